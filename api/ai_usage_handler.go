@@ -0,0 +1,154 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"nofx/config"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AI用量查询的天数范围
+const (
+	defaultAIUsageDays = 7
+	maxAIUsageDays     = 90
+)
+
+// aiUsageTotals 一组AI用量的合计
+type aiUsageTotals struct {
+	Calls            int     `json:"calls"`
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	CostUSD          float64 `json:"cost_usd"`
+}
+
+// add 累加一条用量记录
+func (t *aiUsageTotals) add(r *config.AIUsageRecord) {
+	t.Calls += r.Calls
+	t.PromptTokens += r.PromptTokens
+	t.CompletionTokens += r.CompletionTokens
+	t.CostUSD += r.CostUSD
+}
+
+// traderAIUsage 单个交易员的AI用量（含今日费用和每日预算）
+type traderAIUsage struct {
+	TraderID     string  `json:"trader_id"`
+	TraderName   string  `json:"trader_name"`
+	DailyBudget  float64 `json:"daily_ai_budget"` // 0为不限制
+	TodayCostUSD float64 `json:"today_cost_usd"`
+	aiUsageTotals
+}
+
+// dailyAIUsage 某一天（UTC）所有交易员的AI用量
+type dailyAIUsage struct {
+	Date string `json:"date"`
+	aiUsageTotals
+}
+
+// aiUsageSummary AI用量汇总：用户合计、按交易员、按日期，以及明细（交易员/日期/模型）
+type aiUsageSummary struct {
+	Since    string                  `json:"since"`
+	Total    aiUsageTotals           `json:"total"`
+	ByTrader []*traderAIUsage        `json:"by_trader"`
+	ByDay    []*dailyAIUsage         `json:"by_day"`
+	Records  []*config.AIUsageRecord `json:"records"`
+}
+
+// summarizeAIUsage 汇总AI用量记录；traders 提供交易员名称和预算（已删除的交易员只显示ID）
+func summarizeAIUsage(records []*config.AIUsageRecord, traders []*config.TraderRecord, since, today string) *aiUsageSummary {
+	summary := &aiUsageSummary{
+		Since:    since,
+		ByTrader: []*traderAIUsage{},
+		ByDay:    []*dailyAIUsage{},
+		Records:  records,
+	}
+	if summary.Records == nil {
+		summary.Records = []*config.AIUsageRecord{}
+	}
+
+	byTrader := make(map[string]*traderAIUsage)
+	byDay := make(map[string]*dailyAIUsage)
+	for _, t := range traders {
+		byTrader[t.ID] = &traderAIUsage{TraderID: t.ID, TraderName: t.Name, DailyBudget: t.DailyAIBudget}
+	}
+	for _, r := range records {
+		summary.Total.add(r)
+
+		trader, ok := byTrader[r.TraderID]
+		if !ok {
+			trader = &traderAIUsage{TraderID: r.TraderID}
+			byTrader[r.TraderID] = trader
+		}
+		trader.add(r)
+		if r.Date == today {
+			trader.TodayCostUSD += r.CostUSD
+		}
+
+		day, ok := byDay[r.Date]
+		if !ok {
+			day = &dailyAIUsage{Date: r.Date}
+			byDay[r.Date] = day
+		}
+		day.add(r)
+	}
+
+	for _, trader := range byTrader {
+		summary.ByTrader = append(summary.ByTrader, trader)
+	}
+	sort.Slice(summary.ByTrader, func(i, j int) bool {
+		a, b := summary.ByTrader[i], summary.ByTrader[j]
+		if a.CostUSD != b.CostUSD {
+			return a.CostUSD > b.CostUSD
+		}
+		return a.TraderID < b.TraderID
+	})
+	for _, day := range byDay {
+		summary.ByDay = append(summary.ByDay, day)
+	}
+	sort.Slice(summary.ByDay, func(i, j int) bool { return summary.ByDay[i].Date > summary.ByDay[j].Date })
+	return summary
+}
+
+// handleAIUsage 查询当前用户最近N天（UTC，含今天）的AI token用量和费用
+// 参数: days（默认7，最多90）、trader_id（可选，只看一个交易员）
+func (s *Server) handleAIUsage(c *gin.Context) {
+	userID := c.GetString("user_id")
+	traderID := c.Query("trader_id")
+
+	days := defaultAIUsageDays
+	if raw := c.Query("days"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 1 || parsed > maxAIUsageDays {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("days 必须是1-%d之间的整数", maxAIUsageDays)})
+			return
+		}
+		days = parsed
+	}
+
+	now := time.Now().UTC()
+	since := config.AIUsageDate(now.AddDate(0, 0, -(days - 1)))
+	records, err := s.database.GetAIUsage(userID, traderID, since)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("获取AI用量失败: %v", err)})
+		return
+	}
+	traders, err := s.database.GetTraders(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("获取交易员列表失败: %v", err)})
+		return
+	}
+	if traderID != "" {
+		var selected []*config.TraderRecord
+		for _, t := range traders {
+			if t.ID == traderID {
+				selected = append(selected, t)
+			}
+		}
+		traders = selected
+	}
+
+	c.JSON(http.StatusOK, summarizeAIUsage(records, traders, since, config.AIUsageDate(now)))
+}
@@ -0,0 +1,44 @@
+package api
+
+import (
+	"math"
+	"testing"
+
+	"nofx/config"
+)
+
+func TestSummarizeAIUsage(t *testing.T) {
+	records := []*config.AIUsageRecord{
+		{TraderID: "trader-a", Date: "2025-01-02", Model: "deepseek-chat", Calls: 10, PromptTokens: 50000, CompletionTokens: 5000, CostUSD: 0.02},
+		{TraderID: "trader-a", Date: "2025-01-02", Model: "qwen-turbo", Calls: 2, PromptTokens: 8000, CompletionTokens: 800, CostUSD: 0.001},
+		{TraderID: "trader-b", Date: "2025-01-01", Model: "deepseek-chat", Calls: 20, PromptTokens: 90000, CompletionTokens: 9000, CostUSD: 0.05},
+		{TraderID: "deleted", Date: "2025-01-01", Model: "deepseek-chat", Calls: 1, CostUSD: 0.001},
+	}
+	traders := []*config.TraderRecord{
+		{ID: "trader-a", Name: "A", DailyAIBudget: 1},
+		{ID: "trader-b", Name: "B"},
+		{ID: "trader-idle", Name: "Idle"},
+	}
+
+	summary := summarizeAIUsage(records, traders, "2025-01-01", "2025-01-02")
+	if summary.Total.Calls != 33 || math.Abs(summary.Total.CostUSD-0.072) > 1e-9 {
+		t.Errorf("合计不正确: %+v", summary.Total)
+	}
+	if len(summary.ByTrader) != 4 {
+		t.Fatalf("应包含所有交易员（含无用量和已删除的）: %d", len(summary.ByTrader))
+	}
+	if b := summary.ByTrader[0]; b.TraderID != "trader-b" || b.TodayCostUSD != 0 {
+		t.Errorf("应按费用倒序，B 今天没有费用: %+v", b)
+	}
+	if a := summary.ByTrader[1]; a.TraderName != "A" || a.DailyBudget != 1 || math.Abs(a.TodayCostUSD-0.021) > 1e-9 {
+		t.Errorf("A 的今日费用和预算不正确: %+v", a)
+	}
+	if len(summary.ByDay) != 2 || summary.ByDay[0].Date != "2025-01-02" || summary.ByDay[1].Calls != 21 {
+		t.Errorf("按日期汇总不正确: %+v %+v", summary.ByDay[0], summary.ByDay[1])
+	}
+
+	empty := summarizeAIUsage(nil, nil, "2025-01-01", "2025-01-02")
+	if empty.Records == nil || empty.ByTrader == nil || empty.ByDay == nil {
+		t.Error("没有用量时应返回空数组而不是 null")
+	}
+}
@@ -0,0 +1,258 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"nofx/config"
+	"nofx/decision"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// experimentStatus 将实验存储错误映射为HTTP状态码
+func experimentStatus(err error) int {
+	switch {
+	case errors.Is(err, config.ErrExperimentNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, config.ErrExperimentTraderBusy):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// normalizeSymbolList 规范化逗号分隔的币种列表（去空格、大写、排序），用于比较候选币种是否相同
+func normalizeSymbolList(raw string) string {
+	return normalizeList(strings.ToUpper(raw))
+}
+
+// normalizeList 规范化逗号分隔的列表（去空格、排序），用于比较K线周期和指标是否相同
+func normalizeList(raw string) string {
+	var items []string
+	for _, item := range strings.Split(raw, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	sort.Strings(items)
+	return strings.Join(items, ",")
+}
+
+// experimentConfigMismatch 检查两个交易员除提示词模板外的配置是否一致，返回第一处不一致的说明
+func experimentConfigMismatch(base, other *config.TraderRecord) string {
+	switch {
+	case base.AIModelID != other.AIModelID:
+		return "AI模型"
+	case base.ExchangeID != other.ExchangeID:
+		return "交易所"
+	case normalizeSymbolList(base.TradingSymbols) != normalizeSymbolList(other.TradingSymbols),
+		base.UseCoinPool != other.UseCoinPool, base.UseOITop != other.UseOITop:
+		return "候选币种"
+	case base.BTCETHLeverage != other.BTCETHLeverage, base.AltcoinLeverage != other.AltcoinLeverage:
+		return "杠杆倍数"
+	case base.ScanIntervalMinutes != other.ScanIntervalMinutes:
+		return "扫描间隔"
+	case normalizeList(base.Timeframes) != normalizeList(other.Timeframes):
+		return "K线周期"
+	case normalizeList(base.Indicators) != normalizeList(other.Indicators):
+		return "指标"
+	case base.IsCrossMargin != other.IsCrossMargin:
+		return "保证金模式"
+	case base.MaxSlippagePct != other.MaxSlippagePct:
+		return "滑点上限"
+	case base.AlertTrigger != other.AlertTrigger, base.FillTrigger != other.FillTrigger,
+		base.PriceMoveTriggerPct != other.PriceMoveTriggerPct, base.LiquidationBufferPct != other.LiquidationBufferPct,
+		base.TriggerGapSeconds != other.TriggerGapSeconds:
+		return "事件触发"
+	case base.PromptLanguage != other.PromptLanguage:
+		return "提示词语言"
+	case base.CustomPrompt != other.CustomPrompt:
+		return "自定义prompt"
+	case base.AgentMode != other.AgentMode, base.AgentMode && base.MaxToolCalls != other.MaxToolCalls:
+		return "代理模式"
+	case base.RiskReview != other.RiskReview, base.RiskReviewPrompt != other.RiskReviewPrompt:
+		return "风控审核"
+	case base.TradeMemory != other.TradeMemory, base.TradeMemory && base.ReflectionInterval != other.ReflectionInterval:
+		return "交易记忆"
+	case base.ValidationRules != other.ValidationRules:
+		return "校验规则"
+	case base.DailyAIBudget != other.DailyAIBudget, base.BudgetFallbackModel != other.BudgetFallbackModel:
+		return "AI预算"
+	}
+	return ""
+}
+
+// checkExperimentPromptLock 进行中实验的分组交易员不能启用按市场状态切换模板或覆盖基础prompt
+// 两者都会绕过分组固定的模板版本，使实验结果不再只反映模板差异
+func (s *Server) checkExperimentPromptLock(userID, traderID, regimeTemplates string, overrideBase bool) (int, error) {
+	if regimeTemplates == "" && !overrideBase {
+		return http.StatusOK, nil
+	}
+	name, err := s.database.RunningExperimentName(userID, traderID)
+	if err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("查询交易员参与的实验失败: %w", err)
+	}
+	if name != "" {
+		return http.StatusConflict, fmt.Errorf("交易员正在参与实验 %s，结束实验前不能启用按市场状态切换模板或覆盖基础prompt", name)
+	}
+	return http.StatusOK, nil
+}
+
+// resolveExperimentTemplate 解析分组使用的模板版本
+// 优先使用用户模板（version<=0 时固定为当前最新版本），其次为 prompts/ 目录的系统模板（版本号为0）
+func (s *Server) resolveExperimentTemplate(userID, name string, version int) (int, error) {
+	v, err := s.database.GetPromptTemplateVersion(userID, name, version)
+	if err == nil {
+		return v.Version, nil
+	}
+	if !errors.Is(err, config.ErrPromptTemplateNotFound) {
+		return 0, err
+	}
+	if _, err := decision.GetPromptTemplate(name); err == nil && version <= 0 {
+		return 0, nil
+	}
+	if version > 0 {
+		return 0, fmt.Errorf("模板版本不存在: %s v%d", name, version)
+	}
+	return 0, fmt.Errorf("模板不存在: %s", name)
+}
+
+// handleGetExperiments 获取当前用户的提示词A/B实验列表
+func (s *Server) handleGetExperiments(c *gin.Context) {
+	userID := c.GetString("user_id")
+	experiments, err := s.database.GetExperiments(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("获取实验列表失败: %v", err)})
+		return
+	}
+	if experiments == nil {
+		experiments = []*config.ExperimentRecord{}
+	}
+	c.JSON(http.StatusOK, gin.H{"experiments": experiments})
+}
+
+// handleCreateExperiment 创建提示词A/B实验
+// 各分组的交易员除提示词模板外配置必须一致（AI模型、交易所、候选币种等），第一个分组为对照组
+func (s *Server) handleCreateExperiment(c *gin.Context) {
+	userID := c.GetString("user_id")
+	var req struct {
+		Name string `json:"name" binding:"required"`
+		Arms []struct {
+			TraderID        string `json:"trader_id" binding:"required"`
+			TemplateName    string `json:"template_name" binding:"required"`
+			TemplateVersion int    `json:"template_version"` // 用户模板版本（0为最新）
+		} `json:"arms" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(req.Arms) < 2 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "实验至少需要两个分组"})
+		return
+	}
+
+	exp := &config.ExperimentRecord{
+		ID:     uuid.New().String(),
+		UserID: userID,
+		Name:   req.Name,
+	}
+	var base *config.TraderRecord
+	seenTraders := make(map[string]bool)
+	seenTemplates := make(map[string]bool)
+	for _, arm := range req.Arms {
+		if seenTraders[arm.TraderID] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("交易员 %s 重复出现在多个分组中", arm.TraderID)})
+			return
+		}
+		seenTraders[arm.TraderID] = true
+
+		traderRecord, _, _, err := s.database.GetTraderConfig(userID, arm.TraderID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("交易员不存在或无访问权限: %s", arm.TraderID)})
+			return
+		}
+		if traderRecord.RegimeTemplates != "" || traderRecord.OverrideBasePrompt {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("交易员 %s 配置了按市场状态切换模板或覆盖基础prompt，无法固定提示词模板", traderRecord.Name)})
+			return
+		}
+		if base == nil {
+			base = traderRecord
+		} else if field := experimentConfigMismatch(base, traderRecord); field != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("交易员 %s 与 %s 的%s不同，分组之间只能有提示词模板不同", traderRecord.Name, base.Name, field)})
+			return
+		}
+
+		version, err := s.resolveExperimentTemplate(userID, arm.TemplateName, arm.TemplateVersion)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		key := fmt.Sprintf("%s@%d", arm.TemplateName, version)
+		if seenTemplates[key] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("模板 %s v%d 重复出现在多个分组中", arm.TemplateName, version)})
+			return
+		}
+		seenTemplates[key] = true
+
+		exp.Arms = append(exp.Arms, config.ExperimentArm{
+			TraderID:        arm.TraderID,
+			TemplateName:    arm.TemplateName,
+			TemplateVersion: version,
+		})
+	}
+
+	if err := s.database.CreateExperiment(exp); err != nil {
+		c.JSON(experimentStatus(err), gin.H{"error": fmt.Sprintf("创建实验失败: %v", err)})
+		return
+	}
+
+	// 内存中的交易员立即切换到分组的模板版本
+	for _, arm := range exp.Arms {
+		if trader, err := s.traderManager.GetTrader(arm.TraderID); err == nil {
+			trader.SetSystemPrompt(arm.TemplateName, arm.TemplateVersion)
+		}
+	}
+
+	created, err := s.database.GetExperiment(userID, exp.ID)
+	if err != nil {
+		c.JSON(experimentStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	log.Printf("✓ 提示词实验已创建: user=%s, id=%s, name=%s, arms=%d", userID, created.ID, created.Name, len(created.Arms))
+	c.JSON(http.StatusCreated, created)
+}
+
+// handleGetExperiment 获取实验详情和各分组的表现报告
+func (s *Server) handleGetExperiment(c *gin.Context) {
+	userID := c.GetString("user_id")
+	exp, err := s.database.GetExperiment(userID, c.Param("id"))
+	if err != nil {
+		c.JSON(experimentStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, s.traderManager.EvaluateExperiment(exp))
+}
+
+// handleStopExperiment 结束实验（之后的交易不再计入结果），返回最终报告
+func (s *Server) handleStopExperiment(c *gin.Context) {
+	userID := c.GetString("user_id")
+	id := c.Param("id")
+	if err := s.database.StopExperiment(userID, id); err != nil {
+		c.JSON(experimentStatus(err), gin.H{"error": fmt.Sprintf("结束实验失败: %v", err)})
+		return
+	}
+	exp, err := s.database.GetExperiment(userID, id)
+	if err != nil {
+		c.JSON(experimentStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	log.Printf("✓ 提示词实验已结束: user=%s, id=%s", userID, id)
+	c.JSON(http.StatusOK, s.traderManager.EvaluateExperiment(exp))
+}
@@ -0,0 +1,175 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"nofx/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestExperimentConfigMismatch(t *testing.T) {
+	base := &config.TraderRecord{
+		Name:           "A",
+		AIModelID:      "deepseek",
+		ExchangeID:     "binance",
+		TradingSymbols: "BTCUSDT, ETHUSDT",
+		BTCETHLeverage: 5,
+		Timeframes:     "15m,1h",
+	}
+
+	same := *base
+	same.Name = "B"
+	same.TradingSymbols = "ethusdt,BTCUSDT"
+	same.Timeframes = "1h, 15m"
+	same.SystemPromptTemplate = "trend"
+	if field := experimentConfigMismatch(base, &same); field != "" {
+		t.Errorf("只有模板和列表顺序不同，不应报告差异: %s", field)
+	}
+
+	otherModel := same
+	otherModel.AIModelID = "qwen"
+	if field := experimentConfigMismatch(base, &otherModel); field != "AI模型" {
+		t.Errorf("应报告AI模型不同, got %q", field)
+	}
+
+	otherCoins := same
+	otherCoins.UseCoinPool = true
+	if field := experimentConfigMismatch(base, &otherCoins); field != "候选币种" {
+		t.Errorf("应报告候选币种不同, got %q", field)
+	}
+
+	for want, mutate := range map[string]func(r *config.TraderRecord){
+		"K线周期":  func(r *config.TraderRecord) { r.Timeframes = "4h" },
+		"指标":    func(r *config.TraderRecord) { r.Indicators = "obv" },
+		"保证金模式": func(r *config.TraderRecord) { r.IsCrossMargin = true },
+		"滑点上限":  func(r *config.TraderRecord) { r.MaxSlippagePct = 1 },
+		"事件触发":  func(r *config.TraderRecord) { r.FillTrigger = true },
+	} {
+		other := same
+		mutate(&other)
+		if field := experimentConfigMismatch(base, &other); field != want {
+			t.Errorf("应报告%s不同, got %q", want, field)
+		}
+	}
+}
+
+// newExperimentTestServer 使用临时数据库创建服务器，并准备用户、AI模型和交易所
+func newExperimentTestServer(t *testing.T) (*Server, *config.Database) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	db, err := config.NewDatabase(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatalf("创建测试数据库失败: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := db.CreateUser(&config.User{ID: "user-1", Email: "user-1@test.com", PasswordHash: "hash"}); err != nil {
+		t.Fatalf("创建用户失败: %v", err)
+	}
+	if err := db.CreateAIModel("user-1", "user-1_deepseek", "DeepSeek", "deepseek", true, "key", ""); err != nil {
+		t.Fatalf("创建AI模型失败: %v", err)
+	}
+	if err := db.CreateExchange("user-1", "user-1_binance", "Binance", "cex", true, "key", "secret", false, "", "", "", ""); err != nil {
+		t.Fatalf("创建交易所失败: %v", err)
+	}
+	return &Server{database: db}, db
+}
+
+// createTestTrader 创建实验测试用的交易员
+func createTestTrader(t *testing.T, db *config.Database, id string, mutate func(r *config.TraderRecord)) {
+	t.Helper()
+	record := &config.TraderRecord{
+		ID: id, UserID: "user-1", Name: id, AIModelID: "user-1_deepseek", ExchangeID: "user-1_binance",
+		InitialBalance: 1000, ScanIntervalMinutes: 3, BTCETHLeverage: 5, AltcoinLeverage: 5,
+		SystemPromptTemplate: "default", Timeframes: "15m,1h", TriggerGapSeconds: 60,
+	}
+	if mutate != nil {
+		mutate(record)
+	}
+	if err := db.CreateTrader(record); err != nil {
+		t.Fatalf("创建交易员失败: %v", err)
+	}
+}
+
+// serveJSON 以当前用户身份调用处理函数
+func serveJSON(handler gin.HandlerFunc, method, body string, params ...gin.Param) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(method, "/", strings.NewReader(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Params = params
+	c.Set("user_id", "user-1")
+	handler(c)
+	return w
+}
+
+func TestHandleCreateExperiment_RejectsMismatchedArms(t *testing.T) {
+	s, db := newExperimentTestServer(t)
+	createTestTrader(t, db, "arm-a", nil)
+	createTestTrader(t, db, "arm-b", func(r *config.TraderRecord) { r.Timeframes = "4h" })
+	createTestTrader(t, db, "arm-c", func(r *config.TraderRecord) { r.PriceMoveTriggerPct = 2 })
+	if _, err := db.CreatePromptTemplate("user-1", "trend", "趋势策略", ""); err != nil {
+		t.Fatalf("创建模板失败: %v", err)
+	}
+
+	for _, other := range []string{"arm-b", "arm-c"} {
+		body := `{"name":"exp","arms":[{"trader_id":"arm-a","template_name":"trend"},{"trader_id":"` + other + `","template_name":"trend"}]}`
+		w := serveJSON(s.handleCreateExperiment, http.MethodPost, body)
+		var resp struct {
+			Error string `json:"error"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		if w.Code != http.StatusBadRequest || !strings.Contains(resp.Error, "分组之间只能有提示词模板不同") {
+			t.Errorf("%s 配置不同应拒绝创建实验: %d %s", other, w.Code, w.Body.String())
+		}
+	}
+	// 配置一致的分组通过配置检查（此处因模板版本重复而被拒绝）
+	createTestTrader(t, db, "arm-d", nil)
+	body := `{"name":"exp","arms":[{"trader_id":"arm-a","template_name":"trend"},{"trader_id":"arm-d","template_name":"trend"}]}`
+	if w := serveJSON(s.handleCreateExperiment, http.MethodPost, body); !strings.Contains(w.Body.String(), "重复出现在多个分组中") {
+		t.Errorf("配置一致的分组不应报告配置差异: %s", w.Body.String())
+	}
+	if experiments, _ := db.GetExperiments("user-1"); len(experiments) != 0 {
+		t.Errorf("不应创建实验: %d", len(experiments))
+	}
+}
+
+func TestExperimentPromptLock(t *testing.T) {
+	s, db := newExperimentTestServer(t)
+	createTestTrader(t, db, "arm-a", nil)
+	createTestTrader(t, db, "arm-b", nil)
+	createTestTrader(t, db, "solo", nil)
+	exp := &config.ExperimentRecord{ID: "exp-1", UserID: "user-1", Name: "exp", Arms: []config.ExperimentArm{
+		{TraderID: "arm-a", TemplateName: "trend", TemplateVersion: 1},
+		{TraderID: "arm-b", TemplateName: "trend", TemplateVersion: 2},
+	}}
+	if err := db.CreateExperiment(exp); err != nil {
+		t.Fatalf("创建实验失败: %v", err)
+	}
+
+	if status, err := s.checkExperimentPromptLock("user-1", "arm-a", `{"ranging":"trend"}`, false); status != http.StatusConflict || err == nil {
+		t.Errorf("实验进行中启用市场状态模板应被拒绝: %d %v", status, err)
+	}
+	if _, err := s.checkExperimentPromptLock("user-1", "arm-a", "", false); err != nil {
+		t.Errorf("未启用市场状态模板时不应拒绝: %v", err)
+	}
+	if _, err := s.checkExperimentPromptLock("user-1", "solo", `{"ranging":"trend"}`, true); err != nil {
+		t.Errorf("未参与实验的交易员不应拒绝: %v", err)
+	}
+
+	w := serveJSON(s.handleUpdateTraderPrompt, http.MethodPut, `{"custom_prompt":"x","override_base_prompt":true}`, gin.Param{Key: "id", Value: "arm-b"})
+	if w.Code != http.StatusConflict {
+		t.Errorf("实验进行中覆盖基础prompt应被拒绝: %d %s", w.Code, w.Body.String())
+	}
+
+	if err := db.StopExperiment("user-1", "exp-1"); err != nil {
+		t.Fatalf("结束实验失败: %v", err)
+	}
+	if _, err := s.checkExperimentPromptLock("user-1", "arm-a", `{"ranging":"trend"}`, true); err != nil {
+		t.Errorf("实验结束后不应拒绝: %v", err)
+	}
+}
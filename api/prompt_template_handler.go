@@ -0,0 +1,262 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"nofx/config"
+	"nofx/decision"
+	"regexp"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+const maxPromptTemplateSize = 64 * 1024 // 用户提示词模板内容上限（字节）
+
+// rePromptTemplateName 模板名称：字母、数字、下划线和短横线，最长64个字符
+var rePromptTemplateName = regexp.MustCompile(`^[\p{L}\p{N}_-]{1,64}$`)
+
+// validatePromptTemplate 校验模板名称、大小和 text/template 语法
+func validatePromptTemplate(name, content string) error {
+	if !rePromptTemplateName.MatchString(name) {
+		return fmt.Errorf("模板名称只能包含字母、数字、下划线和短横线（最长64个字符）")
+	}
+	if content == "" {
+		return fmt.Errorf("模板内容不能为空")
+	}
+	if len(content) > maxPromptTemplateSize {
+		return fmt.Errorf("模板内容不能超过 %d KB", maxPromptTemplateSize/1024)
+	}
+	_, err := decision.NewPromptTemplate(name, 0, content)
+	return err
+}
+
+// promptTemplateErrorStatus 将模板存储错误映射为HTTP状态码
+func promptTemplateErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, config.ErrPromptTemplateNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, config.ErrPromptTemplateExists):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// handleGetUserPromptTemplates 获取当前用户的提示词模板列表
+func (s *Server) handleGetUserPromptTemplates(c *gin.Context) {
+	userID := c.GetString("user_id")
+	templates, err := s.database.GetPromptTemplates(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("获取提示词模板失败: %v", err)})
+		return
+	}
+	if templates == nil {
+		templates = []*config.PromptTemplateRecord{}
+	}
+	c.JSON(http.StatusOK, gin.H{"templates": templates})
+}
+
+// handleCreateUserPromptTemplate 创建用户提示词模板（版本1）
+func (s *Server) handleCreateUserPromptTemplate(c *gin.Context) {
+	userID := c.GetString("user_id")
+	var req struct {
+		Name    string `json:"name" binding:"required"`
+		Content string `json:"content" binding:"required"`
+		Note    string `json:"note"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validatePromptTemplate(req.Name, req.Content); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	version, err := s.database.CreatePromptTemplate(userID, req.Name, req.Content, req.Note)
+	if err != nil {
+		c.JSON(promptTemplateErrorStatus(err), gin.H{"error": fmt.Sprintf("创建提示词模板失败: %v", err)})
+		return
+	}
+
+	log.Printf("✓ 用户提示词模板已创建: user=%s, name=%s, version=%d", userID, version.Name, version.Version)
+	c.JSON(http.StatusCreated, version)
+}
+
+// handleGetUserPromptTemplate 获取用户提示词模板的指定版本（?version=N，默认最新）及版本历史
+func (s *Server) handleGetUserPromptTemplate(c *gin.Context) {
+	userID := c.GetString("user_id")
+	name := c.Param("name")
+
+	version := 0
+	if raw := c.Query("version"); raw != "" {
+		v, err := strconv.Atoi(raw)
+		if err != nil || v <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "版本号必须是正整数"})
+			return
+		}
+		version = v
+	}
+
+	current, err := s.database.GetPromptTemplateVersion(userID, name, version)
+	if err != nil {
+		c.JSON(promptTemplateErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	versions, err := s.database.GetPromptTemplateVersions(userID, name)
+	if err != nil {
+		c.JSON(promptTemplateErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	// 版本历史只返回元数据，内容按需查询
+	history := make([]gin.H, 0, len(versions))
+	for _, v := range versions {
+		history = append(history, gin.H{
+			"version":    v.Version,
+			"note":       v.Note,
+			"created_at": v.CreatedAt,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"name":       current.Name,
+		"version":    current.Version,
+		"content":    current.Content,
+		"note":       current.Note,
+		"created_at": current.CreatedAt,
+		"versions":   history,
+	})
+}
+
+// handleUpdateUserPromptTemplate 编辑用户提示词模板（保存为新版本）
+func (s *Server) handleUpdateUserPromptTemplate(c *gin.Context) {
+	userID := c.GetString("user_id")
+	name := c.Param("name")
+	var req struct {
+		Content string `json:"content" binding:"required"`
+		Note    string `json:"note"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validatePromptTemplate(name, req.Content); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	version, err := s.database.AddPromptTemplateVersion(userID, name, req.Content, req.Note)
+	if err != nil {
+		c.JSON(promptTemplateErrorStatus(err), gin.H{"error": fmt.Sprintf("保存提示词模板失败: %v", err)})
+		return
+	}
+
+	log.Printf("✓ 用户提示词模板已更新: user=%s, name=%s, version=%d", userID, version.Name, version.Version)
+	c.JSON(http.StatusOK, version)
+}
+
+// handleDeleteUserPromptTemplate 删除用户提示词模板（历史版本保留，用于追溯决策记录）
+func (s *Server) handleDeleteUserPromptTemplate(c *gin.Context) {
+	userID := c.GetString("user_id")
+	name := c.Param("name")
+
+	if err := s.database.DeletePromptTemplate(userID, name); err != nil {
+		c.JSON(promptTemplateErrorStatus(err), gin.H{"error": fmt.Sprintf("删除提示词模板失败: %v", err)})
+		return
+	}
+
+	log.Printf("✓ 用户提示词模板已删除: user=%s, name=%s", userID, name)
+	c.JSON(http.StatusOK, gin.H{"message": "提示词模板已删除"})
+}
+
+// handleForkPromptTemplate 以现有模板为基础创建新的用户模板
+// 来源优先为用户自己的模板（可指定版本），其次为 prompts/ 目录的系统模板
+func (s *Server) handleForkPromptTemplate(c *gin.Context) {
+	userID := c.GetString("user_id")
+	source := c.Param("name")
+	var req struct {
+		Name    string `json:"name" binding:"required"` // 新模板名称
+		Version int    `json:"version"`                 // 来源版本（0为最新，仅用户模板有效）
+		Note    string `json:"note"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var content, origin string
+	if v, err := s.database.GetPromptTemplateVersion(userID, source, req.Version); err == nil {
+		content = v.Content
+		origin = fmt.Sprintf("%s v%d", v.Name, v.Version)
+	} else if !errors.Is(err, config.ErrPromptTemplateNotFound) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	} else if builtin, err := decision.GetPromptTemplate(source); err == nil && req.Version == 0 {
+		content = builtin.Content
+		origin = builtin.Name
+	} else {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("模板不存在: %s", source)})
+		return
+	}
+
+	if err := validatePromptTemplate(req.Name, content); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	note := req.Note
+	if note == "" {
+		note = "fork: " + origin
+	}
+
+	version, err := s.database.CreatePromptTemplate(userID, req.Name, content, note)
+	if err != nil {
+		c.JSON(promptTemplateErrorStatus(err), gin.H{"error": fmt.Sprintf("创建提示词模板失败: %v", err)})
+		return
+	}
+
+	log.Printf("✓ 用户提示词模板已派生: user=%s, %s -> %s", userID, origin, version.Name)
+	c.JSON(http.StatusCreated, version)
+}
+
+// handleDiffUserPromptTemplate 对比用户提示词模板的两个版本（?from=N&to=M，to 默认最新版本）
+func (s *Server) handleDiffUserPromptTemplate(c *gin.Context) {
+	userID := c.GetString("user_id")
+	name := c.Param("name")
+
+	from, err := strconv.Atoi(c.Query("from"))
+	if err != nil || from <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from 必须是正整数版本号"})
+		return
+	}
+	to := 0
+	if raw := c.Query("to"); raw != "" {
+		if to, err = strconv.Atoi(raw); err != nil || to <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "to 必须是正整数版本号"})
+			return
+		}
+	}
+
+	fromVersion, err := s.database.GetPromptTemplateVersion(userID, name, from)
+	if err != nil {
+		c.JSON(promptTemplateErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	toVersion, err := s.database.GetPromptTemplateVersion(userID, name, to)
+	if err != nil {
+		c.JSON(promptTemplateErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	diff := decision.DiffPrompts(fromVersion.Content, toVersion.Content)
+	c.JSON(http.StatusOK, gin.H{
+		"name":    name,
+		"from":    fromVersion.Version,
+		"to":      toVersion.Version,
+		"lines":   diff,
+		"unified": decision.FormatPromptDiff(diff),
+	})
+}
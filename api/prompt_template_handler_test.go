@@ -0,0 +1,31 @@
+package api
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidatePromptTemplate(t *testing.T) {
+	tests := []struct {
+		name        string
+		tmplName    string
+		content     string
+		shouldError bool
+	}{
+		{name: "正常模板", tmplName: "trend_v2", content: "最多{{.MaxPositions}}个持仓", shouldError: false},
+		{name: "中文名称", tmplName: "趋势策略", content: "策略", shouldError: false},
+		{name: "名称含路径", tmplName: "../default", content: "策略", shouldError: true},
+		{name: "空内容", tmplName: "empty", content: "", shouldError: true},
+		{name: "语法错误", tmplName: "broken", content: "{{if .Regime}}", shouldError: true},
+		{name: "内容过大", tmplName: "huge", content: strings.Repeat("a", maxPromptTemplateSize+1), shouldError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validatePromptTemplate(tt.tmplName, tt.content)
+			if (err != nil) != tt.shouldError {
+				t.Errorf("validatePromptTemplate() error = %v, shouldError %v", err, tt.shouldError)
+			}
+		})
+	}
+}
@@ -14,6 +14,7 @@ import (
 	"nofx/decision"
 	"nofx/hook"
 	"nofx/manager"
+	"nofx/market"
 	"nofx/trader"
 	"strconv"
 	"strings"
@@ -124,6 +125,9 @@ func (s *Server) setupRoutes() {
 			// 服务器IP查询（需要认证，用于白名单配置）
 			protected.GET("/server-ip", s.handleGetServerIP)
 
+			// 行情数据流健康状态（包含订阅的交易对和周期，需要认证）
+			protected.GET("/market/health", s.handleMarketHealth)
+
 			// AI交易员管理
 			protected.GET("/my-traders", s.handleTraderList)
 			protected.GET("/traders/:id/config", s.handleGetTraderConfig)
@@ -142,6 +146,21 @@ func (s *Server) setupRoutes() {
 			protected.GET("/exchanges", s.handleGetExchangeConfigs)
 			protected.PUT("/exchanges", s.handleUpdateExchangeConfigs)
 
+			// 用户提示词模板（数据库存储，带版本历史）
+			protected.GET("/user/prompt-templates", s.handleGetUserPromptTemplates)
+			protected.POST("/user/prompt-templates", s.handleCreateUserPromptTemplate)
+			protected.GET("/user/prompt-templates/:name", s.handleGetUserPromptTemplate)
+			protected.PUT("/user/prompt-templates/:name", s.handleUpdateUserPromptTemplate)
+			protected.DELETE("/user/prompt-templates/:name", s.handleDeleteUserPromptTemplate)
+			protected.POST("/user/prompt-templates/:name/fork", s.handleForkPromptTemplate)
+			protected.GET("/user/prompt-templates/:name/diff", s.handleDiffUserPromptTemplate)
+
+			// 提示词A/B实验
+			protected.GET("/experiments", s.handleGetExperiments)
+			protected.POST("/experiments", s.handleCreateExperiment)
+			protected.GET("/experiments/:id", s.handleGetExperiment)
+			protected.POST("/experiments/:id/stop", s.handleStopExperiment)
+
 			// 用户信号源配置
 			protected.GET("/user/signal-sources", s.handleGetUserSignalSource)
 			protected.POST("/user/signal-sources", s.handleSaveUserSignalSource)
@@ -154,6 +173,7 @@ func (s *Server) setupRoutes() {
 			protected.GET("/decisions/latest", s.handleLatestDecisions)
 			protected.GET("/statistics", s.handleStatistics)
 			protected.GET("/performance", s.handlePerformance)
+			protected.GET("/ai-usage", s.handleAIUsage)
 		}
 	}
 }
@@ -166,6 +186,16 @@ func (s *Server) handleHealth(c *gin.Context) {
 	})
 }
 
+// handleMarketHealth 行情数据流健康状态（WebSocket 连接、静默/轮询中的K线流）
+func (s *Server) handleMarketHealth(c *gin.Context) {
+	report := market.GetStreamHealth()
+	if report == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "行情监控器未启动"})
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
 // handleGetSystemConfig 获取系统配置（客户端需要知道的配置）
 func (s *Server) handleGetSystemConfig(c *gin.Context) {
 	// 获取默认币种
@@ -380,22 +410,97 @@ func (s *Server) getTraderFromQuery(c *gin.Context) (*manager.TraderManager, str
 	return s.traderManager, traderID, nil
 }
 
+// defaultMaxSlippagePct 默认开仓滑点上限（百分比）
+const defaultMaxSlippagePct = 0.5
+
+// defaultTriggerGapSeconds 事件触发的AI决策与上个周期的默认最小间隔（秒）
+const defaultTriggerGapSeconds = 60
+
+// validateEventTriggers 校验事件触发配置
+func validateEventTriggers(priceMoveTriggerPct, liquidationBufferPct float64, triggerGapSeconds int) error {
+	if priceMoveTriggerPct < 0 || priceMoveTriggerPct > 50 {
+		return fmt.Errorf("价格变化触发阈值必须在0-50%%之间")
+	}
+	if liquidationBufferPct < 0 || liquidationBufferPct > 50 {
+		return fmt.Errorf("强平距离触发阈值必须在0-50%%之间")
+	}
+	if triggerGapSeconds < 10 || triggerGapSeconds > 3600 {
+		return fmt.Errorf("事件触发最小间隔必须在10-3600秒之间")
+	}
+	return nil
+}
+
+// maxReflectionInterval AI复盘间隔的最大值（周期数）
+const maxReflectionInterval = 1000
+
+// validateReflectionInterval 校验AI复盘间隔（0为不复盘）
+func validateReflectionInterval(interval int) error {
+	if interval < 0 || interval > maxReflectionInterval {
+		return fmt.Errorf("复盘间隔必须在0-%d个周期之间", maxReflectionInterval)
+	}
+	return nil
+}
+
+// maxDailyAIBudget 每日AI费用预算的最大值（美元）
+const maxDailyAIBudget = 10000
+
+// validateAIBudget 校验每日AI费用预算（0为不限制）和备用模型
+func validateAIBudget(budget float64, fallbackModel string) error {
+	if budget < 0 || budget > maxDailyAIBudget {
+		return fmt.Errorf("每日AI预算必须在0-%d美元之间", maxDailyAIBudget)
+	}
+	if strings.ContainsAny(fallbackModel, " \t\n") {
+		return fmt.Errorf("备用模型名称不能包含空白字符: %q", fallbackModel)
+	}
+	return nil
+}
+
+// maxToolCallsLimit 代理模式每个周期工具调用上限的最大值
+const maxToolCallsLimit = 30
+
+// validateMaxToolCalls 校验代理模式的工具调用上限（0为默认值）
+func validateMaxToolCalls(maxToolCalls int) error {
+	if maxToolCalls < 0 || maxToolCalls > maxToolCallsLimit {
+		return fmt.Errorf("工具调用上限必须在0-%d之间", maxToolCallsLimit)
+	}
+	return nil
+}
+
 // AI交易员管理相关结构体
 type CreateTraderRequest struct {
-	Name                 string  `json:"name" binding:"required"`
-	AIModelID            string  `json:"ai_model_id" binding:"required"`
-	ExchangeID           string  `json:"exchange_id" binding:"required"`
-	InitialBalance       float64 `json:"initial_balance"`
-	ScanIntervalMinutes  int     `json:"scan_interval_minutes"`
-	BTCETHLeverage       int     `json:"btc_eth_leverage"`
-	AltcoinLeverage      int     `json:"altcoin_leverage"`
-	TradingSymbols       string  `json:"trading_symbols"`
-	CustomPrompt         string  `json:"custom_prompt"`
-	OverrideBasePrompt   bool    `json:"override_base_prompt"`
-	SystemPromptTemplate string  `json:"system_prompt_template"` // 系统提示词模板名称
-	IsCrossMargin        *bool   `json:"is_cross_margin"`        // 指针类型，nil表示使用默认值true
-	UseCoinPool          bool    `json:"use_coin_pool"`
-	UseOITop             bool    `json:"use_oi_top"`
+	Name                 string   `json:"name" binding:"required"`
+	AIModelID            string   `json:"ai_model_id" binding:"required"`
+	ExchangeID           string   `json:"exchange_id" binding:"required"`
+	InitialBalance       float64  `json:"initial_balance"`
+	ScanIntervalMinutes  int      `json:"scan_interval_minutes"`
+	BTCETHLeverage       int      `json:"btc_eth_leverage"`
+	AltcoinLeverage      int      `json:"altcoin_leverage"`
+	TradingSymbols       string   `json:"trading_symbols"`
+	CustomPrompt         string   `json:"custom_prompt"`
+	OverrideBasePrompt   bool     `json:"override_base_prompt"`
+	SystemPromptTemplate string   `json:"system_prompt_template"` // 系统提示词模板名称
+	IsCrossMargin        *bool    `json:"is_cross_margin"`        // 指针类型，nil表示使用默认值true
+	UseCoinPool          bool     `json:"use_coin_pool"`
+	UseOITop             bool     `json:"use_oi_top"`
+	Timeframes           string   `json:"timeframes"`             // K线周期，逗号分隔（如 "1m,15m,1h"，空值使用系统默认）
+	Indicators           string   `json:"indicators"`             // 提示词输出的指标，逗号分隔（空值为基础指标）
+	MaxSlippagePct       *float64 `json:"max_slippage_pct"`       // 开仓滑点上限（百分比），nil使用默认值0.5，0为不检查
+	AlertTrigger         bool     `json:"alert_trigger"`          // 市场警报是否触发AI决策周期
+	PriceMoveTriggerPct  float64  `json:"price_move_trigger_pct"` // 持仓价格相对上个周期变化触发阈值（百分比），0为关闭
+	LiquidationBufferPct float64  `json:"liquidation_buffer_pct"` // 标记价距强平价触发阈值（百分比），0为关闭
+	FillTrigger          bool     `json:"fill_trigger"`           // 持仓在周期外被平掉（止盈/止损、强平或手动平仓）是否触发AI决策周期
+	TriggerGapSeconds    *int     `json:"trigger_gap_seconds"`    // 事件触发与上个周期的最小间隔（秒），nil使用默认值60
+	RegimeTemplates      string   `json:"regime_templates"`       // 市场状态 -> 系统提示词模板（JSON对象，如 {"ranging":"conservative"}），空值不切换
+	PromptLanguage       string   `json:"prompt_language"`        // 系统提示词语言（zh/en），空值为中文
+	AgentMode            bool     `json:"agent_mode"`             // 代理模式：AI先看概览，再通过工具按需查询详细数据
+	MaxToolCalls         int      `json:"max_tool_calls"`         // 代理模式每个周期的工具调用上限，0使用默认值
+	RiskReview           bool     `json:"risk_review"`            // 是否由风控经理审核开仓决策（批准/缩小/否决）
+	RiskReviewPrompt     string   `json:"risk_review_prompt"`     // 额外风控规则
+	TradeMemory          bool     `json:"trade_memory"`           // 是否在提示词中加入交易记忆
+	ReflectionInterval   int      `json:"reflection_interval"`    // AI复盘间隔（周期数），0为不复盘
+	ValidationRules      string   `json:"validation_rules"`       // 开仓校验规则（JSON对象，如 {"min_risk_reward":2}），空值使用默认规则
+	DailyAIBudget        float64  `json:"daily_ai_budget"`        // 每日AI费用预算（美元），0为不限制
+	BudgetFallbackModel  string   `json:"budget_fallback_model"`  // 超出预算后改用的模型，空值跳过周期
 }
 
 type ModelConfig struct {
@@ -437,6 +542,7 @@ type SafeExchangeConfig struct {
 	HyperliquidWalletAddr string `json:"hyperliquidWalletAddr"` // Hyperliquid钱包地址（不敏感）
 	AsterUser             string `json:"asterUser"`             // Aster用户名（不敏感）
 	AsterSigner           string `json:"asterSigner"`           // Aster签名者（不敏感）
+	PositionMode          string `json:"positionMode"`          // 持仓模式: hedge / one_way
 }
 
 type UpdateModelConfigRequest struct {
@@ -458,6 +564,10 @@ type UpdateExchangeConfigRequest struct {
 		AsterUser             string `json:"aster_user"`
 		AsterSigner           string `json:"aster_signer"`
 		AsterPrivateKey       string `json:"aster_private_key"`
+		PositionMode          string `json:"position_mode"`
+
+		// Hyperliquid 子账户/Vault地址：nil=不修改, ""=清除（恢复在主钱包交易）
+		HyperliquidVaultAddr *string `json:"hyperliquid_vault_addr"`
 	} `json:"exchanges"`
 }
 
@@ -485,13 +595,73 @@ func (s *Server) handleCreateTrader(c *gin.Context) {
 		symbols := strings.Split(req.TradingSymbols, ",")
 		for _, symbol := range symbols {
 			symbol = strings.TrimSpace(symbol)
-			if symbol != "" && !strings.HasSuffix(strings.ToUpper(symbol), "USDT") {
-				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("无效的币种格式: %s，必须以USDT结尾", symbol)})
+			// 支持 BTC、BTCUSDT、BTCUSDC 等写法，实际可交易性在运行时按交易所品种列表校验
+			if symbol != "" && !market.IsValidSymbol(symbol) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("无效的币种格式: %s，应为币种名称或以USDT/USDC结尾的交易对", symbol)})
 				return
 			}
 		}
 	}
 
+	// 校验K线周期和指标
+	if _, err := market.NewDataConfig(req.Timeframes, req.Indicators); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 校验滑点上限
+	maxSlippagePct := defaultMaxSlippagePct
+	if req.MaxSlippagePct != nil {
+		maxSlippagePct = *req.MaxSlippagePct
+	}
+	if maxSlippagePct < 0 || maxSlippagePct > 10 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "滑点上限必须在0-10%之间"})
+		return
+	}
+
+	// 校验事件触发配置
+	triggerGapSeconds := defaultTriggerGapSeconds
+	if req.TriggerGapSeconds != nil {
+		triggerGapSeconds = *req.TriggerGapSeconds
+	}
+	if err := validateEventTriggers(req.PriceMoveTriggerPct, req.LiquidationBufferPct, triggerGapSeconds); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 校验按市场状态选择的提示词模板
+	userTemplates, err := s.database.ListPromptTemplateNames(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("获取提示词模板失败: %v", err)})
+		return
+	}
+	if _, err := decision.ParseRegimeTemplates(req.RegimeTemplates, userTemplates); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	promptLanguage, err := decision.ParsePromptLanguage(req.PromptLanguage)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validateMaxToolCalls(req.MaxToolCalls); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validateReflectionInterval(req.ReflectionInterval); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if _, err := decision.ParseValidationRules(req.ValidationRules); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	budgetFallbackModel := strings.TrimSpace(req.BudgetFallbackModel)
+	if err := validateAIBudget(req.DailyAIBudget, budgetFallbackModel); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	// 生成交易员ID
 	traderID := fmt.Sprintf("%s_%s_%d", req.ExchangeID, req.AIModelID, time.Now().Unix())
 
@@ -564,11 +734,12 @@ func (s *Server) handleCreateTrader(c *gin.Context) {
 
 		switch req.ExchangeID {
 		case "binance":
-			tempTrader = trader.NewFuturesTrader(exchangeCfg.APIKey, exchangeCfg.SecretKey, userID)
+			tempTrader = trader.NewFuturesTrader(exchangeCfg.APIKey, exchangeCfg.SecretKey, userID, exchangeCfg.PositionMode)
 		case "hyperliquid":
 			tempTrader, createErr = trader.NewHyperliquidTrader(
 				exchangeCfg.APIKey, // private key
 				exchangeCfg.HyperliquidWalletAddr,
+				exchangeCfg.HyperliquidVaultAddr,
 				exchangeCfg.Testnet,
 			)
 		case "aster":
@@ -641,6 +812,25 @@ func (s *Server) handleCreateTrader(c *gin.Context) {
 		OverrideBasePrompt:   req.OverrideBasePrompt,
 		SystemPromptTemplate: systemPromptTemplate,
 		IsCrossMargin:        isCrossMargin,
+		Timeframes:           req.Timeframes,
+		Indicators:           req.Indicators,
+		MaxSlippagePct:       maxSlippagePct,
+		AlertTrigger:         req.AlertTrigger,
+		PriceMoveTriggerPct:  req.PriceMoveTriggerPct,
+		LiquidationBufferPct: req.LiquidationBufferPct,
+		FillTrigger:          req.FillTrigger,
+		TriggerGapSeconds:    triggerGapSeconds,
+		RegimeTemplates:      req.RegimeTemplates,
+		PromptLanguage:       promptLanguage,
+		AgentMode:            req.AgentMode,
+		MaxToolCalls:         req.MaxToolCalls,
+		RiskReview:           req.RiskReview,
+		RiskReviewPrompt:     req.RiskReviewPrompt,
+		TradeMemory:          req.TradeMemory,
+		ReflectionInterval:   req.ReflectionInterval,
+		ValidationRules:      req.ValidationRules,
+		DailyAIBudget:        req.DailyAIBudget,
+		BudgetFallbackModel:  budgetFallbackModel,
 		ScanIntervalMinutes:  scanIntervalMinutes,
 		IsRunning:            false,
 	}
@@ -671,18 +861,37 @@ func (s *Server) handleCreateTrader(c *gin.Context) {
 
 // UpdateTraderRequest 更新交易员请求
 type UpdateTraderRequest struct {
-	Name                 string  `json:"name" binding:"required"`
-	AIModelID            string  `json:"ai_model_id" binding:"required"`
-	ExchangeID           string  `json:"exchange_id" binding:"required"`
-	InitialBalance       float64 `json:"initial_balance"`
-	ScanIntervalMinutes  int     `json:"scan_interval_minutes"`
-	BTCETHLeverage       int     `json:"btc_eth_leverage"`
-	AltcoinLeverage      int     `json:"altcoin_leverage"`
-	TradingSymbols       string  `json:"trading_symbols"`
-	CustomPrompt         string  `json:"custom_prompt"`
-	OverrideBasePrompt   bool    `json:"override_base_prompt"`
-	SystemPromptTemplate string  `json:"system_prompt_template"`
-	IsCrossMargin        *bool   `json:"is_cross_margin"`
+	Name                 string   `json:"name" binding:"required"`
+	AIModelID            string   `json:"ai_model_id" binding:"required"`
+	ExchangeID           string   `json:"exchange_id" binding:"required"`
+	InitialBalance       float64  `json:"initial_balance"`
+	ScanIntervalMinutes  int      `json:"scan_interval_minutes"`
+	BTCETHLeverage       int      `json:"btc_eth_leverage"`
+	AltcoinLeverage      int      `json:"altcoin_leverage"`
+	TradingSymbols       string   `json:"trading_symbols"`
+	CustomPrompt         string   `json:"custom_prompt"`
+	OverrideBasePrompt   bool     `json:"override_base_prompt"`
+	SystemPromptTemplate string   `json:"system_prompt_template"`
+	IsCrossMargin        *bool    `json:"is_cross_margin"`
+	Timeframes           *string  `json:"timeframes"`             // nil表示保持原值
+	Indicators           *string  `json:"indicators"`             // nil表示保持原值
+	MaxSlippagePct       *float64 `json:"max_slippage_pct"`       // nil表示保持原值
+	AlertTrigger         *bool    `json:"alert_trigger"`          // nil表示保持原值
+	PriceMoveTriggerPct  *float64 `json:"price_move_trigger_pct"` // nil表示保持原值
+	LiquidationBufferPct *float64 `json:"liquidation_buffer_pct"` // nil表示保持原值
+	FillTrigger          *bool    `json:"fill_trigger"`           // nil表示保持原值
+	TriggerGapSeconds    *int     `json:"trigger_gap_seconds"`    // nil表示保持原值
+	RegimeTemplates      *string  `json:"regime_templates"`       // nil表示保持原值，空字符串表示不切换
+	PromptLanguage       *string  `json:"prompt_language"`        // nil表示保持原值
+	AgentMode            *bool    `json:"agent_mode"`             // nil表示保持原值
+	MaxToolCalls         *int     `json:"max_tool_calls"`         // nil表示保持原值
+	RiskReview           *bool    `json:"risk_review"`            // nil表示保持原值
+	RiskReviewPrompt     *string  `json:"risk_review_prompt"`     // nil表示保持原值
+	TradeMemory          *bool    `json:"trade_memory"`           // nil表示保持原值
+	ReflectionInterval   *int     `json:"reflection_interval"`    // nil表示保持原值
+	ValidationRules      *string  `json:"validation_rules"`       // nil表示保持原值，空字符串表示使用默认规则
+	DailyAIBudget        *float64 `json:"daily_ai_budget"`        // nil表示保持原值
+	BudgetFallbackModel  *string  `json:"budget_fallback_model"`  // nil表示保持原值
 }
 
 // handleUpdateTrader 更新交易员配置
@@ -746,6 +955,133 @@ func (s *Server) handleUpdateTrader(c *gin.Context) {
 		systemPromptTemplate = existingTrader.SystemPromptTemplate // 如果请求中没有提供，保持原值
 	}
 
+	// 设置K线周期和指标，未提供时保持原值
+	timeframes := existingTrader.Timeframes
+	if req.Timeframes != nil {
+		timeframes = *req.Timeframes
+	}
+	indicators := existingTrader.Indicators
+	if req.Indicators != nil {
+		indicators = *req.Indicators
+	}
+	if _, err := market.NewDataConfig(timeframes, indicators); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 设置滑点上限，未提供时保持原值
+	maxSlippagePct := existingTrader.MaxSlippagePct
+	if req.MaxSlippagePct != nil {
+		maxSlippagePct = *req.MaxSlippagePct
+	}
+	if maxSlippagePct < 0 || maxSlippagePct > 10 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "滑点上限必须在0-10%之间"})
+		return
+	}
+
+	alertTrigger := existingTrader.AlertTrigger // 保持原值
+	if req.AlertTrigger != nil {
+		alertTrigger = *req.AlertTrigger
+	}
+
+	// 设置事件触发配置，未提供时保持原值
+	priceMoveTriggerPct := existingTrader.PriceMoveTriggerPct
+	if req.PriceMoveTriggerPct != nil {
+		priceMoveTriggerPct = *req.PriceMoveTriggerPct
+	}
+	liquidationBufferPct := existingTrader.LiquidationBufferPct
+	if req.LiquidationBufferPct != nil {
+		liquidationBufferPct = *req.LiquidationBufferPct
+	}
+	fillTrigger := existingTrader.FillTrigger
+	if req.FillTrigger != nil {
+		fillTrigger = *req.FillTrigger
+	}
+	triggerGapSeconds := existingTrader.TriggerGapSeconds
+	if req.TriggerGapSeconds != nil {
+		triggerGapSeconds = *req.TriggerGapSeconds
+	}
+	if err := validateEventTriggers(priceMoveTriggerPct, liquidationBufferPct, triggerGapSeconds); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	regimeTemplates := existingTrader.RegimeTemplates
+	if req.RegimeTemplates != nil {
+		regimeTemplates = *req.RegimeTemplates
+	}
+	userTemplates, err := s.database.ListPromptTemplateNames(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("获取提示词模板失败: %v", err)})
+		return
+	}
+	if _, err := decision.ParseRegimeTemplates(regimeTemplates, userTemplates); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if status, err := s.checkExperimentPromptLock(userID, traderID, regimeTemplates, req.OverrideBasePrompt); err != nil {
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	promptLanguage := existingTrader.PromptLanguage
+	if req.PromptLanguage != nil {
+		if promptLanguage, err = decision.ParsePromptLanguage(*req.PromptLanguage); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	agentMode := existingTrader.AgentMode
+	if req.AgentMode != nil {
+		agentMode = *req.AgentMode
+	}
+	maxToolCalls := existingTrader.MaxToolCalls
+	if req.MaxToolCalls != nil {
+		maxToolCalls = *req.MaxToolCalls
+	}
+	if err := validateMaxToolCalls(maxToolCalls); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	riskReview := existingTrader.RiskReview
+	if req.RiskReview != nil {
+		riskReview = *req.RiskReview
+	}
+	riskReviewPrompt := existingTrader.RiskReviewPrompt
+	if req.RiskReviewPrompt != nil {
+		riskReviewPrompt = *req.RiskReviewPrompt
+	}
+	tradeMemory := existingTrader.TradeMemory
+	if req.TradeMemory != nil {
+		tradeMemory = *req.TradeMemory
+	}
+	reflectionInterval := existingTrader.ReflectionInterval
+	if req.ReflectionInterval != nil {
+		reflectionInterval = *req.ReflectionInterval
+	}
+	if err := validateReflectionInterval(reflectionInterval); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	validationRules := existingTrader.ValidationRules
+	if req.ValidationRules != nil {
+		validationRules = *req.ValidationRules
+	}
+	if _, err := decision.ParseValidationRules(validationRules); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	dailyAIBudget := existingTrader.DailyAIBudget
+	if req.DailyAIBudget != nil {
+		dailyAIBudget = *req.DailyAIBudget
+	}
+	budgetFallbackModel := existingTrader.BudgetFallbackModel
+	if req.BudgetFallbackModel != nil {
+		budgetFallbackModel = strings.TrimSpace(*req.BudgetFallbackModel)
+	}
+	if err := validateAIBudget(dailyAIBudget, budgetFallbackModel); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	// 更新交易员配置
 	trader := &config.TraderRecord{
 		ID:                   traderID,
@@ -761,6 +1097,25 @@ func (s *Server) handleUpdateTrader(c *gin.Context) {
 		OverrideBasePrompt:   req.OverrideBasePrompt,
 		SystemPromptTemplate: systemPromptTemplate,
 		IsCrossMargin:        isCrossMargin,
+		Timeframes:           timeframes,
+		Indicators:           indicators,
+		MaxSlippagePct:       maxSlippagePct,
+		AlertTrigger:         alertTrigger,
+		PriceMoveTriggerPct:  priceMoveTriggerPct,
+		LiquidationBufferPct: liquidationBufferPct,
+		FillTrigger:          fillTrigger,
+		TriggerGapSeconds:    triggerGapSeconds,
+		RegimeTemplates:      regimeTemplates,
+		PromptLanguage:       promptLanguage,
+		AgentMode:            agentMode,
+		MaxToolCalls:         maxToolCalls,
+		RiskReview:           riskReview,
+		RiskReviewPrompt:     riskReviewPrompt,
+		TradeMemory:          tradeMemory,
+		ReflectionInterval:   reflectionInterval,
+		ValidationRules:      validationRules,
+		DailyAIBudget:        dailyAIBudget,
+		BudgetFallbackModel:  budgetFallbackModel,
 		ScanIntervalMinutes:  scanIntervalMinutes,
 		IsRunning:            existingTrader.IsRunning, // 保持原值
 	}
@@ -929,6 +1284,10 @@ func (s *Server) handleUpdateTraderPrompt(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if status, err := s.checkExperimentPromptLock(userID, traderID, "", req.OverrideBasePrompt); err != nil {
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
 
 	// 更新数据库
 	err := s.database.UpdateTraderCustomPrompt(userID, traderID, req.CustomPrompt, req.OverrideBasePrompt)
@@ -1067,6 +1426,7 @@ func (s *Server) handleGetExchangeConfigs(c *gin.Context) {
 			HyperliquidWalletAddr: exchange.HyperliquidWalletAddr,
 			AsterUser:             exchange.AsterUser,
 			AsterSigner:           exchange.AsterSigner,
+			PositionMode:          exchange.PositionMode,
 		}
 	}
 
@@ -1127,6 +1487,20 @@ func (s *Server) handleUpdateExchangeConfigs(c *gin.Context) {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("更新交易所 %s 失败: %v", exchangeID, err)})
 			return
 		}
+		if exchangeData.HyperliquidVaultAddr != nil {
+			if err := s.database.UpdateExchangeHyperliquidVault(userID, exchangeID, *exchangeData.HyperliquidVaultAddr); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("更新交易所 %s 子账户/Vault地址失败: %v", exchangeID, err)})
+				return
+			}
+		}
+		// 未提交持仓模式时保留原配置（兼容旧版前端）
+		if exchangeData.PositionMode == "" {
+			continue
+		}
+		if err := s.database.UpdateExchangePositionMode(userID, exchangeID, exchangeData.PositionMode); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("更新交易所 %s 持仓模式失败: %v", exchangeID, err)})
+			return
+		}
 	}
 
 	// 重新加载该用户的所有交易员，使新配置立即生效
@@ -1262,6 +1636,26 @@ func (s *Server) handleGetTraderConfig(c *gin.Context) {
 		"is_cross_margin":        traderConfig.IsCrossMargin,
 		"use_coin_pool":          traderConfig.UseCoinPool,
 		"use_oi_top":             traderConfig.UseOITop,
+		"timeframes":             traderConfig.Timeframes,
+		"indicators":             traderConfig.Indicators,
+		"max_slippage_pct":       traderConfig.MaxSlippagePct,
+		"alert_trigger":          traderConfig.AlertTrigger,
+		"price_move_trigger_pct": traderConfig.PriceMoveTriggerPct,
+		"liquidation_buffer_pct": traderConfig.LiquidationBufferPct,
+		"fill_trigger":           traderConfig.FillTrigger,
+		"trigger_gap_seconds":    traderConfig.TriggerGapSeconds,
+		"regime_templates":       traderConfig.RegimeTemplates,
+		"prompt_language":        traderConfig.PromptLanguage,
+		"system_prompt_version":  traderConfig.SystemPromptVersion,
+		"agent_mode":             traderConfig.AgentMode,
+		"max_tool_calls":         traderConfig.MaxToolCalls,
+		"risk_review":            traderConfig.RiskReview,
+		"risk_review_prompt":     traderConfig.RiskReviewPrompt,
+		"trade_memory":           traderConfig.TradeMemory,
+		"reflection_interval":    traderConfig.ReflectionInterval,
+		"validation_rules":       traderConfig.ValidationRules,
+		"daily_ai_budget":        traderConfig.DailyAIBudget,
+		"budget_fallback_model":  traderConfig.BudgetFallbackModel,
 		"is_running":             isRunning,
 	}
 
@@ -1982,6 +2376,7 @@ func (s *Server) handleGetSupportedExchanges(c *gin.Context) {
 			HyperliquidWalletAddr: "", // 默认配置不包含钱包地址
 			AsterUser:             "", // 默认配置不包含用户信息
 			AsterSigner:           "",
+			PositionMode:          exchange.PositionMode,
 		}
 	}
 
@@ -2015,6 +2410,7 @@ func (s *Server) Start() error {
 	log.Printf("  • GET  /api/decisions/latest?trader_id=xxx - 指定trader的最新决策")
 	log.Printf("  • GET  /api/statistics?trader_id=xxx - 指定trader的统计信息")
 	log.Printf("  • GET  /api/performance?trader_id=xxx - 指定trader的AI学习表现分析")
+	log.Printf("  • GET  /api/ai-usage?days=7&trader_id=xxx - AI token用量和费用（按交易员/日期汇总）")
 	log.Println()
 
 	// 创建 http.Server 以支持 graceful shutdown
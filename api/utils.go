@@ -44,6 +44,9 @@ func SanitizeExchangeConfigForLog(exchanges map[string]struct {
 	AsterUser             string `json:"aster_user"`
 	AsterSigner           string `json:"aster_signer"`
 	AsterPrivateKey       string `json:"aster_private_key"`
+	PositionMode          string `json:"position_mode"`
+
+	HyperliquidVaultAddr *string `json:"hyperliquid_vault_addr"`
 }) map[string]interface{} {
 	safe := make(map[string]interface{})
 	for exchangeID, cfg := range exchanges {
@@ -73,6 +76,12 @@ func SanitizeExchangeConfigForLog(exchanges map[string]struct {
 		if cfg.AsterSigner != "" {
 			safeExchange["aster_signer"] = cfg.AsterSigner
 		}
+		if cfg.HyperliquidVaultAddr != nil && *cfg.HyperliquidVaultAddr != "" {
+			safeExchange["hyperliquid_vault_addr"] = MaskSensitiveString(*cfg.HyperliquidVaultAddr)
+		}
+		if cfg.PositionMode != "" {
+			safeExchange["position_mode"] = cfg.PositionMode
+		}
 
 		safe[exchangeID] = safeExchange
 	}
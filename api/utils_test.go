@@ -97,6 +97,9 @@ func TestSanitizeExchangeConfigForLog(t *testing.T) {
 		AsterUser             string `json:"aster_user"`
 		AsterSigner           string `json:"aster_signer"`
 		AsterPrivateKey       string `json:"aster_private_key"`
+		PositionMode          string `json:"position_mode"`
+
+		HyperliquidVaultAddr *string `json:"hyperliquid_vault_addr"`
 	}{
 		"binance": {
 			Enabled:   true,
@@ -0,0 +1,84 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// AIUsageDateFormat AI用量按UTC自然日统计的日期格式
+const AIUsageDateFormat = "2006-01-02"
+
+// AIUsageRecord 交易员某一天（UTC）在某个模型上的AI用量
+type AIUsageRecord struct {
+	UserID           string  `json:"user_id"`
+	TraderID         string  `json:"trader_id"`
+	Date             string  `json:"date"` // UTC日期，如 2025-01-02
+	Model            string  `json:"model"`
+	Calls            int     `json:"calls"`
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	CostUSD          float64 `json:"cost_usd"`
+}
+
+// AIUsageDate 返回时间对应的用量统计日期（UTC）
+func AIUsageDate(t time.Time) string {
+	return t.UTC().Format(AIUsageDateFormat)
+}
+
+// AddAIUsage 累加交易员当天在某个模型上的AI用量
+func (d *Database) AddAIUsage(usage *AIUsageRecord) error {
+	_, err := d.db.Exec(`
+		INSERT INTO ai_usage (user_id, trader_id, date, model, calls, prompt_tokens, completion_tokens, cost_usd)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(trader_id, date, model) DO UPDATE SET
+			calls = calls + excluded.calls,
+			prompt_tokens = prompt_tokens + excluded.prompt_tokens,
+			completion_tokens = completion_tokens + excluded.completion_tokens,
+			cost_usd = cost_usd + excluded.cost_usd
+	`, usage.UserID, usage.TraderID, usage.Date, usage.Model, usage.Calls,
+		usage.PromptTokens, usage.CompletionTokens, usage.CostUSD)
+	if err != nil {
+		return fmt.Errorf("记录AI用量失败: %w", err)
+	}
+	return nil
+}
+
+// GetTraderAICost 交易员某一天（UTC）所有模型的AI费用（美元）
+func (d *Database) GetTraderAICost(traderID, date string) (float64, error) {
+	var cost float64
+	err := d.db.QueryRow(`
+		SELECT COALESCE(SUM(cost_usd), 0) FROM ai_usage WHERE trader_id = ? AND date = ?
+	`, traderID, date).Scan(&cost)
+	return cost, err
+}
+
+// GetAIUsage 查询用户自 since（UTC日期，含当天）以来的AI用量，traderID 为空时返回所有交易员
+// 结果按日期倒序、交易员和模型排序
+func (d *Database) GetAIUsage(userID, traderID, since string) ([]*AIUsageRecord, error) {
+	query := `
+		SELECT user_id, trader_id, date, model, calls, prompt_tokens, completion_tokens, cost_usd
+		FROM ai_usage WHERE user_id = ? AND date >= ?`
+	args := []interface{}{userID, since}
+	if traderID != "" {
+		query += ` AND trader_id = ?`
+		args = append(args, traderID)
+	}
+	query += ` ORDER BY date DESC, trader_id, model`
+
+	rows, err := d.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []*AIUsageRecord
+	for rows.Next() {
+		var r AIUsageRecord
+		if err := rows.Scan(&r.UserID, &r.TraderID, &r.Date, &r.Model, &r.Calls,
+			&r.PromptTokens, &r.CompletionTokens, &r.CostUSD); err != nil {
+			return nil, err
+		}
+		records = append(records, &r)
+	}
+	return records, rows.Err()
+}
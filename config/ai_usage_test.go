@@ -0,0 +1,51 @@
+package config
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestAIUsageAccumulates(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	userID := "test-user-005"
+	today := AIUsageDate(time.Now())
+	yesterday := AIUsageDate(time.Now().Add(-24 * time.Hour))
+	for _, usage := range []*AIUsageRecord{
+		{UserID: userID, TraderID: "trader-a", Date: today, Model: "deepseek-chat", Calls: 1, PromptTokens: 1000, CompletionTokens: 200, CostUSD: 0.01},
+		{UserID: userID, TraderID: "trader-a", Date: today, Model: "deepseek-chat", Calls: 2, PromptTokens: 3000, CompletionTokens: 300, CostUSD: 0.02},
+		{UserID: userID, TraderID: "trader-a", Date: today, Model: "qwen-turbo", Calls: 1, PromptTokens: 500, CompletionTokens: 100, CostUSD: 0.001},
+		{UserID: userID, TraderID: "trader-b", Date: yesterday, Model: "deepseek-chat", Calls: 1, PromptTokens: 800, CompletionTokens: 100, CostUSD: 0.005},
+		{UserID: "test-user-006", TraderID: "trader-c", Date: today, Model: "deepseek-chat", Calls: 1, CostUSD: 1},
+	} {
+		if err := db.AddAIUsage(usage); err != nil {
+			t.Fatalf("记录AI用量失败: %v", err)
+		}
+	}
+
+	cost, err := db.GetTraderAICost("trader-a", today)
+	if err != nil || math.Abs(cost-0.031) > 1e-9 {
+		t.Errorf("当天费用应累加所有模型: %f, %v", cost, err)
+	}
+
+	records, err := db.GetAIUsage(userID, "", yesterday)
+	if err != nil {
+		t.Fatalf("查询AI用量失败: %v", err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("应返回该用户的3条记录（同一天同一模型合并）: %d", len(records))
+	}
+	if r := records[0]; r.Date != today || r.Model != "deepseek-chat" || r.Calls != 3 || r.PromptTokens != 4000 {
+		t.Errorf("同一天同一模型应合并: %+v", r)
+	}
+	if records[2].TraderID != "trader-b" {
+		t.Errorf("应按日期倒序: %+v", records[2])
+	}
+
+	records, err = db.GetAIUsage(userID, "trader-a", today)
+	if err != nil || len(records) != 2 {
+		t.Errorf("按交易员筛选应返回2条记录: %d, %v", len(records), err)
+	}
+}
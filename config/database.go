@@ -14,6 +14,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/ethereum/go-ethereum/common"
 	_ "modernc.org/sqlite"
 )
 
@@ -29,6 +30,8 @@ type DatabaseInterface interface {
 	UpdateAIModel(userID, id string, enabled bool, apiKey, customAPIURL, customModelName string) error
 	GetExchanges(userID string) ([]*ExchangeConfig, error)
 	UpdateExchange(userID, id string, enabled bool, apiKey, secretKey string, testnet bool, hyperliquidWalletAddr, asterUser, asterSigner, asterPrivateKey string) error
+	UpdateExchangePositionMode(userID, id, positionMode string) error
+	UpdateExchangeHyperliquidVault(userID, id, vaultAddr string) error
 	CreateAIModel(userID, id, name, provider string, enabled bool, apiKey, customAPIURL string) error
 	CreateExchange(userID, id, name, typ string, enabled bool, apiKey, secretKey string, testnet bool, hyperliquidWalletAddr, asterUser, asterSigner, asterPrivateKey string) error
 	CreateTrader(trader *TraderRecord) error
@@ -49,6 +52,21 @@ type DatabaseInterface interface {
 	ValidateBetaCode(code string) (bool, error)
 	UseBetaCode(code, userEmail string) error
 	GetBetaCodeStats() (total, used int, err error)
+	CreatePromptTemplate(userID, name, content, note string) (*PromptTemplateVersion, error)
+	AddPromptTemplateVersion(userID, name, content, note string) (*PromptTemplateVersion, error)
+	DeletePromptTemplate(userID, name string) error
+	GetPromptTemplates(userID string) ([]*PromptTemplateRecord, error)
+	ListPromptTemplateNames(userID string) ([]string, error)
+	GetPromptTemplateVersion(userID, name string, version int) (*PromptTemplateVersion, error)
+	GetPromptTemplateVersions(userID, name string) ([]*PromptTemplateVersion, error)
+	GetLatestPromptTemplateVersions(userID string) ([]*PromptTemplateVersion, error)
+	CreateExperiment(exp *ExperimentRecord) error
+	GetExperiments(userID string) ([]*ExperimentRecord, error)
+	GetExperiment(userID, id string) (*ExperimentRecord, error)
+	StopExperiment(userID, id string) error
+	AddAIUsage(usage *AIUsageRecord) error
+	GetTraderAICost(traderID, date string) (float64, error)
+	GetAIUsage(userID, traderID, since string) ([]*AIUsageRecord, error)
 	Close() error
 }
 
@@ -130,6 +148,10 @@ func (d *Database) createTables() error {
 			aster_private_key TEXT DEFAULT '',
 			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			-- 持仓模式：hedge=双向持仓, one_way=单向持仓，空值使用交易所默认
+			position_mode TEXT DEFAULT '',
+			-- Hyperliquid 子账户/Vault地址（加密存储，空值表示在主钱包交易）
+			hyperliquid_vault_addr TEXT DEFAULT '',
 			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
 		)`,
 
@@ -194,6 +216,65 @@ func (d *Database) createTables() error {
 			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
 		)`,
 
+		// 用户提示词模板表（已删除的模板保留版本历史，用于追溯历史决策）
+		`CREATE TABLE IF NOT EXISTS prompt_templates (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id TEXT NOT NULL,
+			name TEXT NOT NULL,
+			latest_version INTEGER NOT NULL DEFAULT 0,
+			deleted BOOLEAN DEFAULT 0,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+			UNIQUE(user_id, name)
+		)`,
+
+		// 用户提示词模板版本表（版本只增不改）
+		`CREATE TABLE IF NOT EXISTS prompt_template_versions (
+			template_id INTEGER NOT NULL,
+			version INTEGER NOT NULL,
+			content TEXT NOT NULL,
+			note TEXT DEFAULT '',
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (template_id, version),
+			FOREIGN KEY (template_id) REFERENCES prompt_templates(id) ON DELETE CASCADE
+		)`,
+
+		// 提示词A/B实验表
+		`CREATE TABLE IF NOT EXISTS experiments (
+			id TEXT PRIMARY KEY,
+			user_id TEXT NOT NULL,
+			name TEXT NOT NULL,
+			status TEXT NOT NULL DEFAULT 'running',
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			stopped_at DATETIME DEFAULT NULL,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		)`,
+
+		// 实验分组表（每组一个交易员，固定一个提示词模板版本）
+		`CREATE TABLE IF NOT EXISTS experiment_arms (
+			experiment_id TEXT NOT NULL,
+			trader_id TEXT NOT NULL,
+			template_name TEXT NOT NULL,
+			template_version INTEGER NOT NULL DEFAULT 0,
+			position INTEGER NOT NULL DEFAULT 0,
+			PRIMARY KEY (experiment_id, trader_id),
+			FOREIGN KEY (experiment_id) REFERENCES experiments(id) ON DELETE CASCADE
+		)`,
+
+		// AI用量表（按交易员、日期（UTC）和模型累计token和费用）
+		`CREATE TABLE IF NOT EXISTS ai_usage (
+			user_id TEXT NOT NULL,
+			trader_id TEXT NOT NULL,
+			date TEXT NOT NULL,
+			model TEXT NOT NULL,
+			calls INTEGER NOT NULL DEFAULT 0,
+			prompt_tokens INTEGER NOT NULL DEFAULT 0,
+			completion_tokens INTEGER NOT NULL DEFAULT 0,
+			cost_usd REAL NOT NULL DEFAULT 0,
+			PRIMARY KEY (trader_id, date, model)
+		)`,
+
 		// 触发器：自动更新 updated_at
 		`CREATE TRIGGER IF NOT EXISTS update_users_updated_at
 			AFTER UPDATE ON users
@@ -244,6 +325,8 @@ func (d *Database) createTables() error {
 		`ALTER TABLE exchanges ADD COLUMN aster_user TEXT DEFAULT ''`,
 		`ALTER TABLE exchanges ADD COLUMN aster_signer TEXT DEFAULT ''`,
 		`ALTER TABLE exchanges ADD COLUMN aster_private_key TEXT DEFAULT ''`,
+		`ALTER TABLE exchanges ADD COLUMN position_mode TEXT DEFAULT ''`,          // 持仓模式（空值使用交易所默认）
+		`ALTER TABLE exchanges ADD COLUMN hyperliquid_vault_addr TEXT DEFAULT ''`, // Hyperliquid 子账户/Vault地址（加密存储）
 		`ALTER TABLE traders ADD COLUMN custom_prompt TEXT DEFAULT ''`,
 		`ALTER TABLE traders ADD COLUMN override_base_prompt BOOLEAN DEFAULT 0`,
 		`ALTER TABLE traders ADD COLUMN is_cross_margin BOOLEAN DEFAULT 1`,             // 默认为全仓模式
@@ -255,6 +338,26 @@ func (d *Database) createTables() error {
 		`ALTER TABLE traders ADD COLUMN use_coin_pool BOOLEAN DEFAULT 0`,               // 是否使用COIN POOL信号源
 		`ALTER TABLE traders ADD COLUMN use_oi_top BOOLEAN DEFAULT 0`,                  // 是否使用OI TOP信号源
 		`ALTER TABLE traders ADD COLUMN system_prompt_template TEXT DEFAULT 'default'`, // 系统提示词模板名称
+		`ALTER TABLE traders ADD COLUMN timeframes TEXT DEFAULT ''`,                    // K线周期，逗号分隔（空值使用系统默认）
+		`ALTER TABLE traders ADD COLUMN indicators TEXT DEFAULT ''`,                    // 提示词输出的指标，逗号分隔（空值为基础指标）
+		`ALTER TABLE traders ADD COLUMN max_slippage_pct REAL DEFAULT 0.5`,             // 开仓滑点上限（百分比，0为不检查）
+		`ALTER TABLE traders ADD COLUMN alert_trigger BOOLEAN DEFAULT 0`,               // 市场警报是否触发AI决策周期
+		`ALTER TABLE traders ADD COLUMN price_move_trigger_pct REAL DEFAULT 0`,         // 持仓价格变化触发阈值（百分比，0为关闭）
+		`ALTER TABLE traders ADD COLUMN liquidation_buffer_pct REAL DEFAULT 0`,         // 接近强平价触发阈值（百分比，0为关闭）
+		`ALTER TABLE traders ADD COLUMN fill_trigger BOOLEAN DEFAULT 0`,                // 持仓在周期外被平掉（止盈/止损、强平或手动平仓）是否触发AI决策周期
+		`ALTER TABLE traders ADD COLUMN trigger_gap_seconds INTEGER DEFAULT 60`,        // 事件触发与上个周期的最小间隔（秒）
+		`ALTER TABLE traders ADD COLUMN regime_templates TEXT DEFAULT ''`,              // 市场状态 -> 系统提示词模板（JSON）
+		`ALTER TABLE traders ADD COLUMN prompt_language TEXT DEFAULT ''`,               // 系统提示词语言（空值为中文）
+		`ALTER TABLE traders ADD COLUMN system_prompt_version INTEGER DEFAULT 0`,       // 固定的用户模板版本（0为最新）
+		`ALTER TABLE traders ADD COLUMN agent_mode BOOLEAN DEFAULT 0`,                  // 代理模式（AI通过工具按需查询数据）
+		`ALTER TABLE traders ADD COLUMN max_tool_calls INTEGER DEFAULT 0`,              // 代理模式每个周期的工具调用上限（0为默认）
+		`ALTER TABLE traders ADD COLUMN risk_review BOOLEAN DEFAULT 0`,                 // 是否由风控经理审核开仓决策
+		`ALTER TABLE traders ADD COLUMN risk_review_prompt TEXT DEFAULT ''`,            // 额外风控规则
+		`ALTER TABLE traders ADD COLUMN trade_memory BOOLEAN DEFAULT 0`,                // 是否在提示词中加入交易记忆
+		`ALTER TABLE traders ADD COLUMN reflection_interval INTEGER DEFAULT 0`,         // AI复盘间隔（周期数，0为不复盘）
+		`ALTER TABLE traders ADD COLUMN validation_rules TEXT DEFAULT ''`,              // 开仓校验规则（JSON，空值使用默认规则）
+		`ALTER TABLE traders ADD COLUMN daily_ai_budget REAL DEFAULT 0`,                // 每日AI费用预算（美元，0为不限制）
+		`ALTER TABLE traders ADD COLUMN budget_fallback_model TEXT DEFAULT ''`,         // 超出预算后改用的模型（空值跳过周期）
 		`ALTER TABLE ai_models ADD COLUMN custom_api_url TEXT DEFAULT ''`,              // 自定义API地址
 		`ALTER TABLE ai_models ADD COLUMN custom_model_name TEXT DEFAULT ''`,           // 自定义模型名称
 	}
@@ -376,6 +479,8 @@ func (d *Database) migrateExchangesTable() error {
 			aster_private_key TEXT DEFAULT '',
 			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			position_mode TEXT DEFAULT '',
+			hyperliquid_vault_addr TEXT DEFAULT '',
 			PRIMARY KEY (id, user_id),
 			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
 		)
@@ -460,10 +565,12 @@ type ExchangeConfig struct {
 	// Hyperliquid Agent Wallet configuration (following official best practices)
 	// Reference: https://hyperliquid.gitbook.io/hyperliquid-docs/for-developers/api/nonces-and-api-wallets
 	HyperliquidWalletAddr string `json:"hyperliquidWalletAddr"` // Main Wallet Address (holds funds, never expose private key)
+	HyperliquidVaultAddr  string `json:"hyperliquidVaultAddr"`  // Optional sub-account / vault address (orders signed by agent, executed on this account)
 	// Aster 特定字段
 	AsterUser       string    `json:"asterUser"`
 	AsterSigner     string    `json:"asterSigner"`
 	AsterPrivateKey string    `json:"asterPrivateKey"`
+	PositionMode    string    `json:"positionMode"` // 持仓模式: "hedge"(双向持仓) / "one_way"(单向持仓)，空值使用交易所默认
 	CreatedAt       time.Time `json:"created_at"`
 	UpdatedAt       time.Time `json:"updated_at"`
 }
@@ -487,6 +594,26 @@ type TraderRecord struct {
 	OverrideBasePrompt   bool      `json:"override_base_prompt"`   // 是否覆盖基础prompt
 	SystemPromptTemplate string    `json:"system_prompt_template"` // 系统提示词模板名称
 	IsCrossMargin        bool      `json:"is_cross_margin"`        // 是否为全仓模式（true=全仓，false=逐仓）
+	Timeframes           string    `json:"timeframes"`             // K线周期，逗号分隔（如 "1m,15m,1h"，空值使用系统默认）
+	Indicators           string    `json:"indicators"`             // 提示词输出的指标，逗号分隔（空值为基础指标）
+	MaxSlippagePct       float64   `json:"max_slippage_pct"`       // 开仓滑点上限（百分比，0为不检查）
+	AlertTrigger         bool      `json:"alert_trigger"`          // 市场警报是否触发AI决策周期
+	PriceMoveTriggerPct  float64   `json:"price_move_trigger_pct"` // 持仓价格相对上个周期变化触发阈值（百分比，0为关闭）
+	LiquidationBufferPct float64   `json:"liquidation_buffer_pct"` // 标记价距强平价小于该百分比时触发（0为关闭）
+	FillTrigger          bool      `json:"fill_trigger"`           // 持仓在周期外被平掉（止盈/止损、强平或手动平仓）是否触发AI决策周期
+	TriggerGapSeconds    int       `json:"trigger_gap_seconds"`    // 事件触发与上个周期的最小间隔（秒）
+	RegimeTemplates      string    `json:"regime_templates"`       // 市场状态 -> 系统提示词模板（JSON对象，空值不切换）
+	PromptLanguage       string    `json:"prompt_language"`        // 系统提示词语言（zh/en，空值为中文）
+	SystemPromptVersion  int       `json:"system_prompt_version"`  // 固定的用户模板版本（0为最新，由A/B实验设置）
+	AgentMode            bool      `json:"agent_mode"`             // 代理模式：AI先看概览，再通过工具按需查询行情/订单簿/历史交易
+	MaxToolCalls         int       `json:"max_tool_calls"`         // 代理模式每个周期的工具调用上限（0为默认）
+	RiskReview           bool      `json:"risk_review"`            // 是否启用第二阶段风控审核（风控经理批准/缩小/否决开仓决策）
+	RiskReviewPrompt     string    `json:"risk_review_prompt"`     // 额外风控规则（追加到风控经理的系统提示词）
+	TradeMemory          bool      `json:"trade_memory"`           // 是否在提示词中加入交易记忆（近期交易、币种战绩、近期失误）
+	ReflectionInterval   int       `json:"reflection_interval"`    // AI复盘间隔（周期数，0为不复盘）
+	ValidationRules      string    `json:"validation_rules"`       // 开仓校验规则（JSON对象：风险回报比、仓位上限、最小开仓金额等，空值使用默认规则）
+	DailyAIBudget        float64   `json:"daily_ai_budget"`        // 每日AI费用预算（美元，UTC自然日，0为不限制）
+	BudgetFallbackModel  string    `json:"budget_fallback_model"`  // 超出预算后改用的便宜模型（同一API），空值表示跳过周期
 	CreatedAt            time.Time `json:"created_at"`
 	UpdatedAt            time.Time `json:"updated_at"`
 }
@@ -739,6 +866,8 @@ func (d *Database) GetExchanges(userID string) ([]*ExchangeConfig, error) {
 		       COALESCE(aster_user, '') as aster_user,
 		       COALESCE(aster_signer, '') as aster_signer,
 		       COALESCE(aster_private_key, '') as aster_private_key,
+		       COALESCE(position_mode, '') as position_mode,
+		       COALESCE(hyperliquid_vault_addr, '') as hyperliquid_vault_addr,
 		       created_at, updated_at 
 		FROM exchanges WHERE user_id = ? ORDER BY id
 	`, userID)
@@ -755,7 +884,8 @@ func (d *Database) GetExchanges(userID string) ([]*ExchangeConfig, error) {
 			&exchange.ID, &exchange.UserID, &exchange.Name, &exchange.Type,
 			&exchange.Enabled, &exchange.APIKey, &exchange.SecretKey, &exchange.Testnet,
 			&exchange.HyperliquidWalletAddr, &exchange.AsterUser,
-			&exchange.AsterSigner, &exchange.AsterPrivateKey,
+			&exchange.AsterSigner, &exchange.AsterPrivateKey, &exchange.PositionMode,
+			&exchange.HyperliquidVaultAddr,
 			&exchange.CreatedAt, &exchange.UpdatedAt,
 		)
 		if err != nil {
@@ -766,6 +896,7 @@ func (d *Database) GetExchanges(userID string) ([]*ExchangeConfig, error) {
 		exchange.APIKey = d.decryptSensitiveData(exchange.APIKey)
 		exchange.SecretKey = d.decryptSensitiveData(exchange.SecretKey)
 		exchange.AsterPrivateKey = d.decryptSensitiveData(exchange.AsterPrivateKey)
+		exchange.HyperliquidVaultAddr = d.decryptSensitiveData(exchange.HyperliquidVaultAddr)
 
 		exchanges = append(exchanges, &exchange)
 	}
@@ -875,6 +1006,55 @@ func (d *Database) UpdateExchange(userID, id string, enabled bool, apiKey, secre
 	return nil
 }
 
+// UpdateExchangePositionMode 更新交易所持仓模式（hedge=双向持仓, one_way=单向持仓, 空值=交易所默认）
+func (d *Database) UpdateExchangePositionMode(userID, id, positionMode string) error {
+	switch positionMode {
+	case "", "hedge", "one_way":
+	default:
+		return fmt.Errorf("无效的持仓模式: %s（可选值: hedge, one_way）", positionMode)
+	}
+
+	result, err := d.db.Exec(`
+		UPDATE exchanges SET position_mode = ?, updated_at = datetime('now')
+		WHERE id = ? AND user_id = ?
+	`, positionMode, id, userID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("交易所配置不存在: %s", id)
+	}
+	return nil
+}
+
+// UpdateExchangeHyperliquidVault 更新 Hyperliquid 子账户/Vault地址（加密存储，空值表示在主钱包交易）
+func (d *Database) UpdateExchangeHyperliquidVault(userID, id, vaultAddr string) error {
+	vaultAddr = strings.TrimSpace(vaultAddr)
+	if vaultAddr != "" && !common.IsHexAddress(vaultAddr) {
+		return fmt.Errorf("无效的子账户/Vault地址: %s", vaultAddr)
+	}
+
+	result, err := d.db.Exec(`
+		UPDATE exchanges SET hyperliquid_vault_addr = ?, updated_at = datetime('now')
+		WHERE id = ? AND user_id = ?
+	`, d.encryptSensitiveData(vaultAddr), id, userID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("交易所配置不存在: %s", id)
+	}
+	return nil
+}
+
 // CreateAIModel 创建AI模型配置
 func (d *Database) CreateAIModel(userID, id, name, provider string, enabled bool, apiKey, customAPIURL string) error {
 	_, err := d.db.Exec(`
@@ -901,9 +1081,9 @@ func (d *Database) CreateExchange(userID, id, name, typ string, enabled bool, ap
 // CreateTrader 创建交易员
 func (d *Database) CreateTrader(trader *TraderRecord) error {
 	_, err := d.db.Exec(`
-		INSERT INTO traders (id, user_id, name, ai_model_id, exchange_id, initial_balance, scan_interval_minutes, is_running, btc_eth_leverage, altcoin_leverage, trading_symbols, use_coin_pool, use_oi_top, custom_prompt, override_base_prompt, system_prompt_template, is_cross_margin)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-	`, trader.ID, trader.UserID, trader.Name, trader.AIModelID, trader.ExchangeID, trader.InitialBalance, trader.ScanIntervalMinutes, trader.IsRunning, trader.BTCETHLeverage, trader.AltcoinLeverage, trader.TradingSymbols, trader.UseCoinPool, trader.UseOITop, trader.CustomPrompt, trader.OverrideBasePrompt, trader.SystemPromptTemplate, trader.IsCrossMargin)
+		INSERT INTO traders (id, user_id, name, ai_model_id, exchange_id, initial_balance, scan_interval_minutes, is_running, btc_eth_leverage, altcoin_leverage, trading_symbols, use_coin_pool, use_oi_top, custom_prompt, override_base_prompt, system_prompt_template, is_cross_margin, timeframes, indicators, max_slippage_pct, alert_trigger, price_move_trigger_pct, liquidation_buffer_pct, fill_trigger, trigger_gap_seconds, regime_templates, prompt_language, agent_mode, max_tool_calls, risk_review, risk_review_prompt, trade_memory, reflection_interval, validation_rules, daily_ai_budget, budget_fallback_model)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, trader.ID, trader.UserID, trader.Name, trader.AIModelID, trader.ExchangeID, trader.InitialBalance, trader.ScanIntervalMinutes, trader.IsRunning, trader.BTCETHLeverage, trader.AltcoinLeverage, trader.TradingSymbols, trader.UseCoinPool, trader.UseOITop, trader.CustomPrompt, trader.OverrideBasePrompt, trader.SystemPromptTemplate, trader.IsCrossMargin, trader.Timeframes, trader.Indicators, trader.MaxSlippagePct, trader.AlertTrigger, trader.PriceMoveTriggerPct, trader.LiquidationBufferPct, trader.FillTrigger, trader.TriggerGapSeconds, trader.RegimeTemplates, trader.PromptLanguage, trader.AgentMode, trader.MaxToolCalls, trader.RiskReview, trader.RiskReviewPrompt, trader.TradeMemory, trader.ReflectionInterval, trader.ValidationRules, trader.DailyAIBudget, trader.BudgetFallbackModel)
 	return err
 }
 
@@ -916,7 +1096,19 @@ func (d *Database) GetTraders(userID string) ([]*TraderRecord, error) {
 		       COALESCE(use_coin_pool, 0) as use_coin_pool, COALESCE(use_oi_top, 0) as use_oi_top,
 		       COALESCE(custom_prompt, '') as custom_prompt, COALESCE(override_base_prompt, 0) as override_base_prompt,
 		       COALESCE(system_prompt_template, 'default') as system_prompt_template,
-		       COALESCE(is_cross_margin, 1) as is_cross_margin, created_at, updated_at
+		       COALESCE(is_cross_margin, 1) as is_cross_margin,
+		       COALESCE(timeframes, '') as timeframes, COALESCE(indicators, '') as indicators,
+		       COALESCE(max_slippage_pct, 0.5) as max_slippage_pct, COALESCE(alert_trigger, 0) as alert_trigger,
+		       COALESCE(price_move_trigger_pct, 0) as price_move_trigger_pct, COALESCE(liquidation_buffer_pct, 0) as liquidation_buffer_pct,
+		       COALESCE(fill_trigger, 0) as fill_trigger, COALESCE(trigger_gap_seconds, 60) as trigger_gap_seconds,
+		       COALESCE(regime_templates, '') as regime_templates, COALESCE(prompt_language, '') as prompt_language,
+		       COALESCE(system_prompt_version, 0) as system_prompt_version,
+		       COALESCE(agent_mode, 0) as agent_mode, COALESCE(max_tool_calls, 0) as max_tool_calls,
+		       COALESCE(risk_review, 0) as risk_review, COALESCE(risk_review_prompt, '') as risk_review_prompt,
+		       COALESCE(trade_memory, 0) as trade_memory, COALESCE(reflection_interval, 0) as reflection_interval,
+		       COALESCE(validation_rules, '') as validation_rules,
+		       COALESCE(daily_ai_budget, 0) as daily_ai_budget, COALESCE(budget_fallback_model, '') as budget_fallback_model,
+		       created_at, updated_at
 		FROM traders WHERE user_id = ? ORDER BY created_at DESC
 	`, userID)
 	if err != nil {
@@ -933,7 +1125,12 @@ func (d *Database) GetTraders(userID string) ([]*TraderRecord, error) {
 			&trader.BTCETHLeverage, &trader.AltcoinLeverage, &trader.TradingSymbols,
 			&trader.UseCoinPool, &trader.UseOITop,
 			&trader.CustomPrompt, &trader.OverrideBasePrompt, &trader.SystemPromptTemplate,
-			&trader.IsCrossMargin,
+			&trader.IsCrossMargin, &trader.Timeframes, &trader.Indicators,
+			&trader.MaxSlippagePct, &trader.AlertTrigger,
+			&trader.PriceMoveTriggerPct, &trader.LiquidationBufferPct, &trader.FillTrigger, &trader.TriggerGapSeconds,
+			&trader.RegimeTemplates, &trader.PromptLanguage, &trader.SystemPromptVersion,
+			&trader.AgentMode, &trader.MaxToolCalls, &trader.RiskReview, &trader.RiskReviewPrompt, &trader.TradeMemory, &trader.ReflectionInterval,
+			&trader.ValidationRules, &trader.DailyAIBudget, &trader.BudgetFallbackModel,
 			&trader.CreatedAt, &trader.UpdatedAt,
 		)
 		if err != nil {
@@ -952,18 +1149,26 @@ func (d *Database) UpdateTraderStatus(userID, id string, isRunning bool) error {
 }
 
 // UpdateTrader 更新交易员配置
+// 切换系统提示词模板时清除固定的模板版本（SQLite 的 SET 表达式读取的是更新前的值）
 func (d *Database) UpdateTrader(trader *TraderRecord) error {
 	_, err := d.db.Exec(`
 		UPDATE traders SET
 			name = ?, ai_model_id = ?, exchange_id = ?,
 			scan_interval_minutes = ?, btc_eth_leverage = ?, altcoin_leverage = ?,
 			trading_symbols = ?, custom_prompt = ?, override_base_prompt = ?,
-			system_prompt_template = ?, is_cross_margin = ?, updated_at = CURRENT_TIMESTAMP
+			system_prompt_version = CASE WHEN system_prompt_template = ? THEN system_prompt_version ELSE 0 END,
+			system_prompt_template = ?, is_cross_margin = ?, timeframes = ?, indicators = ?,
+			max_slippage_pct = ?, alert_trigger = ?, price_move_trigger_pct = ?, liquidation_buffer_pct = ?,
+			fill_trigger = ?, trigger_gap_seconds = ?, regime_templates = ?, prompt_language = ?,
+			agent_mode = ?, max_tool_calls = ?, risk_review = ?, risk_review_prompt = ?, trade_memory = ?, reflection_interval = ?, validation_rules = ?, daily_ai_budget = ?, budget_fallback_model = ?, updated_at = CURRENT_TIMESTAMP
 		WHERE id = ? AND user_id = ?
 	`, trader.Name, trader.AIModelID, trader.ExchangeID,
 		trader.ScanIntervalMinutes, trader.BTCETHLeverage, trader.AltcoinLeverage,
 		trader.TradingSymbols, trader.CustomPrompt, trader.OverrideBasePrompt,
-		trader.SystemPromptTemplate, trader.IsCrossMargin, trader.ID, trader.UserID)
+		trader.SystemPromptTemplate, trader.SystemPromptTemplate, trader.IsCrossMargin, trader.Timeframes, trader.Indicators,
+		trader.MaxSlippagePct, trader.AlertTrigger, trader.PriceMoveTriggerPct, trader.LiquidationBufferPct,
+		trader.FillTrigger, trader.TriggerGapSeconds, trader.RegimeTemplates, trader.PromptLanguage,
+		trader.AgentMode, trader.MaxToolCalls, trader.RiskReview, trader.RiskReviewPrompt, trader.TradeMemory, trader.ReflectionInterval, trader.ValidationRules, trader.DailyAIBudget, trader.BudgetFallbackModel, trader.ID, trader.UserID)
 	return err
 }
 
@@ -1004,6 +1209,26 @@ func (d *Database) GetTraderConfig(userID, traderID string) (*TraderRecord, *AIM
 			COALESCE(t.override_base_prompt, 0) as override_base_prompt,
 			COALESCE(t.system_prompt_template, 'default') as system_prompt_template,
 			COALESCE(t.is_cross_margin, 1) as is_cross_margin,
+			COALESCE(t.timeframes, '') as timeframes,
+			COALESCE(t.indicators, '') as indicators,
+			COALESCE(t.max_slippage_pct, 0.5) as max_slippage_pct,
+			COALESCE(t.alert_trigger, 0) as alert_trigger,
+			COALESCE(t.price_move_trigger_pct, 0) as price_move_trigger_pct,
+			COALESCE(t.liquidation_buffer_pct, 0) as liquidation_buffer_pct,
+			COALESCE(t.fill_trigger, 0) as fill_trigger,
+			COALESCE(t.trigger_gap_seconds, 60) as trigger_gap_seconds,
+			COALESCE(t.regime_templates, '') as regime_templates,
+			COALESCE(t.prompt_language, '') as prompt_language,
+			COALESCE(t.system_prompt_version, 0) as system_prompt_version,
+			COALESCE(t.agent_mode, 0) as agent_mode,
+			COALESCE(t.max_tool_calls, 0) as max_tool_calls,
+			COALESCE(t.risk_review, 0) as risk_review,
+			COALESCE(t.risk_review_prompt, '') as risk_review_prompt,
+			COALESCE(t.trade_memory, 0) as trade_memory,
+			COALESCE(t.reflection_interval, 0) as reflection_interval,
+			COALESCE(t.validation_rules, '') as validation_rules,
+			COALESCE(t.daily_ai_budget, 0) as daily_ai_budget,
+			COALESCE(t.budget_fallback_model, '') as budget_fallback_model,
 			t.created_at, t.updated_at,
 			a.id, a.user_id, a.name, a.provider, a.enabled, a.api_key,
 			COALESCE(a.custom_api_url, '') as custom_api_url,
@@ -1014,6 +1239,8 @@ func (d *Database) GetTraderConfig(userID, traderID string) (*TraderRecord, *AIM
 			COALESCE(e.aster_user, '') as aster_user,
 			COALESCE(e.aster_signer, '') as aster_signer,
 			COALESCE(e.aster_private_key, '') as aster_private_key,
+			COALESCE(e.position_mode, '') as position_mode,
+			COALESCE(e.hyperliquid_vault_addr, '') as hyperliquid_vault_addr,
 			e.created_at, e.updated_at
 		FROM traders t
 		JOIN ai_models a ON t.ai_model_id = a.id AND t.user_id = a.user_id
@@ -1025,7 +1252,12 @@ func (d *Database) GetTraderConfig(userID, traderID string) (*TraderRecord, *AIM
 		&trader.BTCETHLeverage, &trader.AltcoinLeverage, &trader.TradingSymbols,
 		&trader.UseCoinPool, &trader.UseOITop,
 		&trader.CustomPrompt, &trader.OverrideBasePrompt, &trader.SystemPromptTemplate,
-		&trader.IsCrossMargin,
+		&trader.IsCrossMargin, &trader.Timeframes, &trader.Indicators,
+		&trader.MaxSlippagePct, &trader.AlertTrigger,
+		&trader.PriceMoveTriggerPct, &trader.LiquidationBufferPct, &trader.FillTrigger, &trader.TriggerGapSeconds,
+		&trader.RegimeTemplates, &trader.PromptLanguage, &trader.SystemPromptVersion,
+		&trader.AgentMode, &trader.MaxToolCalls, &trader.RiskReview, &trader.RiskReviewPrompt, &trader.TradeMemory, &trader.ReflectionInterval,
+		&trader.ValidationRules, &trader.DailyAIBudget, &trader.BudgetFallbackModel,
 		&trader.CreatedAt, &trader.UpdatedAt,
 		&aiModel.ID, &aiModel.UserID, &aiModel.Name, &aiModel.Provider, &aiModel.Enabled, &aiModel.APIKey,
 		&aiModel.CustomAPIURL, &aiModel.CustomModelName,
@@ -1033,6 +1265,7 @@ func (d *Database) GetTraderConfig(userID, traderID string) (*TraderRecord, *AIM
 		&exchange.ID, &exchange.UserID, &exchange.Name, &exchange.Type, &exchange.Enabled,
 		&exchange.APIKey, &exchange.SecretKey, &exchange.Testnet,
 		&exchange.HyperliquidWalletAddr, &exchange.AsterUser, &exchange.AsterSigner, &exchange.AsterPrivateKey,
+		&exchange.PositionMode, &exchange.HyperliquidVaultAddr,
 		&exchange.CreatedAt, &exchange.UpdatedAt,
 	)
 
@@ -1045,6 +1278,7 @@ func (d *Database) GetTraderConfig(userID, traderID string) (*TraderRecord, *AIM
 	exchange.APIKey = d.decryptSensitiveData(exchange.APIKey)
 	exchange.SecretKey = d.decryptSensitiveData(exchange.SecretKey)
 	exchange.AsterPrivateKey = d.decryptSensitiveData(exchange.AsterPrivateKey)
+	exchange.HyperliquidVaultAddr = d.decryptSensitiveData(exchange.HyperliquidVaultAddr)
 
 	return &trader, &aiModel, &exchange, nil
 }
@@ -639,12 +639,11 @@ func TestDataPersistenceAcrossReopen(t *testing.T) {
 	defer os.Remove(dbPath)
 
 	// 设置加密服务
-	rsaKeyPath := "test_rsa_key.pem"
+	rsaKeyPath := t.TempDir() + "/test_rsa_key.pem"
 	cryptoService, err := crypto.NewCryptoService(rsaKeyPath)
 	if err != nil {
 		t.Fatalf("初始化加密服务失败: %v", err)
 	}
-	defer os.RemoveAll(rsaKeyPath)
 
 	userID := "test-user-persistence"
 	testAPIKey := "test-api-key-should-persist"
@@ -797,3 +796,128 @@ func TestConcurrentWritesWithWAL(t *testing.T) {
 		t.Errorf("并发写入失败次数过多: %d", errorCount)
 	}
 }
+
+// TestUpdateExchangePositionMode 测试持仓模式的保存与校验
+func TestUpdateExchangePositionMode(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	userID := "test-user-position-mode"
+	if err := db.UpdateExchange(userID, "binance", true, "api-key", "secret-key", false, "", "", "", ""); err != nil {
+		t.Fatalf("初始化失败: %v", err)
+	}
+
+	if err := db.UpdateExchangePositionMode(userID, "binance", "one_way"); err != nil {
+		t.Fatalf("设置持仓模式失败: %v", err)
+	}
+	exchanges, err := db.GetExchanges(userID)
+	if err != nil {
+		t.Fatalf("获取配置失败: %v", err)
+	}
+	if len(exchanges) == 0 || exchanges[0].PositionMode != "one_way" {
+		t.Fatalf("持仓模式未保存: %+v", exchanges)
+	}
+
+	// 更新其他字段不应影响持仓模式
+	if err := db.UpdateExchange(userID, "binance", false, "", "", true, "", "", "", ""); err != nil {
+		t.Fatalf("更新失败: %v", err)
+	}
+	exchanges, _ = db.GetExchanges(userID)
+	if exchanges[0].PositionMode != "one_way" {
+		t.Errorf("持仓模式被覆盖，期望 one_way，实际 %q", exchanges[0].PositionMode)
+	}
+
+	if err := db.UpdateExchangePositionMode(userID, "binance", "net"); err == nil {
+		t.Error("无效的持仓模式应返回错误")
+	}
+	if err := db.UpdateExchangePositionMode(userID, "okx", "hedge"); err == nil {
+		t.Error("不存在的交易所配置应返回错误")
+	}
+}
+
+// TestUpdateExchangeHyperliquidVault 测试 Hyperliquid 子账户/Vault地址的加密保存与清除
+func TestUpdateExchangeHyperliquidVault(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	userID := "test-user-002"
+	vaultAddr := "0xdfc24b077bc1425ad1dea75bcb6f8158e10df303"
+	if err := db.UpdateExchange(userID, "hyperliquid", true, "agent-private-key", "", false, "0xWalletAddress", "", "", ""); err != nil {
+		t.Fatalf("初始化失败: %v", err)
+	}
+
+	if err := db.UpdateExchangeHyperliquidVault(userID, "hyperliquid", vaultAddr); err != nil {
+		t.Fatalf("设置子账户/Vault地址失败: %v", err)
+	}
+	exchanges, err := db.GetExchanges(userID)
+	if err != nil {
+		t.Fatalf("获取配置失败: %v", err)
+	}
+	if len(exchanges) == 0 || exchanges[0].HyperliquidVaultAddr != vaultAddr {
+		t.Fatalf("子账户/Vault地址未保存: %+v", exchanges)
+	}
+
+	// 启用加密服务时数据库中不应保存明文
+	if db.cryptoService != nil {
+		var stored string
+		if err := db.db.QueryRow(`SELECT hyperliquid_vault_addr FROM exchanges WHERE id = ? AND user_id = ?`, "hyperliquid", userID).Scan(&stored); err != nil {
+			t.Fatalf("读取原始数据失败: %v", err)
+		}
+		if stored == vaultAddr {
+			t.Error("子账户/Vault地址应加密存储")
+		}
+	}
+
+	if err := db.UpdateExchangeHyperliquidVault(userID, "hyperliquid", "not-an-address"); err == nil {
+		t.Error("无效地址应返回错误")
+	}
+
+	if err := db.UpdateExchangeHyperliquidVault(userID, "hyperliquid", ""); err != nil {
+		t.Fatalf("清除子账户/Vault地址失败: %v", err)
+	}
+	exchanges, _ = db.GetExchanges(userID)
+	if exchanges[0].HyperliquidVaultAddr != "" {
+		t.Errorf("子账户/Vault地址应已清除，实际 %q", exchanges[0].HyperliquidVaultAddr)
+	}
+}
+
+// TestTraderTimeframesAndIndicators 测试交易员K线周期和指标配置的保存与更新
+func TestTraderTimeframesAndIndicators(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	userID := "test-user-003"
+	trader := &TraderRecord{
+		ID:                   "trader-timeframes",
+		UserID:               userID,
+		Name:                 "timeframes",
+		AIModelID:            "deepseek",
+		ExchangeID:           "binance",
+		InitialBalance:       1000,
+		ScanIntervalMinutes:  3,
+		SystemPromptTemplate: "default",
+		Timeframes:           "1m,15m,1h",
+		Indicators:           "ema,rsi",
+	}
+	if err := db.CreateTrader(trader); err != nil {
+		t.Fatalf("创建交易员失败: %v", err)
+	}
+
+	traders, err := db.GetTraders(userID)
+	if err != nil {
+		t.Fatalf("获取交易员失败: %v", err)
+	}
+	if len(traders) != 1 || traders[0].Timeframes != "1m,15m,1h" || traders[0].Indicators != "ema,rsi" {
+		t.Fatalf("K线周期/指标未保存: %+v", traders)
+	}
+
+	trader.Timeframes = ""
+	trader.Indicators = "macd"
+	if err := db.UpdateTrader(trader); err != nil {
+		t.Fatalf("更新交易员失败: %v", err)
+	}
+	traders, _ = db.GetTraders(userID)
+	if traders[0].Timeframes != "" || traders[0].Indicators != "macd" {
+		t.Errorf("K线周期/指标未更新: timeframes=%q indicators=%q", traders[0].Timeframes, traders[0].Indicators)
+	}
+}
@@ -0,0 +1,201 @@
+package config
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// 实验状态
+const (
+	ExperimentRunning = "running"
+	ExperimentStopped = "stopped"
+)
+
+var (
+	// ErrExperimentNotFound 实验不存在或不属于当前用户
+	ErrExperimentNotFound = errors.New("实验不存在")
+	// ErrExperimentTraderBusy 交易员已在另一个进行中的实验里
+	ErrExperimentTraderBusy = errors.New("交易员已参与其他进行中的实验")
+)
+
+// ExperimentArm 实验分组：一个交易员运行一个固定的提示词模板版本
+type ExperimentArm struct {
+	TraderID        string `json:"trader_id"`
+	TemplateName    string `json:"template_name"`
+	TemplateVersion int    `json:"template_version"` // 用户模板版本号（0为 prompts/ 目录的系统模板）
+}
+
+// ExperimentRecord 提示词A/B实验，第一个分组为对照组
+type ExperimentRecord struct {
+	ID        string          `json:"id"`
+	UserID    string          `json:"user_id"`
+	Name      string          `json:"name"`
+	Status    string          `json:"status"` // running/stopped
+	Arms      []ExperimentArm `json:"arms"`
+	CreatedAt time.Time       `json:"created_at"`
+	StoppedAt *time.Time      `json:"stopped_at,omitempty"`
+}
+
+// CreateExperiment 创建实验，并把各分组的模板版本固定到对应交易员上
+func (d *Database) CreateExperiment(exp *ExperimentRecord) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return fmt.Errorf("开始事务失败: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, arm := range exp.Arms {
+		var busy string
+		err := tx.QueryRow(`
+			SELECT e.name FROM experiment_arms a JOIN experiments e ON a.experiment_id = e.id
+			WHERE a.trader_id = ? AND e.status = ?
+		`, arm.TraderID, ExperimentRunning).Scan(&busy)
+		if err == nil {
+			return fmt.Errorf("%w: %s (%s)", ErrExperimentTraderBusy, arm.TraderID, busy)
+		}
+		if err != sql.ErrNoRows {
+			return err
+		}
+	}
+
+	if _, err := tx.Exec(`
+		INSERT INTO experiments (id, user_id, name, status) VALUES (?, ?, ?, ?)
+	`, exp.ID, exp.UserID, exp.Name, ExperimentRunning); err != nil {
+		return fmt.Errorf("创建实验失败: %w", err)
+	}
+	for i, arm := range exp.Arms {
+		if _, err := tx.Exec(`
+			INSERT INTO experiment_arms (experiment_id, trader_id, template_name, template_version, position) VALUES (?, ?, ?, ?, ?)
+		`, exp.ID, arm.TraderID, arm.TemplateName, arm.TemplateVersion, i); err != nil {
+			return fmt.Errorf("创建实验分组失败: %w", err)
+		}
+		if _, err := tx.Exec(`
+			UPDATE traders SET system_prompt_template = ?, system_prompt_version = ?, updated_at = CURRENT_TIMESTAMP
+			WHERE id = ? AND user_id = ?
+		`, arm.TemplateName, arm.TemplateVersion, arm.TraderID, exp.UserID); err != nil {
+			return fmt.Errorf("设置交易员提示词模板失败: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("提交事务失败: %w", err)
+	}
+	exp.Status = ExperimentRunning
+	return nil
+}
+
+// RunningExperimentName 交易员参与的进行中实验名称（未参与实验时返回空字符串）
+func (d *Database) RunningExperimentName(userID, traderID string) (string, error) {
+	var name string
+	err := d.db.QueryRow(`
+		SELECT e.name FROM experiment_arms a JOIN experiments e ON a.experiment_id = e.id
+		WHERE e.user_id = ? AND a.trader_id = ? AND e.status = ?
+	`, userID, traderID, ExperimentRunning).Scan(&name)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return name, err
+}
+
+// GetExperiments 获取用户的实验列表（最新的在前）
+func (d *Database) GetExperiments(userID string) ([]*ExperimentRecord, error) {
+	rows, err := d.db.Query(`
+		SELECT id, user_id, name, status, created_at, stopped_at
+		FROM experiments WHERE user_id = ? ORDER BY created_at DESC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var experiments []*ExperimentRecord
+	for rows.Next() {
+		exp, err := scanExperiment(rows)
+		if err != nil {
+			return nil, err
+		}
+		experiments = append(experiments, exp)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, exp := range experiments {
+		if exp.Arms, err = d.getExperimentArms(exp.ID); err != nil {
+			return nil, err
+		}
+	}
+	return experiments, nil
+}
+
+// GetExperiment 获取单个实验（含分组）
+func (d *Database) GetExperiment(userID, id string) (*ExperimentRecord, error) {
+	row := d.db.QueryRow(`
+		SELECT id, user_id, name, status, created_at, stopped_at
+		FROM experiments WHERE id = ? AND user_id = ?
+	`, id, userID)
+	exp, err := scanExperiment(row)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("%w: %s", ErrExperimentNotFound, id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if exp.Arms, err = d.getExperimentArms(exp.ID); err != nil {
+		return nil, err
+	}
+	return exp, nil
+}
+
+// StopExperiment 结束实验，之后的交易不再计入实验结果
+// 交易员保留当前的模板设置，需要时由用户自行修改
+func (d *Database) StopExperiment(userID, id string) error {
+	result, err := d.db.Exec(`
+		UPDATE experiments SET status = ?, stopped_at = CURRENT_TIMESTAMP
+		WHERE id = ? AND user_id = ? AND status = ?
+	`, ExperimentStopped, id, userID, ExperimentRunning)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("%w: %s", ErrExperimentNotFound, id)
+	}
+	return nil
+}
+
+// scanExperiment 扫描 experiments 表的一行
+func scanExperiment(row interface{ Scan(...any) error }) (*ExperimentRecord, error) {
+	var exp ExperimentRecord
+	var stoppedAt sql.NullTime
+	if err := row.Scan(&exp.ID, &exp.UserID, &exp.Name, &exp.Status, &exp.CreatedAt, &stoppedAt); err != nil {
+		return nil, err
+	}
+	if stoppedAt.Valid {
+		exp.StoppedAt = &stoppedAt.Time
+	}
+	return &exp, nil
+}
+
+// getExperimentArms 按创建顺序读取实验分组
+func (d *Database) getExperimentArms(experimentID string) ([]ExperimentArm, error) {
+	rows, err := d.db.Query(`
+		SELECT trader_id, template_name, template_version
+		FROM experiment_arms WHERE experiment_id = ? ORDER BY position
+	`, experimentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var arms []ExperimentArm
+	for rows.Next() {
+		var arm ExperimentArm
+		if err := rows.Scan(&arm.TraderID, &arm.TemplateName, &arm.TemplateVersion); err != nil {
+			return nil, err
+		}
+		arms = append(arms, arm)
+	}
+	return arms, rows.Err()
+}
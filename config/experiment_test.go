@@ -0,0 +1,108 @@
+package config
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestExperimentPinsTraderTemplates(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	userID := "test-user-004"
+	for _, id := range []string{"trader-a", "trader-b", "trader-c"} {
+		trader := &TraderRecord{
+			ID:                   id,
+			UserID:               userID,
+			Name:                 id,
+			AIModelID:            "deepseek",
+			ExchangeID:           "binance",
+			InitialBalance:       100,
+			ScanIntervalMinutes:  3,
+			SystemPromptTemplate: "default",
+		}
+		if err := db.CreateTrader(trader); err != nil {
+			t.Fatalf("创建交易员失败: %v", err)
+		}
+	}
+
+	exp := &ExperimentRecord{
+		ID:     "exp-1",
+		UserID: userID,
+		Name:   "trend v1 vs v2",
+		Arms: []ExperimentArm{
+			{TraderID: "trader-a", TemplateName: "trend", TemplateVersion: 1},
+			{TraderID: "trader-b", TemplateName: "trend", TemplateVersion: 2},
+		},
+	}
+	if err := db.CreateExperiment(exp); err != nil {
+		t.Fatalf("创建实验失败: %v", err)
+	}
+
+	// 分组的模板版本固定到交易员上
+	traders, _ := db.GetTraders(userID)
+	pinned := make(map[string]*TraderRecord)
+	for _, tr := range traders {
+		pinned[tr.ID] = tr
+	}
+	if tr := pinned["trader-b"]; tr.SystemPromptTemplate != "trend" || tr.SystemPromptVersion != 2 {
+		t.Errorf("trader-b 未固定到 trend v2: %s v%d", tr.SystemPromptTemplate, tr.SystemPromptVersion)
+	}
+
+	// 同一交易员不能同时参与两个进行中的实验
+	busy := &ExperimentRecord{
+		ID:     "exp-2",
+		UserID: userID,
+		Name:   "busy",
+		Arms: []ExperimentArm{
+			{TraderID: "trader-b", TemplateName: "default"},
+			{TraderID: "trader-c", TemplateName: "trend", TemplateVersion: 1},
+		},
+	}
+	if err := db.CreateExperiment(busy); !errors.Is(err, ErrExperimentTraderBusy) {
+		t.Fatalf("期望 ErrExperimentTraderBusy, got %v", err)
+	}
+	if _, err := db.GetExperiment(userID, "exp-2"); !errors.Is(err, ErrExperimentNotFound) {
+		t.Errorf("失败的实验不应被保存, got %v", err)
+	}
+
+	got, err := db.GetExperiment(userID, "exp-1")
+	if err != nil {
+		t.Fatalf("获取实验失败: %v", err)
+	}
+	if got.Status != ExperimentRunning || len(got.Arms) != 2 || got.Arms[0].TraderID != "trader-a" || got.StoppedAt != nil {
+		t.Fatalf("实验内容不正确: %+v", got)
+	}
+	if _, err := db.GetExperiment("test-user-005", "exp-1"); !errors.Is(err, ErrExperimentNotFound) {
+		t.Errorf("其他用户不应读取到实验, got %v", err)
+	}
+
+	if err := db.StopExperiment(userID, "exp-1"); err != nil {
+		t.Fatalf("结束实验失败: %v", err)
+	}
+	if err := db.StopExperiment(userID, "exp-1"); !errors.Is(err, ErrExperimentNotFound) {
+		t.Errorf("重复结束应返回 ErrExperimentNotFound, got %v", err)
+	}
+	got, _ = db.GetExperiment(userID, "exp-1")
+	if got.Status != ExperimentStopped || got.StoppedAt == nil {
+		t.Errorf("实验应已结束: %+v", got)
+	}
+
+	// 实验结束后交易员可以加入新实验
+	if err := db.CreateExperiment(busy); err != nil {
+		t.Errorf("实验结束后应可创建新实验: %v", err)
+	}
+
+	// 切换模板时清除固定的版本
+	tr := pinned["trader-a"]
+	tr.SystemPromptTemplate = "default"
+	if err := db.UpdateTrader(tr); err != nil {
+		t.Fatalf("更新交易员失败: %v", err)
+	}
+	traders, _ = db.GetTraders(userID)
+	for _, tr := range traders {
+		if tr.ID == "trader-a" && tr.SystemPromptVersion != 0 {
+			t.Errorf("切换模板后应清除固定版本: v%d", tr.SystemPromptVersion)
+		}
+	}
+}
@@ -0,0 +1,258 @@
+package config
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	// ErrPromptTemplateNotFound 用户提示词模板或版本不存在
+	ErrPromptTemplateNotFound = errors.New("提示词模板不存在")
+	// ErrPromptTemplateExists 同名的用户提示词模板已存在
+	ErrPromptTemplateExists = errors.New("提示词模板已存在")
+)
+
+// PromptTemplateRecord 用户提示词模板
+type PromptTemplateRecord struct {
+	ID            int64     `json:"id"`
+	UserID        string    `json:"user_id"`
+	Name          string    `json:"name"`
+	LatestVersion int       `json:"latest_version"`
+	Deleted       bool      `json:"deleted"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// PromptTemplateVersion 用户提示词模板的一个版本（创建后不可修改）
+type PromptTemplateVersion struct {
+	Name      string    `json:"name"`
+	Version   int       `json:"version"`
+	Content   string    `json:"content"`
+	Note      string    `json:"note"` // 版本说明
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// CreatePromptTemplate 创建用户提示词模板（版本1）
+// 同名模板已删除时恢复该模板并追加新版本，旧版本保留以便追溯
+func (d *Database) CreatePromptTemplate(userID, name, content, note string) (*PromptTemplateVersion, error) {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("开始事务失败: %w", err)
+	}
+	defer tx.Rollback()
+
+	var templateID int64
+	var deleted bool
+	err = tx.QueryRow(`SELECT id, deleted FROM prompt_templates WHERE user_id = ? AND name = ?`, userID, name).Scan(&templateID, &deleted)
+	switch {
+	case err == sql.ErrNoRows:
+		result, err := tx.Exec(`INSERT INTO prompt_templates (user_id, name) VALUES (?, ?)`, userID, name)
+		if err != nil {
+			return nil, fmt.Errorf("创建提示词模板失败: %w", err)
+		}
+		if templateID, err = result.LastInsertId(); err != nil {
+			return nil, err
+		}
+	case err != nil:
+		return nil, err
+	case !deleted:
+		return nil, fmt.Errorf("%w: %s", ErrPromptTemplateExists, name)
+	}
+
+	version, err := insertPromptTemplateVersion(tx, templateID, content, note)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("提交事务失败: %w", err)
+	}
+	return d.GetPromptTemplateVersion(userID, name, version)
+}
+
+// AddPromptTemplateVersion 编辑用户提示词模板：保存为新版本，已有版本不变
+func (d *Database) AddPromptTemplateVersion(userID, name, content, note string) (*PromptTemplateVersion, error) {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("开始事务失败: %w", err)
+	}
+	defer tx.Rollback()
+
+	var templateID int64
+	err = tx.QueryRow(`SELECT id FROM prompt_templates WHERE user_id = ? AND name = ? AND deleted = 0`, userID, name).Scan(&templateID)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("%w: %s", ErrPromptTemplateNotFound, name)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	version, err := insertPromptTemplateVersion(tx, templateID, content, note)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("提交事务失败: %w", err)
+	}
+	return d.GetPromptTemplateVersion(userID, name, version)
+}
+
+// insertPromptTemplateVersion 追加模板版本并更新最新版本号，返回新版本号
+func insertPromptTemplateVersion(tx *sql.Tx, templateID int64, content, note string) (int, error) {
+	var version int
+	if err := tx.QueryRow(`SELECT latest_version + 1 FROM prompt_templates WHERE id = ?`, templateID).Scan(&version); err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec(`
+		INSERT INTO prompt_template_versions (template_id, version, content, note) VALUES (?, ?, ?, ?)
+	`, templateID, version, content, note); err != nil {
+		return 0, fmt.Errorf("保存提示词模板版本失败: %w", err)
+	}
+	if _, err := tx.Exec(`
+		UPDATE prompt_templates SET latest_version = ?, deleted = 0, updated_at = CURRENT_TIMESTAMP WHERE id = ?
+	`, version, templateID); err != nil {
+		return 0, err
+	}
+	return version, nil
+}
+
+// DeletePromptTemplate 删除用户提示词模板（版本历史保留，仍可按版本号查询）
+func (d *Database) DeletePromptTemplate(userID, name string) error {
+	result, err := d.db.Exec(`
+		UPDATE prompt_templates SET deleted = 1, updated_at = CURRENT_TIMESTAMP
+		WHERE user_id = ? AND name = ? AND deleted = 0
+	`, userID, name)
+	if err != nil {
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return fmt.Errorf("%w: %s", ErrPromptTemplateNotFound, name)
+	}
+	return nil
+}
+
+// GetPromptTemplates 获取用户的提示词模板列表（不含已删除的模板）
+func (d *Database) GetPromptTemplates(userID string) ([]*PromptTemplateRecord, error) {
+	rows, err := d.db.Query(`
+		SELECT id, user_id, name, latest_version, deleted, created_at, updated_at
+		FROM prompt_templates WHERE user_id = ? AND deleted = 0 ORDER BY name
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var templates []*PromptTemplateRecord
+	for rows.Next() {
+		var t PromptTemplateRecord
+		if err := rows.Scan(&t.ID, &t.UserID, &t.Name, &t.LatestVersion, &t.Deleted, &t.CreatedAt, &t.UpdatedAt); err != nil {
+			return nil, err
+		}
+		templates = append(templates, &t)
+	}
+	return templates, rows.Err()
+}
+
+// ListPromptTemplateNames 获取用户的提示词模板名称（不含已删除的模板，用于校验交易员配置中引用的模板）
+func (d *Database) ListPromptTemplateNames(userID string) ([]string, error) {
+	rows, err := d.db.Query(`
+		SELECT name FROM prompt_templates WHERE user_id = ? AND deleted = 0 ORDER BY name
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	names := []string{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
+
+// GetPromptTemplateVersion 获取用户提示词模板的指定版本（version<=0 为最新版本）
+// 指定版本号时已删除模板的版本也可查询，用于追溯历史决策
+func (d *Database) GetPromptTemplateVersion(userID, name string, version int) (*PromptTemplateVersion, error) {
+	query := `
+		SELECT t.name, v.version, v.content, COALESCE(v.note, ''), v.created_at
+		FROM prompt_templates t
+		JOIN prompt_template_versions v ON v.template_id = t.id
+		WHERE t.user_id = ? AND t.name = ? AND `
+	args := []interface{}{userID, name}
+	if version > 0 {
+		query += `v.version = ?`
+		args = append(args, version)
+	} else {
+		query += `v.version = t.latest_version AND t.deleted = 0`
+	}
+
+	var v PromptTemplateVersion
+	err := d.db.QueryRow(query, args...).Scan(&v.Name, &v.Version, &v.Content, &v.Note, &v.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("%w: %s v%d", ErrPromptTemplateNotFound, name, version)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// GetPromptTemplateVersions 获取用户提示词模板的全部版本（按版本号升序）
+func (d *Database) GetPromptTemplateVersions(userID, name string) ([]*PromptTemplateVersion, error) {
+	rows, err := d.db.Query(`
+		SELECT t.name, v.version, v.content, COALESCE(v.note, ''), v.created_at
+		FROM prompt_templates t
+		JOIN prompt_template_versions v ON v.template_id = t.id
+		WHERE t.user_id = ? AND t.name = ?
+		ORDER BY v.version
+	`, userID, name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var versions []*PromptTemplateVersion
+	for rows.Next() {
+		var v PromptTemplateVersion
+		if err := rows.Scan(&v.Name, &v.Version, &v.Content, &v.Note, &v.CreatedAt); err != nil {
+			return nil, err
+		}
+		versions = append(versions, &v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(versions) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrPromptTemplateNotFound, name)
+	}
+	return versions, nil
+}
+
+// GetLatestPromptTemplateVersions 获取用户所有模板的最新版本（交易员决策时使用）
+func (d *Database) GetLatestPromptTemplateVersions(userID string) ([]*PromptTemplateVersion, error) {
+	rows, err := d.db.Query(`
+		SELECT t.name, v.version, v.content, COALESCE(v.note, ''), v.created_at
+		FROM prompt_templates t
+		JOIN prompt_template_versions v ON v.template_id = t.id AND v.version = t.latest_version
+		WHERE t.user_id = ? AND t.deleted = 0
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var versions []*PromptTemplateVersion
+	for rows.Next() {
+		var v PromptTemplateVersion
+		if err := rows.Scan(&v.Name, &v.Version, &v.Content, &v.Note, &v.CreatedAt); err != nil {
+			return nil, err
+		}
+		versions = append(versions, &v)
+	}
+	return versions, rows.Err()
+}
@@ -0,0 +1,105 @@
+package config
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestPromptTemplateVersioning(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	userID := "test-user-001"
+
+	v1, err := db.CreatePromptTemplate(userID, "trend", "第一版", "初始版本")
+	if err != nil {
+		t.Fatalf("创建模板失败: %v", err)
+	}
+	if v1.Version != 1 || v1.Content != "第一版" || v1.Note != "初始版本" {
+		t.Fatalf("版本1不正确: %+v", v1)
+	}
+
+	if _, err := db.CreatePromptTemplate(userID, "trend", "重复", ""); !errors.Is(err, ErrPromptTemplateExists) {
+		t.Errorf("重复创建应返回 ErrPromptTemplateExists, got %v", err)
+	}
+
+	v2, err := db.AddPromptTemplateVersion(userID, "trend", "第二版", "")
+	if err != nil {
+		t.Fatalf("保存新版本失败: %v", err)
+	}
+	if v2.Version != 2 {
+		t.Errorf("新版本号 = %d, 期望 2", v2.Version)
+	}
+
+	// 旧版本不变，未指定版本时返回最新版本
+	old, err := db.GetPromptTemplateVersion(userID, "trend", 1)
+	if err != nil || old.Content != "第一版" {
+		t.Errorf("版本1应保持不变: %+v, %v", old, err)
+	}
+	latest, err := db.GetPromptTemplateVersion(userID, "trend", 0)
+	if err != nil || latest.Version != 2 {
+		t.Errorf("最新版本应为2: %+v, %v", latest, err)
+	}
+
+	// 其他用户看不到该模板
+	if _, err := db.GetPromptTemplateVersion("test-user-002", "trend", 0); !errors.Is(err, ErrPromptTemplateNotFound) {
+		t.Errorf("其他用户不应读取到模板, got %v", err)
+	}
+
+	templates, err := db.GetPromptTemplates(userID)
+	if err != nil || len(templates) != 1 || templates[0].LatestVersion != 2 {
+		t.Fatalf("模板列表不正确: %+v, %v", templates, err)
+	}
+	names, err := db.ListPromptTemplateNames(userID)
+	if err != nil || len(names) != 1 || names[0] != "trend" {
+		t.Errorf("模板名称列表不正确: %v, %v", names, err)
+	}
+}
+
+func TestDeletePromptTemplateKeepsHistory(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	userID := "test-user-001"
+	if _, err := db.CreatePromptTemplate(userID, "scalp", "v1", ""); err != nil {
+		t.Fatalf("创建模板失败: %v", err)
+	}
+	if err := db.DeletePromptTemplate(userID, "scalp"); err != nil {
+		t.Fatalf("删除模板失败: %v", err)
+	}
+	if err := db.DeletePromptTemplate(userID, "scalp"); !errors.Is(err, ErrPromptTemplateNotFound) {
+		t.Errorf("重复删除应返回 ErrPromptTemplateNotFound, got %v", err)
+	}
+
+	// 删除后不在列表和最新版本中，但历史版本仍可追溯
+	templates, _ := db.GetPromptTemplates(userID)
+	if len(templates) != 0 {
+		t.Errorf("已删除模板不应出现在列表中")
+	}
+	if names, _ := db.ListPromptTemplateNames(userID); len(names) != 0 {
+		t.Errorf("已删除模板不应出现在名称列表中: %v", names)
+	}
+	latest, _ := db.GetLatestPromptTemplateVersions(userID)
+	if len(latest) != 0 {
+		t.Errorf("已删除模板不应参与决策")
+	}
+	if _, err := db.AddPromptTemplateVersion(userID, "scalp", "v2", ""); !errors.Is(err, ErrPromptTemplateNotFound) {
+		t.Errorf("已删除模板不能编辑, got %v", err)
+	}
+	if v, err := db.GetPromptTemplateVersion(userID, "scalp", 1); err != nil || v.Content != "v1" {
+		t.Errorf("已删除模板的历史版本应可查询: %+v, %v", v, err)
+	}
+
+	// 重新创建同名模板时版本号继续递增
+	recreated, err := db.CreatePromptTemplate(userID, "scalp", "重新创建", "")
+	if err != nil {
+		t.Fatalf("重新创建模板失败: %v", err)
+	}
+	if recreated.Version != 2 {
+		t.Errorf("重新创建后的版本号 = %d, 期望 2", recreated.Version)
+	}
+	versions, err := db.GetPromptTemplateVersions(userID, "scalp")
+	if err != nil || len(versions) != 2 {
+		t.Errorf("应保留全部版本: %d, %v", len(versions), err)
+	}
+}
@@ -15,6 +15,7 @@ import (
 	"io"
 	"log"
 	"os"
+	"path/filepath"
 	"sync"
 )
 
@@ -23,6 +24,7 @@ type EncryptionManager struct {
 	privateKey   *rsa.PrivateKey
 	publicKeyPEM string
 	masterKey    []byte // 用於數據庫加密的主密鑰
+	secretsDir   string // 密鑰文件目錄
 	mu           sync.RWMutex
 }
 
@@ -35,14 +37,14 @@ var (
 func GetEncryptionManager() (*EncryptionManager, error) {
 	var initErr error
 	once.Do(func() {
-		instance, initErr = newEncryptionManager()
+		instance, initErr = newEncryptionManager(defaultSecretsDir)
 	})
 	return instance, initErr
 }
 
-// newEncryptionManager 初始化加密管理器
-func newEncryptionManager() (*EncryptionManager, error) {
-	em := &EncryptionManager{}
+// newEncryptionManager 初始化加密管理器（密鑰文件保存在 secretsDir）
+func newEncryptionManager(secretsDir string) (*EncryptionManager, error) {
+	em := &EncryptionManager{secretsDir: secretsDir}
 
 	// 1. 加載或生成 RSA 密鑰對
 	if err := em.loadOrGenerateRSAKeyPair(); err != nil {
@@ -62,20 +64,26 @@ func newEncryptionManager() (*EncryptionManager, error) {
 
 const (
 	rsaKeySize        = 4096
-	rsaPrivateKeyFile = ".secrets/rsa_private.pem"
-	rsaPublicKeyFile  = ".secrets/rsa_public.pem"
-	masterKeyFile     = ".secrets/master.key"
+	defaultSecretsDir = ".secrets"
+	rsaPrivateKeyFile = "rsa_private.pem"
+	rsaPublicKeyFile  = "rsa_public.pem"
+	masterKeyFile     = "master.key"
 )
 
+// secretPath 密鑰文件的完整路徑
+func (em *EncryptionManager) secretPath(name string) string {
+	return filepath.Join(em.secretsDir, name)
+}
+
 // loadOrGenerateRSAKeyPair 加載或生成 RSA 密鑰對
 func (em *EncryptionManager) loadOrGenerateRSAKeyPair() error {
-	// 確保 .secrets 目錄存在
-	if err := os.MkdirAll(".secrets", 0700); err != nil {
+	// 確保密鑰目錄存在
+	if err := os.MkdirAll(em.secretsDir, 0700); err != nil {
 		return err
 	}
 
 	// 嘗試加載現有密鑰
-	if _, err := os.Stat(rsaPrivateKeyFile); err == nil {
+	if _, err := os.Stat(em.secretPath(rsaPrivateKeyFile)); err == nil {
 		return em.loadRSAKeyPair()
 	}
 
@@ -94,7 +102,7 @@ func (em *EncryptionManager) loadOrGenerateRSAKeyPair() error {
 		Type:  "RSA PRIVATE KEY",
 		Bytes: privateKeyBytes,
 	})
-	if err := os.WriteFile(rsaPrivateKeyFile, privateKeyPEM, 0600); err != nil {
+	if err := os.WriteFile(em.secretPath(rsaPrivateKeyFile), privateKeyPEM, 0600); err != nil {
 		return err
 	}
 
@@ -107,7 +115,7 @@ func (em *EncryptionManager) loadOrGenerateRSAKeyPair() error {
 		Type:  "PUBLIC KEY",
 		Bytes: publicKeyBytes,
 	})
-	if err := os.WriteFile(rsaPublicKeyFile, publicKeyPEM, 0644); err != nil {
+	if err := os.WriteFile(em.secretPath(rsaPublicKeyFile), publicKeyPEM, 0644); err != nil {
 		return err
 	}
 
@@ -119,7 +127,7 @@ func (em *EncryptionManager) loadOrGenerateRSAKeyPair() error {
 // loadRSAKeyPair 加載 RSA 密鑰對
 func (em *EncryptionManager) loadRSAKeyPair() error {
 	// 加載私鑰
-	privateKeyPEM, err := os.ReadFile(rsaPrivateKeyFile)
+	privateKeyPEM, err := os.ReadFile(em.secretPath(rsaPrivateKeyFile))
 	if err != nil {
 		return err
 	}
@@ -136,7 +144,7 @@ func (em *EncryptionManager) loadRSAKeyPair() error {
 	em.privateKey = privateKey
 
 	// 加載公鑰
-	publicKeyPEM, err := os.ReadFile(rsaPublicKeyFile)
+	publicKeyPEM, err := os.ReadFile(em.secretPath(rsaPublicKeyFile))
 	if err != nil {
 		return err
 	}
@@ -235,8 +243,8 @@ func (em *EncryptionManager) loadOrGenerateMasterKey() error {
 	}
 
 	// 嘗試從文件加載
-	if _, err := os.Stat(masterKeyFile); err == nil {
-		keyBytes, err := os.ReadFile(masterKeyFile)
+	if _, err := os.Stat(em.secretPath(masterKeyFile)); err == nil {
+		keyBytes, err := os.ReadFile(em.secretPath(masterKeyFile))
 		if err != nil {
 			return err
 		}
@@ -260,12 +268,12 @@ func (em *EncryptionManager) loadOrGenerateMasterKey() error {
 
 	// 保存到文件
 	encoded := base64.StdEncoding.EncodeToString(masterKey)
-	if err := os.WriteFile(masterKeyFile, []byte(encoded), 0600); err != nil {
+	if err := os.WriteFile(em.secretPath(masterKeyFile), []byte(encoded), 0600); err != nil {
 		return err
 	}
 
 	log.Println("✅ 主密鑰已生成並保存")
-	log.Printf("📁 主密鑰文件位置: %s (權限: 0600)", masterKeyFile)
+	log.Printf("📁 主密鑰文件位置: %s (權限: 0600)", em.secretPath(masterKeyFile))
 	log.Println("🔐 生產環境請設置環境變數: NOFX_MASTER_KEY=<從文件讀取>")
 	log.Println("⚠️  請妥善保管 .secrets 目錄，切勿將密鑰提交到版本控制系統")
 	return nil
@@ -357,11 +365,11 @@ func (em *EncryptionManager) RotateMasterKey() error {
 
 	// 保存新密鑰
 	encoded := base64.StdEncoding.EncodeToString(newMasterKey)
-	backupFile := fmt.Sprintf("%s.backup.%d", masterKeyFile, os.Getpid())
+	backupFile := fmt.Sprintf("%s.backup.%d", em.secretPath(masterKeyFile), os.Getpid())
 	if err := os.WriteFile(backupFile, []byte(base64.StdEncoding.EncodeToString(oldMasterKey)), 0600); err != nil {
 		return err
 	}
-	if err := os.WriteFile(masterKeyFile, []byte(encoded), 0600); err != nil {
+	if err := os.WriteFile(em.secretPath(masterKeyFile), []byte(encoded), 0600); err != nil {
 		return err
 	}
 
@@ -4,9 +4,15 @@ import (
 	"testing"
 )
 
+// newTestEncryptionManager 在臨時目錄中生成密鑰，避免測試在源碼目錄寫入 .secrets
+func newTestEncryptionManager(tb testing.TB) (*EncryptionManager, error) {
+	tb.Helper()
+	return newEncryptionManager(tb.TempDir())
+}
+
 // TestRSAKeyPairGeneration 測試 RSA 密鑰對生成
 func TestRSAKeyPairGeneration(t *testing.T) {
-	em, err := GetEncryptionManager()
+	em, err := newTestEncryptionManager(t)
 	if err != nil {
 		t.Fatalf("初始化加密管理器失敗: %v", err)
 	}
@@ -25,7 +31,7 @@ func TestRSAKeyPairGeneration(t *testing.T) {
 
 // TestDatabaseEncryption 測試數據庫加密/解密
 func TestDatabaseEncryption(t *testing.T) {
-	em, err := GetEncryptionManager()
+	em, err := newTestEncryptionManager(t)
 	if err != nil {
 		t.Fatalf("初始化加密管理器失敗: %v", err)
 	}
@@ -66,7 +72,7 @@ func TestDatabaseEncryption(t *testing.T) {
 
 // TestHybridEncryption 測試混合加密（前端 → 後端場景）
 func TestHybridEncryption(t *testing.T) {
-	_, err := GetEncryptionManager()
+	_, err := newTestEncryptionManager(t)
 	if err != nil {
 		t.Fatalf("初始化加密管理器失敗: %v", err)
 	}
@@ -82,7 +88,7 @@ func TestHybridEncryption(t *testing.T) {
 
 // TestEmptyString 測試空字串處理
 func TestEmptyString(t *testing.T) {
-	em, err := GetEncryptionManager()
+	em, err := newTestEncryptionManager(t)
 	if err != nil {
 		t.Fatalf("初始化加密管理器失敗: %v", err)
 	}
@@ -106,7 +112,7 @@ func TestEmptyString(t *testing.T) {
 
 // TestInvalidCiphertext 測試無效密文處理
 func TestInvalidCiphertext(t *testing.T) {
-	em, err := GetEncryptionManager()
+	em, err := newTestEncryptionManager(t)
 	if err != nil {
 		t.Fatalf("初始化加密管理器失敗: %v", err)
 	}
@@ -129,7 +135,7 @@ func TestInvalidCiphertext(t *testing.T) {
 
 // BenchmarkEncryption 性能測試：加密
 func BenchmarkEncryption(b *testing.B) {
-	em, _ := GetEncryptionManager()
+	em, _ := newTestEncryptionManager(b)
 	plaintext := "0x1234567890abcdef1234567890abcdef1234567890abcdef1234567890abcdef"
 
 	b.ResetTimer()
@@ -140,7 +146,7 @@ func BenchmarkEncryption(b *testing.B) {
 
 // BenchmarkDecryption 性能測試：解密
 func BenchmarkDecryption(b *testing.B) {
-	em, _ := GetEncryptionManager()
+	em, _ := newTestEncryptionManager(b)
 	plaintext := "0x1234567890abcdef1234567890abcdef1234567890abcdef1234567890abcdef"
 	encrypted, _ := em.EncryptForDatabase(plaintext)
 
@@ -0,0 +1,332 @@
+package decision
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"nofx/market"
+	"nofx/mcp"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// defaultMaxToolCalls 代理模式每个周期默认的工具调用上限
+	defaultMaxToolCalls = 8
+	// maxAgentCandidates 代理模式概览中最多列出的候选币种（概览每个币种只占一行）
+	maxAgentCandidates = 50
+	// agentOrderBookLevels get_orderbook 输出的买卖盘档数
+	agentOrderBookLevels = 10
+	// maxToolResultLength 单次工具结果的最大长度（超出部分截断，避免对话过长）
+	maxToolResultLength = 8000
+)
+
+// 代理模式可用的工具
+const (
+	toolGetMarketData      = "get_market_data"
+	toolGetPositionHistory = "get_position_history"
+	toolGetOrderBook       = "get_orderbook"
+)
+
+// ToolCallRecord 代理模式下的一次工具调用（完整记录保存在决策日志中）
+type ToolCallRecord struct {
+	Round      int    `json:"round"`     // 第几轮AI请求
+	Name       string `json:"name"`      // 工具名
+	Arguments  string `json:"arguments"` // AI传入的参数（JSON）
+	Result     string `json:"result"`    // 返回给AI的结果
+	Error      string `json:"error,omitempty"`
+	DurationMs int64  `json:"duration_ms"`
+}
+
+// agentTools 代理模式提供给AI的工具
+func agentTools() []mcp.Tool {
+	symbolParam := map[string]interface{}{"type": "string", "description": "交易对，如 BTCUSDT（须是概览中列出的币种）"}
+	return []mcp.Tool{
+		{
+			Name:        toolGetMarketData,
+			Description: "获取单个币种的完整行情数据（价格序列、EMA/MACD/RSI等指标、持仓量、资金费率）",
+			Parameters: map[string]interface{}{
+				"type":     "object",
+				"required": []string{"symbol"},
+				"properties": map[string]interface{}{
+					"symbol":    symbolParam,
+					"timeframe": map[string]interface{}{"type": "string", "description": "K线周期，如 3m/15m/1h/4h/1d；省略时使用交易员配置的周期"},
+				},
+			},
+		},
+		{
+			Name:        toolGetPositionHistory,
+			Description: "获取单个币种的当前持仓和最近已平仓交易的盈亏统计",
+			Parameters: map[string]interface{}{
+				"type":       "object",
+				"required":   []string{"symbol"},
+				"properties": map[string]interface{}{"symbol": symbolParam},
+			},
+		},
+		{
+			Name:        toolGetOrderBook,
+			Description: fmt.Sprintf("获取单个币种的订单簿（价差、±0.5%%/±1%%深度、买卖盘前%d档）", agentOrderBookLevels),
+			Parameters: map[string]interface{}{
+				"type":       "object",
+				"required":   []string{"symbol"},
+				"properties": map[string]interface{}{"symbol": symbolParam},
+			},
+		},
+	}
+}
+
+// runAgent 代理模式：AI按需调用工具查询数据，最后调用 submit_decisions 提交决策
+// 返回最终响应、包含工具调用过程的完整对话（用于修正请求）和工具调用记录
+func runAgent(ctx *Context, client *mcp.Client, messages []mcp.Message) (*mcp.Response, []mcp.Message, []ToolCallRecord, error) {
+	budget := ctx.MaxToolCalls
+	if budget <= 0 {
+		budget = defaultMaxToolCalls
+	}
+
+	var records []ToolCallRecord
+	used := 0
+	for round := 1; ; round++ {
+		// 预算用尽后不再提供查询工具，强制AI提交决策
+		tools := agentTools()
+		if used >= budget {
+			tools = nil
+		}
+		resp, err := client.CallWithTools(messages, tools, DecisionResponseSchema())
+		if err != nil {
+			return nil, messages, records, err
+		}
+		if resp.Structured != "" || len(resp.ToolCalls) == 0 {
+			log.Printf("🧰 代理模式完成：%d轮请求，%d次工具调用", round, used)
+			return resp, messages, records, nil
+		}
+
+		messages = append(messages, mcp.Message{Role: "assistant", Content: resp.Content, ToolCalls: resp.ToolCalls})
+		for _, call := range resp.ToolCalls {
+			record := ToolCallRecord{Round: round, Name: call.Function.Name, Arguments: call.Function.Arguments}
+			if used >= budget {
+				record.Error = "超出工具调用预算"
+				record.Result = fmt.Sprintf("工具调用预算（%d次）已用尽，请根据已有信息调用 submit_decisions 提交决策", budget)
+			} else {
+				used++
+				start := time.Now()
+				result, err := executeAgentTool(ctx, call.Function.Name, call.Function.Arguments)
+				record.DurationMs = time.Since(start).Milliseconds()
+				if err != nil {
+					record.Error = err.Error()
+					result = "错误: " + err.Error()
+				}
+				record.Result = truncateToolResult(result)
+			}
+			log.Printf("🧰 [%d/%d] %s(%s)", used, budget, record.Name, record.Arguments)
+			records = append(records, record)
+			messages = append(messages, mcp.Message{Role: "tool", ToolCallID: call.ID, Content: record.Result})
+		}
+	}
+}
+
+// executeAgentTool 执行AI请求的工具
+func executeAgentTool(ctx *Context, name, arguments string) (string, error) {
+	var args struct {
+		Symbol    string `json:"symbol"`
+		Timeframe string `json:"timeframe"`
+	}
+	if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+		return "", fmt.Errorf("参数不是有效的JSON: %v", err)
+	}
+
+	switch name {
+	case toolGetMarketData:
+		symbol, err := agentSymbol(ctx, args.Symbol)
+		if err != nil {
+			return "", err
+		}
+		return agentMarketData(ctx, symbol, args.Timeframe)
+	case toolGetPositionHistory:
+		symbol, err := agentSymbol(ctx, args.Symbol)
+		if err != nil {
+			return "", err
+		}
+		return agentPositionHistory(ctx, symbol)
+	case toolGetOrderBook:
+		symbol, err := agentSymbol(ctx, args.Symbol)
+		if err != nil {
+			return "", err
+		}
+		// 订单簿取自交易员所在交易所（深度因交易所而异）
+		book, err := ctx.MarketDataConfig.DataSource().OrderBook(symbol)
+		if err != nil {
+			return "", err
+		}
+		return market.FormatOrderBook(book, agentOrderBookLevels), nil
+	}
+	return "", fmt.Errorf("未知工具: %s", name)
+}
+
+// agentSymbol 校验AI请求的币种：只能查询概览中列出的币种（持仓或候选币种）
+func agentSymbol(ctx *Context, raw string) (string, error) {
+	symbol := strings.ToUpper(strings.TrimSpace(raw))
+	if symbol == "" {
+		return "", fmt.Errorf("缺少参数 symbol")
+	}
+	for _, candidate := range []string{symbol, market.Normalize(symbol)} {
+		if _, ok := ctx.MarketDataMap[candidate]; ok {
+			return candidate, nil
+		}
+		for _, pos := range ctx.Positions {
+			if pos.Symbol == candidate {
+				return candidate, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("%s 不在本周期的概览中", symbol)
+}
+
+// agentMarketData 返回币种的完整行情数据；指定周期时按该周期重新获取
+func agentMarketData(ctx *Context, symbol, timeframe string) (string, error) {
+	if timeframe == "" {
+		if data, ok := ctx.MarketDataMap[symbol]; ok {
+			return market.Format(data), nil
+		}
+	} else if _, ok := market.TimeframeDuration(timeframe); !ok {
+		return "", fmt.Errorf("不支持的K线周期: %s", timeframe)
+	}
+
+	cfg := &market.DataConfig{}
+	if ctx.MarketDataConfig != nil {
+		*cfg = *ctx.MarketDataConfig
+	}
+	if timeframe != "" {
+		cfg.Timeframes = []string{timeframe}
+	}
+	data, err := market.GetWithConfig(symbol, cfg)
+	if err != nil {
+		return "", err
+	}
+	return market.Format(data), nil
+}
+
+// agentPositionHistory 返回币种的当前持仓和历史交易统计（从 ctx.Performance 中提取）
+func agentPositionHistory(ctx *Context, symbol string) (string, error) {
+	var history struct {
+		Symbol       string            `json:"symbol"`
+		Position     *PositionInfo     `json:"current_position"`
+		Stats        json.RawMessage   `json:"stats,omitempty"`
+		RecentTrades []json.RawMessage `json:"recent_trades"`
+	}
+	history.Symbol = symbol
+	history.RecentTrades = []json.RawMessage{}
+	for i := range ctx.Positions {
+		if ctx.Positions[i].Symbol == symbol {
+			history.Position = &ctx.Positions[i]
+			break
+		}
+	}
+
+	if ctx.Performance != nil {
+		// 与夏普比率相同，通过JSON从 interface{} 中提取需要的字段
+		var perf struct {
+			RecentTrades []json.RawMessage          `json:"recent_trades"`
+			SymbolStats  map[string]json.RawMessage `json:"symbol_stats"`
+		}
+		jsonData, err := json.Marshal(ctx.Performance)
+		if err != nil {
+			return "", err
+		}
+		if err := json.Unmarshal(jsonData, &perf); err != nil {
+			return "", err
+		}
+		history.Stats = perf.SymbolStats[symbol]
+		for _, trade := range perf.RecentTrades {
+			var t struct {
+				Symbol string `json:"symbol"`
+			}
+			if json.Unmarshal(trade, &t) == nil && t.Symbol == symbol {
+				history.RecentTrades = append(history.RecentTrades, trade)
+			}
+		}
+	}
+
+	out, err := json.Marshal(history)
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+// truncateToolResult 截断过长的工具结果
+func truncateToolResult(result string) string {
+	if len(result) <= maxToolResultLength {
+		return result
+	}
+	cut := maxToolResultLength
+	for cut > 0 && !utf8.RuneStart(result[cut]) {
+		cut--
+	}
+	return result[:cut] + "\n……（结果过长，已截断）"
+}
+
+// buildAgentUserPrompt 构建代理模式的 User Prompt：账户、持仓和候选币种各一行的紧凑概览
+func buildAgentUserPrompt(ctx *Context) string {
+	var sb strings.Builder
+	writePromptHeader(&sb, ctx)
+
+	if len(ctx.Positions) > 0 {
+		sb.WriteString("## 当前持仓\n")
+		for i, pos := range ctx.Positions {
+			sb.WriteString(formatPositionLine(i, pos))
+		}
+	} else {
+		sb.WriteString("当前持仓: 无\n\n")
+	}
+
+	sb.WriteString("## 候选币种概览\n\n")
+	displayed := make(map[string]bool)
+	for _, coin := range ctx.CandidateCoins {
+		if data, ok := ctx.MarketDataMap[coin.Symbol]; ok && !displayed[coin.Symbol] {
+			displayed[coin.Symbol] = true
+			sb.WriteString(fmt.Sprintf("%d. %s%s | %s\n", len(displayed), coin.Symbol, candidateSourceTags(coin), formatOverviewLine(data)))
+		}
+	}
+	// 持仓和BTC等不在候选列表中的币种也列出，方便查询
+	var others []string
+	for symbol := range ctx.MarketDataMap {
+		if !displayed[symbol] {
+			others = append(others, symbol)
+		}
+	}
+	sort.Strings(others)
+	for _, symbol := range others {
+		displayed[symbol] = true
+		sb.WriteString(fmt.Sprintf("%d. %s | %s\n", len(displayed), symbol, formatOverviewLine(ctx.MarketDataMap[symbol])))
+	}
+	sb.WriteString("\n")
+
+	writeSharpeRatio(&sb, ctx)
+	writeTradeMemory(&sb, ctx)
+
+	budget := ctx.MaxToolCalls
+	if budget <= 0 {
+		budget = defaultMaxToolCalls
+	}
+	sb.WriteString("---\n\n")
+	sb.WriteString(fmt.Sprintf("以上是紧凑概览。你可以调用 %s、%s、%s 查询具体币种的详细数据（本周期最多 %d 次），",
+		toolGetMarketData, toolGetPositionHistory, toolGetOrderBook, budget))
+	sb.WriteString("只查询与决策相关的币种，然后调用 submit_decisions 提交思维链和决策\n")
+
+	return sb.String()
+}
+
+// formatOverviewLine 单个币种的概览：价格、涨跌幅、关键指标、资金费率、持仓价值和市场状态
+func formatOverviewLine(data *market.Data) string {
+	line := fmt.Sprintf("价格 %.4f | 1h %+.2f%% | 4h %+.2f%% | RSI7 %.1f | MACD %.4f | 资金费率 %.2e",
+		data.CurrentPrice, data.PriceChange1h, data.PriceChange4h, data.CurrentRSI7, data.CurrentMACD, data.FundingRate)
+	if data.OpenInterest != nil && data.OpenInterest.Latest > 0 {
+		line += fmt.Sprintf(" | OI %.1fM USD", data.OpenInterest.Latest*data.CurrentPrice/1_000_000)
+	}
+	if data.Regime != nil {
+		line += " | " + regimeLabels[data.Regime.Regime]
+	}
+	return line
+}
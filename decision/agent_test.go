@@ -0,0 +1,138 @@
+package decision
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"nofx/market"
+	"nofx/mcp"
+)
+
+// TestRunAgent 工具调用结果回传给AI，超出预算的调用被拒绝，预算用尽后强制提交决策
+func TestRunAgent(t *testing.T) {
+	var requests []map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]interface{}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		requests = append(requests, req)
+		if tools, _ := req["tools"].([]interface{}); len(tools) > 1 {
+			w.Write([]byte(`{"choices":[{"message":{"content":"先查历史","tool_calls":[
+				{"id":"c1","type":"function","function":{"name":"get_position_history","arguments":"{\"symbol\":\"sol\"}"}},
+				{"id":"c2","type":"function","function":{"name":"get_orderbook","arguments":"{\"symbol\":\"SOLUSDT\"}"}}]}}]}`))
+			return
+		}
+		w.Write([]byte(`{"choices":[{"message":{"content":"","tool_calls":[{"id":"c3","type":"function","function":{"name":"submit_decisions","arguments":"{\"reasoning\":\"观望\",\"decisions\":[{\"symbol\":\"SOLUSDT\",\"action\":\"wait\"}]}"}}]}}]}`))
+	}))
+	defer server.Close()
+
+	client := mcp.New()
+	client.SetCustomAPI(server.URL, "test-key", "test-model")
+	ctx := &Context{
+		MarketDataMap: map[string]*market.Data{"SOLUSDT": {Symbol: "SOLUSDT", CurrentPrice: 150}},
+		Performance: map[string]interface{}{
+			"recent_trades": []map[string]interface{}{
+				{"symbol": "SOLUSDT", "pn_l": 12.5},
+				{"symbol": "BTCUSDT", "pn_l": -3},
+			},
+			"symbol_stats": map[string]interface{}{"SOLUSDT": map[string]interface{}{"win_rate": 100}},
+		},
+		MaxToolCalls: 1,
+	}
+	messages := []mcp.Message{{Role: "system", Content: "sys"}, {Role: "user", Content: "overview"}}
+
+	resp, messages, records, err := runAgent(ctx, client, messages)
+	if err != nil {
+		t.Fatalf("代理模式失败: %v", err)
+	}
+	if resp.Structured == "" || len(requests) != 2 {
+		t.Fatalf("应在第2轮提交决策: resp=%+v requests=%d", resp, len(requests))
+	}
+	if choice, ok := requests[1]["tool_choice"].(map[string]interface{}); !ok || choice["type"] != "function" {
+		t.Errorf("预算用尽后应强制调用 submit_decisions: %v", requests[1]["tool_choice"])
+	}
+
+	if len(records) != 2 {
+		t.Fatalf("应记录2次工具调用, got %d", len(records))
+	}
+	if records[0].Error != "" || !strings.Contains(records[0].Result, `"pn_l":12.5`) || strings.Contains(records[0].Result, "BTCUSDT") {
+		t.Errorf("历史交易应只包含SOLUSDT: %+v", records[0])
+	}
+	if records[1].Error != "超出工具调用预算" {
+		t.Errorf("第2次调用应超出预算: %+v", records[1])
+	}
+
+	// system + user + assistant(tool_calls) + 2个 tool 结果
+	if len(messages) != 5 || messages[3].ToolCallID != "c1" || messages[4].ToolCallID != "c2" {
+		t.Errorf("对话应包含工具调用过程: %+v", messages)
+	}
+}
+
+// stubOrderBookSource 只提供订单簿的行情数据源（模拟非币安交易所）
+type stubOrderBookSource struct {
+	market.MarketDataSource
+	book *market.OrderBook
+}
+
+func (s stubOrderBookSource) OrderBook(symbol string) (*market.OrderBook, error) { return s.book, nil }
+
+// TestExecuteAgentTool_OrderBookFromTraderSource get_orderbook 使用交易员所在交易所的订单簿
+func TestExecuteAgentTool_OrderBookFromTraderSource(t *testing.T) {
+	book := &market.OrderBook{
+		Symbol: "SOLUSDC",
+		Bids:   []market.OrderBookLevel{{Price: 149.9, Quantity: 10}},
+		Asks:   []market.OrderBookLevel{{Price: 150.1, Quantity: 5}},
+	}
+	ctx := &Context{
+		MarketDataMap:    map[string]*market.Data{"SOLUSDC": {Symbol: "SOLUSDC"}},
+		MarketDataConfig: &market.DataConfig{Source: stubOrderBookSource{book: book}},
+	}
+	result, err := executeAgentTool(ctx, toolGetOrderBook, `{"symbol":"SOLUSDC"}`)
+	if err != nil || result != market.FormatOrderBook(book, agentOrderBookLevels) {
+		t.Errorf("get_orderbook = %q, %v", result, err)
+	}
+}
+
+func TestAgentSymbol(t *testing.T) {
+	ctx := &Context{
+		MarketDataMap: map[string]*market.Data{"BTCUSDT": {}},
+		Positions:     []PositionInfo{{Symbol: "ETHUSDT"}},
+	}
+	for raw, want := range map[string]string{"btc": "BTCUSDT", " BTCUSDT ": "BTCUSDT", "ETH": "ETHUSDT"} {
+		if got, err := agentSymbol(ctx, raw); err != nil || got != want {
+			t.Errorf("agentSymbol(%q) = %q, %v; 期望 %s", raw, got, err, want)
+		}
+	}
+	if _, err := agentSymbol(ctx, "DOGEUSDT"); err == nil {
+		t.Error("不在概览中的币种应返回错误")
+	}
+}
+
+func TestBuildAgentUserPrompt(t *testing.T) {
+	ctx := &Context{
+		Account:        AccountInfo{TotalEquity: 1000, AvailableBalance: 800},
+		CandidateCoins: []CandidateCoin{{Symbol: "SOLUSDT", Sources: []string{"oi_top"}}},
+		MarketDataMap: map[string]*market.Data{
+			"SOLUSDT": {Symbol: "SOLUSDT", CurrentPrice: 150, PriceChange1h: 1.5, OpenInterest: &market.OIData{Latest: 100000}},
+			"BTCUSDT": {Symbol: "BTCUSDT", CurrentPrice: 100000},
+		},
+		MaxToolCalls: 5,
+	}
+
+	prompt := buildAgentUserPrompt(ctx)
+	for _, want := range []string{
+		"1. SOLUSDT (OI_Top持仓增长) | 价格 150.0000 | 1h +1.50%",
+		"OI 15.0M USD",
+		"2. BTCUSDT | 价格 100000.0000",
+		"本周期最多 5 次",
+	} {
+		if !strings.Contains(prompt, want) {
+			t.Errorf("概览缺少 %q:\n%s", want, prompt)
+		}
+	}
+	if strings.Contains(prompt, "current_price =") {
+		t.Errorf("概览不应包含完整行情数据:\n%s", prompt)
+	}
+}
@@ -2,6 +2,7 @@ package decision
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"math"
@@ -9,6 +10,7 @@ import (
 	"nofx/mcp"
 	"nofx/pool"
 	"regexp"
+	"slices"
 	"strings"
 	"time"
 )
@@ -74,17 +76,37 @@ type OITopData struct {
 
 // Context 交易上下文（传递给AI的完整信息）
 type Context struct {
-	CurrentTime     string                  `json:"current_time"`
-	RuntimeMinutes  int                     `json:"runtime_minutes"`
-	CallCount       int                     `json:"call_count"`
-	Account         AccountInfo             `json:"account"`
-	Positions       []PositionInfo          `json:"positions"`
-	CandidateCoins  []CandidateCoin         `json:"candidate_coins"`
-	MarketDataMap   map[string]*market.Data `json:"-"` // 不序列化，但内部使用
-	OITopDataMap    map[string]*OITopData   `json:"-"` // OI Top数据映射
-	Performance     interface{}             `json:"-"` // 历史表现分析（logger.PerformanceAnalysis）
-	BTCETHLeverage  int                     `json:"-"` // BTC/ETH杠杆倍数（从配置读取）
-	AltcoinLeverage int                     `json:"-"` // 山寨币杠杆倍数（从配置读取）
+	CurrentTime         string                     `json:"current_time"`
+	RuntimeMinutes      int                        `json:"runtime_minutes"`
+	CallCount           int                        `json:"call_count"`
+	Account             AccountInfo                `json:"account"`
+	Positions           []PositionInfo             `json:"positions"`
+	CandidateCoins      []CandidateCoin            `json:"candidate_coins"`
+	MarketDataMap       map[string]*market.Data    `json:"-"` // 不序列化，但内部使用
+	OITopDataMap        map[string]*OITopData      `json:"-"` // OI Top数据映射
+	Performance         interface{}                `json:"-"` // 历史表现分析（logger.PerformanceAnalysis）
+	BTCETHLeverage      int                        `json:"-"` // BTC/ETH杠杆倍数（从配置读取）
+	AltcoinLeverage     int                        `json:"-"` // 山寨币杠杆倍数（从配置读取）
+	MarketDataConfig    *market.DataConfig         `json:"-"` // K线周期和指标配置（nil使用系统默认）
+	MarketRegime        *market.RegimeData         `json:"-"` // BTC的市场状态
+	Correlations        *market.Correlations       `json:"-"` // 持仓、候选币种和BTC的收益率相关系数
+	RegimeTemplates     map[string]string          `json:"-"` // 市场状态 -> 系统提示词模板（未配置的状态使用交易员模板）
+	UserPromptTemplates map[string]*PromptTemplate `json:"-"` // 用户在数据库中保存的模板（最新版本，优先于同名的 prompts/ 模板）
+	PromptLanguage      string                     `json:"-"` // 系统提示词语言（zh/en，空值为中文）
+
+	AgentMode    bool `json:"-"` // 代理模式：User Prompt 只给紧凑概览，AI通过工具按需查询详细数据
+	MaxToolCalls int  `json:"-"` // 代理模式每个周期的工具调用上限（<=0 使用默认值）
+
+	RiskReview       bool   `json:"-"` // 是否由风控经理对开仓决策做第二阶段审核
+	RiskReviewPrompt string `json:"-"` // 交易员配置的额外风控规则（追加到风控 System Prompt）
+
+	ValidationRules *ValidationRules      `json:"-"` // 交易员的开仓校验规则（nil使用默认规则）
+	Instruments     *market.InstrumentSet `json:"-"` // 交易所可交易品种（提供真实最小名义价值，nil时使用默认值）
+
+	TradeMemory bool   `json:"-"` // 是否在 User Prompt 中加入交易记忆（最近交易、币种战绩、近期失误和AI复盘）
+	Reflection  string `json:"-"` // 最近一次AI复盘（由交易员定期生成）
+
+	droppedCandidates []string // 本周期因超出prompt预算未提供市场数据的候选币种（校验时拒绝对其开仓）
 }
 
 // Decision AI的交易决策
@@ -118,6 +140,15 @@ type FullDecision struct {
 	Timestamp    time.Time  `json:"timestamp"`
 	// AIRequestDurationMs 记录 AI API 调用耗时（毫秒）方便排查延迟问题
 	AIRequestDurationMs int64 `json:"ai_request_duration_ms,omitempty"`
+	// PromptTemplate/PromptTemplateVersion 生成系统提示词的模板及版本（prompts/ 目录的模板版本为0，完全自定义prompt时为空）
+	PromptTemplate        string `json:"prompt_template,omitempty"`
+	PromptTemplateVersion int    `json:"prompt_template_version,omitempty"`
+	// ToolCalls 代理模式下AI的完整工具调用记录
+	ToolCalls []ToolCallRecord `json:"tool_calls,omitempty"`
+	// RiskReview 第二阶段风控审核记录（未启用或没有开仓决策时为空），Decisions 为审核后的决策
+	RiskReview *RiskReview `json:"risk_review,omitempty"`
+	// PromptBudget User Prompt 的token预算和压缩情况（代理模式为空）
+	PromptBudget *PromptBudget `json:"prompt_budget,omitempty"`
 }
 
 // GetFullDecision 获取AI的完整交易决策（批量分析所有币种和持仓）
@@ -133,19 +164,69 @@ func GetFullDecisionWithCustomPrompt(ctx *Context, mcpClient *mcp.Client, custom
 	}
 
 	// 2. 构建 System Prompt（固定规则）和 User Prompt（动态数据）
-	systemPrompt := buildSystemPromptWithCustom(ctx.Account.TotalEquity, ctx.BTCETHLeverage, ctx.AltcoinLeverage, customPrompt, overrideBase, templateName)
-	userPrompt := buildUserPrompt(ctx)
+	templateName = selectTemplateForRegime(ctx, templateName)
+	systemPrompt, usedTemplate := buildSystemPromptWithCustom(promptVariablesForContext(ctx), customPrompt, overrideBase, templateName, ctx.UserPromptTemplates)
+	// 完整数据的 User Prompt 按模型上下文窗口压缩；代理模式只输出紧凑概览
+	var userPrompt string
+	var promptBudget *PromptBudget
+	if ctx.AgentMode {
+		userPrompt = buildAgentUserPrompt(ctx)
+	} else {
+		userPrompt, promptBudget = buildBudgetedUserPrompt(ctx, systemPrompt, mcpClient)
+	}
 
-	// 3. 调用AI API（使用 system + user prompt）
+	// 3. 调用AI API（使用 system + user prompt，支持时要求按 Schema 结构化输出）
+	messages := []mcp.Message{
+		{Role: "system", Content: systemPrompt},
+		{Role: "user", Content: userPrompt},
+	}
 	aiCallStart := time.Now()
-	aiResponse, err := mcpClient.CallWithMessages(systemPrompt, userPrompt)
-	aiCallDuration := time.Since(aiCallStart)
+	var aiResponse *mcp.Response
+	var toolCalls []ToolCallRecord
+	var err error
+	if ctx.AgentMode {
+		aiResponse, messages, toolCalls, err = runAgent(ctx, mcpClient, messages)
+		if errors.Is(err, mcp.ErrToolsUnsupported) {
+			// 模型不支持工具调用：回退到完整数据的 User Prompt
+			log.Printf("⚠️  代理模式不可用，回退为完整数据prompt: %v", err)
+			userPrompt, promptBudget = buildBudgetedUserPrompt(ctx, systemPrompt, mcpClient)
+			messages = []mcp.Message{
+				{Role: "system", Content: systemPrompt},
+				{Role: "user", Content: userPrompt},
+			}
+			aiResponse, err = mcpClient.CallWithConversation(messages, DecisionResponseSchema())
+		}
+	} else {
+		aiResponse, err = mcpClient.CallWithConversation(messages, DecisionResponseSchema())
+	}
 	if err != nil {
 		return nil, fmt.Errorf("调用AI API失败: %w", err)
 	}
 
-	// 4. 解析AI响应
-	decision, err := parseFullDecisionResponse(aiResponse, ctx.Account.TotalEquity, ctx.BTCETHLeverage, ctx.AltcoinLeverage)
+	// 4. 解析AI响应；不符合 Schema 时把具体错误发回给AI修正一次
+	ctx.droppedCandidates = nil
+	if promptBudget != nil {
+		ctx.droppedCandidates = promptBudget.DroppedCandidates
+	}
+	decision, err := parseDecisionResponse(aiResponse, ctx)
+	var schemaErr *SchemaError
+	if errors.As(err, &schemaErr) {
+		log.Printf("🔁 AI决策不符合Schema（%d处错误），请求AI修正: %v", len(schemaErr.Errors), schemaErr)
+		messages = append(messages,
+			mcp.Message{Role: "assistant", Content: rawDecisionReply(aiResponse)},
+			mcp.Message{Role: "user", Content: buildRepairPrompt(schemaErr)},
+		)
+		repaired, callErr := mcpClient.CallWithConversation(messages, DecisionResponseSchema())
+		if callErr != nil {
+			err = fmt.Errorf("%w（修正请求失败: %v）", err, callErr)
+		} else {
+			decision, err = parseDecisionResponse(repaired, ctx)
+			if err == nil {
+				log.Printf("✓ AI已按Schema修正决策")
+			}
+		}
+	}
+	aiCallDuration := time.Since(aiCallStart)
 
 	// 无论是否有错误，都要保存 SystemPrompt 和 UserPrompt（用于调试和决策未执行后的问题定位）
 	if decision != nil {
@@ -153,12 +234,23 @@ func GetFullDecisionWithCustomPrompt(ctx *Context, mcpClient *mcp.Client, custom
 		decision.SystemPrompt = systemPrompt // 保存系统prompt
 		decision.UserPrompt = userPrompt     // 保存输入prompt
 		decision.AIRequestDurationMs = aiCallDuration.Milliseconds()
+		decision.ToolCalls = toolCalls
+		decision.PromptBudget = promptBudget
+		if usedTemplate != nil {
+			decision.PromptTemplate = usedTemplate.Name
+			decision.PromptTemplateVersion = usedTemplate.Version
+		}
 	}
 
 	if err != nil {
 		return decision, fmt.Errorf("解析AI响应失败: %w", err)
 	}
 
+	// 5. 风控经理审核开仓决策（可选）
+	if ctx.RiskReview {
+		decision.Decisions, decision.RiskReview = reviewDecisions(ctx, mcpClient, decision.Decisions)
+	}
+
 	decision.Timestamp = time.Now()
 	decision.SystemPrompt = systemPrompt // 保存系统prompt
 	decision.UserPrompt = userPrompt     // 保存输入prompt
@@ -178,8 +270,11 @@ func fetchMarketDataForContext(ctx *Context) error {
 		symbolSet[pos.Symbol] = true
 	}
 
-	// 2. 候选币种数量根据账户状态动态调整
+	// 2. 候选币种数量根据账户状态动态调整（代理模式只输出概览，可以覆盖更多币种）
 	maxCandidates := calculateMaxCandidates(ctx)
+	if ctx.AgentMode {
+		maxCandidates = min(len(ctx.CandidateCoins), maxAgentCandidates)
+	}
 	for i, coin := range ctx.CandidateCoins {
 		if i >= maxCandidates {
 			break
@@ -187,6 +282,11 @@ func fetchMarketDataForContext(ctx *Context) error {
 		symbolSet[coin.Symbol] = true
 	}
 
+	// 3. BTC 用于判断市场状态和计算相关性
+	if !symbolSet["BTCUSDT"] && !symbolSet["BTCUSDC"] {
+		symbolSet["BTCUSDT"] = true
+	}
+
 	// 并发获取市场数据
 	// 持仓币种集合（用于判断是否跳过OI检查）
 	positionSymbols := make(map[string]bool)
@@ -195,7 +295,7 @@ func fetchMarketDataForContext(ctx *Context) error {
 	}
 
 	for symbol := range symbolSet {
-		data, err := market.Get(symbol)
+		data, err := market.GetWithConfig(symbol, ctx.MarketDataConfig)
 		if err != nil {
 			// 单个币种失败不影响整体，只记录错误
 			continue
@@ -219,9 +319,17 @@ func fetchMarketDataForContext(ctx *Context) error {
 			}
 		}
 
+		// 按系统提示词中的单币仓位上限估算滑点（提示词中注明是最大仓位，实际开仓的滑点由 checkSlippage 按开仓金额检查）
+		data.Liquidity.EstimateFor(ctx.validationRules().MaxNotional(symbol, ctx.Account.TotalEquity))
+
 		ctx.MarketDataMap[symbol] = data
 	}
 
+	if btc, ok := btcSymbol(ctx.MarketDataMap); ok {
+		ctx.MarketRegime = ctx.MarketDataMap[btc].Regime
+	}
+	ctx.Correlations = market.ComputeCorrelations(ctx.MarketDataMap)
+
 	// 加载OI Top数据（不影响主流程）
 	oiPositions, err := pool.GetOITopPositions()
 	if err == nil {
@@ -242,7 +350,8 @@ func fetchMarketDataForContext(ctx *Context) error {
 	return nil
 }
 
-// calculateMaxCandidates 根据账户状态计算需要分析的候选币种数量
+// calculateMaxCandidates 根据账户状态计算需要获取市场数据的候选币种数量
+// 最终输出到 prompt 的数量还受模型上下文窗口限制（见 fitUserPrompt）
 func calculateMaxCandidates(ctx *Context) int {
 	// ⚠️ 重要：限制候选币种数量，避免 Prompt 过大
 	// 根据持仓数量动态调整：持仓越少，可以分析更多候选币
@@ -271,145 +380,99 @@ func calculateMaxCandidates(ctx *Context) int {
 	return min(len(ctx.CandidateCoins), maxCandidates)
 }
 
-// buildSystemPromptWithCustom 构建包含自定义内容的 System Prompt
-func buildSystemPromptWithCustom(accountEquity float64, btcEthLeverage, altcoinLeverage int, customPrompt string, overrideBase bool, templateName string) string {
+// buildSystemPromptWithCustom 构建包含自定义内容的 System Prompt，同时返回使用的模板（完全自定义时为nil）
+func buildSystemPromptWithCustom(vars PromptVariables, customPrompt string, overrideBase bool, templateName string, userTemplates map[string]*PromptTemplate) (string, *PromptTemplate) {
 	// 如果覆盖基础prompt且有自定义prompt，只使用自定义prompt
 	if overrideBase && customPrompt != "" {
-		return customPrompt
+		return customPrompt, nil
 	}
 
 	// 获取基础prompt（使用指定的模板）
-	basePrompt := buildSystemPrompt(accountEquity, btcEthLeverage, altcoinLeverage, templateName)
+	basePrompt, usedTemplate := buildSystemPrompt(vars, templateName, userTemplates)
 
 	// 如果没有自定义prompt，直接返回基础prompt
 	if customPrompt == "" {
-		return basePrompt
+		return basePrompt, usedTemplate
 	}
 
 	// 添加自定义prompt部分到基础prompt
 	var sb strings.Builder
 	sb.WriteString(basePrompt)
 	sb.WriteString("\n\n")
-	sb.WriteString("# 📌 个性化交易策略\n\n")
-	sb.WriteString(customPrompt)
-	sb.WriteString("\n\n")
-	sb.WriteString("注意: 以上个性化策略是对基础规则的补充，不能违背基础风险控制原则。\n")
+	if vars.Language == PromptLanguageEN {
+		sb.WriteString("# 📌 Personalized Trading Strategy\n\n")
+		sb.WriteString(customPrompt)
+		sb.WriteString("\n\n")
+		sb.WriteString("Note: the personalized strategy above supplements the base rules and must not violate the base risk controls.\n")
+	} else {
+		sb.WriteString("# 📌 个性化交易策略\n\n")
+		sb.WriteString(customPrompt)
+		sb.WriteString("\n\n")
+		sb.WriteString("注意: 以上个性化策略是对基础规则的补充，不能违背基础风险控制原则。\n")
+	}
 
-	return sb.String()
+	return sb.String(), usedTemplate
 }
 
-// buildSystemPrompt 构建 System Prompt（使用模板+动态部分）
-func buildSystemPrompt(accountEquity float64, btcEthLeverage, altcoinLeverage int, templateName string) string {
-	var sb strings.Builder
+// lookupPromptTemplate 按名称查找模板：用户模板优先，其次为 prompts/ 目录的模板
+func lookupPromptTemplate(name string, userTemplates map[string]*PromptTemplate) (*PromptTemplate, error) {
+	if tmpl, ok := userTemplates[name]; ok {
+		return tmpl, nil
+	}
+	return GetPromptTemplate(name)
+}
 
-	// 1. 加载提示词模板（核心交易策略部分）
+// buildSystemPrompt 构建 System Prompt（渲染模板，模板未引用的硬约束和输出格式追加在末尾），同时返回使用的模板
+func buildSystemPrompt(vars PromptVariables, templateName string, userTemplates map[string]*PromptTemplate) (string, *PromptTemplate) {
+	// 加载提示词模板（核心交易策略部分）
 	if templateName == "" {
 		templateName = "default" // 默认使用 default 模板
 	}
 
-	template, err := GetPromptTemplate(templateName)
+	tmpl, err := lookupPromptTemplate(templateName, userTemplates)
 	if err != nil {
 		// 如果模板不存在，记录错误并使用 default
 		log.Printf("⚠️  提示词模板 '%s' 不存在，使用 default: %v", templateName, err)
-		template, err = GetPromptTemplate("default")
-		if err != nil {
-			// 如果连 default 都不存在，使用内置的简化版本
-			log.Printf("❌ 无法加载任何提示词模板，使用内置简化版本")
-			sb.WriteString("你是专业的加密货币交易AI。请根据市场数据做出交易决策。\n\n")
-		} else {
-			sb.WriteString(template.Content)
-			sb.WriteString("\n\n")
-		}
 	} else {
-		sb.WriteString(template.Content)
-		sb.WriteString("\n\n")
+		prompt, renderErr := tmpl.Render(vars)
+		if renderErr == nil {
+			return prompt, tmpl
+		}
+		log.Printf("⚠️  %v，使用 default", renderErr)
 	}
 
-	// 2. 硬约束（风险控制）- 动态生成
-	sb.WriteString("# 硬约束（风险控制）\n\n")
-	sb.WriteString("1. 风险回报比: 必须 ≥ 1:3（冒1%风险，赚3%+收益）\n")
-	sb.WriteString("2. 最多持仓: 3个币种（质量>数量）\n")
-	sb.WriteString(fmt.Sprintf("3. 单币仓位: 山寨%.0f-%.0f U | BTC/ETH %.0f-%.0f U\n",
-		accountEquity*0.8, accountEquity*1.5, accountEquity*5, accountEquity*10))
-	sb.WriteString(fmt.Sprintf("4. 杠杆限制: **山寨币最大%dx杠杆** | **BTC/ETH最大%dx杠杆** (⚠️ 严格执行，不可超过)\n", altcoinLeverage, btcEthLeverage))
-	sb.WriteString("5. 保证金: 总使用率 ≤ 90%\n")
-	sb.WriteString("6. 开仓金额: 建议 **≥12 USDT** (交易所最小名义价值 10 USDT + 安全边际)\n\n")
-
-	// 3. 输出格式 - 动态生成
-	sb.WriteString("# 输出格式 (严格遵守)\n\n")
-	sb.WriteString("**必须使用XML标签 <reasoning> 和 <decision> 标签分隔思维链和决策JSON，避免解析错误**\n\n")
-	sb.WriteString("## 格式要求\n\n")
-	sb.WriteString("<reasoning>\n")
-	sb.WriteString("你的思维链分析...\n")
-	sb.WriteString("- 简洁分析你的思考过程 \n")
-	sb.WriteString("</reasoning>\n\n")
-	sb.WriteString("<decision>\n")
-	sb.WriteString("```json\n[\n")
-	sb.WriteString(fmt.Sprintf("  {\"symbol\": \"BTCUSDT\", \"action\": \"open_short\", \"leverage\": %d, \"position_size_usd\": %.0f, \"stop_loss\": 97000, \"take_profit\": 91000, \"confidence\": 85, \"risk_usd\": 300, \"reasoning\": \"下跌趋势+MACD死叉\"},\n", btcEthLeverage, accountEquity*5))
-	sb.WriteString("  {\"symbol\": \"ETHUSDT\", \"action\": \"close_long\", \"reasoning\": \"止盈离场\"}\n")
-	sb.WriteString("]\n```\n")
-	sb.WriteString("</decision>\n\n")
-	sb.WriteString("## 字段说明\n\n")
-	sb.WriteString("- `action`: open_long | open_short | close_long | close_short | hold | wait\n")
-	sb.WriteString("- `confidence`: 0-100（开仓建议≥75）\n")
-	sb.WriteString("- 开仓时必填: leverage, position_size_usd, stop_loss, take_profit, confidence, risk_usd, reasoning\n\n")
+	if templateName != "default" {
+		if tmpl, err = lookupPromptTemplate("default", userTemplates); err == nil {
+			prompt, renderErr := tmpl.Render(vars)
+			if renderErr == nil {
+				return prompt, tmpl
+			}
+			log.Printf("⚠️  %v", renderErr)
+		}
+	}
 
-	return sb.String()
+	// 如果连 default 都不可用，使用内置的简化版本
+	log.Printf("❌ 无法加载任何提示词模板，使用内置简化版本")
+	if vars.Language == PromptLanguageEN {
+		return "You are a professional crypto trading AI. Make trading decisions based on the market data.\n\n" + renderBuiltinSections(vars), nil
+	}
+	return "你是专业的加密货币交易AI。请根据市场数据做出交易决策。\n\n" + renderBuiltinSections(vars), nil
 }
 
-// buildUserPrompt 构建 User Prompt（动态数据）
-func buildUserPrompt(ctx *Context) string {
+// buildUserPrompt 构建 User Prompt（动态数据），序列详细程度和候选币种数量由 layout 决定
+func buildUserPrompt(ctx *Context, layout promptLayout) string {
 	var sb strings.Builder
-
-	// 系统状态
-	sb.WriteString(fmt.Sprintf("时间: %s | 周期: #%d | 运行: %d分钟\n\n",
-		ctx.CurrentTime, ctx.CallCount, ctx.RuntimeMinutes))
-
-	// BTC 市场
-	if btcData, hasBTC := ctx.MarketDataMap["BTCUSDT"]; hasBTC {
-		sb.WriteString(fmt.Sprintf("BTC: %.2f (1h: %+.2f%%, 4h: %+.2f%%) | MACD: %.4f | RSI: %.2f\n\n",
-			btcData.CurrentPrice, btcData.PriceChange1h, btcData.PriceChange4h,
-			btcData.CurrentMACD, btcData.CurrentRSI7))
-	}
-
-	// 账户
-	sb.WriteString(fmt.Sprintf("账户: 净值%.2f | 余额%.2f (%.1f%%) | 盈亏%+.2f%% | 保证金%.1f%% | 持仓%d个\n\n",
-		ctx.Account.TotalEquity,
-		ctx.Account.AvailableBalance,
-		(ctx.Account.AvailableBalance/ctx.Account.TotalEquity)*100,
-		ctx.Account.TotalPnLPct,
-		ctx.Account.MarginUsedPct,
-		ctx.Account.PositionCount))
+	writePromptHeader(&sb, ctx)
 
 	// 持仓（完整市场数据）
 	if len(ctx.Positions) > 0 {
 		sb.WriteString("## 当前持仓\n")
 		for i, pos := range ctx.Positions {
-			// 计算持仓时长
-			holdingDuration := ""
-			if pos.UpdateTime > 0 {
-				durationMs := time.Now().UnixMilli() - pos.UpdateTime
-				durationMin := durationMs / (1000 * 60) // 转换为分钟
-				if durationMin < 60 {
-					holdingDuration = fmt.Sprintf(" | 持仓时长%d分钟", durationMin)
-				} else {
-					durationHour := durationMin / 60
-					durationMinRemainder := durationMin % 60
-					holdingDuration = fmt.Sprintf(" | 持仓时长%d小时%d分钟", durationHour, durationMinRemainder)
-				}
-			}
-
-			// 计算仓位价值（用于 partial_close 检查）
-			positionValue := math.Abs(pos.Quantity) * pos.MarkPrice
-
-			sb.WriteString(fmt.Sprintf("%d. %s %s | 入场价%.4f 当前价%.4f | 数量%.4f | 仓位价值%.2f USDT | 盈亏%+.2f%% | 盈亏金额%+.2f USDT | 最高收益率%.2f%% | 杠杆%dx | 保证金%.0f | 强平价%.4f%s\n\n",
-				i+1, pos.Symbol, strings.ToUpper(pos.Side),
-				pos.EntryPrice, pos.MarkPrice, pos.Quantity, positionValue, pos.UnrealizedPnLPct, pos.UnrealizedPnL, pos.PeakPnLPct,
-				pos.Leverage, pos.MarginUsed, pos.LiquidationPrice, holdingDuration))
+			sb.WriteString(formatPositionLine(i, pos))
 
 			// 使用FormatMarketData输出完整市场数据
 			if marketData, ok := ctx.MarketDataMap[pos.Symbol]; ok {
-				sb.WriteString(market.Format(marketData))
+				sb.WriteString(market.FormatWithDetail(marketData, layout.series))
 				sb.WriteString("\n")
 			}
 		}
@@ -420,40 +483,31 @@ func buildUserPrompt(ctx *Context) string {
 	// 候选币种（完整市场数据）
 	sb.WriteString(fmt.Sprintf("## 候选币种 (%d个)\n\n", len(ctx.MarketDataMap)))
 	displayedCount := 0
+	var omitted []string
 	for _, coin := range ctx.CandidateCoins {
 		marketData, hasData := ctx.MarketDataMap[coin.Symbol]
 		if !hasData {
 			continue
 		}
-		displayedCount++
-
-		sourceTags := ""
-		if len(coin.Sources) > 1 {
-			sourceTags = " (AI500+OI_Top双重信号)"
-		} else if len(coin.Sources) == 1 && coin.Sources[0] == "oi_top" {
-			sourceTags = " (OI_Top持仓增长)"
+		if displayedCount >= layout.candidates {
+			omitted = append(omitted, coin.Symbol)
+			continue
 		}
+		displayedCount++
 
 		// 使用FormatMarketData输出完整市场数据
-		sb.WriteString(fmt.Sprintf("### %d. %s%s\n\n", displayedCount, coin.Symbol, sourceTags))
-		sb.WriteString(market.Format(marketData))
+		sb.WriteString(fmt.Sprintf("### %d. %s%s\n\n", displayedCount, coin.Symbol, candidateSourceTags(coin)))
+		sb.WriteString(market.FormatWithDetail(marketData, layout.series))
 		sb.WriteString("\n")
 	}
+	if len(omitted) > 0 {
+		sb.WriteString(fmt.Sprintf("⚠️ 因prompt长度限制，以下%d个候选币种未提供市场数据，本周期不要对其开仓: %s\n",
+			len(omitted), strings.Join(omitted, ", ")))
+	}
 	sb.WriteString("\n")
 
-	// 夏普比率（直接传值，不要复杂格式化）
-	if ctx.Performance != nil {
-		// 直接从interface{}中提取SharpeRatio
-		type PerformanceData struct {
-			SharpeRatio float64 `json:"sharpe_ratio"`
-		}
-		var perfData PerformanceData
-		if jsonData, err := json.Marshal(ctx.Performance); err == nil {
-			if err := json.Unmarshal(jsonData, &perfData); err == nil {
-				sb.WriteString(fmt.Sprintf("## 📊 夏普比率: %.2f\n\n", perfData.SharpeRatio))
-			}
-		}
-	}
+	writeSharpeRatio(&sb, ctx)
+	writeTradeMemory(&sb, ctx)
 
 	sb.WriteString("---\n\n")
 	sb.WriteString("现在请分析并输出决策（思维链 + JSON）\n")
@@ -461,8 +515,130 @@ func buildUserPrompt(ctx *Context) string {
 	return sb.String()
 }
 
+// writePromptHeader 输出 User Prompt 开头的系统状态、BTC行情、市场状态和账户信息
+func writePromptHeader(sb *strings.Builder, ctx *Context) {
+	// 系统状态
+	sb.WriteString(fmt.Sprintf("时间: %s | 周期: #%d | 运行: %d分钟\n\n",
+		ctx.CurrentTime, ctx.CallCount, ctx.RuntimeMinutes))
+
+	// BTC 市场（Hyperliquid 等交易所使用USDC计价）
+	if btc, hasBTC := btcSymbol(ctx.MarketDataMap); hasBTC {
+		btcData := ctx.MarketDataMap[btc]
+		sb.WriteString(fmt.Sprintf("BTC: %.2f (1h: %+.2f%%, 4h: %+.2f%%) | MACD: %.4f | RSI: %.2f\n\n",
+			btcData.CurrentPrice, btcData.PriceChange1h, btcData.PriceChange4h,
+			btcData.CurrentMACD, btcData.CurrentRSI7))
+	}
+
+	// 市场状态和相关性
+	writeMarketStructure(sb, ctx)
+
+	// 账户
+	sb.WriteString(fmt.Sprintf("账户: 净值%.2f | 余额%.2f (%.1f%%) | 盈亏%+.2f%% | 保证金%.1f%% | 持仓%d个\n\n",
+		ctx.Account.TotalEquity,
+		ctx.Account.AvailableBalance,
+		(ctx.Account.AvailableBalance/ctx.Account.TotalEquity)*100,
+		ctx.Account.TotalPnLPct,
+		ctx.Account.MarginUsedPct,
+		ctx.Account.PositionCount))
+}
+
+// formatPositionLine 格式化单个持仓（序号、方向、价格、盈亏、杠杆和持仓时长）
+func formatPositionLine(i int, pos PositionInfo) string {
+	// 计算持仓时长
+	holdingDuration := ""
+	if pos.UpdateTime > 0 {
+		durationMs := time.Now().UnixMilli() - pos.UpdateTime
+		durationMin := durationMs / (1000 * 60) // 转换为分钟
+		if durationMin < 60 {
+			holdingDuration = fmt.Sprintf(" | 持仓时长%d分钟", durationMin)
+		} else {
+			durationHour := durationMin / 60
+			durationMinRemainder := durationMin % 60
+			holdingDuration = fmt.Sprintf(" | 持仓时长%d小时%d分钟", durationHour, durationMinRemainder)
+		}
+	}
+
+	// 计算仓位价值（用于 partial_close 检查）
+	positionValue := math.Abs(pos.Quantity) * pos.MarkPrice
+
+	return fmt.Sprintf("%d. %s %s | 入场价%.4f 当前价%.4f | 数量%.4f | 仓位价值%.2f USDT | 盈亏%+.2f%% | 盈亏金额%+.2f USDT | 最高收益率%.2f%% | 杠杆%dx | 保证金%.0f | 强平价%.4f%s\n\n",
+		i+1, pos.Symbol, strings.ToUpper(pos.Side),
+		pos.EntryPrice, pos.MarkPrice, pos.Quantity, positionValue, pos.UnrealizedPnLPct, pos.UnrealizedPnL, pos.PeakPnLPct,
+		pos.Leverage, pos.MarginUsed, pos.LiquidationPrice, holdingDuration)
+}
+
+// candidateSourceTags 候选币种的信号来源标记
+func candidateSourceTags(coin CandidateCoin) string {
+	if len(coin.Sources) > 1 {
+		return " (AI500+OI_Top双重信号)"
+	} else if len(coin.Sources) == 1 && coin.Sources[0] == "oi_top" {
+		return " (OI_Top持仓增长)"
+	}
+	return ""
+}
+
+// writeSharpeRatio 输出夏普比率（直接传值，不要复杂格式化）
+func writeSharpeRatio(sb *strings.Builder, ctx *Context) {
+	if ctx.Performance == nil {
+		return
+	}
+	// 直接从interface{}中提取SharpeRatio
+	type PerformanceData struct {
+		SharpeRatio float64 `json:"sharpe_ratio"`
+	}
+	var perfData PerformanceData
+	if jsonData, err := json.Marshal(ctx.Performance); err == nil {
+		if err := json.Unmarshal(jsonData, &perfData); err == nil {
+			sb.WriteString(fmt.Sprintf("## 📊 夏普比率: %.2f\n\n", perfData.SharpeRatio))
+		}
+	}
+}
+
+// parseDecisionResponse 解析AI响应：有结构化输出时按 Schema 解码，否则从文本中提取
+func parseDecisionResponse(resp *mcp.Response, ctx *Context) (*FullDecision, error) {
+	if resp.Structured == "" {
+		return parseFullDecisionResponse(resp.Content, ctx)
+	}
+
+	var out struct {
+		Reasoning string     `json:"reasoning"`
+		Decisions []Decision `json:"decisions"`
+	}
+	cotTrace := strings.TrimSpace(resp.Content)
+	if err := decodeWithSchema(resp.Structured, DecisionResponseSchema().Schema, &out); err != nil {
+		return &FullDecision{
+			CoTTrace:  cotTrace,
+			Decisions: []Decision{},
+		}, err
+	}
+	// 工具调用时文本内容通常就是思维链；json_schema 模式下内容即结构化JSON，思维链在 reasoning 字段中
+	if cotTrace == "" || resp.Content == resp.Structured {
+		cotTrace = strings.TrimSpace(out.Reasoning)
+	}
+
+	if err := validateDecisions(ctx, out.Decisions); err != nil {
+		return &FullDecision{
+			CoTTrace:  cotTrace,
+			Decisions: out.Decisions,
+		}, fmt.Errorf("决策验证失败: %w", err)
+	}
+
+	return &FullDecision{
+		CoTTrace:  cotTrace,
+		Decisions: out.Decisions,
+	}, nil
+}
+
+// rawDecisionReply 返回AI上一次的原始输出（修正请求中作为 assistant 消息）
+func rawDecisionReply(resp *mcp.Response) string {
+	if resp.Structured != "" {
+		return resp.Structured
+	}
+	return resp.Content
+}
+
 // parseFullDecisionResponse 解析AI的完整决策响应
-func parseFullDecisionResponse(aiResponse string, accountEquity float64, btcEthLeverage, altcoinLeverage int) (*FullDecision, error) {
+func parseFullDecisionResponse(aiResponse string, ctx *Context) (*FullDecision, error) {
 	// 1. 提取思维链
 	cotTrace := extractCoTTrace(aiResponse)
 
@@ -476,7 +652,7 @@ func parseFullDecisionResponse(aiResponse string, accountEquity float64, btcEthL
 	}
 
 	// 3. 验证决策
-	if err := validateDecisions(decisions, accountEquity, btcEthLeverage, altcoinLeverage); err != nil {
+	if err := validateDecisions(ctx, decisions); err != nil {
 		return &FullDecision{
 			CoTTrace:  cotTrace,
 			Decisions: decisions,
@@ -547,8 +723,8 @@ func extractDecisions(response string) ([]Decision, error) {
 			return nil, fmt.Errorf("JSON格式验证失败: %w\nJSON内容: %s\n完整响应:\n%s", err, jsonContent, response)
 		}
 		var decisions []Decision
-		if err := json.Unmarshal([]byte(jsonContent), &decisions); err != nil {
-			return nil, fmt.Errorf("JSON解析失败: %w\nJSON内容: %s", err, jsonContent)
+		if err := decodeWithSchema(jsonContent, DecisionArraySchema(), &decisions); err != nil {
+			return nil, fmt.Errorf("%w\nJSON内容: %s", err, jsonContent)
 		}
 		return decisions, nil
 	}
@@ -585,10 +761,10 @@ func extractDecisions(response string) ([]Decision, error) {
 		return nil, fmt.Errorf("JSON格式验证失败: %w\nJSON内容: %s\n完整响应:\n%s", err, jsonContent, response)
 	}
 
-	// 解析JSON
+	// 解析JSON（按 Schema 校验）
 	var decisions []Decision
-	if err := json.Unmarshal([]byte(jsonContent), &decisions); err != nil {
-		return nil, fmt.Errorf("JSON解析失败: %w\nJSON内容: %s", err, jsonContent)
+	if err := decodeWithSchema(jsonContent, DecisionArraySchema(), &decisions); err != nil {
+		return nil, fmt.Errorf("%w\nJSON内容: %s", err, jsonContent)
 	}
 
 	return decisions, nil
@@ -674,10 +850,10 @@ func compactArrayOpen(s string) string {
 	return reArrayOpenSpace.ReplaceAllString(strings.TrimSpace(s), "[{")
 }
 
-// validateDecisions 验证所有决策（需要账户信息和杠杆配置）
-func validateDecisions(decisions []Decision, accountEquity float64, btcEthLeverage, altcoinLeverage int) error {
+// validateDecisions 验证所有决策（使用上下文中的账户信息、杠杆配置和校验规则）
+func validateDecisions(ctx *Context, decisions []Decision) error {
 	for i, decision := range decisions {
-		if err := validateDecision(&decision, accountEquity, btcEthLeverage, altcoinLeverage); err != nil {
+		if err := validateDecision(ctx, &decision); err != nil {
 			return fmt.Errorf("决策 #%d 验证失败: %w", i+1, err)
 		}
 	}
@@ -706,8 +882,8 @@ func findMatchingBracket(s string, start int) int {
 	return -1
 }
 
-// validateDecision 验证单个决策的有效性
-func validateDecision(d *Decision, accountEquity float64, btcEthLeverage, altcoinLeverage int) error {
+// validateDecision 验证单个决策的有效性（开仓决策按交易员的校验规则检查）
+func validateDecision(ctx *Context, d *Decision) error {
 	// 验证action
 	validActions := map[string]bool{
 		"open_long":          true,
@@ -727,13 +903,20 @@ func validateDecision(d *Decision, accountEquity float64, btcEthLeverage, altcoi
 
 	// 开仓操作必须提供完整参数
 	if d.Action == "open_long" || d.Action == "open_short" {
+		// AI没有看到因prompt预算省略的候选币种的市场数据
+		if slices.Contains(ctx.droppedCandidates, d.Symbol) {
+			return fmt.Errorf("%s 因prompt长度限制未提供市场数据，本周期不能开仓", d.Symbol)
+		}
+		rules := ctx.validationRules()
+		accountEquity := ctx.Account.TotalEquity
+		price := ctx.currentPrice(d.Symbol)
+
 		// 根据币种使用配置的杠杆上限
-		maxLeverage := altcoinLeverage          // 山寨币使用配置的杠杆
-		maxPositionValue := accountEquity * 1.5 // 山寨币最多1.5倍账户净值
-		if d.Symbol == "BTCUSDT" || d.Symbol == "ETHUSDT" {
-			maxLeverage = btcEthLeverage          // BTC和ETH使用配置的杠杆
-			maxPositionValue = accountEquity * 10 // BTC/ETH最多10倍账户净值
+		maxLeverage := ctx.AltcoinLeverage // 山寨币使用配置的杠杆
+		if rules.IsMajor(d.Symbol) {
+			maxLeverage = ctx.BTCETHLeverage // 主流币使用 BTC/ETH 的杠杆
 		}
+		maxPositionValue := rules.MaxNotional(d.Symbol, accountEquity)
 
 		// ✅ Fallback 机制：杠杆超限时自动修正为上限值（而不是直接拒绝决策）
 		if d.Leverage <= 0 {
@@ -748,29 +931,19 @@ func validateDecision(d *Decision, accountEquity float64, btcEthLeverage, altcoi
 			return fmt.Errorf("仓位大小必须大于0: %.2f", d.PositionSizeUSD)
 		}
 
-		// ✅ 验证最小开仓金额（防止数量格式化为 0 的错误）
-		// Binance 最小名义价值 10 USDT + 安全边际
-		const minPositionSizeGeneral = 12.0 // 10 + 20% 安全边际
-		const minPositionSizeBTCETH = 60.0  // BTC/ETH 因价格高和精度限制需要更大金额（更灵活）
-
-		if d.Symbol == "BTCUSDT" || d.Symbol == "ETHUSDT" {
-			if d.PositionSizeUSD < minPositionSizeBTCETH {
-				return fmt.Errorf("%s 开仓金额过小(%.2f USDT)，必须≥%.2f USDT（因价格高且精度限制，避免数量四舍五入为0）", d.Symbol, d.PositionSizeUSD, minPositionSizeBTCETH)
-			}
-		} else {
-			if d.PositionSizeUSD < minPositionSizeGeneral {
-				return fmt.Errorf("开仓金额过小(%.2f USDT)，必须≥%.2f USDT（Binance 最小名义价值要求）", d.PositionSizeUSD, minPositionSizeGeneral)
-			}
+		// ✅ 验证最小开仓金额（防止数量格式化为 0 或低于交易所最小名义价值）
+		if minPositionSize, source := rules.minPositionUSD(ctx.Instruments, d.Symbol, price); d.PositionSizeUSD < minPositionSize {
+			return fmt.Errorf("%s 开仓金额过小(%.2f USDT)，必须≥%.2f USDT（%s + %.0f%%安全边际）",
+				d.Symbol, d.PositionSizeUSD, minPositionSize, source, rules.MinNotionalBuffer*100)
 		}
 
 		// 验证仓位价值上限（加1%容差以避免浮点数精度问题）
 		tolerance := maxPositionValue * 0.01 // 1%容差
 		if d.PositionSizeUSD > maxPositionValue+tolerance {
-			if d.Symbol == "BTCUSDT" || d.Symbol == "ETHUSDT" {
-				return fmt.Errorf("BTC/ETH单币种仓位价值不能超过%.0f USDT（10倍账户净值），实际: %.0f", maxPositionValue, d.PositionSizeUSD)
-			} else {
-				return fmt.Errorf("山寨币单币种仓位价值不能超过%.0f USDT（1.5倍账户净值），实际: %.0f", maxPositionValue, d.PositionSizeUSD)
+			if rules.IsMajor(d.Symbol) {
+				return fmt.Errorf("%s 单币种仓位价值不能超过%.0f USDT（%.1f倍账户净值），实际: %.0f", d.Symbol, maxPositionValue, rules.MajorMaxNotional, d.PositionSizeUSD)
 			}
+			return fmt.Errorf("山寨币单币种仓位价值不能超过%.0f USDT（%.1f倍账户净值），实际: %.0f", maxPositionValue, rules.AltcoinMaxNotional, d.PositionSizeUSD)
 		}
 		if d.StopLoss <= 0 || d.TakeProfit <= 0 {
 			return fmt.Errorf("止损和止盈必须大于0")
@@ -787,36 +960,9 @@ func validateDecision(d *Decision, accountEquity float64, btcEthLeverage, altcoi
 			}
 		}
 
-		// 验证风险回报比（必须≥1:3）
-		// 计算入场价（假设当前市价）
-		var entryPrice float64
-		if d.Action == "open_long" {
-			// 做多：入场价在止损和止盈之间
-			entryPrice = d.StopLoss + (d.TakeProfit-d.StopLoss)*0.2 // 假设在20%位置入场
-		} else {
-			// 做空：入场价在止损和止盈之间
-			entryPrice = d.StopLoss - (d.StopLoss-d.TakeProfit)*0.2 // 假设在20%位置入场
-		}
-
-		var riskPercent, rewardPercent, riskRewardRatio float64
-		if d.Action == "open_long" {
-			riskPercent = (entryPrice - d.StopLoss) / entryPrice * 100
-			rewardPercent = (d.TakeProfit - entryPrice) / entryPrice * 100
-			if riskPercent > 0 {
-				riskRewardRatio = rewardPercent / riskPercent
-			}
-		} else {
-			riskPercent = (d.StopLoss - entryPrice) / entryPrice * 100
-			rewardPercent = (entryPrice - d.TakeProfit) / entryPrice * 100
-			if riskPercent > 0 {
-				riskRewardRatio = rewardPercent / riskPercent
-			}
-		}
-
-		// 硬约束：风险回报比必须≥3.0
-		if riskRewardRatio < 3.0 {
-			return fmt.Errorf("风险回报比过低(%.2f:1)，必须≥3.0:1 [风险:%.2f%% 收益:%.2f%%] [止损:%.2f 止盈:%.2f]",
-				riskRewardRatio, riskPercent, rewardPercent, d.StopLoss, d.TakeProfit)
+		// 按当前价验证止损止盈方向和风险回报比
+		if err := checkRiskReward(d, price, rules.MinRiskReward); err != nil {
+			return err
 		}
 	}
 
@@ -0,0 +1,123 @@
+package decision
+
+import (
+	"log"
+	"math"
+	"unicode/utf8"
+
+	"nofx/market"
+	"nofx/mcp"
+)
+
+// promptReserveTokens 为结构化输出的 Schema/工具定义和 Schema 修正提示预留的token
+const promptReserveTokens = 1500
+
+// promptSeriesDetails prompt 超出预算时依次尝试的序列详细程度
+var promptSeriesDetails = []market.SeriesDetail{market.SeriesFull, market.SeriesDownsampled, market.SeriesSummary}
+
+// PromptBudget 本周期 prompt 的token预算，以及为满足预算做的压缩和省略
+type PromptBudget struct {
+	ContextWindow     int      `json:"context_window"`               // 模型上下文窗口（0表示未知，不压缩）
+	MaxOutputTokens   int      `json:"max_output_tokens"`            // AI响应的最大token数（AI_MAX_TOKENS）
+	InputBudget       int      `json:"input_budget"`                 // 可用于 System + User Prompt 的token（0表示不限）
+	EstimatedTokens   int      `json:"estimated_tokens"`             // 最终 System + User Prompt 的估算token数
+	SeriesDetail      string   `json:"series_detail"`                // 序列详细程度：full/downsampled/summary
+	Candidates        int      `json:"candidates"`                   // 提供了市场数据的候选币种数量
+	DroppedCandidates []string `json:"dropped_candidates,omitempty"` // 因超出预算省略的候选币种
+	OverBudget        bool     `json:"over_budget,omitempty"`        // 压缩到最小后仍超出预算
+}
+
+// promptLayout User Prompt 的数据详细程度
+type promptLayout struct {
+	series     market.SeriesDetail // 持仓和候选币种的序列详细程度
+	candidates int                 // 最多输出市场数据的候选币种数量
+}
+
+// estimateTokens 粗略估算文本的token数（偏保守）
+// ASCII 每3个字符约1个token（行情数据以数字为主，比英文单词更费token），中文等其他字符每个约1个token
+func estimateTokens(text string) int {
+	ascii, other := 0, 0
+	for _, r := range text {
+		if r < utf8.RuneSelf {
+			ascii++
+		} else {
+			other++
+		}
+	}
+	return (ascii+2)/3 + other
+}
+
+// promptInputBudget 根据模型上下文窗口计算 prompt 可用的token
+// 需要为AI响应和一次 Schema 修正（重发上次响应并再次生成）各预留 MaxTokens
+func promptInputBudget(client *mcp.Client) (contextWindow, budget int) {
+	contextWindow = client.ContextWindow()
+	return contextWindow, contextWindow - 2*client.MaxTokens - promptReserveTokens
+}
+
+// marketDataCandidates 有市场数据（会在 prompt 中输出）的候选币种，按候选顺序
+func marketDataCandidates(ctx *Context) []string {
+	var symbols []string
+	for _, coin := range ctx.CandidateCoins {
+		if _, ok := ctx.MarketDataMap[coin.Symbol]; ok {
+			symbols = append(symbols, coin.Symbol)
+		}
+	}
+	return symbols
+}
+
+// fitUserPrompt 构建不超过预算的 User Prompt
+// 先逐级压缩序列（完整 → 降采样 → 摘要），仍超出时从候选列表末尾（优先级最低）开始省略候选币种；持仓数据始终保留
+func fitUserPrompt(ctx *Context, systemPrompt string, budget int) (string, *PromptBudget) {
+	systemTokens := estimateTokens(systemPrompt)
+	candidates := marketDataCandidates(ctx)
+	result := &PromptBudget{InputBudget: budget}
+
+	layout := promptLayout{candidates: len(candidates)}
+	var userPrompt string
+	fits := false
+	for _, detail := range promptSeriesDetails {
+		layout.series = detail
+		userPrompt = buildUserPrompt(ctx, layout)
+		if systemTokens+estimateTokens(userPrompt) <= budget {
+			fits = true
+			break
+		}
+	}
+	for !fits && layout.candidates > 0 {
+		layout.candidates--
+		userPrompt = buildUserPrompt(ctx, layout)
+		fits = systemTokens+estimateTokens(userPrompt) <= budget
+	}
+
+	result.EstimatedTokens = systemTokens + estimateTokens(userPrompt)
+	result.SeriesDetail = layout.series.String()
+	result.Candidates = layout.candidates
+	result.DroppedCandidates = candidates[layout.candidates:]
+	result.OverBudget = !fits
+	return userPrompt, result
+}
+
+// buildBudgetedUserPrompt 按AI客户端的上下文窗口和 AI_MAX_TOKENS 构建 User Prompt，并记录压缩情况
+// 模型上下文窗口未知时不压缩（预算记为0）
+func buildBudgetedUserPrompt(ctx *Context, systemPrompt string, client *mcp.Client) (string, *PromptBudget) {
+	contextWindow, budget := promptInputBudget(client)
+	if contextWindow <= 0 {
+		userPrompt, result := fitUserPrompt(ctx, systemPrompt, math.MaxInt)
+		result.InputBudget = 0
+		result.MaxOutputTokens = client.MaxTokens
+		return userPrompt, result
+	}
+	userPrompt, result := fitUserPrompt(ctx, systemPrompt, budget)
+	result.ContextWindow = contextWindow
+	result.MaxOutputTokens = client.MaxTokens
+
+	switch {
+	case result.OverBudget:
+		log.Printf("⚠️  Prompt 压缩后仍超出预算（估算 %d > %d token，上下文窗口 %d），可能被API拒绝或截断",
+			result.EstimatedTokens, budget, contextWindow)
+	case result.SeriesDetail != market.SeriesFull.String() || len(result.DroppedCandidates) > 0:
+		log.Printf("📉 Prompt 超出预算已压缩：序列 %s，省略 %d 个候选币种，估算 %d / %d token",
+			result.SeriesDetail, len(result.DroppedCandidates), result.EstimatedTokens, budget)
+	}
+	return userPrompt, result
+}
@@ -0,0 +1,99 @@
+package decision
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"nofx/market"
+	"nofx/mcp"
+)
+
+// budgetTestContext 构造带持仓和候选币种序列数据的上下文
+func budgetTestContext(candidates int) *Context {
+	series := &market.IntradayData{}
+	for i := 0; i < 10; i++ {
+		v := 100 + float64(i)*1.37
+		series.MidPrices = append(series.MidPrices, v)
+		series.EMA20Values = append(series.EMA20Values, v-0.5)
+		series.MACDValues = append(series.MACDValues, float64(i)*0.013)
+		series.RSI7Values = append(series.RSI7Values, 40+float64(i))
+		series.RSI14Values = append(series.RSI14Values, 45+float64(i))
+		series.Volume = append(series.Volume, 1000+float64(i)*37)
+	}
+	ctx := &Context{
+		Account:       AccountInfo{TotalEquity: 1000, AvailableBalance: 800, PositionCount: 1},
+		Positions:     []PositionInfo{{Symbol: "BTCUSDT", Side: "long", EntryPrice: 100, MarkPrice: 101, Quantity: 1, Leverage: 5}},
+		MarketDataMap: map[string]*market.Data{"BTCUSDT": {Symbol: "BTCUSDT", CurrentPrice: 101, IntradaySeries: series}},
+	}
+	for i := 0; i < candidates; i++ {
+		symbol := fmt.Sprintf("COIN%dUSDT", i)
+		ctx.CandidateCoins = append(ctx.CandidateCoins, CandidateCoin{Symbol: symbol})
+		ctx.MarketDataMap[symbol] = &market.Data{Symbol: symbol, CurrentPrice: 100, IntradaySeries: series}
+	}
+	return ctx
+}
+
+func TestEstimateTokens(t *testing.T) {
+	if got := estimateTokens("123456789"); got != 3 {
+		t.Errorf("ASCII 应按每3个字符1个token估算: %d", got)
+	}
+	if got := estimateTokens("候选币种abc"); got != 5 {
+		t.Errorf("中文每个字符应按1个token估算: %d", got)
+	}
+}
+
+// TestFitUserPrompt 超出预算时先压缩序列，再从末尾省略候选币种，持仓始终保留
+func TestFitUserPrompt(t *testing.T) {
+	ctx := budgetTestContext(5)
+	full := buildUserPrompt(ctx, promptLayout{series: market.SeriesFull, candidates: 5})
+	downsampled := buildUserPrompt(ctx, promptLayout{series: market.SeriesDownsampled, candidates: 5})
+	summary := buildUserPrompt(ctx, promptLayout{series: market.SeriesSummary, candidates: 5})
+
+	prompt, budget := fitUserPrompt(ctx, "", estimateTokens(full))
+	if prompt != full || budget.SeriesDetail != "full" || budget.Candidates != 5 || len(budget.DroppedCandidates) != 0 {
+		t.Errorf("预算充足时应输出完整数据: %+v", budget)
+	}
+
+	_, budget = fitUserPrompt(ctx, "", estimateTokens(downsampled))
+	if budget.SeriesDetail != "downsampled" || budget.Candidates != 5 {
+		t.Errorf("应先降采样序列: %+v", budget)
+	}
+
+	prompt, budget = fitUserPrompt(ctx, "", estimateTokens(summary)-200)
+	if budget.SeriesDetail != "summary" || budget.OverBudget {
+		t.Fatalf("应使用摘要并省略候选币种: %+v", budget)
+	}
+	if budget.Candidates >= 5 || budget.Candidates+len(budget.DroppedCandidates) != 5 || budget.DroppedCandidates[len(budget.DroppedCandidates)-1] != "COIN4USDT" {
+		t.Errorf("应从候选列表末尾省略: %+v", budget)
+	}
+	if budget.EstimatedTokens > budget.InputBudget {
+		t.Errorf("压缩后应在预算内: %+v", budget)
+	}
+	if !strings.Contains(prompt, "## 当前持仓") || !strings.Contains(prompt, "COIN4USDT") || strings.Contains(prompt, "### 5. COIN4USDT") {
+		t.Error("持仓应保留，省略的候选币种只在提示中列出")
+	}
+
+	_, budget = fitUserPrompt(ctx, strings.Repeat("x", 3000), 100)
+	if !budget.OverBudget || budget.Candidates != 0 {
+		t.Errorf("无法满足预算时应省略全部候选币种并标记超出: %+v", budget)
+	}
+}
+
+// TestBuildBudgetedUserPrompt_UnknownContextWindow 测试上下文窗口未知的模型不压缩 prompt
+func TestBuildBudgetedUserPrompt_UnknownContextWindow(t *testing.T) {
+	client := mcp.New()
+	client.SetCustomAPI("http://127.0.0.1", "test-key", "my-local-model")
+	ctx := budgetTestContext(50)
+
+	prompt, budget := buildBudgetedUserPrompt(ctx, "", client)
+	if budget.ContextWindow != 0 || budget.InputBudget != 0 || budget.OverBudget {
+		t.Errorf("未知上下文窗口不应设置预算: %+v", budget)
+	}
+	if budget.SeriesDetail != "full" || budget.Candidates != 50 || len(budget.DroppedCandidates) != 0 {
+		t.Errorf("未知上下文窗口不应压缩: %+v", budget)
+	}
+	if prompt != buildUserPrompt(ctx, promptLayout{series: market.SeriesFull, candidates: 50}) {
+		t.Error("应输出完整数据的 User Prompt")
+	}
+}
@@ -0,0 +1,72 @@
+package decision
+
+import "strings"
+
+// 逐行对比的操作类型
+const (
+	DiffEqual  = " "
+	DiffInsert = "+"
+	DiffDelete = "-"
+)
+
+// PromptDiffLine 提示词版本对比的一行
+type PromptDiffLine struct {
+	Op   string `json:"op"`   // " " 未变 / "+" 新增 / "-" 删除
+	Text string `json:"text"` // 行内容
+}
+
+// DiffPrompts 逐行对比两个提示词版本（基于最长公共子序列）
+func DiffPrompts(from, to string) []PromptDiffLine {
+	a := strings.Split(from, "\n")
+	b := strings.Split(to, "\n")
+
+	// lcs[i][j] = a[i:] 与 b[j:] 的最长公共子序列长度
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	diff := make([]PromptDiffLine, 0, max(len(a), len(b)))
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			diff = append(diff, PromptDiffLine{Op: DiffEqual, Text: a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			diff = append(diff, PromptDiffLine{Op: DiffDelete, Text: a[i]})
+			i++
+		default:
+			diff = append(diff, PromptDiffLine{Op: DiffInsert, Text: b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		diff = append(diff, PromptDiffLine{Op: DiffDelete, Text: a[i]})
+	}
+	for ; j < len(b); j++ {
+		diff = append(diff, PromptDiffLine{Op: DiffInsert, Text: b[j]})
+	}
+	return diff
+}
+
+// FormatPromptDiff 以统一格式（每行前缀 " "/"+"/"-"）输出对比结果
+func FormatPromptDiff(diff []PromptDiffLine) string {
+	var sb strings.Builder
+	for _, line := range diff {
+		sb.WriteString(line.Op)
+		sb.WriteString(line.Text)
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
@@ -1,18 +1,23 @@
 package decision
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
 	"strings"
 	"sync"
+	"text/template"
 )
 
 // PromptTemplate 系统提示词模板
 type PromptTemplate struct {
 	Name    string // 模板名称（文件名，不含扩展名）
-	Content string // 模板内容
+	Content string // 模板内容（text/template 语法，变量见 PromptVariables）
+	Version int    // 版本号（用户模板从1开始，prompts/ 目录的模板为0）
+
+	tmpl *template.Template // 加载时解析的模板
 }
 
 // PromptManager 提示词管理器
@@ -46,6 +51,7 @@ func NewPromptManager() *PromptManager {
 }
 
 // LoadTemplates 从指定目录加载所有提示词模板
+// 模板语法错误的文件不会被加载，错误汇总后返回（其余模板照常加载）
 func (pm *PromptManager) LoadTemplates(dir string) error {
 	pm.mu.Lock()
 	defer pm.mu.Unlock()
@@ -67,6 +73,7 @@ func (pm *PromptManager) LoadTemplates(dir string) error {
 	}
 
 	// 加载每个模板文件
+	var parseErrs []error
 	for _, file := range files {
 		// 读取文件内容
 		content, err := os.ReadFile(file)
@@ -79,16 +86,25 @@ func (pm *PromptManager) LoadTemplates(dir string) error {
 		fileName := filepath.Base(file)
 		templateName := strings.TrimSuffix(fileName, filepath.Ext(fileName))
 
+		// 解析模板语法
+		tmpl, err := parsePromptTemplate(templateName, string(content))
+		if err != nil {
+			log.Printf("⚠️  提示词模板语法错误 %s: %v", file, err)
+			parseErrs = append(parseErrs, fmt.Errorf("提示词模板 %s 语法错误: %w", fileName, err))
+			continue
+		}
+
 		// 存储模板
 		pm.templates[templateName] = &PromptTemplate{
 			Name:    templateName,
 			Content: string(content),
+			tmpl:    tmpl,
 		}
 
 		log.Printf("  📄 加载提示词模板: %s (%s)", templateName, fileName)
 	}
 
-	return nil
+	return errors.Join(parseErrs...)
 }
 
 // GetTemplate 获取指定名称的提示词模板
@@ -96,12 +112,12 @@ func (pm *PromptManager) GetTemplate(name string) (*PromptTemplate, error) {
 	pm.mu.RLock()
 	defer pm.mu.RUnlock()
 
-	template, exists := pm.templates[name]
+	tmpl, exists := pm.templates[name]
 	if !exists {
 		return nil, fmt.Errorf("提示词模板不存在: %s", name)
 	}
 
-	return template, nil
+	return tmpl, nil
 }
 
 // GetAllTemplateNames 获取所有模板名称列表
@@ -123,8 +139,8 @@ func (pm *PromptManager) GetAllTemplates() []*PromptTemplate {
 	defer pm.mu.RUnlock()
 
 	templates := make([]*PromptTemplate, 0, len(pm.templates))
-	for _, template := range pm.templates {
-		templates = append(templates, template)
+	for _, tmpl := range pm.templates {
+		templates = append(templates, tmpl)
 	}
 
 	return templates
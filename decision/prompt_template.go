@@ -0,0 +1,295 @@
+package decision
+
+import (
+	"fmt"
+	"math"
+	"nofx/market"
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+// 系统提示词语言
+const (
+	PromptLanguageZH = "zh"
+	PromptLanguageEN = "en"
+)
+
+const (
+	defaultMaxPositions      = 3    // 最多同时持仓的币种数量
+	defaultMaxMarginUsagePct = 90.0 // 保证金总使用率上限（百分比）
+	defaultMinOpenUSD        = 12.0 // 建议的最小开仓金额（交易所最小名义价值 10 USDT + 安全边际）
+)
+
+// 内置的提示词片段名称，模板中可用 {{template "risk_rules" .}} 自行决定位置，
+// 也可用 {{define "risk_rules"}}...{{end}} 覆盖内容；模板未引用时追加在末尾
+const (
+	riskRulesSection    = "risk_rules"
+	outputFormatSection = "output_format"
+)
+
+// defaultAllowedActions 系统提示词中列出的可选动作
+var defaultAllowedActions = []string{"open_long", "open_short", "close_long", "close_short", "hold", "wait"}
+
+// regimeLabelsEN 市场状态的英文名称
+var regimeLabelsEN = map[string]string{
+	market.RegimeTrendingUp:     "trending up",
+	market.RegimeTrendingDown:   "trending down",
+	market.RegimeRanging:        "ranging",
+	market.RegimeHighVolatility: "high volatility",
+}
+
+// PromptVariables 系统提示词模板可用的变量（模板中以 {{.字段名}} 引用）
+type PromptVariables struct {
+	AccountEquity         float64  // 账户净值
+	BTCETHLeverage        int      // BTC/ETH 最大杠杆
+	AltcoinLeverage       int      // 山寨币最大杠杆
+	AltcoinMinPositionUSD float64  // 山寨币单币仓位下限（净值0.8倍）
+	AltcoinMaxPositionUSD float64  // 山寨币单币仓位上限（净值1.5倍）
+	BTCETHMinPositionUSD  float64  // BTC/ETH 单币仓位下限（净值5倍）
+	BTCETHMaxPositionUSD  float64  // BTC/ETH 单币仓位上限（净值10倍）
+	MaxPositions          int      // 最多持仓币种数
+	MaxMarginUsagePct     float64  // 保证金总使用率上限（百分比）
+	MinOpenUSD            float64  // 建议的最小开仓金额
+	MinRiskReward         float64  // 最低风险回报比（0为不检查）
+	AllowedActions        []string // 可选动作
+	Language              string   // 提示词语言（zh/en）
+	Regime                string   // BTC市场状态（trending_up等，未知时为空）
+	RegimeLabel           string   // 按提示词语言显示的市场状态名称
+}
+
+// NewPromptVariables 按账户净值和杠杆配置生成提示词变量（默认中文，无市场状态）
+func NewPromptVariables(accountEquity float64, btcEthLeverage, altcoinLeverage int) PromptVariables {
+	return PromptVariables{
+		AccountEquity:         accountEquity,
+		BTCETHLeverage:        btcEthLeverage,
+		AltcoinLeverage:       altcoinLeverage,
+		AltcoinMinPositionUSD: accountEquity * 0.8,
+		AltcoinMaxPositionUSD: accountEquity * 1.5,
+		BTCETHMinPositionUSD:  accountEquity * 5,
+		BTCETHMaxPositionUSD:  accountEquity * 10,
+		MaxPositions:          defaultMaxPositions,
+		MaxMarginUsagePct:     defaultMaxMarginUsagePct,
+		MinOpenUSD:            defaultMinOpenUSD,
+		MinRiskReward:         defaultMinRiskReward,
+		AllowedActions:        defaultAllowedActions,
+		Language:              PromptLanguageZH,
+	}
+}
+
+// promptVariablesForContext 从交易上下文生成提示词变量
+func promptVariablesForContext(ctx *Context) PromptVariables {
+	vars := NewPromptVariables(ctx.Account.TotalEquity, ctx.BTCETHLeverage, ctx.AltcoinLeverage)
+	if language, err := ParsePromptLanguage(ctx.PromptLanguage); err == nil {
+		vars.Language = language
+	}
+	if ctx.MarketRegime != nil {
+		vars.Regime = ctx.MarketRegime.Regime
+	}
+	vars.RegimeLabel = vars.regimeLabel()
+	vars.applyValidationRules(ctx.validationRules(), ctx.Account.TotalEquity)
+	return vars
+}
+
+// applyValidationRules 按交易员的校验规则调整仓位上限、最小开仓金额和风险回报比，保证提示词与校验一致
+func (v *PromptVariables) applyValidationRules(rules ValidationRules, accountEquity float64) {
+	v.AltcoinMaxPositionUSD = accountEquity * rules.AltcoinMaxNotional
+	v.BTCETHMaxPositionUSD = accountEquity * rules.MajorMaxNotional
+	v.AltcoinMinPositionUSD = math.Min(v.AltcoinMinPositionUSD, v.AltcoinMaxPositionUSD)
+	v.BTCETHMinPositionUSD = math.Min(v.BTCETHMinPositionUSD, v.BTCETHMaxPositionUSD)
+	v.MinOpenUSD = rules.DefaultMinNotional * (1 + rules.MinNotionalBuffer)
+	v.MinRiskReward = rules.MinRiskReward
+}
+
+// regimeLabel 按提示词语言返回市场状态名称
+func (v PromptVariables) regimeLabel() string {
+	if v.Language == PromptLanguageEN {
+		return regimeLabelsEN[v.Regime]
+	}
+	return regimeLabels[v.Regime]
+}
+
+// ParsePromptLanguage 解析系统提示词语言配置（空字符串为中文）
+func ParsePromptLanguage(raw string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(raw)) {
+	case "", "zh", "zh-cn":
+		return PromptLanguageZH, nil
+	case "en", "en-us":
+		return PromptLanguageEN, nil
+	default:
+		return "", fmt.Errorf("不支持的提示词语言: %s（可选: %s, %s）", raw, PromptLanguageZH, PromptLanguageEN)
+	}
+}
+
+// promptFuncs 模板中可用的辅助函数
+var promptFuncs = template.FuncMap{
+	"join": strings.Join,
+	"mul":  func(a, b float64) float64 { return a * b },
+}
+
+// builtinPromptSections 内置的硬约束和输出格式片段（按 .Language 输出中文或英文）
+const builtinPromptSections = `
+{{- define "risk_rules" -}}
+{{- if eq .Language "en" -}}
+# Hard Constraints (Risk Control)
+
+1. Risk/reward: {{if gt .MinRiskReward 0.0}}must be ≥ 1:{{printf "%g" .MinRiskReward}} (risk 1% to make {{printf "%g" .MinRiskReward}}%+, measured from the current price){{else}}stop loss and take profit must be on the correct side of the current price{{end}}
+2. Max positions: {{.MaxPositions}} symbols (quality over quantity)
+3. Position size: altcoins {{printf "%.0f" .AltcoinMinPositionUSD}}-{{printf "%.0f" .AltcoinMaxPositionUSD}} U | BTC/ETH {{printf "%.0f" .BTCETHMinPositionUSD}}-{{printf "%.0f" .BTCETHMaxPositionUSD}} U
+4. Leverage: **altcoins max {{.AltcoinLeverage}}x** | **BTC/ETH max {{.BTCETHLeverage}}x** (⚠️ strictly enforced, never exceed)
+5. Margin: total usage ≤ {{printf "%.0f" .MaxMarginUsagePct}}%
+6. Order size: recommended **≥{{printf "%.0f" .MinOpenUSD}} USDT** (exchange minimum notional + safety margin; high-priced coins also need at least one minimum order quantity)
+{{- else -}}
+# 硬约束（风险控制）
+
+1. 风险回报比: {{if gt .MinRiskReward 0.0}}必须 ≥ 1:{{printf "%g" .MinRiskReward}}（按当前价计算，冒1%风险，赚{{printf "%g" .MinRiskReward}}%+收益）{{else}}止损止盈必须位于当前价的正确一侧{{end}}
+2. 最多持仓: {{.MaxPositions}}个币种（质量>数量）
+3. 单币仓位: 山寨{{printf "%.0f" .AltcoinMinPositionUSD}}-{{printf "%.0f" .AltcoinMaxPositionUSD}} U | BTC/ETH {{printf "%.0f" .BTCETHMinPositionUSD}}-{{printf "%.0f" .BTCETHMaxPositionUSD}} U
+4. 杠杆限制: **山寨币最大{{.AltcoinLeverage}}x杠杆** | **BTC/ETH最大{{.BTCETHLeverage}}x杠杆** (⚠️ 严格执行，不可超过)
+5. 保证金: 总使用率 ≤ {{printf "%.0f" .MaxMarginUsagePct}}%
+6. 开仓金额: 建议 **≥{{printf "%.0f" .MinOpenUSD}} USDT** (交易所最小名义价值 + 安全边际；高价币还需满足最小下单数量)
+{{- end -}}
+{{- end -}}
+
+{{- define "output_format" -}}
+{{- if eq .Language "en" -}}
+# Output Format (strict)
+
+**You must separate the chain of thought and the decision JSON with the XML tags <reasoning> and <decision> to avoid parsing errors**
+
+## Format
+
+<reasoning>
+Your chain-of-thought analysis...
+- Briefly explain your reasoning
+</reasoning>
+
+<decision>
+` + "```json" + `
+[
+  {"symbol": "BTCUSDT", "action": "open_short", "leverage": {{.BTCETHLeverage}}, "position_size_usd": {{printf "%.0f" .BTCETHMinPositionUSD}}, "stop_loss": 97000, "take_profit": 91000, "confidence": 85, "risk_usd": 300, "reasoning": "Downtrend + MACD bearish cross"},
+  {"symbol": "ETHUSDT", "action": "close_long", "reasoning": "Take profit"}
+]
+` + "```" + `
+</decision>
+
+## Fields
+
+- ` + "`action`" + `: {{join .AllowedActions " | "}}
+- ` + "`confidence`" + `: 0-100 (≥75 recommended for opening)
+- Required when opening: leverage, position_size_usd, stop_loss, take_profit, confidence, risk_usd, reasoning
+{{- else -}}
+# 输出格式 (严格遵守)
+
+**必须使用XML标签 <reasoning> 和 <decision> 标签分隔思维链和决策JSON，避免解析错误**
+
+## 格式要求
+
+<reasoning>
+你的思维链分析...
+- 简洁分析你的思考过程
+</reasoning>
+
+<decision>
+` + "```json" + `
+[
+  {"symbol": "BTCUSDT", "action": "open_short", "leverage": {{.BTCETHLeverage}}, "position_size_usd": {{printf "%.0f" .BTCETHMinPositionUSD}}, "stop_loss": 97000, "take_profit": 91000, "confidence": 85, "risk_usd": 300, "reasoning": "下跌趋势+MACD死叉"},
+  {"symbol": "ETHUSDT", "action": "close_long", "reasoning": "止盈离场"}
+]
+` + "```" + `
+</decision>
+
+## 字段说明
+
+- ` + "`action`" + `: {{join .AllowedActions " | "}}
+- ` + "`confidence`" + `: 0-100（开仓建议≥75）
+- 开仓时必填: leverage, position_size_usd, stop_loss, take_profit, confidence, risk_usd, reasoning
+{{- end -}}
+{{- end -}}`
+
+// builtinPromptTemplate 包含内置片段的基础模板，每个提示词模板在其副本上解析
+var builtinPromptTemplate = template.Must(template.New("builtin").Funcs(promptFuncs).Parse(builtinPromptSections))
+
+// parsePromptTemplate 解析提示词模板（模板语法错误在加载时报告）
+func parsePromptTemplate(name, content string) (*template.Template, error) {
+	base, err := builtinPromptTemplate.Clone()
+	if err != nil {
+		return nil, err
+	}
+	tmpl, err := base.New(name).Parse(content)
+	if err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+// NewPromptTemplate 解析用户保存的提示词模板（语法错误时返回错误）
+func NewPromptTemplate(name string, version int, content string) (*PromptTemplate, error) {
+	tmpl, err := parsePromptTemplate(name, content)
+	if err != nil {
+		return nil, fmt.Errorf("提示词模板 %s 语法错误: %w", name, err)
+	}
+	return &PromptTemplate{Name: name, Content: content, Version: version, tmpl: tmpl}, nil
+}
+
+// Render 用给定变量渲染提示词模板，模板未引用的内置片段依次追加在末尾
+func (t *PromptTemplate) Render(vars PromptVariables) (string, error) {
+	if t.tmpl == nil {
+		return "", fmt.Errorf("提示词模板未解析: %s", t.Name)
+	}
+
+	var sb strings.Builder
+	if err := t.tmpl.Execute(&sb, vars); err != nil {
+		return "", fmt.Errorf("渲染提示词模板 %s 失败: %w", t.Name, err)
+	}
+	sb.WriteString("\n\n")
+
+	for _, section := range []string{riskRulesSection, outputFormatSection} {
+		if invokesTemplate(t.tmpl.Tree.Root, section) {
+			continue
+		}
+		if err := t.tmpl.ExecuteTemplate(&sb, section, vars); err != nil {
+			return "", fmt.Errorf("渲染提示词片段 %s 失败: %w", section, err)
+		}
+		sb.WriteString("\n\n")
+	}
+
+	return sb.String(), nil
+}
+
+// renderBuiltinSections 渲染内置的硬约束和输出格式（模板全部不可用时的兜底）
+func renderBuiltinSections(vars PromptVariables) string {
+	var sb strings.Builder
+	for _, section := range []string{riskRulesSection, outputFormatSection} {
+		if err := builtinPromptTemplate.ExecuteTemplate(&sb, section, vars); err != nil {
+			// 内置片段在包初始化时已解析，执行失败只可能是变量缺失
+			continue
+		}
+		sb.WriteString("\n\n")
+	}
+	return sb.String()
+}
+
+// invokesTemplate 检查语法树中是否引用了指定名称的模板片段
+func invokesTemplate(node parse.Node, name string) bool {
+	switch n := node.(type) {
+	case *parse.TemplateNode:
+		return n.Name == name
+	case *parse.ListNode:
+		if n == nil {
+			return false
+		}
+		for _, child := range n.Nodes {
+			if invokesTemplate(child, name) {
+				return true
+			}
+		}
+	case *parse.IfNode:
+		return invokesTemplate(n.List, name) || invokesTemplate(n.ElseList, name)
+	case *parse.RangeNode:
+		return invokesTemplate(n.List, name) || invokesTemplate(n.ElseList, name)
+	case *parse.WithNode:
+		return invokesTemplate(n.List, name) || invokesTemplate(n.ElseList, name)
+	}
+	return false
+}
@@ -0,0 +1,173 @@
+package decision
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"nofx/market"
+)
+
+func mustParsePromptTemplate(t *testing.T, content string) *PromptTemplate {
+	t.Helper()
+	tmpl, err := parsePromptTemplate("test", content)
+	if err != nil {
+		t.Fatalf("解析模板失败: %v", err)
+	}
+	return &PromptTemplate{Name: "test", Content: content, tmpl: tmpl}
+}
+
+func TestPromptTemplate_RenderVariables(t *testing.T) {
+	vars := NewPromptVariables(1000, 20, 5)
+	vars.Regime = market.RegimeRanging
+	vars.RegimeLabel = vars.regimeLabel()
+
+	pt := mustParsePromptTemplate(t, "净值{{printf \"%.0f\" .AccountEquity}} | 最多{{.MaxPositions}}个 | 状态{{.RegimeLabel}} | {{join .AllowedActions \",\"}}")
+	prompt, err := pt.Render(vars)
+	if err != nil {
+		t.Fatalf("渲染失败: %v", err)
+	}
+
+	for _, want := range []string{
+		"净值1000 | 最多3个 | 状态震荡 | open_long,open_short,close_long,close_short,hold,wait",
+		"# 硬约束（风险控制）",
+		"山寨币最大5x杠杆",
+		"BTC/ETH最大20x杠杆",
+		"单币仓位: 山寨800-1500 U | BTC/ETH 5000-10000 U",
+		"# 输出格式 (严格遵守)",
+		`"leverage": 20, "position_size_usd": 5000`,
+	} {
+		if !strings.Contains(prompt, want) {
+			t.Errorf("渲染结果缺少 %q\n%s", want, prompt)
+		}
+	}
+}
+
+func TestPromptTemplate_RenderSectionPlacement(t *testing.T) {
+	vars := NewPromptVariables(1000, 20, 5)
+
+	t.Run("模板引用的片段不重复追加", func(t *testing.T) {
+		pt := mustParsePromptTemplate(t, "{{template \"output_format\" .}}\n\n策略正文")
+		prompt, err := pt.Render(vars)
+		if err != nil {
+			t.Fatalf("渲染失败: %v", err)
+		}
+		if n := strings.Count(prompt, "# 输出格式"); n != 1 {
+			t.Errorf("输出格式出现 %d 次，期望 1 次", n)
+		}
+		if strings.Index(prompt, "# 输出格式") > strings.Index(prompt, "策略正文") {
+			t.Errorf("输出格式应位于模板指定的位置\n%s", prompt)
+		}
+		if !strings.Contains(prompt, "# 硬约束") {
+			t.Errorf("未引用的硬约束应追加在末尾")
+		}
+	})
+
+	t.Run("模板可覆盖内置片段", func(t *testing.T) {
+		pt := mustParsePromptTemplate(t, "策略正文{{define \"risk_rules\"}}自定义风控: {{.AltcoinLeverage}}x{{end}}")
+		prompt, err := pt.Render(vars)
+		if err != nil {
+			t.Fatalf("渲染失败: %v", err)
+		}
+		if !strings.Contains(prompt, "自定义风控: 5x") || strings.Contains(prompt, "# 硬约束") {
+			t.Errorf("覆盖的片段未生效\n%s", prompt)
+		}
+	})
+
+	t.Run("英文", func(t *testing.T) {
+		vars := vars
+		vars.Language = PromptLanguageEN
+		pt := mustParsePromptTemplate(t, "{{if eq .Language \"en\"}}Strategy{{else}}策略{{end}}")
+		prompt, err := pt.Render(vars)
+		if err != nil {
+			t.Fatalf("渲染失败: %v", err)
+		}
+		for _, want := range []string{"Strategy", "# Hard Constraints (Risk Control)", "# Output Format (strict)"} {
+			if !strings.Contains(prompt, want) {
+				t.Errorf("渲染结果缺少 %q", want)
+			}
+		}
+		if strings.Contains(prompt, "硬约束") {
+			t.Errorf("英文提示词不应包含中文片段")
+		}
+	})
+}
+
+func TestPromptManager_LoadTemplatesRejectsInvalidSyntax(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"good.txt":    "最多{{.MaxPositions}}个",
+		"broken.txt":  "未闭合{{if .Regime}}",
+		"unknown.txt": "{{template \"missing_section\" .}}",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("创建测试文件失败: %v", err)
+		}
+	}
+
+	pm := NewPromptManager()
+	err := pm.LoadTemplates(dir)
+	if err == nil || !strings.Contains(err.Error(), "broken.txt") {
+		t.Fatalf("期望报告 broken.txt 语法错误, got %v", err)
+	}
+	if _, err := pm.GetTemplate("good"); err != nil {
+		t.Errorf("语法正确的模板应正常加载: %v", err)
+	}
+	if _, err := pm.GetTemplate("broken"); err == nil {
+		t.Errorf("语法错误的模板不应被加载")
+	}
+
+	// 引用不存在的片段属于渲染错误，加载时无法发现
+	if unknown, err := pm.GetTemplate("unknown"); err == nil {
+		if _, err := unknown.Render(NewPromptVariables(1000, 20, 5)); err == nil {
+			t.Errorf("引用不存在的片段应渲染失败")
+		}
+	}
+}
+
+func TestParsePromptLanguage(t *testing.T) {
+	tests := map[string]string{"": PromptLanguageZH, "zh-CN": PromptLanguageZH, "EN": PromptLanguageEN}
+	for raw, want := range tests {
+		got, err := ParsePromptLanguage(raw)
+		if err != nil || got != want {
+			t.Errorf("ParsePromptLanguage(%q) = %q, %v; want %q", raw, got, err, want)
+		}
+	}
+	if _, err := ParsePromptLanguage("fr"); err == nil {
+		t.Errorf("不支持的语言应返回错误")
+	}
+}
+
+func TestBuildSystemPromptPrefersUserTemplate(t *testing.T) {
+	userTemplate, err := NewPromptTemplate("default", 3, "用户自己的默认策略")
+	if err != nil {
+		t.Fatalf("解析用户模板失败: %v", err)
+	}
+	userTemplates := map[string]*PromptTemplate{"default": userTemplate}
+
+	prompt, used := buildSystemPrompt(NewPromptVariables(1000, 20, 5), "", userTemplates)
+	if used != userTemplate || !strings.Contains(prompt, "用户自己的默认策略") {
+		t.Errorf("应使用同名的用户模板: %v", used)
+	}
+
+	// 未找到的模板降级到 default 时，记录的也是实际使用的模板
+	_, used = buildSystemPrompt(NewPromptVariables(1000, 20, 5), "missing", userTemplates)
+	if used == nil || used.Name != "default" || used.Version != 3 {
+		t.Errorf("降级后应记录实际使用的模板: %+v", used)
+	}
+
+	if _, err := NewPromptTemplate("broken", 1, "{{if}}"); err == nil {
+		t.Errorf("语法错误的用户模板应返回错误")
+	}
+}
+
+func TestDiffPrompts(t *testing.T) {
+	diff := DiffPrompts("a\nb\nc", "a\nc\nd")
+	got := FormatPromptDiff(diff)
+	want := " a\n-b\n c\n+d\n"
+	if got != want {
+		t.Errorf("DiffPrompts =\n%q\nwant\n%q", got, want)
+	}
+}
@@ -0,0 +1,121 @@
+package decision
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"nofx/market"
+	"slices"
+	"sort"
+	"strings"
+)
+
+const highCorrelationThreshold = 0.8 // 相关系数绝对值不低于该值的币种对在提示词中单独列出
+
+// regimeLabels 市场状态的中文名称
+var regimeLabels = map[string]string{
+	market.RegimeTrendingUp:     "趋势上涨",
+	market.RegimeTrendingDown:   "趋势下跌",
+	market.RegimeRanging:        "震荡",
+	market.RegimeHighVolatility: "高波动",
+}
+
+// ParseRegimeTemplates 解析按市场状态选择系统提示词模板的配置（JSON对象：市场状态 -> 模板名称）
+// 空字符串表示不按市场状态切换模板；模板名称可以是 prompts/ 下的系统模板，也可以是用户保存的模板（userTemplates）
+func ParseRegimeTemplates(raw string, userTemplates []string) (map[string]string, error) {
+	if strings.TrimSpace(raw) == "" {
+		return nil, nil
+	}
+	var mapping map[string]string
+	if err := json.Unmarshal([]byte(raw), &mapping); err != nil {
+		return nil, fmt.Errorf("市场状态模板配置必须是JSON对象: %w", err)
+	}
+	for regime, templateName := range mapping {
+		if _, ok := regimeLabels[regime]; !ok {
+			return nil, fmt.Errorf("未知的市场状态: %s（可选: %s）", regime, strings.Join(market.Regimes, ", "))
+		}
+		if slices.Contains(userTemplates, templateName) {
+			continue
+		}
+		if _, err := GetPromptTemplate(templateName); err != nil {
+			return nil, fmt.Errorf("市场状态 %s 的模板无效: %w", regime, err)
+		}
+	}
+	return mapping, nil
+}
+
+// btcSymbol 上下文中BTC的交易对（USDT或USDC计价）
+func btcSymbol(dataMap map[string]*market.Data) (string, bool) {
+	for _, symbol := range []string{"BTCUSDT", "BTCUSDC"} {
+		if _, ok := dataMap[symbol]; ok {
+			return symbol, true
+		}
+	}
+	return "", false
+}
+
+// selectTemplateForRegime 按BTC所处的市场状态选择系统提示词模板（未配置对应状态时使用原模板）
+func selectTemplateForRegime(ctx *Context, templateName string) string {
+	if ctx.MarketRegime == nil || len(ctx.RegimeTemplates) == 0 {
+		return templateName
+	}
+	if selected, ok := ctx.RegimeTemplates[ctx.MarketRegime.Regime]; ok && selected != "" && selected != templateName {
+		log.Printf("🧭 市场状态: %s，使用提示词模板 %s", regimeLabels[ctx.MarketRegime.Regime], selected)
+		return selected
+	}
+	return templateName
+}
+
+// writeMarketStructure 输出BTC市场状态和币种相关性
+func writeMarketStructure(sb *strings.Builder, ctx *Context) {
+	if r := ctx.MarketRegime; r != nil {
+		sb.WriteString(fmt.Sprintf("市场状态(BTC %s): %s | ADX %.1f | ATR %.2f%% (均值%.2f倍) | EMA20斜率 %+.2f%%\n\n",
+			r.Timeframe, regimeLabels[r.Regime], r.ADX, r.ATRPct, r.VolatilityRatio, r.EMASlopePct))
+	}
+
+	corr := ctx.Correlations
+	if corr == nil {
+		return
+	}
+	btc, hasBTC := btcSymbol(ctx.MarketDataMap)
+
+	var withBTC []string
+	type pair struct {
+		a, b  string
+		value float64
+	}
+	var pairs []pair
+	for i, a := range corr.Symbols {
+		if hasBTC && a != btc {
+			if value, ok := corr.Get(a, btc); ok {
+				withBTC = append(withBTC, fmt.Sprintf("%s %.2f", a, value))
+			}
+		}
+		for _, b := range corr.Symbols[i+1:] {
+			if a == btc || b == btc {
+				continue
+			}
+			if value, ok := corr.Get(a, b); ok && math.Abs(value) >= highCorrelationThreshold {
+				pairs = append(pairs, pair{a, b, value})
+			}
+		}
+	}
+	if len(withBTC) == 0 && len(pairs) == 0 {
+		return
+	}
+
+	sb.WriteString(fmt.Sprintf("## 相关性 (%s收益率)\n", corr.Timeframe))
+	if len(withBTC) > 0 {
+		sb.WriteString(fmt.Sprintf("与BTC: %s\n", strings.Join(withBTC, " | ")))
+	}
+	if len(pairs) > 0 {
+		sort.Slice(pairs, func(i, j int) bool { return math.Abs(pairs[i].value) > math.Abs(pairs[j].value) })
+		items := make([]string, len(pairs))
+		for i, p := range pairs {
+			items[i] = fmt.Sprintf("%s/%s %.2f", p.a, p.b, p.value)
+		}
+		sb.WriteString(fmt.Sprintf("高相关(|ρ|≥%.1f，同向持仓风险叠加): %s\n", highCorrelationThreshold, strings.Join(items, " | ")))
+	}
+	sb.WriteString("\n")
+}
@@ -0,0 +1,86 @@
+package decision
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"nofx/market"
+)
+
+// TestParseRegimeTemplates 测试市场状态模板配置校验
+func TestParseRegimeTemplates(t *testing.T) {
+	originalDir := promptsDir
+	defer func() {
+		promptsDir = originalDir
+		globalPromptManager.ReloadTemplates(originalDir)
+	}()
+	tempDir := t.TempDir()
+	for _, name := range []string{"default", "conservative"} {
+		os.WriteFile(filepath.Join(tempDir, name+".txt"), []byte(name), 0644)
+	}
+	promptsDir = tempDir
+	if err := ReloadPromptTemplates(); err != nil {
+		t.Fatalf("加载模板失败: %v", err)
+	}
+
+	if mapping, err := ParseRegimeTemplates("", nil); err != nil || mapping != nil {
+		t.Errorf("空配置 = %v, %v", mapping, err)
+	}
+	mapping, err := ParseRegimeTemplates(`{"ranging":"conservative","high_volatility":"conservative"}`, nil)
+	if err != nil || mapping[market.RegimeRanging] != "conservative" {
+		t.Errorf("有效配置 = %v, %v", mapping, err)
+	}
+	for _, raw := range []string{`{"sideways":"default"}`, `{"ranging":"missing"}`, `["ranging"]`} {
+		if _, err := ParseRegimeTemplates(raw, []string{"mine"}); err == nil {
+			t.Errorf("%s 应校验失败", raw)
+		}
+	}
+	// 用户保存的模板同样可以按市场状态选用
+	mapping, err = ParseRegimeTemplates(`{"ranging":"mine","trending_up":"default"}`, []string{"mine"})
+	if err != nil || mapping[market.RegimeRanging] != "mine" {
+		t.Errorf("用户模板配置 = %v, %v", mapping, err)
+	}
+}
+
+// TestSelectTemplateForRegime 测试按BTC市场状态切换模板
+func TestSelectTemplateForRegime(t *testing.T) {
+	ctx := &Context{RegimeTemplates: map[string]string{market.RegimeHighVolatility: "conservative"}}
+	if got := selectTemplateForRegime(ctx, "default"); got != "default" {
+		t.Errorf("没有市场状态时应使用原模板, 实际 %s", got)
+	}
+	ctx.MarketRegime = &market.RegimeData{Regime: market.RegimeHighVolatility}
+	if got := selectTemplateForRegime(ctx, "default"); got != "conservative" {
+		t.Errorf("高波动应使用 conservative, 实际 %s", got)
+	}
+	ctx.MarketRegime.Regime = market.RegimeTrendingUp
+	if got := selectTemplateForRegime(ctx, "default"); got != "default" {
+		t.Errorf("未配置的状态应使用原模板, 实际 %s", got)
+	}
+}
+
+// TestWriteMarketStructure 测试提示词中的市场状态和相关性
+func TestWriteMarketStructure(t *testing.T) {
+	ctx := &Context{
+		MarketDataMap: map[string]*market.Data{"BTCUSDT": {}, "ETHUSDT": {}, "SOLUSDT": {}},
+		MarketRegime:  &market.RegimeData{Timeframe: "4h", Regime: market.RegimeTrendingUp, ADX: 31.2, ATRPct: 1.5, VolatilityRatio: 1.1, EMASlopePct: 0.8},
+		Correlations: &market.Correlations{
+			Timeframe: "4h",
+			Symbols:   []string{"BTCUSDT", "ETHUSDT", "SOLUSDT"},
+			Values: [][]float64{
+				{1, 0.9, 0.7},
+				{0.9, 1, 0.85},
+				{0.7, 0.85, 1},
+			},
+		},
+	}
+	var sb strings.Builder
+	writeMarketStructure(&sb, ctx)
+	out := sb.String()
+	for _, want := range []string{"市场状态(BTC 4h): 趋势上涨", "与BTC: ETHUSDT 0.90 | SOLUSDT 0.70", "ETHUSDT/SOLUSDT 0.85"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("输出缺少 %q:\n%s", want, out)
+		}
+	}
+}
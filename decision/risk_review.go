@@ -0,0 +1,314 @@
+package decision
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"nofx/mcp"
+	"strings"
+	"time"
+)
+
+// 风控审核结论
+const (
+	RiskApprove = "approve" // 批准，按原决策执行
+	RiskResize  = "resize"  // 批准但缩小仓位或降低杠杆
+	RiskVeto    = "veto"    // 否决，不执行
+)
+
+// RiskVerdict 风控经理对单条开仓决策的审核结论
+type RiskVerdict struct {
+	Index           int     `json:"index"`                       // 待审核决策的序号
+	Symbol          string  `json:"symbol"`                      // 币种
+	Action          string  `json:"action"`                      // 原决策动作
+	Verdict         string  `json:"verdict"`                     // approve/resize/veto
+	PositionSizeUSD float64 `json:"position_size_usd,omitempty"` // 审核后的仓位价值（veto 时为空）
+	Leverage        int     `json:"leverage,omitempty"`          // 审核后的杠杆（veto 时为空）
+	Reason          string  `json:"reason"`                      // 审核理由
+}
+
+// RiskReview 第二阶段风控审核的完整记录
+type RiskReview struct {
+	SystemPrompt string        `json:"system_prompt"`
+	UserPrompt   string        `json:"user_prompt"`
+	CoTTrace     string        `json:"cot_trace"`   // 风控经理的分析
+	Proposed     []Decision    `json:"proposed"`    // 交易分析师提出的原始决策
+	Verdicts     []RiskVerdict `json:"verdicts"`    // 每条开仓决策的审核结论
+	DurationMs   int64         `json:"duration_ms"` // 风控审核的AI调用耗时（毫秒）
+	Error        string        `json:"error,omitempty"`
+}
+
+// RiskReviewSchema 风控审核结果的 JSON Schema
+func RiskReviewSchema() *mcp.ResponseSchema {
+	return &mcp.ResponseSchema{
+		Name:        "submit_risk_review",
+		Description: "提交对开仓决策的风控审核结果",
+		Schema: map[string]interface{}{
+			"type":     "object",
+			"required": []string{"reasoning", "reviews"},
+			"properties": map[string]interface{}{
+				"reasoning": map[string]interface{}{"type": "string", "description": "风控分析"},
+				"reviews": map[string]interface{}{
+					"type": "array",
+					"items": map[string]interface{}{
+						"type":     "object",
+						"required": []string{"index", "verdict", "reason"},
+						"properties": map[string]interface{}{
+							"index":             map[string]interface{}{"type": "integer", "minimum": 0, "description": "待审核决策的序号"},
+							"verdict":           map[string]interface{}{"type": "string", "enum": []string{RiskApprove, RiskResize, RiskVeto}},
+							"position_size_usd": map[string]interface{}{"type": "number", "exclusiveMinimum": 0, "description": "resize 后的仓位价值（只能调小）"},
+							"leverage":          map[string]interface{}{"type": "integer", "minimum": 1, "description": "resize 后的杠杆（只能调低）"},
+							"reason":            map[string]interface{}{"type": "string", "minLength": 1},
+						},
+						"allOf": []interface{}{
+							map[string]interface{}{
+								"if": map[string]interface{}{
+									"properties": map[string]interface{}{"verdict": map[string]interface{}{"enum": []string{RiskResize}}},
+								},
+								"then": map[string]interface{}{"required": []string{"position_size_usd"}},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// reviewDecisions 第二阶段：风控经理审核开仓决策，返回审核后的决策和审核记录
+// 平仓、调整止盈止损等降低风险的决策不需要审核；审核失败或缺少结论的开仓决策一律否决
+func reviewDecisions(ctx *Context, client *mcp.Client, decisions []Decision) ([]Decision, *RiskReview) {
+	var opening []int
+	for i, d := range decisions {
+		if d.Action == "open_long" || d.Action == "open_short" {
+			opening = append(opening, i)
+		}
+	}
+	if len(opening) == 0 {
+		return decisions, nil
+	}
+
+	review := &RiskReview{
+		SystemPrompt: buildRiskReviewSystemPrompt(ctx),
+		UserPrompt:   buildRiskReviewUserPrompt(ctx, decisions, opening),
+		Proposed:     decisions,
+	}
+	messages := []mcp.Message{
+		{Role: "system", Content: review.SystemPrompt},
+		{Role: "user", Content: review.UserPrompt},
+	}
+
+	start := time.Now()
+	var verdicts []RiskVerdict
+	resp, err := client.CallWithConversation(messages, RiskReviewSchema())
+	if err == nil {
+		review.CoTTrace, verdicts, err = parseRiskReviewResponse(resp)
+		var schemaErr *SchemaError
+		if errors.As(err, &schemaErr) {
+			log.Printf("🔁 风控审核结果不符合Schema，请求AI修正: %v", schemaErr)
+			messages = append(messages,
+				mcp.Message{Role: "assistant", Content: rawDecisionReply(resp)},
+				mcp.Message{Role: "user", Content: buildRepairPrompt(schemaErr)},
+			)
+			if resp, err = client.CallWithConversation(messages, RiskReviewSchema()); err == nil {
+				review.CoTTrace, verdicts, err = parseRiskReviewResponse(resp)
+			}
+		}
+	}
+	review.DurationMs = time.Since(start).Milliseconds()
+
+	missingReason := "风控未给出审核结论"
+	if err != nil {
+		log.Printf("⚠️  风控审核失败，否决全部开仓决策: %v", err)
+		review.Error = err.Error()
+		missingReason = "风控审核失败"
+		verdicts = nil
+	}
+
+	reviewed, applied := applyRiskVerdicts(ctx, decisions, opening, verdicts, missingReason)
+	review.Verdicts = applied
+	return reviewed, review
+}
+
+// parseRiskReviewResponse 解析风控审核结果（结构化输出或文本中的JSON对象）
+func parseRiskReviewResponse(resp *mcp.Response) (string, []RiskVerdict, error) {
+	var out struct {
+		Reasoning string        `json:"reasoning"`
+		Reviews   []RiskVerdict `json:"reviews"`
+	}
+	raw := resp.Structured
+	if raw == "" {
+		raw = extractJSONObject(resp.Content)
+	}
+	if err := decodeWithSchema(raw, RiskReviewSchema().Schema, &out); err != nil {
+		return strings.TrimSpace(resp.Content), nil, err
+	}
+
+	// 工具调用时文本内容通常就是分析；其他情况分析在 reasoning 字段中
+	cotTrace := strings.TrimSpace(resp.Content)
+	if resp.Structured == "" || cotTrace == "" || resp.Content == resp.Structured {
+		cotTrace = strings.TrimSpace(out.Reasoning)
+	}
+	return cotTrace, out.Reviews, nil
+}
+
+// extractJSONObject 从文本中提取第一个 { 到最后一个 } 之间的JSON对象
+func extractJSONObject(s string) string {
+	start := strings.Index(s, "{")
+	end := strings.LastIndex(s, "}")
+	if start < 0 || end < start {
+		return s
+	}
+	return s[start : end+1]
+}
+
+// applyRiskVerdicts 按审核结论处理开仓决策：否决的移除，resize 只能调小仓位和杠杆，调整后仍需通过决策验证
+func applyRiskVerdicts(ctx *Context, decisions []Decision, opening []int, verdicts []RiskVerdict, missingReason string) ([]Decision, []RiskVerdict) {
+	byIndex := make(map[int]RiskVerdict, len(verdicts))
+	for _, v := range verdicts {
+		byIndex[v.Index] = v
+	}
+
+	reviewed := append([]Decision(nil), decisions...)
+	vetoed := make(map[int]bool)
+	applied := make([]RiskVerdict, 0, len(opening))
+	for k, i := range opening {
+		d := reviewed[i]
+		v, ok := byIndex[k]
+		if !ok {
+			v = RiskVerdict{Verdict: RiskVeto, Reason: missingReason}
+		}
+		v.Index, v.Symbol, v.Action = k, d.Symbol, d.Action
+
+		switch v.Verdict {
+		case RiskApprove:
+			v.PositionSizeUSD, v.Leverage = d.PositionSizeUSD, d.Leverage
+		case RiskResize:
+			resized := d
+			if v.PositionSizeUSD > 0 && v.PositionSizeUSD < d.PositionSizeUSD {
+				resized.RiskUSD = d.RiskUSD * v.PositionSizeUSD / d.PositionSizeUSD
+				resized.PositionSizeUSD = v.PositionSizeUSD
+			}
+			if v.Leverage > 0 && v.Leverage < d.Leverage {
+				resized.Leverage = v.Leverage
+			}
+			if err := validateDecision(ctx, &resized); err != nil {
+				v.Verdict = RiskVeto
+				v.Reason = fmt.Sprintf("%s（调整后的决策无效: %v）", v.Reason, err)
+				break
+			}
+			reviewed[i] = resized
+			v.PositionSizeUSD, v.Leverage = resized.PositionSizeUSD, resized.Leverage
+		default:
+			v.Verdict = RiskVeto
+		}
+
+		if v.Verdict == RiskVeto {
+			vetoed[i] = true
+			v.PositionSizeUSD, v.Leverage = 0, 0
+		}
+		log.Printf("🛡️  风控 %s %s: %s (%s)", v.Symbol, v.Action, v.Verdict, v.Reason)
+		applied = append(applied, v)
+	}
+
+	result := make([]Decision, 0, len(reviewed))
+	for i, d := range reviewed {
+		if !vetoed[i] {
+			result = append(result, d)
+		}
+	}
+	return result, applied
+}
+
+// buildRiskReviewSystemPrompt 构建风控经理的 System Prompt（交易员配置的额外风控规则追加在末尾）
+func buildRiskReviewSystemPrompt(ctx *Context) string {
+	var sb strings.Builder
+	language, _ := ParsePromptLanguage(ctx.PromptLanguage)
+	if language == PromptLanguageEN {
+		sb.WriteString("You are the risk manager of a crypto perpetual futures trading desk. The analyst has proposed this cycle's opening decisions; review each of them:\n")
+		sb.WriteString("- approve: execute as proposed\n")
+		sb.WriteString("- resize: approve with a smaller position_size_usd and/or lower leverage (you may only reduce, never increase)\n")
+		sb.WriteString("- veto: do not execute\n\n")
+		sb.WriteString("Focus on margin usage, concentration and correlation with existing positions, risk per trade (stop distance × size), whether the stop-loss/take-profit make sense, and conflicts with existing positions. ")
+		sb.WriteString("Closing and stop adjustment decisions reduce risk and are not reviewed. Every review must include a reason.\n\n")
+		sb.WriteString("Call submit_risk_review with your result. If you cannot call tools, output a single JSON object: ")
+	} else {
+		sb.WriteString("你是加密货币合约交易团队的风控经理。交易分析师已经提出了本周期的开仓决策，请逐条审核：\n")
+		sb.WriteString("- approve：批准，按原决策执行\n")
+		sb.WriteString("- resize：批准但缩小仓位（position_size_usd）或降低杠杆（leverage），只能调小不能调大\n")
+		sb.WriteString("- veto：否决，不执行\n\n")
+		sb.WriteString("审核重点：保证金使用率、与现有持仓的集中度和相关性、单笔风险（止损距离 × 仓位）、止损止盈是否合理、是否与现有持仓冲突。")
+		sb.WriteString("平仓、调整止盈止损等降低风险的决策不需要审核。每条审核都必须给出理由。\n\n")
+		sb.WriteString("调用 submit_risk_review 提交审核结果；无法调用工具时，输出一个JSON对象：")
+	}
+	sb.WriteString(`{"reasoning": "...", "reviews": [{"index": 0, "verdict": "approve|resize|veto", "position_size_usd": 100, "leverage": 3, "reason": "..."}]}`)
+	sb.WriteString("\n")
+
+	if rules := strings.TrimSpace(ctx.RiskReviewPrompt); rules != "" {
+		if language == PromptLanguageEN {
+			sb.WriteString("\n# 📌 Additional Risk Rules\n\n")
+		} else {
+			sb.WriteString("\n# 📌 额外风控规则\n\n")
+		}
+		sb.WriteString(rules)
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// buildRiskReviewUserPrompt 构建风控审核的 User Prompt：账户、持仓、硬约束和待审核的开仓决策
+func buildRiskReviewUserPrompt(ctx *Context, decisions []Decision, opening []int) string {
+	var sb strings.Builder
+	writePromptHeader(&sb, ctx)
+
+	if len(ctx.Positions) > 0 {
+		sb.WriteString("## 当前持仓\n")
+		for i, pos := range ctx.Positions {
+			sb.WriteString(formatPositionLine(i, pos))
+		}
+	} else {
+		sb.WriteString("当前持仓: 无\n\n")
+	}
+
+	rules := ctx.validationRules()
+	sb.WriteString(fmt.Sprintf("## 硬约束\n%s 杠杆上限 %dx，单币仓位上限 %.0f USDT；山寨币杠杆上限 %dx，单币仓位上限 %.0f USDT",
+		strings.Join(rules.MajorCoins, "/"), ctx.BTCETHLeverage, ctx.Account.TotalEquity*rules.MajorMaxNotional,
+		ctx.AltcoinLeverage, ctx.Account.TotalEquity*rules.AltcoinMaxNotional))
+	if rules.MinRiskReward > 0 {
+		sb.WriteString(fmt.Sprintf("；风险回报比 ≥ 1:%g（按当前价计算）", rules.MinRiskReward))
+	}
+	sb.WriteString("\n\n")
+
+	sb.WriteString("## 待审核的开仓决策\n")
+	for k, i := range opening {
+		d := decisions[i]
+		sb.WriteString(fmt.Sprintf("[%d] %s %s | 杠杆 %dx | 仓位 %.2f USDT | 止损 %.4f | 止盈 %.4f | 信心度 %d | 风险 %.2f USDT\n    理由: %s\n",
+			k, d.Symbol, d.Action, d.Leverage, d.PositionSizeUSD, d.StopLoss, d.TakeProfit, d.Confidence, d.RiskUSD, d.Reasoning))
+	}
+
+	// 同周期的其他决策（平仓等）作为参考
+	var others []Decision
+	for i, d := range decisions {
+		if !containsIndex(opening, i) && d.Action != "hold" && d.Action != "wait" {
+			others = append(others, d)
+		}
+	}
+	if len(others) > 0 {
+		othersJSON, _ := json.Marshal(others)
+		sb.WriteString(fmt.Sprintf("\n同周期的其他决策（无需审核）: %s\n", othersJSON))
+	}
+
+	sb.WriteString("\n---\n\n请逐条审核以上开仓决策\n")
+	return sb.String()
+}
+
+// containsIndex 判断序号是否在列表中
+func containsIndex(indexes []int, i int) bool {
+	for _, idx := range indexes {
+		if idx == i {
+			return true
+		}
+	}
+	return false
+}
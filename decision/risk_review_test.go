@@ -0,0 +1,115 @@
+package decision
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"nofx/mcp"
+)
+
+func riskReviewTestContext() *Context {
+	return &Context{
+		Account:         AccountInfo{TotalEquity: 1000, AvailableBalance: 1000},
+		BTCETHLeverage:  10,
+		AltcoinLeverage: 5,
+	}
+}
+
+func riskReviewTestDecisions() []Decision {
+	return []Decision{
+		{Symbol: "BTCUSDT", Action: "open_long", Leverage: 5, PositionSizeUSD: 5000, StopLoss: 90000, TakeProfit: 120000, RiskUSD: 200},
+		{Symbol: "ETHUSDT", Action: "close_short"},
+		{Symbol: "SOLUSDT", Action: "open_short", Leverage: 5, PositionSizeUSD: 1000, StopLoss: 220, TakeProfit: 150},
+		{Symbol: "DOGEUSDT", Action: "open_long", Leverage: 3, PositionSizeUSD: 500, StopLoss: 0.1, TakeProfit: 0.2},
+	}
+}
+
+func TestApplyRiskVerdicts(t *testing.T) {
+	decisions := riskReviewTestDecisions()
+	opening := []int{0, 2, 3}
+	verdicts := []RiskVerdict{
+		{Index: 0, Verdict: RiskResize, PositionSizeUSD: 2500, Leverage: 8, Reason: "仓位过重"},
+		{Index: 1, Verdict: RiskResize, PositionSizeUSD: 5, Reason: "缩到最小"},
+	}
+
+	reviewed, applied := applyRiskVerdicts(riskReviewTestContext(), decisions, opening, verdicts, "风控未给出审核结论")
+
+	if len(reviewed) != 2 || reviewed[0].Symbol != "BTCUSDT" || reviewed[1].Action != "close_short" {
+		t.Fatalf("审核后应保留缩小的BTC和平仓决策: %+v", reviewed)
+	}
+	if reviewed[0].PositionSizeUSD != 2500 || reviewed[0].Leverage != 5 || reviewed[0].RiskUSD != 100 {
+		t.Errorf("resize 只能调小仓位，不能调高杠杆，风险金额按比例缩小: %+v", reviewed[0])
+	}
+	if decisions[0].PositionSizeUSD != 5000 {
+		t.Error("不应修改原始决策")
+	}
+
+	if len(applied) != 3 {
+		t.Fatalf("每条开仓决策都应有审核结论, got %d", len(applied))
+	}
+	if applied[1].Verdict != RiskVeto || !strings.Contains(applied[1].Reason, "调整后的决策无效") {
+		t.Errorf("调整后低于最小开仓金额应否决: %+v", applied[1])
+	}
+	if applied[2].Verdict != RiskVeto || applied[2].Symbol != "DOGEUSDT" || applied[2].Reason != "风控未给出审核结论" {
+		t.Errorf("缺少审核结论应否决: %+v", applied[2])
+	}
+}
+
+func TestReviewDecisions(t *testing.T) {
+	fail := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fail {
+			http.Error(w, "internal", http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte(`{"choices":[{"message":{"content":"BTC 仓位合理","tool_calls":[{"id":"c1","type":"function","function":{"name":"submit_risk_review","arguments":"{\"reasoning\":\"...\",\"reviews\":[{\"index\":0,\"verdict\":\"approve\",\"reason\":\"风险可控\"},{\"index\":1,\"verdict\":\"veto\",\"reason\":\"与BTC高度相关\"},{\"index\":2,\"verdict\":\"approve\",\"reason\":\"ok\"}]}"}}]}}]}`))
+	}))
+	defer server.Close()
+
+	client := mcp.New()
+	client.SetCustomAPI(server.URL, "test-key", "test-model")
+	client.StructuredOutput = mcp.StructuredTools
+	ctx := riskReviewTestContext()
+	ctx.RiskReviewPrompt = "单笔风险不超过净值2%"
+
+	reviewed, review := reviewDecisions(ctx, client, riskReviewTestDecisions())
+	if review == nil || review.Error != "" {
+		t.Fatalf("审核失败: %+v", review)
+	}
+	if len(reviewed) != 3 || reviewed[2].Symbol != "DOGEUSDT" {
+		t.Errorf("SOL 应被否决: %+v", reviewed)
+	}
+	if review.CoTTrace != "BTC 仓位合理" || len(review.Proposed) != 4 {
+		t.Errorf("审核记录不完整: %+v", review)
+	}
+	if !strings.Contains(review.SystemPrompt, "单笔风险不超过净值2%") || !strings.Contains(review.UserPrompt, "[1] SOLUSDT open_short") {
+		t.Errorf("提示词缺少额外规则或待审核决策:\n%s\n%s", review.SystemPrompt, review.UserPrompt)
+	}
+
+	fail = true
+	reviewed, review = reviewDecisions(ctx, client, riskReviewTestDecisions())
+	if review.Error == "" || len(reviewed) != 1 || reviewed[0].Action != "close_short" {
+		t.Errorf("审核失败时应否决全部开仓决策: %+v", reviewed)
+	}
+
+	if reviewed, review := reviewDecisions(ctx, client, []Decision{{Symbol: "BTCUSDT", Action: "wait"}}); review != nil || len(reviewed) != 1 {
+		t.Error("没有开仓决策时不应请求审核")
+	}
+}
+
+func TestBuildRiskReviewSystemPromptLanguage(t *testing.T) {
+	ctx := riskReviewTestContext()
+	ctx.RiskReviewPrompt = "Keep risk per trade under 2% of equity"
+
+	if prompt := buildRiskReviewSystemPrompt(ctx); !strings.Contains(prompt, "# 📌 额外风控规则") {
+		t.Errorf("中文提示词应使用中文的额外规则标题:\n%s", prompt)
+	}
+
+	ctx.PromptLanguage = PromptLanguageEN
+	prompt := buildRiskReviewSystemPrompt(ctx)
+	if !strings.Contains(prompt, "# 📌 Additional Risk Rules") || strings.Contains(prompt, "额外风控规则") {
+		t.Errorf("英文提示词应使用英文的额外规则标题:\n%s", prompt)
+	}
+}
@@ -0,0 +1,275 @@
+package decision
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"nofx/mcp"
+	"sort"
+	"strings"
+)
+
+// decisionActions AI可输出的全部动作
+var decisionActions = []string{
+	"open_long", "open_short", "close_long", "close_short",
+	"update_stop_loss", "update_take_profit", "partial_close", "hold", "wait",
+}
+
+// maxSchemaErrors 修正请求中最多列出的 Schema 错误数
+const maxSchemaErrors = 10
+
+// decisionItemSchema 单条决策的 JSON Schema（动作相关的必填字段用 if/then 表达）
+func decisionItemSchema() map[string]interface{} {
+	number := func(description string) map[string]interface{} {
+		return map[string]interface{}{"type": "number", "exclusiveMinimum": 0, "description": description}
+	}
+	requiredWhen := func(actions []string, fields ...string) map[string]interface{} {
+		return map[string]interface{}{
+			"if": map[string]interface{}{
+				"properties": map[string]interface{}{"action": map[string]interface{}{"enum": actions}},
+			},
+			"then": map[string]interface{}{"required": fields},
+		}
+	}
+
+	return map[string]interface{}{
+		"type":     "object",
+		"required": []string{"symbol", "action"},
+		"properties": map[string]interface{}{
+			"symbol":            map[string]interface{}{"type": "string", "minLength": 1, "description": "交易对，如 BTCUSDT"},
+			"action":            map[string]interface{}{"type": "string", "enum": decisionActions},
+			"leverage":          map[string]interface{}{"type": "integer", "minimum": 1},
+			"position_size_usd": number("仓位价值（USDT）"),
+			"stop_loss":         number("止损价"),
+			"take_profit":       number("止盈价"),
+			"new_stop_loss":     number("新止损价（update_stop_loss）"),
+			"new_take_profit":   number("新止盈价（update_take_profit）"),
+			"close_percentage":  map[string]interface{}{"type": "number", "exclusiveMinimum": 0, "maximum": 100},
+			"confidence":        map[string]interface{}{"type": "integer", "minimum": 0, "maximum": 100},
+			"risk_usd":          map[string]interface{}{"type": "number", "minimum": 0},
+			"reasoning":         map[string]interface{}{"type": "string"},
+		},
+		"allOf": []interface{}{
+			requiredWhen([]string{"open_long", "open_short"}, "leverage", "position_size_usd", "stop_loss", "take_profit"),
+			requiredWhen([]string{"update_stop_loss"}, "new_stop_loss"),
+			requiredWhen([]string{"update_take_profit"}, "new_take_profit"),
+			requiredWhen([]string{"partial_close"}, "close_percentage"),
+		},
+	}
+}
+
+// DecisionArraySchema 决策数组的 JSON Schema
+func DecisionArraySchema() map[string]interface{} {
+	return map[string]interface{}{
+		"type":  "array",
+		"items": decisionItemSchema(),
+	}
+}
+
+// DecisionResponseSchema 结构化输出使用的 Schema：思维链 + 决策数组
+// 工具调用的参数和 response_format 都要求顶层为 object
+func DecisionResponseSchema() *mcp.ResponseSchema {
+	return &mcp.ResponseSchema{
+		Name:        "submit_decisions",
+		Description: "提交本周期的交易决策",
+		Schema: map[string]interface{}{
+			"type":     "object",
+			"required": []string{"reasoning", "decisions"},
+			"properties": map[string]interface{}{
+				"reasoning": map[string]interface{}{"type": "string", "description": "思维链分析"},
+				"decisions": DecisionArraySchema(),
+			},
+		},
+	}
+}
+
+// SchemaError AI输出不符合 JSON Schema（可以把错误发回给AI修正）
+type SchemaError struct {
+	Errors []string
+}
+
+func (e *SchemaError) Error() string {
+	return "决策不符合JSON Schema: " + strings.Join(e.Errors, "; ")
+}
+
+// decodeWithSchema 按 Schema 校验JSON并解码到 out；JSON语法错误和 Schema 错误都返回 *SchemaError
+func decodeWithSchema(raw string, schema map[string]interface{}, out interface{}) error {
+	var value interface{}
+	if err := json.Unmarshal([]byte(raw), &value); err != nil {
+		return &SchemaError{Errors: []string{fmt.Sprintf("不是有效的JSON: %v", err)}}
+	}
+	if errs := validateSchema(value, schema, "$"); len(errs) > 0 {
+		return &SchemaError{Errors: errs}
+	}
+	if err := json.Unmarshal([]byte(raw), out); err != nil {
+		return &SchemaError{Errors: []string{fmt.Sprintf("JSON解析失败: %v", err)}}
+	}
+	return nil
+}
+
+// buildRepairPrompt 生成修正请求：列出具体的 Schema 错误，要求AI只修正格式后重新输出
+func buildRepairPrompt(schemaErr *SchemaError) string {
+	errs := schemaErr.Errors
+	if len(errs) > maxSchemaErrors {
+		errs = append(errs[:maxSchemaErrors:maxSchemaErrors], fmt.Sprintf("……另有 %d 处错误", len(schemaErr.Errors)-maxSchemaErrors))
+	}
+
+	var sb strings.Builder
+	sb.WriteString("你上一次输出的决策JSON不符合要求的Schema，错误如下：\n")
+	for _, e := range errs {
+		sb.WriteString("- ")
+		sb.WriteString(e)
+		sb.WriteString("\n")
+	}
+	sb.WriteString("\n请保持原有的交易判断，只修正以上问题，按要求的格式重新输出完整决策。\n")
+	return sb.String()
+}
+
+// validateSchema 按 JSON Schema 校验值，返回带路径的错误列表
+// 支持决策 Schema 用到的子集：type/enum/required/properties/items/minLength/minimum/maximum/exclusiveMinimum/allOf/if/then
+func validateSchema(value interface{}, schema map[string]interface{}, path string) []string {
+	var errs []string
+
+	if typ, ok := schema["type"].(string); ok && !matchesSchemaType(value, typ) {
+		return []string{fmt.Sprintf("%s: 类型应为 %s，实际为 %s", path, typ, jsonTypeName(value))}
+	}
+
+	if enum, ok := schema["enum"].([]string); ok {
+		str, _ := value.(string)
+		found := false
+		for _, e := range enum {
+			if e == str {
+				found = true
+				break
+			}
+		}
+		if !found {
+			errs = append(errs, fmt.Sprintf("%s: 取值 %v 不在允许范围 [%s] 内", path, value, strings.Join(enum, ", ")))
+		}
+	}
+
+	if minLength, ok := schema["minLength"].(int); ok {
+		if str, _ := value.(string); len(str) < minLength {
+			errs = append(errs, fmt.Sprintf("%s: 长度不能小于 %d", path, minLength))
+		}
+	}
+
+	if num, ok := value.(float64); ok {
+		if minimum, ok := schemaNumber(schema["minimum"]); ok && num < minimum {
+			errs = append(errs, fmt.Sprintf("%s: %v 不能小于 %v", path, num, minimum))
+		}
+		if minimum, ok := schemaNumber(schema["exclusiveMinimum"]); ok && num <= minimum {
+			errs = append(errs, fmt.Sprintf("%s: %v 必须大于 %v", path, num, minimum))
+		}
+		if maximum, ok := schemaNumber(schema["maximum"]); ok && num > maximum {
+			errs = append(errs, fmt.Sprintf("%s: %v 不能大于 %v", path, num, maximum))
+		}
+	}
+
+	if obj, ok := value.(map[string]interface{}); ok {
+		if required, ok := schema["required"].([]string); ok {
+			for _, field := range required {
+				if _, exists := obj[field]; !exists {
+					errs = append(errs, fmt.Sprintf("%s: 缺少必填字段 %s", path, field))
+				}
+			}
+		}
+		if properties, ok := schema["properties"].(map[string]interface{}); ok {
+			// 按字段名排序，保证错误顺序稳定
+			fields := make([]string, 0, len(obj))
+			for field := range obj {
+				fields = append(fields, field)
+			}
+			sort.Strings(fields)
+			for _, field := range fields {
+				if propSchema, ok := properties[field].(map[string]interface{}); ok {
+					errs = append(errs, validateSchema(obj[field], propSchema, path+"."+field)...)
+				}
+			}
+		}
+	}
+
+	if arr, ok := value.([]interface{}); ok {
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for i, item := range arr {
+				errs = append(errs, validateSchema(item, items, fmt.Sprintf("%s[%d]", path, i))...)
+			}
+		}
+	}
+
+	if allOf, ok := schema["allOf"].([]interface{}); ok {
+		for _, sub := range allOf {
+			if subSchema, ok := sub.(map[string]interface{}); ok {
+				errs = append(errs, validateSchema(value, subSchema, path)...)
+			}
+		}
+	}
+
+	if ifSchema, ok := schema["if"].(map[string]interface{}); ok {
+		if len(validateSchema(value, ifSchema, path)) == 0 {
+			if thenSchema, ok := schema["then"].(map[string]interface{}); ok {
+				errs = append(errs, validateSchema(value, thenSchema, path)...)
+			}
+		}
+	}
+
+	return errs
+}
+
+// matchesSchemaType 判断 encoding/json 解码出的值是否符合 Schema 类型
+func matchesSchemaType(value interface{}, typ string) bool {
+	switch typ {
+	case "object":
+		_, ok := value.(map[string]interface{})
+		return ok
+	case "array":
+		_, ok := value.([]interface{})
+		return ok
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	case "integer":
+		num, ok := value.(float64)
+		return ok && num == math.Trunc(num)
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	}
+	return true
+}
+
+// jsonTypeName 返回JSON值的类型名（用于错误信息）
+func jsonTypeName(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case float64:
+		if v == math.Trunc(v) {
+			return "integer"
+		}
+		return "number"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// schemaNumber 读取 Schema 中的数值约束
+func schemaNumber(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
@@ -0,0 +1,120 @@
+package decision
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"nofx/mcp"
+)
+
+func TestValidateDecisionSchema(t *testing.T) {
+	tests := []struct {
+		name     string
+		json     string
+		wantErrs []string // 期望错误信息包含的片段（空表示应通过）
+	}{
+		{
+			name: "合法的开仓和持有",
+			json: `[{"symbol":"BTCUSDT","action":"open_long","leverage":5,"position_size_usd":500,"stop_loss":90000,"take_profit":99000,"confidence":80},
+				{"symbol":"ETHUSDT","action":"hold","reasoning":"趋势未变"}]`,
+		},
+		{
+			name:     "开仓缺少止损止盈",
+			json:     `[{"symbol":"BTCUSDT","action":"open_long","leverage":5,"position_size_usd":500}]`,
+			wantErrs: []string{"$[0]: 缺少必填字段 stop_loss", "$[0]: 缺少必填字段 take_profit"},
+		},
+		{
+			name:     "未知动作",
+			json:     `[{"symbol":"BTCUSDT","action":"buy"}]`,
+			wantErrs: []string{"$[0].action: 取值 buy 不在允许范围"},
+		},
+		{
+			name:     "杠杆类型错误",
+			json:     `[{"symbol":"SOLUSDT","action":"open_short","leverage":"5x","position_size_usd":100,"stop_loss":200,"take_profit":150}]`,
+			wantErrs: []string{"$[0].leverage: 类型应为 integer，实际为 string"},
+		},
+		{
+			name:     "部分平仓比例超出范围",
+			json:     `[{"symbol":"SOLUSDT","action":"partial_close","close_percentage":150}]`,
+			wantErrs: []string{"$[0].close_percentage: 150 不能大于 100"},
+		},
+		{
+			name:     "不是数组",
+			json:     `{"symbol":"BTCUSDT","action":"wait"}`,
+			wantErrs: []string{"$: 类型应为 array，实际为 object"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var decisions []Decision
+			err := decodeWithSchema(tt.json, DecisionArraySchema(), &decisions)
+			if len(tt.wantErrs) == 0 {
+				if err != nil {
+					t.Fatalf("期望通过, got %v", err)
+				}
+				return
+			}
+			var schemaErr *SchemaError
+			if !errors.As(err, &schemaErr) {
+				t.Fatalf("期望 SchemaError, got %v", err)
+			}
+			for _, want := range tt.wantErrs {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("错误信息缺少 %q: %v", want, err)
+				}
+			}
+		})
+	}
+}
+
+func schemaTestContext() *Context {
+	return &Context{Account: AccountInfo{TotalEquity: 1000}, BTCETHLeverage: 10, AltcoinLeverage: 5}
+}
+
+func TestExtractDecisionsReturnsSchemaError(t *testing.T) {
+	response := "<reasoning>分析</reasoning>\n<decision>\n```json\n[{\"symbol\":\"BTCUSDT\",\"action\":\"open_long\",\"leverage\":5}]\n```\n</decision>"
+	_, err := parseFullDecisionResponse(response, schemaTestContext())
+	var schemaErr *SchemaError
+	if !errors.As(err, &schemaErr) {
+		t.Fatalf("文本解析的决策也应按 Schema 校验, got %v", err)
+	}
+
+	prompt := buildRepairPrompt(schemaErr)
+	if !strings.Contains(prompt, "缺少必填字段 position_size_usd") {
+		t.Errorf("修正请求应列出具体错误:\n%s", prompt)
+	}
+}
+
+func TestParseStructuredDecisionResponse(t *testing.T) {
+	structured := `{"reasoning":"BTC 突破","decisions":[{"symbol":"BTCUSDT","action":"open_long","leverage":5,"position_size_usd":5000,"stop_loss":90000,"take_profit":120000}]}`
+
+	t.Run("工具调用", func(t *testing.T) {
+		decision, err := parseDecisionResponse(&mcp.Response{Content: "先看大盘", Structured: structured}, schemaTestContext())
+		if err != nil {
+			t.Fatalf("解析失败: %v", err)
+		}
+		if decision.CoTTrace != "先看大盘" || len(decision.Decisions) != 1 || decision.Decisions[0].Leverage != 5 {
+			t.Errorf("解析结果不正确: %+v", decision)
+		}
+	})
+
+	t.Run("json_schema", func(t *testing.T) {
+		decision, err := parseDecisionResponse(&mcp.Response{Content: structured, Structured: structured}, schemaTestContext())
+		if err != nil {
+			t.Fatalf("解析失败: %v", err)
+		}
+		if decision.CoTTrace != "BTC 突破" {
+			t.Errorf("思维链应取自 reasoning 字段: %q", decision.CoTTrace)
+		}
+	})
+
+	t.Run("缺少决策字段", func(t *testing.T) {
+		_, err := parseDecisionResponse(&mcp.Response{Structured: `{"reasoning":"..."}`}, schemaTestContext())
+		var schemaErr *SchemaError
+		if !errors.As(err, &schemaErr) || !strings.Contains(err.Error(), "缺少必填字段 decisions") {
+			t.Errorf("期望 SchemaError, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,257 @@
+package decision
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"nofx/mcp"
+)
+
+const (
+	// tradeMemorySymbols 交易记忆中最多展示的币种战绩数
+	tradeMemorySymbols = 8
+	// tradeMemoryMistakes 交易记忆中最多展示的近期失误数
+	tradeMemoryMistakes = 5
+	// maxReasonRunes 开仓/平仓理由的最大长度（字符）
+	maxReasonRunes = 60
+	// maxReflectionRunes AI复盘的最大长度（字符）
+	maxReflectionRunes = 800
+
+	// quickLossMinutes 持仓不足该时长即亏损平仓视为入场过早
+	quickLossMinutes = 30
+	// bigLossPct 单笔亏损超过保证金的该百分比视为仓位或杠杆过大
+	bigLossPct = 20
+)
+
+// memoryTrade 已平仓交易（logger.TradeOutcome 中交易记忆需要的字段）
+type memoryTrade struct {
+	Symbol      string  `json:"symbol"`
+	Side        string  `json:"side"`
+	Leverage    int     `json:"leverage"`
+	PnL         float64 `json:"pn_l"`
+	PnLPct      float64 `json:"pn_l_pct"`
+	Duration    string  `json:"duration"`
+	WasStopLoss bool    `json:"was_stop_loss"`
+	EntryReason string  `json:"entry_reason"`
+	CloseReason string  `json:"close_reason"`
+}
+
+// memorySymbol 币种战绩（logger.SymbolPerformance）
+type memorySymbol struct {
+	Symbol      string  `json:"symbol"`
+	TotalTrades int     `json:"total_trades"`
+	WinRate     float64 `json:"win_rate"`
+	TotalPnL    float64 `json:"total_pn_l"`
+	AvgPnL      float64 `json:"avg_pn_l"`
+}
+
+// tradeMemory 从历史表现中提炼的交易记忆
+type tradeMemory struct {
+	Trades   []memoryTrade  // 最近的已平仓交易（最新的在前）
+	Symbols  []memorySymbol // 币种战绩（按交易次数排序）
+	Mistakes []string       // 近期失误
+}
+
+// buildTradeMemory 从 ctx.Performance 构建交易记忆（没有已平仓交易时返回 nil）
+func buildTradeMemory(performance interface{}) *tradeMemory {
+	if performance == nil {
+		return nil
+	}
+	// 与夏普比率相同，通过JSON从 interface{} 中提取需要的字段
+	var perf struct {
+		RecentTrades []memoryTrade           `json:"recent_trades"`
+		SymbolStats  map[string]memorySymbol `json:"symbol_stats"`
+	}
+	jsonData, err := json.Marshal(performance)
+	if err != nil || json.Unmarshal(jsonData, &perf) != nil || len(perf.RecentTrades) == 0 {
+		return nil
+	}
+
+	memory := &tradeMemory{Trades: perf.RecentTrades}
+	for symbol, stats := range perf.SymbolStats {
+		stats.Symbol = symbol
+		memory.Symbols = append(memory.Symbols, stats)
+	}
+	sort.Slice(memory.Symbols, func(i, j int) bool {
+		if memory.Symbols[i].TotalTrades != memory.Symbols[j].TotalTrades {
+			return memory.Symbols[i].TotalTrades > memory.Symbols[j].TotalTrades
+		}
+		return memory.Symbols[i].Symbol < memory.Symbols[j].Symbol
+	})
+	if len(memory.Symbols) > tradeMemorySymbols {
+		memory.Symbols = memory.Symbols[:tradeMemorySymbols]
+	}
+	memory.Mistakes = findMistakes(memory.Trades)
+	return memory
+}
+
+// findMistakes 找出近期失误：止损离场、单笔大亏、入场过早，以及同一币种连续亏损
+func findMistakes(trades []memoryTrade) []string {
+	var mistakes []string
+	add := func(format string, args ...interface{}) {
+		if len(mistakes) < tradeMemoryMistakes {
+			mistakes = append(mistakes, fmt.Sprintf(format, args...))
+		}
+	}
+
+	// 同一币种从最新一笔开始的连续亏损次数
+	streaks := make(map[string]int)
+	ended := make(map[string]bool)
+	for _, t := range trades {
+		if ended[t.Symbol] {
+			continue
+		}
+		if t.PnL < 0 {
+			streaks[t.Symbol]++
+		} else {
+			ended[t.Symbol] = true
+		}
+	}
+	reported := make(map[string]bool)
+
+	for _, t := range trades {
+		if t.PnL >= 0 {
+			continue
+		}
+		label := fmt.Sprintf("%s %s", t.Symbol, strings.ToUpper(t.Side))
+		holding, _ := time.ParseDuration(t.Duration)
+		switch {
+		case t.WasStopLoss:
+			add("%s 止损离场 %+.2f%%，入场理由: %s", label, t.PnLPct, truncateRunes(t.EntryReason, maxReasonRunes))
+		case t.PnLPct <= -bigLossPct:
+			add("%s 单笔亏损 %+.2f%%（超过保证金的%d%%），仓位或杠杆(%dx)过大", label, t.PnLPct, bigLossPct, t.Leverage)
+		case holding > 0 && holding < quickLossMinutes*time.Minute:
+			add("%s 持仓仅%s即亏损平仓 %+.2f%%，入场时机可能过早", label, formatHolding(holding), t.PnLPct)
+		}
+		if n := streaks[t.Symbol]; n >= 2 && !reported[t.Symbol] {
+			reported[t.Symbol] = true
+			add("%s 最近连续%d笔亏损，避免反复交易同一币种", t.Symbol, n)
+		}
+	}
+	return mistakes
+}
+
+// writeTradeMemory 输出交易记忆：最近交易、币种战绩、近期失误和AI复盘（未启用交易记忆时不输出）
+func writeTradeMemory(sb *strings.Builder, ctx *Context) {
+	if !ctx.TradeMemory {
+		return
+	}
+	memory := buildTradeMemory(ctx.Performance)
+	reflection := strings.TrimSpace(ctx.Reflection)
+	if memory == nil && reflection == "" {
+		return
+	}
+
+	sb.WriteString("## 🧠 交易记忆\n\n")
+	if memory != nil {
+		memory.write(sb)
+	}
+	if reflection != "" {
+		sb.WriteString("### AI复盘\n")
+		sb.WriteString(limitRunes(reflection, maxReflectionRunes))
+		sb.WriteString("\n\n")
+	}
+}
+
+// write 输出最近交易、币种战绩和近期失误
+func (m *tradeMemory) write(sb *strings.Builder) {
+	sb.WriteString(fmt.Sprintf("### 最近%d笔交易（最新在前）\n", len(m.Trades)))
+	for i, t := range m.Trades {
+		holding, _ := time.ParseDuration(t.Duration)
+		exit := "主动平仓"
+		if t.WasStopLoss {
+			exit = "止损离场"
+		}
+		sb.WriteString(fmt.Sprintf("%d. %s %s %dx | 盈亏%+.2f USDT (%+.2f%%) | 持仓%s | %s\n",
+			i+1, t.Symbol, strings.ToUpper(t.Side), t.Leverage, t.PnL, t.PnLPct, formatHolding(holding), exit))
+		if t.EntryReason != "" {
+			sb.WriteString(fmt.Sprintf("   入场理由: %s\n", truncateRunes(t.EntryReason, maxReasonRunes)))
+		}
+		if t.CloseReason != "" {
+			sb.WriteString(fmt.Sprintf("   平仓理由: %s\n", truncateRunes(t.CloseReason, maxReasonRunes)))
+		}
+	}
+	sb.WriteString("\n")
+
+	if len(m.Symbols) > 0 {
+		sb.WriteString("### 币种战绩\n")
+		for _, s := range m.Symbols {
+			sb.WriteString(fmt.Sprintf("%s: %d笔 | 胜率%.0f%% | 累计%+.2f USDT | 平均%+.2f USDT\n",
+				s.Symbol, s.TotalTrades, s.WinRate, s.TotalPnL, s.AvgPnL))
+		}
+		sb.WriteString("\n")
+	}
+
+	if len(m.Mistakes) > 0 {
+		sb.WriteString("### 近期失误\n")
+		for _, mistake := range m.Mistakes {
+			sb.WriteString("- " + mistake + "\n")
+		}
+		sb.WriteString("\n")
+	}
+}
+
+// formatHolding 格式化持仓时长
+func formatHolding(d time.Duration) string {
+	minutes := int(d.Minutes())
+	if minutes < 60 {
+		return fmt.Sprintf("%d分钟", minutes)
+	}
+	return fmt.Sprintf("%d小时%d分钟", minutes/60, minutes%60)
+}
+
+// truncateRunes 合并为单行并按字符截断
+func truncateRunes(s string, n int) string {
+	return limitRunes(strings.Join(strings.Fields(s), " "), n)
+}
+
+// limitRunes 按字符截断文本，超长时以省略号结尾
+func limitRunes(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n]) + "…"
+}
+
+// GenerateReflection 让AI复盘最近的已平仓交易，总结做对的地方、反复出现的错误和后续规则
+// 上一次复盘（ctx.Reflection）一并提供，便于AI在此基础上修正
+func GenerateReflection(ctx *Context, client *mcp.Client) (string, error) {
+	memory := buildTradeMemory(ctx.Performance)
+	if memory == nil {
+		return "", fmt.Errorf("没有已平仓交易，无法复盘")
+	}
+
+	var systemPrompt string
+	if language, _ := ParsePromptLanguage(ctx.PromptLanguage); language == PromptLanguageEN {
+		systemPrompt = "You are the trading coach of a crypto perpetual futures trader. Review the trader's recent closed trades and summarize: " +
+			"1) what worked, 2) recurring mistakes (with the symbols and setups involved), 3) 3-5 concrete rules to follow in the next cycles. " +
+			"Keep it under 200 words and output only the review."
+	} else {
+		systemPrompt = "你是加密货币合约交易员的复盘教练。请根据交易员最近的已平仓交易总结：" +
+			"1) 做对了什么；2) 反复出现的错误（指出涉及的币种和入场形态）；3) 接下来几个周期应遵守的3-5条具体规则。" +
+			"不超过300字，只输出复盘内容。"
+	}
+
+	var sb strings.Builder
+	memory.write(&sb)
+	if previous := strings.TrimSpace(ctx.Reflection); previous != "" {
+		sb.WriteString("### 上一次复盘\n")
+		sb.WriteString(previous)
+		sb.WriteString("\n\n")
+	}
+	sb.WriteString("---\n\n请复盘以上交易\n")
+
+	reflection, err := client.CallWithMessages(systemPrompt, sb.String())
+	if err != nil {
+		return "", fmt.Errorf("调用AI复盘失败: %w", err)
+	}
+	reflection = strings.TrimSpace(reflection)
+	if reflection == "" {
+		return "", fmt.Errorf("AI复盘内容为空")
+	}
+	return limitRunes(reflection, maxReflectionRunes), nil
+}
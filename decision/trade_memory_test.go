@@ -0,0 +1,121 @@
+package decision
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"nofx/mcp"
+)
+
+func tradeMemoryTestPerformance() map[string]interface{} {
+	return map[string]interface{}{
+		"sharpe_ratio": 0.5,
+		"recent_trades": []map[string]interface{}{
+			{"symbol": "SOLUSDT", "side": "long", "leverage": 5, "pn_l": -12, "pn_l_pct": -8, "duration": "2h5m0s",
+				"was_stop_loss": true, "entry_reason": "突破前高，\n放量上涨", "close_reason": "止损触发 @140.0000"},
+			{"symbol": "SOLUSDT", "side": "long", "leverage": 5, "pn_l": -3, "pn_l_pct": -2, "duration": "12m0s",
+				"entry_reason": "RSI超卖反弹"},
+			{"symbol": "BTCUSDT", "side": "short", "leverage": 10, "pn_l": -50, "pn_l_pct": -25, "duration": "1h0m0s"},
+			{"symbol": "ETHUSDT", "side": "long", "leverage": 3, "pn_l": 20, "pn_l_pct": 6, "duration": "45m0s",
+				"entry_reason": strings.Repeat("趋势", 50)},
+		},
+		"symbol_stats": map[string]interface{}{
+			"SOLUSDT": map[string]interface{}{"total_trades": 2, "win_rate": 0, "total_pn_l": -15, "avg_pn_l": -7.5},
+			"BTCUSDT": map[string]interface{}{"total_trades": 1, "win_rate": 0, "total_pn_l": -50, "avg_pn_l": -50},
+			"ETHUSDT": map[string]interface{}{"total_trades": 1, "win_rate": 100, "total_pn_l": 20, "avg_pn_l": 20},
+		},
+	}
+}
+
+func TestBuildTradeMemory(t *testing.T) {
+	memory := buildTradeMemory(tradeMemoryTestPerformance())
+	if memory == nil || len(memory.Trades) != 4 {
+		t.Fatalf("应包含4笔交易: %+v", memory)
+	}
+	if memory.Symbols[0].Symbol != "SOLUSDT" || memory.Symbols[1].Symbol != "BTCUSDT" {
+		t.Errorf("币种战绩应按交易次数、币种排序: %+v", memory.Symbols)
+	}
+
+	want := []string{
+		"SOLUSDT LONG 止损离场 -8.00%，入场理由: 突破前高， 放量上涨",
+		"SOLUSDT 最近连续2笔亏损",
+		"SOLUSDT LONG 持仓仅12分钟即亏损平仓",
+		"BTCUSDT SHORT 单笔亏损 -25.00%",
+	}
+	if len(memory.Mistakes) != len(want) {
+		t.Fatalf("近期失误数量不对: %v", memory.Mistakes)
+	}
+	for i, w := range want {
+		if !strings.HasPrefix(memory.Mistakes[i], w) {
+			t.Errorf("失误[%d] = %q, 期望以 %q 开头", i, memory.Mistakes[i], w)
+		}
+	}
+
+	if buildTradeMemory(map[string]interface{}{"recent_trades": []interface{}{}}) != nil || buildTradeMemory(nil) != nil {
+		t.Error("没有已平仓交易时不应构建交易记忆")
+	}
+}
+
+func TestWriteTradeMemory(t *testing.T) {
+	ctx := &Context{Performance: tradeMemoryTestPerformance(), Reflection: "少追高\n严格止损"}
+
+	var sb strings.Builder
+	writeTradeMemory(&sb, ctx)
+	if sb.Len() != 0 {
+		t.Error("未启用交易记忆时不应输出")
+	}
+
+	ctx.TradeMemory = true
+	writeTradeMemory(&sb, ctx)
+	out := sb.String()
+	for _, want := range []string{
+		"## 🧠 交易记忆",
+		"1. SOLUSDT LONG 5x | 盈亏-12.00 USDT (-8.00%) | 持仓2小时5分钟 | 止损离场",
+		"平仓理由: 止损触发 @140.0000",
+		"ETHUSDT: 1笔 | 胜率100% | 累计+20.00 USDT",
+		"### 近期失误",
+		"### AI复盘\n少追高\n严格止损",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("交易记忆缺少 %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, strings.Repeat("趋势", 31)) {
+		t.Errorf("入场理由应截断:\n%s", out)
+	}
+}
+
+func TestGenerateReflection(t *testing.T) {
+	var userPrompt string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Messages []mcp.Message `json:"messages"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		userPrompt = req.Messages[len(req.Messages)-1].Content
+		w.Write([]byte(`{"choices":[{"message":{"content":"  SOL 连续止损，暂停追涨  "}}]}`))
+	}))
+	defer server.Close()
+
+	client := mcp.New()
+	client.SetCustomAPI(server.URL, "test-key", "test-model")
+	ctx := &Context{Performance: tradeMemoryTestPerformance(), Reflection: "上次: 控制杠杆"}
+
+	reflection, err := GenerateReflection(ctx, client)
+	if err != nil {
+		t.Fatalf("复盘失败: %v", err)
+	}
+	if reflection != "SOL 连续止损，暂停追涨" {
+		t.Errorf("复盘内容 = %q", reflection)
+	}
+	if !strings.Contains(userPrompt, "### 近期失误") || !strings.Contains(userPrompt, "### 上一次复盘\n上次: 控制杠杆") {
+		t.Errorf("复盘输入缺少交易记忆或上一次复盘:\n%s", userPrompt)
+	}
+
+	if _, err := GenerateReflection(&Context{}, client); err == nil {
+		t.Error("没有已平仓交易时应返回错误")
+	}
+}
@@ -1,7 +1,10 @@
 package decision
 
 import (
+	"strings"
 	"testing"
+
+	"nofx/market"
 )
 
 // TestLeverageFallback 测试杠杆超限时的自动修正功能
@@ -83,7 +86,12 @@ func TestLeverageFallback(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := validateDecision(&tt.decision, tt.accountEquity, tt.btcEthLeverage, tt.altcoinLeverage)
+			ctx := &Context{
+				Account:         AccountInfo{TotalEquity: tt.accountEquity},
+				BTCETHLeverage:  tt.btcEthLeverage,
+				AltcoinLeverage: tt.altcoinLeverage,
+			}
+			err := validateDecision(ctx, &tt.decision)
 
 			// 检查错误状态
 			if (err != nil) != tt.wantError {
@@ -98,3 +106,122 @@ func TestLeverageFallback(t *testing.T) {
 		})
 	}
 }
+
+// TestParseValidationRules 测试校验规则的解析：未配置的字段使用默认值，非法配置报错
+func TestParseValidationRules(t *testing.T) {
+	rules, err := ParseValidationRules("")
+	if err != nil || rules.MinRiskReward != defaultMinRiskReward || !rules.IsMajor("ETHUSDC") {
+		t.Fatalf("空配置应使用默认规则: %+v, %v", rules, err)
+	}
+
+	rules, err = ParseValidationRules(`{"min_risk_reward": 2, "major_coins": ["btc", "SOLUSDT"]}`)
+	if err != nil {
+		t.Fatalf("解析失败: %v", err)
+	}
+	if rules.MinRiskReward != 2 || rules.AltcoinMaxNotional != defaultAltcoinMaxNotional {
+		t.Errorf("未配置的字段应保留默认值: %+v", rules)
+	}
+	if !rules.IsMajor("SOLUSDT") || rules.IsMajor("ETHUSDT") {
+		t.Errorf("主流币应按配置识别: %v", rules.MajorCoins)
+	}
+	if rules.MaxNotional("BTCUSDT", 100) != 1000 || rules.MaxNotional("ETHUSDT", 100) != 150 {
+		t.Errorf("仓位上限计算错误")
+	}
+
+	for _, raw := range []string{
+		`[1, 2]`,
+		`{"min_rr": 2}`,
+		`{"min_risk_reward": -1}`,
+		`{"altcoin_max_notional": 0}`,
+		`{"major_coins": ["BTC!"]}`,
+	} {
+		if _, err := ParseValidationRules(raw); err == nil {
+			t.Errorf("%s 应该报错", raw)
+		}
+	}
+}
+
+// TestValidateDecisionRules 测试按当前价计算风险回报比、交易所最小名义价值和自定义规则
+func TestValidateDecisionRules(t *testing.T) {
+	instruments := market.NewInstrumentSet("binance", []market.Instrument{
+		{Base: "BTC", Quote: "USDT", Exchange: "binance", NativeSymbol: "BTCUSDT", MinNotional: 100, MinQty: 0.001},
+		{Base: "SOL", Quote: "USDT", Exchange: "binance", NativeSymbol: "SOLUSDT", MinNotional: 5, MinQty: 0.01},
+	})
+	newCtx := func(rules *ValidationRules) *Context {
+		return &Context{
+			Account:         AccountInfo{TotalEquity: 1000},
+			BTCETHLeverage:  10,
+			AltcoinLeverage: 5,
+			MarketDataMap: map[string]*market.Data{
+				"BTCUSDT": {Symbol: "BTCUSDT", CurrentPrice: 100000},
+				"SOLUSDT": {Symbol: "SOLUSDT", CurrentPrice: 150},
+			},
+			ValidationRules: rules,
+			Instruments:     instruments,
+		}
+	}
+	custom, _ := ParseValidationRules(`{"min_risk_reward": 1.5, "altcoin_max_notional": 3}`)
+
+	tests := []struct {
+		name     string
+		rules    *ValidationRules
+		decision Decision
+		wantErr  string
+	}{
+		{
+			name:     "按当前价风险回报比达标",
+			decision: Decision{Symbol: "SOLUSDT", Action: "open_long", Leverage: 3, PositionSizeUSD: 500, StopLoss: 145, TakeProfit: 165},
+		},
+		{
+			// 假设入场价在20%处时为 4:1，但按当前价只有 1:1
+			name:     "按当前价风险回报比不足",
+			decision: Decision{Symbol: "SOLUSDT", Action: "open_long", Leverage: 3, PositionSizeUSD: 500, StopLoss: 140, TakeProfit: 160},
+			wantErr:  "风险回报比过低",
+		},
+		{
+			name:     "自定义风险回报比",
+			rules:    &custom,
+			decision: Decision{Symbol: "SOLUSDT", Action: "open_long", Leverage: 3, PositionSizeUSD: 2500, StopLoss: 140, TakeProfit: 165},
+		},
+		{
+			name:     "止损在当前价错误一侧",
+			decision: Decision{Symbol: "SOLUSDT", Action: "open_short", Leverage: 3, PositionSizeUSD: 500, StopLoss: 149, TakeProfit: 100},
+			wantErr:  "做空时止损价",
+		},
+		{
+			name:     "低于交易所最小名义价值",
+			decision: Decision{Symbol: "BTCUSDT", Action: "open_long", Leverage: 5, PositionSizeUSD: 110, StopLoss: 98000, TakeProfit: 110000},
+			wantErr:  "交易所最小名义价值",
+		},
+		{
+			name:     "超过山寨币仓位上限",
+			decision: Decision{Symbol: "SOLUSDT", Action: "open_long", Leverage: 3, PositionSizeUSD: 2500, StopLoss: 145, TakeProfit: 165},
+			wantErr:  "1.5倍账户净值",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateDecision(newCtx(tt.rules), &tt.decision)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("不应报错: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("期望错误包含 %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+	// 因prompt预算省略的候选币种不能开仓，平仓不受影响
+	ctx := newCtx(nil)
+	ctx.droppedCandidates = []string{"SOLUSDT"}
+	open := Decision{Symbol: "SOLUSDT", Action: "open_long", Leverage: 3, PositionSizeUSD: 500, StopLoss: 145, TakeProfit: 165}
+	if err := validateDecision(ctx, &open); err == nil || !strings.Contains(err.Error(), "未提供市场数据") {
+		t.Errorf("省略的候选币种开仓应被拒绝, got %v", err)
+	}
+	if err := validateDecision(ctx, &Decision{Symbol: "SOLUSDT", Action: "close_long"}); err != nil {
+		t.Errorf("省略的候选币种平仓不应报错: %v", err)
+	}
+}
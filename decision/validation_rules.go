@@ -0,0 +1,174 @@
+package decision
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"nofx/market"
+)
+
+// 默认校验规则（与系统提示词硬约束一致）
+const (
+	defaultMinRiskReward      = 3.0  // 风险回报比 ≥ 1:3
+	defaultMajorMaxNotional   = 10.0 // BTC/ETH 单币仓位上限为净值10倍
+	defaultAltcoinMaxNotional = 1.5  // 山寨币单币仓位上限为净值1.5倍
+	defaultMinNotionalBuffer  = 0.2  // 最小开仓金额在交易所最小名义价值上加20%安全边际
+	defaultMinNotional        = 10.0 // 无法获取交易所规则时使用的最小名义价值（USDT）
+
+	// assumedEntryRatio 没有当前价格时，假设入场价位于止损到止盈之间的该比例处
+	assumedEntryRatio = 0.2
+)
+
+// defaultMajorCoins 默认的主流币（使用 BTC/ETH 的杠杆和仓位上限）
+var defaultMajorCoins = []string{"BTC", "ETH"}
+
+// ValidationRules 开仓决策的校验规则（每个交易员单独配置，JSON中未出现的字段使用默认值）
+type ValidationRules struct {
+	MinRiskReward      float64  `json:"min_risk_reward"`      // 最低风险回报比（按当前价计算），0为不检查
+	MajorCoins         []string `json:"major_coins"`          // 主流币的基础资产（如 BTC、ETH），使用 BTC/ETH 杠杆和仓位上限
+	MajorMaxNotional   float64  `json:"major_max_notional"`   // 主流币单币仓位上限（账户净值倍数）
+	AltcoinMaxNotional float64  `json:"altcoin_max_notional"` // 山寨币单币仓位上限（账户净值倍数）
+	MinNotionalBuffer  float64  `json:"min_notional_buffer"`  // 最小开仓金额在交易所最小名义价值之上的安全边际（0.2 = 20%）
+	DefaultMinNotional float64  `json:"default_min_notional"` // 无法获取交易所规则时使用的最小名义价值（USDT）
+}
+
+// DefaultValidationRules 默认校验规则
+func DefaultValidationRules() ValidationRules {
+	return ValidationRules{
+		MinRiskReward:      defaultMinRiskReward,
+		MajorCoins:         append([]string(nil), defaultMajorCoins...),
+		MajorMaxNotional:   defaultMajorMaxNotional,
+		AltcoinMaxNotional: defaultAltcoinMaxNotional,
+		MinNotionalBuffer:  defaultMinNotionalBuffer,
+		DefaultMinNotional: defaultMinNotional,
+	}
+}
+
+// ParseValidationRules 解析交易员的校验规则配置（JSON对象，空字符串使用默认规则）
+func ParseValidationRules(raw string) (ValidationRules, error) {
+	rules := DefaultValidationRules()
+	if strings.TrimSpace(raw) == "" {
+		return rules, nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader([]byte(raw)))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&rules); err != nil {
+		return DefaultValidationRules(), fmt.Errorf("校验规则配置必须是JSON对象: %w", err)
+	}
+
+	switch {
+	case rules.MinRiskReward < 0:
+		return DefaultValidationRules(), fmt.Errorf("min_risk_reward 不能为负数: %.2f", rules.MinRiskReward)
+	case rules.MajorMaxNotional <= 0 || rules.AltcoinMaxNotional <= 0:
+		return DefaultValidationRules(), fmt.Errorf("单币仓位上限必须大于0")
+	case rules.MinNotionalBuffer < 0:
+		return DefaultValidationRules(), fmt.Errorf("min_notional_buffer 不能为负数: %.2f", rules.MinNotionalBuffer)
+	case rules.DefaultMinNotional < 0:
+		return DefaultValidationRules(), fmt.Errorf("default_min_notional 不能为负数: %.2f", rules.DefaultMinNotional)
+	}
+
+	majors := make([]string, 0, len(rules.MajorCoins))
+	for _, coin := range rules.MajorCoins {
+		base, _ := market.SplitSymbol(coin)
+		if base == "" || !market.IsValidSymbol(base) {
+			return DefaultValidationRules(), fmt.Errorf("无效的主流币: %q", coin)
+		}
+		majors = append(majors, base)
+	}
+	rules.MajorCoins = majors
+	return rules, nil
+}
+
+// IsMajor 是否为主流币（不区分计价资产，BTCUSDT 和 BTCUSDC 都算）
+func (r ValidationRules) IsMajor(symbol string) bool {
+	base, _ := market.SplitSymbol(symbol)
+	for _, coin := range r.MajorCoins {
+		if coin == base {
+			return true
+		}
+	}
+	return false
+}
+
+// MaxNotional 单币开仓金额上限
+func (r ValidationRules) MaxNotional(symbol string, accountEquity float64) float64 {
+	if r.IsMajor(symbol) {
+		return accountEquity * r.MajorMaxNotional
+	}
+	return accountEquity * r.AltcoinMaxNotional
+}
+
+// minPositionUSD 最小开仓金额：交易所最小名义价值与最小下单数量对应金额中的较大者，再加安全边际
+// 没有交易所规则时使用 DefaultMinNotional；返回值的第二项说明数值来源（用于错误信息）
+func (r ValidationRules) minPositionUSD(instruments *market.InstrumentSet, symbol string, price float64) (float64, string) {
+	minNotional, source := r.DefaultMinNotional, "默认最小名义价值"
+	if instruments != nil {
+		if inst, err := instruments.Resolve(symbol); err == nil {
+			if inst.MinNotional > 0 {
+				minNotional, source = inst.MinNotional, "交易所最小名义价值"
+			}
+			if inst.MinQty > 0 && price > 0 && inst.MinQty*price > minNotional {
+				minNotional, source = inst.MinQty*price, fmt.Sprintf("最小下单数量 %g", inst.MinQty)
+			}
+		}
+	}
+	return minNotional * (1 + r.MinNotionalBuffer), source
+}
+
+// validationRules 上下文的校验规则（未配置时使用默认规则）
+func (ctx *Context) validationRules() ValidationRules {
+	if ctx.ValidationRules != nil {
+		return *ctx.ValidationRules
+	}
+	return DefaultValidationRules()
+}
+
+// currentPrice 上下文中币种的当前价格（没有行情数据时返回0）
+func (ctx *Context) currentPrice(symbol string) float64 {
+	if data, ok := ctx.MarketDataMap[symbol]; ok && data != nil {
+		return data.CurrentPrice
+	}
+	return 0
+}
+
+// checkRiskReward 按当前价检查止损止盈的方向和风险回报比
+// 没有当前价格时，假设入场价位于止损到止盈之间的 assumedEntryRatio 处
+func checkRiskReward(d *Decision, price, minRiskReward float64) error {
+	long := d.Action == "open_long"
+	entryPrice := price
+	if entryPrice <= 0 {
+		if long {
+			entryPrice = d.StopLoss + (d.TakeProfit-d.StopLoss)*assumedEntryRatio
+		} else {
+			entryPrice = d.StopLoss - (d.StopLoss-d.TakeProfit)*assumedEntryRatio
+		}
+	}
+
+	var riskPercent, rewardPercent float64
+	if long {
+		if d.StopLoss >= entryPrice || d.TakeProfit <= entryPrice {
+			return fmt.Errorf("做多时止损价(%.4f)必须低于当前价(%.4f)、止盈价(%.4f)必须高于当前价", d.StopLoss, entryPrice, d.TakeProfit)
+		}
+		riskPercent = (entryPrice - d.StopLoss) / entryPrice * 100
+		rewardPercent = (d.TakeProfit - entryPrice) / entryPrice * 100
+	} else {
+		if d.StopLoss <= entryPrice || d.TakeProfit >= entryPrice {
+			return fmt.Errorf("做空时止损价(%.4f)必须高于当前价(%.4f)、止盈价(%.4f)必须低于当前价", d.StopLoss, entryPrice, d.TakeProfit)
+		}
+		riskPercent = (d.StopLoss - entryPrice) / entryPrice * 100
+		rewardPercent = (entryPrice - d.TakeProfit) / entryPrice * 100
+	}
+
+	if minRiskReward <= 0 {
+		return nil
+	}
+	riskRewardRatio := rewardPercent / riskPercent
+	if riskRewardRatio < minRiskReward {
+		return fmt.Errorf("风险回报比过低(%.2f:1)，必须≥%.2f:1 [当前价:%.4f 风险:%.2f%% 收益:%.2f%%] [止损:%.4f 止盈:%.4f]",
+			riskRewardRatio, minRiskReward, entryPrice, riskPercent, rewardPercent, d.StopLoss, d.TakeProfit)
+	}
+	return nil
+}
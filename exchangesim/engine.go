@@ -0,0 +1,548 @@
+package exchangesim
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Venue 订单来源的交易所协议
+type Venue string
+
+const (
+	VenueBinance     Venue = "binance"
+	VenueAster       Venue = "aster"
+	VenueHyperliquid Venue = "hyperliquid"
+)
+
+// 订单状态（统一使用币安命名）
+const (
+	StatusNew             = "NEW"
+	StatusPartiallyFilled = "PARTIALLY_FILLED"
+	StatusFilled          = "FILLED"
+	StatusCanceled        = "CANCELED"
+	StatusRejected        = "REJECTED"
+	StatusExpired         = "EXPIRED"
+)
+
+// 订单类型（Hyperliquid 订单在内部也映射到这些类型）
+const (
+	OrderTypeMarket           = "MARKET"
+	OrderTypeLimit            = "LIMIT"
+	OrderTypeStopMarket       = "STOP_MARKET"
+	OrderTypeTakeProfitMarket = "TAKE_PROFIT_MARKET"
+)
+
+const qtyEpsilon = 1e-9
+
+// Symbol 模拟交易所中的合约配置
+type Symbol struct {
+	Name              string  // 币安格式交易对，如 BTCUSDT / BTCUSDC（Hyperliquid 使用去掉计价资产的币种名）
+	PricePrecision    int     // 价格小数位（tickSize = 10^-PricePrecision）
+	QuantityPrecision int     // 数量小数位（stepSize = 10^-QuantityPrecision，同时作为 Hyperliquid szDecimals）
+	MaxLeverage       int     // 最大杠杆
+	MinNotional       float64 // 最小名义价值（非只减仓订单）
+	Price             float64 // 初始标记价格
+}
+
+// Coin 返回基础资产（Hyperliquid 币种名）
+func (s Symbol) Coin() string {
+	return strings.TrimSuffix(s.Name, s.Quote())
+}
+
+// Quote 返回计价/保证金资产（USDT 或 USDC）
+func (s Symbol) Quote() string {
+	if strings.HasSuffix(s.Name, "USDC") {
+		return "USDC"
+	}
+	return "USDT"
+}
+
+// DefaultSymbols 默认上架的合约
+func DefaultSymbols() []Symbol {
+	return []Symbol{
+		{Name: "BTCUSDT", PricePrecision: 1, QuantityPrecision: 3, MaxLeverage: 50, MinNotional: 5, Price: 50000},
+		{Name: "ETHUSDT", PricePrecision: 2, QuantityPrecision: 3, MaxLeverage: 50, MinNotional: 5, Price: 3000},
+		{Name: "SOLUSDT", PricePrecision: 2, QuantityPrecision: 2, MaxLeverage: 20, MinNotional: 5, Price: 150},
+	}
+}
+
+// Order 模拟交易所中的订单快照
+type Order struct {
+	ID            int64
+	ClientOrderID string
+	Venue         Venue
+	Symbol        string
+	Side          string // BUY / SELL
+	PositionSide  string // LONG / SHORT / BOTH
+	Type          string // MARKET / LIMIT / STOP_MARKET / TAKE_PROFIT_MARKET
+	TimeInForce   string // GTC / IOC / GTX
+	Price         float64
+	StopPrice     float64
+	Quantity      float64
+	ExecutedQty   float64
+	AvgPrice      float64
+	ReduceOnly    bool
+	ClosePosition bool
+	Status        string
+	UpdateTime    int64
+}
+
+// IsOpen 订单是否仍在挂单中
+func (o *Order) IsOpen() bool {
+	return o.Status == StatusNew || o.Status == StatusPartiallyFilled
+}
+
+// IsConditional 是否为条件单（止损/止盈）
+func (o *Order) IsConditional() bool {
+	return o.Type == OrderTypeStopMarket || o.Type == OrderTypeTakeProfitMarket
+}
+
+func (o *Order) remaining() float64 {
+	return o.Quantity - o.ExecutedQty
+}
+
+// Position 模拟交易所中的持仓快照
+type Position struct {
+	Symbol       string
+	PositionSide string  // LONG / SHORT / BOTH
+	Amount       float64 // 带符号数量：多为正、空为负
+	EntryPrice   float64
+}
+
+// Fill 成交记录
+type Fill struct {
+	OrderID     int64
+	Symbol      string
+	Side        string
+	Quantity    float64
+	Price       float64
+	RealizedPnL float64
+	Time        int64
+}
+
+// rejectError 交易所拒单（按币安错误码描述，Hyperliquid 使用 hlMsg）
+type rejectError struct {
+	code  int
+	msg   string
+	hlMsg string
+}
+
+func (e *rejectError) Error() string {
+	return fmt.Sprintf("code=%d, msg=%s", e.code, e.msg)
+}
+
+func reject(code int, msg string) *rejectError {
+	return &rejectError{code: code, msg: msg, hlMsg: msg}
+}
+
+// engine 撮合与账户引擎（不加锁，由 Server 统一加锁）
+type engine struct {
+	symbols     map[string]*Symbol
+	symbolOrder []string
+	prices      map[string]float64
+
+	balance     float64
+	spotBalance float64
+	dualSide    bool
+	leverage    map[string]int
+	isolated    map[string]bool
+
+	positions map[string]*Position // key: symbol|positionSide
+	orders    []*Order
+	fills     []Fill
+	nextID    int64
+
+	now func() time.Time
+}
+
+func newEngine() *engine {
+	e := &engine{
+		symbols:   make(map[string]*Symbol),
+		prices:    make(map[string]float64),
+		leverage:  make(map[string]int),
+		isolated:  make(map[string]bool),
+		positions: make(map[string]*Position),
+		nextID:    1000000,
+		now:       time.Now,
+	}
+	for _, s := range DefaultSymbols() {
+		e.addSymbol(s)
+	}
+	return e
+}
+
+func (e *engine) addSymbol(s Symbol) {
+	if s.MaxLeverage == 0 {
+		s.MaxLeverage = 20
+	}
+	if _, exists := e.symbols[s.Name]; !exists {
+		e.symbolOrder = append(e.symbolOrder, s.Name)
+	}
+	sym := s
+	e.symbols[s.Name] = &sym
+	e.prices[s.Name] = s.Price
+}
+
+// symbolByCoin 按 Hyperliquid 币种名查找交易对
+func (e *engine) symbolByCoin(coin string) *Symbol {
+	if sym, ok := e.symbols[coin+"USDT"]; ok {
+		return sym
+	}
+	return e.symbols[coin+"USDC"]
+}
+
+// symbolByAsset 按 Hyperliquid asset 序号查找交易对（与 meta.universe 顺序一致）
+func (e *engine) symbolByAsset(asset int) *Symbol {
+	if asset < 0 || asset >= len(e.symbolOrder) {
+		return nil
+	}
+	return e.symbols[e.symbolOrder[asset]]
+}
+
+func (e *engine) leverageOf(symbol string) int {
+	if lev, ok := e.leverage[symbol]; ok {
+		return lev
+	}
+	return 20
+}
+
+func positionKey(symbol, positionSide string) string {
+	return symbol + "|" + positionSide
+}
+
+func (e *engine) position(symbol, positionSide string) *Position {
+	key := positionKey(symbol, positionSide)
+	pos, ok := e.positions[key]
+	if !ok {
+		pos = &Position{Symbol: symbol, PositionSide: positionSide}
+		e.positions[key] = pos
+	}
+	return pos
+}
+
+// sortedPositions 返回所有非零持仓（按交易对、方向排序，保证输出稳定）
+func (e *engine) sortedPositions() []*Position {
+	var result []*Position
+	for _, pos := range e.positions {
+		if math.Abs(pos.Amount) > qtyEpsilon {
+			result = append(result, pos)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Symbol != result[j].Symbol {
+			return result[i].Symbol < result[j].Symbol
+		}
+		return result[i].PositionSide < result[j].PositionSide
+	})
+	return result
+}
+
+func (e *engine) unrealizedPnL(pos *Position) float64 {
+	return (e.prices[pos.Symbol] - pos.EntryPrice) * pos.Amount
+}
+
+func (e *engine) marginUsed(pos *Position) float64 {
+	return math.Abs(pos.Amount) * e.prices[pos.Symbol] / float64(e.leverageOf(pos.Symbol))
+}
+
+// totals 返回 (未实现盈亏, 已用保证金)
+func (e *engine) totals() (float64, float64) {
+	unrealized, margin := 0.0, 0.0
+	for _, pos := range e.sortedPositions() {
+		unrealized += e.unrealizedPnL(pos)
+		margin += e.marginUsed(pos)
+	}
+	return unrealized, margin
+}
+
+func (e *engine) available() float64 {
+	unrealized, margin := e.totals()
+	return e.balance + unrealized - margin
+}
+
+// liquidationPrice 粗略估算强平价（仅供展示）
+func (e *engine) liquidationPrice(pos *Position) float64 {
+	lev := float64(e.leverageOf(pos.Symbol))
+	if pos.Amount > 0 {
+		return pos.EntryPrice * (1 - 1/lev)
+	}
+	return pos.EntryPrice * (1 + 1/lev)
+}
+
+// targetPosition 返回订单作用的持仓
+func (e *engine) targetPosition(o *Order) *Position {
+	return e.position(o.Symbol, o.PositionSide)
+}
+
+// isReducing 订单是否减少持仓
+func (e *engine) isReducing(o *Order) bool {
+	switch o.PositionSide {
+	case "LONG":
+		return o.Side == "SELL"
+	case "SHORT":
+		return o.Side == "BUY"
+	}
+	if o.ReduceOnly || o.ClosePosition {
+		return true
+	}
+	pos := e.targetPosition(o)
+	return (pos.Amount > 0 && o.Side == "SELL") || (pos.Amount < 0 && o.Side == "BUY")
+}
+
+func (e *engine) findOrder(symbol string, orderID int64, clientOrderID string) *Order {
+	for i := len(e.orders) - 1; i >= 0; i-- {
+		o := e.orders[i]
+		if symbol != "" && o.Symbol != symbol {
+			continue
+		}
+		if orderID != 0 && o.ID == orderID {
+			return o
+		}
+		if orderID == 0 && clientOrderID != "" && o.ClientOrderID == clientOrderID {
+			return o
+		}
+	}
+	return nil
+}
+
+func (e *engine) openOrders(symbol string) []*Order {
+	var result []*Order
+	for _, o := range e.orders {
+		if o.IsOpen() && (symbol == "" || o.Symbol == symbol) {
+			result = append(result, o)
+		}
+	}
+	return result
+}
+
+func (e *engine) cancel(o *Order) {
+	o.Status = StatusCanceled
+	o.UpdateTime = e.now().UnixMilli()
+}
+
+// validate 下单前的通用校验（交易对、数量精度、保证金、只减仓等）
+func (e *engine) validate(o *Order) *rejectError {
+	sym, ok := e.symbols[o.Symbol]
+	if !ok {
+		return reject(-1121, "Invalid symbol.")
+	}
+	if o.Quantity <= 0 && !o.ClosePosition {
+		return &rejectError{code: -4003, msg: "Quantity less than or equal to zero.", hlMsg: "Order has zero size."}
+	}
+	if !onStep(o.Quantity, sym.QuantityPrecision) {
+		return &rejectError{code: -1111, msg: "Precision is over the maximum defined for this asset.", hlMsg: "Order has invalid size."}
+	}
+
+	if e.isReducing(o) {
+		if o.ClosePosition {
+			return nil
+		}
+		pos := e.targetPosition(o)
+		if math.Abs(pos.Amount) < qtyEpsilon {
+			return &rejectError{code: -2022, msg: "ReduceOnly Order is rejected.", hlMsg: "Reduce only order would increase position."}
+		}
+		if o.Quantity > math.Abs(pos.Amount)+qtyEpsilon && o.PositionSide != "BOTH" {
+			return reject(-2022, "ReduceOnly Order is rejected.")
+		}
+		return nil
+	}
+
+	price := e.prices[o.Symbol]
+	if o.Type == OrderTypeLimit && o.Price > 0 {
+		price = o.Price
+	}
+	notional := o.Quantity * price
+	if notional < sym.MinNotional {
+		return &rejectError{
+			code:  -4164,
+			msg:   fmt.Sprintf("Order's notional must be no smaller than %v (unless you choose reduce only).", sym.MinNotional),
+			hlMsg: fmt.Sprintf("Order must have minimum value of $%v.", sym.MinNotional),
+		}
+	}
+	if notional/float64(e.leverageOf(o.Symbol)) > e.available()+qtyEpsilon {
+		return &rejectError{code: -2019, msg: "Margin is insufficient.", hlMsg: "Insufficient margin to place order."}
+	}
+	return nil
+}
+
+// place 记录新订单并按场景动作处理（调用前须已通过 validate）
+func (e *engine) place(o *Order, act ruleAction, ratio float64) *Order {
+	e.nextID++
+	o.ID = e.nextID
+	o.Status = StatusNew
+	o.UpdateTime = e.now().UnixMilli()
+	e.orders = append(e.orders, o)
+
+	if o.IsConditional() {
+		return o
+	}
+	if act == actionRest {
+		// 市价单和 IOC 无法挂单，视为无对手盘直接过期
+		if o.Type == OrderTypeMarket || o.TimeInForce == "IOC" {
+			o.Status = StatusExpired
+		}
+		return o
+	}
+	if !e.marketable(o) {
+		if o.TimeInForce == "IOC" {
+			o.Status = StatusExpired
+		}
+		return o
+	}
+
+	qty := o.Quantity
+	if act == actionPartialFill {
+		qty = floorToStep(o.Quantity*ratio, e.symbols[o.Symbol].QuantityPrecision)
+	}
+	if qty > 0 {
+		e.execute(o, qty, e.prices[o.Symbol])
+	}
+	if o.remaining() > qtyEpsilon && (o.Type == OrderTypeMarket || o.TimeInForce == "IOC") {
+		o.Status = StatusExpired
+	}
+	return o
+}
+
+// marketable 限价单是否可立即成交
+func (e *engine) marketable(o *Order) bool {
+	if o.Type == OrderTypeMarket {
+		return true
+	}
+	price := e.prices[o.Symbol]
+	if o.Side == "BUY" {
+		return o.Price >= price
+	}
+	return o.Price <= price
+}
+
+// execute 成交指定数量并更新持仓和余额
+func (e *engine) execute(o *Order, qty, price float64) {
+	pos := e.targetPosition(o)
+	if o.ClosePosition {
+		qty = math.Abs(pos.Amount)
+	}
+	if e.isReducing(o) && qty > math.Abs(pos.Amount) && o.PositionSide != "BOTH" {
+		qty = math.Abs(pos.Amount)
+	}
+	if o.ReduceOnly && qty > math.Abs(pos.Amount) {
+		qty = math.Abs(pos.Amount)
+	}
+	if qty <= qtyEpsilon {
+		o.Status = StatusExpired
+		return
+	}
+
+	delta := qty
+	if o.Side == "SELL" {
+		delta = -qty
+	}
+
+	realized := 0.0
+	switch {
+	case pos.Amount == 0 || (pos.Amount > 0) == (delta > 0):
+		total := math.Abs(pos.Amount) + qty
+		pos.EntryPrice = (math.Abs(pos.Amount)*pos.EntryPrice + qty*price) / total
+		pos.Amount += delta
+	default:
+		closed := math.Min(math.Abs(pos.Amount), qty)
+		if pos.Amount > 0 {
+			realized = closed * (price - pos.EntryPrice)
+		} else {
+			realized = closed * (pos.EntryPrice - price)
+		}
+		pos.Amount += delta
+		if math.Abs(pos.Amount) < qtyEpsilon {
+			pos.Amount = 0
+			pos.EntryPrice = 0
+		} else if (pos.Amount > 0) == (delta > 0) {
+			// 单向持仓模式下反手：剩余部分按成交价开新仓
+			pos.EntryPrice = price
+		}
+	}
+	e.balance += realized
+
+	o.AvgPrice = (o.AvgPrice*o.ExecutedQty + price*qty) / (o.ExecutedQty + qty)
+	o.ExecutedQty += qty
+	if o.ClosePosition || o.remaining() <= qtyEpsilon {
+		o.Status = StatusFilled
+	} else {
+		o.Status = StatusPartiallyFilled
+	}
+	o.UpdateTime = e.now().UnixMilli()
+
+	e.fills = append(e.fills, Fill{
+		OrderID:     o.ID,
+		Symbol:      o.Symbol,
+		Side:        o.Side,
+		Quantity:    qty,
+		Price:       price,
+		RealizedPnL: realized,
+		Time:        o.UpdateTime,
+	})
+}
+
+// setPrice 更新标记价格，并触发条件单和可成交的限价挂单
+func (e *engine) setPrice(symbol string, price float64) []*Order {
+	e.prices[symbol] = price
+
+	var touched []*Order
+	for _, o := range e.openOrders(symbol) {
+		switch {
+		case o.IsConditional():
+			if !e.triggered(o, price) {
+				continue
+			}
+			qty := o.remaining()
+			pos := e.targetPosition(o)
+			if o.ClosePosition || qty > math.Abs(pos.Amount) {
+				qty = math.Abs(pos.Amount)
+			}
+			if qty <= qtyEpsilon {
+				o.Status = StatusExpired
+				o.UpdateTime = e.now().UnixMilli()
+			} else {
+				e.execute(o, qty, price)
+				o.Status = StatusFilled
+			}
+			touched = append(touched, o)
+		case o.Type == OrderTypeLimit && e.marketable(o):
+			e.execute(o, o.remaining(), o.Price)
+			touched = append(touched, o)
+		}
+	}
+	return touched
+}
+
+// triggered 条件单是否被当前价格触发
+func (e *engine) triggered(o *Order, price float64) bool {
+	if o.Type == OrderTypeStopMarket {
+		if o.Side == "SELL" {
+			return price <= o.StopPrice
+		}
+		return price >= o.StopPrice
+	}
+	if o.Side == "SELL" {
+		return price >= o.StopPrice
+	}
+	return price <= o.StopPrice
+}
+
+// wouldTrigger 条件单下单时是否会立即触发（币安会拒绝此类订单）
+func (e *engine) wouldTrigger(o *Order) bool {
+	return o.IsConditional() && e.triggered(o, e.prices[o.Symbol])
+}
+
+// onStep 数值是否为 10^-precision 的整数倍
+func onStep(value float64, precision int) bool {
+	scaled := value * math.Pow10(precision)
+	return math.Abs(scaled-math.Round(scaled)) < 1e-6
+}
+
+// floorToStep 向下取整到 10^-precision
+func floorToStep(value float64, precision int) float64 {
+	scale := math.Pow10(precision)
+	return math.Floor(value*scale+1e-9) / scale
+}
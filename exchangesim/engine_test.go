@@ -0,0 +1,176 @@
+package exchangesim
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestServer(t *testing.T) *Server {
+	sim := NewServer()
+	t.Cleanup(sim.Close)
+	return sim
+}
+
+func marketOrder(symbol, side, positionSide string, qty float64) *Order {
+	return &Order{
+		Venue:        VenueBinance,
+		Symbol:       symbol,
+		Side:         side,
+		PositionSide: positionSide,
+		Type:         OrderTypeMarket,
+		Quantity:     qty,
+	}
+}
+
+func TestEngine_OpenAndCloseRealizesPnL(t *testing.T) {
+	e := newEngine()
+	e.balance = 10000
+	e.dualSide = true
+
+	open := e.place(marketOrder("BTCUSDT", "BUY", "LONG", 0.1), actionFill, 0)
+	assert.Equal(t, StatusFilled, open.Status)
+	assert.InDelta(t, 50000, open.AvgPrice, 1e-9)
+	assert.InDelta(t, 0.1, e.position("BTCUSDT", "LONG").Amount, 1e-9)
+
+	e.setPrice("BTCUSDT", 51000)
+	closeOrder := marketOrder("BTCUSDT", "SELL", "LONG", 0.1)
+	require.Nil(t, e.validate(closeOrder))
+	e.place(closeOrder, actionFill, 0)
+
+	assert.InDelta(t, 0, e.position("BTCUSDT", "LONG").Amount, 1e-9)
+	assert.InDelta(t, 10100, e.balance, 1e-6)
+}
+
+func TestEngine_Validate(t *testing.T) {
+	e := newEngine()
+	e.balance = 100
+	e.dualSide = true
+
+	tests := []struct {
+		name  string
+		order *Order
+		code  int
+	}{
+		{"未知交易对", marketOrder("FOOUSDT", "BUY", "LONG", 1), -1121},
+		{"数量为0", marketOrder("BTCUSDT", "BUY", "LONG", 0), -4003},
+		{"数量精度超限", marketOrder("BTCUSDT", "BUY", "LONG", 0.0001), -1111},
+		{"名义价值过小", marketOrder("SOLUSDT", "BUY", "LONG", 0.01), -4164},
+		{"保证金不足", marketOrder("BTCUSDT", "BUY", "LONG", 1), -2019},
+		{"无持仓平仓", marketOrder("BTCUSDT", "SELL", "LONG", 0.01), -2022},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rej := e.validate(tt.order)
+			require.NotNil(t, rej)
+			assert.Equal(t, tt.code, rej.code)
+		})
+	}
+}
+
+func TestEngine_StopLossTriggers(t *testing.T) {
+	e := newEngine()
+	e.balance = 10000
+	e.dualSide = true
+	e.place(marketOrder("ETHUSDT", "BUY", "LONG", 1), actionFill, 0)
+
+	stop := &Order{
+		Venue:         VenueBinance,
+		Symbol:        "ETHUSDT",
+		Side:          "SELL",
+		PositionSide:  "LONG",
+		Type:          OrderTypeStopMarket,
+		StopPrice:     2900,
+		ClosePosition: true,
+	}
+	assert.False(t, e.wouldTrigger(stop))
+	e.place(stop, actionFill, 0)
+	assert.Equal(t, StatusNew, stop.Status)
+
+	e.setPrice("ETHUSDT", 2950)
+	assert.Equal(t, StatusNew, stop.Status)
+
+	e.setPrice("ETHUSDT", 2890)
+	assert.Equal(t, StatusFilled, stop.Status)
+	assert.InDelta(t, 0, e.position("ETHUSDT", "LONG").Amount, 1e-9)
+	assert.InDelta(t, 10000-110, e.balance, 1e-6)
+}
+
+func TestEngine_PartialFillAndRest(t *testing.T) {
+	e := newEngine()
+	e.balance = 10000
+	e.dualSide = true
+
+	partial := e.place(marketOrder("BTCUSDT", "BUY", "LONG", 0.1), actionPartialFill, 0.5)
+	assert.Equal(t, StatusExpired, partial.Status)
+	assert.InDelta(t, 0.05, partial.ExecutedQty, 1e-9)
+
+	limit := &Order{
+		Venue:        VenueBinance,
+		Symbol:       "BTCUSDT",
+		Side:         "BUY",
+		PositionSide: "LONG",
+		Type:         OrderTypeLimit,
+		TimeInForce:  "GTC",
+		Price:        50000,
+		Quantity:     0.01,
+	}
+	e.place(limit, actionRest, 0)
+	assert.Equal(t, StatusNew, limit.Status)
+
+	e.setPrice("BTCUSDT", 49900)
+	assert.Equal(t, StatusFilled, limit.Status)
+	assert.InDelta(t, 50000, limit.AvgPrice, 1e-9)
+	assert.InDelta(t, 0.06, e.position("BTCUSDT", "LONG").Amount, 1e-9)
+}
+
+func TestScenario_RuleMatching(t *testing.T) {
+	sim := newTestServer(t)
+	sim.Script(
+		NextOrder().ForSymbol("ethusdt").Reject(-2019, "Margin is insufficient."),
+		NextOrder().OnVenue(VenueAster).Rest().Times(2),
+		NextOrder().Delay(10*time.Millisecond).Always(),
+	)
+
+	btc := marketOrder("BTCUSDT", "BUY", "BOTH", 0.01)
+	assert.Equal(t, actionFill, sim.takeRule(btc).action)
+	assert.Equal(t, 3, sim.PendingRules(), "Always 规则不会被移除")
+
+	eth := marketOrder("ETHUSDT", "BUY", "BOTH", 0.01)
+	assert.Equal(t, actionReject, sim.takeRule(eth).action)
+	assert.Equal(t, 2, sim.PendingRules())
+
+	aster := marketOrder("BTCUSDT", "BUY", "BOTH", 0.01)
+	aster.Venue = VenueAster
+	assert.Equal(t, actionRest, sim.takeRule(aster).action)
+	assert.Equal(t, actionRest, sim.takeRule(aster).action)
+	assert.Equal(t, 1, sim.PendingRules())
+}
+
+func TestSubmitOrder_AcceptThenFail(t *testing.T) {
+	sim := newTestServer(t)
+	sim.Script(NextOrder().AcceptThenFail(), NextOrder().FailBeforeAccept())
+
+	outcome := sim.submitOrder(marketOrder("BTCUSDT", "BUY", "BOTH", 0.01), nil)
+	assert.True(t, outcome.failed)
+	assert.True(t, outcome.accepted)
+	assert.Equal(t, StatusFilled, outcome.order.Status)
+
+	outcome = sim.submitOrder(marketOrder("BTCUSDT", "BUY", "BOTH", 0.01), nil)
+	assert.True(t, outcome.failed)
+	assert.False(t, outcome.accepted)
+
+	assert.Len(t, sim.Orders(), 1)
+	assert.InDelta(t, 0.01, sim.Position("BTCUSDT", "BOTH").Amount, 1e-9)
+}
+
+func TestHLPriceValid(t *testing.T) {
+	assert.True(t, hlPriceValid("50500", 3))
+	assert.True(t, hlPriceValid("123456", 3), "整数价格总是合法")
+	assert.True(t, hlPriceValid("3030.5", 3))
+	assert.False(t, hlPriceValid("3030.55", 3), "超过5位有效数字")
+	assert.False(t, hlPriceValid("0.0012345", 2), "小数位超过 6-szDecimals")
+	assert.True(t, hlPriceValid("0.0012", 2))
+}
@@ -0,0 +1,653 @@
+package exchangesim
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// 超时类错误（币安 -1007：执行状态未知）
+const timeoutMsg = "Timeout waiting for response from backend server. Send status unknown; execution status unknown."
+
+// futuresRequest 已解析的合约 REST 请求
+type futuresRequest struct {
+	method string
+	path   string
+	params url.Values
+	venue  Venue
+}
+
+// handleFutures 币安合约 / Aster 的 REST 入口
+// 两者协议基本一致：带 signer 参数的请求按 Aster 规则验签，否则按币安 HMAC 规则验签
+func (s *Server) handleFutures(w http.ResponseWriter, r *http.Request) {
+	rawBody, _ := io.ReadAll(r.Body)
+	params, err := url.ParseQuery(r.URL.RawQuery)
+	if err != nil {
+		writeFuturesError(w, http.StatusBadRequest, reject(-1100, "Illegal characters found in a parameter."))
+		return
+	}
+	if len(rawBody) > 0 {
+		bodyParams, err := url.ParseQuery(string(rawBody))
+		if err != nil {
+			writeFuturesError(w, http.StatusBadRequest, reject(-1100, "Illegal characters found in a parameter."))
+			return
+		}
+		for k, vs := range bodyParams {
+			for _, v := range vs {
+				params.Add(k, v)
+			}
+		}
+	}
+
+	req := &futuresRequest{
+		method: r.Method,
+		path:   r.URL.Path,
+		params: params,
+		venue:  VenueBinance,
+	}
+
+	// 公共接口（无需签名）
+	switch req.path {
+	case "/fapi/v1/ping":
+		writeJSON(w, http.StatusOK, map[string]interface{}{})
+		return
+	case "/fapi/v1/time":
+		writeJSON(w, http.StatusOK, map[string]interface{}{"serverTime": time.Now().UnixMilli()})
+		return
+	case "/fapi/v1/exchangeInfo", "/fapi/v3/exchangeInfo":
+		s.futuresExchangeInfo(w)
+		return
+	case "/fapi/v1/ticker/price", "/fapi/v2/ticker/price", "/fapi/v3/ticker/price":
+		s.futuresTickerPrice(w, req)
+		return
+	}
+
+	// 签名接口
+	if params.Get("signer") != "" {
+		req.venue = VenueAster
+		if rej := s.verifyAster(params); rej != nil {
+			writeFuturesError(w, http.StatusUnauthorized, rej)
+			return
+		}
+	} else if rej := s.verifyBinance(r, rawBody); rej != nil {
+		writeFuturesError(w, http.StatusUnauthorized, rej)
+		return
+	}
+
+	endpoint := strings.TrimPrefix(strings.TrimPrefix(strings.TrimPrefix(req.path, "/fapi/v1"), "/fapi/v2"), "/fapi/v3")
+	switch {
+	case endpoint == "/positionSide/dual":
+		s.futuresPositionMode(w, req)
+	case endpoint == "/marginType":
+		s.futuresMarginType(w, req)
+	case endpoint == "/leverage":
+		s.futuresLeverage(w, req)
+	case endpoint == "/account":
+		s.futuresAccount(w)
+	case endpoint == "/balance":
+		s.futuresBalance(w)
+	case endpoint == "/positionRisk":
+		s.futuresPositionRisk(w, req)
+	case endpoint == "/order" && req.method == http.MethodPost:
+		s.futuresCreateOrder(w, req)
+	case endpoint == "/order" && req.method == http.MethodGet:
+		s.futuresQueryOrder(w, req)
+	case endpoint == "/order" && req.method == http.MethodDelete:
+		s.futuresCancelOrder(w, req)
+	case endpoint == "/openOrders":
+		s.futuresOpenOrders(w, req)
+	case endpoint == "/allOpenOrders" && req.method == http.MethodDelete:
+		s.futuresCancelAll(w, req)
+	default:
+		writeFuturesError(w, http.StatusNotFound, reject(-5000, fmt.Sprintf("Path %s, Method %s is invalid", req.path, req.method)))
+	}
+}
+
+// verifyBinance 校验币安 HMAC-SHA256 签名（签名内容 = 不含 signature 的 querystring + body）
+func (s *Server) verifyBinance(r *http.Request, rawBody []byte) *rejectError {
+	s.mu.Lock()
+	secret, ok := s.binanceKeys[r.Header.Get("X-MBX-APIKEY")]
+	s.mu.Unlock()
+	if !ok {
+		return reject(-2015, "Invalid API-key, IP, or permissions for action.")
+	}
+
+	var signature string
+	var parts []string
+	for _, part := range strings.Split(r.URL.RawQuery, "&") {
+		if strings.HasPrefix(part, "signature=") {
+			signature = strings.TrimPrefix(part, "signature=")
+			continue
+		}
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	if signature == "" {
+		return reject(-1102, "Mandatory parameter 'signature' was not sent, was empty/null, or malformed.")
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strings.Join(parts, "&") + string(rawBody)))
+	if !hmac.Equal([]byte(hex.EncodeToString(mac.Sum(nil))), []byte(signature)) {
+		return reject(-1022, "Signature for this request is not valid.")
+	}
+
+	values, _ := url.ParseQuery(r.URL.RawQuery + "&" + string(rawBody))
+	timestamp, err := strconv.ParseInt(values.Get("timestamp"), 10, 64)
+	if err != nil {
+		return reject(-1102, "Mandatory parameter 'timestamp' was not sent, was empty/null, or malformed.")
+	}
+	recvWindow := int64(5000)
+	if rw, err := strconv.ParseInt(values.Get("recvWindow"), 10, 64); err == nil && rw > 0 {
+		recvWindow = rw
+	}
+	now := time.Now().UnixMilli()
+	if timestamp > now+1000 || now-timestamp > recvWindow {
+		return reject(-1021, "Timestamp for this request is outside of the recvWindow.")
+	}
+	return nil
+}
+
+// verifyAster 校验 Aster 签名
+// 签名内容：除 user/signer/signature/nonce 外的参数按 key 排序序列化为 JSON，
+// 与 user、signer、nonce 一起 ABI 编码后做 Keccak256，再按以太坊签名消息格式签名
+func (s *Server) verifyAster(params url.Values) *rejectError {
+	user := params.Get("user")
+	signer := params.Get("signer")
+
+	s.mu.Lock()
+	registered, ok := s.asterSigners[strings.ToLower(user)]
+	s.mu.Unlock()
+	if !ok || registered != strings.ToLower(signer) {
+		return reject(-2015, "Invalid API-key, IP, or permissions for action.")
+	}
+
+	payload := make(map[string]string)
+	for k := range params {
+		switch k {
+		case "user", "signer", "signature", "nonce":
+			continue
+		}
+		payload[k] = params.Get(k)
+	}
+	jsonStr, err := json.Marshal(payload)
+	if err != nil {
+		return reject(-1022, "Signature for this request is not valid.")
+	}
+
+	nonce, ok := new(big.Int).SetString(params.Get("nonce"), 10)
+	if !ok {
+		return reject(-1102, "Mandatory parameter 'nonce' was not sent, was empty/null, or malformed.")
+	}
+
+	tString, _ := abi.NewType("string", "", nil)
+	tAddress, _ := abi.NewType("address", "", nil)
+	tUint256, _ := abi.NewType("uint256", "", nil)
+	arguments := abi.Arguments{{Type: tString}, {Type: tAddress}, {Type: tAddress}, {Type: tUint256}}
+	packed, err := arguments.Pack(string(jsonStr), common.HexToAddress(user), common.HexToAddress(signer), nonce)
+	if err != nil {
+		return reject(-1022, "Signature for this request is not valid.")
+	}
+	hash := crypto.Keccak256(packed)
+	msgHash := crypto.Keccak256Hash([]byte(fmt.Sprintf("\x19Ethereum Signed Message:\n%d%s", len(hash), hash)))
+
+	sig, err := hex.DecodeString(strings.TrimPrefix(params.Get("signature"), "0x"))
+	if err != nil || len(sig) != 65 {
+		return reject(-1022, "Signature for this request is not valid.")
+	}
+	if sig[64] >= 27 {
+		sig[64] -= 27
+	}
+	pub, err := crypto.SigToPub(msgHash.Bytes(), sig)
+	if err != nil || !strings.EqualFold(crypto.PubkeyToAddress(*pub).Hex(), signer) {
+		return reject(-1022, "Signature for this request is not valid.")
+	}
+	return nil
+}
+
+func writeFuturesError(w http.ResponseWriter, status int, rej *rejectError) {
+	writeJSON(w, status, map[string]interface{}{"code": rej.code, "msg": rej.msg})
+}
+
+func writeFuturesTimeout(w http.ResponseWriter) {
+	writeFuturesError(w, http.StatusServiceUnavailable, reject(-1007, timeoutMsg))
+}
+
+func (s *Server) futuresExchangeInfo(w http.ResponseWriter) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	symbols := make([]map[string]interface{}, 0, len(s.engine.symbolOrder))
+	for _, name := range s.engine.symbolOrder {
+		sym := s.engine.symbols[name]
+		symbols = append(symbols, map[string]interface{}{
+			"symbol":             sym.Name,
+			"pair":               sym.Name,
+			"contractType":       "PERPETUAL",
+			"status":             "TRADING",
+			"baseAsset":          sym.Coin(),
+			"quoteAsset":         sym.Quote(),
+			"marginAsset":        sym.Quote(),
+			"pricePrecision":     sym.PricePrecision,
+			"quantityPrecision":  sym.QuantityPrecision,
+			"baseAssetPrecision": 8,
+			"quotePrecision":     8,
+			"filters": []map[string]interface{}{
+				{"filterType": "PRICE_FILTER", "minPrice": formatStep(sym.PricePrecision), "maxPrice": "10000000", "tickSize": formatStep(sym.PricePrecision)},
+				{"filterType": "LOT_SIZE", "minQty": formatStep(sym.QuantityPrecision), "maxQty": "100000", "stepSize": formatStep(sym.QuantityPrecision)},
+				{"filterType": "MARKET_LOT_SIZE", "minQty": formatStep(sym.QuantityPrecision), "maxQty": "100000", "stepSize": formatStep(sym.QuantityPrecision)},
+				{"filterType": "MIN_NOTIONAL", "notional": formatFloat(sym.MinNotional)},
+			},
+			"orderTypes":  []string{"LIMIT", "MARKET", "STOP_MARKET", "TAKE_PROFIT_MARKET"},
+			"timeInForce": []string{"GTC", "IOC", "FOK", "GTX"},
+		})
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"timezone":   "UTC",
+		"serverTime": time.Now().UnixMilli(),
+		"rateLimits": []interface{}{},
+		"assets":     []map[string]interface{}{{"asset": "USDT", "marginAvailable": true}},
+		"symbols":    symbols,
+	})
+}
+
+func (s *Server) futuresTickerPrice(w http.ResponseWriter, req *futuresRequest) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().UnixMilli()
+	if symbol := req.params.Get("symbol"); symbol != "" {
+		price, ok := s.engine.prices[symbol]
+		if !ok {
+			writeFuturesError(w, http.StatusBadRequest, reject(-1121, "Invalid symbol."))
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"symbol": symbol, "price": formatFloat(price), "time": now})
+		return
+	}
+
+	prices := make([]map[string]interface{}, 0, len(s.engine.symbolOrder))
+	for _, name := range s.engine.symbolOrder {
+		prices = append(prices, map[string]interface{}{"symbol": name, "price": formatFloat(s.engine.prices[name]), "time": now})
+	}
+	writeJSON(w, http.StatusOK, prices)
+}
+
+func (s *Server) futuresPositionMode(w http.ResponseWriter, req *futuresRequest) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if req.method == http.MethodGet {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"dualSidePosition": s.engine.dualSide})
+		return
+	}
+
+	dualSide := req.params.Get("dualSidePosition") == "true"
+	if dualSide == s.engine.dualSide {
+		writeFuturesError(w, http.StatusBadRequest, reject(-4059, "No need to change position side."))
+		return
+	}
+	if len(s.engine.sortedPositions()) > 0 || len(s.engine.openOrders("")) > 0 {
+		writeFuturesError(w, http.StatusBadRequest, reject(-4068, "Position side cannot be changed if there exists position."))
+		return
+	}
+	s.engine.dualSide = dualSide
+	writeJSON(w, http.StatusOK, map[string]interface{}{"code": 200, "msg": "success"})
+}
+
+func (s *Server) futuresMarginType(w http.ResponseWriter, req *futuresRequest) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	symbol := req.params.Get("symbol")
+	if _, ok := s.engine.symbols[symbol]; !ok {
+		writeFuturesError(w, http.StatusBadRequest, reject(-1121, "Invalid symbol."))
+		return
+	}
+
+	isolated := strings.ToUpper(req.params.Get("marginType")) == "ISOLATED"
+	if isolated == s.engine.isolated[symbol] {
+		writeFuturesError(w, http.StatusBadRequest, reject(-4046, "No need to change margin type."))
+		return
+	}
+	for _, pos := range s.engine.sortedPositions() {
+		if pos.Symbol == symbol {
+			writeFuturesError(w, http.StatusBadRequest, reject(-4048, "Margin type cannot be changed if there exists position."))
+			return
+		}
+	}
+	s.engine.isolated[symbol] = isolated
+	writeJSON(w, http.StatusOK, map[string]interface{}{"code": 200, "msg": "success"})
+}
+
+func (s *Server) futuresLeverage(w http.ResponseWriter, req *futuresRequest) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	symbol := req.params.Get("symbol")
+	sym, ok := s.engine.symbols[symbol]
+	if !ok {
+		writeFuturesError(w, http.StatusBadRequest, reject(-1121, "Invalid symbol."))
+		return
+	}
+	leverage, err := strconv.Atoi(req.params.Get("leverage"))
+	if err != nil || leverage < 1 || leverage > sym.MaxLeverage {
+		writeFuturesError(w, http.StatusBadRequest, reject(-4028, fmt.Sprintf("Leverage %s is not valid", req.params.Get("leverage"))))
+		return
+	}
+	s.engine.leverage[symbol] = leverage
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"leverage":         leverage,
+		"maxNotionalValue": "1000000",
+		"symbol":           symbol,
+	})
+}
+
+func (s *Server) futuresAccount(w http.ResponseWriter) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	unrealized, margin := s.engine.totals()
+	available := s.engine.balance + unrealized - margin
+
+	positions := make([]map[string]interface{}, 0)
+	for _, pos := range s.engine.sortedPositions() {
+		positions = append(positions, map[string]interface{}{
+			"symbol":           pos.Symbol,
+			"positionSide":     pos.PositionSide,
+			"positionAmt":      formatFloat(pos.Amount),
+			"entryPrice":       formatFloat(pos.EntryPrice),
+			"unrealizedProfit": formatFloat(s.engine.unrealizedPnL(pos)),
+			"initialMargin":    formatFloat(s.engine.marginUsed(pos)),
+			"leverage":         strconv.Itoa(s.engine.leverageOf(pos.Symbol)),
+			"isolated":         s.engine.isolated[pos.Symbol],
+		})
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"feeTier":                     0,
+		"canTrade":                    true,
+		"canDeposit":                  true,
+		"canWithdraw":                 true,
+		"totalInitialMargin":          formatFloat(margin),
+		"totalMaintMargin":            formatFloat(margin / 10),
+		"totalWalletBalance":          formatFloat(s.engine.balance),
+		"totalUnrealizedProfit":       formatFloat(unrealized),
+		"totalMarginBalance":          formatFloat(s.engine.balance + unrealized),
+		"totalPositionInitialMargin":  formatFloat(margin),
+		"totalOpenOrderInitialMargin": "0",
+		"totalCrossWalletBalance":     formatFloat(s.engine.balance),
+		"totalCrossUnPnl":             formatFloat(unrealized),
+		"availableBalance":            formatFloat(available),
+		"maxWithdrawAmount":           formatFloat(math.Max(available, 0)),
+		"assets": []map[string]interface{}{
+			{
+				"asset":              "USDT",
+				"walletBalance":      formatFloat(s.engine.balance),
+				"unrealizedProfit":   formatFloat(unrealized),
+				"marginBalance":      formatFloat(s.engine.balance + unrealized),
+				"initialMargin":      formatFloat(margin),
+				"crossWalletBalance": formatFloat(s.engine.balance),
+				"crossUnPnl":         formatFloat(unrealized),
+				"availableBalance":   formatFloat(available),
+				"maxWithdrawAmount":  formatFloat(math.Max(available, 0)),
+			},
+		},
+		"positions": positions,
+	})
+}
+
+func (s *Server) futuresBalance(w http.ResponseWriter) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	unrealized, margin := s.engine.totals()
+	available := s.engine.balance + unrealized - margin
+	writeJSON(w, http.StatusOK, []map[string]interface{}{
+		{
+			"accountAlias":       "sim",
+			"asset":              "USDT",
+			"balance":            formatFloat(s.engine.balance),
+			"walletBalance":      formatFloat(s.engine.balance),
+			"crossWalletBalance": formatFloat(s.engine.balance),
+			"crossUnPnl":         formatFloat(unrealized),
+			"availableBalance":   formatFloat(available),
+			"maxWithdrawAmount":  formatFloat(math.Max(available, 0)),
+			"marginAvailable":    true,
+			"updateTime":         time.Now().UnixMilli(),
+		},
+	})
+}
+
+// futuresPositionRisk 持仓风险（与真实接口一致，每个交易对都返回记录，无持仓时数量为0）
+func (s *Server) futuresPositionRisk(w http.ResponseWriter, req *futuresRequest) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sides := []string{"BOTH"}
+	if s.engine.dualSide {
+		sides = []string{"LONG", "SHORT"}
+	}
+
+	filter := req.params.Get("symbol")
+	result := make([]map[string]interface{}, 0)
+	for _, name := range s.engine.symbolOrder {
+		if filter != "" && filter != name {
+			continue
+		}
+		for _, side := range sides {
+			pos := s.engine.position(name, side)
+			marginType := "cross"
+			if s.engine.isolated[name] {
+				marginType = "isolated"
+			}
+			liquidation := 0.0
+			if pos.Amount != 0 {
+				liquidation = s.engine.liquidationPrice(pos)
+			}
+			result = append(result, map[string]interface{}{
+				"symbol":           name,
+				"positionSide":     side,
+				"positionAmt":      formatFloat(pos.Amount),
+				"entryPrice":       formatFloat(pos.EntryPrice),
+				"breakEvenPrice":   formatFloat(pos.EntryPrice),
+				"markPrice":        formatFloat(s.engine.prices[name]),
+				"unRealizedProfit": formatFloat(s.engine.unrealizedPnL(pos)),
+				"liquidationPrice": formatFloat(liquidation),
+				"leverage":         strconv.Itoa(s.engine.leverageOf(name)),
+				"maxNotionalValue": "1000000",
+				"marginType":       marginType,
+				"isolatedMargin":   "0",
+				"isAutoAddMargin":  "false",
+				"notional":         formatFloat(pos.Amount * s.engine.prices[name]),
+				"isolatedWallet":   "0",
+				"updateTime":       time.Now().UnixMilli(),
+			})
+		}
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+func (s *Server) futuresCreateOrder(w http.ResponseWriter, req *futuresRequest) {
+	p := req.params
+	o := &Order{
+		Venue:         req.venue,
+		ClientOrderID: p.Get("newClientOrderId"),
+		Symbol:        p.Get("symbol"),
+		Side:          strings.ToUpper(p.Get("side")),
+		PositionSide:  strings.ToUpper(p.Get("positionSide")),
+		Type:          strings.ToUpper(p.Get("type")),
+		TimeInForce:   strings.ToUpper(p.Get("timeInForce")),
+		ReduceOnly:    p.Get("reduceOnly") == "true",
+		ClosePosition: p.Get("closePosition") == "true",
+	}
+	if o.PositionSide == "" {
+		o.PositionSide = "BOTH"
+	}
+	if o.ClientOrderID == "" {
+		o.ClientOrderID = fmt.Sprintf("sim_%d", time.Now().UnixNano())
+	}
+	o.Quantity, _ = strconv.ParseFloat(p.Get("quantity"), 64)
+	o.Price, _ = strconv.ParseFloat(p.Get("price"), 64)
+	o.StopPrice, _ = strconv.ParseFloat(p.Get("stopPrice"), 64)
+
+	switch o.Type {
+	case OrderTypeMarket, OrderTypeLimit, OrderTypeStopMarket, OrderTypeTakeProfitMarket:
+	default:
+		writeFuturesError(w, http.StatusBadRequest, reject(-1116, "Invalid orderType."))
+		return
+	}
+	if o.Side != "BUY" && o.Side != "SELL" {
+		writeFuturesError(w, http.StatusBadRequest, reject(-1117, "Invalid side."))
+		return
+	}
+
+	outcome := s.submitOrder(o, func(e *engine) *rejectError {
+		sym, ok := e.symbols[o.Symbol]
+		if !ok {
+			return reject(-1121, "Invalid symbol.")
+		}
+		if (o.PositionSide == "BOTH") == e.dualSide {
+			return reject(-4061, "Order's position side does not match user's setting.")
+		}
+		if o.ReduceOnly && e.dualSide {
+			return reject(-1106, "Parameter 'reduceOnly' sent when not required.")
+		}
+		if o.Type == OrderTypeLimit && o.Price <= 0 {
+			return reject(-1102, "Mandatory parameter 'price' was not sent, was empty/null, or malformed.")
+		}
+		if (o.Type == OrderTypeLimit && !onStep(o.Price, sym.PricePrecision)) ||
+			(o.IsConditional() && !onStep(o.StopPrice, sym.PricePrecision)) {
+			return reject(-4014, "Price not increased by tick size.")
+		}
+		if e.wouldTrigger(o) {
+			return reject(-2021, "Order would immediately trigger.")
+		}
+		if existing := e.findOrder("", 0, o.ClientOrderID); existing != nil && existing.IsOpen() {
+			return reject(-4116, "ClientOrderId is duplicated.")
+		}
+		return nil
+	})
+
+	switch {
+	case outcome.failed:
+		writeFuturesTimeout(w)
+	case outcome.rejected != nil:
+		writeFuturesError(w, http.StatusBadRequest, outcome.rejected)
+	default:
+		writeJSON(w, http.StatusOK, futuresOrderJSON(&outcome.order))
+	}
+}
+
+func (s *Server) futuresQueryOrder(w http.ResponseWriter, req *futuresRequest) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	orderID, _ := strconv.ParseInt(req.params.Get("orderId"), 10, 64)
+	o := s.engine.findOrder(req.params.Get("symbol"), orderID, req.params.Get("origClientOrderId"))
+	if o == nil {
+		writeFuturesError(w, http.StatusBadRequest, reject(-2013, "Order does not exist."))
+		return
+	}
+	writeJSON(w, http.StatusOK, futuresOrderJSON(o))
+}
+
+func (s *Server) futuresCancelOrder(w http.ResponseWriter, req *futuresRequest) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	orderID, _ := strconv.ParseInt(req.params.Get("orderId"), 10, 64)
+	o := s.engine.findOrder(req.params.Get("symbol"), orderID, req.params.Get("origClientOrderId"))
+	if o == nil || !o.IsOpen() {
+		writeFuturesError(w, http.StatusBadRequest, reject(-2011, "Unknown order sent."))
+		return
+	}
+	s.engine.cancel(o)
+	writeJSON(w, http.StatusOK, futuresOrderJSON(o))
+}
+
+func (s *Server) futuresOpenOrders(w http.ResponseWriter, req *futuresRequest) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := make([]map[string]interface{}, 0)
+	for _, o := range s.engine.openOrders(req.params.Get("symbol")) {
+		result = append(result, futuresOrderJSON(o))
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+func (s *Server) futuresCancelAll(w http.ResponseWriter, req *futuresRequest) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	symbol := req.params.Get("symbol")
+	if _, ok := s.engine.symbols[symbol]; !ok {
+		writeFuturesError(w, http.StatusBadRequest, reject(-1121, "Invalid symbol."))
+		return
+	}
+	for _, o := range s.engine.openOrders(symbol) {
+		s.engine.cancel(o)
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"code": 200,
+		"msg":  "The operation of cancel all open order is done.",
+	})
+}
+
+// futuresOrderJSON 币安格式的订单响应
+func futuresOrderJSON(o *Order) map[string]interface{} {
+	timeInForce := o.TimeInForce
+	if timeInForce == "" {
+		timeInForce = "GTC"
+	}
+	return map[string]interface{}{
+		"orderId":       o.ID,
+		"symbol":        o.Symbol,
+		"status":        o.Status,
+		"clientOrderId": o.ClientOrderID,
+		"price":         formatFloat(o.Price),
+		"avgPrice":      formatFloat(o.AvgPrice),
+		"origQty":       formatFloat(o.Quantity),
+		"executedQty":   formatFloat(o.ExecutedQty),
+		"cumQty":        formatFloat(o.ExecutedQty),
+		"cumQuote":      formatFloat(o.ExecutedQty * o.AvgPrice),
+		"timeInForce":   timeInForce,
+		"type":          o.Type,
+		"origType":      o.Type,
+		"reduceOnly":    o.ReduceOnly,
+		"closePosition": o.ClosePosition,
+		"side":          o.Side,
+		"positionSide":  o.PositionSide,
+		"stopPrice":     formatFloat(o.StopPrice),
+		"workingType":   "CONTRACT_PRICE",
+		"priceProtect":  false,
+		"time":          o.UpdateTime,
+		"updateTime":    o.UpdateTime,
+	}
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// formatStep 精度对应的最小变动单位，如 3 -> "0.001"
+func formatStep(precision int) string {
+	return strconv.FormatFloat(math.Pow10(-precision), 'f', precision, 64)
+}
@@ -0,0 +1,661 @@
+package exchangesim
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	gethmath "github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+	"github.com/sonirico/go-hyperliquid"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// hlInfoRequest /info 请求体
+type hlInfoRequest struct {
+	Type string          `json:"type"`
+	User string          `json:"user"`
+	Oid  json.RawMessage `json:"oid"`
+}
+
+// hlExchangeRequest /exchange 请求体
+type hlExchangeRequest struct {
+	Action    json.RawMessage `json:"action"`
+	Nonce     int64           `json:"nonce"`
+	Signature struct {
+		R string `json:"r"`
+		S string `json:"s"`
+		V int    `json:"v"`
+	} `json:"signature"`
+	VaultAddress *string `json:"vaultAddress"`
+	ExpiresAfter *int64  `json:"expiresAfter"`
+}
+
+// handleHyperliquidInfo Hyperliquid 查询接口
+func (s *Server) handleHyperliquidInfo(w http.ResponseWriter, r *http.Request) {
+	var req hlInfoRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Failed to deserialize the JSON body", http.StatusUnprocessableEntity)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch req.Type {
+	case "meta":
+		writeJSON(w, http.StatusOK, s.hlMeta())
+	case "spotMeta":
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"universe": []interface{}{},
+			"tokens": []map[string]interface{}{
+				{"name": "USDC", "szDecimals": 8, "weiDecimals": 8, "index": 0, "tokenId": "0x6d1e7cde53ba9467b783cb7c530ce054", "isCanonical": true},
+			},
+		})
+	case "clearinghouseState":
+		writeJSON(w, http.StatusOK, s.hlClearinghouseState(req.User))
+	case "spotClearinghouseState":
+		balances := []map[string]interface{}{}
+		if s.isHyperliquidWallet(req.User) {
+			balances = append(balances, map[string]interface{}{
+				"coin":     "USDC",
+				"token":    0,
+				"hold":     "0.0",
+				"total":    formatFloat(s.engine.spotBalance),
+				"entryNtl": "0.0",
+			})
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"balances": balances})
+	case "allMids":
+		mids := make(map[string]string)
+		for _, name := range s.engine.symbolOrder {
+			mids[s.engine.symbols[name].Coin()] = formatFloat(s.engine.prices[name])
+		}
+		writeJSON(w, http.StatusOK, mids)
+	case "openOrders", "frontendOpenOrders":
+		orders := []map[string]interface{}{}
+		if s.isHyperliquidWallet(req.User) {
+			for _, o := range s.engine.openOrders("") {
+				if o.Venue == VenueHyperliquid {
+					orders = append(orders, s.hlOrderJSON(o))
+				}
+			}
+		}
+		writeJSON(w, http.StatusOK, orders)
+	case "orderStatus":
+		s.hlOrderStatus(w, req)
+	default:
+		http.Error(w, "Failed to deserialize the JSON body into the target type", http.StatusUnprocessableEntity)
+	}
+}
+
+func (s *Server) hlMeta() map[string]interface{} {
+	universe := make([]map[string]interface{}, 0, len(s.engine.symbolOrder))
+	for _, name := range s.engine.symbolOrder {
+		sym := s.engine.symbols[name]
+		universe = append(universe, map[string]interface{}{
+			"name":          sym.Coin(),
+			"szDecimals":    sym.QuantityPrecision,
+			"maxLeverage":   sym.MaxLeverage,
+			"marginTableId": sym.MaxLeverage,
+			"onlyIsolated":  false,
+			"isDelisted":    false,
+		})
+	}
+	return map[string]interface{}{"universe": universe, "marginTables": []interface{}{}}
+}
+
+// isHyperliquidWallet 是否为持有资金和持仓的地址（已注册的主钱包，或设置的子账户/Vault）
+func (s *Server) isHyperliquidWallet(addr string) bool {
+	addr = strings.ToLower(addr)
+	if s.hlVault != "" {
+		return addr == s.hlVault
+	}
+	for _, wallet := range s.hlAgents {
+		if wallet == addr {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) hlClearinghouseState(user string) map[string]interface{} {
+	emptySummary := map[string]interface{}{"accountValue": "0.0", "totalMarginUsed": "0.0", "totalNtlPos": "0.0", "totalRawUsd": "0.0"}
+	if !s.isHyperliquidWallet(user) {
+		return map[string]interface{}{
+			"assetPositions":     []interface{}{},
+			"crossMarginSummary": emptySummary,
+			"marginSummary":      emptySummary,
+			"withdrawable":       "0.0",
+			"time":               time.Now().UnixMilli(),
+		}
+	}
+
+	positions := []map[string]interface{}{}
+	var totalNtl float64
+	for _, pos := range s.engine.sortedPositions() {
+		sym := s.engine.symbols[pos.Symbol]
+		mark := s.engine.prices[pos.Symbol]
+		margin := s.engine.marginUsed(pos)
+		pnl := s.engine.unrealizedPnL(pos)
+		totalNtl += math.Abs(pos.Amount) * mark
+
+		leverageType := "cross"
+		if s.engine.isolated[pos.Symbol] {
+			leverageType = "isolated"
+		}
+		roe := 0.0
+		if margin > 0 {
+			roe = pnl / margin
+		}
+		entry := formatFloat(pos.EntryPrice)
+		liquidation := formatFloat(s.engine.liquidationPrice(pos))
+		positions = append(positions, map[string]interface{}{
+			"type": "oneWay",
+			"position": map[string]interface{}{
+				"coin":           sym.Coin(),
+				"entryPx":        entry,
+				"leverage":       map[string]interface{}{"type": leverageType, "value": s.engine.leverageOf(pos.Symbol)},
+				"liquidationPx":  liquidation,
+				"marginUsed":     formatFloat(margin),
+				"maxLeverage":    sym.MaxLeverage,
+				"positionValue":  formatFloat(math.Abs(pos.Amount) * mark),
+				"returnOnEquity": formatFloat(roe),
+				"szi":            formatFloat(pos.Amount),
+				"unrealizedPnl":  formatFloat(pnl),
+			},
+		})
+	}
+
+	unrealized, margin := s.engine.totals()
+	summary := map[string]interface{}{
+		"accountValue":    formatFloat(s.engine.balance + unrealized),
+		"totalMarginUsed": formatFloat(margin),
+		"totalNtlPos":     formatFloat(totalNtl),
+		"totalRawUsd":     formatFloat(s.engine.balance),
+	}
+	return map[string]interface{}{
+		"assetPositions":     positions,
+		"crossMarginSummary": summary,
+		"marginSummary":      summary,
+		"withdrawable":       formatFloat(math.Max(s.engine.available(), 0)),
+		"time":               time.Now().UnixMilli(),
+	}
+}
+
+func (s *Server) hlOrderJSON(o *Order) map[string]interface{} {
+	side := "B"
+	if o.Side == "SELL" {
+		side = "A"
+	}
+	price := o.Price
+	if o.IsConditional() {
+		price = o.StopPrice
+	}
+	return map[string]interface{}{
+		"coin":      s.engine.symbols[o.Symbol].Coin(),
+		"side":      side,
+		"limitPx":   formatFloat(price),
+		"oid":       o.ID,
+		"sz":        formatFloat(o.remaining()),
+		"origSz":    formatFloat(o.Quantity),
+		"timestamp": o.UpdateTime,
+	}
+}
+
+// hlOrderStatus 按 oid（数字）或 cloid（0x 开头的字符串）查询订单
+func (s *Server) hlOrderStatus(w http.ResponseWriter, req hlInfoRequest) {
+	var o *Order
+	var cloid string
+	if err := json.Unmarshal(req.Oid, &cloid); err == nil {
+		o = s.engine.findOrder("", 0, strings.ToLower(cloid))
+	} else {
+		var oid int64
+		if err := json.Unmarshal(req.Oid, &oid); err == nil {
+			o = s.engine.findOrder("", oid, "")
+		}
+	}
+	if o == nil || o.Venue != VenueHyperliquid || !s.isHyperliquidWallet(req.User) {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"status": "unknownOid"})
+		return
+	}
+
+	orderType := "Limit"
+	switch o.Type {
+	case OrderTypeStopMarket:
+		orderType = "Stop Market"
+	case OrderTypeTakeProfitMarket:
+		orderType = "Take Profit Market"
+	}
+	queried := s.hlOrderJSON(o)
+	queried["orderType"] = orderType
+	queried["reduceOnly"] = o.ReduceOnly
+	queried["isTrigger"] = o.IsConditional()
+	queried["triggerPx"] = formatFloat(o.StopPrice)
+	queried["triggerCondition"] = "N/A"
+	queried["isPositionTpsl"] = false
+	queried["children"] = []interface{}{}
+	queried["tif"] = hlTif(o.TimeInForce)
+	if o.ClientOrderID != "" {
+		queried["cloid"] = o.ClientOrderID
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"status": "order",
+		"order": map[string]interface{}{
+			"order":           queried,
+			"status":          hlOrderStatusValue(o),
+			"statusTimestamp": o.UpdateTime,
+		},
+	})
+}
+
+func hlTif(timeInForce string) string {
+	switch timeInForce {
+	case "IOC":
+		return string(hyperliquid.TifIoc)
+	case "GTX":
+		return string(hyperliquid.TifAlo)
+	}
+	return string(hyperliquid.TifGtc)
+}
+
+func hlOrderStatusValue(o *Order) string {
+	switch o.Status {
+	case StatusNew, StatusPartiallyFilled:
+		return string(hyperliquid.OrderStatusValueOpen)
+	case StatusFilled:
+		if o.IsConditional() {
+			return string(hyperliquid.OrderStatusValueTriggered)
+		}
+		return string(hyperliquid.OrderStatusValueFilled)
+	case StatusRejected:
+		return string(hyperliquid.OrderStatusValueRejected)
+	}
+	if o.ExecutedQty > 0 {
+		// IOC 部分成交后剩余部分过期，Hyperliquid 视为已成交
+		return string(hyperliquid.OrderStatusValueFilled)
+	}
+	return string(hyperliquid.OrderStatusValueCanceled)
+}
+
+// handleHyperliquidExchange Hyperliquid 交易接口（L1 action，需 Agent 钱包签名）
+func (s *Server) handleHyperliquidExchange(w http.ResponseWriter, r *http.Request) {
+	var req hlExchangeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Failed to deserialize the JSON body", http.StatusUnprocessableEntity)
+		return
+	}
+
+	var head struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(req.Action, &head); err != nil {
+		http.Error(w, "Failed to deserialize the JSON body", http.StatusUnprocessableEntity)
+		return
+	}
+
+	var action interface{}
+	switch head.Type {
+	case "order":
+		var a hyperliquid.OrderAction
+		if err := json.Unmarshal(req.Action, &a); err != nil {
+			http.Error(w, "Failed to deserialize the JSON body", http.StatusUnprocessableEntity)
+			return
+		}
+		action = a
+	case "cancel":
+		var a hyperliquid.CancelAction
+		if err := json.Unmarshal(req.Action, &a); err != nil {
+			http.Error(w, "Failed to deserialize the JSON body", http.StatusUnprocessableEntity)
+			return
+		}
+		action = a
+	case "updateLeverage":
+		var a hyperliquid.UpdateLeverageAction
+		if err := json.Unmarshal(req.Action, &a); err != nil {
+			http.Error(w, "Failed to deserialize the JSON body", http.StatusUnprocessableEntity)
+			return
+		}
+		action = a
+	default:
+		writeHLError(w, fmt.Sprintf("Unsupported action type: %s", head.Type))
+		return
+	}
+
+	signer, err := recoverL1Signer(action, req)
+	if err != nil {
+		writeHLError(w, fmt.Sprintf("Invalid signature: %v", err))
+		return
+	}
+	s.mu.Lock()
+	wallet, ok := s.hlAgents[strings.ToLower(signer)]
+	vaultErr := s.hlCheckVault(wallet, req.VaultAddress)
+	s.mu.Unlock()
+	if !ok {
+		writeHLError(w, fmt.Sprintf("User or API Wallet %s does not exist.", strings.ToLower(signer)))
+		return
+	}
+	if vaultErr != "" {
+		writeHLError(w, vaultErr)
+		return
+	}
+
+	switch a := action.(type) {
+	case hyperliquid.OrderAction:
+		s.hlPlaceOrders(w, a)
+	case hyperliquid.CancelAction:
+		s.hlCancelOrders(w, a)
+	case hyperliquid.UpdateLeverageAction:
+		s.hlUpdateLeverage(w, a)
+	}
+}
+
+// hlCheckVault 校验交易目标账户：带 vaultAddress 时必须是由该主钱包管理的子账户/Vault（调用方持有锁）
+func (s *Server) hlCheckVault(wallet string, vaultAddress *string) string {
+	if vaultAddress == nil || *vaultAddress == "" {
+		if s.hlVault != "" {
+			return fmt.Sprintf("User %s has no margin; trading account is vault %s.", wallet, s.hlVault)
+		}
+		return ""
+	}
+	vault := strings.ToLower(*vaultAddress)
+	if vault != s.hlVault {
+		return fmt.Sprintf("Vault %s does not exist.", vault)
+	}
+	if wallet != s.hlVaultMaster {
+		return fmt.Sprintf("User %s is not authorized to trade on behalf of %s.", wallet, vault)
+	}
+	return ""
+}
+
+func (s *Server) hlPlaceOrders(w http.ResponseWriter, action hyperliquid.OrderAction) {
+	statuses := make([]map[string]interface{}, 0, len(action.Orders))
+	for _, wire := range action.Orders {
+		status, timeout := s.hlPlaceOrder(wire)
+		if timeout {
+			// 网关超时：订单可能已被接受
+			http.Error(w, "Gateway Timeout", http.StatusGatewayTimeout)
+			return
+		}
+		statuses = append(statuses, status)
+	}
+	writeHLOK(w, "order", map[string]interface{}{"statuses": statuses})
+}
+
+// hlPlaceOrder 处理单笔订单，返回 Hyperliquid 订单状态（resting / filled / error）
+func (s *Server) hlPlaceOrder(wire hyperliquid.OrderWire) (map[string]interface{}, bool) {
+	s.mu.Lock()
+	sym := s.engine.symbolByAsset(wire.Asset)
+	s.mu.Unlock()
+	if sym == nil {
+		return hlStatusError(fmt.Sprintf("Invalid asset: %d", wire.Asset)), false
+	}
+
+	o := &Order{
+		Venue:        VenueHyperliquid,
+		Symbol:       sym.Name,
+		Side:         "BUY",
+		PositionSide: "BOTH",
+		ReduceOnly:   wire.ReduceOnly,
+	}
+	if !wire.IsBuy {
+		o.Side = "SELL"
+	}
+	if wire.Cloid != nil {
+		o.ClientOrderID = strings.ToLower(*wire.Cloid)
+	}
+	o.Quantity, _ = strconv.ParseFloat(wire.Size, 64)
+	o.Price, _ = strconv.ParseFloat(wire.LimitPx, 64)
+
+	switch {
+	case wire.OrderType.Trigger != nil:
+		o.Type = OrderTypeStopMarket
+		if wire.OrderType.Trigger.Tpsl == hyperliquid.TakeProfit {
+			o.Type = OrderTypeTakeProfitMarket
+		}
+		o.StopPrice, _ = strconv.ParseFloat(wire.OrderType.Trigger.TriggerPx, 64)
+	case wire.OrderType.Limit != nil:
+		o.Type = OrderTypeLimit
+		switch wire.OrderType.Limit.Tif {
+		case hyperliquid.TifIoc:
+			o.TimeInForce = "IOC"
+		case hyperliquid.TifAlo:
+			o.TimeInForce = "GTX"
+		default:
+			o.TimeInForce = "GTC"
+		}
+	default:
+		return hlStatusError("Invalid order type."), false
+	}
+
+	outcome := s.submitOrder(o, func(e *engine) *rejectError {
+		if !hlPriceValid(wire.LimitPx, sym.QuantityPrecision) ||
+			(o.IsConditional() && !hlPriceValid(wire.OrderType.Trigger.TriggerPx, sym.QuantityPrecision)) {
+			return &rejectError{code: -4014, msg: "Price not increased by tick size.", hlMsg: "Order has invalid price."}
+		}
+		if o.ClientOrderID != "" {
+			if existing := e.findOrder("", 0, o.ClientOrderID); existing != nil {
+				return &rejectError{code: -4116, msg: "ClientOrderId is duplicated.", hlMsg: "Duplicate cloid."}
+			}
+		}
+		return nil
+	})
+
+	switch {
+	case outcome.failed:
+		return nil, true
+	case outcome.rejected != nil:
+		return hlStatusError(outcome.rejected.hlMsg), false
+	}
+
+	placed := outcome.order
+	if placed.Status == StatusExpired && placed.ExecutedQty == 0 {
+		return hlStatusError(fmt.Sprintf("Order could not immediately match against any resting orders. asset=%d", wire.Asset)), false
+	}
+	if placed.ExecutedQty > 0 {
+		return map[string]interface{}{
+			"filled": map[string]interface{}{
+				"totalSz": formatFloat(placed.ExecutedQty),
+				"avgPx":   formatFloat(placed.AvgPrice),
+				"oid":     placed.ID,
+			},
+		}, false
+	}
+	resting := map[string]interface{}{"oid": placed.ID}
+	if placed.ClientOrderID != "" {
+		resting["cloid"] = placed.ClientOrderID
+	}
+	return map[string]interface{}{"resting": resting}, false
+}
+
+func (s *Server) hlCancelOrders(w http.ResponseWriter, action hyperliquid.CancelAction) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	statuses := make([]interface{}, 0, len(action.Cancels))
+	for _, c := range action.Cancels {
+		o := s.engine.findOrder("", c.OrderID, "")
+		if o == nil || !o.IsOpen() || o.Venue != VenueHyperliquid {
+			statuses = append(statuses, hlStatusError(fmt.Sprintf("Order was never placed, already canceled, or filled. asset=%d", c.Asset)))
+			continue
+		}
+		s.engine.cancel(o)
+		statuses = append(statuses, "success")
+	}
+	writeHLOK(w, "cancel", map[string]interface{}{"statuses": statuses})
+}
+
+func (s *Server) hlUpdateLeverage(w http.ResponseWriter, action hyperliquid.UpdateLeverageAction) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sym := s.engine.symbolByAsset(action.Asset)
+	if sym == nil {
+		writeHLError(w, fmt.Sprintf("Invalid asset: %d", action.Asset))
+		return
+	}
+	if action.Leverage < 1 || action.Leverage > sym.MaxLeverage {
+		writeHLError(w, "Invalid leverage value")
+		return
+	}
+	s.engine.leverage[sym.Name] = action.Leverage
+	s.engine.isolated[sym.Name] = !action.IsCross
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"status":   "ok",
+		"response": map[string]interface{}{"type": "default"},
+	})
+}
+
+func writeHLOK(w http.ResponseWriter, responseType string, data interface{}) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"status":   "ok",
+		"response": map[string]interface{}{"type": responseType, "data": data},
+	})
+}
+
+func writeHLError(w http.ResponseWriter, msg string) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{"status": "err", "response": msg})
+}
+
+func hlStatusError(msg string) map[string]interface{} {
+	return map[string]interface{}{"error": msg}
+}
+
+// hlPriceValid Hyperliquid 价格规则：最多5位有效数字，且小数位不超过 6-szDecimals（整数价格总是合法）
+func hlPriceValid(px string, szDecimals int) bool {
+	value, err := strconv.ParseFloat(px, 64)
+	if err != nil || value <= 0 {
+		return false
+	}
+	if value == math.Trunc(value) {
+		return true
+	}
+
+	intPart, fracPart, _ := strings.Cut(px, ".")
+	fracPart = strings.TrimRight(fracPart, "0")
+	if len(fracPart) > 6-szDecimals {
+		return false
+	}
+	digits := strings.TrimLeft(intPart+fracPart, "0")
+	return len(digits) <= 5
+}
+
+// recoverL1Signer 按 Hyperliquid L1 action 签名规则恢复签名地址
+// actionHash = keccak256(msgpack(action) + nonce + vault [+ expiresAfter])，
+// 再作为 phantom agent 的 connectionId 进行 EIP-712 签名（测试网 source = "b"）
+func recoverL1Signer(action interface{}, req hlExchangeRequest) (string, error) {
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.UseCompactInts(true)
+	if err := enc.Encode(action); err != nil {
+		return "", err
+	}
+	data := convertStr16ToStr8(buf.Bytes())
+
+	nonce := make([]byte, 8)
+	binary.BigEndian.PutUint64(nonce, uint64(req.Nonce))
+	data = append(data, nonce...)
+	if req.VaultAddress == nil || *req.VaultAddress == "" {
+		data = append(data, 0x00)
+	} else {
+		vault, err := hex.DecodeString(strings.TrimPrefix(*req.VaultAddress, "0x"))
+		if err != nil {
+			return "", err
+		}
+		data = append(data, 0x01)
+		data = append(data, vault...)
+	}
+	if req.ExpiresAfter != nil {
+		expires := make([]byte, 8)
+		binary.BigEndian.PutUint64(expires, uint64(*req.ExpiresAfter))
+		data = append(data, 0x00)
+		data = append(data, expires...)
+	}
+	connectionID := crypto.Keccak256(data)
+
+	chainID := gethmath.HexOrDecimal256(*big.NewInt(1337))
+	typedData := apitypes.TypedData{
+		Domain: apitypes.TypedDataDomain{
+			ChainId:           &chainID,
+			Name:              "Exchange",
+			Version:           "1",
+			VerifyingContract: "0x0000000000000000000000000000000000000000",
+		},
+		Types: apitypes.Types{
+			"Agent": []apitypes.Type{
+				{Name: "source", Type: "string"},
+				{Name: "connectionId", Type: "bytes32"},
+			},
+			"EIP712Domain": []apitypes.Type{
+				{Name: "name", Type: "string"},
+				{Name: "version", Type: "string"},
+				{Name: "chainId", Type: "uint256"},
+				{Name: "verifyingContract", Type: "address"},
+			},
+		},
+		PrimaryType: "Agent",
+		Message:     map[string]interface{}{"source": "b", "connectionId": connectionID},
+	}
+	domainSeparator, err := typedData.HashStruct("EIP712Domain", typedData.Domain.Map())
+	if err != nil {
+		return "", err
+	}
+	messageHash, err := typedData.HashStruct("Agent", typedData.Message)
+	if err != nil {
+		return "", err
+	}
+	raw := append([]byte{0x19, 0x01}, domainSeparator...)
+	digest := crypto.Keccak256(append(raw, messageHash...))
+
+	r, err := hexutil.DecodeBig(req.Signature.R)
+	if err != nil {
+		return "", err
+	}
+	sv, err := hexutil.DecodeBig(req.Signature.S)
+	if err != nil {
+		return "", err
+	}
+	sig := make([]byte, 65)
+	r.FillBytes(sig[:32])
+	sv.FillBytes(sig[32:64])
+	sig[64] = byte(req.Signature.V - 27)
+
+	pub, err := crypto.SigToPub(digest, sig)
+	if err != nil {
+		return "", err
+	}
+	return crypto.PubkeyToAddress(*pub).Hex(), nil
+}
+
+// convertStr16ToStr8 与 SDK 一致：将长度小于256的 msgpack str16 转为 str8（兼容 Python msgpack）
+func convertStr16ToStr8(data []byte) []byte {
+	result := make([]byte, 0, len(data))
+	for i := 0; i < len(data); {
+		if data[i] == 0xda && i+2 < len(data) {
+			length := int(data[i+1])<<8 | int(data[i+2])
+			if length < 256 {
+				result = append(result, 0xd9, byte(length))
+				i += 3
+				if i+length <= len(data) {
+					result = append(result, data[i:i+length]...)
+					i += length
+				}
+				continue
+			}
+		}
+		result = append(result, data[i])
+		i++
+	}
+	return result
+}
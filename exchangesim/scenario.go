@@ -0,0 +1,161 @@
+package exchangesim
+
+import (
+	"strings"
+	"time"
+)
+
+// ruleAction 场景规则对订单的处理方式
+type ruleAction int
+
+const (
+	actionFill             ruleAction = iota // 按正常撮合处理（默认）
+	actionPartialFill                        // 只成交一部分，剩余按订单类型过期或挂单
+	actionReject                             // 交易所拒单
+	actionRest                               // 挂单不成交（直到后续价格变动），市价/IOC 单直接过期
+	actionAcceptThenFail                     // 订单已被接受，但响应失败（模拟超时，状态不明）
+	actionFailBeforeAccept                   // 请求失败，订单未到达撮合引擎
+)
+
+// Rule 订单场景规则
+// 每条规则匹配下一笔满足条件的新订单，并决定其处理结果，用法示例：
+//
+//	sim.Script(
+//		exchangesim.NextOrder().ForSymbol("BTCUSDT").Reject(-2019, "Margin is insufficient."),
+//		exchangesim.NextOrder().PartialFill(0.5),
+//		exchangesim.NextOrder().Delay(200*time.Millisecond).AcceptThenFail(),
+//	)
+//
+// 规则按添加顺序匹配，默认只生效一次（可用 Times/Always 修改）
+type Rule struct {
+	venue     Venue
+	symbol    string
+	side      string
+	orderType string
+
+	action  ruleAction
+	ratio   float64
+	code    int
+	message string
+	delay   time.Duration
+	times   int // 剩余生效次数，<0 表示一直生效
+}
+
+// NextOrder 创建一条匹配下一笔订单的规则（默认正常成交）
+func NextOrder() *Rule {
+	return &Rule{action: actionFill, times: 1}
+}
+
+// OnVenue 只匹配指定交易所协议的订单
+func (r *Rule) OnVenue(venue Venue) *Rule {
+	r.venue = venue
+	return r
+}
+
+// ForSymbol 只匹配指定交易对（币安格式，如 BTCUSDT）
+func (r *Rule) ForSymbol(symbol string) *Rule {
+	r.symbol = strings.ToUpper(symbol)
+	return r
+}
+
+// WithSide 只匹配指定方向（BUY / SELL）
+func (r *Rule) WithSide(side string) *Rule {
+	r.side = strings.ToUpper(side)
+	return r
+}
+
+// OfType 只匹配指定订单类型（MARKET / LIMIT / STOP_MARKET / TAKE_PROFIT_MARKET）
+func (r *Rule) OfType(orderType string) *Rule {
+	r.orderType = strings.ToUpper(orderType)
+	return r
+}
+
+// Fill 正常撮合成交
+func (r *Rule) Fill() *Rule {
+	r.action = actionFill
+	return r
+}
+
+// PartialFill 只成交 ratio 比例（0~1）的数量
+func (r *Rule) PartialFill(ratio float64) *Rule {
+	r.action = actionPartialFill
+	r.ratio = ratio
+	return r
+}
+
+// Reject 拒单，code/message 按币安格式返回（Hyperliquid 只使用 message）
+func (r *Rule) Reject(code int, message string) *Rule {
+	r.action = actionReject
+	r.code = code
+	r.message = message
+	return r
+}
+
+// Rest 订单挂单不成交（市价单和 IOC 单直接过期）
+func (r *Rule) Rest() *Rule {
+	r.action = actionRest
+	return r
+}
+
+// AcceptThenFail 订单被交易所接受并撮合，但响应返回超时错误
+func (r *Rule) AcceptThenFail() *Rule {
+	r.action = actionAcceptThenFail
+	return r
+}
+
+// FailBeforeAccept 请求返回超时错误，订单没有到达交易所
+func (r *Rule) FailBeforeAccept() *Rule {
+	r.action = actionFailBeforeAccept
+	return r
+}
+
+// Delay 处理订单前等待指定时间（模拟延迟）
+func (r *Rule) Delay(d time.Duration) *Rule {
+	r.delay = d
+	return r
+}
+
+// Times 规则生效次数
+func (r *Rule) Times(n int) *Rule {
+	r.times = n
+	return r
+}
+
+// Always 规则一直生效
+func (r *Rule) Always() *Rule {
+	r.times = -1
+	return r
+}
+
+func (r *Rule) matches(o *Order) bool {
+	if r.venue != "" && r.venue != o.Venue {
+		return false
+	}
+	if r.symbol != "" && r.symbol != o.Symbol {
+		return false
+	}
+	if r.side != "" && r.side != o.Side {
+		return false
+	}
+	if r.orderType != "" && r.orderType != o.Type {
+		return false
+	}
+	return true
+}
+
+// takeRule 取出第一条匹配订单的规则（生效次数用尽后移除）
+func (s *Server) takeRule(o *Order) *Rule {
+	for i, r := range s.rules {
+		if !r.matches(o) {
+			continue
+		}
+		if r.times > 0 {
+			r.times--
+			if r.times == 0 {
+				s.rules = append(s.rules[:i], s.rules[i+1:]...)
+			}
+		}
+		return r
+	}
+	return NextOrder()
+}
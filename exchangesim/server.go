@@ -0,0 +1,301 @@
+// Package exchangesim 进程内模拟交易所，用于集成测试
+//
+// 一个 Server 同时实现了币安合约（/fapi/v1、/fapi/v2）、Aster（/fapi/v3）和
+// Hyperliquid（/info、/exchange）的 REST 协议，以及币安风格的组合流 WebSocket（/stream）。
+// 所有签名请求都会按各交易所的规则验签，订单在内存撮合引擎中成交，
+// 支持止损/止盈条件单、持仓、杠杆和保证金模式，并可通过场景规则（Rule）注入
+// 部分成交、拒单、超时和延迟。
+package exchangesim
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Server 模拟交易所服务器
+type Server struct {
+	mu      sync.Mutex
+	engine  *engine
+	rules   []*Rule
+	latency time.Duration
+
+	binanceKeys  map[string]string // apiKey -> secretKey
+	asterSigners map[string]string // user(小写) -> signer(小写)
+	hlAgents     map[string]string // agent(小写) -> 主钱包(小写)
+
+	// Hyperliquid 子账户/Vault：设置后模拟账户归属该地址，只能由 hlVaultMaster 的 Agent 通过 vaultAddress 交易
+	hlVault       string
+	hlVaultMaster string
+
+	hub        *wsHub
+	httpServer *httptest.Server
+}
+
+// NewServer 创建并启动模拟交易所（默认上架 DefaultSymbols，账户余额 10000）
+func NewServer() *Server {
+	s := &Server{
+		engine:       newEngine(),
+		binanceKeys:  make(map[string]string),
+		asterSigners: make(map[string]string),
+		hlAgents:     make(map[string]string),
+		hub:          newWSHub(),
+	}
+	s.engine.balance = 10000
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/fapi/", s.withLatency(s.handleFutures))
+	mux.HandleFunc("/info", s.withLatency(s.handleHyperliquidInfo))
+	mux.HandleFunc("/exchange", s.withLatency(s.handleHyperliquidExchange))
+	mux.HandleFunc("/stream", s.handleWebSocket)
+	mux.HandleFunc("/ws", s.handleWebSocket)
+
+	s.httpServer = httptest.NewServer(mux)
+	return s
+}
+
+// URL REST 接口地址（可直接作为币安 BaseURL、Aster baseURL 或 Hyperliquid API URL）
+func (s *Server) URL() string {
+	return s.httpServer.URL
+}
+
+// WebSocketURL 组合流 WebSocket 地址
+func (s *Server) WebSocketURL() string {
+	return "ws" + strings.TrimPrefix(s.httpServer.URL, "http") + "/stream"
+}
+
+// Client 返回连接到模拟交易所的 HTTP 客户端
+func (s *Server) Client() *http.Client {
+	return s.httpServer.Client()
+}
+
+// Close 关闭服务器和所有 WebSocket 连接
+func (s *Server) Close() {
+	s.hub.closeAll()
+	s.httpServer.Close()
+}
+
+// DropWebSockets 断开所有 WebSocket 连接但保持服务运行（模拟网络闪断，测试重连和重新订阅）
+func (s *Server) DropWebSockets() {
+	s.hub.closeAll()
+}
+
+// AddSymbol 上架（或覆盖）一个合约
+func (s *Server) AddSymbol(sym Symbol) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.engine.addSymbol(sym)
+}
+
+// SetBalance 设置合约账户钱包余额（USDT/USDC 通用）
+func (s *Server) SetBalance(balance float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.engine.balance = balance
+}
+
+// SetSpotBalance 设置 Hyperliquid 现货账户 USDC 余额
+func (s *Server) SetSpotBalance(balance float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.engine.spotBalance = balance
+}
+
+// SetLatency 设置所有 REST 请求的固定延迟
+func (s *Server) SetLatency(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.latency = d
+}
+
+// SetPrice 更新标记价格：触发条件单、成交可成交的限价挂单，并推送 WebSocket 行情
+func (s *Server) SetPrice(symbol string, price float64) {
+	s.mu.Lock()
+	s.engine.setPrice(symbol, price)
+	s.mu.Unlock()
+
+	s.hub.publishPrice(symbol, price, time.Now())
+}
+
+// Price 当前标记价格
+func (s *Server) Price(symbol string) float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.engine.prices[symbol]
+}
+
+// Script 追加场景规则
+func (s *Server) Script(rules ...*Rule) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rules = append(s.rules, rules...)
+}
+
+// PendingRules 尚未用完的场景规则数量
+func (s *Server) PendingRules() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.rules)
+}
+
+// AddBinanceAPIKey 注册币安 API Key（HMAC 签名）
+func (s *Server) AddBinanceAPIKey(apiKey, secretKey string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.binanceKeys[apiKey] = secretKey
+}
+
+// AddAsterSigner 注册 Aster 主钱包及其授权的签名地址
+func (s *Server) AddAsterSigner(user, signer string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.asterSigners[strings.ToLower(user)] = strings.ToLower(signer)
+}
+
+// AddHyperliquidAgent 注册 Hyperliquid 主钱包及其授权的 Agent 钱包
+func (s *Server) AddHyperliquidAgent(wallet, agent string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hlAgents[strings.ToLower(agent)] = strings.ToLower(wallet)
+}
+
+// SetHyperliquidVault 将模拟账户（余额、持仓、订单）归属到 Hyperliquid 子账户/Vault
+// 之后只有 master 主钱包授权的 Agent 在请求中带上 vaultAddress 才能交易，查询也只对该地址返回数据
+func (s *Server) SetHyperliquidVault(vault, master string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hlVault = strings.ToLower(vault)
+	s.hlVaultMaster = strings.ToLower(master)
+}
+
+// Balance 合约账户钱包余额（不含未实现盈亏）
+func (s *Server) Balance() float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.engine.balance
+}
+
+// DualSidePosition 是否为双向持仓模式
+func (s *Server) DualSidePosition() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.engine.dualSide
+}
+
+// Leverage 交易对当前杠杆
+func (s *Server) Leverage(symbol string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.engine.leverageOf(symbol)
+}
+
+// IsolatedMargin 交易对是否为逐仓模式
+func (s *Server) IsolatedMargin(symbol string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.engine.isolated[symbol]
+}
+
+// Orders 所有订单快照（按下单顺序）
+func (s *Server) Orders() []Order {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	result := make([]Order, 0, len(s.engine.orders))
+	for _, o := range s.engine.orders {
+		result = append(result, *o)
+	}
+	return result
+}
+
+// OpenOrders 挂单快照（symbol 为空表示全部）
+func (s *Server) OpenOrders(symbol string) []Order {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var result []Order
+	for _, o := range s.engine.openOrders(symbol) {
+		result = append(result, *o)
+	}
+	return result
+}
+
+// Position 持仓快照（positionSide: LONG / SHORT / BOTH）
+func (s *Server) Position(symbol, positionSide string) Position {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return *s.engine.position(symbol, positionSide)
+}
+
+// Fills 成交记录
+func (s *Server) Fills() []Fill {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Fill(nil), s.engine.fills...)
+}
+
+// orderOutcome 下单处理结果
+type orderOutcome struct {
+	order    Order
+	rejected *rejectError
+	failed   bool // 响应失败（订单可能已被接受，见 accepted）
+	accepted bool
+}
+
+// submitOrder 按场景规则处理新订单
+// precheck 在加锁状态下执行交易所特有的校验（如持仓模式、重复 clientOrderId）
+func (s *Server) submitOrder(o *Order, precheck func(e *engine) *rejectError) orderOutcome {
+	s.mu.Lock()
+	rule := s.takeRule(o)
+	s.mu.Unlock()
+
+	if rule.delay > 0 {
+		time.Sleep(rule.delay)
+	}
+
+	switch rule.action {
+	case actionFailBeforeAccept:
+		return orderOutcome{failed: true}
+	case actionReject:
+		return orderOutcome{rejected: reject(rule.code, rule.message)}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if precheck != nil {
+		if rej := precheck(s.engine); rej != nil {
+			return orderOutcome{rejected: rej}
+		}
+	}
+	if rej := s.engine.validate(o); rej != nil {
+		return orderOutcome{rejected: rej}
+	}
+
+	placed := s.engine.place(o, rule.action, rule.ratio)
+	return orderOutcome{
+		order:    *placed,
+		accepted: true,
+		failed:   rule.action == actionAcceptThenFail,
+	}
+}
+
+// withLatency 为 REST 请求增加固定延迟
+func (s *Server) withLatency(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		latency := s.latency
+		s.mu.Unlock()
+		if latency > 0 {
+			time.Sleep(latency)
+		}
+		next(w, r)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,252 @@
+package exchangesim
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// K线周期（币安命名）
+var klineIntervals = map[string]time.Duration{
+	"1m":  time.Minute,
+	"3m":  3 * time.Minute,
+	"5m":  5 * time.Minute,
+	"15m": 15 * time.Minute,
+	"30m": 30 * time.Minute,
+	"1h":  time.Hour,
+	"2h":  2 * time.Hour,
+	"4h":  4 * time.Hour,
+	"6h":  6 * time.Hour,
+	"8h":  8 * time.Hour,
+	"12h": 12 * time.Hour,
+	"1d":  24 * time.Hour,
+}
+
+var upgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// wsClient 一个 WebSocket 连接及其订阅的流
+type wsClient struct {
+	conn    *websocket.Conn
+	writeMu sync.Mutex
+	streams map[string]bool
+}
+
+func (c *wsClient) send(v interface{}) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return c.conn.WriteJSON(v)
+}
+
+// candle 推送中的当前K线
+type candle struct {
+	openTime int64
+	open     float64
+	high     float64
+	low      float64
+	close    float64
+	trades   int64
+}
+
+// wsHub 管理 WebSocket 连接，按币安组合流格式推送行情
+type wsHub struct {
+	mu      sync.Mutex
+	clients map[*wsClient]bool
+	candles map[string]*candle // key: stream 名称
+}
+
+func newWSHub() *wsHub {
+	return &wsHub{
+		clients: make(map[*wsClient]bool),
+		candles: make(map[string]*candle),
+	}
+}
+
+// handleWebSocket 币安组合流协议：SUBSCRIBE / UNSUBSCRIBE / LIST_SUBSCRIPTIONS
+// 也支持在 URL 中直接指定流：/stream?streams=btcusdt@kline_3m/ethusdt@markPrice
+func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+
+	client := &wsClient{conn: conn, streams: make(map[string]bool)}
+	if streams := r.URL.Query().Get("streams"); streams != "" {
+		for _, stream := range strings.Split(streams, "/") {
+			client.streams[strings.ToLower(stream)] = true
+		}
+	}
+	s.hub.add(client)
+	defer s.hub.remove(client)
+
+	for {
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		var req struct {
+			Method string   `json:"method"`
+			Params []string `json:"params"`
+			ID     int64    `json:"id"`
+		}
+		if err := json.Unmarshal(message, &req); err != nil {
+			client.send(map[string]interface{}{"error": map[string]interface{}{"code": 3, "msg": "Invalid JSON"}, "id": nil})
+			continue
+		}
+
+		switch req.Method {
+		case "SUBSCRIBE":
+			s.hub.subscribe(client, req.Params, true)
+			client.send(map[string]interface{}{"result": nil, "id": req.ID})
+		case "UNSUBSCRIBE":
+			s.hub.subscribe(client, req.Params, false)
+			client.send(map[string]interface{}{"result": nil, "id": req.ID})
+		case "LIST_SUBSCRIPTIONS":
+			client.send(map[string]interface{}{"result": s.hub.list(client), "id": req.ID})
+		default:
+			client.send(map[string]interface{}{"error": map[string]interface{}{"code": 2, "msg": "Invalid request"}, "id": req.ID})
+		}
+	}
+}
+
+func (h *wsHub) add(c *wsClient) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.clients[c] = true
+}
+
+func (h *wsHub) remove(c *wsClient) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.clients, c)
+	c.conn.Close()
+}
+
+func (h *wsHub) subscribe(c *wsClient, streams []string, on bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, stream := range streams {
+		if on {
+			c.streams[strings.ToLower(stream)] = true
+		} else {
+			delete(c.streams, strings.ToLower(stream))
+		}
+	}
+}
+
+func (h *wsHub) list(c *wsClient) []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	result := make([]string, 0, len(c.streams))
+	for stream := range c.streams {
+		result = append(result, stream)
+	}
+	return result
+}
+
+// closeAll 断开所有连接（客户端会收到读错误，可用于测试重连）
+func (h *wsHub) closeAll() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for c := range h.clients {
+		c.conn.Close()
+		delete(h.clients, c)
+	}
+}
+
+// publishPrice 向订阅了该交易对 K线 / 标记价格流的连接推送最新价格
+func (h *wsHub) publishPrice(symbol string, price float64, now time.Time) {
+	h.mu.Lock()
+	type delivery struct {
+		client *wsClient
+		msg    map[string]interface{}
+	}
+	var deliveries []delivery
+	prefix := strings.ToLower(symbol) + "@"
+	for c := range h.clients {
+		for stream := range c.streams {
+			if !strings.HasPrefix(stream, prefix) {
+				continue
+			}
+			var data map[string]interface{}
+			kind := strings.TrimPrefix(stream, prefix)
+			switch {
+			case strings.HasPrefix(kind, "kline_"):
+				interval := strings.TrimPrefix(kind, "kline_")
+				if _, ok := klineIntervals[interval]; !ok {
+					continue
+				}
+				data = h.klineEvent(stream, symbol, interval, price, now)
+			case strings.HasPrefix(kind, "markprice"):
+				data = map[string]interface{}{
+					"e": "markPriceUpdate",
+					"E": now.UnixMilli(),
+					"s": symbol,
+					"p": formatFloat(price),
+					"i": formatFloat(price),
+					"r": "0.00010000",
+					"T": now.Add(8 * time.Hour).Truncate(8 * time.Hour).UnixMilli(),
+				}
+			default:
+				continue
+			}
+			deliveries = append(deliveries, delivery{client: c, msg: map[string]interface{}{"stream": stream, "data": data}})
+		}
+	}
+	h.mu.Unlock()
+
+	for _, d := range deliveries {
+		d.client.send(d.msg)
+	}
+}
+
+// klineEvent 更新该流的当前K线并生成推送事件（调用方持有锁）
+func (h *wsHub) klineEvent(stream, symbol, interval string, price float64, now time.Time) map[string]interface{} {
+	period := klineIntervals[interval]
+	openTime := now.Truncate(period).UnixMilli()
+
+	k, ok := h.candles[stream]
+	if !ok || k.openTime != openTime {
+		k = &candle{openTime: openTime, open: price, high: price, low: price}
+		h.candles[stream] = k
+	}
+	k.close = price
+	if price > k.high {
+		k.high = price
+	}
+	if price < k.low {
+		k.low = price
+	}
+	k.trades++
+
+	return map[string]interface{}{
+		"e": "kline",
+		"E": now.UnixMilli(),
+		"s": symbol,
+		"k": map[string]interface{}{
+			"t": k.openTime,
+			"T": k.openTime + period.Milliseconds() - 1,
+			"s": symbol,
+			"i": interval,
+			"f": 0,
+			"L": k.trades,
+			"o": formatFloat(k.open),
+			"c": formatFloat(k.close),
+			"h": formatFloat(k.high),
+			"l": formatFloat(k.low),
+			"v": "1",
+			"n": k.trades,
+			"x": false,
+			"q": formatFloat(price),
+			"V": "0.5",
+			"Q": formatFloat(price / 2),
+			"B": "0",
+		},
+	}
+}
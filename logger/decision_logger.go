@@ -7,6 +7,7 @@ import (
 	"math"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 )
 
@@ -27,6 +28,71 @@ type DecisionRecord struct {
 	ErrorMessage   string             `json:"error_message"`   // 错误信息（如果有）
 	// AIRequestDurationMs 记录 AI API 调用耗时（毫秒），方便评估调用性能
 	AIRequestDurationMs int64 `json:"ai_request_duration_ms,omitempty"`
+	// PromptTemplate/PromptTemplateVersion 生成系统提示词的模板及版本（用户模板版本从1开始，prompts/ 目录的模板为0）
+	PromptTemplate        string `json:"prompt_template,omitempty"`
+	PromptTemplateVersion int    `json:"prompt_template_version,omitempty"`
+	// ToolCalls 代理模式下AI的完整工具调用记录（按调用顺序）
+	ToolCalls []ToolCallRecord `json:"tool_calls,omitempty"`
+	// RiskReview 第二阶段风控审核（SystemPrompt/InputPrompt/CoTTrace/DecisionJSON 为第一阶段交易分析师的记录）
+	RiskReview *RiskReviewRecord `json:"risk_review,omitempty"`
+	// AIUsage 本周期所有AI调用（决策、修正、工具轮次、风控审核、复盘）的token用量和费用
+	AIUsage *AIUsageRecord `json:"ai_usage,omitempty"`
+	// PromptBudget User Prompt 的token预算，以及因超出模型上下文窗口压缩的序列和省略的候选币种
+	PromptBudget *PromptBudgetRecord `json:"prompt_budget,omitempty"`
+}
+
+// PromptBudgetRecord 一个周期的 prompt token预算和压缩情况
+type PromptBudgetRecord struct {
+	ContextWindow     int      `json:"context_window"`               // 模型上下文窗口
+	MaxOutputTokens   int      `json:"max_output_tokens"`            // AI响应的最大token数
+	InputBudget       int      `json:"input_budget"`                 // 可用于 System + User Prompt 的token
+	EstimatedTokens   int      `json:"estimated_tokens"`             // 最终 prompt 的估算token数
+	SeriesDetail      string   `json:"series_detail"`                // 序列详细程度：full/downsampled/summary
+	Candidates        int      `json:"candidates"`                   // 提供了市场数据的候选币种数量
+	DroppedCandidates []string `json:"dropped_candidates,omitempty"` // 因超出预算省略的候选币种
+	OverBudget        bool     `json:"over_budget,omitempty"`        // 压缩到最小后仍超出预算
+}
+
+// AIUsageRecord 一个周期的AI token用量和费用
+type AIUsageRecord struct {
+	Model            string  `json:"model"`                     // 本周期使用的模型
+	Calls            int     `json:"calls"`                     // AI调用次数
+	PromptTokens     int     `json:"prompt_tokens"`             // 输入token
+	CompletionTokens int     `json:"completion_tokens"`         // 输出token
+	CostUSD          float64 `json:"cost_usd"`                  // 按模型价格计算的费用（美元）
+	BudgetFallback   bool    `json:"budget_fallback,omitempty"` // 是否因超出每日预算改用备用模型
+}
+
+// ToolCallRecord 代理模式下的一次工具调用
+type ToolCallRecord struct {
+	Round      int    `json:"round"`           // 第几轮AI请求
+	Name       string `json:"name"`            // 工具名
+	Arguments  string `json:"arguments"`       // AI传入的参数（JSON）
+	Result     string `json:"result"`          // 返回给AI的结果
+	Error      string `json:"error,omitempty"` // 执行失败或超出预算的原因
+	DurationMs int64  `json:"duration_ms"`     // 执行耗时（毫秒）
+}
+
+// RiskReviewRecord 风控经理对开仓决策的审核记录
+type RiskReviewRecord struct {
+	SystemPrompt string              `json:"system_prompt"`   // 风控经理的系统提示词
+	InputPrompt  string              `json:"input_prompt"`    // 风控审核的输入prompt
+	CoTTrace     string              `json:"cot_trace"`       // 风控经理的分析（输出）
+	ProposedJSON string              `json:"proposed_json"`   // 交易分析师提出的原始决策
+	Verdicts     []RiskVerdictRecord `json:"verdicts"`        // 每条开仓决策的审核结论
+	DurationMs   int64               `json:"duration_ms"`     // 风控审核的AI调用耗时（毫秒）
+	Error        string              `json:"error,omitempty"` // 审核失败原因（失败时否决全部开仓决策）
+}
+
+// RiskVerdictRecord 单条开仓决策的审核结论
+type RiskVerdictRecord struct {
+	Index           int     `json:"index"`
+	Symbol          string  `json:"symbol"`
+	Action          string  `json:"action"`
+	Verdict         string  `json:"verdict"`                     // approve/resize/veto
+	PositionSizeUSD float64 `json:"position_size_usd,omitempty"` // 审核后的仓位价值
+	Leverage        int     `json:"leverage,omitempty"`          // 审核后的杠杆
+	Reason          string  `json:"reason"`
 }
 
 // AccountSnapshot 账户状态快照
@@ -62,8 +128,21 @@ type DecisionAction struct {
 	Timestamp time.Time `json:"timestamp"` // 执行时间
 	Success   bool      `json:"success"`   // 是否成功
 	Error     string    `json:"error"`     // 错误信息
+	// ClientOrderID 客户端订单ID（由周期编号+决策序号确定性生成，用于安全重试和对账）
+	ClientOrderID string `json:"client_order_id,omitempty"`
+	// Reasoning AI给出的决策理由；auto_close 时为平仓原因（如止损触发）
+	Reasoning string `json:"reasoning,omitempty"`
+	// ExitReason 交易所自动平仓的触发类型（仅 auto_close_long/auto_close_short）：stop_loss/take_profit/external
+	ExitReason string `json:"exit_reason,omitempty"`
 }
 
+// 交易所自动平仓的触发类型
+const (
+	ExitStopLoss   = "stop_loss"
+	ExitTakeProfit = "take_profit"
+	ExitExternal   = "external"
+)
+
 // DecisionLogger 决策日志记录器
 type DecisionLogger struct {
 	logDir      string
@@ -295,6 +374,9 @@ type TradeOutcome struct {
 	OpenTime      time.Time `json:"open_time"`      // 开仓时间
 	CloseTime     time.Time `json:"close_time"`     // 平仓时间
 	WasStopLoss   bool      `json:"was_stop_loss"`  // 是否止损
+	// EntryReason/CloseReason 开仓和平仓时的理由（auto_close 时为触发原因）
+	EntryReason string `json:"entry_reason,omitempty"`
+	CloseReason string `json:"close_reason,omitempty"`
 }
 
 // PerformanceAnalysis 交易表现分析
@@ -311,6 +393,9 @@ type PerformanceAnalysis struct {
 	SymbolStats   map[string]*SymbolPerformance `json:"symbol_stats"`   // 各币种表现
 	BestSymbol    string                        `json:"best_symbol"`    // 表现最好的币种
 	WorstSymbol   string                        `json:"worst_symbol"`   // 表现最差的币种
+
+	MaxDrawdownPct float64   `json:"max_drawdown_pct"` // 最大回撤（百分比，基于各周期账户净值）
+	TradePnLPcts   []float64 `json:"-"`                // 全部已平仓交易的盈亏百分比（按平仓顺序，用于显著性检验）
 }
 
 // SymbolPerformance 币种表现统计
@@ -338,18 +423,105 @@ func (l *DecisionLogger) AnalyzePerformance(lookbackCycles int) (*PerformanceAna
 		}, nil
 	}
 
+	// 为了避免开仓记录在窗口外导致匹配失败，需要先从所有历史记录中找出未平仓的持仓
+	// 获取更多历史记录来构建完整的持仓状态（使用更大的窗口）
+	allRecords, err := l.GetLatestRecords(lookbackCycles * 3) // 扩大3倍窗口
+	if err != nil {
+		allRecords = nil
+	}
+
+	return l.analyzeRecords(records, allRecords), nil
+}
+
+// AnalyzePerformanceBetween 分析 [since, until) 时间段内的交易表现（until 为零值表示至今）
+// 用于提示词A/B实验：只统计实验期间的决策周期
+func (l *DecisionLogger) AnalyzePerformanceBetween(since, until time.Time) (*PerformanceAnalysis, error) {
+	files, err := ioutil.ReadDir(l.logDir)
+	if err != nil {
+		return nil, fmt.Errorf("读取日志目录失败: %w", err)
+	}
+
+	// 文件名按时间排序，找出时间段对应的文件区间 [start, end)
+	var names []string
+	for _, file := range files {
+		if !file.IsDir() {
+			names = append(names, file.Name())
+		}
+	}
+	start, end := len(names), len(names)
+	for i, name := range names {
+		ts, ok := recordFileTime(name)
+		if !ok {
+			continue
+		}
+		if !until.IsZero() && !ts.Before(until) {
+			end = i
+			break
+		}
+		if start == len(names) && !ts.Before(since) {
+			start = i
+		}
+	}
+	if start >= end {
+		return &PerformanceAnalysis{
+			RecentTrades: []TradeOutcome{},
+			SymbolStats:  make(map[string]*SymbolPerformance),
+		}, nil
+	}
+
+	// 与 AnalyzePerformance 相同，向前扩大到3倍窗口来匹配窗口外的开仓记录
+	prefillStart := max(0, end-3*(end-start))
+	allRecords := l.readRecordFiles(names[prefillStart:end])
+	records := l.readRecordFiles(names[start:end])
+	return l.analyzeRecords(records, allRecords), nil
+}
+
+// recordFileTime 从决策记录文件名（decision_YYYYMMDD_HHMMSS_cycleN.json）解析记录时间
+func recordFileTime(name string) (time.Time, bool) {
+	const prefix = "decision_"
+	const layout = "20060102_150405"
+	if !strings.HasPrefix(name, prefix) || len(name) < len(prefix)+len(layout) {
+		return time.Time{}, false
+	}
+	ts, err := time.ParseInLocation(layout, name[len(prefix):len(prefix)+len(layout)], time.Local)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return ts, true
+}
+
+// readRecordFiles 按顺序读取决策记录文件，跳过无法解析的文件
+func (l *DecisionLogger) readRecordFiles(names []string) []*DecisionRecord {
+	records := make([]*DecisionRecord, 0, len(names))
+	for _, name := range names {
+		data, err := ioutil.ReadFile(filepath.Join(l.logDir, name))
+		if err != nil {
+			continue
+		}
+		var record DecisionRecord
+		if err := json.Unmarshal(data, &record); err != nil {
+			continue
+		}
+		records = append(records, &record)
+	}
+	return records
+}
+
+// analyzeRecords 根据决策记录统计交易表现
+// records 为分析窗口内的记录，allRecords 为包含窗口及之前记录的扩大窗口（用于匹配窗口外的开仓）
+func (l *DecisionLogger) analyzeRecords(records, allRecords []*DecisionRecord) *PerformanceAnalysis {
 	analysis := &PerformanceAnalysis{
 		RecentTrades: []TradeOutcome{},
 		SymbolStats:  make(map[string]*SymbolPerformance),
 	}
+	if len(records) == 0 {
+		return analysis
+	}
 
 	// 追踪持仓状态：symbol_side -> {side, openPrice, openTime, quantity, leverage}
 	openPositions := make(map[string]map[string]interface{})
 
-	// 为了避免开仓记录在窗口外导致匹配失败，需要先从所有历史记录中找出未平仓的持仓
-	// 获取更多历史记录来构建完整的持仓状态（使用更大的窗口）
-	allRecords, err := l.GetLatestRecords(lookbackCycles * 3) // 扩大3倍窗口
-	if err == nil && len(allRecords) > len(records) {
+	if len(allRecords) > len(records) {
 		// 先从扩大的窗口中收集所有开仓记录
 		for _, record := range allRecords {
 			for _, action := range record.Decisions {
@@ -381,11 +553,12 @@ func (l *DecisionLogger) AnalyzePerformance(lookbackCycles int) (*PerformanceAna
 				case "open_long", "open_short":
 					// 记录开仓
 					openPositions[posKey] = map[string]interface{}{
-						"side":      side,
-						"openPrice": action.Price,
-						"openTime":  action.Timestamp,
-						"quantity":  action.Quantity,
-						"leverage":  action.Leverage,
+						"side":        side,
+						"openPrice":   action.Price,
+						"openTime":    action.Timestamp,
+						"quantity":    action.Quantity,
+						"leverage":    action.Leverage,
+						"entryReason": action.Reasoning,
 					}
 				case "close_long", "close_short", "auto_close_long", "auto_close_short":
 					// 移除已平仓记录
@@ -437,6 +610,7 @@ func (l *DecisionLogger) AnalyzePerformance(lookbackCycles int) (*PerformanceAna
 					"accumulatedPnL":     0.0,             // 🔧 BUG FIX：累積部分平倉盈虧
 					"partialCloseCount":  0,               // 🔧 BUG FIX：部分平倉次數
 					"partialCloseVolume": 0.0,             // 🔧 BUG FIX：部分平倉總量
+					"entryReason":        action.Reasoning,
 				}
 
 			case "close_long", "close_short", "partial_close", "auto_close_long", "auto_close_short":
@@ -447,6 +621,7 @@ func (l *DecisionLogger) AnalyzePerformance(lookbackCycles int) (*PerformanceAna
 					side := openPos["side"].(string)
 					quantity := openPos["quantity"].(float64)
 					leverage := openPos["leverage"].(int)
+					entryReason, _ := openPos["entryReason"].(string)
 
 					// 🔧 BUG FIX：取得追蹤字段（若不存在則初始化）
 					remainingQty, _ := openPos["remainingQuantity"].(float64)
@@ -509,9 +684,12 @@ func (l *DecisionLogger) AnalyzePerformance(lookbackCycles int) (*PerformanceAna
 								Duration:      action.Timestamp.Sub(openTime).String(),
 								OpenTime:      openTime,
 								CloseTime:     action.Timestamp,
+								EntryReason:   entryReason,
+								CloseReason:   action.Reasoning,
 							}
 
 							analysis.RecentTrades = append(analysis.RecentTrades, outcome)
+							analysis.TradePnLPcts = append(analysis.TradePnLPcts, pnlPct)
 							analysis.TotalTrades++ // 🔧 只在完全平倉時計數
 
 							// 分类交易
@@ -569,9 +747,13 @@ func (l *DecisionLogger) AnalyzePerformance(lookbackCycles int) (*PerformanceAna
 							Duration:      action.Timestamp.Sub(openTime).String(),
 							OpenTime:      openTime,
 							CloseTime:     action.Timestamp,
+							WasStopLoss:   action.ExitReason == ExitStopLoss,
+							EntryReason:   entryReason,
+							CloseReason:   action.Reasoning,
 						}
 
 						analysis.RecentTrades = append(analysis.RecentTrades, outcome)
+						analysis.TradePnLPcts = append(analysis.TradePnLPcts, pnlPct)
 						analysis.TotalTrades++
 
 						// 分类交易
@@ -666,8 +848,27 @@ func (l *DecisionLogger) AnalyzePerformance(lookbackCycles int) (*PerformanceAna
 
 	// 计算夏普比率（需要至少2个数据点）
 	analysis.SharpeRatio = l.calculateSharpeRatio(records)
+	analysis.MaxDrawdownPct = calculateMaxDrawdown(records)
 
-	return analysis, nil
+	return analysis
+}
+
+// calculateMaxDrawdown 计算最大回撤（净值从峰值回落的最大百分比）
+func calculateMaxDrawdown(records []*DecisionRecord) float64 {
+	peak, maxDrawdown := 0.0, 0.0
+	for _, record := range records {
+		equity := record.AccountState.TotalBalance
+		if equity <= 0 {
+			continue
+		}
+		if equity > peak {
+			peak = equity
+		}
+		if drawdown := (peak - equity) / peak * 100; drawdown > maxDrawdown {
+			maxDrawdown = drawdown
+		}
+	}
+	return maxDrawdown
 }
 
 // calculateSharpeRatio 计算夏普比率
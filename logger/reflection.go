@@ -0,0 +1,60 @@
+package logger
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// reflectionDir 交易记忆子目录（决策记录按文件遍历日志目录时会跳过子目录）
+const reflectionDir = "memory"
+
+// Reflection AI对近期交易的复盘总结
+type Reflection struct {
+	Text          string    `json:"text"`            // 复盘内容（加入后续周期的 User Prompt）
+	CycleNumber   int       `json:"cycle_number"`    // 生成复盘时的周期编号
+	Timestamp     time.Time `json:"timestamp"`       // 生成时间
+	TradeCount    int       `json:"trade_count"`     // 复盘覆盖的已平仓交易数
+	LastTradeTime time.Time `json:"last_trade_time"` // 复盘覆盖的最新一笔交易的平仓时间
+}
+
+// reflectionPath 复盘文件路径
+func (l *DecisionLogger) reflectionPath() string {
+	return filepath.Join(l.logDir, reflectionDir, "reflection.json")
+}
+
+// SaveReflection 保存最新的AI复盘（覆盖上一次复盘）
+func (l *DecisionLogger) SaveReflection(reflection *Reflection) error {
+	path := l.reflectionPath()
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("创建交易记忆目录失败: %w", err)
+	}
+
+	data, err := json.MarshalIndent(reflection, "", "  ")
+	if err != nil {
+		return fmt.Errorf("序列化复盘失败: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("写入复盘失败: %w", err)
+	}
+	return nil
+}
+
+// LoadReflection 读取最新的AI复盘（从未复盘时返回 nil, nil）
+func (l *DecisionLogger) LoadReflection() (*Reflection, error) {
+	data, err := os.ReadFile(l.reflectionPath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取复盘失败: %w", err)
+	}
+
+	var reflection Reflection
+	if err := json.Unmarshal(data, &reflection); err != nil {
+		return nil, fmt.Errorf("解析复盘失败: %w", err)
+	}
+	return &reflection, nil
+}
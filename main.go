@@ -97,6 +97,11 @@ func syncConfigToDatabase(database *config.Database, configFile *ConfigFile) err
 		configs["altcoin_leverage"] = strconv.Itoa(configFile.Leverage.AltcoinLeverage)
 	}
 
+	// 同步默认K线周期（逗号分隔，如 "3m,4h"）
+	if configFile.DataKLineTime != "" {
+		configs["data_k_line_time"] = configFile.DataKLineTime
+	}
+
 	// 如果JWT密钥不为空，也同步
 	if configFile.JWTSecret != "" {
 		configs["jwt_secret"] = configFile.JWTSecret
@@ -262,6 +267,18 @@ func main() {
 		log.Printf("✓ 已配置OI Top API")
 	}
 
+	// 设置默认K线周期（交易员未单独配置时使用）
+	dataKLineTime, _ := database.GetSystemConfig("data_k_line_time")
+	if dataKLineTime != "" {
+		timeframes, err := market.ParseTimeframes(dataKLineTime)
+		if err != nil {
+			log.Printf("⚠️  解析data_k_line_time配置失败: %v，使用默认K线周期", err)
+		} else if len(timeframes) > 0 {
+			market.SetDefaultTimeframes(timeframes)
+			log.Printf("✓ 默认K线周期: %v", timeframes)
+		}
+	}
+
 	// 创建TraderManager
 	traderManager := manager.NewTraderManager()
 
@@ -346,7 +363,17 @@ func main() {
 	}()
 
 	// 启动流行情数据 - 默认使用所有交易员设置的币种 如果没有设置币种 则优先使用系统默认
-	go market.NewWSMonitor(150).Start(database.GetCustomCoins())
+	wsMonitor := market.NewWSMonitor(150)
+	// 本地K线库：重启后复用历史K线，并补齐断线期间缺失的K线
+	if err := os.MkdirAll("market_data", 0755); err != nil {
+		log.Printf("⚠️  创建K线数据目录失败: %v", err)
+	} else if klineStore, err := market.OpenKlineStore("market_data/klines.db", market.DefaultRetentionBars); err != nil {
+		log.Printf("⚠️  打开本地K线库失败，K线仅保存在内存: %v", err)
+	} else {
+		defer klineStore.Close()
+		wsMonitor.SetKlineStore(klineStore)
+	}
+	go wsMonitor.Start(database.GetCustomCoins())
 	//go market.NewWSMonitor(150).Start([]string{}) //这里是一个使用方式 传入空的话 则使用market市场的所有币种
 	// 设置优雅退出
 	sigChan := make(chan os.Signal, 1)
@@ -0,0 +1,252 @@
+package manager
+
+import (
+	"math"
+	"nofx/config"
+	"nofx/logger"
+	"sort"
+	"time"
+)
+
+const (
+	// experimentAlpha 显著性水平（双侧）
+	experimentAlpha = 0.05
+	// experimentMinTrades 每组至少需要的已平仓交易数，低于该值不判断显著性
+	experimentMinTrades = 10
+)
+
+// ExperimentArmReport 实验分组的表现
+type ExperimentArmReport struct {
+	TraderID        string  `json:"trader_id"`
+	TraderName      string  `json:"trader_name"`
+	TemplateName    string  `json:"template_name"`
+	TemplateVersion int     `json:"template_version"`
+	Control         bool    `json:"control"` // 是否为对照组（第一个分组）
+	Rank            int     `json:"rank"`    // 按夏普比率排名（1为最好）
+	TotalTrades     int     `json:"total_trades"`
+	WinRate         float64 `json:"win_rate"`
+	ProfitFactor    float64 `json:"profit_factor"`
+	SharpeRatio     float64 `json:"sharpe_ratio"`
+	MaxDrawdownPct  float64 `json:"max_drawdown_pct"`
+	AvgTradePnLPct  float64 `json:"avg_trade_pnl_pct"` // 每笔交易平均盈亏百分比（相对保证金）
+	PValue          float64 `json:"p_value"`           // 与对照组每笔交易盈亏的 Welch t 检验双侧p值（对照组为1）
+	Significant     bool    `json:"significant"`       // 与对照组的差异是否显著
+	Error           string  `json:"error,omitempty"`
+}
+
+// ExperimentReport 提示词A/B实验报告
+type ExperimentReport struct {
+	Experiment *config.ExperimentRecord `json:"experiment"`
+	Arms       []ExperimentArmReport    `json:"arms"`
+	Winner     string                   `json:"winner,omitempty"` // 显著优于对照组的最佳分组（交易员ID），无则为空
+	Alpha      float64                  `json:"alpha"`
+	MinTrades  int                      `json:"min_trades"`
+}
+
+// EvaluateExperiment 统计实验期间各分组的交易表现，并与对照组做显著性检验
+func (tm *TraderManager) EvaluateExperiment(exp *config.ExperimentRecord) *ExperimentReport {
+	var until time.Time
+	if exp.StoppedAt != nil {
+		until = *exp.StoppedAt
+	}
+
+	names := make(map[string]string, len(exp.Arms))
+	analyses := make(map[string]*logger.PerformanceAnalysis, len(exp.Arms))
+	errs := make(map[string]string)
+	for _, arm := range exp.Arms {
+		t, err := tm.GetTrader(arm.TraderID)
+		if err != nil {
+			errs[arm.TraderID] = "交易员未加载"
+			continue
+		}
+		names[arm.TraderID] = t.GetName()
+		analysis, err := t.GetDecisionLogger().AnalyzePerformanceBetween(exp.CreatedAt, until)
+		if err != nil {
+			errs[arm.TraderID] = err.Error()
+			continue
+		}
+		analyses[arm.TraderID] = analysis
+	}
+
+	report := buildExperimentReport(exp, analyses)
+	for i := range report.Arms {
+		arm := &report.Arms[i]
+		arm.TraderName = names[arm.TraderID]
+		arm.Error = errs[arm.TraderID]
+	}
+	return report
+}
+
+// buildExperimentReport 根据各分组的表现分析生成实验报告（第一个分组为对照组）
+func buildExperimentReport(exp *config.ExperimentRecord, analyses map[string]*logger.PerformanceAnalysis) *ExperimentReport {
+	report := &ExperimentReport{
+		Experiment: exp,
+		Arms:       make([]ExperimentArmReport, 0, len(exp.Arms)),
+		Alpha:      experimentAlpha,
+		MinTrades:  experimentMinTrades,
+	}
+
+	var controlPnL []float64
+	if len(exp.Arms) > 0 {
+		if analysis := analyses[exp.Arms[0].TraderID]; analysis != nil {
+			controlPnL = analysis.TradePnLPcts
+		}
+	}
+
+	for i, arm := range exp.Arms {
+		armReport := ExperimentArmReport{
+			TraderID:        arm.TraderID,
+			TemplateName:    arm.TemplateName,
+			TemplateVersion: arm.TemplateVersion,
+			Control:         i == 0,
+			PValue:          1,
+		}
+		if analysis := analyses[arm.TraderID]; analysis != nil {
+			armReport.TotalTrades = analysis.TotalTrades
+			armReport.WinRate = analysis.WinRate
+			armReport.ProfitFactor = analysis.ProfitFactor
+			armReport.SharpeRatio = analysis.SharpeRatio
+			armReport.MaxDrawdownPct = analysis.MaxDrawdownPct
+			armReport.AvgTradePnLPct = mean(analysis.TradePnLPcts)
+
+			if i > 0 {
+				_, armReport.PValue = welchTTest(analysis.TradePnLPcts, controlPnL)
+				armReport.Significant = armReport.PValue < experimentAlpha &&
+					len(analysis.TradePnLPcts) >= experimentMinTrades && len(controlPnL) >= experimentMinTrades
+			}
+		}
+		report.Arms = append(report.Arms, armReport)
+	}
+
+	// 按夏普比率排名（不修改分组顺序，第一个分组始终是对照组）
+	order := make([]int, len(report.Arms))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return report.Arms[order[a]].SharpeRatio > report.Arms[order[b]].SharpeRatio
+	})
+	for rank, idx := range order {
+		report.Arms[idx].Rank = rank + 1
+	}
+
+	// 胜出组：排名最高、显著优于对照组的分组
+	controlAvg := mean(controlPnL)
+	for _, idx := range order {
+		arm := report.Arms[idx]
+		if arm.Control {
+			continue
+		}
+		if arm.Significant && arm.AvgTradePnLPct > controlAvg {
+			report.Winner = arm.TraderID
+			break
+		}
+	}
+	return report
+}
+
+// welchTTest 对两组样本做 Welch t 检验（不假设方差相等），返回 t 值和双侧p值
+// 任一组样本少于2个时无法检验，返回 p=1
+func welchTTest(a, b []float64) (t, p float64) {
+	if len(a) < 2 || len(b) < 2 {
+		return 0, 1
+	}
+	na, nb := float64(len(a)), float64(len(b))
+	va, vb := variance(a)/na, variance(b)/nb
+	diff := mean(a) - mean(b)
+	se2 := va + vb
+	if se2 == 0 {
+		if diff == 0 {
+			return 0, 1
+		}
+		return math.Copysign(math.Inf(1), diff), 0
+	}
+
+	t = diff / math.Sqrt(se2)
+	// Welch–Satterthwaite 自由度
+	df := se2 * se2 / (va*va/(na-1) + vb*vb/(nb-1))
+	// 双侧p值：P(|T| > |t|) = I_{df/(df+t²)}(df/2, 1/2)
+	p = regularizedIncompleteBeta(df/(df+t*t), df/2, 0.5)
+	return t, p
+}
+
+// mean 样本均值（空样本为0）
+func mean(xs []float64) float64 {
+	if len(xs) == 0 {
+		return 0
+	}
+	sum := 0.0
+	for _, x := range xs {
+		sum += x
+	}
+	return sum / float64(len(xs))
+}
+
+// variance 样本方差（n-1）
+func variance(xs []float64) float64 {
+	if len(xs) < 2 {
+		return 0
+	}
+	m := mean(xs)
+	sum := 0.0
+	for _, x := range xs {
+		sum += (x - m) * (x - m)
+	}
+	return sum / float64(len(xs)-1)
+}
+
+// regularizedIncompleteBeta 正则化不完全Beta函数 I_x(a, b)（连分式展开）
+func regularizedIncompleteBeta(x, a, b float64) float64 {
+	if x <= 0 {
+		return 0
+	}
+	if x >= 1 {
+		return 1
+	}
+	lgab, _ := math.Lgamma(a + b)
+	lga, _ := math.Lgamma(a)
+	lgb, _ := math.Lgamma(b)
+	front := math.Exp(lgab - lga - lgb + a*math.Log(x) + b*math.Log(1-x))
+	// 连分式在 x < (a+1)/(a+b+2) 时收敛快，否则利用对称性 I_x(a,b) = 1 - I_{1-x}(b,a)
+	if x < (a+1)/(a+b+2) {
+		return front * betaContinuedFraction(x, a, b) / a
+	}
+	return 1 - front*betaContinuedFraction(1-x, b, a)/b
+}
+
+// betaContinuedFraction 不完全Beta函数的连分式（修正的 Lentz 算法）
+func betaContinuedFraction(x, a, b float64) float64 {
+	const (
+		maxIterations = 300
+		epsilon       = 1e-12
+		tiny          = 1e-300
+	)
+	clampTiny := func(v float64) float64 {
+		if math.Abs(v) < tiny {
+			return tiny
+		}
+		return v
+	}
+
+	c := 1.0
+	d := 1 / clampTiny(1-(a+b)*x/(a+1))
+	h := d
+	for m := 1; m <= maxIterations; m++ {
+		fm := float64(m)
+		// 偶数项
+		num := fm * (b - fm) * x / ((a + 2*fm - 1) * (a + 2*fm))
+		d = 1 / clampTiny(1+num*d)
+		c = clampTiny(1 + num/c)
+		h *= d * c
+		// 奇数项
+		num = -(a + fm) * (a + b + fm) * x / ((a + 2*fm) * (a + 2*fm + 1))
+		d = 1 / clampTiny(1+num*d)
+		c = clampTiny(1 + num/c)
+		delta := d * c
+		h *= delta
+		if math.Abs(delta-1) < epsilon {
+			break
+		}
+	}
+	return h
+}
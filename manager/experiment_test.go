@@ -0,0 +1,76 @@
+package manager
+
+import (
+	"math"
+	"testing"
+
+	"nofx/config"
+	"nofx/logger"
+)
+
+// TestWelchTTest 对照已知的 t 分布取值校验p值
+func TestWelchTTest(t *testing.T) {
+	// t=2, df=10 时双侧p值约为 0.0734
+	if p := regularizedIncompleteBeta(10.0/(10+4), 5, 0.5); math.Abs(p-0.0734) > 0.0005 {
+		t.Errorf("t=2, df=10 的p值 = %.4f, 期望约 0.0734", p)
+	}
+
+	a := []float64{1, 2, 3, 4, 5}
+	b := []float64{1, 2, 3, 4, 5}
+	if _, p := welchTTest(a, b); p < 0.999 {
+		t.Errorf("相同样本的p值应为1, got %.4f", p)
+	}
+
+	c := []float64{11, 12, 13, 14, 15}
+	tStat, p := welchTTest(c, a)
+	if tStat <= 0 || p > 0.001 {
+		t.Errorf("明显不同的样本应显著: t=%.2f p=%.4f", tStat, p)
+	}
+
+	if _, p := welchTTest([]float64{1}, a); p != 1 {
+		t.Errorf("样本不足时p值应为1, got %.4f", p)
+	}
+}
+
+func TestBuildExperimentReport(t *testing.T) {
+	exp := &config.ExperimentRecord{
+		ID: "exp-1",
+		Arms: []config.ExperimentArm{
+			{TraderID: "control", TemplateName: "trend", TemplateVersion: 1},
+			{TraderID: "better", TemplateName: "trend", TemplateVersion: 2},
+			{TraderID: "few", TemplateName: "scalp", TemplateVersion: 1},
+		},
+	}
+
+	pnl := func(base float64, n int) []float64 {
+		xs := make([]float64, n)
+		for i := range xs {
+			xs[i] = base + float64(i%3) - 1
+		}
+		return xs
+	}
+	analyses := map[string]*logger.PerformanceAnalysis{
+		"control": {TotalTrades: 12, SharpeRatio: 0.1, TradePnLPcts: pnl(-1, 12)},
+		"better":  {TotalTrades: 12, SharpeRatio: 0.5, TradePnLPcts: pnl(4, 12)},
+		"few":     {TotalTrades: 3, SharpeRatio: 0.9, TradePnLPcts: pnl(10, 3)},
+	}
+
+	report := buildExperimentReport(exp, analyses)
+	if len(report.Arms) != 3 || !report.Arms[0].Control || report.Arms[0].TraderID != "control" {
+		t.Fatalf("分组顺序应保持不变且第一组为对照组: %+v", report.Arms)
+	}
+
+	better, few := report.Arms[1], report.Arms[2]
+	if !better.Significant || better.PValue >= experimentAlpha {
+		t.Errorf("better 应显著优于对照组: %+v", better)
+	}
+	if few.Significant {
+		t.Errorf("交易数不足时不应判断为显著: %+v", few)
+	}
+	if few.Rank != 1 || better.Rank != 2 || report.Arms[0].Rank != 3 {
+		t.Errorf("应按夏普比率排名: few=%d better=%d control=%d", few.Rank, better.Rank, report.Arms[0].Rank)
+	}
+	if report.Winner != "better" {
+		t.Errorf("胜出组应为 better, got %q", report.Winner)
+	}
+}
@@ -236,6 +236,27 @@ func (tm *TraderManager) addTraderFromDB(traderCfg *config.TraderRecord, aiModel
 		MaxDrawdown:           maxDrawdown,
 		StopTradingTime:       time.Duration(stopTradingMinutes) * time.Minute,
 		IsCrossMargin:         traderCfg.IsCrossMargin,
+		Timeframes:            traderCfg.Timeframes,     // K线周期
+		Indicators:            traderCfg.Indicators,     // 提示词输出的指标
+		MaxSlippagePct:        traderCfg.MaxSlippagePct, // 开仓滑点上限
+		AlertTrigger:          traderCfg.AlertTrigger,   // 市场警报触发AI决策
+		PositionMode:          exchangeCfg.PositionMode, // 持仓模式
+		PriceMoveTriggerPct:   traderCfg.PriceMoveTriggerPct,
+		LiquidationBufferPct:  traderCfg.LiquidationBufferPct,
+		FillTrigger:           traderCfg.FillTrigger,
+		MinTriggerGap:         time.Duration(traderCfg.TriggerGapSeconds) * time.Second,
+		RegimeTemplates:       traderCfg.RegimeTemplates,
+		PromptLanguage:        traderCfg.PromptLanguage,
+		SystemPromptVersion:   traderCfg.SystemPromptVersion,
+		AgentMode:             traderCfg.AgentMode,
+		MaxToolCalls:          traderCfg.MaxToolCalls,
+		RiskReview:            traderCfg.RiskReview,
+		RiskReviewPrompt:      traderCfg.RiskReviewPrompt,
+		TradeMemory:           traderCfg.TradeMemory,
+		ReflectionInterval:    traderCfg.ReflectionInterval,
+		ValidationRules:       traderCfg.ValidationRules,
+		DailyAIBudget:         traderCfg.DailyAIBudget,
+		BudgetFallbackModel:   traderCfg.BudgetFallbackModel,
 		DefaultCoins:          defaultCoins,
 		TradingCoins:          tradingCoins,
 		SystemPromptTemplate:  traderCfg.SystemPromptTemplate, // 系统提示词模板
@@ -248,6 +269,7 @@ func (tm *TraderManager) addTraderFromDB(traderCfg *config.TraderRecord, aiModel
 	} else if exchangeCfg.ID == "hyperliquid" {
 		traderConfig.HyperliquidPrivateKey = exchangeCfg.APIKey // hyperliquid用APIKey存储private key
 		traderConfig.HyperliquidWalletAddr = exchangeCfg.HyperliquidWalletAddr
+		traderConfig.HyperliquidVaultAddr = exchangeCfg.HyperliquidVaultAddr
 	} else if exchangeCfg.ID == "aster" {
 		traderConfig.AsterUser = exchangeCfg.AsterUser
 		traderConfig.AsterSigner = exchangeCfg.AsterSigner
@@ -343,6 +365,27 @@ func (tm *TraderManager) AddTraderFromDB(traderCfg *config.TraderRecord, aiModel
 		MaxDrawdown:           maxDrawdown,
 		StopTradingTime:       time.Duration(stopTradingMinutes) * time.Minute,
 		IsCrossMargin:         traderCfg.IsCrossMargin,
+		Timeframes:            traderCfg.Timeframes,     // K线周期
+		Indicators:            traderCfg.Indicators,     // 提示词输出的指标
+		MaxSlippagePct:        traderCfg.MaxSlippagePct, // 开仓滑点上限
+		AlertTrigger:          traderCfg.AlertTrigger,   // 市场警报触发AI决策
+		PositionMode:          exchangeCfg.PositionMode, // 持仓模式
+		PriceMoveTriggerPct:   traderCfg.PriceMoveTriggerPct,
+		LiquidationBufferPct:  traderCfg.LiquidationBufferPct,
+		FillTrigger:           traderCfg.FillTrigger,
+		MinTriggerGap:         time.Duration(traderCfg.TriggerGapSeconds) * time.Second,
+		RegimeTemplates:       traderCfg.RegimeTemplates,
+		PromptLanguage:        traderCfg.PromptLanguage,
+		SystemPromptVersion:   traderCfg.SystemPromptVersion,
+		AgentMode:             traderCfg.AgentMode,
+		MaxToolCalls:          traderCfg.MaxToolCalls,
+		RiskReview:            traderCfg.RiskReview,
+		RiskReviewPrompt:      traderCfg.RiskReviewPrompt,
+		TradeMemory:           traderCfg.TradeMemory,
+		ReflectionInterval:    traderCfg.ReflectionInterval,
+		ValidationRules:       traderCfg.ValidationRules,
+		DailyAIBudget:         traderCfg.DailyAIBudget,
+		BudgetFallbackModel:   traderCfg.BudgetFallbackModel,
 		DefaultCoins:          defaultCoins,
 		TradingCoins:          tradingCoins,
 	}
@@ -354,6 +397,7 @@ func (tm *TraderManager) AddTraderFromDB(traderCfg *config.TraderRecord, aiModel
 	} else if exchangeCfg.ID == "hyperliquid" {
 		traderConfig.HyperliquidPrivateKey = exchangeCfg.APIKey // hyperliquid用APIKey存储private key
 		traderConfig.HyperliquidWalletAddr = exchangeCfg.HyperliquidWalletAddr
+		traderConfig.HyperliquidVaultAddr = exchangeCfg.HyperliquidVaultAddr
 	} else if exchangeCfg.ID == "aster" {
 		traderConfig.AsterUser = exchangeCfg.AsterUser
 		traderConfig.AsterSigner = exchangeCfg.AsterSigner
@@ -1042,6 +1086,27 @@ func (tm *TraderManager) loadSingleTrader(traderCfg *config.TraderRecord, aiMode
 		MaxDrawdown:          maxDrawdown,
 		StopTradingTime:      time.Duration(stopTradingMinutes) * time.Minute,
 		IsCrossMargin:        traderCfg.IsCrossMargin,
+		Timeframes:           traderCfg.Timeframes,     // K线周期
+		Indicators:           traderCfg.Indicators,     // 提示词输出的指标
+		MaxSlippagePct:       traderCfg.MaxSlippagePct, // 开仓滑点上限
+		AlertTrigger:         traderCfg.AlertTrigger,   // 市场警报触发AI决策
+		PositionMode:         exchangeCfg.PositionMode, // 持仓模式
+		PriceMoveTriggerPct:  traderCfg.PriceMoveTriggerPct,
+		LiquidationBufferPct: traderCfg.LiquidationBufferPct,
+		FillTrigger:          traderCfg.FillTrigger,
+		MinTriggerGap:        time.Duration(traderCfg.TriggerGapSeconds) * time.Second,
+		RegimeTemplates:      traderCfg.RegimeTemplates,
+		PromptLanguage:       traderCfg.PromptLanguage,
+		SystemPromptVersion:  traderCfg.SystemPromptVersion,
+		AgentMode:            traderCfg.AgentMode,
+		MaxToolCalls:         traderCfg.MaxToolCalls,
+		RiskReview:           traderCfg.RiskReview,
+		RiskReviewPrompt:     traderCfg.RiskReviewPrompt,
+		TradeMemory:          traderCfg.TradeMemory,
+		ReflectionInterval:   traderCfg.ReflectionInterval,
+		ValidationRules:      traderCfg.ValidationRules,
+		DailyAIBudget:        traderCfg.DailyAIBudget,
+		BudgetFallbackModel:  traderCfg.BudgetFallbackModel,
 		DefaultCoins:         defaultCoins,
 		TradingCoins:         tradingCoins,
 		SystemPromptTemplate: traderCfg.SystemPromptTemplate, // 系统提示词模板
@@ -1055,6 +1120,7 @@ func (tm *TraderManager) loadSingleTrader(traderCfg *config.TraderRecord, aiMode
 	} else if exchangeCfg.ID == "hyperliquid" {
 		traderConfig.HyperliquidPrivateKey = exchangeCfg.APIKey // hyperliquid用APIKey存储private key
 		traderConfig.HyperliquidWalletAddr = exchangeCfg.HyperliquidWalletAddr
+		traderConfig.HyperliquidVaultAddr = exchangeCfg.HyperliquidVaultAddr
 	} else if exchangeCfg.ID == "aster" {
 		traderConfig.AsterUser = exchangeCfg.AsterUser
 		traderConfig.AsterSigner = exchangeCfg.AsterSigner
@@ -0,0 +1,278 @@
+package market
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"sync"
+	"time"
+)
+
+// 警报类型
+const (
+	AlertVolumeSpike    = "volume_spike"       // 成交量放大
+	AlertPriceChange    = "price_change_15min" // 15分钟价格剧烈变化
+	AlertRSIOverbought  = "rsi_overbought"     // RSI超买
+	AlertRSIOversold    = "rsi_oversold"       // RSI超卖
+	alertCooldown       = 15 * time.Minute     // 同一交易对同类警报的最小间隔
+	alertSubscriberSize = 100
+)
+
+// alertTimeframe 计算特征和警报使用的K线周期（系统默认最短周期，收盘时评估）
+func alertTimeframe() string {
+	return DefaultTimeframes()[0]
+}
+
+// calculateFeatures 根据K线计算交易对特征，K线不足21根（当前 + 之前20根）时返回nil
+// 价格变化、波动率等比例字段均为小数（0.05 = 5%）
+func calculateFeatures(symbol string, klines []Kline, timeframe string) *SymbolFeatures {
+	if len(klines) < 21 {
+		return nil
+	}
+
+	last := klines[len(klines)-1]
+	f := &SymbolFeatures{
+		Symbol:    symbol,
+		Timestamp: time.UnixMilli(last.CloseTime),
+		Price:     last.Close,
+		Volume:    last.Volume,
+		RSI14:     calculateRSI(klines, 14),
+		SMA5:      mean(closes(klines[len(klines)-5:])),
+		SMA10:     mean(closes(klines[len(klines)-10:])),
+		SMA20:     mean(closes(klines[len(klines)-20:])),
+	}
+
+	if d, ok := TimeframeDuration(timeframe); ok {
+		f.PriceChange15Min = priceChangeOver(klines, d, 15*time.Minute)
+		f.PriceChange1H = priceChangeOver(klines, d, time.Hour)
+		f.PriceChange4H = priceChangeOver(klines, d, 4*time.Hour)
+	}
+
+	// 成交量对比（当前K线 vs 之前N根均值）
+	prev := klines[:len(klines)-1]
+	if avg5 := averageVolume(prev[len(prev)-5:]); avg5 > 0 {
+		f.VolumeRatio5 = last.Volume / avg5
+	}
+	avg20 := averageVolume(prev[len(prev)-20:])
+	if avg20 > 0 {
+		f.VolumeRatio20 = last.Volume / avg20
+		f.VolumeTrend = averageVolume(klines[len(klines)-5:]) / avg20
+	}
+
+	// 最近20根的区间、波动率
+	window := klines[len(klines)-20:]
+	high, low := window[0].High, window[0].Low
+	returns := make([]float64, 0, len(window))
+	for i, k := range window {
+		high = math.Max(high, k.High)
+		low = math.Min(low, k.Low)
+		if i > 0 && window[i-1].Close > 0 {
+			returns = append(returns, k.Close/window[i-1].Close-1)
+		}
+	}
+	if low > 0 {
+		f.HighLowRatio = high/low - 1
+	}
+	if high > low {
+		f.PositionInRange = (last.Close - low) / (high - low)
+	}
+	f.Volatility20 = stddev(returns)
+
+	return f
+}
+
+// priceChangeOver 相对 period 之前的价格变化（小数），K线不足或周期不能整除时返回0
+func priceChangeOver(klines []Kline, barDuration, period time.Duration) float64 {
+	if barDuration > period || period%barDuration != 0 {
+		return 0
+	}
+	n := int(period / barDuration)
+	if len(klines) <= n {
+		return 0
+	}
+	past := klines[len(klines)-1-n].Close
+	if past <= 0 {
+		return 0
+	}
+	return klines[len(klines)-1].Close/past - 1
+}
+
+func closes(klines []Kline) []float64 {
+	values := make([]float64, len(klines))
+	for i, k := range klines {
+		values[i] = k.Close
+	}
+	return values
+}
+
+func averageVolume(klines []Kline) float64 {
+	if len(klines) == 0 {
+		return 0
+	}
+	sum := 0.0
+	for _, k := range klines {
+		sum += k.Volume
+	}
+	return sum / float64(len(klines))
+}
+
+func mean(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
+
+func stddev(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	avg := mean(values)
+	variance := 0.0
+	for _, v := range values {
+		variance += (v - avg) * (v - avg)
+	}
+	return math.Sqrt(variance / float64(len(values)))
+}
+
+// detectAlerts 按阈值检测特征触发的警报
+func detectAlerts(f *SymbolFeatures, thresholds AlertThresholds) []Alert {
+	var alerts []Alert
+	add := func(typ string, value, threshold float64, format string, args ...interface{}) {
+		alerts = append(alerts, Alert{
+			Type:      typ,
+			Symbol:    f.Symbol,
+			Value:     value,
+			Threshold: threshold,
+			Message:   fmt.Sprintf(format, args...),
+			Timestamp: f.Timestamp,
+		})
+	}
+
+	if thresholds.VolumeSpike > 0 && f.VolumeRatio20 >= thresholds.VolumeSpike {
+		add(AlertVolumeSpike, f.VolumeRatio20, thresholds.VolumeSpike,
+			"%s 成交量放大 %.1f 倍（20周期均值）", f.Symbol, f.VolumeRatio20)
+	}
+	if thresholds.PriceChange15Min > 0 && math.Abs(f.PriceChange15Min) >= thresholds.PriceChange15Min {
+		add(AlertPriceChange, f.PriceChange15Min, thresholds.PriceChange15Min,
+			"%s 15分钟价格变化 %+.2f%%", f.Symbol, f.PriceChange15Min*100)
+	}
+	if thresholds.RSIOverbought > 0 && f.RSI14 >= thresholds.RSIOverbought {
+		add(AlertRSIOverbought, f.RSI14, thresholds.RSIOverbought, "%s RSI(14) 超买 %.1f", f.Symbol, f.RSI14)
+	}
+	if thresholds.RSIOversold > 0 && f.RSI14 > 0 && f.RSI14 <= thresholds.RSIOversold {
+		add(AlertRSIOversold, f.RSI14, thresholds.RSIOversold, "%s RSI(14) 超卖 %.1f", f.Symbol, f.RSI14)
+	}
+	return alerts
+}
+
+// evaluateAlerts K线收盘后重新计算交易对特征并发出警报（同类警报在冷却期内只发一次）
+func (m *WSMonitor) evaluateAlerts(symbol, timeframe string) {
+	value, ok := m.getKlineDataMap(timeframe).Load(symbol)
+	if !ok {
+		return
+	}
+	features := calculateFeatures(symbol, value.([]Kline), timeframe)
+	if features == nil {
+		return
+	}
+	m.featuresMap.Store(symbol, features)
+
+	for _, alert := range detectAlerts(features, config.AlertThresholds) {
+		key := symbol + ":" + alert.Type
+		if last, ok := m.lastAlerts.Load(key); ok && alert.Timestamp.Sub(last.(time.Time)) < alertCooldown {
+			continue
+		}
+		m.lastAlerts.Store(key, alert.Timestamp)
+		m.updateSymbolStats(alert)
+
+		select {
+		case m.alertsChan <- alert:
+		default:
+			log.Printf("⚠️  警报通道已满，丢弃警报: %s", alert.Message)
+		}
+	}
+}
+
+// updateSymbolStats 更新交易对的警报统计
+func (m *WSMonitor) updateSymbolStats(alert Alert) {
+	value, _ := m.symbolStats.LoadOrStore(alert.Symbol, &SymbolStats{})
+	stats := value.(*SymbolStats)
+
+	m.statsMutex.Lock()
+	defer m.statsMutex.Unlock()
+	stats.LastActiveTime = time.Now()
+	stats.LastAlertTime = alert.Timestamp
+	stats.AlertCount++
+	if alert.Type == AlertVolumeSpike {
+		stats.VolumeSpikeCount++
+	}
+}
+
+// GetFeatures 获取交易对最近一次计算的特征
+func (m *WSMonitor) GetFeatures(symbol string) (*SymbolFeatures, bool) {
+	value, ok := m.featuresMap.Load(symbol)
+	if !ok {
+		return nil, false
+	}
+	return value.(*SymbolFeatures), true
+}
+
+// dispatchAlerts 将警报分发给所有订阅者，alertsChan 关闭后退出
+func (m *WSMonitor) dispatchAlerts() {
+	for alert := range m.alertsChan {
+		log.Printf("🔔 %s", alert.Message)
+		publishAlert(alert)
+	}
+}
+
+// AlertSubscription 市场警报订阅，从 C 接收警报
+// 按订阅本身（而不是交易员ID）取消，交易员重新加载时旧的 Run 退出不会关闭新订阅的通道
+type AlertSubscription struct {
+	C     <-chan Alert
+	owner string // 订阅者（交易员ID），仅用于日志
+	ch    chan Alert
+}
+
+// alertSubscribers 当前的警报订阅
+var alertSubscribers = struct {
+	sync.Mutex
+	subs map[*AlertSubscription]struct{}
+}{subs: make(map[*AlertSubscription]struct{})}
+
+// SubscribeAlerts 订阅市场警报，使用完毕需调用 UnsubscribeAlerts
+func SubscribeAlerts(owner string) *AlertSubscription {
+	ch := make(chan Alert, alertSubscriberSize)
+	sub := &AlertSubscription{C: ch, owner: owner, ch: ch}
+	alertSubscribers.Lock()
+	defer alertSubscribers.Unlock()
+	alertSubscribers.subs[sub] = struct{}{}
+	return sub
+}
+
+// UnsubscribeAlerts 取消订阅并关闭通道（重复调用无副作用）
+func UnsubscribeAlerts(sub *AlertSubscription) {
+	alertSubscribers.Lock()
+	defer alertSubscribers.Unlock()
+	if _, ok := alertSubscribers.subs[sub]; ok {
+		close(sub.ch)
+		delete(alertSubscribers.subs, sub)
+	}
+}
+
+// publishAlert 非阻塞地分发警报，订阅者处理不过来时丢弃
+func publishAlert(alert Alert) {
+	alertSubscribers.Lock()
+	defer alertSubscribers.Unlock()
+	for sub := range alertSubscribers.subs {
+		select {
+		case sub.ch <- alert:
+		default:
+			log.Printf("⚠️  交易员 %s 警报通道已满，丢弃: %s", sub.owner, alert.Message)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package market
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// generateFlatKlines 生成价格和成交量恒定的3分钟K线
+func generateFlatKlines(count int, price, volume float64) []Kline {
+	klines := make([]Kline, count)
+	for i := range klines {
+		klines[i] = Kline{
+			OpenTime:  int64(i) * 180000,
+			CloseTime: int64(i+1)*180000 - 1,
+			Open:      price,
+			High:      price,
+			Low:       price,
+			Close:     price,
+			Volume:    volume,
+		}
+	}
+	return klines
+}
+
+// TestCalculateFeatures 测试特征计算
+func TestCalculateFeatures(t *testing.T) {
+	klines := generateFlatKlines(100, 100, 10)
+	// 最后一根放量上涨
+	last := &klines[len(klines)-1]
+	last.Close, last.High, last.Volume = 110, 110, 50
+
+	f := calculateFeatures("BTCUSDT", klines, "3m")
+	if f == nil {
+		t.Fatal("calculateFeatures returned nil")
+	}
+	if math.Abs(f.PriceChange15Min-0.1) > 1e-9 || math.Abs(f.PriceChange1H-0.1) > 1e-9 || math.Abs(f.PriceChange4H-0.1) > 1e-9 {
+		t.Errorf("价格变化 = %.4f/%.4f/%.4f, 期望均为 0.1", f.PriceChange15Min, f.PriceChange1H, f.PriceChange4H)
+	}
+	if f.VolumeRatio5 != 5 || f.VolumeRatio20 != 5 {
+		t.Errorf("成交量倍数 = %.2f/%.2f, 期望 5", f.VolumeRatio5, f.VolumeRatio20)
+	}
+	if f.PositionInRange != 1 || math.Abs(f.HighLowRatio-0.1) > 1e-9 {
+		t.Errorf("区间位置 = %.2f, 高低比 = %.4f", f.PositionInRange, f.HighLowRatio)
+	}
+	if math.Abs(f.SMA5-102) > 1e-9 {
+		t.Errorf("SMA5 = %.4f, 期望 102", f.SMA5)
+	}
+
+	if calculateFeatures("BTCUSDT", klines[:20], "3m") != nil {
+		t.Error("K线不足时应返回nil")
+	}
+}
+
+// TestDetectAlerts 测试阈值警报
+func TestDetectAlerts(t *testing.T) {
+	thresholds := AlertThresholds{VolumeSpike: 3, PriceChange15Min: 0.05, RSIOverbought: 70, RSIOversold: 30}
+
+	alerts := detectAlerts(&SymbolFeatures{Symbol: "BTCUSDT", VolumeRatio20: 5, PriceChange15Min: -0.06, RSI14: 25}, thresholds)
+	types := make(map[string]bool)
+	for _, a := range alerts {
+		types[a.Type] = true
+	}
+	if len(alerts) != 3 || !types[AlertVolumeSpike] || !types[AlertPriceChange] || !types[AlertRSIOversold] {
+		t.Errorf("警报 = %+v, 期望放量、价格变化、超卖", alerts)
+	}
+
+	if alerts := detectAlerts(&SymbolFeatures{Symbol: "BTCUSDT", VolumeRatio20: 1, PriceChange15Min: 0.01, RSI14: 50}, thresholds); len(alerts) != 0 {
+		t.Errorf("未超过阈值时不应有警报: %+v", alerts)
+	}
+}
+
+// TestEvaluateAlerts_CooldownAndDispatch 测试警报冷却和分发给订阅者
+func TestEvaluateAlerts_CooldownAndDispatch(t *testing.T) {
+	m := &WSMonitor{alertsChan: make(chan Alert, 10)}
+	klines := generateFlatKlines(100, 100, 10)
+	// 价格小幅震荡，避免RSI处于极值
+	for i := range klines {
+		if i%2 == 1 {
+			klines[i].Close = 100.1
+		}
+	}
+	klines[len(klines)-1].Volume = 50
+	m.getKlineDataMap("3m").Store("BTCUSDT", klines)
+
+	sub := SubscribeAlerts("trader-alerts")
+	defer UnsubscribeAlerts(sub)
+	go m.dispatchAlerts()
+	defer close(m.alertsChan)
+
+	m.evaluateAlerts("BTCUSDT", "3m")
+	m.evaluateAlerts("BTCUSDT", "3m") // 冷却期内不重复
+
+	select {
+	case alert := <-sub.C:
+		if alert.Type != AlertVolumeSpike || alert.Symbol != "BTCUSDT" {
+			t.Errorf("警报内容不符: %+v", alert)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("订阅者未收到警报")
+	}
+	select {
+	case alert := <-sub.C:
+		t.Errorf("冷却期内不应重复警报: %+v", alert)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if f, ok := m.GetFeatures("BTCUSDT"); !ok || f.VolumeRatio20 != 5 {
+		t.Errorf("特征未保存: %+v", f)
+	}
+	value, _ := m.symbolStats.Load("BTCUSDT")
+	if stats := value.(*SymbolStats); stats.AlertCount != 1 || stats.VolumeSpikeCount != 1 {
+		t.Errorf("统计 = %+v, 期望各1次", stats)
+	}
+}
+
+// TestAlertSubscription_ReloadedOwner 同一交易员重新订阅后，取消旧订阅不影响新订阅
+func TestAlertSubscription_ReloadedOwner(t *testing.T) {
+	old := SubscribeAlerts("trader-reload")
+	current := SubscribeAlerts("trader-reload")
+	defer UnsubscribeAlerts(current)
+
+	UnsubscribeAlerts(old)
+	UnsubscribeAlerts(old) // 重复取消无副作用
+	if _, ok := <-old.C; ok {
+		t.Error("旧订阅的通道应已关闭")
+	}
+
+	publishAlert(Alert{Type: AlertVolumeSpike, Symbol: "ETHUSDT"})
+	select {
+	case alert, ok := <-current.C:
+		if !ok || alert.Symbol != "ETHUSDT" {
+			t.Errorf("新订阅应收到警报: %+v, %v", alert, ok)
+		}
+	default:
+		t.Error("新订阅未收到警报")
+	}
+}
@@ -16,10 +16,16 @@ const (
 )
 
 type APIClient struct {
-	client *http.Client
+	client  *http.Client
+	baseURL string // 币安兼容的合约API地址
 }
 
 func NewAPIClient() *APIClient {
+	return newAPIClientWithBaseURL(baseURL)
+}
+
+// newAPIClientWithBaseURL 创建使用指定API地址的客户端（Aster 等币安兼容接口）
+func newAPIClientWithBaseURL(url string) *APIClient {
 	client := &http.Client{
 		Timeout: 30 * time.Second,
 	}
@@ -31,12 +37,13 @@ func NewAPIClient() *APIClient {
 	}
 
 	return &APIClient{
-		client: client,
+		client:  client,
+		baseURL: url,
 	}
 }
 
 func (c *APIClient) GetExchangeInfo() (*ExchangeInfo, error) {
-	url := fmt.Sprintf("%s/fapi/v1/exchangeInfo", baseURL)
+	url := fmt.Sprintf("%s/fapi/v1/exchangeInfo", c.baseURL)
 	resp, err := c.client.Get(url)
 	if err != nil {
 		return nil, err
@@ -57,7 +64,16 @@ func (c *APIClient) GetExchangeInfo() (*ExchangeInfo, error) {
 }
 
 func (c *APIClient) GetKlines(symbol, interval string, limit int) ([]Kline, error) {
-	url := fmt.Sprintf("%s/fapi/v1/klines", baseURL)
+	return c.getKlines(symbol, interval, limit, 0, 0)
+}
+
+// GetKlinesRange 获取开盘时间在 [startTime, endTime] 内的K线（毫秒，最多 limit 根）
+func (c *APIClient) GetKlinesRange(symbol, interval string, startTime, endTime int64, limit int) ([]Kline, error) {
+	return c.getKlines(symbol, interval, limit, startTime, endTime)
+}
+
+func (c *APIClient) getKlines(symbol, interval string, limit int, startTime, endTime int64) ([]Kline, error) {
+	url := fmt.Sprintf("%s/fapi/v1/klines", c.baseURL)
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
 		return nil, err
@@ -67,6 +83,12 @@ func (c *APIClient) GetKlines(symbol, interval string, limit int) ([]Kline, erro
 	q.Add("symbol", symbol)
 	q.Add("interval", interval)
 	q.Add("limit", strconv.Itoa(limit))
+	if startTime > 0 {
+		q.Add("startTime", strconv.FormatInt(startTime, 10))
+	}
+	if endTime > 0 {
+		q.Add("endTime", strconv.FormatInt(endTime, 10))
+	}
 	req.URL.RawQuery = q.Encode()
 
 	resp, err := c.client.Do(req)
@@ -124,7 +146,7 @@ func parseKline(kr KlineResponse) (Kline, error) {
 }
 
 func (c *APIClient) GetCurrentPrice(symbol string) (float64, error) {
-	url := fmt.Sprintf("%s/fapi/v1/ticker/price", baseURL)
+	url := fmt.Sprintf("%s/fapi/v1/ticker/price", c.baseURL)
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
 		return 0, err
@@ -158,3 +180,44 @@ func (c *APIClient) GetCurrentPrice(symbol string) (float64, error) {
 
 	return price, nil
 }
+
+// GetDepth 获取订单簿深度快照
+func (c *APIClient) GetDepth(symbol string, limit int) (*OrderBook, error) {
+	url := fmt.Sprintf("%s/fapi/v1/depth", c.baseURL)
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	q := req.URL.Query()
+	q.Add("symbol", symbol)
+	q.Add("limit", strconv.Itoa(limit))
+	req.URL.RawQuery = q.Encode()
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var depth struct {
+		Bids [][2]string `json:"bids"`
+		Asks [][2]string `json:"asks"`
+	}
+	if err := json.Unmarshal(body, &depth); err != nil {
+		log.Printf("获取订单簿失败,响应内容: %s", string(body))
+		return nil, err
+	}
+
+	return &OrderBook{
+		Symbol:     symbol,
+		Bids:       parseOrderBookLevels(depth.Bids),
+		Asks:       parseOrderBookLevels(depth.Asks),
+		UpdateTime: time.Now(),
+	}, nil
+}
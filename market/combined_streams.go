@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -11,18 +12,31 @@ import (
 	"github.com/gorilla/websocket"
 )
 
+// combinedStreamsURL 组合流端点（测试中可指向模拟交易所）
+var combinedStreamsURL = "wss://fstream.binance.com/stream"
+
+// reconnectDelay 断线后重新连接前的等待时间（测试中可缩短）
+var reconnectDelay = 3 * time.Second
+
 type CombinedStreamsClient struct {
 	conn        *websocket.Conn
 	mu          sync.RWMutex
 	subscribers map[string]chan []byte
+	subscribed  map[string]bool // 已发送订阅请求的流（重连后重新订阅）
 	reconnect   bool
 	done        chan struct{}
 	batchSize   int // 每批订阅的流数量
+
+	lastMessage   sync.Map  // 流 -> 最近一次收到消息的时间
+	connectedAt   time.Time // 当前连接建立时间（断开时为零值）
+	reconnects    int       // 重连成功次数
+	lastReconnect time.Time
 }
 
 func NewCombinedStreamsClient(batchSize int) *CombinedStreamsClient {
 	return &CombinedStreamsClient{
 		subscribers: make(map[string]chan []byte),
+		subscribed:  make(map[string]bool),
 		reconnect:   true,
 		done:        make(chan struct{}),
 		batchSize:   batchSize,
@@ -35,18 +49,39 @@ func (c *CombinedStreamsClient) Connect() error {
 	}
 
 	// 组合流使用不同的端点
-	conn, _, err := dialer.Dial("wss://fstream.binance.com/stream", nil)
+	conn, _, err := dialer.Dial(combinedStreamsURL, nil)
 	if err != nil {
 		return fmt.Errorf("组合流WebSocket连接失败: %v", err)
 	}
 
 	c.mu.Lock()
 	c.conn = conn
+	c.connectedAt = time.Now()
+	streams := make([]string, 0, len(c.subscribed))
+	for stream := range c.subscribed {
+		streams = append(streams, stream)
+	}
 	c.mu.Unlock()
 
 	log.Println("组合流WebSocket连接成功")
 	go c.readMessages()
 
+	// 重连后服务端的订阅已丢失，重新订阅之前的所有流
+	if len(streams) > 0 {
+		sort.Strings(streams)
+		for i := 0; i < len(streams); i += c.batchSize {
+			end := i + c.batchSize
+			if end > len(streams) {
+				end = len(streams)
+			}
+			if err := c.subscribeStreams(streams[i:end]); err != nil {
+				log.Printf("⚠️  重连后重新订阅失败: %v", err)
+				break
+			}
+		}
+		log.Printf("✓ 重连后已重新订阅 %d 个流", len(streams))
+	}
+
 	return nil
 }
 
@@ -99,9 +134,14 @@ func (c *CombinedStreamsClient) subscribeStreams(streams []string) error {
 		"id":     time.Now().UnixNano(),
 	}
 
-	c.mu.RLock()
-	defer c.mu.RUnlock()
+	// 写连接需要独占锁（同一连接不支持并发写）
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
+	// 先记录订阅，未连接时由重连统一订阅
+	for _, stream := range streams {
+		c.subscribed[stream] = true
+	}
 	if c.conn == nil {
 		return fmt.Errorf("WebSocket未连接")
 	}
@@ -128,6 +168,12 @@ func (c *CombinedStreamsClient) readMessages() {
 			_, message, err := conn.ReadMessage()
 			if err != nil {
 				log.Printf("读取组合流消息失败: %v", err)
+				c.mu.Lock()
+				if c.conn == conn {
+					c.conn = nil
+					c.connectedAt = time.Time{}
+				}
+				c.mu.Unlock()
 				c.handleReconnect()
 				return
 			}
@@ -148,6 +194,10 @@ func (c *CombinedStreamsClient) handleCombinedMessage(message []byte) {
 		return
 	}
 
+	if combinedMsg.Stream != "" {
+		c.lastMessage.Store(combinedMsg.Stream, time.Now())
+	}
+
 	c.mu.RLock()
 	ch, exists := c.subscribers[combinedMsg.Stream]
 	c.mu.RUnlock()
@@ -175,12 +225,45 @@ func (c *CombinedStreamsClient) handleReconnect() {
 	}
 
 	log.Println("组合流尝试重新连接...")
-	time.Sleep(3 * time.Second)
+	time.Sleep(reconnectDelay)
 
 	if err := c.Connect(); err != nil {
 		log.Printf("组合流重新连接失败: %v", err)
 		go c.handleReconnect()
+		return
+	}
+
+	c.mu.Lock()
+	c.reconnects++
+	c.lastReconnect = time.Now()
+	c.mu.Unlock()
+}
+
+// forceReconnect 关闭当前连接，由读循环触发重连（连接未断开但长时间没有消息时使用）
+func (c *CombinedStreamsClient) forceReconnect() {
+	c.mu.RLock()
+	conn := c.conn
+	c.mu.RUnlock()
+	if conn != nil {
+		log.Println("⚠️  组合流长时间没有消息，强制重连")
+		conn.Close()
+	}
+}
+
+// LastMessageTime 流最近一次收到消息的时间
+func (c *CombinedStreamsClient) LastMessageTime(stream string) (time.Time, bool) {
+	value, ok := c.lastMessage.Load(stream)
+	if !ok {
+		return time.Time{}, false
 	}
+	return value.(time.Time), true
+}
+
+// connectionState 连接状态快照（当前连接建立时间、重连次数、最近重连时间）
+func (c *CombinedStreamsClient) connectionState() (connectedAt time.Time, reconnects int, lastReconnect time.Time) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.connectedAt, c.reconnects, c.lastReconnect
 }
 
 func (c *CombinedStreamsClient) Close() {
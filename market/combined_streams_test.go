@@ -0,0 +1,116 @@
+package market
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"nofx/exchangesim"
+)
+
+// TestCombinedStreamsClient_KlineFromSimulator 通过模拟交易所的组合流推送 K线
+func TestCombinedStreamsClient_KlineFromSimulator(t *testing.T) {
+	sim := exchangesim.NewServer()
+	defer sim.Close()
+
+	original := combinedStreamsURL
+	combinedStreamsURL = sim.WebSocketURL()
+	defer func() { combinedStreamsURL = original }()
+
+	client := NewCombinedStreamsClient(10)
+	defer client.Close()
+
+	ch := client.AddSubscriber("btcusdt@kline_3m", 10)
+	if err := client.Connect(); err != nil {
+		t.Fatalf("连接模拟交易所失败: %v", err)
+	}
+	if err := client.BatchSubscribeKlines([]string{"BTCUSDT"}, "3m"); err != nil {
+		t.Fatalf("订阅K线失败: %v", err)
+	}
+
+	// 订阅请求异步处理，持续推送价格直到收到K线
+	deadline := time.After(3 * time.Second)
+	ticker := time.NewTicker(20 * time.Millisecond)
+	defer ticker.Stop()
+
+	price := 50000.0
+	for {
+		select {
+		case data := <-ch:
+			var kline KlineWSData
+			if err := json.Unmarshal(data, &kline); err != nil {
+				t.Fatalf("解析K线失败: %v", err)
+			}
+			if kline.EventType != "kline" || kline.Symbol != "BTCUSDT" || kline.Kline.Interval != "3m" {
+				t.Fatalf("K线内容不符: %+v", kline)
+			}
+			if kline.Kline.ClosePrice == "" || kline.Kline.CloseTime <= kline.Kline.StartTime {
+				t.Fatalf("K线价格/时间无效: %+v", kline.Kline)
+			}
+			return
+		case <-ticker.C:
+			price += 10
+			sim.SetPrice("BTCUSDT", price)
+		case <-deadline:
+			t.Fatal("超时未收到K线推送")
+		}
+	}
+}
+
+// TestCombinedStreamsClient_ResubscribeAfterReconnect 连接断开后自动重连并重新订阅
+func TestCombinedStreamsClient_ResubscribeAfterReconnect(t *testing.T) {
+	sim := exchangesim.NewServer()
+	defer sim.Close()
+
+	originalURL, originalDelay := combinedStreamsURL, reconnectDelay
+	combinedStreamsURL = sim.WebSocketURL()
+	reconnectDelay = 10 * time.Millisecond
+	defer func() { combinedStreamsURL, reconnectDelay = originalURL, originalDelay }()
+
+	client := NewCombinedStreamsClient(10)
+	defer client.Close()
+
+	ch := client.AddSubscriber("btcusdt@kline_3m", 100)
+	if err := client.Connect(); err != nil {
+		t.Fatalf("连接模拟交易所失败: %v", err)
+	}
+	if err := client.BatchSubscribeKlines([]string{"BTCUSDT"}, "3m"); err != nil {
+		t.Fatalf("订阅K线失败: %v", err)
+	}
+
+	// waitKline 持续推送价格直到收到K线
+	price := 50000.0
+	waitKline := func(stage string) {
+		deadline := time.After(3 * time.Second)
+		ticker := time.NewTicker(20 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ch:
+				return
+			case <-ticker.C:
+				price += 10
+				sim.SetPrice("BTCUSDT", price)
+			case <-deadline:
+				t.Fatalf("%s: 超时未收到K线推送", stage)
+			}
+		}
+	}
+
+	waitKline("首次订阅")
+	if _, ok := client.LastMessageTime("btcusdt@kline_3m"); !ok {
+		t.Error("收到消息后应记录最近消息时间")
+	}
+
+	sim.DropWebSockets()
+	// 等待读循环发现断线后清空残留消息
+	time.Sleep(50 * time.Millisecond)
+	for len(ch) > 0 {
+		<-ch
+	}
+	waitKline("重连后")
+
+	if _, reconnects, _ := client.connectionState(); reconnects != 1 {
+		t.Errorf("重连次数 = %d, 期望 1", reconnects)
+	}
+}
@@ -24,92 +24,133 @@ var (
 	frCacheTTL     = 1 * time.Hour
 )
 
-// Get 获取指定代币的市场数据
+// Get 获取指定代币的市场数据（使用系统默认K线周期）
 func Get(symbol string) (*Data, error) {
-	var klines3m, klines4h []Kline
-	var err error
+	return GetWithConfig(symbol, nil)
+}
+
+// GetWithConfig 按配置的K线周期和数据源获取指定代币的市场数据
+// 最短周期用于当前指标和日内序列，最长周期用于长期数据，cfg 为 nil 时使用系统默认周期和币安行情
+func GetWithConfig(symbol string, cfg *DataConfig) (*Data, error) {
 	// 标准化symbol
 	symbol = Normalize(symbol)
-	// 获取3分钟K线数据 (最近10个)
-	klines3m, err = WSMonitorCli.GetCurrentKlines(symbol, "3m") // 多获取一些用于计算
-	if err != nil {
-		return nil, fmt.Errorf("获取3分钟K线失败: %v", err)
-	}
-
-	// Data staleness detection: Prevent DOGEUSDT-style price freeze issues
-	if isStaleData(klines3m, symbol) {
-		log.Printf("⚠️  WARNING: %s detected stale data (consecutive price freeze), skipping symbol", symbol)
-		return nil, fmt.Errorf("%s data is stale, possible cache failure", symbol)
-	}
+	source := cfg.DataSource()
+	timeframes := cfg.EffectiveTimeframes()
+
+	// 获取各周期K线数据 (最近100个，多获取一些用于计算指标)
+	klinesByTF := make(map[string][]Kline, len(timeframes))
+	for i, tf := range timeframes {
+		klines, err := source.Klines(symbol, tf, klineHistorySize)
+		if err != nil {
+			return nil, fmt.Errorf("获取%s K线失败: %v", tf, err)
+		}
 
-	// 获取4小时K线数据 (最近10个)
-	klines4h, err = WSMonitorCli.GetCurrentKlines(symbol, "4h") // 多获取用于计算指标
-	if err != nil {
-		return nil, fmt.Errorf("获取4小时K线失败: %v", err)
-	}
+		// Data staleness detection: Prevent DOGEUSDT-style price freeze issues
+		if i == 0 && isStaleData(klines, symbol) {
+			log.Printf("⚠️  WARNING: %s detected stale data (consecutive price freeze), skipping symbol", symbol)
+			return nil, fmt.Errorf("%s data is stale, possible cache failure", symbol)
+		}
 
-	// 检查数据是否为空
-	if len(klines3m) == 0 {
-		return nil, fmt.Errorf("3分钟K线数据为空")
-	}
-	if len(klines4h) == 0 {
-		return nil, fmt.Errorf("4小时K线数据为空")
+		// 检查数据是否为空
+		if len(klines) == 0 {
+			return nil, fmt.Errorf("%s K线数据为空", tf)
+		}
+		klinesByTF[tf] = klines
 	}
 
-	// 计算当前指标 (基于3分钟最新数据)
-	currentPrice := klines3m[len(klines3m)-1].Close
-	currentEMA20 := calculateEMA(klines3m, 20)
-	currentMACD := calculateMACD(klines3m)
-	currentRSI7 := calculateRSI(klines3m, 7)
+	// 计算当前指标 (基于最短周期最新数据)
+	primary := klinesByTF[timeframes[0]]
+	currentPrice := primary[len(primary)-1].Close
+	currentEMA20 := calculateEMA(primary, 20)
+	currentMACD := calculateMACD(primary)
+	currentRSI7 := calculateRSI(primary, 7)
 
 	// 计算价格变化百分比
-	// 1小时价格变化 = 20个3分钟K线前的价格
-	priceChange1h := 0.0
-	if len(klines3m) >= 21 { // 至少需要21根K线 (当前 + 20根前)
-		price1hAgo := klines3m[len(klines3m)-21].Close
-		if price1hAgo > 0 {
-			priceChange1h = ((currentPrice - price1hAgo) / price1hAgo) * 100
-		}
-	}
-
-	// 4小时价格变化 = 1个4小时K线前的价格
-	priceChange4h := 0.0
-	if len(klines4h) >= 2 {
-		price4hAgo := klines4h[len(klines4h)-2].Close
-		if price4hAgo > 0 {
-			priceChange4h = ((currentPrice - price4hAgo) / price4hAgo) * 100
-		}
-	}
+	priceChange1h := calculatePriceChange(klinesByTF, timeframes, currentPrice, time.Hour)
+	priceChange4h := calculatePriceChange(klinesByTF, timeframes, currentPrice, 4*time.Hour)
 
 	// 获取OI数据
-	oiData, err := getOpenInterestData(symbol)
+	oiData, err := source.OpenInterest(symbol)
 	if err != nil {
 		// OI失败不影响整体,使用默认值
 		oiData = &OIData{Latest: 0, Average: 0}
 	}
 
 	// 获取Funding Rate
-	fundingRate, _ := getFundingRate(symbol)
-
-	// 计算日内系列数据
-	intradayData := calculateIntradaySeries(klines3m)
-
-	// 计算长期数据
-	longerTermData := calculateLongerTermData(klines4h)
-
-	return &Data{
-		Symbol:            symbol,
-		CurrentPrice:      currentPrice,
-		PriceChange1h:     priceChange1h,
-		PriceChange4h:     priceChange4h,
-		CurrentEMA20:      currentEMA20,
-		CurrentMACD:       currentMACD,
-		CurrentRSI7:       currentRSI7,
-		OpenInterest:      oiData,
-		FundingRate:       fundingRate,
-		IntradaySeries:    intradayData,
-		LongerTermContext: longerTermData,
-	}, nil
+	fundingRate, _ := source.FundingRate(symbol)
+
+	// 订单簿和市场情绪（强平、多空比、主动买卖量）只有币安数据，其他数据源不输出
+	var liquidity *LiquidityData
+	var sentiment *SentimentData
+	if source.Name() == SourceBinance {
+		refSymbol := ReferenceSymbol(symbol)
+		liquidity = getLiquidity(refSymbol)
+		sentiment = getSentiment(refSymbol, klinesByTF, timeframes)
+	}
+
+	// 计算各周期序列数据和选择的扩展指标
+	var indicators []string
+	if cfg != nil {
+		indicators = cfg.Indicators
+	}
+	selected := func(indicator string) bool { return indicatorSelected(indicators, indicator) }
+	timeframeData := make(map[string]*TimeframeData, len(timeframes))
+	for _, tf := range timeframes {
+		timeframeData[tf] = &TimeframeData{
+			Timeframe:  tf,
+			Series:     calculateIntradaySeries(klinesByTF[tf]),
+			Context:    calculateLongerTermData(klinesByTF[tf]),
+			Indicators: calculateIndicators(klinesByTF[tf], selected),
+		}
+	}
+
+	data := &Data{
+		Symbol:         symbol,
+		CurrentPrice:   currentPrice,
+		PriceChange1h:  priceChange1h,
+		PriceChange4h:  priceChange4h,
+		CurrentEMA20:   currentEMA20,
+		CurrentMACD:    currentMACD,
+		CurrentRSI7:    currentRSI7,
+		OpenInterest:   oiData,
+		FundingRate:    fundingRate,
+		Liquidity:      liquidity,
+		Sentiment:      sentiment,
+		IntradaySeries: timeframeData[timeframes[0]].Series,
+		Timeframes:     timeframeData,
+		Indicators:     indicators,
+	}
+	if len(timeframes) > 1 {
+		data.LongerTermContext = timeframeData[timeframes[len(timeframes)-1]].Context
+	}
+
+	// 市场状态和相关性使用最长周期（噪声更小）
+	trendTF := timeframes[len(timeframes)-1]
+	data.trendTimeframe = trendTF
+	data.trendKlines = klinesByTF[trendTF]
+	data.Regime = ClassifyRegime(trendTF, klinesByTF[trendTF])
+	return data, nil
+}
+
+// calculatePriceChange 计算相对 period 之前的价格变化百分比
+// 优先使用能整除 period 的最长周期（如 4h 变化使用上一根4小时K线），数据不足时回退到更短周期
+func calculatePriceChange(klinesByTF map[string][]Kline, timeframes []string, currentPrice float64, period time.Duration) float64 {
+	for i := len(timeframes) - 1; i >= 0; i-- {
+		d, ok := TimeframeDuration(timeframes[i])
+		if !ok || d > period || period%d != 0 {
+			continue
+		}
+		n := int(period / d)
+		klines := klinesByTF[timeframes[i]]
+		if len(klines) <= n { // 至少需要 n+1 根K线 (当前 + n根前)
+			continue
+		}
+		pastPrice := klines[len(klines)-1-n].Close
+		if pastPrice > 0 {
+			return ((currentPrice - pastPrice) / pastPrice) * 100
+		}
+	}
+	return 0
 }
 
 // calculateEMA 计算EMA
@@ -323,10 +364,9 @@ func calculateLongerTermData(klines []Kline) *LongerTermData {
 }
 
 // getOpenInterestData 获取OI数据
-func getOpenInterestData(symbol string) (*OIData, error) {
-	url := fmt.Sprintf("https://fapi.binance.com/fapi/v1/openInterest?symbol=%s", symbol)
+func getOpenInterestData(apiClient *APIClient, symbol string) (*OIData, error) {
+	url := fmt.Sprintf("%s/fapi/v1/openInterest?symbol=%s", apiClient.baseURL, symbol)
 
-	apiClient := NewAPIClient()
 	resp, err := apiClient.client.Get(url)
 	if err != nil {
 		return nil, err
@@ -356,11 +396,12 @@ func getOpenInterestData(symbol string) (*OIData, error) {
 	}, nil
 }
 
-// getFundingRate 获取资金费率（优化：使用 1 小时缓存）
-func getFundingRate(symbol string) (float64, error) {
+// getFundingRate 获取资金费率（优化：使用 1 小时缓存，按API地址区分交易所）
+func getFundingRate(apiClient *APIClient, symbol string) (float64, error) {
 	// 检查缓存（有效期 1 小时）
 	// Funding Rate 每 8 小时才更新，1 小时缓存非常合理
-	if cached, ok := fundingRateMap.Load(symbol); ok {
+	cacheKey := apiClient.baseURL + ":" + symbol
+	if cached, ok := fundingRateMap.Load(cacheKey); ok {
 		cache := cached.(*FundingRateCache)
 		if time.Since(cache.UpdatedAt) < frCacheTTL {
 			// 缓存命中，直接返回
@@ -369,9 +410,8 @@ func getFundingRate(symbol string) (float64, error) {
 	}
 
 	// 缓存过期或不存在，调用 API
-	url := fmt.Sprintf("https://fapi.binance.com/fapi/v1/premiumIndex?symbol=%s", symbol)
+	url := fmt.Sprintf("%s/fapi/v1/premiumIndex?symbol=%s", apiClient.baseURL, symbol)
 
-	apiClient := NewAPIClient()
 	resp, err := apiClient.client.Get(url)
 	if err != nil {
 		return 0, err
@@ -400,7 +440,7 @@ func getFundingRate(symbol string) (float64, error) {
 	rate, _ := strconv.ParseFloat(result.LastFundingRate, 64)
 
 	// 更新缓存
-	fundingRateMap.Store(symbol, &FundingRateCache{
+	fundingRateMap.Store(cacheKey, &FundingRateCache{
 		Rate:      rate,
 		UpdatedAt: time.Now(),
 	})
@@ -410,6 +450,11 @@ func getFundingRate(symbol string) (float64, error) {
 
 // Format 格式化输出市场数据
 func Format(data *Data) string {
+	return FormatWithDetail(data, SeriesFull)
+}
+
+// FormatWithDetail 格式化输出市场数据，序列按 detail 压缩（用于控制 prompt 大小）
+func FormatWithDetail(data *Data, detail SeriesDetail) string {
 	var sb strings.Builder
 
 	// 使用动态精度格式化价格
@@ -430,58 +475,235 @@ func Format(data *Data) string {
 
 	sb.WriteString(fmt.Sprintf("Funding Rate: %.2e\n\n", data.FundingRate))
 
-	if data.IntradaySeries != nil {
-		sb.WriteString("Intraday series (3‑minute intervals, oldest → latest):\n\n")
+	if data.Regime != nil {
+		r := data.Regime
+		sb.WriteString(fmt.Sprintf("Market regime (%s): %s | ADX %.1f | ATR %.2f%% of price (%.2fx avg) | EMA20 slope %+.2f%%\n\n",
+			r.Timeframe, r.Regime, r.ADX, r.ATRPct, r.VolatilityRatio, r.EMASlopePct))
+	}
 
-		if len(data.IntradaySeries.MidPrices) > 0 {
-			sb.WriteString(fmt.Sprintf("Mid prices: %s\n\n", formatFloatSlice(data.IntradaySeries.MidPrices)))
-		}
+	if data.Liquidity != nil {
+		writeLiquidity(&sb, data.Liquidity)
+	}
 
-		if len(data.IntradaySeries.EMA20Values) > 0 {
-			sb.WriteString(fmt.Sprintf("EMA indicators (20‑period): %s\n\n", formatFloatSlice(data.IntradaySeries.EMA20Values)))
-		}
+	if data.Sentiment != nil {
+		writeSentiment(&sb, data.Sentiment)
+	}
 
-		if len(data.IntradaySeries.MACDValues) > 0 {
-			sb.WriteString(fmt.Sprintf("MACD indicators: %s\n\n", formatFloatSlice(data.IntradaySeries.MACDValues)))
+	// 未携带周期数据时（如手动构造的Data）按默认 3m/4h 输出
+	if len(data.Timeframes) == 0 {
+		if data.IntradaySeries != nil {
+			writeIntradaySeries(&sb, data, "3m", data.IntradaySeries, detail)
 		}
-
-		if len(data.IntradaySeries.RSI7Values) > 0 {
-			sb.WriteString(fmt.Sprintf("RSI indicators (7‑Period): %s\n\n", formatFloatSlice(data.IntradaySeries.RSI7Values)))
+		if data.LongerTermContext != nil {
+			writeLongerTermContext(&sb, data, "4h", data.LongerTermContext, detail)
 		}
-
-		if len(data.IntradaySeries.RSI14Values) > 0 {
-			sb.WriteString(fmt.Sprintf("RSI indicators (14‑Period): %s\n\n", formatFloatSlice(data.IntradaySeries.RSI14Values)))
+		return sb.String()
+	}
+
+	// 最短周期输出日内序列，其余周期输出长期概览
+	timeframes := make([]string, 0, len(data.Timeframes))
+	for tf := range data.Timeframes {
+		timeframes = append(timeframes, tf)
+	}
+	for i, tf := range SortTimeframes(timeframes) {
+		tfData := data.Timeframes[tf]
+		if i == 0 {
+			if tfData.Series != nil {
+				writeIntradaySeries(&sb, data, tf, tfData.Series, detail)
+			}
+		} else if tfData.Context != nil {
+			writeLongerTermContext(&sb, data, tf, tfData.Context, detail)
+		}
+		if tfData.Indicators != nil {
+			writeIndicators(&sb, tf, tfData.Indicators, detail)
 		}
+	}
+
+	return sb.String()
+}
+
+// showIndicator 是否在 Format 中输出该指标
+func (d *Data) showIndicator(indicator string) bool {
+	return indicatorSelected(d.Indicators, indicator)
+}
+
+// indicatorSelected 指标是否被选择（未配置时只选择基础指标）
+func indicatorSelected(indicators []string, indicator string) bool {
+	if len(indicators) == 0 {
+		return containsString(DefaultIndicators, indicator)
+	}
+	return containsString(indicators, indicator)
+}
 
-		if len(data.IntradaySeries.Volume) > 0 {
-			sb.WriteString(fmt.Sprintf("Volume: %s\n\n", formatFloatSlice(data.IntradaySeries.Volume)))
+// writeIntradaySeries 输出日内序列
+func writeIntradaySeries(sb *strings.Builder, data *Data, timeframe string, series *IntradayData, detail SeriesDetail) {
+	sb.WriteString(fmt.Sprintf("Intraday series (%s intervals%s, oldest → latest):\n\n", timeframeLabel(timeframe), detail.label()))
+
+	if len(series.MidPrices) > 0 {
+		sb.WriteString(fmt.Sprintf("Mid prices: %s\n\n", detail.formatSeries(series.MidPrices)))
+	}
+
+	if data.showIndicator(IndicatorEMA) && len(series.EMA20Values) > 0 {
+		sb.WriteString(fmt.Sprintf("EMA indicators (20‑period): %s\n\n", detail.formatSeries(series.EMA20Values)))
+	}
+
+	if data.showIndicator(IndicatorMACD) && len(series.MACDValues) > 0 {
+		sb.WriteString(fmt.Sprintf("MACD indicators: %s\n\n", detail.formatSeries(series.MACDValues)))
+	}
+
+	if data.showIndicator(IndicatorRSI) {
+		if len(series.RSI7Values) > 0 {
+			sb.WriteString(fmt.Sprintf("RSI indicators (7‑Period): %s\n\n", detail.formatSeries(series.RSI7Values)))
+		}
+		if len(series.RSI14Values) > 0 {
+			sb.WriteString(fmt.Sprintf("RSI indicators (14‑Period): %s\n\n", detail.formatSeries(series.RSI14Values)))
 		}
+	}
+
+	if data.showIndicator(IndicatorVolume) && len(series.Volume) > 0 {
+		sb.WriteString(fmt.Sprintf("Volume: %s\n\n", detail.formatSeries(series.Volume)))
+	}
 
-		sb.WriteString(fmt.Sprintf("3m ATR (14‑period): %.3f\n\n", data.IntradaySeries.ATR14))
+	if data.showIndicator(IndicatorATR) {
+		sb.WriteString(fmt.Sprintf("%s ATR (14‑period): %.3f\n\n", timeframe, series.ATR14))
 	}
+}
 
-	if data.LongerTermContext != nil {
-		sb.WriteString("Longer‑term context (4‑hour timeframe):\n\n")
+// writeLongerTermContext 输出长期概览
+func writeLongerTermContext(sb *strings.Builder, data *Data, timeframe string, ctx *LongerTermData, detail SeriesDetail) {
+	sb.WriteString(fmt.Sprintf("Longer‑term context (%s timeframe%s):\n\n", timeframeLabel(timeframe), detail.label()))
 
+	if data.showIndicator(IndicatorEMA) {
 		sb.WriteString(fmt.Sprintf("20‑Period EMA: %.3f vs. 50‑Period EMA: %.3f\n\n",
-			data.LongerTermContext.EMA20, data.LongerTermContext.EMA50))
+			ctx.EMA20, ctx.EMA50))
+	}
 
+	if data.showIndicator(IndicatorATR) {
 		sb.WriteString(fmt.Sprintf("3‑Period ATR: %.3f vs. 14‑Period ATR: %.3f\n\n",
-			data.LongerTermContext.ATR3, data.LongerTermContext.ATR14))
+			ctx.ATR3, ctx.ATR14))
+	}
 
+	if data.showIndicator(IndicatorVolume) {
 		sb.WriteString(fmt.Sprintf("Current Volume: %.3f vs. Average Volume: %.3f\n\n",
-			data.LongerTermContext.CurrentVolume, data.LongerTermContext.AverageVolume))
+			ctx.CurrentVolume, ctx.AverageVolume))
+	}
 
-		if len(data.LongerTermContext.MACDValues) > 0 {
-			sb.WriteString(fmt.Sprintf("MACD indicators: %s\n\n", formatFloatSlice(data.LongerTermContext.MACDValues)))
+	if data.showIndicator(IndicatorMACD) && len(ctx.MACDValues) > 0 {
+		sb.WriteString(fmt.Sprintf("MACD indicators: %s\n\n", detail.formatSeries(ctx.MACDValues)))
+	}
+
+	if data.showIndicator(IndicatorRSI) && len(ctx.RSI14Values) > 0 {
+		sb.WriteString(fmt.Sprintf("RSI indicators (14‑Period): %s\n\n", detail.formatSeries(ctx.RSI14Values)))
+	}
+}
+
+// writeIndicators 输出扩展技术指标
+func writeIndicators(sb *strings.Builder, timeframe string, ind *IndicatorData, detail SeriesDetail) {
+	sb.WriteString(fmt.Sprintf("Additional indicators (%s timeframe%s):\n\n", timeframeLabel(timeframe), detail.label()))
+
+	if b := ind.Bollinger; b != nil {
+		sb.WriteString(fmt.Sprintf("Bollinger Bands (20, 2): upper %s / middle %s / lower %s, bandwidth %.2f%%, %%B %.2f\n\n",
+			formatPriceWithDynamicPrecision(b.Upper), formatPriceWithDynamicPrecision(b.Middle),
+			formatPriceWithDynamicPrecision(b.Lower), b.Bandwidth, b.PercentB))
+	}
+
+	if v := ind.VWAP; v != nil {
+		sb.WriteString(fmt.Sprintf("VWAP: session (UTC day) %s, anchored at window high %s, anchored at window low %s\n\n",
+			formatPriceWithDynamicPrecision(v.Session), formatPriceWithDynamicPrecision(v.AnchoredHigh),
+			formatPriceWithDynamicPrecision(v.AnchoredLow)))
+	}
+
+	if r := ind.StochRSI; r != nil {
+		sb.WriteString(fmt.Sprintf("Stochastic RSI (14, 14, 3, 3): %%K %.2f, %%D %.2f\n\n", r.K, r.D))
+	}
+
+	if a := ind.ADX; a != nil {
+		sb.WriteString(fmt.Sprintf("ADX (14): %.2f, +DI %.2f, -DI %.2f\n\n", a.ADX, a.PlusDI, a.MinusDI))
+	}
+
+	if st := ind.Supertrend; st != nil {
+		trend := "down"
+		if st.Uptrend {
+			trend = "up"
+		}
+		sb.WriteString(fmt.Sprintf("Supertrend (10, 3): %s, trend %s for %d bars\n\n",
+			formatPriceWithDynamicPrecision(st.Value), trend, st.BarsInTrend))
+	}
+
+	if ich := ind.Ichimoku; ich != nil {
+		sb.WriteString(fmt.Sprintf("Ichimoku (9, 26, 52): tenkan %s, kijun %s, cloud A %s, cloud B %s\n\n",
+			formatPriceWithDynamicPrecision(ich.Tenkan), formatPriceWithDynamicPrecision(ich.Kijun),
+			formatPriceWithDynamicPrecision(ich.SenkouA), formatPriceWithDynamicPrecision(ich.SenkouB)))
+	}
+
+	if len(ind.OBV) > 0 {
+		sb.WriteString(fmt.Sprintf("OBV: %s\n\n", detail.formatSeries(ind.OBV)))
+	}
+
+	if d := ind.Donchian; d != nil {
+		sb.WriteString(fmt.Sprintf("Donchian Channel (20): upper %s / middle %s / lower %s\n\n",
+			formatPriceWithDynamicPrecision(d.Upper), formatPriceWithDynamicPrecision(d.Middle),
+			formatPriceWithDynamicPrecision(d.Lower)))
+	}
+}
+
+// writeLiquidity 输出订单簿流动性指标
+func writeLiquidity(sb *strings.Builder, l *LiquidityData) {
+	sb.WriteString(fmt.Sprintf("Order book (top %d levels): best bid %s / best ask %s, spread %.2f bps\n\n",
+		orderBookDepthLevels, formatPriceWithDynamicPrecision(l.BestBid), formatPriceWithDynamicPrecision(l.BestAsk), l.SpreadBps))
+	sb.WriteString(fmt.Sprintf("Depth within ±0.5%%: bids $%.0f / asks $%.0f | within ±1%%: bids $%.0f / asks $%.0f | imbalance %+.2f\n\n",
+		l.BidDepth05, l.AskDepth05, l.BidDepth1, l.AskDepth1, l.Imbalance))
+
+	if s := l.Slippage; s != nil {
+		exhausted := ""
+		if s.Exhausted {
+			exhausted = " (exceeds visible depth, actual slippage may be higher)"
 		}
+		sb.WriteString(fmt.Sprintf("Estimated slippage at max position size ($%.0f market order, smaller orders slip less): buy %.3f%% / sell %.3f%%%s\n\n",
+			s.NotionalUSD, s.BuyPct, s.SellPct, exhausted))
+	}
+}
 
-		if len(data.LongerTermContext.RSI14Values) > 0 {
-			sb.WriteString(fmt.Sprintf("RSI indicators (14‑Period): %s\n\n", formatFloatSlice(data.LongerTermContext.RSI14Values)))
+// writeSentiment 输出市场情绪数据
+func writeSentiment(sb *strings.Builder, s *SentimentData) {
+	if len(s.Liquidations) == 0 && s.GlobalLongShort == nil && s.TopTraderLongShort == nil && len(s.TakerFlow) == 0 {
+		return
+	}
+	sb.WriteString("Sentiment signals:\n\n")
+
+	if len(s.Liquidations) > 0 {
+		parts := make([]string, len(s.Liquidations))
+		for i, w := range s.Liquidations {
+			parts[i] = fmt.Sprintf("%s longs $%.0f / shorts $%.0f (%d orders)", windowLabel(w.Window), w.LongUSD, w.ShortUSD, w.Count)
 		}
+		sb.WriteString(fmt.Sprintf("Liquidations: %s\n\n", strings.Join(parts, " | ")))
 	}
 
-	return sb.String()
+	if r := s.GlobalLongShort; r != nil {
+		sb.WriteString(fmt.Sprintf("Long/short account ratio (all accounts): %.2f (long %.1f%% / short %.1f%%), 1h change %+.2f\n\n",
+			r.Ratio, r.LongPct, r.ShortPct, r.Change1h))
+	}
+
+	if r := s.TopTraderLongShort; r != nil {
+		sb.WriteString(fmt.Sprintf("Long/short account ratio (top traders): %.2f (long %.1f%% / short %.1f%%), 1h change %+.2f\n\n",
+			r.Ratio, r.LongPct, r.ShortPct, r.Change1h))
+	}
+
+	if len(s.TakerFlow) > 0 {
+		parts := make([]string, len(s.TakerFlow))
+		for i, f := range s.TakerFlow {
+			parts[i] = fmt.Sprintf("%s buy $%.0f / sell $%.0f (ratio %.2f)", windowLabel(f.Window), f.BuyUSD, f.SellUSD, f.Ratio)
+		}
+		sb.WriteString(fmt.Sprintf("Taker volume: %s\n\n", strings.Join(parts, " | ")))
+	}
+}
+
+// windowLabel 滚动窗口描述，如 5m、1h、4h
+func windowLabel(d time.Duration) string {
+	if d < time.Hour {
+		return fmt.Sprintf("%dm", int(d/time.Minute))
+	}
+	return fmt.Sprintf("%dh", int(d/time.Hour))
 }
 
 // formatPriceWithDynamicPrecision 根据价格区间动态选择精度
@@ -524,13 +746,82 @@ func formatFloatSlice(values []float64) string {
 	return "[" + strings.Join(strValues, ", ") + "]"
 }
 
-// Normalize 标准化symbol,确保是USDT交易对
-func Normalize(symbol string) string {
-	symbol = strings.ToUpper(symbol)
-	if strings.HasSuffix(symbol, "USDT") {
-		return symbol
+// SeriesDetail 序列数据在 Format 中的详细程度（prompt 超出预算时逐级压缩）
+type SeriesDetail int
+
+const (
+	SeriesFull        SeriesDetail = iota // 完整序列
+	SeriesDownsampled                     // 降采样：每 seriesDownsampleStep 个点保留1个（始终保留最新点）
+	SeriesSummary                         // 摘要：只输出首尾值和区间范围
+)
+
+// seriesDownsampleStep 降采样的间隔
+const seriesDownsampleStep = 2
+
+// String 详细程度名称（用于日志和决策记录）
+func (d SeriesDetail) String() string {
+	switch d {
+	case SeriesDownsampled:
+		return "downsampled"
+	case SeriesSummary:
+		return "summary"
+	default:
+		return "full"
+	}
+}
+
+// label 序列所在段落标题中的压缩说明（日内序列、长期概览和扩展指标）
+func (d SeriesDetail) label() string {
+	switch d {
+	case SeriesDownsampled:
+		return fmt.Sprintf(", 1 of every %d points", seriesDownsampleStep)
+	case SeriesSummary:
+		return ", summarized as first → last"
+	default:
+		return ""
+	}
+}
+
+// formatSeries 按详细程度格式化序列
+func (d SeriesDetail) formatSeries(values []float64) string {
+	switch d {
+	case SeriesDownsampled:
+		return formatFloatSlice(downsampleSeries(values, seriesDownsampleStep))
+	case SeriesSummary:
+		return summarizeSeries(values)
+	default:
+		return formatFloatSlice(values)
+	}
+}
+
+// downsampleSeries 从最新点往前每 step 个点取1个，保持从旧到新的顺序
+func downsampleSeries(values []float64, step int) []float64 {
+	if step <= 1 || len(values) <= 2 {
+		return values
+	}
+	result := make([]float64, 0, (len(values)+step-1)/step)
+	for i := (len(values) - 1) % step; i < len(values); i += step {
+		result = append(result, values[i])
+	}
+	return result
+}
+
+// summarizeSeries 序列摘要：首尾值，区间极值超出首尾时附加区间范围
+func summarizeSeries(values []float64) string {
+	if len(values) <= 2 {
+		return formatFloatSlice(values)
+	}
+	first, last := values[0], values[len(values)-1]
+	low, high := values[0], values[0]
+	for _, v := range values[1:] {
+		low = math.Min(low, v)
+		high = math.Max(high, v)
+	}
+	summary := formatPriceWithDynamicPrecision(first) + " → " + formatPriceWithDynamicPrecision(last)
+	if low < math.Min(first, last) || high > math.Max(first, last) {
+		summary += fmt.Sprintf(" (range %s–%s)", formatPriceWithDynamicPrecision(low), formatPriceWithDynamicPrecision(high))
 	}
-	return symbol + "USDT"
+	return summary
 }
 
 // parseFloat 解析float值
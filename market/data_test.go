@@ -2,6 +2,7 @@ package market
 
 import (
 	"math"
+	"strings"
 	"testing"
 )
 
@@ -500,3 +501,42 @@ func TestIsStaleData_EmptyKlines(t *testing.T) {
 		t.Error("Expected false for empty klines, got true")
 	}
 }
+
+// TestFormatWithDetail 测试序列降采样和摘要压缩
+func TestFormatWithDetail(t *testing.T) {
+	if got := downsampleSeries([]float64{1, 2, 3, 4, 5}, 2); len(got) != 3 || got[0] != 1 || got[2] != 5 {
+		t.Errorf("降采样应保留最新点: %v", got)
+	}
+	if got := downsampleSeries([]float64{1, 2, 3, 4}, 2); len(got) != 2 || got[0] != 2 || got[1] != 4 {
+		t.Errorf("降采样应从最新点往前取: %v", got)
+	}
+	if got := summarizeSeries([]float64{3, 1, 5, 2}); got != "3.0000 → 2.0000 (range 1.0000–5.0000)" {
+		t.Errorf("摘要格式不正确: %s", got)
+	}
+	if got := summarizeSeries([]float64{1, 2, 3}); got != "1.0000 → 3.0000" {
+		t.Errorf("单调序列的摘要不需要区间范围: %s", got)
+	}
+
+	klines := generateTestKlines(60)
+	data := &Data{
+		Symbol:            "BTCUSDT",
+		CurrentPrice:      100,
+		IntradaySeries:    calculateIntradaySeries(klines),
+		LongerTermContext: calculateLongerTermData(klines),
+	}
+	full := FormatWithDetail(data, SeriesFull)
+	if full != Format(data) {
+		t.Error("SeriesFull 应与 Format 输出一致")
+	}
+	downsampled := FormatWithDetail(data, SeriesDownsampled)
+	summary := FormatWithDetail(data, SeriesSummary)
+	if !(len(summary) < len(downsampled) && len(downsampled) < len(full)) {
+		t.Errorf("压缩后输出应逐级变短: %d / %d / %d", len(full), len(downsampled), len(summary))
+	}
+	if !strings.Contains(downsampled, "1 of every 2 points") || !strings.Contains(summary, "summarized") {
+		t.Error("序列标题应说明压缩方式")
+	}
+	if !strings.Contains(downsampled, "timeframe, 1 of every 2 points):") || !strings.Contains(summary, "timeframe, summarized as first → last):") {
+		t.Error("长期概览的标题也应说明压缩方式")
+	}
+}
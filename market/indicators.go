@@ -0,0 +1,475 @@
+package market
+
+import (
+	"math"
+	"time"
+)
+
+// 扩展指标的标准参数
+const (
+	bollingerPeriod      = 20
+	bollingerStdDev      = 2.0
+	stochRSIPeriod       = 14
+	stochRSISmoothK      = 3
+	stochRSISmoothD      = 3
+	adxPeriod            = 14
+	supertrendPeriod     = 10
+	supertrendMultiplier = 3.0
+	ichimokuTenkan       = 9
+	ichimokuKijun        = 26
+	ichimokuSenkouB      = 52
+	donchianPeriod       = 20
+	obvSeriesLength      = 10
+)
+
+// IndicatorData 扩展技术指标（按交易员配置计算，未选择的指标为nil）
+type IndicatorData struct {
+	Bollinger  *BollingerBands
+	VWAP       *VWAPData
+	StochRSI   *StochRSIData
+	ADX        *ADXData
+	Supertrend *SupertrendData
+	Ichimoku   *IchimokuData
+	OBV        []float64 // 最近10根K线的OBV
+	Donchian   *DonchianChannel
+}
+
+// BollingerBands 布林带 (20, 2)
+type BollingerBands struct {
+	Upper     float64
+	Middle    float64
+	Lower     float64
+	Bandwidth float64 // 带宽百分比 (Upper-Lower)/Middle*100
+	PercentB  float64 // 价格在带内的位置 (0=下轨, 1=上轨)
+}
+
+// VWAPData 成交量加权平均价
+type VWAPData struct {
+	Session      float64 // 当日（UTC 0点起）VWAP
+	AnchoredHigh float64 // 锚定窗口内最高点的VWAP
+	AnchoredLow  float64 // 锚定窗口内最低点的VWAP
+}
+
+// StochRSIData 随机RSI (14, 14, 3, 3)
+type StochRSIData struct {
+	K float64
+	D float64
+}
+
+// ADXData 平均趋向指标 (14)
+type ADXData struct {
+	ADX     float64
+	PlusDI  float64
+	MinusDI float64
+}
+
+// SupertrendData 超级趋势 (10, 3)
+type SupertrendData struct {
+	Value       float64
+	Uptrend     bool
+	BarsInTrend int // 当前趋势已持续的K线数
+}
+
+// IchimokuData 一目均衡表 (9, 26, 52)，云层为当前K线对应的先行带
+type IchimokuData struct {
+	Tenkan  float64
+	Kijun   float64
+	SenkouA float64
+	SenkouB float64
+}
+
+// DonchianChannel 唐奇安通道 (20)
+type DonchianChannel struct {
+	Upper  float64
+	Middle float64
+	Lower  float64
+}
+
+// calculateIndicators 按选择的指标计算扩展指标，未选择任何扩展指标时返回nil
+func calculateIndicators(klines []Kline, selected func(string) bool) *IndicatorData {
+	data := &IndicatorData{}
+	if selected(IndicatorBollinger) {
+		data.Bollinger = calculateBollinger(klines, bollingerPeriod, bollingerStdDev)
+	}
+	if selected(IndicatorVWAP) {
+		data.VWAP = calculateVWAP(klines)
+	}
+	if selected(IndicatorStochRSI) {
+		data.StochRSI = calculateStochRSI(klines, stochRSIPeriod, stochRSIPeriod, stochRSISmoothK, stochRSISmoothD)
+	}
+	if selected(IndicatorADX) {
+		data.ADX = calculateADX(klines, adxPeriod)
+	}
+	if selected(IndicatorSupertrend) {
+		data.Supertrend = calculateSupertrend(klines, supertrendPeriod, supertrendMultiplier)
+	}
+	if selected(IndicatorIchimoku) {
+		data.Ichimoku = calculateIchimoku(klines, ichimokuTenkan, ichimokuKijun, ichimokuSenkouB)
+	}
+	if selected(IndicatorOBV) {
+		data.OBV = calculateOBV(klines, obvSeriesLength)
+	}
+	if selected(IndicatorDonchian) {
+		data.Donchian = calculateDonchian(klines, donchianPeriod)
+	}
+
+	if data.Bollinger == nil && data.VWAP == nil && data.StochRSI == nil && data.ADX == nil &&
+		data.Supertrend == nil && data.Ichimoku == nil && data.OBV == nil && data.Donchian == nil {
+		return nil
+	}
+	return data
+}
+
+// calculateBollinger 计算布林带（总体标准差）
+func calculateBollinger(klines []Kline, period int, stdDev float64) *BollingerBands {
+	if len(klines) < period {
+		return nil
+	}
+
+	window := klines[len(klines)-period:]
+	sum := 0.0
+	for _, k := range window {
+		sum += k.Close
+	}
+	middle := sum / float64(period)
+
+	variance := 0.0
+	for _, k := range window {
+		variance += (k.Close - middle) * (k.Close - middle)
+	}
+	sd := math.Sqrt(variance / float64(period))
+
+	bands := &BollingerBands{
+		Upper:  middle + stdDev*sd,
+		Middle: middle,
+		Lower:  middle - stdDev*sd,
+	}
+	if middle != 0 {
+		bands.Bandwidth = (bands.Upper - bands.Lower) / middle * 100
+	}
+	if bands.Upper != bands.Lower {
+		bands.PercentB = (klines[len(klines)-1].Close - bands.Lower) / (bands.Upper - bands.Lower)
+	}
+	return bands
+}
+
+// calculateVWAP 计算当日VWAP和锚定VWAP（锚点为窗口内最高点和最低点）
+func calculateVWAP(klines []Kline) *VWAPData {
+	if len(klines) == 0 {
+		return nil
+	}
+
+	// 当日起点（UTC 0点）
+	last := time.UnixMilli(klines[len(klines)-1].OpenTime).UTC()
+	sessionStart := time.Date(last.Year(), last.Month(), last.Day(), 0, 0, 0, 0, time.UTC).UnixMilli()
+	sessionIdx := len(klines) - 1
+	for sessionIdx > 0 && klines[sessionIdx-1].OpenTime >= sessionStart {
+		sessionIdx--
+	}
+
+	highIdx, lowIdx := 0, 0
+	for i, k := range klines {
+		if k.High > klines[highIdx].High {
+			highIdx = i
+		}
+		if k.Low < klines[lowIdx].Low {
+			lowIdx = i
+		}
+	}
+
+	return &VWAPData{
+		Session:      anchoredVWAP(klines, sessionIdx),
+		AnchoredHigh: anchoredVWAP(klines, highIdx),
+		AnchoredLow:  anchoredVWAP(klines, lowIdx),
+	}
+}
+
+// anchoredVWAP 从 anchor 位置开始计算VWAP（典型价格 (H+L+C)/3 加权）
+func anchoredVWAP(klines []Kline, anchor int) float64 {
+	pv, volume := 0.0, 0.0
+	for _, k := range klines[anchor:] {
+		typical := (k.High + k.Low + k.Close) / 3
+		pv += typical * k.Volume
+		volume += k.Volume
+	}
+	if volume == 0 {
+		return klines[len(klines)-1].Close
+	}
+	return pv / volume
+}
+
+// rsiSeries 计算RSI序列（Wilder平滑），返回值从第 period 根K线开始
+func rsiSeries(klines []Kline, period int) []float64 {
+	if len(klines) <= period {
+		return nil
+	}
+
+	gains, losses := 0.0, 0.0
+	for i := 1; i <= period; i++ {
+		change := klines[i].Close - klines[i-1].Close
+		if change > 0 {
+			gains += change
+		} else {
+			losses -= change
+		}
+	}
+	avgGain := gains / float64(period)
+	avgLoss := losses / float64(period)
+
+	rsi := func() float64 {
+		if avgLoss == 0 {
+			return 100
+		}
+		return 100 - 100/(1+avgGain/avgLoss)
+	}
+
+	series := make([]float64, 0, len(klines)-period)
+	series = append(series, rsi())
+	for i := period + 1; i < len(klines); i++ {
+		change := klines[i].Close - klines[i-1].Close
+		gain, loss := math.Max(change, 0), math.Max(-change, 0)
+		avgGain = (avgGain*float64(period-1) + gain) / float64(period)
+		avgLoss = (avgLoss*float64(period-1) + loss) / float64(period)
+		series = append(series, rsi())
+	}
+	return series
+}
+
+// sma 计算简单移动平均序列
+func sma(values []float64, period int) []float64 {
+	if len(values) < period {
+		return nil
+	}
+	result := make([]float64, 0, len(values)-period+1)
+	sum := 0.0
+	for i, v := range values {
+		sum += v
+		if i >= period {
+			sum -= values[i-period]
+		}
+		if i >= period-1 {
+			result = append(result, sum/float64(period))
+		}
+	}
+	return result
+}
+
+// calculateStochRSI 计算随机RSI
+func calculateStochRSI(klines []Kline, rsiPeriod, stochPeriod, smoothK, smoothD int) *StochRSIData {
+	rsi := rsiSeries(klines, rsiPeriod)
+	if len(rsi) < stochPeriod {
+		return nil
+	}
+
+	stoch := make([]float64, 0, len(rsi)-stochPeriod+1)
+	for i := stochPeriod - 1; i < len(rsi); i++ {
+		lowest, highest := rsi[i], rsi[i]
+		for _, v := range rsi[i-stochPeriod+1 : i+1] {
+			lowest = math.Min(lowest, v)
+			highest = math.Max(highest, v)
+		}
+		if highest == lowest {
+			stoch = append(stoch, 0)
+		} else {
+			stoch = append(stoch, (rsi[i]-lowest)/(highest-lowest)*100)
+		}
+	}
+
+	k := sma(stoch, smoothK)
+	d := sma(k, smoothD)
+	if len(d) == 0 {
+		return nil
+	}
+	return &StochRSIData{K: k[len(k)-1], D: d[len(d)-1]}
+}
+
+// trueRange 计算第 i 根K线的真实波幅
+func trueRange(klines []Kline, i int) float64 {
+	high, low, prevClose := klines[i].High, klines[i].Low, klines[i-1].Close
+	return math.Max(high-low, math.Max(math.Abs(high-prevClose), math.Abs(low-prevClose)))
+}
+
+// calculateADX 计算ADX/DMI（Wilder平滑）
+func calculateADX(klines []Kline, period int) *ADXData {
+	if len(klines) < 2*period+1 {
+		return nil
+	}
+
+	var smoothTR, smoothPlusDM, smoothMinusDM float64
+	var plusDI, minusDI, adx float64
+	dxSum := 0.0
+	for i := 1; i < len(klines); i++ {
+		upMove := klines[i].High - klines[i-1].High
+		downMove := klines[i-1].Low - klines[i].Low
+		plusDM, minusDM := 0.0, 0.0
+		if upMove > downMove && upMove > 0 {
+			plusDM = upMove
+		}
+		if downMove > upMove && downMove > 0 {
+			minusDM = downMove
+		}
+		tr := trueRange(klines, i)
+
+		if i <= period {
+			// 前 period 根累加作为初始值
+			smoothTR += tr
+			smoothPlusDM += plusDM
+			smoothMinusDM += minusDM
+			if i < period {
+				continue
+			}
+		} else {
+			smoothTR = smoothTR - smoothTR/float64(period) + tr
+			smoothPlusDM = smoothPlusDM - smoothPlusDM/float64(period) + plusDM
+			smoothMinusDM = smoothMinusDM - smoothMinusDM/float64(period) + minusDM
+		}
+
+		if smoothTR == 0 {
+			plusDI, minusDI = 0, 0
+		} else {
+			plusDI = 100 * smoothPlusDM / smoothTR
+			minusDI = 100 * smoothMinusDM / smoothTR
+		}
+		dx := 0.0
+		if plusDI+minusDI != 0 {
+			dx = 100 * math.Abs(plusDI-minusDI) / (plusDI + minusDI)
+		}
+
+		// 第一个ADX为前 period 个DX的平均值，之后Wilder平滑
+		n := i - period + 1
+		switch {
+		case n < period:
+			dxSum += dx
+		case n == period:
+			adx = (dxSum + dx) / float64(period)
+		default:
+			adx = (adx*float64(period-1) + dx) / float64(period)
+		}
+	}
+
+	return &ADXData{ADX: adx, PlusDI: plusDI, MinusDI: minusDI}
+}
+
+// calculateSupertrend 计算超级趋势
+func calculateSupertrend(klines []Kline, period int, multiplier float64) *SupertrendData {
+	if len(klines) <= period {
+		return nil
+	}
+
+	// 初始ATR为前 period 个TR的平均值，之后Wilder平滑
+	atr := 0.0
+	for i := 1; i <= period; i++ {
+		atr += trueRange(klines, i)
+	}
+	atr /= float64(period)
+
+	var finalUpper, finalLower float64
+	uptrend := true
+	trendStart := period
+	for i := period; i < len(klines); i++ {
+		if i > period {
+			atr = (atr*float64(period-1) + trueRange(klines, i)) / float64(period)
+		}
+		hl2 := (klines[i].High + klines[i].Low) / 2
+		basicUpper := hl2 + multiplier*atr
+		basicLower := hl2 - multiplier*atr
+
+		if i == period {
+			finalUpper, finalLower = basicUpper, basicLower
+			uptrend = klines[i].Close >= hl2
+			continue
+		}
+
+		prevClose := klines[i-1].Close
+		if basicUpper < finalUpper || prevClose > finalUpper {
+			finalUpper = basicUpper
+		}
+		if basicLower > finalLower || prevClose < finalLower {
+			finalLower = basicLower
+		}
+
+		prevUptrend := uptrend
+		if uptrend && klines[i].Close < finalLower {
+			uptrend = false
+		} else if !uptrend && klines[i].Close > finalUpper {
+			uptrend = true
+		}
+		if uptrend != prevUptrend {
+			trendStart = i
+		}
+	}
+
+	result := &SupertrendData{Uptrend: uptrend, BarsInTrend: len(klines) - trendStart}
+	if uptrend {
+		result.Value = finalLower
+	} else {
+		result.Value = finalUpper
+	}
+	return result
+}
+
+// midpoint 计算 [start, end) 区间最高价与最低价的中值
+func midpoint(klines []Kline, start, end int) float64 {
+	highest, lowest := klines[start].High, klines[start].Low
+	for _, k := range klines[start:end] {
+		highest = math.Max(highest, k.High)
+		lowest = math.Min(lowest, k.Low)
+	}
+	return (highest + lowest) / 2
+}
+
+// calculateIchimoku 计算一目均衡表（先行带取 kijun 根K线前计算、投射到当前的值）
+func calculateIchimoku(klines []Kline, tenkan, kijun, senkouB int) *IchimokuData {
+	n := len(klines)
+	if n < senkouB+kijun {
+		return nil
+	}
+
+	// 先行带在 kijun 根K线前计算
+	past := n - kijun
+	return &IchimokuData{
+		Tenkan:  midpoint(klines, n-tenkan, n),
+		Kijun:   midpoint(klines, n-kijun, n),
+		SenkouA: (midpoint(klines, past-tenkan, past) + midpoint(klines, past-kijun, past)) / 2,
+		SenkouB: midpoint(klines, past-senkouB, past),
+	}
+}
+
+// calculateOBV 计算能量潮，返回最近 length 个值
+func calculateOBV(klines []Kline, length int) []float64 {
+	if len(klines) == 0 {
+		return nil
+	}
+
+	obv := make([]float64, len(klines))
+	for i := 1; i < len(klines); i++ {
+		switch {
+		case klines[i].Close > klines[i-1].Close:
+			obv[i] = obv[i-1] + klines[i].Volume
+		case klines[i].Close < klines[i-1].Close:
+			obv[i] = obv[i-1] - klines[i].Volume
+		default:
+			obv[i] = obv[i-1]
+		}
+	}
+
+	if len(obv) > length {
+		obv = obv[len(obv)-length:]
+	}
+	return obv
+}
+
+// calculateDonchian 计算唐奇安通道（包含当前K线）
+func calculateDonchian(klines []Kline, period int) *DonchianChannel {
+	if len(klines) < period {
+		return nil
+	}
+
+	window := klines[len(klines)-period:]
+	upper, lower := window[0].High, window[0].Low
+	for _, k := range window {
+		upper = math.Max(upper, k.High)
+		lower = math.Min(lower, k.Low)
+	}
+	return &DonchianChannel{Upper: upper, Middle: (upper + lower) / 2, Lower: lower}
+}
@@ -0,0 +1,242 @@
+package market
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+// generateTrendKlines 生成线性趋势K线（收盘价每根变化 step，高低点为收盘价±1）
+func generateTrendKlines(count int, start, step float64) []Kline {
+	klines := make([]Kline, count)
+	for i := range klines {
+		close := start + float64(i)*step
+		klines[i] = Kline{
+			OpenTime: int64(i) * 180000,
+			Open:     close - step,
+			High:     close + 1,
+			Low:      close - 1,
+			Close:    close,
+			Volume:   100,
+		}
+	}
+	return klines
+}
+
+// TestCalculateBollinger 测试布林带计算
+func TestCalculateBollinger(t *testing.T) {
+	// 收盘价 1..20：均值10.5，总体标准差 sqrt((20²-1)/12)
+	klines := generateTrendKlines(20, 1, 1)
+	b := calculateBollinger(klines, 20, 2)
+	if b == nil {
+		t.Fatal("calculateBollinger returned nil")
+	}
+	sd := math.Sqrt(399.0 / 12)
+	if math.Abs(b.Middle-10.5) > 1e-9 || math.Abs(b.Upper-(10.5+2*sd)) > 1e-9 || math.Abs(b.Lower-(10.5-2*sd)) > 1e-9 {
+		t.Errorf("布林带 = %+v, 期望中轨10.5 标准差%.4f", b, sd)
+	}
+	if b.PercentB <= 0.5 {
+		t.Errorf("上涨趋势中 %%B 应大于0.5, 实际 %.4f", b.PercentB)
+	}
+
+	if calculateBollinger(klines[:10], 20, 2) != nil {
+		t.Error("数据不足时应返回nil")
+	}
+}
+
+// TestCalculateVWAP 测试当日VWAP和锚定VWAP
+func TestCalculateVWAP(t *testing.T) {
+	day := time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC).UnixMilli()
+	klines := []Kline{
+		{OpenTime: day - 3600000, High: 12, Low: 8, Close: 10, Volume: 100}, // 前一日
+		{OpenTime: day, High: 22, Low: 18, Close: 20, Volume: 100},
+		{OpenTime: day + 3600000, High: 32, Low: 28, Close: 30, Volume: 300},
+	}
+
+	v := calculateVWAP(klines)
+	if v == nil {
+		t.Fatal("calculateVWAP returned nil")
+	}
+	// 当日: (20*100 + 30*300) / 400 = 27.5
+	if math.Abs(v.Session-27.5) > 1e-9 {
+		t.Errorf("当日VWAP = %.4f, 期望 27.5", v.Session)
+	}
+	// 锚定最低点（第一根）: (10*100 + 20*100 + 30*300) / 500 = 24
+	if math.Abs(v.AnchoredLow-24) > 1e-9 {
+		t.Errorf("锚定最低点VWAP = %.4f, 期望 24", v.AnchoredLow)
+	}
+	// 锚定最高点（最后一根）= 30
+	if math.Abs(v.AnchoredHigh-30) > 1e-9 {
+		t.Errorf("锚定最高点VWAP = %.4f, 期望 30", v.AnchoredHigh)
+	}
+}
+
+// TestRSISeries_ConsistentWithCalculateRSI 测试RSI序列最后一个值与 calculateRSI 一致
+func TestRSISeries_ConsistentWithCalculateRSI(t *testing.T) {
+	klines := generateTestKlines(60)
+	series := rsiSeries(klines, 14)
+	if len(series) != 60-14 {
+		t.Fatalf("RSI序列长度 = %d, 期望 %d", len(series), 60-14)
+	}
+	if math.Abs(series[len(series)-1]-calculateRSI(klines, 14)) > 1e-9 {
+		t.Errorf("RSI序列最后值 %.6f 与 calculateRSI %.6f 不一致", series[len(series)-1], calculateRSI(klines, 14))
+	}
+}
+
+// TestCalculateStochRSI 测试随机RSI
+func TestCalculateStochRSI(t *testing.T) {
+	// 先跌后涨：末端RSI处于区间高位
+	klines := append(generateTrendKlines(40, 200, -2), generateTrendKlines(20, 122, 3)...)
+	s := calculateStochRSI(klines, 14, 14, 3, 3)
+	if s == nil {
+		t.Fatal("calculateStochRSI returned nil")
+	}
+	if s.K < 80 || s.K > 100 || s.D < 0 || s.D > 100 {
+		t.Errorf("反弹后 StochRSI 应处于高位, 实际 K=%.2f D=%.2f", s.K, s.D)
+	}
+
+	if calculateStochRSI(klines[:20], 14, 14, 3, 3) != nil {
+		t.Error("数据不足时应返回nil")
+	}
+}
+
+// TestCalculateADX 测试ADX/DMI
+func TestCalculateADX(t *testing.T) {
+	up := calculateADX(generateTrendKlines(60, 100, 2), 14)
+	if up == nil {
+		t.Fatal("calculateADX returned nil")
+	}
+	if up.PlusDI <= up.MinusDI || up.ADX < 50 {
+		t.Errorf("强上涨趋势应 +DI > -DI 且 ADX 较高, 实际 %+v", up)
+	}
+
+	down := calculateADX(generateTrendKlines(60, 300, -2), 14)
+	if down.MinusDI <= down.PlusDI {
+		t.Errorf("下跌趋势应 -DI > +DI, 实际 %+v", down)
+	}
+
+	if calculateADX(generateTrendKlines(20, 100, 1), 14) != nil {
+		t.Error("数据不足时应返回nil")
+	}
+}
+
+// TestCalculateSupertrend 测试超级趋势方向和翻转
+func TestCalculateSupertrend(t *testing.T) {
+	up := calculateSupertrend(generateTrendKlines(50, 100, 2), 10, 3)
+	if up == nil || !up.Uptrend || up.Value >= 198 {
+		t.Fatalf("上涨趋势中超级趋势应在价格下方, 实际 %+v", up)
+	}
+
+	// 上涨后急跌：趋势翻转为下跌
+	klines := append(generateTrendKlines(40, 100, 2), generateTrendKlines(10, 160, -5)...)
+	down := calculateSupertrend(klines, 10, 3)
+	if down.Uptrend || down.Value <= klines[len(klines)-1].Close {
+		t.Errorf("急跌后超级趋势应翻转向下且在价格上方, 实际 %+v", down)
+	}
+	if down.BarsInTrend <= 0 || down.BarsInTrend > 10 {
+		t.Errorf("翻转后持续K线数应在急跌区间内, 实际 %d", down.BarsInTrend)
+	}
+}
+
+// TestCalculateIchimoku 测试一目均衡表
+func TestCalculateIchimoku(t *testing.T) {
+	// 收盘价 = i，高低点 = i±1
+	klines := generateTrendKlines(100, 0, 1)
+	ich := calculateIchimoku(klines, 9, 26, 52)
+	if ich == nil {
+		t.Fatal("calculateIchimoku returned nil")
+	}
+
+	// 转换线: 最近9根 最高 100, 最低 90 → 95
+	// 基准线: 最近26根 最高 100, 最低 73 → 86.5
+	// 先行带A: 26根前 (转换线 69 + 基准线 60.5) / 2 = 64.75
+	// 先行带B: 26根前最近52根 最高 74, 最低 21 → 47.5
+	expected := IchimokuData{Tenkan: 95, Kijun: 86.5, SenkouA: 64.75, SenkouB: 47.5}
+	if *ich != expected {
+		t.Errorf("一目均衡表 = %+v, 期望 %+v", *ich, expected)
+	}
+
+	if calculateIchimoku(klines[:70], 9, 26, 52) != nil {
+		t.Error("数据不足时应返回nil")
+	}
+}
+
+// TestCalculateOBV 测试能量潮
+func TestCalculateOBV(t *testing.T) {
+	klines := []Kline{
+		{Close: 10, Volume: 100},
+		{Close: 11, Volume: 200},
+		{Close: 11, Volume: 300},
+		{Close: 9, Volume: 50},
+	}
+	obv := calculateOBV(klines, 3)
+	expected := []float64{200, 200, 150}
+	if len(obv) != len(expected) {
+		t.Fatalf("OBV = %v, 期望 %v", obv, expected)
+	}
+	for i := range expected {
+		if obv[i] != expected[i] {
+			t.Errorf("OBV = %v, 期望 %v", obv, expected)
+			break
+		}
+	}
+}
+
+// TestCalculateDonchian 测试唐奇安通道
+func TestCalculateDonchian(t *testing.T) {
+	klines := generateTrendKlines(30, 0, 1)
+	d := calculateDonchian(klines, 20)
+	// 最近20根: 收盘 10..29，最高 30，最低 9
+	if d == nil || d.Upper != 30 || d.Lower != 9 || d.Middle != 19.5 {
+		t.Errorf("唐奇安通道 = %+v, 期望 30/19.5/9", d)
+	}
+}
+
+// TestCalculateIndicators_Selection 测试只计算选择的扩展指标
+func TestCalculateIndicators_Selection(t *testing.T) {
+	klines := generateTrendKlines(100, 100, 1)
+
+	if calculateIndicators(klines, func(ind string) bool { return indicatorSelected(nil, ind) }) != nil {
+		t.Error("未选择扩展指标时应返回nil")
+	}
+
+	selected := []string{IndicatorBollinger, IndicatorADX}
+	ind := calculateIndicators(klines, func(name string) bool { return indicatorSelected(selected, name) })
+	if ind == nil || ind.Bollinger == nil || ind.ADX == nil {
+		t.Fatalf("应计算已选择的指标, 实际 %+v", ind)
+	}
+	if ind.VWAP != nil || ind.Ichimoku != nil || ind.OBV != nil {
+		t.Errorf("未选择的指标不应计算, 实际 %+v", ind)
+	}
+}
+
+// TestFormat_ExtendedIndicators 测试扩展指标输出到提示词
+func TestFormat_ExtendedIndicators(t *testing.T) {
+	klines := generateTrendKlines(100, 100, 1)
+	all := func(string) bool { return true }
+	data := &Data{
+		Symbol:     "BTCUSDT",
+		Indicators: AllIndicators,
+		Timeframes: map[string]*TimeframeData{
+			"3m": {Timeframe: "3m", Series: calculateIntradaySeries(klines), Indicators: calculateIndicators(klines, all)},
+		},
+	}
+
+	output := Format(data)
+	for _, want := range []string{
+		"Additional indicators (3‑minute timeframe)",
+		"Bollinger Bands (20, 2)",
+		"VWAP: session",
+		"Stochastic RSI",
+		"ADX (14)",
+		"Supertrend (10, 3)",
+		"Ichimoku (9, 26, 52)",
+		"OBV: [",
+		"Donchian Channel (20)",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("输出缺少 %q", want)
+		}
+	}
+}
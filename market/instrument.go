@@ -0,0 +1,153 @@
+package market
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// 计价/保证金资产
+const (
+	QuoteUSDT = "USDT"
+	QuoteUSDC = "USDC"
+)
+
+// ContractPerpetual 永续合约
+const ContractPerpetual = "PERPETUAL"
+
+// knownQuotes 已知的计价资产（按长度从长到短匹配后缀）
+var knownQuotes = []string{QuoteUSDT, QuoteUSDC}
+
+// Instrument 标准化的交易品种
+// 系统内部（决策、持仓、日志）统一使用 Symbol()（Base+Quote），下单时再转换为交易所原生符号
+type Instrument struct {
+	Base         string `json:"base"`          // 基础资产，如 BTC
+	Quote        string `json:"quote"`         // 计价/保证金资产，如 USDT、USDC
+	Exchange     string `json:"exchange"`      // 交易所ID: binance / hyperliquid / aster
+	NativeSymbol string `json:"native_symbol"` // 交易所原生符号，如币安 BTCUSDC、Hyperliquid BTC
+	ContractType string `json:"contract_type"` // 合约类型，如 PERPETUAL
+
+	MinNotional float64 `json:"min_notional,omitempty"` // 交易所最小名义价值（计价资产），0表示未知
+	MinQty      float64 `json:"min_qty,omitempty"`      // 最小下单数量（基础资产），0表示未知
+}
+
+// Symbol 规范交易对符号（Base+Quote）
+func (i Instrument) Symbol() string {
+	return i.Base + i.Quote
+}
+
+// SplitSymbol 拆分交易对为基础资产和计价资产
+// 支持 "BTCUSDT"、"btc/usdc"、"BTC-USDT"、"BTC" 等写法；无法识别计价资产时 quote 为空
+// 返回大写的规范写法；交易所原生符号区分大小写时（如 Hyperliquid 的 kPEPE）应通过 InstrumentSet 的 NativeSymbol 还原
+func SplitSymbol(symbol string) (base, quote string) {
+	symbol = strings.ToUpper(strings.TrimSpace(symbol))
+	symbol = strings.NewReplacer("/", "", "-", "", "_", "", ":", "", " ", "").Replace(symbol)
+
+	for _, q := range knownQuotes {
+		if len(symbol) > len(q) && strings.HasSuffix(symbol, q) {
+			return strings.TrimSuffix(symbol, q), q
+		}
+	}
+	return symbol, ""
+}
+
+// NormalizeSymbol 标准化交易对符号，未带计价资产时使用 defaultQuote
+func NormalizeSymbol(symbol, defaultQuote string) string {
+	base, quote := SplitSymbol(symbol)
+	if quote == "" {
+		quote = defaultQuote
+	}
+	return base + quote
+}
+
+// Normalize 标准化symbol（未带计价资产时默认为USDT交易对）
+func Normalize(symbol string) string {
+	return NormalizeSymbol(symbol, QuoteUSDT)
+}
+
+// ReferenceSymbol 币安行情数据使用的参考交易对
+// 币安数据源取自 USDT 永续，其他计价资产的品种按基础资产映射
+func ReferenceSymbol(symbol string) string {
+	base, _ := SplitSymbol(symbol)
+	return base + QuoteUSDT
+}
+
+// DefaultQuote 交易所的默认计价资产
+func DefaultQuote(exchange string) string {
+	if exchange == "hyperliquid" {
+		return QuoteUSDC
+	}
+	return QuoteUSDT
+}
+
+// IsValidSymbol 交易对格式是否合法（基础资产只能包含字母和数字）
+func IsValidSymbol(symbol string) bool {
+	base, _ := SplitSymbol(symbol)
+	if base == "" {
+		return false
+	}
+	for _, c := range base {
+		if (c < 'A' || c > 'Z') && (c < '0' || c > '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// InstrumentSet 某个交易所的可交易品种列表（用于符号映射和决策校验）
+type InstrumentSet struct {
+	exchange string
+	bySymbol map[string]Instrument   // 规范符号 -> 品种
+	byBase   map[string][]Instrument // 基础资产 -> 品种
+}
+
+// NewInstrumentSet 根据交易所返回的品种列表创建索引
+func NewInstrumentSet(exchange string, instruments []Instrument) *InstrumentSet {
+	set := &InstrumentSet{
+		exchange: exchange,
+		bySymbol: make(map[string]Instrument, len(instruments)),
+		byBase:   make(map[string][]Instrument),
+	}
+	for _, inst := range instruments {
+		if _, exists := set.bySymbol[inst.Symbol()]; exists {
+			continue
+		}
+		set.bySymbol[inst.Symbol()] = inst
+		set.byBase[inst.Base] = append(set.byBase[inst.Base], inst)
+	}
+	return set
+}
+
+// Len 品种数量
+func (s *InstrumentSet) Len() int {
+	return len(s.bySymbol)
+}
+
+// Symbols 所有规范符号（已排序）
+func (s *InstrumentSet) Symbols() []string {
+	symbols := make([]string, 0, len(s.bySymbol))
+	for symbol := range s.bySymbol {
+		symbols = append(symbols, symbol)
+	}
+	sort.Strings(symbols)
+	return symbols
+}
+
+// Resolve 将任意写法的交易对解析为该交易所的真实品种
+// 1. 未带计价资产时使用交易所默认计价资产
+// 2. 精确匹配规范符号
+// 3. 该基础资产在交易所只有一个品种时直接使用（如 Hyperliquid 只有 USDC 计价，BTCUSDT -> BTCUSDC）
+func (s *InstrumentSet) Resolve(symbol string) (Instrument, error) {
+	base, quote := SplitSymbol(symbol)
+	if quote == "" {
+		quote = DefaultQuote(s.exchange)
+	}
+
+	if inst, ok := s.bySymbol[base+quote]; ok {
+		return inst, nil
+	}
+	if candidates := s.byBase[base]; len(candidates) == 1 {
+		return candidates[0], nil
+	}
+	return Instrument{}, fmt.Errorf("交易所 %s 不支持交易对 %s", s.exchange, symbol)
+}
@@ -0,0 +1,115 @@
+package market
+
+import "testing"
+
+// TestSplitSymbol 测试交易对拆分
+func TestSplitSymbol(t *testing.T) {
+	tests := []struct {
+		symbol string
+		base   string
+		quote  string
+	}{
+		{"BTCUSDT", "BTC", "USDT"},
+		{"btcusdc", "BTC", "USDC"},
+		{"ETH/USDC", "ETH", "USDC"},
+		{" sol-usdt ", "SOL", "USDT"},
+		{"HYPE", "HYPE", ""},
+		{"USDC", "USDC", ""},
+	}
+
+	for _, tt := range tests {
+		base, quote := SplitSymbol(tt.symbol)
+		if base != tt.base || quote != tt.quote {
+			t.Errorf("SplitSymbol(%q) = (%q, %q), 期望 (%q, %q)", tt.symbol, base, quote, tt.base, tt.quote)
+		}
+	}
+}
+
+// TestNormalize 测试symbol标准化（未带计价资产时默认USDT，保留USDC）
+func TestNormalize(t *testing.T) {
+	tests := map[string]string{
+		"btc":      "BTCUSDT",
+		"BTCUSDT":  "BTCUSDT",
+		"BTCUSDC":  "BTCUSDC",
+		"eth/usdc": "ETHUSDC",
+	}
+	for input, expected := range tests {
+		if got := Normalize(input); got != expected {
+			t.Errorf("Normalize(%q) = %q, 期望 %q", input, got, expected)
+		}
+	}
+
+	if got := NormalizeSymbol("BTC", DefaultQuote("hyperliquid")); got != "BTCUSDC" {
+		t.Errorf("Hyperliquid 默认计价资产应为USDC, 实际: %s", got)
+	}
+	if got := ReferenceSymbol("BTCUSDC"); got != "BTCUSDT" {
+		t.Errorf("ReferenceSymbol(BTCUSDC) = %s, 期望 BTCUSDT", got)
+	}
+}
+
+// TestIsValidSymbol 测试交易对格式校验
+func TestIsValidSymbol(t *testing.T) {
+	for _, symbol := range []string{"BTC", "BTCUSDT", "ethusdc", "1000PEPEUSDT"} {
+		if !IsValidSymbol(symbol) {
+			t.Errorf("%s 应为合法交易对", symbol)
+		}
+	}
+	for _, symbol := range []string{"", "BTC$", "比特币USDT"} {
+		if IsValidSymbol(symbol) {
+			t.Errorf("%q 应为非法交易对", symbol)
+		}
+	}
+}
+
+// TestInstrumentSet_Resolve 测试按交易所品种列表解析交易对
+func TestInstrumentSet_Resolve(t *testing.T) {
+	binance := NewInstrumentSet("binance", []Instrument{
+		{Base: "BTC", Quote: QuoteUSDT, Exchange: "binance", NativeSymbol: "BTCUSDT", ContractType: ContractPerpetual},
+		{Base: "BTC", Quote: QuoteUSDC, Exchange: "binance", NativeSymbol: "BTCUSDC", ContractType: ContractPerpetual},
+		{Base: "SOL", Quote: QuoteUSDC, Exchange: "binance", NativeSymbol: "SOLUSDC", ContractType: ContractPerpetual},
+	})
+	hyperliquid := NewInstrumentSet("hyperliquid", []Instrument{
+		{Base: "BTC", Quote: QuoteUSDC, Exchange: "hyperliquid", NativeSymbol: "BTC", ContractType: ContractPerpetual},
+		{Base: "HYPE", Quote: QuoteUSDC, Exchange: "hyperliquid", NativeSymbol: "HYPE", ContractType: ContractPerpetual},
+	})
+
+	tests := []struct {
+		name     string
+		set      *InstrumentSet
+		symbol   string
+		expected string
+		native   string
+		wantErr  bool
+	}{
+		{"币安USDT合约", binance, "BTCUSDT", "BTCUSDT", "BTCUSDT", false},
+		{"币安USDC合约", binance, "btcusdc", "BTCUSDC", "BTCUSDC", false},
+		{"币安默认USDT", binance, "BTC", "BTCUSDT", "BTCUSDT", false},
+		{"币安唯一品种映射", binance, "SOLUSDT", "SOLUSDC", "SOLUSDC", false},
+		{"币安不支持", binance, "HYPEUSDT", "", "", true},
+		{"Hyperliquid映射USDC", hyperliquid, "BTCUSDT", "BTCUSDC", "BTC", false},
+		{"Hyperliquid原生币种", hyperliquid, "HYPE", "HYPEUSDC", "HYPE", false},
+		{"Hyperliquid不支持", hyperliquid, "DOGEUSDT", "", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inst, err := tt.set.Resolve(tt.symbol)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("期望返回错误, 实际解析为 %s", inst.Symbol())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("解析失败: %v", err)
+			}
+			if inst.Symbol() != tt.expected || inst.NativeSymbol != tt.native {
+				t.Errorf("解析结果 %s (%s), 期望 %s (%s)", inst.Symbol(), inst.NativeSymbol, tt.expected, tt.native)
+			}
+		})
+	}
+
+	if got := binance.Symbols(); len(got) != 3 || got[0] != "BTCUSDC" {
+		t.Errorf("Symbols() = %v", got)
+	}
+}
@@ -0,0 +1,444 @@
+package market
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+const (
+	klineHistorySize     = 100           // 内存中每个交易对/周期保留的K线数
+	klineFetchLimit      = 1500          // 币安单次K线请求上限
+	DefaultRetentionBars = 5000          // 本地库每个交易对/周期默认保留的K线数
+	klinePruneInterval   = 6 * time.Hour // 清理过期K线的间隔
+
+	klineWriteQueueSize    = 1000 // 待写入本地库的K线队列长度
+	klineBackfillQueueSize = 1000 // 待补齐的缺口队列长度
+	klineBackfillWorkers   = 4    // 并发补齐缺口的协程数
+)
+
+// klineWrite 待写入本地库的已收盘K线（done 非nil时为刷新标记，写完之前的K线后关闭）
+type klineWrite struct {
+	symbol    string
+	timeframe string
+	klines    []Kline
+	done      chan struct{}
+}
+
+// klineBackfill 待补齐的缺失K线区间（开盘时间，首尾均包含）
+type klineBackfill struct {
+	symbol    string
+	timeframe string
+	from      int64
+	to        int64
+}
+
+// KlineStore 本地K线库（SQLite），按交易对/周期保存已收盘K线，重启后读库并补齐缺口
+type KlineStore struct {
+	db            *sql.DB
+	retentionBars int
+}
+
+// KlineGap 缺失的K线区间（开盘时间，毫秒，首尾均包含）
+type KlineGap struct {
+	From int64
+	To   int64
+}
+
+// OpenKlineStore 打开（或创建）本地K线库，retentionBars<=0 时使用默认保留数量
+func OpenKlineStore(path string, retentionBars int) (*KlineStore, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("打开K线库失败: %w", err)
+	}
+	if _, err := db.Exec("PRAGMA journal_mode=WAL"); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("启用WAL模式失败: %w", err)
+	}
+	if _, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS klines (
+			symbol TEXT NOT NULL,
+			timeframe TEXT NOT NULL,
+			open_time INTEGER NOT NULL,
+			open REAL NOT NULL,
+			high REAL NOT NULL,
+			low REAL NOT NULL,
+			close REAL NOT NULL,
+			volume REAL NOT NULL,
+			close_time INTEGER NOT NULL,
+			quote_volume REAL NOT NULL DEFAULT 0,
+			trades INTEGER NOT NULL DEFAULT 0,
+			taker_buy_base_volume REAL NOT NULL DEFAULT 0,
+			taker_buy_quote_volume REAL NOT NULL DEFAULT 0,
+			PRIMARY KEY (symbol, timeframe, open_time)
+		)
+	`); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("创建K线表失败: %w", err)
+	}
+	// 交易所无法提供的K线区间（如上市之前、维护期间），Load 不再重复请求
+	if _, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS kline_gaps (
+			symbol TEXT NOT NULL,
+			timeframe TEXT NOT NULL,
+			from_time INTEGER NOT NULL,
+			to_time INTEGER NOT NULL,
+			PRIMARY KEY (symbol, timeframe, from_time)
+		)
+	`); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("创建K线缺口表失败: %w", err)
+	}
+
+	if retentionBars <= 0 {
+		retentionBars = DefaultRetentionBars
+	}
+	return &KlineStore{db: db, retentionBars: retentionBars}, nil
+}
+
+// Close 关闭K线库
+func (s *KlineStore) Close() error {
+	return s.db.Close()
+}
+
+// Save 写入K线（相同开盘时间覆盖）
+func (s *KlineStore) Save(symbol, timeframe string, klines []Kline) error {
+	if len(klines) == 0 {
+		return nil
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	stmt, err := tx.Prepare(`
+		INSERT OR REPLACE INTO klines (symbol, timeframe, open_time, open, high, low, close, volume,
+			close_time, quote_volume, trades, taker_buy_base_volume, taker_buy_quote_volume)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+
+	for _, k := range klines {
+		if _, err := stmt.Exec(symbol, timeframe, k.OpenTime, k.Open, k.High, k.Low, k.Close, k.Volume,
+			k.CloseTime, k.QuoteVolume, k.Trades, k.TakerBuyBaseVolume, k.TakerBuyQuoteVolume); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Range 读取开盘时间在 [from, to] 内的K线（按时间升序）
+func (s *KlineStore) Range(symbol, timeframe string, from, to int64) ([]Kline, error) {
+	rows, err := s.db.Query(`
+		SELECT open_time, open, high, low, close, volume, close_time, quote_volume, trades,
+			taker_buy_base_volume, taker_buy_quote_volume
+		FROM klines WHERE symbol = ? AND timeframe = ? AND open_time >= ? AND open_time <= ?
+		ORDER BY open_time
+	`, symbol, timeframe, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var klines []Kline
+	for rows.Next() {
+		var k Kline
+		if err := rows.Scan(&k.OpenTime, &k.Open, &k.High, &k.Low, &k.Close, &k.Volume, &k.CloseTime,
+			&k.QuoteVolume, &k.Trades, &k.TakerBuyBaseVolume, &k.TakerBuyQuoteVolume); err != nil {
+			return nil, err
+		}
+		klines = append(klines, k)
+	}
+	return klines, rows.Err()
+}
+
+// Prune 按保留数量清理每个交易对/周期最旧的K线（及保留范围之前的缺口记录），返回删除的K线条数
+func (s *KlineStore) Prune() (int64, error) {
+	var total int64
+	for timeframe, d := range timeframeDurations {
+		window := int64(s.retentionBars-1) * d.Milliseconds()
+		result, err := s.db.Exec(`
+			DELETE FROM klines WHERE timeframe = ? AND open_time < (
+				SELECT MAX(k2.open_time) FROM klines k2
+				WHERE k2.symbol = klines.symbol AND k2.timeframe = klines.timeframe
+			) - ?
+		`, timeframe, window)
+		if err != nil {
+			return total, err
+		}
+		n, _ := result.RowsAffected()
+		total += n
+
+		if _, err := s.db.Exec(`
+			DELETE FROM kline_gaps WHERE timeframe = ? AND to_time < (
+				SELECT MAX(k.open_time) FROM klines k
+				WHERE k.symbol = kline_gaps.symbol AND k.timeframe = kline_gaps.timeframe
+			) - ?
+		`, timeframe, window); err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// unfillableGaps 读取与 [from, to] 重叠的、已确认交易所无法提供的K线区间（按时间升序）
+func (s *KlineStore) unfillableGaps(symbol, timeframe string, from, to int64) ([]KlineGap, error) {
+	rows, err := s.db.Query(`
+		SELECT from_time, to_time FROM kline_gaps
+		WHERE symbol = ? AND timeframe = ? AND to_time >= ? AND from_time <= ?
+		ORDER BY from_time
+	`, symbol, timeframe, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var gaps []KlineGap
+	for rows.Next() {
+		var gap KlineGap
+		if err := rows.Scan(&gap.From, &gap.To); err != nil {
+			return nil, err
+		}
+		gaps = append(gaps, gap)
+	}
+	return gaps, rows.Err()
+}
+
+// recordUnfillableGaps 记录交易所无法提供的K线区间
+func (s *KlineStore) recordUnfillableGaps(symbol, timeframe string, gaps []KlineGap) error {
+	for _, gap := range gaps {
+		if _, err := s.db.Exec(`
+			INSERT OR REPLACE INTO kline_gaps (symbol, timeframe, from_time, to_time) VALUES (?, ?, ?, ?)
+		`, symbol, timeframe, gap.From, gap.To); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Load 读取 [from, to] 内的K线，缺失部分通过REST补齐并写入本地库
+// 交易所也没有的区间会被记录下来，之后的 Load 不再重复请求
+// to 应为已收盘K线的开盘时间（未收盘K线不入库，否则之后不会再被补齐）
+func (s *KlineStore) Load(apiClient *APIClient, symbol, timeframe string, from, to int64) ([]Kline, error) {
+	d, ok := TimeframeDuration(timeframe)
+	if !ok {
+		return nil, fmt.Errorf("不支持的K线周期: %s", timeframe)
+	}
+	stored, err := s.Range(symbol, timeframe, from, to)
+	if err != nil {
+		return nil, err
+	}
+	known, err := s.unfillableGaps(symbol, timeframe, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	gaps := subtractGaps(FindGaps(stored, d, from, to), known, d)
+	if len(gaps) == 0 {
+		return stored, nil
+	}
+	for _, gap := range gaps {
+		klines, err := fetchKlineRange(apiClient, symbol, timeframe, gap.From, gap.To)
+		if err != nil {
+			return nil, fmt.Errorf("补齐 %s %s K线失败: %w", symbol, timeframe, err)
+		}
+		if err := s.Save(symbol, timeframe, klines); err != nil {
+			return nil, err
+		}
+		if missing := FindGaps(klines, d, gap.From, gap.To); len(missing) > 0 {
+			if err := s.recordUnfillableGaps(symbol, timeframe, missing); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return s.Range(symbol, timeframe, from, to)
+}
+
+// subtractGaps 从缺失区间中去掉已确认无法补齐的区间（known 需按时间升序）
+func subtractGaps(gaps, known []KlineGap, interval time.Duration) []KlineGap {
+	step := interval.Milliseconds()
+	var result []KlineGap
+	for _, gap := range gaps {
+		from := gap.From
+		for _, k := range known {
+			if k.To < from || k.From > gap.To {
+				continue
+			}
+			if k.From > from {
+				result = append(result, KlineGap{From: from, To: k.From - step})
+			}
+			from = k.To + step
+		}
+		if from <= gap.To {
+			result = append(result, KlineGap{From: from, To: gap.To})
+		}
+	}
+	return result
+}
+
+// FindGaps 对比期望的开盘时间，找出 [from, to] 内缺失的K线区间（klines 需按时间升序）
+func FindGaps(klines []Kline, interval time.Duration, from, to int64) []KlineGap {
+	step := interval.Milliseconds()
+	if step <= 0 || from > to {
+		return nil
+	}
+	from = alignOpenTime(from+step-1, interval) // 向上对齐到第一个期望的开盘时间
+
+	var gaps []KlineGap
+	next := from
+	for _, k := range klines {
+		if k.OpenTime < next {
+			continue
+		}
+		if k.OpenTime > to {
+			break
+		}
+		if k.OpenTime > next {
+			gaps = append(gaps, KlineGap{From: next, To: k.OpenTime - step})
+		}
+		next = k.OpenTime + step
+	}
+	if next <= to {
+		gaps = append(gaps, KlineGap{From: next, To: alignOpenTime(to, interval)})
+	}
+	return gaps
+}
+
+// alignOpenTime 对齐到所在K线的开盘时间（币安K线按UTC零点对齐）
+func alignOpenTime(ms int64, interval time.Duration) int64 {
+	step := interval.Milliseconds()
+	return ms - ms%step
+}
+
+// lastClosedOpenTime 最近一根已收盘K线的开盘时间
+func lastClosedOpenTime(now time.Time, interval time.Duration) int64 {
+	return alignOpenTime(now.UnixMilli(), interval) - interval.Milliseconds()
+}
+
+// fetchKlineRange 分批获取开盘时间在 [from, to] 内的K线
+func fetchKlineRange(apiClient *APIClient, symbol, timeframe string, from, to int64) ([]Kline, error) {
+	var result []Kline
+	for from <= to {
+		klines, err := apiClient.GetKlinesRange(symbol, timeframe, from, to, klineFetchLimit)
+		if err != nil {
+			return nil, err
+		}
+		if len(klines) == 0 {
+			break
+		}
+		result = append(result, klines...)
+		from = klines[len(klines)-1].OpenTime + 1
+	}
+	return result, nil
+}
+
+// mergeKlines 按开盘时间合并两组K线（后者覆盖前者），保留最近 limit 根
+func mergeKlines(base, extra []Kline, limit int) []Kline {
+	byOpenTime := make(map[int64]Kline, len(base)+len(extra))
+	for _, k := range base {
+		byOpenTime[k.OpenTime] = k
+	}
+	for _, k := range extra {
+		byOpenTime[k.OpenTime] = k
+	}
+	merged := make([]Kline, 0, len(byOpenTime))
+	for _, k := range byOpenTime {
+		merged = append(merged, k)
+	}
+	sort.Slice(merged, func(i, j int) bool { return merged[i].OpenTime < merged[j].OpenTime })
+	if limit > 0 && len(merged) > limit {
+		merged = merged[len(merged)-limit:]
+	}
+	return merged
+}
+
+// runKlineRetention 定期清理本地K线库
+func (m *WSMonitor) runKlineRetention() {
+	ticker := time.NewTicker(klinePruneInterval)
+	defer ticker.Stop()
+	for {
+		if n, err := m.klineStore.Prune(); err != nil {
+			log.Printf("⚠️  清理本地K线失败: %v", err)
+		} else if n > 0 {
+			log.Printf("🧹 已清理 %d 条过期K线", n)
+		}
+		<-ticker.C
+	}
+}
+
+// startKlineWorkers 启动本地库写入和缺口补齐的后台协程（只启动一次）
+func (m *WSMonitor) startKlineWorkers() {
+	m.klineWorkersOnce.Do(func() {
+		m.klineWrites = make(chan klineWrite, klineWriteQueueSize)
+		m.klineBackfills = make(chan klineBackfill, klineBackfillQueueSize)
+		go m.runKlineWriter()
+		for i := 0; i < klineBackfillWorkers; i++ {
+			go m.runKlineBackfiller()
+		}
+	})
+}
+
+// runKlineWriter 按顺序将已收盘K线写入本地库
+func (m *WSMonitor) runKlineWriter() {
+	for w := range m.klineWrites {
+		if w.done != nil {
+			close(w.done)
+			continue
+		}
+		if err := m.klineStore.Save(w.symbol, w.timeframe, w.klines); err != nil {
+			log.Printf("⚠️  保存 %s %s K线失败: %v", w.symbol, w.timeframe, err)
+		}
+	}
+}
+
+// runKlineBackfiller 通过REST补齐连接中断期间缺失的K线
+func (m *WSMonitor) runKlineBackfiller() {
+	for b := range m.klineBackfills {
+		m.backfillKlines(b.symbol, b.timeframe, b.from, b.to)
+	}
+}
+
+// persistKlines 将已收盘K线加入本地库写入队列（未启用本地库时忽略）
+// 队列已满时丢弃，缺失的K线之后由 Load 从REST补齐
+func (m *WSMonitor) persistKlines(symbol, timeframe string, klines []Kline) {
+	if m.klineStore == nil || len(klines) == 0 {
+		return
+	}
+	m.startKlineWorkers()
+	select {
+	case m.klineWrites <- klineWrite{symbol: symbol, timeframe: timeframe, klines: klines}:
+	default:
+		log.Printf("⚠️  K线写入队列已满，丢弃 %s %s K线 %d 条", symbol, timeframe, len(klines))
+	}
+}
+
+// scheduleBackfill 将缺失的K线区间加入补齐队列，不阻塞 WebSocket 读循环
+func (m *WSMonitor) scheduleBackfill(symbol, timeframe string, from, to int64) {
+	m.startKlineWorkers()
+	select {
+	case m.klineBackfills <- klineBackfill{symbol: symbol, timeframe: timeframe, from: from, to: to}:
+	default:
+		log.Printf("⚠️  K线补齐队列已满，跳过 %s %s 缺口", symbol, timeframe)
+	}
+}
+
+// flushKlineWrites 等待队列中已有的K线写入本地库
+func (m *WSMonitor) flushKlineWrites() {
+	m.startKlineWorkers()
+	done := make(chan struct{})
+	m.klineWrites <- klineWrite{done: done}
+	<-done
+}
+
+// SetKlineStore 启用本地K线库（需在 Start 之前调用）
+func (m *WSMonitor) SetKlineStore(store *KlineStore) {
+	m.klineStore = store
+}
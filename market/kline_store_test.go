@@ -0,0 +1,233 @@
+package market
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// generateKlinesAt 从 start 开始生成 count 根连续的3分钟K线
+func generateKlinesAt(start int64, count int) []Kline {
+	step := (3 * time.Minute).Milliseconds()
+	klines := make([]Kline, count)
+	for i := range klines {
+		openTime := start + int64(i)*step
+		klines[i] = Kline{OpenTime: openTime, CloseTime: openTime + step - 1, Open: 100, High: 101, Low: 99, Close: float64(100 + i), Volume: 10}
+	}
+	return klines
+}
+
+func openTestKlineStore(t *testing.T, retentionBars int) *KlineStore {
+	store, err := OpenKlineStore(filepath.Join(t.TempDir(), "klines.db"), retentionBars)
+	if err != nil {
+		t.Fatalf("打开K线库失败: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+// TestFindGaps 测试按期望开盘时间检测缺失K线
+func TestFindGaps(t *testing.T) {
+	step := (3 * time.Minute).Milliseconds()
+	klines := generateKlinesAt(0, 10)
+	// 去掉第3、4根和第8根
+	klines = append(append(klines[:3:3], klines[5:8]...), klines[9:]...)
+
+	gaps := FindGaps(klines, 3*time.Minute, 0, 12*step)
+	expected := []KlineGap{
+		{From: 3 * step, To: 4 * step},
+		{From: 8 * step, To: 8 * step},
+		{From: 10 * step, To: 12 * step}, // 尾部缺失
+	}
+	if !reflect.DeepEqual(gaps, expected) {
+		t.Errorf("缺口 = %+v, 期望 %+v", gaps, expected)
+	}
+
+	// 未对齐的起点向上对齐，空数据时整个区间缺失
+	if gaps := FindGaps(nil, 3*time.Minute, 1, 2*step+5); !reflect.DeepEqual(gaps, []KlineGap{{From: step, To: 2 * step}}) {
+		t.Errorf("空数据缺口 = %+v", gaps)
+	}
+	if gaps := FindGaps(generateKlinesAt(0, 5), 3*time.Minute, 0, 4*step); len(gaps) != 0 {
+		t.Errorf("完整数据不应有缺口: %+v", gaps)
+	}
+}
+
+// TestKlineStore_SaveRangePrune 测试K线写入、读取、覆盖和按数量保留
+func TestKlineStore_SaveRangePrune(t *testing.T) {
+	store := openTestKlineStore(t, 5)
+	step := (3 * time.Minute).Milliseconds()
+	klines := generateKlinesAt(0, 8)
+
+	if err := store.Save("BTCUSDT", "3m", klines); err != nil {
+		t.Fatalf("保存失败: %v", err)
+	}
+	if err := store.Save("ETHUSDT", "3m", klines[:2]); err != nil {
+		t.Fatalf("保存失败: %v", err)
+	}
+
+	// 覆盖同一开盘时间
+	updated := klines[7]
+	updated.Close = 999
+	if err := store.Save("BTCUSDT", "3m", []Kline{updated}); err != nil {
+		t.Fatalf("覆盖失败: %v", err)
+	}
+
+	got, err := store.Range("BTCUSDT", "3m", 2*step, 7*step)
+	if err != nil {
+		t.Fatalf("读取失败: %v", err)
+	}
+	if len(got) != 6 || got[0] != klines[2] || got[5].Close != 999 {
+		t.Errorf("读取结果不符: %+v", got)
+	}
+
+	// 每个交易对/周期只保留最近5根
+	n, err := store.Prune()
+	if err != nil || n != 3 {
+		t.Errorf("清理 = %d, %v, 期望删除3条", n, err)
+	}
+	if got, _ := store.Range("BTCUSDT", "3m", 0, 7*step); len(got) != 5 || got[0].OpenTime != 3*step {
+		t.Errorf("清理后剩余 %d 条", len(got))
+	}
+	if got, _ := store.Range("ETHUSDT", "3m", 0, 7*step); len(got) != 2 {
+		t.Errorf("其他交易对不应受影响, 剩余 %d 条", len(got))
+	}
+
+	// 数据完整时 Load 直接读库，不访问API
+	if got, err := store.Load(nil, "BTCUSDT", "3m", 3*step, 7*step); err != nil || len(got) != 5 {
+		t.Errorf("Load = %d 条, %v", len(got), err)
+	}
+}
+
+// TestKlineStore_LoadRecordsUnfillableGaps 测试交易所无法提供的区间被记录，之后的 Load 不再请求
+func TestKlineStore_LoadRecordsUnfillableGaps(t *testing.T) {
+	step := (3 * time.Minute).Milliseconds()
+	var requests atomic.Int32
+	// 交易所只有 5*step 之后的K线（交易对在此之前尚未上市）
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		start, _ := strconv.ParseInt(r.URL.Query().Get("startTime"), 10, 64)
+		end, _ := strconv.ParseInt(r.URL.Query().Get("endTime"), 10, 64)
+		var parts []string
+		for open := max(start, 5*step); open <= end; open += step {
+			parts = append(parts, `[`+itoa(open)+`,"1","1","1","1","1",`+itoa(open+step-1)+`,"1",1,"1","1"]`)
+		}
+		w.Write([]byte("[" + strings.Join(parts, ",") + "]"))
+	}))
+	defer server.Close()
+
+	store := openTestKlineStore(t, 0)
+	apiClient := newAPIClientWithBaseURL(server.URL)
+	got, err := store.Load(apiClient, "NEWUSDT", "3m", 0, 9*step)
+	if err != nil || len(got) != 5 || got[0].OpenTime != 5*step {
+		t.Fatalf("首次 Load = %+v, %v", got, err)
+	}
+	first := requests.Load()
+
+	got, err = store.Load(apiClient, "NEWUSDT", "3m", 0, 9*step)
+	if err != nil || len(got) != 5 {
+		t.Errorf("再次 Load = %d 条, %v", len(got), err)
+	}
+	if requests.Load() != first {
+		t.Errorf("已记录的缺口不应再次请求, 请求 %d -> %d 次", first, requests.Load())
+	}
+}
+
+// TestSubtractGaps 测试从缺失区间中去掉已确认无法补齐的区间
+func TestSubtractGaps(t *testing.T) {
+	step := (3 * time.Minute).Milliseconds()
+	gaps := []KlineGap{{From: 0, To: 9 * step}}
+	known := []KlineGap{{From: 0, To: 2 * step}, {From: 5 * step, To: 6 * step}}
+	want := []KlineGap{{From: 3 * step, To: 4 * step}, {From: 7 * step, To: 9 * step}}
+	if got := subtractGaps(gaps, known, 3*time.Minute); !reflect.DeepEqual(got, want) {
+		t.Errorf("subtractGaps = %+v, 期望 %+v", got, want)
+	}
+}
+
+// TestMergeKlines 测试K线合并去重和长度限制
+func TestMergeKlines(t *testing.T) {
+	klines := generateKlinesAt(0, 5)
+	updated := klines[4]
+	updated.Close = 500
+
+	merged := mergeKlines(klines[:3], []Kline{updated, klines[3], klines[2]}, 4)
+	if len(merged) != 4 || merged[0].OpenTime != klines[1].OpenTime || merged[3].Close != 500 {
+		t.Errorf("合并结果不符: %+v", merged)
+	}
+}
+
+// TestProcessKlineUpdate_PersistsFinal 测试只有已收盘K线写入本地库
+func TestProcessKlineUpdate_PersistsFinal(t *testing.T) {
+	store := openTestKlineStore(t, 0)
+	m := &WSMonitor{klineStore: store}
+	m.getKlineDataMap("3m").Store("BTCUSDT", generateKlinesAt(0, 3))
+	step := (3 * time.Minute).Milliseconds()
+
+	var update KlineWSData
+	update.Kline.StartTime = 3 * step
+	update.Kline.CloseTime = 4*step - 1
+	update.Kline.ClosePrice = "105"
+	m.processKlineUpdate("BTCUSDT", update, "3m")
+	m.flushKlineWrites()
+	if got, _ := store.Range("BTCUSDT", "3m", 0, 10*step); len(got) != 0 {
+		t.Errorf("未收盘K线不应入库: %+v", got)
+	}
+
+	update.Kline.IsFinal = true
+	m.processKlineUpdate("BTCUSDT", update, "3m")
+	m.flushKlineWrites()
+	got, _ := store.Range("BTCUSDT", "3m", 0, 10*step)
+	if len(got) != 1 || got[0].Close != 105 {
+		t.Errorf("已收盘K线应入库: %+v", got)
+	}
+
+	value, _ := m.getKlineDataMap("3m").Load("BTCUSDT")
+	if klines := value.([]Kline); len(klines) != 4 || klines[3].Close != 105 {
+		t.Errorf("内存K线未更新: %+v", klines)
+	}
+}
+
+// TestProcessKlineUpdate_BackfillsAsync 测试K线缺口在后台补齐，不阻塞 WebSocket 处理
+func TestProcessKlineUpdate_BackfillsAsync(t *testing.T) {
+	step := (3 * time.Minute).Milliseconds()
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.Write([]byte(`[[` + itoa(3*step) + `,"1","1","1","1","1",` + itoa(4*step-1) + `,"1",1,"1","1"]]`))
+	}))
+	defer server.Close()
+	defer close(release)
+
+	m := &WSMonitor{apiClient: newAPIClientWithBaseURL(server.URL)}
+	m.getKlineDataMap("3m").Store("BTCUSDT", generateKlinesAt(0, 3))
+
+	var update KlineWSData
+	update.Kline.StartTime = 4 * step
+	update.Kline.CloseTime = 5*step - 1
+	done := make(chan struct{})
+	go func() {
+		m.processKlineUpdate("BTCUSDT", update, "3m")
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("补齐缺口阻塞了 WebSocket 处理")
+	}
+
+	release <- struct{}{}
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		value, _ := m.getKlineDataMap("3m").Load("BTCUSDT")
+		if klines := value.([]Kline); len(klines) == 5 && klines[3].OpenTime == 3*step {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Error("后台补齐后内存K线应连续")
+}
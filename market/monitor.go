@@ -10,18 +10,36 @@ import (
 )
 
 type WSMonitor struct {
-	wsClient       *WSClient
-	combinedClient *CombinedStreamsClient
-	symbols        []string
-	featuresMap    sync.Map
-	alertsChan     chan Alert
-	klineDataMap3m sync.Map // 存储每个交易对的K线历史数据
-	klineDataMap4h sync.Map // 存储每个交易对的K线历史数据
-	tickerDataMap  sync.Map // 存储每个交易对的ticker数据
-	batchSize      int
-	filterSymbols  sync.Map // 使用sync.Map来存储需要监控的币种和其状态
-	symbolStats    sync.Map // 存储币种统计信息
-	FilterSymbol   []string //经过筛选的币种
+	wsClient        *WSClient
+	combinedClient  *CombinedStreamsClient
+	symbols         []string
+	featuresMap     sync.Map
+	alertsChan      chan Alert
+	klineDataMaps   sync.Map // K线周期 -> *sync.Map（存储每个交易对的K线历史数据）
+	klineLocks      sync.Map // K线流 -> *sync.Mutex（WebSocket 更新、REST 轮询和补齐写入同一K线流时互斥）
+	tickerDataMap   sync.Map // 存储每个交易对的ticker数据
+	batchSize       int
+	filterSymbols   sync.Map // 使用sync.Map来存储需要监控的币种和其状态
+	symbolStats     sync.Map // 存储币种统计信息
+	statsMutex      sync.Mutex
+	lastAlerts      sync.Map    // 交易对:警报类型 -> 上次警报时间（用于冷却）
+	FilterSymbol    []string    //经过筛选的币种
+	orderBooks      sync.Map    // 存储每个交易对的本地订单簿（*OrderBook）
+	depthSubscribed sync.Map    // 已订阅深度流的交易对
+	klineStore      *KlineStore // 本地K线库（nil表示不持久化）
+	streamPolls     sync.Map    // K线流 -> 最近一次成功的REST轮询时间（WebSocket静默期间）
+	pollBackoffs    sync.Map    // K线流 -> pollBackoff（REST 轮询失败后的退避）
+	apiClient       *APIClient  // REST 轮询使用的客户端（nil表示使用默认地址）
+
+	// 本地K线库写入和缺口补齐由后台协程处理，WebSocket 读循环只入队
+	klineWorkersOnce sync.Once
+	klineWrites      chan klineWrite    // 待写入本地库的已收盘K线
+	klineBackfills   chan klineBackfill // 待补齐的缺失K线区间
+
+	subscribedMutex      sync.Mutex
+	subscribedTimeframes map[string]bool // 已批量订阅的K线周期
+	pendingTimeframes    map[string]bool // 正在加载历史数据和订阅的K线周期（避免并发重复订阅）
+	started              bool            // 是否已完成初始订阅
 }
 type SymbolStats struct {
 	LastActiveTime   time.Time
@@ -32,7 +50,6 @@ type SymbolStats struct {
 }
 
 var WSMonitorCli *WSMonitor
-var subKlineTime = []string{"3m", "4h"} // 管理订阅流的K线周期
 
 func NewWSMonitor(batchSize int) *WSMonitor {
 	WSMonitorCli = &WSMonitor{
@@ -40,7 +57,10 @@ func NewWSMonitor(batchSize int) *WSMonitor {
 		combinedClient: NewCombinedStreamsClient(batchSize),
 		alertsChan:     make(chan Alert, 1000),
 		batchSize:      batchSize,
+
+		subscribedTimeframes: make(map[string]bool),
 	}
+	go WSMonitorCli.dispatchAlerts()
 	return WSMonitorCli
 }
 
@@ -68,14 +88,14 @@ func (m *WSMonitor) Initialize(coins []string) error {
 
 	log.Printf("找到 %d 个交易对", len(m.symbols))
 	// 初始化历史数据
-	if err := m.initializeHistoricalData(); err != nil {
+	if err := m.initializeHistoricalData(ActiveTimeframes()); err != nil {
 		log.Printf("初始化历史数据失败: %v", err)
 	}
 
 	return nil
 }
 
-func (m *WSMonitor) initializeHistoricalData() error {
+func (m *WSMonitor) initializeHistoricalData(timeframes []string) error {
 	apiClient := NewAPIClient()
 
 	var wg sync.WaitGroup
@@ -89,25 +109,8 @@ func (m *WSMonitor) initializeHistoricalData() error {
 			defer wg.Done()
 			defer func() { <-semaphore }()
 
-			// 获取历史K线数据
-			klines, err := apiClient.GetKlines(s, "3m", 100)
-			if err != nil {
-				log.Printf("获取 %s 历史数据失败: %v", s, err)
-				return
-			}
-			if len(klines) > 0 {
-				m.klineDataMap3m.Store(s, klines)
-				log.Printf("已加载 %s 的历史K线数据-3m: %d 条", s, len(klines))
-			}
-			// 获取历史K线数据
-			klines4h, err := apiClient.GetKlines(s, "4h", 100)
-			if err != nil {
-				log.Printf("获取 %s 历史数据失败: %v", s, err)
-				return
-			}
-			if len(klines4h) > 0 {
-				m.klineDataMap4h.Store(s, klines4h)
-				log.Printf("已加载 %s 的历史K线数据-4h: %d 条", s, len(klines4h))
+			for _, tf := range timeframes {
+				m.loadHistoricalKlines(apiClient, s, tf)
 			}
 		}(symbol)
 	}
@@ -116,8 +119,34 @@ func (m *WSMonitor) initializeHistoricalData() error {
 	return nil
 }
 
+// loadHistoricalKlines 加载单个交易对的历史K线（启用本地K线库时读库并补齐缺口，否则通过API获取）
+func (m *WSMonitor) loadHistoricalKlines(apiClient *APIClient, symbol, timeframe string) {
+	var klines []Kline
+	var err error
+	if d, ok := TimeframeDuration(timeframe); ok && m.klineStore != nil {
+		to := lastClosedOpenTime(time.Now(), d)
+		from := to - int64(klineHistorySize-1)*d.Milliseconds()
+		klines, err = m.klineStore.Load(apiClient, symbol, timeframe, from, to)
+	} else {
+		klines, err = apiClient.GetKlines(symbol, timeframe, klineHistorySize)
+	}
+	if err != nil {
+		log.Printf("获取 %s 历史数据失败: %v", symbol, err)
+		return
+	}
+	if len(klines) > 0 {
+		m.updateKlines(symbol, timeframe, func(existing []Kline) []Kline {
+			return mergeKlines(klines, existing, klineHistorySize)
+		})
+		log.Printf("已加载 %s 的历史K线数据-%s: %d 条", symbol, timeframe, len(klines))
+	}
+}
+
 func (m *WSMonitor) Start(coins []string) {
 	log.Printf("启动WebSocket实时监控...")
+	if m.klineStore != nil {
+		go m.runKlineRetention()
+	}
 	// 初始化交易对
 	err := m.Initialize(coins)
 	if err != nil {
@@ -136,6 +165,8 @@ func (m *WSMonitor) Start(coins []string) {
 		log.Printf("❌ 订阅币种交易对失败: %v", err)
 		return
 	}
+	// 监控数据流健康，静默时切换为REST轮询
+	go m.superviseStreams()
 }
 
 // subscribeSymbol 注册监听
@@ -151,19 +182,71 @@ func (m *WSMonitor) subscribeSymbol(symbol, st string) []string {
 func (m *WSMonitor) subscribeAll() error {
 	// 执行批量订阅
 	log.Println("开始订阅所有交易对...")
-	for _, symbol := range m.symbols {
-		for _, st := range subKlineTime {
-			m.subscribeSymbol(symbol, st)
+	m.subscribedMutex.Lock()
+	m.started = true
+	m.subscribedMutex.Unlock()
+
+	if err := m.subscribeTimeframes(ActiveTimeframes()); err != nil {
+		return err
+	}
+	// 强平数据不影响K线订阅
+	if err := m.subscribeLiquidations(); err != nil {
+		log.Printf("⚠️  订阅强平订单流失败: %v", err)
+	}
+	log.Println("所有交易对订阅完成")
+	return nil
+}
+
+// subscribeTimeframes 为所有交易对订阅尚未订阅的K线周期（交易员启动时按需追加）
+// 历史数据加载和订阅在锁外进行，只在登记周期状态时持有 subscribedMutex
+func (m *WSMonitor) subscribeTimeframes(timeframes []string) error {
+	m.subscribedMutex.Lock()
+	// 尚未完成初始化时由 Start 统一订阅
+	if !m.started {
+		m.subscribedMutex.Unlock()
+		return nil
+	}
+	if m.pendingTimeframes == nil {
+		m.pendingTimeframes = make(map[string]bool)
+	}
+	var pending []string
+	for _, st := range timeframes {
+		if m.subscribedTimeframes[st] || m.pendingTimeframes[st] {
+			continue
 		}
+		m.pendingTimeframes[st] = true
+		pending = append(pending, st)
 	}
-	for _, st := range subKlineTime {
-		err := m.combinedClient.BatchSubscribeKlines(m.symbols, st)
-		if err != nil {
+	symbols := m.symbols
+	m.subscribedMutex.Unlock()
+
+	defer func() {
+		m.subscribedMutex.Lock()
+		for _, st := range pending {
+			delete(m.pendingTimeframes, st)
+		}
+		m.subscribedMutex.Unlock()
+	}()
+
+	apiClient := m.restClient()
+	for _, st := range pending {
+		for _, symbol := range symbols {
+			// 初始订阅之后新增的周期需要补充历史数据
+			if _, exists := m.getKlineDataMap(st).Load(symbol); !exists {
+				m.loadHistoricalKlines(apiClient, symbol, st)
+			}
+			m.subscribeSymbol(symbol, st)
+		}
+		if err := m.combinedClient.BatchSubscribeKlines(symbols, st); err != nil {
 			log.Printf("❌ 订阅 %s K线失败: %v", st, err)
 			return err
 		}
+
+		m.subscribedMutex.Lock()
+		m.subscribedTimeframes[st] = true
+		m.subscribedMutex.Unlock()
+		log.Printf("✓ 已订阅 %s K线", st)
 	}
-	log.Println("所有交易对订阅完成")
 	return nil
 }
 
@@ -175,19 +258,32 @@ func (m *WSMonitor) handleKlineData(symbol string, ch <-chan []byte, _time strin
 			continue
 		}
 		m.processKlineUpdate(symbol, klineData, _time)
+
+		// K线收盘时重新计算特征并检测警报
+		if klineData.Kline.IsFinal && _time == alertTimeframe() {
+			m.evaluateAlerts(symbol, _time)
+		}
 	}
 }
 
 func (m *WSMonitor) getKlineDataMap(_time string) *sync.Map {
-	var klineDataMap *sync.Map
-	if _time == "3m" {
-		klineDataMap = &m.klineDataMap3m
-	} else if _time == "4h" {
-		klineDataMap = &m.klineDataMap4h
-	} else {
-		klineDataMap = &sync.Map{}
+	klineDataMap, _ := m.klineDataMaps.LoadOrStore(_time, &sync.Map{})
+	return klineDataMap.(*sync.Map)
+}
+
+// updateKlines 在K线流的锁内读取、修改并保存内存K线，update 不能修改传入的切片（读取方不加锁）
+// 所有写入方都需通过这里，避免 WebSocket 更新和 REST 轮询互相覆盖；update 中不要做网络请求
+func (m *WSMonitor) updateKlines(symbol, timeframe string, update func(existing []Kline) []Kline) {
+	lock, _ := m.klineLocks.LoadOrStore(klineStreamName(symbol, timeframe), &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	defer lock.(*sync.Mutex).Unlock()
+
+	klineDataMap := m.getKlineDataMap(timeframe)
+	var existing []Kline
+	if value, ok := klineDataMap.Load(symbol); ok {
+		existing = value.([]Kline)
 	}
-	return klineDataMap
+	klineDataMap.Store(symbol, update(existing))
 }
 func (m *WSMonitor) processKlineUpdate(symbol string, wsData KlineWSData, _time string) {
 	// 转换WebSocket数据为Kline结构
@@ -206,30 +302,55 @@ func (m *WSMonitor) processKlineUpdate(symbol string, wsData KlineWSData, _time
 	kline.TakerBuyBaseVolume, _ = parseFloat(wsData.Kline.TakerBuyBaseVolume)
 	kline.TakerBuyQuoteVolume, _ = parseFloat(wsData.Kline.TakerBuyQuoteVolume)
 	// 更新K线数据
-	var klineDataMap = m.getKlineDataMap(_time)
-	value, exists := klineDataMap.Load(symbol)
-	var klines []Kline
-	if exists {
-		klines = value.([]Kline)
-
+	var gapFrom int64 = -1
+	m.updateKlines(symbol, _time, func(klines []Kline) []Kline {
+		if len(klines) == 0 {
+			return []Kline{kline}
+		}
 		// 检查是否是新的K线
-		if len(klines) > 0 && klines[len(klines)-1].OpenTime == kline.OpenTime {
-			// 更新当前K线
-			klines[len(klines)-1] = kline
-		} else {
-			// 添加新K线
-			klines = append(klines, kline)
-
-			// 保持数据长度
-			if len(klines) > 100 {
-				klines = klines[1:]
-			}
+		if klines[len(klines)-1].OpenTime == kline.OpenTime {
+			// 更新当前K线（复制后修改，读取方可能正持有旧切片）
+			updated := make([]Kline, len(klines))
+			copy(updated, klines)
+			updated[len(updated)-1] = kline
+			return updated
 		}
-	} else {
-		klines = []Kline{kline}
+		// 连接中断期间缺失的K线，释放锁后通过API补齐
+		if d, ok := TimeframeDuration(_time); ok && kline.OpenTime-klines[len(klines)-1].OpenTime > d.Milliseconds() {
+			gapFrom = klines[len(klines)-1].OpenTime + d.Milliseconds()
+		}
+		// 添加新K线并保持数据长度
+		return mergeKlines(klines, []Kline{kline}, klineHistorySize)
+	})
+	if gapFrom >= 0 {
+		d, _ := TimeframeDuration(_time)
+		m.scheduleBackfill(symbol, _time, gapFrom, kline.OpenTime-d.Milliseconds())
+	}
+
+	// 已收盘K线写入本地库
+	if wsData.Kline.IsFinal {
+		m.persistKlines(symbol, _time, []Kline{kline})
 	}
+}
 
-	klineDataMap.Store(symbol, klines)
+// backfillKlines 补齐开盘时间在 [from, to] 内的缺失K线并合并到内存（网络请求在锁外进行）
+func (m *WSMonitor) backfillKlines(symbol, timeframe string, from, to int64) {
+	var missing []Kline
+	var err error
+	apiClient := m.restClient()
+	if m.klineStore != nil {
+		missing, err = m.klineStore.Load(apiClient, symbol, timeframe, from, to)
+	} else {
+		missing, err = fetchKlineRange(apiClient, symbol, timeframe, from, to)
+	}
+	if err != nil {
+		log.Printf("⚠️  补齐 %s %s 缺失K线失败: %v", symbol, timeframe, err)
+		return
+	}
+	m.updateKlines(symbol, timeframe, func(klines []Kline) []Kline {
+		return mergeKlines(missing, klines, klineHistorySize)
+	})
+	log.Printf("🔧 已补齐 %s %s 缺失K线: %d 条", symbol, timeframe, len(missing))
 }
 
 func (m *WSMonitor) GetCurrentKlines(symbol string, duration string) ([]Kline, error) {
@@ -244,7 +365,9 @@ func (m *WSMonitor) GetCurrentKlines(symbol string, duration string) ([]Kline, e
 		}
 
 		// 动态缓存进缓存
-		m.getKlineDataMap(duration).Store(strings.ToUpper(symbol), klines)
+		m.updateKlines(strings.ToUpper(symbol), duration, func(existing []Kline) []Kline {
+			return mergeKlines(klines, existing, klineHistorySize)
+		})
 
 		// 订阅 WebSocket 流
 		subStr := m.subscribeSymbol(symbol, duration)
@@ -270,4 +393,7 @@ func (m *WSMonitor) GetCurrentKlines(symbol string, duration string) ([]Kline, e
 func (m *WSMonitor) Close() {
 	m.wsClient.Close()
 	close(m.alertsChan)
+	if m.klineStore != nil {
+		m.flushKlineWrites()
+	}
 }
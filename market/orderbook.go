@@ -0,0 +1,282 @@
+package market
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// orderBookDepthLevels 部分深度流档位（币安支持 5/10/20）
+	orderBookDepthLevels = 20
+	// orderBookStaleAfter 本地订单簿超过该时间未更新时重新通过API获取
+	orderBookStaleAfter = 10 * time.Second
+)
+
+// 滑点估算方向
+const (
+	SideBuy  = "buy"  // 市价买入（开多/平空），吃卖盘
+	SideSell = "sell" // 市价卖出（开空/平多），吃买盘
+)
+
+// OrderBookLevel 盘口档位
+type OrderBookLevel struct {
+	Price    float64
+	Quantity float64
+}
+
+// OrderBook 本地订单簿（部分深度快照，每次推送整体替换）
+type OrderBook struct {
+	Symbol     string
+	Bids       []OrderBookLevel // 买盘，价格从高到低
+	Asks       []OrderBookLevel // 卖盘，价格从低到高
+	UpdateTime time.Time
+}
+
+// LiquidityData 订单簿流动性指标（基于可见的前20档深度）
+type LiquidityData struct {
+	BestBid    float64
+	BestAsk    float64
+	SpreadBps  float64           // 买卖价差（基点）
+	BidDepth05 float64           // 中间价下方0.5%以内的买盘金额（USD）
+	AskDepth05 float64           // 中间价上方0.5%以内的卖盘金额（USD）
+	BidDepth1  float64           // 中间价下方1%以内的买盘金额（USD）
+	AskDepth1  float64           // 中间价上方1%以内的卖盘金额（USD）
+	Imbalance  float64           // 买卖盘不平衡度 (买-卖)/(买+卖)，基于±1%深度，范围 -1~1
+	Slippage   *SlippageEstimate // 按单币仓位上限估算的滑点（未估算时为nil）
+
+	book *OrderBook
+}
+
+// SlippageEstimate 市价单滑点估算
+type SlippageEstimate struct {
+	NotionalUSD float64
+	BuyPct      float64 // 市价买入平均成交价相对中间价的滑点百分比
+	SellPct     float64 // 市价卖出平均成交价相对中间价的滑点百分比
+	Exhausted   bool    // 可见深度不足以完全成交（实际滑点可能更大）
+}
+
+// Mid 中间价
+func (b *OrderBook) Mid() float64 {
+	if len(b.Bids) == 0 || len(b.Asks) == 0 {
+		return 0
+	}
+	return (b.Bids[0].Price + b.Asks[0].Price) / 2
+}
+
+// depthWithin 中间价上下 pct% 以内的买卖盘金额（USD）
+func (b *OrderBook) depthWithin(pct float64) (bidDepth, askDepth float64) {
+	mid := b.Mid()
+	if mid <= 0 {
+		return 0, 0
+	}
+	for _, l := range b.Bids {
+		if l.Price < mid*(1-pct/100) {
+			break
+		}
+		bidDepth += l.Price * l.Quantity
+	}
+	for _, l := range b.Asks {
+		if l.Price > mid*(1+pct/100) {
+			break
+		}
+		askDepth += l.Price * l.Quantity
+	}
+	return bidDepth, askDepth
+}
+
+// EstimateSlippage 估算市价成交 notional 金额（USD）的滑点百分比
+// 可见深度不足时剩余部分按最差一档价格计算，并返回 exhausted=true
+func (b *OrderBook) EstimateSlippage(side string, notional float64) (pct float64, exhausted bool) {
+	mid := b.Mid()
+	if mid <= 0 || notional <= 0 {
+		return 0, false
+	}
+
+	levels := b.Asks
+	if side == SideSell {
+		levels = b.Bids
+	}
+
+	remaining := notional
+	filledQty := 0.0
+	lastPrice := mid
+	for _, l := range levels {
+		levelNotional := l.Price * l.Quantity
+		lastPrice = l.Price
+		if levelNotional >= remaining {
+			filledQty += remaining / l.Price
+			remaining = 0
+			break
+		}
+		filledQty += l.Quantity
+		remaining -= levelNotional
+	}
+	if remaining > 0 {
+		exhausted = true
+		filledQty += remaining / lastPrice
+	}
+
+	avgPrice := notional / filledQty
+	return math.Abs(avgPrice-mid) / mid * 100, exhausted
+}
+
+// calculateLiquidity 根据订单簿计算流动性指标
+func calculateLiquidity(book *OrderBook) *LiquidityData {
+	mid := book.Mid()
+	if mid <= 0 {
+		return nil
+	}
+
+	l := &LiquidityData{
+		BestBid:   book.Bids[0].Price,
+		BestAsk:   book.Asks[0].Price,
+		SpreadBps: (book.Asks[0].Price - book.Bids[0].Price) / mid * 10000,
+		book:      book,
+	}
+	l.BidDepth05, l.AskDepth05 = book.depthWithin(0.5)
+	l.BidDepth1, l.AskDepth1 = book.depthWithin(1)
+	if total := l.BidDepth1 + l.AskDepth1; total > 0 {
+		l.Imbalance = (l.BidDepth1 - l.AskDepth1) / total
+	}
+	return l
+}
+
+// EstimateFor 按单币仓位上限估算双向滑点，结果保存在 Slippage 中（提示词中注明按最大仓位估算）
+func (l *LiquidityData) EstimateFor(notional float64) *SlippageEstimate {
+	if l == nil || l.book == nil || notional <= 0 {
+		return nil
+	}
+	buyPct, buyExhausted := l.book.EstimateSlippage(SideBuy, notional)
+	sellPct, sellExhausted := l.book.EstimateSlippage(SideSell, notional)
+	l.Slippage = &SlippageEstimate{
+		NotionalUSD: notional,
+		BuyPct:      buyPct,
+		SellPct:     sellPct,
+		Exhausted:   buyExhausted || sellExhausted,
+	}
+	return l.Slippage
+}
+
+// FormatOrderBook 格式化输出订单簿：流动性指标 + 买卖盘前 levels 档（供AI按需查询）
+func FormatOrderBook(book *OrderBook, levels int) string {
+	liquidity := calculateLiquidity(book)
+	if liquidity == nil {
+		return fmt.Sprintf("%s order book is empty\n", book.Symbol)
+	}
+
+	var sb strings.Builder
+	writeLiquidity(&sb, liquidity)
+	writeLevels := func(name string, side []OrderBookLevel) {
+		sb.WriteString(fmt.Sprintf("%s (price, quantity, notional USD):\n", name))
+		for i, level := range side {
+			if i >= levels {
+				break
+			}
+			sb.WriteString(fmt.Sprintf("  %s, %.4f, %.0f\n",
+				formatPriceWithDynamicPrecision(level.Price), level.Quantity, level.Price*level.Quantity))
+		}
+		sb.WriteString("\n")
+	}
+	writeLevels("Asks", book.Asks)
+	writeLevels("Bids", book.Bids)
+	return sb.String()
+}
+
+// DepthWSData 部分深度流推送数据
+type DepthWSData struct {
+	EventType string      `json:"e"`
+	EventTime int64       `json:"E"`
+	Symbol    string      `json:"s"`
+	Bids      [][2]string `json:"b"`
+	Asks      [][2]string `json:"a"`
+}
+
+// parseOrderBookLevels 解析 [价格, 数量] 字符串档位，跳过数量为0的档位
+func parseOrderBookLevels(raw [][2]string) []OrderBookLevel {
+	levels := make([]OrderBookLevel, 0, len(raw))
+	for _, r := range raw {
+		price, err := strconv.ParseFloat(r[0], 64)
+		if err != nil {
+			continue
+		}
+		qty, err := strconv.ParseFloat(r[1], 64)
+		if err != nil || qty <= 0 {
+			continue
+		}
+		levels = append(levels, OrderBookLevel{Price: price, Quantity: qty})
+	}
+	return levels
+}
+
+// depthStream 部分深度流名称
+func depthStream(symbol string) string {
+	return fmt.Sprintf("%s@depth%d@500ms", strings.ToLower(symbol), orderBookDepthLevels)
+}
+
+// GetOrderBook 获取本地订单簿（USDC等计价的品种映射到币安USDT永续）
+func GetOrderBook(symbol string) (*OrderBook, error) {
+	if WSMonitorCli == nil {
+		return nil, fmt.Errorf("WebSocket监控器未初始化")
+	}
+	return WSMonitorCli.GetOrderBook(ReferenceSymbol(Normalize(symbol)))
+}
+
+// GetOrderBook 获取交易对的本地订单簿
+// 首次请求时通过API获取快照并订阅部分深度流，之后由推送维护；推送中断超过 orderBookStaleAfter 时回退到API
+func (m *WSMonitor) GetOrderBook(symbol string) (*OrderBook, error) {
+	if value, ok := m.orderBooks.Load(symbol); ok {
+		book := value.(*OrderBook)
+		if time.Since(book.UpdateTime) < orderBookStaleAfter {
+			return book, nil
+		}
+	}
+
+	book, err := NewAPIClient().GetDepth(symbol, orderBookDepthLevels)
+	if err != nil {
+		return nil, fmt.Errorf("获取%s订单簿失败: %v", symbol, err)
+	}
+	m.orderBooks.Store(symbol, book)
+
+	// 每个交易对只订阅一次深度流
+	if _, subscribed := m.depthSubscribed.LoadOrStore(symbol, true); !subscribed {
+		stream := depthStream(symbol)
+		ch := m.combinedClient.AddSubscriber(stream, 10)
+		go m.handleDepthData(symbol, ch)
+		if err := m.combinedClient.subscribeStreams([]string{stream}); err != nil {
+			log.Printf("警告: 订阅%s深度流失败: %v (使用API数据)", symbol, err)
+		}
+	}
+	return book, nil
+}
+
+// handleDepthData 处理部分深度流推送（整体替换本地订单簿）
+func (m *WSMonitor) handleDepthData(symbol string, ch <-chan []byte) {
+	for data := range ch {
+		var depth DepthWSData
+		if err := json.Unmarshal(data, &depth); err != nil {
+			log.Printf("解析深度数据失败: %v", err)
+			continue
+		}
+		m.orderBooks.Store(symbol, &OrderBook{
+			Symbol:     symbol,
+			Bids:       parseOrderBookLevels(depth.Bids),
+			Asks:       parseOrderBookLevels(depth.Asks),
+			UpdateTime: time.Now(),
+		})
+	}
+}
+
+// getLiquidity 获取交易对的流动性指标（失败时返回nil，不影响行情数据）
+func getLiquidity(symbol string) *LiquidityData {
+	book, err := WSMonitorCli.GetOrderBook(symbol)
+	if err != nil {
+		log.Printf("⚠️  %v", err)
+		return nil
+	}
+	return calculateLiquidity(book)
+}
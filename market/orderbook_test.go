@@ -0,0 +1,140 @@
+package market
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestOrderBook 构造中间价为100、每档间隔0.1、每档数量10的订单簿
+func newTestOrderBook() *OrderBook {
+	book := &OrderBook{Symbol: "BTCUSDT", UpdateTime: time.Now()}
+	for i := 0; i < 20; i++ {
+		book.Bids = append(book.Bids, OrderBookLevel{Price: 99.95 - float64(i)*0.1, Quantity: 10})
+		book.Asks = append(book.Asks, OrderBookLevel{Price: 100.05 + float64(i)*0.1, Quantity: 10})
+	}
+	return book
+}
+
+// TestCalculateLiquidity 测试价差、深度和不平衡度
+func TestCalculateLiquidity(t *testing.T) {
+	book := newTestOrderBook()
+	// 买盘加厚：第一档数量翻倍
+	book.Bids[0].Quantity = 20
+
+	l := calculateLiquidity(book)
+	if l == nil {
+		t.Fatal("calculateLiquidity returned nil")
+	}
+	if math.Abs(l.SpreadBps-10) > 1e-9 {
+		t.Errorf("价差 = %.4f bps, 期望 10", l.SpreadBps)
+	}
+
+	// ±0.5%（99.5~100.5）: 买盘 99.95..99.55 共5档，卖盘 100.05..100.45 共5档
+	expectedAsk05 := 0.0
+	for i := 0; i < 5; i++ {
+		expectedAsk05 += (100.05 + float64(i)*0.1) * 10
+	}
+	if math.Abs(l.AskDepth05-expectedAsk05) > 1e-6 {
+		t.Errorf("卖盘±0.5%%深度 = %.2f, 期望 %.2f", l.AskDepth05, expectedAsk05)
+	}
+	if l.BidDepth1 <= l.BidDepth05 || l.AskDepth1 <= l.AskDepth05 {
+		t.Errorf("±1%%深度应大于±0.5%%深度: %+v", l)
+	}
+	if l.Imbalance <= 0 || l.Imbalance >= 1 {
+		t.Errorf("买盘较厚时不平衡度应为正, 实际 %.4f", l.Imbalance)
+	}
+
+	if calculateLiquidity(&OrderBook{}) != nil {
+		t.Error("空订单簿应返回nil")
+	}
+}
+
+// TestEstimateSlippage 测试按档位逐级成交的滑点估算
+func TestEstimateSlippage(t *testing.T) {
+	book := newTestOrderBook()
+
+	// 只吃第一档：平均价 100.05，滑点 0.05%
+	pct, exhausted := book.EstimateSlippage(SideBuy, 500)
+	if exhausted || math.Abs(pct-0.05) > 1e-9 {
+		t.Errorf("小额买入滑点 = %.4f%% (exhausted=%v), 期望 0.05%%", pct, exhausted)
+	}
+
+	// 吃满两档：数量20，金额 1000.5+1001.5，平均价 100.1
+	pct, _ = book.EstimateSlippage(SideBuy, 1000.5+1001.5)
+	if math.Abs(pct-0.1) > 1e-9 {
+		t.Errorf("两档买入滑点 = %.4f%%, 期望 0.1%%", pct)
+	}
+
+	// 卖出方向对称
+	pct, _ = book.EstimateSlippage(SideSell, 999.5)
+	if math.Abs(pct-0.05) > 1e-9 {
+		t.Errorf("小额卖出滑点 = %.4f%%, 期望 0.05%%", pct)
+	}
+
+	// 超过可见深度
+	if _, exhausted := book.EstimateSlippage(SideBuy, 1e6); !exhausted {
+		t.Error("超过可见深度时应标记 exhausted")
+	}
+}
+
+// TestHandleDepthData 测试深度流推送替换本地订单簿
+func TestHandleDepthData(t *testing.T) {
+	m := &WSMonitor{}
+	ch := make(chan []byte, 1)
+	ch <- []byte(`{"e":"depthUpdate","E":1,"s":"BTCUSDT","b":[["99.9","1.5"],["99.8","0"]],"a":[["100.1","2"]]}`)
+	close(ch)
+	m.handleDepthData("BTCUSDT", ch)
+
+	value, ok := m.orderBooks.Load("BTCUSDT")
+	if !ok {
+		t.Fatal("订单簿未保存")
+	}
+	book := value.(*OrderBook)
+	if len(book.Bids) != 1 || book.Bids[0] != (OrderBookLevel{Price: 99.9, Quantity: 1.5}) {
+		t.Errorf("买盘解析错误（数量为0的档位应跳过）: %+v", book.Bids)
+	}
+	if len(book.Asks) != 1 || book.Asks[0].Price != 100.1 || book.Mid() != 100 {
+		t.Errorf("卖盘解析错误: %+v", book.Asks)
+	}
+
+	// 未过期的订单簿直接返回，不访问API
+	got, err := m.GetOrderBook("BTCUSDT")
+	if err != nil || got != book {
+		t.Errorf("应返回本地订单簿, 实际 %v, %v", got, err)
+	}
+}
+
+// TestFormat_Liquidity 测试流动性指标输出到提示词
+func TestFormat_Liquidity(t *testing.T) {
+	liquidity := calculateLiquidity(newTestOrderBook())
+	liquidity.EstimateFor(5000)
+	data := &Data{Symbol: "BTCUSDT", CurrentPrice: 100, Liquidity: liquidity}
+
+	output := Format(data)
+	for _, want := range []string{
+		"Order book (top 20 levels)",
+		"spread 10.00 bps",
+		"Depth within ±0.5%",
+		"Estimated slippage at max position size ($5000 market order",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("输出缺少 %q", want)
+		}
+	}
+}
+
+func TestFormatOrderBook(t *testing.T) {
+	output := FormatOrderBook(newTestOrderBook(), 3)
+	if !strings.Contains(output, "spread 10.00 bps") {
+		t.Errorf("输出缺少流动性指标:\n%s", output)
+	}
+	if !strings.Contains(output, "100.25, 10.0000") || strings.Contains(output, "100.35") {
+		t.Errorf("卖盘应只输出前3档:\n%s", output)
+	}
+
+	if output := FormatOrderBook(&OrderBook{Symbol: "BTCUSDT"}, 3); !strings.Contains(output, "empty") {
+		t.Errorf("空订单簿输出不正确: %s", output)
+	}
+}
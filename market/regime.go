@@ -0,0 +1,186 @@
+package market
+
+import (
+	"math"
+	"sort"
+)
+
+// 市场状态
+const (
+	RegimeTrendingUp     = "trending_up"
+	RegimeTrendingDown   = "trending_down"
+	RegimeRanging        = "ranging"
+	RegimeHighVolatility = "high_volatility"
+)
+
+// Regimes 所有市场状态（用于校验按状态选择提示词模板的配置）
+var Regimes = []string{RegimeTrendingUp, RegimeTrendingDown, RegimeRanging, RegimeHighVolatility}
+
+const (
+	regimeATRPeriod       = 14
+	regimeEMAPeriod       = 20
+	regimeSlopeBars       = 5    // EMA20 斜率的计算跨度（K线数）
+	regimeADXTrending     = 25.0 // ADX 不低于该值视为趋势行情
+	regimeVolatilityRatio = 1.5  // 当前ATR不低于窗口平均真实波幅的该倍数视为高波动
+	minCorrelationSamples = 20   // 计算相关系数所需的最少共同收益率样本
+)
+
+// RegimeData 市场状态（基于 ATR/ADX/EMA 斜率分类）
+type RegimeData struct {
+	Timeframe       string
+	Regime          string
+	ADX             float64
+	ATRPct          float64 // ATR(14) 占当前价格的百分比
+	VolatilityRatio float64 // ATR(14) / 窗口平均真实波幅
+	EMASlopePct     float64 // EMA20 在最近5根K线内的变化百分比
+}
+
+// ClassifyRegime 根据K线判断市场状态，数据不足时返回nil
+// 高波动优先于趋势判断；ADX 达到趋势阈值时按 EMA20 斜率方向区分涨跌，否则为震荡
+func ClassifyRegime(timeframe string, klines []Kline) *RegimeData {
+	n := len(klines)
+	if n < 2*adxPeriod+1 || n < regimeEMAPeriod+regimeSlopeBars {
+		return nil
+	}
+	price := klines[n-1].Close
+	adx := calculateADX(klines, adxPeriod)
+	emaPrev := calculateEMA(klines[:n-regimeSlopeBars], regimeEMAPeriod)
+	if adx == nil || price <= 0 || emaPrev <= 0 {
+		return nil
+	}
+
+	sumTR := 0.0
+	for i := 1; i < n; i++ {
+		sumTR += trueRange(klines, i)
+	}
+	avgTR := sumTR / float64(n-1)
+	atr := calculateATR(klines, regimeATRPeriod)
+
+	data := &RegimeData{
+		Timeframe:   timeframe,
+		ADX:         adx.ADX,
+		ATRPct:      atr / price * 100,
+		EMASlopePct: (calculateEMA(klines, regimeEMAPeriod) - emaPrev) / emaPrev * 100,
+	}
+	if avgTR > 0 {
+		data.VolatilityRatio = atr / avgTR
+	}
+
+	switch {
+	case data.VolatilityRatio >= regimeVolatilityRatio:
+		data.Regime = RegimeHighVolatility
+	case data.ADX >= regimeADXTrending && data.EMASlopePct > 0:
+		data.Regime = RegimeTrendingUp
+	case data.ADX >= regimeADXTrending && data.EMASlopePct < 0:
+		data.Regime = RegimeTrendingDown
+	default:
+		data.Regime = RegimeRanging
+	}
+	return data
+}
+
+// Correlations 交易对之间K线收益率的相关系数矩阵
+type Correlations struct {
+	Timeframe string
+	Symbols   []string    // 按字母排序
+	Values    [][]float64 // Values[i][j] 为 Symbols[i] 与 Symbols[j] 的相关系数，样本不足时为 NaN
+}
+
+// ComputeCorrelations 按各交易对最长周期的K线计算收益率相关系数（按开盘时间对齐）
+func ComputeCorrelations(dataMap map[string]*Data) *Correlations {
+	returns := make(map[string]map[int64]float64)
+	timeframe := ""
+	for symbol, data := range dataMap {
+		if data == nil || len(data.trendKlines) < minCorrelationSamples+1 {
+			continue
+		}
+		// 周期不一致的数据无法对齐（同一交易员的数据周期相同）
+		if timeframe != "" && data.trendTimeframe != timeframe {
+			continue
+		}
+		timeframe = data.trendTimeframe
+		returns[symbol] = logReturns(data.trendKlines)
+	}
+	if len(returns) < 2 {
+		return nil
+	}
+
+	symbols := make([]string, 0, len(returns))
+	for symbol := range returns {
+		symbols = append(symbols, symbol)
+	}
+	sort.Strings(symbols)
+
+	values := make([][]float64, len(symbols))
+	for i := range symbols {
+		values[i] = make([]float64, len(symbols))
+		values[i][i] = 1
+	}
+	for i := 0; i < len(symbols); i++ {
+		for j := i + 1; j < len(symbols); j++ {
+			corr := correlation(returns[symbols[i]], returns[symbols[j]])
+			values[i][j], values[j][i] = corr, corr
+		}
+	}
+	return &Correlations{Timeframe: timeframe, Symbols: symbols, Values: values}
+}
+
+// Get 两个交易对的相关系数（任一交易对不存在或样本不足时返回 false）
+func (m *Correlations) Get(a, b string) (float64, bool) {
+	if m == nil {
+		return 0, false
+	}
+	i := sort.SearchStrings(m.Symbols, a)
+	j := sort.SearchStrings(m.Symbols, b)
+	if i >= len(m.Symbols) || m.Symbols[i] != a || j >= len(m.Symbols) || m.Symbols[j] != b {
+		return 0, false
+	}
+	if math.IsNaN(m.Values[i][j]) {
+		return 0, false
+	}
+	return m.Values[i][j], true
+}
+
+// logReturns 开盘时间 -> 该K线相对上一根的对数收益率
+func logReturns(klines []Kline) map[int64]float64 {
+	returns := make(map[int64]float64, len(klines))
+	for i := 1; i < len(klines); i++ {
+		if klines[i-1].Close > 0 && klines[i].Close > 0 {
+			returns[klines[i].OpenTime] = math.Log(klines[i].Close / klines[i-1].Close)
+		}
+	}
+	return returns
+}
+
+// correlation 两组收益率在共同时间点上的皮尔逊相关系数，样本不足或无波动时返回 NaN
+func correlation(a, b map[int64]float64) float64 {
+	var xs, ys []float64
+	for t, x := range a {
+		if y, ok := b[t]; ok {
+			xs = append(xs, x)
+			ys = append(ys, y)
+		}
+	}
+	n := float64(len(xs))
+	if len(xs) < minCorrelationSamples {
+		return math.NaN()
+	}
+
+	var sumX, sumY float64
+	for i := range xs {
+		sumX += xs[i]
+		sumY += ys[i]
+	}
+	meanX, meanY := sumX/n, sumY/n
+	var cov, varX, varY float64
+	for i := range xs {
+		dx, dy := xs[i]-meanX, ys[i]-meanY
+		cov += dx * dy
+		varX += dx * dx
+		varY += dy * dy
+	}
+	if varX == 0 || varY == 0 {
+		return math.NaN()
+	}
+	return cov / math.Sqrt(varX*varY)
+}
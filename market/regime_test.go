@@ -0,0 +1,84 @@
+package market
+
+import (
+	"math"
+	"testing"
+)
+
+// TestClassifyRegime 测试趋势、震荡和高波动的分类
+func TestClassifyRegime(t *testing.T) {
+	if r := ClassifyRegime("4h", generateTrendKlines(100, 100, 2)); r == nil || r.Regime != RegimeTrendingUp || r.EMASlopePct <= 0 {
+		t.Errorf("上涨趋势分类错误: %+v", r)
+	}
+	if r := ClassifyRegime("4h", generateTrendKlines(100, 400, -2)); r == nil || r.Regime != RegimeTrendingDown || r.EMASlopePct >= 0 {
+		t.Errorf("下跌趋势分类错误: %+v", r)
+	}
+
+	// 在 100/101 之间来回波动
+	ranging := generateTrendKlines(100, 100, 0)
+	for i := range ranging {
+		ranging[i].Close = 100 + float64(i%2)
+	}
+	if r := ClassifyRegime("4h", ranging); r == nil || r.Regime != RegimeRanging {
+		t.Errorf("震荡分类错误: %+v", r)
+	}
+
+	// 最近15根K线振幅放大到10倍
+	volatile := generateTrendKlines(100, 100, 0)
+	for i := range volatile {
+		volatile[i].Close = 100 + float64(i%2)
+		if i >= 85 {
+			volatile[i].High, volatile[i].Low = 110, 90
+		}
+	}
+	if r := ClassifyRegime("4h", volatile); r == nil || r.Regime != RegimeHighVolatility || r.VolatilityRatio < regimeVolatilityRatio {
+		t.Errorf("高波动分类错误: %+v", r)
+	}
+
+	if ClassifyRegime("4h", generateTrendKlines(20, 100, 1)) != nil {
+		t.Error("数据不足时应返回nil")
+	}
+}
+
+// TestComputeCorrelations 测试收益率相关系数（按开盘时间对齐）
+func TestComputeCorrelations(t *testing.T) {
+	base := make([]Kline, 60)
+	same := make([]Kline, 60)
+	inverse := make([]Kline, 60)
+	for i := range base {
+		// 收益率交替 +1%/-0.5%，反向序列方向相反
+		move := 1.01
+		if i%2 == 1 {
+			move = 0.995
+		}
+		openTime := int64(i) * 180000
+		base[i] = Kline{OpenTime: openTime, Close: 100}
+		same[i] = Kline{OpenTime: openTime, Close: 50}
+		inverse[i] = Kline{OpenTime: openTime, Close: 10}
+		if i > 0 {
+			base[i].Close = base[i-1].Close * move
+			same[i].Close = same[i-1].Close * move
+			inverse[i].Close = inverse[i-1].Close / move
+		}
+	}
+
+	dataMap := map[string]*Data{
+		"BTCUSDT": {trendTimeframe: "3m", trendKlines: base},
+		"ETHUSDT": {trendTimeframe: "3m", trendKlines: same[10:]}, // 起点不同，按时间对齐
+		"SOLUSDT": {trendTimeframe: "3m", trendKlines: inverse},
+		"NEWUSDT": {trendTimeframe: "3m", trendKlines: base[:10]}, // 样本不足
+	}
+	corr := ComputeCorrelations(dataMap)
+	if corr == nil || corr.Timeframe != "3m" || len(corr.Symbols) != 3 {
+		t.Fatalf("相关性矩阵 = %+v", corr)
+	}
+	if v, ok := corr.Get("ETHUSDT", "BTCUSDT"); !ok || math.Abs(v-1) > 1e-9 {
+		t.Errorf("同向序列相关系数 = %v, %v", v, ok)
+	}
+	if v, ok := corr.Get("BTCUSDT", "SOLUSDT"); !ok || v > -0.99 {
+		t.Errorf("反向序列相关系数 = %v, %v", v, ok)
+	}
+	if _, ok := corr.Get("BTCUSDT", "NEWUSDT"); ok {
+		t.Error("样本不足的交易对不应有相关系数")
+	}
+}
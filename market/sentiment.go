@@ -0,0 +1,286 @@
+package market
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// liquidationStream 全市场强平订单流（每个交易对每秒最多推送一条最新强平）
+const liquidationStream = "!forceOrder@arr"
+
+var (
+	// liquidationWindows 强平统计的滚动窗口
+	liquidationWindows = []time.Duration{5 * time.Minute, time.Hour, 4 * time.Hour}
+	// takerFlowWindows 主动买卖量统计的滚动窗口
+	takerFlowWindows = []time.Duration{time.Hour, 4 * time.Hour}
+)
+
+// 多空比数据（币安每5分钟更新一次，缓存5分钟）
+const (
+	longShortRatioPeriod   = "5m"
+	longShortRatioLimit    = 13 // 当前值 + 1小时前（12个5分钟周期）
+	longShortRatioCacheTTL = 5 * time.Minute
+)
+
+// SentimentData 市场情绪数据（强平、多空比、主动买卖量）
+type SentimentData struct {
+	Liquidations       []LiquidationWindow // 强平统计（强平流未启动时为空）
+	GlobalLongShort    *LongShortRatio     // 全市场账户多空比
+	TopTraderLongShort *LongShortRatio     // 大户账户多空比
+	TakerFlow          []TakerFlowWindow   // 主动买卖量
+}
+
+// LiquidationWindow 滚动窗口内的强平统计
+type LiquidationWindow struct {
+	Window   time.Duration
+	LongUSD  float64 // 多头被强平金额（强平单方向为SELL）
+	ShortUSD float64 // 空头被强平金额（强平单方向为BUY）
+	Count    int
+}
+
+// LongShortRatio 账户多空比
+type LongShortRatio struct {
+	Ratio     float64 // 多空账户数比值
+	LongPct   float64 // 多头账户占比（百分比）
+	ShortPct  float64 // 空头账户占比（百分比）
+	Change1h  float64 // 相对1小时前的多空比变化
+	UpdatedAt time.Time
+}
+
+// TakerFlowWindow 滚动窗口内的主动买卖量
+type TakerFlowWindow struct {
+	Window  time.Duration
+	BuyUSD  float64 // 主动买入成交额
+	SellUSD float64 // 主动卖出成交额
+	Ratio   float64 // 买/卖比值（卖出为0时为0）
+}
+
+// liquidationEvent 单次强平
+type liquidationEvent struct {
+	time     time.Time
+	side     string // 强平单方向：SELL=多头被强平，BUY=空头被强平
+	notional float64
+}
+
+// liquidationStore 按交易对保存最近的强平事件（保留最长窗口内的数据）
+var liquidationStore = struct {
+	sync.Mutex
+	active bool
+	events map[string][]liquidationEvent
+}{events: make(map[string][]liquidationEvent)}
+
+// recordLiquidation 记录一次强平并清理超出最长窗口的事件
+func recordLiquidation(symbol, side string, notional float64, at time.Time) {
+	liquidationStore.Lock()
+	defer liquidationStore.Unlock()
+
+	cutoff := at.Add(-liquidationWindows[len(liquidationWindows)-1])
+	events := liquidationStore.events[symbol]
+	start := 0
+	for start < len(events) && events[start].time.Before(cutoff) {
+		start++
+	}
+	liquidationStore.events[symbol] = append(events[start:], liquidationEvent{time: at, side: side, notional: notional})
+}
+
+// getLiquidationWindows 统计交易对在各滚动窗口内的强平，强平流未启动时返回nil
+func getLiquidationWindows(symbol string, now time.Time) []LiquidationWindow {
+	liquidationStore.Lock()
+	defer liquidationStore.Unlock()
+
+	if !liquidationStore.active {
+		return nil
+	}
+
+	windows := make([]LiquidationWindow, len(liquidationWindows))
+	for i, w := range liquidationWindows {
+		windows[i].Window = w
+	}
+	for _, e := range liquidationStore.events[symbol] {
+		age := now.Sub(e.time)
+		for i, w := range liquidationWindows {
+			if age > w {
+				continue
+			}
+			if e.side == "SELL" {
+				windows[i].LongUSD += e.notional
+			} else {
+				windows[i].ShortUSD += e.notional
+			}
+			windows[i].Count++
+		}
+	}
+	return windows
+}
+
+// LiquidationWSData 强平订单流推送数据
+type LiquidationWSData struct {
+	EventType string `json:"e"`
+	EventTime int64  `json:"E"`
+	Order     struct {
+		Symbol       string `json:"s"`
+		Side         string `json:"S"`
+		AveragePrice string `json:"ap"`
+		FilledQty    string `json:"z"`
+		TradeTime    int64  `json:"T"`
+	} `json:"o"`
+}
+
+// subscribeLiquidations 订阅全市场强平订单流
+func (m *WSMonitor) subscribeLiquidations() error {
+	ch := m.combinedClient.AddSubscriber(liquidationStream, 1000)
+	go m.handleLiquidationData(ch)
+	if err := m.combinedClient.subscribeStreams([]string{liquidationStream}); err != nil {
+		return err
+	}
+
+	liquidationStore.Lock()
+	liquidationStore.active = true
+	liquidationStore.Unlock()
+	return nil
+}
+
+// handleLiquidationData 处理强平订单推送
+func (m *WSMonitor) handleLiquidationData(ch <-chan []byte) {
+	for data := range ch {
+		var liq LiquidationWSData
+		if err := json.Unmarshal(data, &liq); err != nil {
+			log.Printf("解析强平数据失败: %v", err)
+			continue
+		}
+		price, _ := strconv.ParseFloat(liq.Order.AveragePrice, 64)
+		qty, _ := strconv.ParseFloat(liq.Order.FilledQty, 64)
+		if price <= 0 || qty <= 0 {
+			continue
+		}
+		recordLiquidation(liq.Order.Symbol, liq.Order.Side, price*qty, time.UnixMilli(liq.Order.TradeTime))
+	}
+}
+
+// longShortRatioCache 多空比缓存（key: 接口路径 + 交易对）
+var longShortRatioCache sync.Map // map[string]*LongShortRatio
+
+// getLongShortRatio 获取账户多空比（5分钟缓存）
+// endpoint: globalLongShortAccountRatio（全市场）或 topLongShortAccountRatio（大户）
+func getLongShortRatio(endpoint, symbol string) (*LongShortRatio, error) {
+	key := endpoint + ":" + symbol
+	if cached, ok := longShortRatioCache.Load(key); ok {
+		ratio := cached.(*LongShortRatio)
+		if time.Since(ratio.UpdatedAt) < longShortRatioCacheTTL {
+			return ratio, nil
+		}
+	}
+
+	ratio, err := NewAPIClient().GetLongShortRatio(endpoint, symbol, longShortRatioPeriod, longShortRatioLimit)
+	if err != nil {
+		return nil, err
+	}
+	longShortRatioCache.Store(key, ratio)
+	return ratio, nil
+}
+
+// GetLongShortRatio 获取账户多空比历史，返回最新值及相对最早一条的变化
+func (c *APIClient) GetLongShortRatio(endpoint, symbol, period string, limit int) (*LongShortRatio, error) {
+	url := fmt.Sprintf("%s/futures/data/%s", c.baseURL, endpoint)
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	q := req.URL.Query()
+	q.Add("symbol", symbol)
+	q.Add("period", period)
+	q.Add("limit", strconv.Itoa(limit))
+	req.URL.RawQuery = q.Encode()
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	// 按时间从旧到新返回
+	var result []struct {
+		LongShortRatio string `json:"longShortRatio"`
+		LongAccount    string `json:"longAccount"`
+		ShortAccount   string `json:"shortAccount"`
+		Timestamp      int64  `json:"timestamp"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("解析多空比失败: %v, 响应: %s", err, string(body))
+	}
+	if len(result) == 0 {
+		return nil, fmt.Errorf("%s 多空比数据为空", symbol)
+	}
+
+	latest := result[len(result)-1]
+	ratio := &LongShortRatio{UpdatedAt: time.Now()}
+	ratio.Ratio, _ = strconv.ParseFloat(latest.LongShortRatio, 64)
+	ratio.LongPct, _ = strconv.ParseFloat(latest.LongAccount, 64)
+	ratio.ShortPct, _ = strconv.ParseFloat(latest.ShortAccount, 64)
+	ratio.LongPct *= 100
+	ratio.ShortPct *= 100
+	if earliest, err := strconv.ParseFloat(result[0].LongShortRatio, 64); err == nil && len(result) > 1 {
+		ratio.Change1h = ratio.Ratio - earliest
+	}
+	return ratio, nil
+}
+
+// calculateTakerFlow 统计 period 内的主动买卖成交额
+// 使用能整除 period 的最长周期K线，数据不足时回退到更短周期；没有可用周期时返回nil
+func calculateTakerFlow(klinesByTF map[string][]Kline, timeframes []string, period time.Duration) *TakerFlowWindow {
+	for i := len(timeframes) - 1; i >= 0; i-- {
+		d, ok := TimeframeDuration(timeframes[i])
+		if !ok || d > period || period%d != 0 {
+			continue
+		}
+		n := int(period / d)
+		klines := klinesByTF[timeframes[i]]
+		if len(klines) < n {
+			continue
+		}
+
+		flow := &TakerFlowWindow{Window: period}
+		for _, k := range klines[len(klines)-n:] {
+			flow.BuyUSD += k.TakerBuyQuoteVolume
+			flow.SellUSD += k.QuoteVolume - k.TakerBuyQuoteVolume
+		}
+		if flow.SellUSD > 0 {
+			flow.Ratio = flow.BuyUSD / flow.SellUSD
+		}
+		return flow
+	}
+	return nil
+}
+
+// getSentiment 汇总交易对的市场情绪数据（各项失败互不影响）
+func getSentiment(symbol string, klinesByTF map[string][]Kline, timeframes []string) *SentimentData {
+	sentiment := &SentimentData{
+		Liquidations: getLiquidationWindows(symbol, time.Now()),
+	}
+
+	if ratio, err := getLongShortRatio("globalLongShortAccountRatio", symbol); err == nil {
+		sentiment.GlobalLongShort = ratio
+	}
+	if ratio, err := getLongShortRatio("topLongShortAccountRatio", symbol); err == nil {
+		sentiment.TopTraderLongShort = ratio
+	}
+
+	for _, w := range takerFlowWindows {
+		if flow := calculateTakerFlow(klinesByTF, timeframes, w); flow != nil {
+			sentiment.TakerFlow = append(sentiment.TakerFlow, *flow)
+		}
+	}
+	return sentiment
+}
@@ -0,0 +1,143 @@
+package market
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestLiquidationWindows 测试强平滚动窗口统计
+func TestLiquidationWindows(t *testing.T) {
+	liquidationStore.Lock()
+	liquidationStore.active = false
+	liquidationStore.events = make(map[string][]liquidationEvent)
+	liquidationStore.Unlock()
+
+	now := time.Now()
+	if getLiquidationWindows("BTCUSDT", now) != nil {
+		t.Error("强平流未启动时应返回nil")
+	}
+
+	liquidationStore.Lock()
+	liquidationStore.active = true
+	liquidationStore.Unlock()
+	defer func() {
+		liquidationStore.Lock()
+		liquidationStore.active = false
+		liquidationStore.events = make(map[string][]liquidationEvent)
+		liquidationStore.Unlock()
+	}()
+
+	recordLiquidation("BTCUSDT", "SELL", 1000, now.Add(-5*time.Hour)) // 超出最长窗口，下一次记录时清理
+	recordLiquidation("BTCUSDT", "SELL", 2000, now.Add(-2*time.Hour))
+	recordLiquidation("BTCUSDT", "BUY", 500, now.Add(-30*time.Minute))
+	recordLiquidation("BTCUSDT", "SELL", 300, now.Add(-time.Minute))
+
+	windows := getLiquidationWindows("BTCUSDT", now)
+	expected := []LiquidationWindow{
+		{Window: 5 * time.Minute, LongUSD: 300, Count: 1},
+		{Window: time.Hour, LongUSD: 300, ShortUSD: 500, Count: 2},
+		{Window: 4 * time.Hour, LongUSD: 2300, ShortUSD: 500, Count: 3},
+	}
+	if len(windows) != len(expected) {
+		t.Fatalf("窗口数量 = %d, 期望 %d", len(windows), len(expected))
+	}
+	for i := range expected {
+		if windows[i] != expected[i] {
+			t.Errorf("窗口 %s = %+v, 期望 %+v", windowLabel(expected[i].Window), windows[i], expected[i])
+		}
+	}
+
+	liquidationStore.Lock()
+	kept := len(liquidationStore.events["BTCUSDT"])
+	liquidationStore.Unlock()
+	if kept != 3 {
+		t.Errorf("超出最长窗口的事件应被清理, 剩余 %d 条", kept)
+	}
+}
+
+// TestHandleLiquidationData 测试解析强平订单推送
+func TestHandleLiquidationData(t *testing.T) {
+	liquidationStore.Lock()
+	liquidationStore.active = true
+	liquidationStore.events = make(map[string][]liquidationEvent)
+	liquidationStore.Unlock()
+	defer func() {
+		liquidationStore.Lock()
+		liquidationStore.active = false
+		liquidationStore.events = make(map[string][]liquidationEvent)
+		liquidationStore.Unlock()
+	}()
+
+	now := time.Now()
+	ch := make(chan []byte, 2)
+	ch <- []byte(`{"e":"forceOrder","E":1,"o":{"s":"ETHUSDT","S":"BUY","ap":"2000","z":"1.5","T":` + strconv.FormatInt(now.UnixMilli(), 10) + `}}`)
+	ch <- []byte(`{"e":"forceOrder","E":1,"o":{"s":"ETHUSDT","S":"SELL","ap":"2000","z":"0","T":` + strconv.FormatInt(now.UnixMilli(), 10) + `}}`)
+	close(ch)
+	(&WSMonitor{}).handleLiquidationData(ch)
+
+	windows := getLiquidationWindows("ETHUSDT", now)
+	if windows[0].ShortUSD != 3000 || windows[0].LongUSD != 0 || windows[0].Count != 1 {
+		t.Errorf("强平统计 = %+v, 期望空头被强平 3000（数量为0的推送应跳过）", windows[0])
+	}
+}
+
+// TestCalculateTakerFlow 测试主动买卖成交额统计
+func TestCalculateTakerFlow(t *testing.T) {
+	klines3m := make([]Kline, 100)
+	for i := range klines3m {
+		klines3m[i] = Kline{QuoteVolume: 100, TakerBuyQuoteVolume: 60}
+	}
+	klines4h := []Kline{{QuoteVolume: 10000, TakerBuyQuoteVolume: 4000}, {QuoteVolume: 8000, TakerBuyQuoteVolume: 2000}}
+	byTF := map[string][]Kline{"3m": klines3m, "4h": klines4h}
+	tfs := []string{"3m", "4h"}
+
+	// 1小时 = 最近20根3分钟K线
+	flow := calculateTakerFlow(byTF, tfs, time.Hour)
+	if flow == nil || flow.BuyUSD != 1200 || flow.SellUSD != 800 || math.Abs(flow.Ratio-1.5) > 1e-9 {
+		t.Errorf("1h主动买卖 = %+v, 期望 买1200/卖800", flow)
+	}
+
+	// 4小时 = 最近1根4小时K线
+	flow = calculateTakerFlow(byTF, tfs, 4*time.Hour)
+	if flow == nil || flow.BuyUSD != 2000 || flow.SellUSD != 6000 {
+		t.Errorf("4h主动买卖 = %+v, 期望 买2000/卖6000", flow)
+	}
+
+	if calculateTakerFlow(map[string][]Kline{"1d": klines4h}, []string{"1d"}, time.Hour) != nil {
+		t.Error("没有可用周期时应返回nil")
+	}
+}
+
+// TestFormat_Sentiment 测试情绪数据输出到提示词
+func TestFormat_Sentiment(t *testing.T) {
+	data := &Data{
+		Symbol:       "BTCUSDT",
+		CurrentPrice: 100,
+		Sentiment: &SentimentData{
+			Liquidations:       []LiquidationWindow{{Window: 5 * time.Minute, LongUSD: 300, Count: 1}},
+			GlobalLongShort:    &LongShortRatio{Ratio: 1.85, LongPct: 64.9, ShortPct: 35.1, Change1h: 0.05},
+			TopTraderLongShort: &LongShortRatio{Ratio: 0.9, LongPct: 47.4, ShortPct: 52.6},
+			TakerFlow:          []TakerFlowWindow{{Window: time.Hour, BuyUSD: 1200, SellUSD: 800, Ratio: 1.5}},
+		},
+	}
+
+	output := Format(data)
+	for _, want := range []string{
+		"Sentiment signals:",
+		"Liquidations: 5m longs $300 / shorts $0 (1 orders)",
+		"Long/short account ratio (all accounts): 1.85 (long 64.9% / short 35.1%), 1h change +0.05",
+		"Long/short account ratio (top traders): 0.90",
+		"Taker volume: 1h buy $1200 / sell $800 (ratio 1.50)",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("输出缺少 %q", want)
+		}
+	}
+
+	if strings.Contains(Format(&Data{Symbol: "BTCUSDT", Sentiment: &SentimentData{}}), "Sentiment signals") {
+		t.Error("没有情绪数据时不应输出标题")
+	}
+}
@@ -0,0 +1,458 @@
+package market
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 行情数据源名称（与交易所ID一致）
+const (
+	SourceBinance     = "binance"
+	SourceHyperliquid = "hyperliquid"
+	SourceAster       = "aster"
+)
+
+const (
+	asterBaseURL              = "https://fapi.asterdex.com"
+	hyperliquidInfoURL        = "https://api.hyperliquid.xyz/info"
+	hyperliquidTestnetInfoURL = "https://api.hyperliquid-testnet.xyz/info"
+	hyperliquidCtxCacheTTL    = 1 * time.Minute  // metaAndAssetCtxs 缓存时间
+	hyperliquidKlineCacheTTL  = 15 * time.Second // candleSnapshot 缓存时间
+)
+
+// hyperliquidIntervals Hyperliquid candleSnapshot 支持的K线周期（从大到小，不支持 6h）
+var hyperliquidIntervals = []string{"1d", "12h", "8h", "4h", "2h", "1h", "30m", "15m", "5m", "3m", "1m"}
+
+// hyperliquidSources 按网络共享的 Hyperliquid 数据源，使所有交易员共用同一份缓存
+var (
+	hyperliquidSourcesMu sync.Mutex
+	hyperliquidSources   = make(map[bool]*HyperliquidSource)
+)
+
+// MarketDataSource 行情数据源（K线、持仓量、资金费率），交易员按所在交易所选择
+type MarketDataSource interface {
+	Name() string
+	// Klines 最近 limit 根K线（按时间升序，最后一根可能未收盘）
+	Klines(symbol, timeframe string, limit int) ([]Kline, error)
+	OpenInterest(symbol string) (*OIData, error)
+	// FundingRate 资金费率（按8小时结算周期）
+	FundingRate(symbol string) (float64, error)
+	// OrderBook 该交易所的订单簿（前 orderBookDepthLevels 档）
+	OrderBook(symbol string) (*OrderBook, error)
+}
+
+// SourceForExchange 按交易所选择行情数据源（未知交易所使用币安）
+func SourceForExchange(exchange string, testnet bool) MarketDataSource {
+	switch exchange {
+	case SourceHyperliquid:
+		return sharedHyperliquidSource(testnet)
+	case SourceAster:
+		return NewAsterSource()
+	default:
+		return BinanceSource{}
+	}
+}
+
+// BinanceSource 币安USDT永续行情（K线来自 WSMonitor 缓存，其他计价资产按基础资产映射）
+type BinanceSource struct{}
+
+func (BinanceSource) Name() string { return SourceBinance }
+
+func (BinanceSource) Klines(symbol, timeframe string, limit int) ([]Kline, error) {
+	return WSMonitorCli.GetCurrentKlines(ReferenceSymbol(symbol), timeframe)
+}
+
+func (BinanceSource) OpenInterest(symbol string) (*OIData, error) {
+	return getOpenInterestData(NewAPIClient(), ReferenceSymbol(symbol))
+}
+
+func (BinanceSource) FundingRate(symbol string) (float64, error) {
+	return getFundingRate(NewAPIClient(), ReferenceSymbol(symbol))
+}
+
+func (BinanceSource) OrderBook(symbol string) (*OrderBook, error) {
+	return GetOrderBook(symbol)
+}
+
+// AsterSource Aster永续行情（币安兼容REST接口）
+type AsterSource struct {
+	apiClient *APIClient
+}
+
+func NewAsterSource() *AsterSource {
+	return &AsterSource{apiClient: newAPIClientWithBaseURL(asterBaseURL)}
+}
+
+func (s *AsterSource) Name() string { return SourceAster }
+
+func (s *AsterSource) Klines(symbol, timeframe string, limit int) ([]Kline, error) {
+	return s.apiClient.GetKlines(Normalize(symbol), timeframe, limit)
+}
+
+func (s *AsterSource) OpenInterest(symbol string) (*OIData, error) {
+	return getOpenInterestData(s.apiClient, Normalize(symbol))
+}
+
+func (s *AsterSource) FundingRate(symbol string) (float64, error) {
+	return getFundingRate(s.apiClient, Normalize(symbol))
+}
+
+func (s *AsterSource) OrderBook(symbol string) (*OrderBook, error) {
+	return s.apiClient.GetDepth(Normalize(symbol), orderBookDepthLevels)
+}
+
+// HyperliquidSource Hyperliquid永续行情（info 接口的 candleSnapshot 和 metaAndAssetCtxs）
+type HyperliquidSource struct {
+	apiClient *APIClient
+	infoURL   string
+
+	mu          sync.Mutex
+	assetCtxs   map[string]hyperliquidAssetCtx // 币种 -> 资金费率、持仓量
+	coins       map[string]string              // 大写币种 -> 交易所币种名（区分大小写，如 kPEPE）
+	ctxUpdateAt time.Time
+
+	klineMu    sync.Mutex
+	klineCache map[string]hyperliquidKlines // coin|interval -> 最近一次获取的K线
+}
+
+// hyperliquidKlines candleSnapshot 缓存
+type hyperliquidKlines struct {
+	klines    []Kline
+	limit     int // 获取时请求的K线数量
+	fetchedAt time.Time
+}
+
+// hyperliquidAssetCtx metaAndAssetCtxs 中单个币种的上下文
+type hyperliquidAssetCtx struct {
+	Funding      string `json:"funding"`      // 每小时资金费率
+	OpenInterest string `json:"openInterest"` // 持仓量（币数量）
+	MarkPx       string `json:"markPx"`
+}
+
+func NewHyperliquidSource(testnet bool) *HyperliquidSource {
+	infoURL := hyperliquidInfoURL
+	if testnet {
+		infoURL = hyperliquidTestnetInfoURL
+	}
+	return &HyperliquidSource{apiClient: NewAPIClient(), infoURL: infoURL}
+}
+
+// sharedHyperliquidSource 获取指定网络共享的 Hyperliquid 数据源
+func sharedHyperliquidSource(testnet bool) *HyperliquidSource {
+	hyperliquidSourcesMu.Lock()
+	defer hyperliquidSourcesMu.Unlock()
+
+	src, ok := hyperliquidSources[testnet]
+	if !ok {
+		src = NewHyperliquidSource(testnet)
+		hyperliquidSources[testnet] = src
+	}
+	return src
+}
+
+func (s *HyperliquidSource) Name() string { return SourceHyperliquid }
+
+// post 调用 Hyperliquid info 接口
+func (s *HyperliquidSource) post(request interface{}, result interface{}) error {
+	payload, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	resp, err := s.apiClient.client.Post(s.infoURL, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("Hyperliquid info 接口返回 %d: %s", resp.StatusCode, string(body))
+	}
+	if err := json.Unmarshal(body, result); err != nil {
+		return fmt.Errorf("解析Hyperliquid响应失败: %v, 响应: %s", err, string(body))
+	}
+	return nil
+}
+
+// Klines 获取K线（15秒缓存）；Hyperliquid 不支持的周期（如 6h）由能整除它的最大周期合并而成
+func (s *HyperliquidSource) Klines(symbol, timeframe string, limit int) ([]Kline, error) {
+	d, ok := TimeframeDuration(timeframe)
+	if !ok {
+		return nil, fmt.Errorf("不支持的K线周期: %s", timeframe)
+	}
+	interval, ratio := hyperliquidInterval(timeframe, d)
+	if interval == "" {
+		return nil, fmt.Errorf("Hyperliquid 不支持K线周期: %s", timeframe)
+	}
+
+	coin := s.coinName(symbol)
+	if ratio == 1 {
+		return s.cachedCandles(coin, interval, limit)
+	}
+
+	// 多取一个周期的小K线，保证开头不完整的周期被丢弃后仍有 limit 根
+	candles, err := s.cachedCandles(coin, interval, (limit+1)*ratio)
+	if err != nil {
+		return nil, err
+	}
+	klines := aggregateKlines(candles, d, ratio)
+	if len(klines) > limit {
+		klines = klines[len(klines)-limit:]
+	}
+	return klines, nil
+}
+
+// hyperliquidInterval 选择请求的K线周期：支持则直接使用，否则使用能整除它的最大周期，ratio 为合并倍数
+func hyperliquidInterval(timeframe string, d time.Duration) (interval string, ratio int) {
+	for _, candidate := range hyperliquidIntervals {
+		if candidate == timeframe {
+			return timeframe, 1
+		}
+	}
+	for _, candidate := range hyperliquidIntervals {
+		if cd, ok := TimeframeDuration(candidate); ok && cd < d && d%cd == 0 {
+			return candidate, int(d / cd)
+		}
+	}
+	return "", 0
+}
+
+// aggregateKlines 将小周期K线按 d 对齐（UTC）合并为大周期K线，丢弃开头不完整的周期
+func aggregateKlines(candles []Kline, d time.Duration, ratio int) []Kline {
+	period := d.Milliseconds()
+	var klines []Kline
+	var counts []int
+	for _, c := range candles {
+		openTime := c.OpenTime - c.OpenTime%period
+		if n := len(klines); n > 0 && klines[n-1].OpenTime == openTime {
+			k := &klines[n-1]
+			k.High = math.Max(k.High, c.High)
+			k.Low = math.Min(k.Low, c.Low)
+			k.Close = c.Close
+			k.CloseTime = c.CloseTime
+			k.Volume += c.Volume
+			k.QuoteVolume += c.QuoteVolume
+			k.Trades += c.Trades
+			counts[n-1]++
+			continue
+		}
+		k := c
+		k.OpenTime = openTime
+		klines = append(klines, k)
+		counts = append(counts, 1)
+	}
+	if len(klines) > 1 && counts[0] < ratio {
+		klines = klines[1:]
+	}
+	return klines
+}
+
+// cachedCandles 获取最近 limit 根K线，缓存期内且缓存数量足够时直接返回缓存
+func (s *HyperliquidSource) cachedCandles(coin, interval string, limit int) ([]Kline, error) {
+	key := coin + "|" + interval
+
+	s.klineMu.Lock()
+	cached, ok := s.klineCache[key]
+	s.klineMu.Unlock()
+
+	if !ok || cached.limit < limit || time.Since(cached.fetchedAt) >= hyperliquidKlineCacheTTL {
+		klines, err := s.fetchCandles(coin, interval, limit)
+		if err != nil {
+			return nil, err
+		}
+		cached = hyperliquidKlines{klines: klines, limit: limit, fetchedAt: time.Now()}
+
+		s.klineMu.Lock()
+		if s.klineCache == nil {
+			s.klineCache = make(map[string]hyperliquidKlines)
+		}
+		s.klineCache[key] = cached
+		s.klineMu.Unlock()
+	}
+
+	klines := cached.klines
+	if len(klines) > limit {
+		klines = klines[len(klines)-limit:]
+	}
+	return append([]Kline(nil), klines...), nil
+}
+
+// fetchCandles 调用 candleSnapshot 获取最近 limit 根K线
+func (s *HyperliquidSource) fetchCandles(coin, interval string, limit int) ([]Kline, error) {
+	d, _ := TimeframeDuration(interval)
+	end := time.Now()
+	start := end.Add(-time.Duration(limit) * d)
+
+	var candles []struct {
+		OpenTime  int64  `json:"t"`
+		CloseTime int64  `json:"T"`
+		Open      string `json:"o"`
+		High      string `json:"h"`
+		Low       string `json:"l"`
+		Close     string `json:"c"`
+		Volume    string `json:"v"`
+		Trades    int    `json:"n"`
+	}
+	request := map[string]interface{}{
+		"type": "candleSnapshot",
+		"req": map[string]interface{}{
+			"coin":      coin,
+			"interval":  interval,
+			"startTime": start.UnixMilli(),
+			"endTime":   end.UnixMilli(),
+		},
+	}
+	if err := s.post(request, &candles); err != nil {
+		return nil, err
+	}
+
+	klines := make([]Kline, 0, len(candles))
+	for _, c := range candles {
+		k := Kline{OpenTime: c.OpenTime, CloseTime: c.CloseTime, Trades: c.Trades}
+		k.Open, _ = strconv.ParseFloat(c.Open, 64)
+		k.High, _ = strconv.ParseFloat(c.High, 64)
+		k.Low, _ = strconv.ParseFloat(c.Low, 64)
+		k.Close, _ = strconv.ParseFloat(c.Close, 64)
+		k.Volume, _ = strconv.ParseFloat(c.Volume, 64)
+		k.QuoteVolume = k.Volume * k.Close // Hyperliquid 不提供成交额，按收盘价估算
+		klines = append(klines, k)
+	}
+	if len(klines) > limit {
+		klines = klines[len(klines)-limit:]
+	}
+	return klines, nil
+}
+
+// coinName 将交易对解析为交易所币种名（保留大小写，如 kPEPEUSDC -> kPEPE），meta 获取失败时使用大写基础资产
+func (s *HyperliquidSource) coinName(symbol string) string {
+	base, _ := SplitSymbol(symbol)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.refreshAssetCtxsLocked(); err == nil {
+		if coin, ok := s.coins[base]; ok {
+			return coin
+		}
+	}
+	return base
+}
+
+// assetCtx 获取币种的资金费率和持仓量（1分钟缓存，所有币种一次请求）
+func (s *HyperliquidSource) assetCtx(symbol string) (*hyperliquidAssetCtx, error) {
+	base, _ := SplitSymbol(symbol)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.refreshAssetCtxsLocked(); err != nil {
+		return nil, err
+	}
+	ctx, ok := s.assetCtxs[s.coins[base]]
+	if !ok {
+		return nil, fmt.Errorf("Hyperliquid 没有 %s 永续合约", base)
+	}
+	return &ctx, nil
+}
+
+// refreshAssetCtxsLocked 缓存过期时重新获取 metaAndAssetCtxs（调用方需持有 s.mu）
+func (s *HyperliquidSource) refreshAssetCtxsLocked() error {
+	if s.assetCtxs != nil && time.Since(s.ctxUpdateAt) < hyperliquidCtxCacheTTL {
+		return nil
+	}
+
+	// 响应为 [meta, assetCtxs]，assetCtxs 与 meta.universe 按下标对应
+	var result []json.RawMessage
+	if err := s.post(map[string]string{"type": "metaAndAssetCtxs"}, &result); err != nil {
+		return err
+	}
+	if len(result) != 2 {
+		return fmt.Errorf("Hyperliquid metaAndAssetCtxs 响应格式错误")
+	}
+	var meta struct {
+		Universe []struct {
+			Name string `json:"name"`
+		} `json:"universe"`
+	}
+	var ctxs []hyperliquidAssetCtx
+	if err := json.Unmarshal(result[0], &meta); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(result[1], &ctxs); err != nil {
+		return err
+	}
+
+	s.assetCtxs = make(map[string]hyperliquidAssetCtx, len(ctxs))
+	s.coins = make(map[string]string, len(ctxs))
+	for i, asset := range meta.Universe {
+		if i < len(ctxs) {
+			s.assetCtxs[asset.Name] = ctxs[i]
+			s.coins[strings.ToUpper(asset.Name)] = asset.Name
+		}
+	}
+	s.ctxUpdateAt = time.Now()
+	return nil
+}
+
+func (s *HyperliquidSource) OpenInterest(symbol string) (*OIData, error) {
+	ctx, err := s.assetCtx(symbol)
+	if err != nil {
+		return nil, err
+	}
+	oi, _ := strconv.ParseFloat(ctx.OpenInterest, 64)
+	return &OIData{
+		Latest:  oi,
+		Average: oi * 0.999, // 近似平均值
+	}, nil
+}
+
+// FundingRate Hyperliquid 每小时结算资金费，按8小时折算以便与其他交易所一致
+func (s *HyperliquidSource) FundingRate(symbol string) (float64, error) {
+	ctx, err := s.assetCtx(symbol)
+	if err != nil {
+		return 0, err
+	}
+	rate, _ := strconv.ParseFloat(ctx.Funding, 64)
+	return rate * 8, nil
+}
+
+// OrderBook 通过 l2Book 获取订单簿（每边最多20档）
+func (s *HyperliquidSource) OrderBook(symbol string) (*OrderBook, error) {
+	coin := s.coinName(symbol)
+	var result struct {
+		Levels [][]struct {
+			Px string `json:"px"`
+			Sz string `json:"sz"`
+		} `json:"levels"`
+	}
+	if err := s.post(map[string]string{"type": "l2Book", "coin": coin}, &result); err != nil {
+		return nil, fmt.Errorf("获取%s订单簿失败: %v", coin, err)
+	}
+	if len(result.Levels) != 2 {
+		return nil, fmt.Errorf("Hyperliquid l2Book 响应格式错误")
+	}
+
+	book := &OrderBook{Symbol: symbol, UpdateTime: time.Now()}
+	for side, levels := range result.Levels {
+		raw := make([][2]string, 0, len(levels))
+		for _, l := range levels {
+			raw = append(raw, [2]string{l.Px, l.Sz})
+		}
+		if side == 0 {
+			book.Bids = parseOrderBookLevels(raw)
+		} else {
+			book.Asks = parseOrderBookLevels(raw)
+		}
+	}
+	return book, nil
+}
@@ -0,0 +1,172 @@
+package market
+
+import (
+	"encoding/json"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestSourceForExchange 测试按交易所选择行情数据源
+func TestSourceForExchange(t *testing.T) {
+	cases := map[string]string{
+		"binance":     SourceBinance,
+		"hyperliquid": SourceHyperliquid,
+		"aster":       SourceAster,
+		"unknown":     SourceBinance,
+	}
+	for exchange, want := range cases {
+		if got := SourceForExchange(exchange, false).Name(); got != want {
+			t.Errorf("%s 数据源 = %s, 期望 %s", exchange, got, want)
+		}
+	}
+	if src := SourceForExchange("hyperliquid", true).(*HyperliquidSource); src.infoURL != hyperliquidTestnetInfoURL {
+		t.Errorf("测试网应使用测试网接口, 实际 %s", src.infoURL)
+	}
+
+	var cfg *DataConfig
+	if cfg.DataSource().Name() != SourceBinance {
+		t.Error("未配置数据源时应使用币安")
+	}
+}
+
+// TestHyperliquidSource 测试 candleSnapshot 和 metaAndAssetCtxs 解析
+func TestHyperliquidSource(t *testing.T) {
+	ctxRequests, candleRequests := 0, 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var req struct {
+			Type string `json:"type"`
+			Coin string `json:"coin"`
+			Req  struct {
+				Coin     string `json:"coin"`
+				Interval string `json:"interval"`
+			} `json:"req"`
+		}
+		json.Unmarshal(body, &req)
+
+		switch req.Type {
+		case "candleSnapshot":
+			candleRequests++
+			switch {
+			case req.Req.Coin == "BTC" && req.Req.Interval == "3m":
+				w.Write([]byte(`[
+					{"t":0,"T":179999,"s":"BTC","i":"3m","o":"100","c":"101","h":"102","l":"99","v":"2","n":5},
+					{"t":180000,"T":359999,"s":"BTC","i":"3m","o":"101","c":"103","h":"104","l":"100","v":"3","n":7}
+				]`))
+			case req.Req.Coin == "kPEPE" && req.Req.Interval == "2h":
+				// 4h 的K线属于不完整的 0-6h 周期，6h/8h/10h 合并为 6h 周期
+				w.Write([]byte(`[
+					{"t":14400000,"T":21599999,"o":"1.0","c":"1.1","h":"1.2","l":"0.9","v":"10","n":1},
+					{"t":21600000,"T":28799999,"o":"1.1","c":"1.3","h":"1.4","l":"1.0","v":"20","n":2},
+					{"t":28800000,"T":35999999,"o":"1.3","c":"1.2","h":"1.5","l":"1.1","v":"30","n":3},
+					{"t":36000000,"T":43199999,"o":"1.2","c":"1.25","h":"1.3","l":"0.8","v":"40","n":4}
+				]`))
+			default:
+				t.Errorf("请求参数错误: %s", body)
+			}
+		case "l2Book":
+			if req.Coin != "kPEPE" {
+				t.Errorf("l2Book 币种错误: %s", body)
+			}
+			w.Write([]byte(`{"coin":"kPEPE","time":1,"levels":[
+				[{"px":"0.0099","sz":"1000","n":2},{"px":"0.0098","sz":"2000","n":1}],
+				[{"px":"0.0101","sz":"1500","n":3}]
+			]}`))
+		case "metaAndAssetCtxs":
+			ctxRequests++
+			w.Write([]byte(`[
+				{"universe":[{"name":"BTC","szDecimals":5},{"name":"ETH","szDecimals":4},{"name":"kPEPE","szDecimals":0}]},
+				[{"funding":"0.0000125","openInterest":"1000.5","markPx":"100000"},{"funding":"-0.00001","openInterest":"20000","markPx":"4000"},{"funding":"0","openInterest":"5","markPx":"0.01"}]
+			]`))
+		default:
+			t.Errorf("未知请求: %s", body)
+		}
+	}))
+	defer server.Close()
+
+	src := NewHyperliquidSource(false)
+	src.infoURL = server.URL
+
+	klines, err := src.Klines("BTCUSDC", "3m", 1)
+	if err != nil {
+		t.Fatalf("获取K线失败: %v", err)
+	}
+	if len(klines) != 1 || klines[0].OpenTime != 180000 || klines[0].Close != 103 || klines[0].Trades != 7 {
+		t.Errorf("K线解析错误（应保留最近 limit 根）: %+v", klines)
+	}
+	if _, err := src.Klines("BTCUSDC", "3m", 1); err != nil || candleRequests != 1 {
+		t.Errorf("缓存期内应只请求一次 candleSnapshot, 实际 %d 次 (%v)", candleRequests, err)
+	}
+
+	klines, err = src.Klines("KPEPEUSDC", "6h", 1)
+	if err != nil {
+		t.Fatalf("获取6h K线失败: %v", err)
+	}
+	if len(klines) != 1 {
+		t.Fatalf("6h K线数量 = %d, 期望 1: %+v", len(klines), klines)
+	}
+	if k := klines[0]; k.OpenTime != 21600000 || k.CloseTime != 43199999 || k.Open != 1.1 || k.Close != 1.25 ||
+		k.High != 1.5 || k.Low != 0.8 || k.Volume != 90 || k.Trades != 9 {
+		t.Errorf("6h K线应由2h K线合并: %+v", k)
+	}
+
+	rate, err := src.FundingRate("ETHUSDC")
+	if err != nil || math.Abs(rate-(-0.00008)) > 1e-12 {
+		t.Errorf("资金费率 = %v, %v, 期望按8小时折算为 -0.00008", rate, err)
+	}
+	oi, err := src.OpenInterest("BTCUSDC")
+	if err != nil || oi.Latest != 1000.5 {
+		t.Errorf("持仓量 = %+v, %v", oi, err)
+	}
+	if ctxRequests != 1 {
+		t.Errorf("缓存期内应只请求一次 metaAndAssetCtxs, 实际 %d 次", ctxRequests)
+	}
+	if _, err := src.FundingRate("DOGEUSDC"); err == nil {
+		t.Error("未上架的币种应返回错误")
+	}
+
+	book, err := src.OrderBook("KPEPEUSDC")
+	if err != nil || len(book.Bids) != 2 || len(book.Asks) != 1 || book.Bids[0].Price != 0.0099 || book.Asks[0].Quantity != 1500 {
+		t.Errorf("订单簿 = %+v, %v", book, err)
+	}
+}
+
+// TestAsterSource 测试币安兼容接口使用 Aster 地址
+func TestAsterSource(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("symbol") != "SOLUSDT" {
+			t.Errorf("交易对参数错误: %s", r.URL.RawQuery)
+		}
+		switch r.URL.Path {
+		case "/fapi/v1/klines":
+			w.Write([]byte(`[[0,"150","151","149","150.5","10",179999,"1505",3,"6","903"]]`))
+		case "/fapi/v1/openInterest":
+			w.Write([]byte(`{"openInterest":"5000","symbol":"SOLUSDT","time":1}`))
+		case "/fapi/v1/premiumIndex":
+			w.Write([]byte(`{"symbol":"SOLUSDT","lastFundingRate":"0.0002"}`))
+		case "/fapi/v1/depth":
+			w.Write([]byte(`{"lastUpdateId":1,"bids":[["150.4","3"]],"asks":[["150.6","2"]]}`))
+		default:
+			t.Errorf("未知路径: %s", r.URL.Path)
+		}
+	}))
+	defer server.Close()
+
+	src := &AsterSource{apiClient: newAPIClientWithBaseURL(server.URL)}
+	klines, err := src.Klines("SOL", "3m", 100)
+	if err != nil || len(klines) != 1 || klines[0].Close != 150.5 {
+		t.Errorf("K线 = %+v, %v", klines, err)
+	}
+	if oi, err := src.OpenInterest("SOLUSDT"); err != nil || oi.Latest != 5000 {
+		t.Errorf("持仓量 = %+v, %v", oi, err)
+	}
+	if rate, err := src.FundingRate("SOLUSDT"); err != nil || rate != 0.0002 {
+		t.Errorf("资金费率 = %v, %v", rate, err)
+	}
+	if book, err := src.OrderBook("SOLUSDT"); err != nil || book.Mid() != 150.5 {
+		t.Errorf("订单簿 = %+v, %v", book, err)
+	}
+}
@@ -0,0 +1,307 @@
+package market
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	streamCheckInterval    = 15 * time.Second // 数据流健康检查间隔
+	streamSilenceThreshold = 60 * time.Second // 超过该时间没有消息视为数据流静默
+	streamPollBars         = 3                // REST 轮询每次获取的K线数
+	streamPollBatch        = 20               // 每次检查最多轮询的K线流数量（最久未轮询的优先）
+	streamPollConcurrency  = 4                // REST 轮询并发数
+	streamPollMaxBackoff   = 5 * time.Minute  // 轮询失败后的最长退避时间
+)
+
+// pollBackoff K线流 REST 轮询失败后的退避状态
+type pollBackoff struct {
+	failures int       // 连续失败次数
+	retryAt  time.Time // 下次允许轮询的时间
+}
+
+// 数据流状态
+const (
+	StreamHealthy = "healthy" // WebSocket 正常推送
+	StreamPolling = "polling" // WebSocket 静默，已切换为 REST 轮询
+	StreamStale   = "stale"   // WebSocket 静默且 REST 轮询失败，数据可能过期
+)
+
+// 行情整体状态
+const (
+	FeedHealthy  = "healthy"  // 所有数据流正常
+	FeedDegraded = "degraded" // 部分数据流轮询中或过期
+	FeedDown     = "down"     // 半数以上数据流过期，交易员应跳过周期
+)
+
+// StreamHealth 单个K线流的健康状态
+type StreamHealth struct {
+	Stream      string    `json:"stream"`
+	Symbol      string    `json:"symbol"`
+	Timeframe   string    `json:"timeframe"`
+	Status      string    `json:"status"`
+	LastMessage time.Time `json:"last_message"`        // 最近一次 WebSocket 消息（零值表示从未收到）
+	LastPoll    time.Time `json:"last_poll,omitempty"` // 最近一次成功的 REST 轮询
+}
+
+// StreamHealthReport 行情数据流健康报告
+type StreamHealthReport struct {
+	Status        string         `json:"status"`
+	Connected     bool           `json:"connected"`
+	ConnectedAt   time.Time      `json:"connected_at"`
+	Reconnects    int            `json:"reconnects"`
+	LastReconnect time.Time      `json:"last_reconnect"`
+	Total         int            `json:"total"`
+	Polling       int            `json:"polling"`
+	Stale         int            `json:"stale"`
+	Streams       []StreamHealth `json:"streams"` // 只列出非 healthy 的数据流
+}
+
+// klineStreamName 组合流中K线流的名称
+func klineStreamName(symbol, timeframe string) string {
+	return fmt.Sprintf("%s@kline_%s", strings.ToLower(symbol), timeframe)
+}
+
+// supervisedStreams 已批量订阅的K线流（交易对 × 周期）
+func (m *WSMonitor) supervisedStreams() []StreamHealth {
+	m.subscribedMutex.Lock()
+	defer m.subscribedMutex.Unlock()
+
+	timeframes := make([]string, 0, len(m.subscribedTimeframes))
+	for tf := range m.subscribedTimeframes {
+		timeframes = append(timeframes, tf)
+	}
+	sort.Strings(timeframes)
+
+	streams := make([]StreamHealth, 0, len(m.symbols)*len(timeframes))
+	for _, tf := range timeframes {
+		for _, symbol := range m.symbols {
+			streams = append(streams, StreamHealth{
+				Stream:    klineStreamName(symbol, tf),
+				Symbol:    symbol,
+				Timeframe: tf,
+			})
+		}
+	}
+	return streams
+}
+
+// classifyStream 判断数据流状态
+// 连接建立后还没收到消息的流从连接时间开始计算静默时长
+func classifyStream(lastMessage, connectedAt, lastPoll, now time.Time) string {
+	since := lastMessage
+	if connectedAt.After(since) {
+		since = connectedAt
+	}
+	if !since.IsZero() && now.Sub(since) < streamSilenceThreshold {
+		return StreamHealthy
+	}
+	if !lastPoll.IsZero() && now.Sub(lastPoll) < streamSilenceThreshold {
+		return StreamPolling
+	}
+	return StreamStale
+}
+
+// feedStatus 根据轮询中和过期的数据流数量汇总整体状态
+func feedStatus(total, polling, stale int) string {
+	switch {
+	case total > 0 && stale*2 > total:
+		return FeedDown
+	case polling > 0 || stale > 0:
+		return FeedDegraded
+	default:
+		return FeedHealthy
+	}
+}
+
+// streamHealth 生成当前的健康报告
+func (m *WSMonitor) streamHealth(now time.Time) *StreamHealthReport {
+	connectedAt, reconnects, lastReconnect := m.combinedClient.connectionState()
+	report := &StreamHealthReport{
+		Connected:     !connectedAt.IsZero(),
+		ConnectedAt:   connectedAt,
+		Reconnects:    reconnects,
+		LastReconnect: lastReconnect,
+		Streams:       []StreamHealth{},
+	}
+
+	for _, s := range m.supervisedStreams() {
+		s.LastMessage, _ = m.combinedClient.LastMessageTime(s.Stream)
+		s.LastPoll = m.lastPollTime(s.Stream)
+		s.Status = classifyStream(s.LastMessage, connectedAt, s.LastPoll, now)
+
+		report.Total++
+		switch s.Status {
+		case StreamPolling:
+			report.Polling++
+		case StreamStale:
+			report.Stale++
+		default:
+			continue
+		}
+		report.Streams = append(report.Streams, s)
+	}
+	report.Status = feedStatus(report.Total, report.Polling, report.Stale)
+	return report
+}
+
+// superviseStreams 定期检查数据流：静默的流切换为 REST 轮询，全部静默时强制重连
+func (m *WSMonitor) superviseStreams() {
+	ticker := time.NewTicker(streamCheckInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		m.checkStreams(time.Now())
+	}
+}
+
+// checkStreams 执行一次健康检查
+func (m *WSMonitor) checkStreams(now time.Time) {
+	connectedAt, _, _ := m.combinedClient.connectionState()
+	streams := m.supervisedStreams()
+	if len(streams) == 0 {
+		return
+	}
+
+	silent := 0
+	var due []StreamHealth
+	for _, s := range streams {
+		lastMessage, _ := m.combinedClient.LastMessageTime(s.Stream)
+		if classifyStream(lastMessage, connectedAt, time.Time{}, now) == StreamHealthy {
+			// WebSocket 恢复推送，停止轮询
+			if _, polling := m.streamPolls.LoadAndDelete(s.Stream); polling {
+				log.Printf("✓ %s 已恢复 WebSocket 推送，停止 REST 轮询", s.Stream)
+			}
+			m.pollBackoffs.Delete(s.Stream)
+			continue
+		}
+		silent++
+		if value, ok := m.pollBackoffs.Load(s.Stream); ok && now.Before(value.(pollBackoff).retryAt) {
+			continue
+		}
+		s.LastPoll = m.lastPollTime(s.Stream)
+		due = append(due, s)
+	}
+	m.pollStreams(due, now)
+
+	// 连接仍在但所有流都没有消息，说明连接已假死
+	if silent == len(streams) && !connectedAt.IsZero() && now.Sub(connectedAt) >= streamSilenceThreshold {
+		m.combinedClient.forceReconnect()
+	}
+}
+
+// pollStreams 轮询到期的静默K线流
+// 每次最多 streamPollBatch 个（最久未成功轮询、其次退避最久的优先，其余留到下次检查），
+// 并发不超过 streamPollConcurrency，失败的流指数退避
+func (m *WSMonitor) pollStreams(streams []StreamHealth, now time.Time) {
+	retryAt := func(stream string) time.Time {
+		if value, ok := m.pollBackoffs.Load(stream); ok {
+			return value.(pollBackoff).retryAt
+		}
+		return time.Time{}
+	}
+	sort.SliceStable(streams, func(i, j int) bool {
+		if !streams[i].LastPoll.Equal(streams[j].LastPoll) {
+			return streams[i].LastPoll.Before(streams[j].LastPoll)
+		}
+		return retryAt(streams[i].Stream).Before(retryAt(streams[j].Stream))
+	})
+	if len(streams) > streamPollBatch {
+		streams = streams[:streamPollBatch]
+	}
+
+	var wg sync.WaitGroup
+	semaphore := make(chan struct{}, streamPollConcurrency)
+	for _, s := range streams {
+		wg.Add(1)
+		semaphore <- struct{}{}
+		go func(s StreamHealth) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+			if m.pollStream(s.Symbol, s.Timeframe, now) {
+				m.pollBackoffs.Delete(s.Stream)
+			} else {
+				m.recordPollFailure(s.Stream, now)
+			}
+		}(s)
+	}
+	wg.Wait()
+}
+
+// recordPollFailure 记录轮询失败，退避时间从 2 个检查间隔开始翻倍，最长 streamPollMaxBackoff
+func (m *WSMonitor) recordPollFailure(stream string, now time.Time) {
+	backoff := pollBackoff{failures: 1}
+	if value, ok := m.pollBackoffs.Load(stream); ok {
+		backoff.failures = value.(pollBackoff).failures + 1
+	}
+	delay := streamPollMaxBackoff
+	if shift := backoff.failures; shift < 8 {
+		delay = min(streamCheckInterval<<shift, streamPollMaxBackoff)
+	}
+	backoff.retryAt = now.Add(delay)
+	m.pollBackoffs.Store(stream, backoff)
+}
+
+// lastPollTime 最近一次成功轮询的时间（从未轮询返回零值）
+func (m *WSMonitor) lastPollTime(stream string) time.Time {
+	if value, ok := m.streamPolls.Load(stream); ok {
+		return value.(time.Time)
+	}
+	return time.Time{}
+}
+
+// pollStream 通过 REST 获取最近的K线，替代静默的 WebSocket 流，返回是否成功
+func (m *WSMonitor) pollStream(symbol, timeframe string, now time.Time) bool {
+	stream := klineStreamName(symbol, timeframe)
+	klines, err := m.restClient().GetKlines(symbol, timeframe, streamPollBars)
+	if err != nil || len(klines) == 0 {
+		log.Printf("⚠️  %s REST 轮询失败: %v", stream, err)
+		return false
+	}
+	if _, polling := m.streamPolls.Load(stream); !polling {
+		log.Printf("⚠️  %s 超过 %v 没有 WebSocket 消息，切换为 REST 轮询", stream, streamSilenceThreshold)
+	}
+
+	// 与 WebSocket 更新使用同一把锁合并，缺口在锁外补齐
+	var gapFrom int64 = -1
+	d, _ := TimeframeDuration(timeframe)
+	m.updateKlines(symbol, timeframe, func(existing []Kline) []Kline {
+		if len(existing) > 0 && d > 0 && klines[0].OpenTime-existing[len(existing)-1].OpenTime > d.Milliseconds() {
+			gapFrom = existing[len(existing)-1].OpenTime + d.Milliseconds()
+		}
+		return mergeKlines(existing, klines, klineHistorySize)
+	})
+	if gapFrom >= 0 {
+		m.backfillKlines(symbol, timeframe, gapFrom, klines[0].OpenTime-d.Milliseconds())
+	}
+
+	// 已收盘K线写入本地库
+	var closed []Kline
+	for _, k := range klines {
+		if k.CloseTime < now.UnixMilli() {
+			closed = append(closed, k)
+		}
+	}
+	m.persistKlines(symbol, timeframe, closed)
+	m.streamPolls.Store(stream, now)
+	return true
+}
+
+// restClient REST 轮询使用的客户端
+func (m *WSMonitor) restClient() *APIClient {
+	if m.apiClient != nil {
+		return m.apiClient
+	}
+	return NewAPIClient()
+}
+
+// GetStreamHealth 行情数据流健康报告（监控器未启动时返回 nil）
+func GetStreamHealth() *StreamHealthReport {
+	if WSMonitorCli == nil {
+		return nil
+	}
+	return WSMonitorCli.streamHealth(time.Now())
+}
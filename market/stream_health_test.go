@@ -0,0 +1,264 @@
+package market
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestClassifyStream 测试数据流状态判断
+func TestClassifyStream(t *testing.T) {
+	now := time.Now()
+	recent := now.Add(-10 * time.Second)
+	old := now.Add(-5 * time.Minute)
+
+	cases := []struct {
+		name                           string
+		lastMessage, connectedAt, poll time.Time
+		want                           string
+	}{
+		{"正常推送", recent, old, time.Time{}, StreamHealthy},
+		{"刚连接尚未收到消息", time.Time{}, recent, time.Time{}, StreamHealthy},
+		{"静默且轮询成功", old, old, recent, StreamPolling},
+		{"静默且轮询过期", old, old, old, StreamStale},
+		{"从未连接", time.Time{}, time.Time{}, time.Time{}, StreamStale},
+	}
+	for _, c := range cases {
+		if got := classifyStream(c.lastMessage, c.connectedAt, c.poll, now); got != c.want {
+			t.Errorf("%s: 状态 = %s, 期望 %s", c.name, got, c.want)
+		}
+	}
+
+	if got := feedStatus(4, 0, 0); got != FeedHealthy {
+		t.Errorf("全部正常 = %s", got)
+	}
+	if got := feedStatus(4, 1, 2); got != FeedDegraded {
+		t.Errorf("半数过期 = %s, 期望 degraded", got)
+	}
+	if got := feedStatus(4, 0, 3); got != FeedDown {
+		t.Errorf("多数过期 = %s, 期望 down", got)
+	}
+}
+
+// TestCheckStreams_PollsSilentStream 测试静默的K线流切换为REST轮询并更新内存K线
+func TestCheckStreams_PollsSilentStream(t *testing.T) {
+	now := time.Now()
+	step := (3 * time.Minute).Milliseconds()
+	last := alignOpenTime(now.UnixMilli(), 3*time.Minute)
+
+	healthy := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !healthy {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(`{"code":-1,"msg":"unavailable"}`))
+			return
+		}
+		if r.URL.Path != "/fapi/v1/klines" || r.URL.Query().Get("symbol") != "BTCUSDT" {
+			t.Errorf("未知请求: %s", r.URL)
+		}
+		w.Write([]byte(`[
+			[` + itoa(last-step) + `,"100","101","99","100.5","10",` + itoa(last-1) + `,"1005",3,"6","603"],
+			[` + itoa(last) + `,"100.5","102","100","101.5","4",` + itoa(last+step-1) + `,"406",2,"2","203"]
+		]`))
+	}))
+	defer server.Close()
+
+	store := openTestKlineStore(t, 0)
+	m := &WSMonitor{
+		combinedClient:       NewCombinedStreamsClient(10),
+		symbols:              []string{"BTCUSDT"},
+		subscribedTimeframes: map[string]bool{"3m": true},
+		klineStore:           store,
+		apiClient:            newAPIClientWithBaseURL(server.URL),
+	}
+	m.getKlineDataMap("3m").Store("BTCUSDT", generateKlinesAt(last-3*step, 2))
+
+	// 未连接且没有消息：轮询前为 stale
+	if report := m.streamHealth(now); report.Status != FeedDown || report.Stale != 1 {
+		t.Fatalf("轮询前状态 = %+v", report)
+	}
+
+	m.checkStreams(now)
+	m.flushKlineWrites()
+	value, _ := m.getKlineDataMap("3m").Load("BTCUSDT")
+	klines := value.([]Kline)
+	if len(klines) != 4 || klines[3].OpenTime != last || klines[3].Close != 101.5 {
+		t.Errorf("轮询后内存K线不符: %+v", klines)
+	}
+	if got, _ := store.Range("BTCUSDT", "3m", 0, last); len(got) != 1 || got[0].OpenTime != last-step {
+		t.Errorf("只有已收盘K线应入库: %+v", got)
+	}
+
+	report := m.streamHealth(now)
+	if report.Status != FeedDegraded || report.Polling != 1 || len(report.Streams) != 1 || report.Streams[0].Stream != "btcusdt@kline_3m" {
+		t.Errorf("轮询后状态 = %+v", report)
+	}
+
+	// REST 也失败，超过阈值后变为过期
+	healthy = false
+	later := now.Add(2 * streamSilenceThreshold)
+	m.checkStreams(later)
+	if report := m.streamHealth(later); report.Status != FeedDown {
+		t.Errorf("轮询失败后状态 = %s, 期望 down", report.Status)
+	}
+
+	// WebSocket 恢复推送后停止轮询
+	m.combinedClient.lastMessage.Store("btcusdt@kline_3m", later)
+	m.checkStreams(later)
+	if _, polling := m.streamPolls.Load("btcusdt@kline_3m"); polling {
+		t.Error("恢复推送后应停止轮询")
+	}
+	if report := m.streamHealth(later); report.Status != FeedHealthy {
+		t.Errorf("恢复后状态 = %s", report.Status)
+	}
+}
+
+func itoa(v int64) string {
+	return strconv.FormatInt(v, 10)
+}
+
+// TestCheckStreams_ThrottlesPolling 测试每次检查限制轮询数量，失败的流退避
+func TestCheckStreams_ThrottlesPolling(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(`{"code":-1,"msg":"unavailable"}`))
+	}))
+	defer server.Close()
+
+	symbols := make([]string, streamPollBatch+5)
+	for i := range symbols {
+		symbols[i] = "COIN" + strconv.Itoa(i) + "USDT"
+	}
+	m := &WSMonitor{
+		combinedClient:       NewCombinedStreamsClient(10),
+		symbols:              symbols,
+		subscribedTimeframes: map[string]bool{"3m": true},
+		apiClient:            newAPIClientWithBaseURL(server.URL),
+	}
+
+	now := time.Now()
+	m.checkStreams(now)
+	if got := requests.Load(); got != streamPollBatch {
+		t.Fatalf("首次检查请求 %d 次, 期望 %d", got, streamPollBatch)
+	}
+	m.checkStreams(now)
+	if got := requests.Load(); got != streamPollBatch+5 {
+		t.Fatalf("第二次检查应只轮询剩余的流, 实际累计 %d 次", got)
+	}
+
+	// 失败后退避 2 个检查间隔
+	m.checkStreams(now.Add(streamCheckInterval))
+	if got := requests.Load(); got != streamPollBatch+5 {
+		t.Errorf("退避期内不应轮询, 实际累计 %d 次", got)
+	}
+	m.checkStreams(now.Add(2 * streamCheckInterval))
+	if got := requests.Load(); got != 2*streamPollBatch+5 {
+		t.Errorf("退避结束后应再次轮询一批, 实际累计 %d 次", got)
+	}
+
+	value, _ := m.pollBackoffs.Load(klineStreamName(symbols[0], "3m"))
+	if backoff := value.(pollBackoff); backoff.failures != 2 || !backoff.retryAt.Equal(now.Add(6*streamCheckInterval)) {
+		t.Errorf("连续失败后退避应翻倍: %+v", backoff)
+	}
+}
+
+// TestPollStream_BackfillOutsideLock 测试轮询补齐缺口时不持有K线流的锁，WebSocket 更新可以同时写入
+func TestPollStream_BackfillOutsideLock(t *testing.T) {
+	step := (3 * time.Minute).Milliseconds()
+	var m *WSMonitor
+	bars := func(from, to int64) string {
+		var parts []string
+		for open := from; open <= to; open += step {
+			parts = append(parts, `[`+itoa(open)+`,"1","1","1","1","1",`+itoa(open+step-1)+`,"1",1,"1","1"]`)
+		}
+		return "[" + strings.Join(parts, ",") + "]"
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start, _ := strconv.ParseInt(r.URL.Query().Get("startTime"), 10, 64)
+		if start == 0 {
+			w.Write([]byte(bars(5*step, 6*step)))
+			return
+		}
+		// 补齐请求期间收到 WebSocket 更新（持有锁时会死锁）
+		var update KlineWSData
+		update.Kline.StartTime = 6 * step
+		update.Kline.CloseTime = 7*step - 1
+		update.Kline.ClosePrice = "2"
+		m.processKlineUpdate("BTCUSDT", update, "3m")
+
+		end, _ := strconv.ParseInt(r.URL.Query().Get("endTime"), 10, 64)
+		w.Write([]byte(bars(start, min(end, 4*step))))
+	}))
+	defer server.Close()
+
+	m = &WSMonitor{apiClient: newAPIClientWithBaseURL(server.URL)}
+	m.getKlineDataMap("3m").Store("BTCUSDT", generateKlinesAt(0, 3))
+
+	done := make(chan bool)
+	go func() { done <- m.pollStream("BTCUSDT", "3m", time.Now()) }()
+	select {
+	case ok := <-done:
+		if !ok {
+			t.Fatal("轮询失败")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("补齐期间持有锁导致 WebSocket 更新阻塞")
+	}
+
+	value, _ := m.getKlineDataMap("3m").Load("BTCUSDT")
+	klines := value.([]Kline)
+	if len(klines) != 7 || klines[3].OpenTime != 3*step || klines[6].Close != 2 {
+		t.Errorf("轮询、补齐和 WebSocket 更新应合并: %+v", klines)
+	}
+}
+
+// TestSubscribeTimeframes_LoadsOutsideLock 测试新增周期加载历史数据时不持有订阅锁，且同一周期不会重复加载
+func TestSubscribeTimeframes_LoadsOutsideLock(t *testing.T) {
+	var m *WSMonitor
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		// 加载期间健康检查和其他交易员的订阅请求不应阻塞
+		m.supervisedStreams()
+		if err := m.subscribeTimeframes([]string{"15m"}); err != nil {
+			t.Errorf("加载中的周期应直接返回: %v", err)
+		}
+		w.Write([]byte(`[[0,"1","1","1","1","1",899999,"1",1,"1","1"]]`))
+	}))
+	defer server.Close()
+
+	m = &WSMonitor{
+		combinedClient:       NewCombinedStreamsClient(10),
+		symbols:              []string{"BTCUSDT"},
+		subscribedTimeframes: map[string]bool{},
+		started:              true,
+		apiClient:            newAPIClientWithBaseURL(server.URL),
+	}
+
+	done := make(chan struct{})
+	go func() {
+		m.subscribeTimeframes([]string{"15m"}) // 未连接 WebSocket，订阅本身会失败
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("加载历史数据时持有订阅锁导致死锁")
+	}
+
+	if got := requests.Load(); got != 1 {
+		t.Errorf("历史数据请求 %d 次, 期望 1", got)
+	}
+	if _, ok := m.getKlineDataMap("15m").Load("BTCUSDT"); !ok {
+		t.Error("应加载新增周期的历史数据")
+	}
+	if m.pendingTimeframes["15m"] {
+		t.Error("结束后应清除加载中状态")
+	}
+}
@@ -0,0 +1,245 @@
+package market
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 可在 market.Format 中选择输出的指标
+const (
+	IndicatorEMA    = "ema"
+	IndicatorMACD   = "macd"
+	IndicatorRSI    = "rsi"
+	IndicatorATR    = "atr"
+	IndicatorVolume = "volume"
+
+	// 扩展指标（需在交易员配置中显式选择）
+	IndicatorBollinger  = "bollinger"
+	IndicatorVWAP       = "vwap"
+	IndicatorStochRSI   = "stoch_rsi"
+	IndicatorADX        = "adx"
+	IndicatorSupertrend = "supertrend"
+	IndicatorIchimoku   = "ichimoku"
+	IndicatorOBV        = "obv"
+	IndicatorDonchian   = "donchian"
+)
+
+// DefaultIndicators 未配置指标时输出的基础指标
+var DefaultIndicators = []string{IndicatorEMA, IndicatorMACD, IndicatorRSI, IndicatorATR, IndicatorVolume}
+
+// AllIndicators 全部可选指标
+var AllIndicators = append(append([]string(nil), DefaultIndicators...),
+	IndicatorBollinger, IndicatorVWAP, IndicatorStochRSI, IndicatorADX,
+	IndicatorSupertrend, IndicatorIchimoku, IndicatorOBV, IndicatorDonchian)
+
+// timeframeDurations 币安支持的K线周期
+var timeframeDurations = map[string]time.Duration{
+	"1m":  time.Minute,
+	"3m":  3 * time.Minute,
+	"5m":  5 * time.Minute,
+	"15m": 15 * time.Minute,
+	"30m": 30 * time.Minute,
+	"1h":  time.Hour,
+	"2h":  2 * time.Hour,
+	"4h":  4 * time.Hour,
+	"6h":  6 * time.Hour,
+	"8h":  8 * time.Hour,
+	"12h": 12 * time.Hour,
+	"1d":  24 * time.Hour,
+}
+
+// DataConfig 市场数据配置（K线周期和输出指标）
+type DataConfig struct {
+	Timeframes []string         // K线周期，最短周期作为日内序列，其余作为长周期概览
+	Indicators []string         // market.Format 输出的指标，空值为基础指标
+	Source     MarketDataSource // 行情数据源，nil 使用币安
+}
+
+var (
+	defaultTimeframes      = []string{"3m", "4h"}
+	defaultTimeframesMutex sync.RWMutex
+)
+
+// DefaultTimeframes 系统默认K线周期
+func DefaultTimeframes() []string {
+	defaultTimeframesMutex.RLock()
+	defer defaultTimeframesMutex.RUnlock()
+	return append([]string(nil), defaultTimeframes...)
+}
+
+// SetDefaultTimeframes 设置系统默认K线周期（来自配置 data_k_line_time）
+func SetDefaultTimeframes(timeframes []string) {
+	if len(timeframes) == 0 {
+		return
+	}
+	defaultTimeframesMutex.Lock()
+	defer defaultTimeframesMutex.Unlock()
+	defaultTimeframes = SortTimeframes(timeframes)
+}
+
+// TimeframeDuration 返回K线周期对应的时长
+func TimeframeDuration(timeframe string) (time.Duration, bool) {
+	d, ok := timeframeDurations[timeframe]
+	return d, ok
+}
+
+// SortTimeframes 去重并按周期从短到长排序
+func SortTimeframes(timeframes []string) []string {
+	seen := make(map[string]bool, len(timeframes))
+	result := make([]string, 0, len(timeframes))
+	for _, tf := range timeframes {
+		if seen[tf] {
+			continue
+		}
+		seen[tf] = true
+		result = append(result, tf)
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return timeframeDurations[result[i]] < timeframeDurations[result[j]]
+	})
+	return result
+}
+
+// ParseTimeframes 解析逗号分隔的K线周期（如 "1m,15m,1h"），空字符串返回nil
+func ParseTimeframes(s string) ([]string, error) {
+	var timeframes []string
+	for _, tf := range strings.Split(s, ",") {
+		tf = strings.TrimSpace(tf)
+		if tf == "" {
+			continue
+		}
+		if _, ok := timeframeDurations[tf]; !ok {
+			return nil, fmt.Errorf("不支持的K线周期: %s", tf)
+		}
+		timeframes = append(timeframes, tf)
+	}
+	if len(timeframes) == 0 {
+		return nil, nil
+	}
+	return SortTimeframes(timeframes), nil
+}
+
+// ParseIndicators 解析逗号分隔的指标列表（如 "ema,rsi,bollinger"），空字符串返回nil（基础指标）
+func ParseIndicators(s string) ([]string, error) {
+	var indicators []string
+	seen := make(map[string]bool)
+	for _, ind := range strings.Split(s, ",") {
+		ind = strings.ToLower(strings.TrimSpace(ind))
+		if ind == "" || seen[ind] {
+			continue
+		}
+		if !isKnownIndicator(ind) {
+			return nil, fmt.Errorf("不支持的指标: %s（可选值: %s）", ind, strings.Join(AllIndicators, ", "))
+		}
+		seen[ind] = true
+		indicators = append(indicators, ind)
+	}
+	return indicators, nil
+}
+
+func isKnownIndicator(indicator string) bool {
+	return containsString(AllIndicators, indicator)
+}
+
+func containsString(values []string, target string) bool {
+	for _, v := range values {
+		if v == target {
+			return true
+		}
+	}
+	return false
+}
+
+// NewDataConfig 根据配置字符串创建市场数据配置（空值使用系统默认）
+func NewDataConfig(timeframes, indicators string) (*DataConfig, error) {
+	tfs, err := ParseTimeframes(timeframes)
+	if err != nil {
+		return nil, err
+	}
+	inds, err := ParseIndicators(indicators)
+	if err != nil {
+		return nil, err
+	}
+	return &DataConfig{Timeframes: tfs, Indicators: inds}, nil
+}
+
+// EffectiveTimeframes 返回生效的K线周期（未配置时使用系统默认）
+func (c *DataConfig) EffectiveTimeframes() []string {
+	if c == nil || len(c.Timeframes) == 0 {
+		return DefaultTimeframes()
+	}
+	return SortTimeframes(c.Timeframes)
+}
+
+// DataSource 返回行情数据源（未配置时使用币安）
+func (c *DataConfig) DataSource() MarketDataSource {
+	if c == nil || c.Source == nil {
+		return BinanceSource{}
+	}
+	return c.Source
+}
+
+// timeframeRegistry 记录运行中交易员请求的K线周期，WSMonitor 订阅其并集
+var timeframeRegistry = struct {
+	sync.Mutex
+	byOwner map[string][]string
+}{byOwner: make(map[string][]string)}
+
+// RegisterTimeframes 登记交易员需要的K线周期，新增周期会立即订阅
+func RegisterTimeframes(owner string, timeframes []string) {
+	if len(timeframes) == 0 {
+		timeframes = DefaultTimeframes()
+	}
+
+	timeframeRegistry.Lock()
+	timeframeRegistry.byOwner[owner] = SortTimeframes(timeframes)
+	timeframeRegistry.Unlock()
+
+	if WSMonitorCli != nil {
+		if err := WSMonitorCli.subscribeTimeframes(ActiveTimeframes()); err != nil {
+			log.Printf("⚠️  订阅K线周期失败: %v", err)
+		}
+	}
+}
+
+// UnregisterTimeframes 注销交易员的K线周期
+// 已订阅的流不会退订（同一连接复用，成本很低），仅影响之后的并集计算
+func UnregisterTimeframes(owner string) {
+	timeframeRegistry.Lock()
+	defer timeframeRegistry.Unlock()
+	delete(timeframeRegistry.byOwner, owner)
+}
+
+// ActiveTimeframes 系统默认周期与所有运行中交易员周期的并集
+func ActiveTimeframes() []string {
+	timeframes := DefaultTimeframes()
+
+	timeframeRegistry.Lock()
+	for _, tfs := range timeframeRegistry.byOwner {
+		timeframes = append(timeframes, tfs...)
+	}
+	timeframeRegistry.Unlock()
+
+	return SortTimeframes(timeframes)
+}
+
+// timeframeLabel 将K线周期转换为提示词中的描述，如 "3m" -> "3‑minute"、"4h" -> "4‑hour"
+func timeframeLabel(timeframe string) string {
+	if len(timeframe) < 2 {
+		return timeframe
+	}
+	n, unit := timeframe[:len(timeframe)-1], timeframe[len(timeframe)-1:]
+	switch unit {
+	case "m":
+		return n + "‑minute"
+	case "h":
+		return n + "‑hour"
+	case "d":
+		return n + "‑day"
+	}
+	return timeframe
+}
@@ -0,0 +1,135 @@
+package market
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestParseTimeframes 测试K线周期解析（去重并按周期排序）
+func TestParseTimeframes(t *testing.T) {
+	tfs, err := ParseTimeframes(" 1h, 1m ,15m,1m")
+	if err != nil {
+		t.Fatalf("解析失败: %v", err)
+	}
+	if !reflect.DeepEqual(tfs, []string{"1m", "15m", "1h"}) {
+		t.Errorf("ParseTimeframes = %v, 期望 [1m 15m 1h]", tfs)
+	}
+
+	if tfs, err := ParseTimeframes(""); err != nil || tfs != nil {
+		t.Errorf("空字符串应返回nil, 实际 %v, %v", tfs, err)
+	}
+	if _, err := ParseTimeframes("3m,7m"); err == nil {
+		t.Error("不支持的周期应返回错误")
+	}
+	if _, err := ParseIndicators("ema,foo"); err == nil {
+		t.Error("不支持的指标应返回错误")
+	}
+}
+
+// TestActiveTimeframes 测试运行中交易员K线周期的并集
+func TestActiveTimeframes(t *testing.T) {
+	RegisterTimeframes("trader-a", []string{"1m", "15m"})
+	RegisterTimeframes("trader-b", []string{"15m", "1d"})
+	defer UnregisterTimeframes("trader-a")
+	defer UnregisterTimeframes("trader-b")
+
+	if got := ActiveTimeframes(); !reflect.DeepEqual(got, []string{"1m", "3m", "15m", "4h", "1d"}) {
+		t.Errorf("ActiveTimeframes = %v", got)
+	}
+
+	UnregisterTimeframes("trader-b")
+	if got := ActiveTimeframes(); !reflect.DeepEqual(got, []string{"1m", "3m", "15m", "4h"}) {
+		t.Errorf("注销后 ActiveTimeframes = %v", got)
+	}
+}
+
+// TestCalculatePriceChange 测试按周期计算价格变化（优先使用能整除的最长周期）
+func TestCalculatePriceChange(t *testing.T) {
+	klines3m := generateTestKlines(100)
+	klines4h := generateTestKlines(10)
+	klines4h[len(klines4h)-2].Close = 50
+	byTF := map[string][]Kline{"3m": klines3m, "4h": klines4h}
+	tfs := []string{"3m", "4h"}
+	current := klines3m[len(klines3m)-1].Close
+
+	// 1小时变化 = 20根3分钟K线前
+	expected1h := (current - klines3m[len(klines3m)-21].Close) / klines3m[len(klines3m)-21].Close * 100
+	if got := calculatePriceChange(byTF, tfs, current, time.Hour); math.Abs(got-expected1h) > 1e-9 {
+		t.Errorf("1h变化 = %.4f, 期望 %.4f", got, expected1h)
+	}
+
+	// 4小时变化 = 上一根4小时K线
+	expected4h := (current - 50) / 50 * 100
+	if got := calculatePriceChange(byTF, tfs, current, 4*time.Hour); math.Abs(got-expected4h) > 1e-9 {
+		t.Errorf("4h变化 = %.4f, 期望 %.4f", got, expected4h)
+	}
+
+	// 没有可用周期时返回0
+	if got := calculatePriceChange(map[string][]Kline{"1d": klines4h}, []string{"1d"}, current, time.Hour); got != 0 {
+		t.Errorf("无可用周期时应返回0, 实际 %.4f", got)
+	}
+}
+
+// TestFormat_Timeframes 测试按周期和指标配置输出市场数据
+func TestFormat_Timeframes(t *testing.T) {
+	klines := generateTestKlines(60)
+	data := &Data{
+		Symbol:       "BTCUSDT",
+		CurrentPrice: 100,
+		Timeframes: map[string]*TimeframeData{
+			"1h":  {Timeframe: "1h", Series: calculateIntradaySeries(klines), Context: calculateLongerTermData(klines)},
+			"15m": {Timeframe: "15m", Series: calculateIntradaySeries(klines), Context: calculateLongerTermData(klines)},
+			"1d":  {Timeframe: "1d", Series: calculateIntradaySeries(klines), Context: calculateLongerTermData(klines)},
+		},
+		Indicators: []string{IndicatorRSI},
+	}
+
+	output := Format(data)
+	for _, want := range []string{
+		"Intraday series (15‑minute intervals",
+		"Longer‑term context (1‑hour timeframe)",
+		"Longer‑term context (1‑day timeframe)",
+		"RSI indicators (7‑Period)",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("输出缺少 %q", want)
+		}
+	}
+	if strings.Index(output, "1‑hour") > strings.Index(output, "1‑day") {
+		t.Error("长周期应按周期从短到长输出")
+	}
+	for _, unwanted := range []string{"EMA indicators", "MACD indicators", "Volume", "ATR"} {
+		if strings.Contains(output, unwanted) {
+			t.Errorf("未选择的指标不应输出: %q", unwanted)
+		}
+	}
+}
+
+// TestFormat_DefaultTimeframesUnchanged 测试默认 3m/4h 周期的输出与旧格式一致
+func TestFormat_DefaultTimeframesUnchanged(t *testing.T) {
+	klines := generateTestKlines(60)
+	legacy := &Data{
+		Symbol:            "BTCUSDT",
+		CurrentPrice:      100,
+		IntradaySeries:    calculateIntradaySeries(klines),
+		LongerTermContext: calculateLongerTermData(klines),
+	}
+	withTimeframes := *legacy
+	withTimeframes.Timeframes = map[string]*TimeframeData{
+		"3m": {Timeframe: "3m", Series: legacy.IntradaySeries},
+		"4h": {Timeframe: "4h", Context: legacy.LongerTermContext},
+	}
+
+	output := Format(&withTimeframes)
+	if output != Format(legacy) {
+		t.Error("默认周期输出应与未携带周期数据时一致")
+	}
+	for _, want := range []string{"Intraday series (3‑minute intervals", "3m ATR (14‑period)", "Longer‑term context (4‑hour timeframe)"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("输出缺少 %q", want)
+		}
+	}
+}
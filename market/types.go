@@ -13,8 +13,24 @@ type Data struct {
 	CurrentRSI7       float64
 	OpenInterest      *OIData
 	FundingRate       float64
-	IntradaySeries    *IntradayData
-	LongerTermContext *LongerTermData
+	Liquidity         *LiquidityData            // 订单簿流动性指标（获取失败时为nil）
+	Sentiment         *SentimentData            // 强平、多空比、主动买卖量等情绪数据
+	IntradaySeries    *IntradayData             // 最短周期的日内序列
+	LongerTermContext *LongerTermData           // 最长周期的长期数据
+	Timeframes        map[string]*TimeframeData // K线周期 -> 序列数据
+	Indicators        []string                  // Format 输出的指标（空值为基础指标）
+	Regime            *RegimeData               // 最长周期的市场状态（数据不足时为nil）
+
+	trendTimeframe string  // 最长周期（用于计算相关性）
+	trendKlines    []Kline // 最长周期K线（用于计算相关性）
+}
+
+// TimeframeData 单个K线周期的序列数据
+type TimeframeData struct {
+	Timeframe  string
+	Series     *IntradayData   // 逐根K线的指标序列
+	Context    *LongerTermData // 周期概览（EMA/ATR/成交量对比）
+	Indicators *IndicatorData  // 扩展技术指标（未选择时为nil）
 }
 
 // OIData Open Interest数据
@@ -23,7 +39,7 @@ type OIData struct {
 	Average float64
 }
 
-// IntradayData 日内数据(3分钟间隔)
+// IntradayData 日内数据(默认3分钟间隔)
 type IntradayData struct {
 	MidPrices   []float64
 	EMA20Values []float64
@@ -34,7 +50,7 @@ type IntradayData struct {
 	ATR14       float64
 }
 
-// LongerTermData 长期数据(4小时时间框架)
+// LongerTermData 长期数据(默认4小时时间框架)
 type LongerTermData struct {
 	EMA20         float64
 	EMA50         float64
@@ -14,6 +14,7 @@ type WSClient struct {
 	conn        *websocket.Conn
 	mu          sync.RWMutex
 	subscribers map[string]chan []byte
+	subscribed  map[string]bool // 已订阅的流（重连后重新订阅）
 	reconnect   bool
 	done        chan struct{}
 }
@@ -71,6 +72,7 @@ type TickerWSData struct {
 func NewWSClient() *WSClient {
 	return &WSClient{
 		subscribers: make(map[string]chan []byte),
+		subscribed:  make(map[string]bool),
 		reconnect:   true,
 		done:        make(chan struct{}),
 	}
@@ -88,6 +90,10 @@ func (w *WSClient) Connect() error {
 
 	w.mu.Lock()
 	w.conn = conn
+	streams := make([]string, 0, len(w.subscribed))
+	for stream := range w.subscribed {
+		streams = append(streams, stream)
+	}
 	w.mu.Unlock()
 
 	log.Println("WebSocket连接成功")
@@ -95,6 +101,13 @@ func (w *WSClient) Connect() error {
 	// 启动消息读取循环
 	go w.readMessages()
 
+	// 重连后重新订阅之前的流
+	for _, stream := range streams {
+		if err := w.subscribe(stream); err != nil {
+			log.Printf("⚠️  重连后重新订阅 %s 失败: %v", stream, err)
+		}
+	}
+
 	return nil
 }
 
@@ -120,9 +133,10 @@ func (w *WSClient) subscribe(stream string) error {
 		"id":     time.Now().Unix(),
 	}
 
-	w.mu.RLock()
-	defer w.mu.RUnlock()
+	w.mu.Lock()
+	defer w.mu.Unlock()
 
+	w.subscribed[stream] = true
 	if w.conn == nil {
 		return fmt.Errorf("WebSocket未连接")
 	}
@@ -189,7 +203,7 @@ func (w *WSClient) handleReconnect() {
 	}
 
 	log.Println("尝试重新连接...")
-	time.Sleep(3 * time.Second)
+	time.Sleep(reconnectDelay)
 
 	if err := w.Connect(); err != nil {
 		log.Printf("重新连接失败: %v", err)
@@ -3,6 +3,7 @@ package mcp
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -10,6 +11,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
@@ -22,6 +24,16 @@ const (
 	ProviderCustom   Provider = "custom"
 )
 
+// StructuredMode 结构化输出方式
+type StructuredMode string
+
+const (
+	StructuredAuto       StructuredMode = "auto"        // 按Provider选择（DeepSeek/Qwen 使用工具调用，自定义API关闭）
+	StructuredTools      StructuredMode = "tools"       // 工具调用（function calling），参数即结构化结果
+	StructuredJSONSchema StructuredMode = "json_schema" // response_format: json_schema（OpenAI兼容）
+	StructuredOff        StructuredMode = "off"         // 不使用结构化输出，只依赖 prompt 和文本解析
+)
+
 // Client AI API配置
 type Client struct {
 	Provider   Provider
@@ -31,6 +43,57 @@ type Client struct {
 	Timeout    time.Duration
 	UseFullURL bool // 是否使用完整URL（不添加/chat/completions）
 	MaxTokens  int  // AI响应的最大token数
+
+	StructuredOutput      StructuredMode // 结构化输出方式（默认 auto）
+	structuredUnsupported *atomic.Bool   // API明确拒绝过结构化输出参数，之后不再发送（多个goroutine共享）
+
+	usage *usageMeter // 上次 TakeUsage 以来累计的token用量和费用
+}
+
+// ErrToolsUnsupported API不支持工具调用（或已通过 AI_STRUCTURED_OUTPUT=off 关闭）
+var ErrToolsUnsupported = errors.New("API不支持工具调用")
+
+// Message 对话消息
+type Message struct {
+	Role       string     `json:"role"` // system/user/assistant/tool
+	Content    string     `json:"content"`
+	ToolCalls  []ToolCall `json:"tool_calls,omitempty"`   // assistant 消息中AI请求调用的工具
+	ToolCallID string     `json:"tool_call_id,omitempty"` // tool 消息对应的工具调用ID
+}
+
+// ToolCall AI请求的一次工具调用
+type ToolCall struct {
+	ID       string       `json:"id"`
+	Type     string       `json:"type"` // 固定为 function
+	Function ToolFunction `json:"function"`
+}
+
+// ToolFunction 工具调用的函数名和参数
+type ToolFunction struct {
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"` // JSON字符串
+}
+
+// Tool 可供AI调用的工具
+type Tool struct {
+	Name        string                 // 函数名
+	Description string                 // 函数描述
+	Parameters  map[string]interface{} // 参数的 JSON Schema
+}
+
+// ResponseSchema 要求AI按JSON Schema输出的结构化结果（顶层必须是 object）
+type ResponseSchema struct {
+	Name        string                 // 函数名/Schema名称
+	Description string                 // 说明（工具调用时作为函数描述）
+	Schema      map[string]interface{} // JSON Schema
+}
+
+// Response AI响应
+type Response struct {
+	Content    string     // 文本内容
+	Structured string     // 按 ResponseSchema 输出的JSON（未使用结构化输出或模型未遵循时为空）
+	ToolCalls  []ToolCall // AI请求调用的其他工具（仅 CallWithTools）
+	Usage      Usage      // 本次调用的token用量和费用（API未返回 usage 时为0）
 }
 
 func New() *Client {
@@ -45,13 +108,28 @@ func New() *Client {
 		}
 	}
 
+	// 从环境变量读取结构化输出方式，默认 auto
+	structured := StructuredAuto
+	if envStructured := os.Getenv("AI_STRUCTURED_OUTPUT"); envStructured != "" {
+		switch mode := StructuredMode(strings.ToLower(envStructured)); mode {
+		case StructuredAuto, StructuredTools, StructuredJSONSchema, StructuredOff:
+			structured = mode
+			log.Printf("🔧 [MCP] 使用环境变量 AI_STRUCTURED_OUTPUT: %s", structured)
+		default:
+			log.Printf("⚠️  [MCP] 环境变量 AI_STRUCTURED_OUTPUT 无效 (%s)，使用默认值: %s", envStructured, structured)
+		}
+	}
+
 	// 默认配置
 	return &Client{
-		Provider:  ProviderDeepSeek,
-		BaseURL:   "https://api.deepseek.com/v1",
-		Model:     "deepseek-chat",
-		Timeout:   120 * time.Second, // 增加到120秒，因为AI需要分析大量数据
-		MaxTokens: maxTokens,
+		Provider:              ProviderDeepSeek,
+		BaseURL:               "https://api.deepseek.com/v1",
+		Model:                 "deepseek-chat",
+		Timeout:               120 * time.Second, // 增加到120秒，因为AI需要分析大量数据
+		MaxTokens:             maxTokens,
+		StructuredOutput:      structured,
+		structuredUnsupported: &atomic.Bool{},
+		usage:                 &usageMeter{},
 	}
 }
 
@@ -133,8 +211,106 @@ func (client *Client) SetClient(Client Client) {
 
 // CallWithMessages 使用 system + user prompt 调用AI API（推荐）
 func (client *Client) CallWithMessages(systemPrompt, userPrompt string) (string, error) {
+	resp, err := client.CallWithConversation(buildMessages(systemPrompt, userPrompt), nil)
+	if err != nil {
+		return "", err
+	}
+	return resp.Content, nil
+}
+
+// CallWithConversation 使用完整对话调用AI API，schema 不为空时要求结构化输出
+// API 拒绝结构化输出参数时（如模型不支持工具调用）自动降级为普通调用，调用方需回退到文本解析
+func (client *Client) CallWithConversation(messages []Message, schema *ResponseSchema) (*Response, error) {
+	mode := client.structuredMode()
+	if schema == nil || mode == StructuredOff {
+		return client.callWithRetry(messages, nil, StructuredOff, nil)
+	}
+
+	resp, err := client.callWithRetry(messages, schema, mode, nil)
+	switch {
+	case err == nil:
+		return resp, nil
+	case isSchemaRejectedError(err):
+		log.Printf("⚠️  [MCP] API 不支持结构化输出 (%s)，降级为普通调用: %v", mode, err)
+		client.markStructuredUnsupported()
+		return client.callWithRetry(messages, nil, StructuredOff, nil)
+	case isBadRequestError(err):
+		// 其他请求错误（如上下文过长、参数错误）不代表不支持结构化输出：本次不带 Schema 重试一次
+		log.Printf("⚠️  [MCP] 结构化输出请求失败，本次不带Schema重试: %v", err)
+		return client.callWithRetry(messages, nil, StructuredOff, nil)
+	}
+	return resp, err
+}
+
+// CallWithTools 提供工具让AI自主调用，final 为提交最终结果的工具
+// AI调用 final 时结果在 Response.Structured 中，调用其他工具时在 Response.ToolCalls 中；tools 为空时强制调用 final
+// 工具调用不可用时返回 ErrToolsUnsupported，调用方需回退到普通调用
+func (client *Client) CallWithTools(messages []Message, tools []Tool, final *ResponseSchema) (*Response, error) {
+	if client.isStructuredUnsupported() || client.StructuredOutput == StructuredOff {
+		return nil, ErrToolsUnsupported
+	}
+
+	resp, err := client.callWithRetry(messages, final, StructuredTools, tools)
+	switch {
+	case err == nil:
+		return resp, nil
+	case isSchemaRejectedError(err):
+		log.Printf("⚠️  [MCP] API 不支持工具调用: %v", err)
+		client.markStructuredUnsupported()
+		return nil, fmt.Errorf("%w: %v", ErrToolsUnsupported, err)
+	case isBadRequestError(err):
+		// 其他请求错误只让本次回退到普通调用，不影响之后的周期
+		log.Printf("⚠️  [MCP] 工具调用请求失败，本次回退为普通调用: %v", err)
+		return nil, fmt.Errorf("%w: %v", ErrToolsUnsupported, err)
+	}
+	return resp, err
+}
+
+// isStructuredUnsupported API是否明确拒绝过结构化输出参数
+func (client *Client) isStructuredUnsupported() bool {
+	return client.structuredUnsupported != nil && client.structuredUnsupported.Load()
+}
+
+// markStructuredUnsupported 记录API不支持结构化输出（之后的调用不再发送相关参数）
+func (client *Client) markStructuredUnsupported() {
+	if client.structuredUnsupported != nil {
+		client.structuredUnsupported.Store(true)
+	}
+}
+
+// structuredMode 返回实际使用的结构化输出方式
+func (client *Client) structuredMode() StructuredMode {
+	if client.isStructuredUnsupported() {
+		return StructuredOff
+	}
+	switch client.StructuredOutput {
+	case StructuredTools, StructuredJSONSchema, StructuredOff:
+		return client.StructuredOutput
+	}
+	// auto：DeepSeek/Qwen 支持工具调用；自定义API能力未知，不发送额外参数
+	if client.Provider == ProviderDeepSeek || client.Provider == ProviderQwen {
+		return StructuredTools
+	}
+	return StructuredOff
+}
+
+// buildMessages 构建 system + user 对话
+func buildMessages(systemPrompt, userPrompt string) []Message {
+	messages := []Message{}
+
+	// 如果有 system prompt，添加 system message
+	if systemPrompt != "" {
+		messages = append(messages, Message{Role: "system", Content: systemPrompt})
+	}
+
+	// 添加 user message
+	return append(messages, Message{Role: "user", Content: userPrompt})
+}
+
+// callWithRetry 调用AI API，网络类错误自动重试
+func (client *Client) callWithRetry(messages []Message, schema *ResponseSchema, mode StructuredMode, tools []Tool) (*Response, error) {
 	if client.APIKey == "" {
-		return "", fmt.Errorf("AI API密钥未设置，请先调用 SetDeepSeekAPIKey() 或 SetQwenAPIKey()")
+		return nil, fmt.Errorf("AI API密钥未设置，请先调用 SetDeepSeekAPIKey() 或 SetQwenAPIKey()")
 	}
 
 	// 重试配置
@@ -146,7 +322,7 @@ func (client *Client) CallWithMessages(systemPrompt, userPrompt string) (string,
 			fmt.Printf("⚠️  AI API调用失败，正在重试 (%d/%d)...\n", attempt, maxRetries)
 		}
 
-		result, err := client.callOnce(systemPrompt, userPrompt)
+		result, err := client.callOnce(messages, schema, mode, tools)
 		if err == nil {
 			if attempt > 1 {
 				fmt.Printf("✓ AI API重试成功\n")
@@ -157,7 +333,7 @@ func (client *Client) CallWithMessages(systemPrompt, userPrompt string) (string,
 		lastErr = err
 		// 如果不是网络错误，不重试
 		if !isRetryableError(err) {
-			return "", err
+			return nil, err
 		}
 
 		// 重试前等待
@@ -168,11 +344,11 @@ func (client *Client) CallWithMessages(systemPrompt, userPrompt string) (string,
 		}
 	}
 
-	return "", fmt.Errorf("重试%d次后仍然失败: %w", maxRetries, lastErr)
+	return nil, fmt.Errorf("重试%d次后仍然失败: %w", maxRetries, lastErr)
 }
 
-// callOnce 单次调用AI API（内部使用）
-func (client *Client) callOnce(systemPrompt, userPrompt string) (string, error) {
+// callOnce 单次调用AI API（内部使用），tools 为 schema 之外可供AI自主选择的工具
+func (client *Client) callOnce(messages []Message, schema *ResponseSchema, mode StructuredMode, tools []Tool) (*Response, error) {
 	// 打印当前 AI 配置
 	log.Printf("📡 [MCP] AI 请求配置:")
 	log.Printf("   Provider: %s", client.Provider)
@@ -183,23 +359,6 @@ func (client *Client) callOnce(systemPrompt, userPrompt string) (string, error)
 		log.Printf("   API Key: %s...%s", client.APIKey[:4], client.APIKey[len(client.APIKey)-4:])
 	}
 
-	// 构建 messages 数组
-	messages := []map[string]string{}
-
-	// 如果有 system prompt，添加 system message
-	if systemPrompt != "" {
-		messages = append(messages, map[string]string{
-			"role":    "system",
-			"content": systemPrompt,
-		})
-	}
-
-	// 添加 user message
-	messages = append(messages, map[string]string{
-		"role":    "user",
-		"content": userPrompt,
-	})
-
 	// 构建请求体
 	requestBody := map[string]interface{}{
 		"model":       client.Model,
@@ -208,12 +367,40 @@ func (client *Client) callOnce(systemPrompt, userPrompt string) (string, error)
 		"max_tokens":  client.MaxTokens,
 	}
 
-	// 注意：response_format 参数仅 OpenAI 支持，DeepSeek/Qwen 不支持
-	// 我们通过强化 prompt 和后处理来确保 JSON 格式正确
+	// 结构化输出：response_format 仅 OpenAI 兼容API支持，DeepSeek/Qwen 使用工具调用
+	// 未使用结构化输出时，通过强化 prompt 和后处理来确保 JSON 格式正确
+	if schema != nil {
+		switch mode {
+		case StructuredTools:
+			log.Printf("   Structured: tools (%s, %d个可选工具)", schema.Name, len(tools))
+			definitions := []map[string]interface{}{toolDefinition(schema.Name, schema.Description, schema.Schema)}
+			for _, tool := range tools {
+				definitions = append(definitions, toolDefinition(tool.Name, tool.Description, tool.Parameters))
+			}
+			requestBody["tools"] = definitions
+			if len(tools) == 0 {
+				requestBody["tool_choice"] = map[string]interface{}{
+					"type":     "function",
+					"function": map[string]string{"name": schema.Name},
+				}
+			} else {
+				requestBody["tool_choice"] = "auto"
+			}
+		case StructuredJSONSchema:
+			log.Printf("   Structured: json_schema (%s)", schema.Name)
+			requestBody["response_format"] = map[string]interface{}{
+				"type": "json_schema",
+				"json_schema": map[string]interface{}{
+					"name":   schema.Name,
+					"schema": schema.Schema,
+				},
+			}
+		}
+	}
 
 	jsonData, err := json.Marshal(requestBody)
 	if err != nil {
-		return "", fmt.Errorf("序列化请求失败: %w", err)
+		return nil, fmt.Errorf("序列化请求失败: %w", err)
 	}
 
 	// 创建HTTP请求
@@ -229,7 +416,7 @@ func (client *Client) callOnce(systemPrompt, userPrompt string) (string, error)
 
 	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
 	if err != nil {
-		return "", fmt.Errorf("创建请求失败: %w", err)
+		return nil, fmt.Errorf("创建请求失败: %w", err)
 	}
 
 	req.Header.Set("Content-Type", "application/json")
@@ -250,38 +437,85 @@ func (client *Client) callOnce(systemPrompt, userPrompt string) (string, error)
 	httpClient := &http.Client{Timeout: client.Timeout}
 	resp, err := httpClient.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("发送请求失败: %w", err)
+		return nil, fmt.Errorf("发送请求失败: %w", err)
 	}
 	defer resp.Body.Close()
 
 	// 读取响应
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return "", fmt.Errorf("读取响应失败: %w", err)
+		return nil, fmt.Errorf("读取响应失败: %w", err)
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("API返回错误 (status %d): %s", resp.StatusCode, string(body))
+		return nil, fmt.Errorf("API返回错误 (status %d): %s", resp.StatusCode, string(body))
 	}
 
 	// 解析响应
 	var result struct {
 		Choices []struct {
 			Message struct {
-				Content string `json:"content"`
+				Content   string     `json:"content"`
+				ToolCalls []ToolCall `json:"tool_calls"`
 			} `json:"message"`
 		} `json:"choices"`
+		Usage struct {
+			PromptTokens     int `json:"prompt_tokens"`
+			CompletionTokens int `json:"completion_tokens"`
+		} `json:"usage"`
 	}
 
 	if err := json.Unmarshal(body, &result); err != nil {
-		return "", fmt.Errorf("解析响应失败: %w", err)
+		return nil, fmt.Errorf("解析响应失败: %w", err)
 	}
 
 	if len(result.Choices) == 0 {
-		return "", fmt.Errorf("API返回空响应")
+		return nil, fmt.Errorf("API返回空响应")
 	}
 
-	return result.Choices[0].Message.Content, nil
+	// 记录token用量和费用（失败的调用不计费）
+	usage := Usage{
+		Calls:            1,
+		PromptTokens:     result.Usage.PromptTokens,
+		CompletionTokens: result.Usage.CompletionTokens,
+		CostUSD:          CostFor(client.Model, result.Usage.PromptTokens, result.Usage.CompletionTokens),
+	}
+	client.recordUsage(usage)
+	log.Printf("📊 [MCP] Token用量: 输入 %d，输出 %d，费用 $%.5f", usage.PromptTokens, usage.CompletionTokens, usage.CostUSD)
+
+	message := result.Choices[0].Message
+	response := &Response{Content: message.Content, Usage: usage}
+	if schema != nil {
+		switch mode {
+		case StructuredTools:
+			for _, call := range message.ToolCalls {
+				if call.Function.Name == schema.Name {
+					if response.Structured == "" {
+						response.Structured = call.Function.Arguments
+					}
+					continue
+				}
+				if len(tools) > 0 {
+					response.ToolCalls = append(response.ToolCalls, call)
+				}
+			}
+		case StructuredJSONSchema:
+			response.Structured = message.Content
+		}
+	}
+	return response, nil
+}
+
+// toolDefinition 构建 tools 参数中的函数定义
+func toolDefinition(name, description string, parameters map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"type": "function",
+		"function": map[string]interface{}{
+			"name":        name,
+			"description": description,
+			"parameters":  parameters,
+		},
+	}
 }
 
 // isRetryableError 判断错误是否可重试
@@ -305,3 +539,27 @@ func isRetryableError(err error) bool {
 	}
 	return false
 }
+
+// schemaRejectionKeywords API拒绝结构化输出参数时错误信息中出现的参数名
+var schemaRejectionKeywords = []string{"tool", "function", "response_format", "json_schema", "schema"}
+
+// isBadRequestError 判断是否为请求参数错误（400/422）
+func isBadRequestError(err error) bool {
+	errStr := err.Error()
+	return strings.Contains(errStr, "status 400") || strings.Contains(errStr, "status 422")
+}
+
+// isSchemaRejectedError 判断是否为API拒绝结构化输出参数（tools/tool_choice/response_format）的错误
+// 其他请求错误（上下文过长、参数取值错误等）不算，避免一次无关的错误永久关闭结构化输出
+func isSchemaRejectedError(err error) bool {
+	if !isBadRequestError(err) {
+		return false
+	}
+	errStr := strings.ToLower(err.Error())
+	for _, keyword := range schemaRejectionKeywords {
+		if strings.Contains(errStr, keyword) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,231 @@
+package mcp
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestCallWithConversation_ToolsAndFallback 工具调用返回结构化参数；API拒绝工具参数时降级为普通调用
+func TestCallWithConversation_ToolsAndFallback(t *testing.T) {
+	rejectTools := false
+	var lastRequest map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lastRequest = nil
+		_ = json.NewDecoder(r.Body).Decode(&lastRequest)
+		if _, hasTools := lastRequest["tools"]; hasTools {
+			if rejectTools {
+				http.Error(w, `{"error":"tools not supported"}`, http.StatusBadRequest)
+				return
+			}
+			w.Write([]byte(`{"choices":[{"message":{"content":"分析","tool_calls":[{"function":{"name":"submit","arguments":"{\"ok\":true}"}}]}}]}`))
+			return
+		}
+		w.Write([]byte(`{"choices":[{"message":{"content":"纯文本"}}]}`))
+	}))
+	defer server.Close()
+
+	client := New()
+	client.SetCustomAPI(server.URL, "test-key", "test-model")
+	client.StructuredOutput = StructuredTools
+	schema := &ResponseSchema{Name: "submit", Schema: map[string]interface{}{"type": "object"}}
+	messages := []Message{{Role: "user", Content: "hi"}}
+
+	resp, err := client.CallWithConversation(messages, schema)
+	if err != nil {
+		t.Fatalf("调用失败: %v", err)
+	}
+	if resp.Content != "分析" || resp.Structured != `{"ok":true}` {
+		t.Errorf("工具调用结果不正确: %+v", resp)
+	}
+	if choice, ok := lastRequest["tool_choice"].(map[string]interface{}); !ok || choice["type"] != "function" {
+		t.Errorf("应强制调用工具: %v", lastRequest["tool_choice"])
+	}
+
+	rejectTools = true
+	resp, err = client.CallWithConversation(messages, schema)
+	if err != nil {
+		t.Fatalf("降级调用失败: %v", err)
+	}
+	if resp.Content != "纯文本" || resp.Structured != "" {
+		t.Errorf("降级后应返回纯文本: %+v", resp)
+	}
+	if client.structuredMode() != StructuredOff {
+		t.Errorf("API拒绝后不应再发送结构化参数")
+	}
+}
+
+// TestCallWithConversation_UnrelatedBadRequest 与结构化输出无关的400错误只让本次不带Schema重试，不永久关闭结构化输出
+func TestCallWithConversation_UnrelatedBadRequest(t *testing.T) {
+	failNext := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]interface{}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		if _, hasTools := req["tools"]; hasTools {
+			if failNext {
+				failNext = false
+				http.Error(w, `{"error":"This model's maximum context length is 65536 tokens"}`, http.StatusBadRequest)
+				return
+			}
+			w.Write([]byte(`{"choices":[{"message":{"content":"","tool_calls":[{"function":{"name":"submit","arguments":"{}"}}]}}]}`))
+			return
+		}
+		w.Write([]byte(`{"choices":[{"message":{"content":"纯文本"}}]}`))
+	}))
+	defer server.Close()
+
+	client := New()
+	client.SetCustomAPI(server.URL, "test-key", "test-model")
+	client.StructuredOutput = StructuredTools
+	schema := &ResponseSchema{Name: "submit", Schema: map[string]interface{}{"type": "object"}}
+	messages := []Message{{Role: "user", Content: "hi"}}
+
+	resp, err := client.CallWithConversation(messages, schema)
+	if err != nil || resp.Content != "纯文本" {
+		t.Fatalf("应不带Schema重试一次: %+v, %v", resp, err)
+	}
+	if client.structuredMode() != StructuredTools {
+		t.Fatal("无关的请求错误不应关闭结构化输出")
+	}
+	if resp, err := client.CallWithConversation(messages, schema); err != nil || resp.Structured != "{}" {
+		t.Errorf("之后的调用应继续使用结构化输出: %+v, %v", resp, err)
+	}
+}
+
+// TestCallWithTools AI可自主选择查询工具；tools 为空时强制调用 final
+func TestCallWithTools(t *testing.T) {
+	var lastRequest map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lastRequest = nil
+		_ = json.NewDecoder(r.Body).Decode(&lastRequest)
+		tools, _ := lastRequest["tools"].([]interface{})
+		if len(tools) > 1 {
+			w.Write([]byte(`{"choices":[{"message":{"content":"","tool_calls":[{"id":"call_1","type":"function","function":{"name":"lookup","arguments":"{\"symbol\":\"BTCUSDT\"}"}}]}}]}`))
+			return
+		}
+		w.Write([]byte(`{"choices":[{"message":{"content":"","tool_calls":[{"id":"call_2","type":"function","function":{"name":"submit","arguments":"{\"ok\":true}"}}]}}]}`))
+	}))
+	defer server.Close()
+
+	client := New()
+	client.SetCustomAPI(server.URL, "test-key", "test-model")
+	client.StructuredOutput = StructuredAuto
+	final := &ResponseSchema{Name: "submit", Schema: map[string]interface{}{"type": "object"}}
+	tools := []Tool{{Name: "lookup", Parameters: map[string]interface{}{"type": "object"}}}
+	messages := []Message{{Role: "user", Content: "hi"}}
+
+	resp, err := client.CallWithTools(messages, tools, final)
+	if err != nil {
+		t.Fatalf("调用失败: %v", err)
+	}
+	if len(resp.ToolCalls) != 1 || resp.ToolCalls[0].ID != "call_1" || resp.Structured != "" {
+		t.Errorf("应返回查询工具调用: %+v", resp)
+	}
+	if lastRequest["tool_choice"] != "auto" {
+		t.Errorf("有可选工具时 tool_choice 应为 auto: %v", lastRequest["tool_choice"])
+	}
+
+	messages = append(messages,
+		Message{Role: "assistant", ToolCalls: resp.ToolCalls},
+		Message{Role: "tool", ToolCallID: "call_1", Content: "price 100"},
+	)
+	resp, err = client.CallWithTools(messages, nil, final)
+	if err != nil {
+		t.Fatalf("调用失败: %v", err)
+	}
+	if resp.Structured != `{"ok":true}` || len(resp.ToolCalls) != 0 {
+		t.Errorf("应返回最终结果: %+v", resp)
+	}
+	if choice, ok := lastRequest["tool_choice"].(map[string]interface{}); !ok || choice["type"] != "function" {
+		t.Errorf("没有可选工具时应强制调用 final: %v", lastRequest["tool_choice"])
+	}
+	sent := lastRequest["messages"].([]interface{})
+	if toolMsg := sent[2].(map[string]interface{}); toolMsg["tool_call_id"] != "call_1" {
+		t.Errorf("tool 消息应携带 tool_call_id: %v", toolMsg)
+	}
+
+	client.StructuredOutput = StructuredOff
+	if _, err := client.CallWithTools(messages, tools, final); !errors.Is(err, ErrToolsUnsupported) {
+		t.Errorf("关闭结构化输出时应返回 ErrToolsUnsupported, got %v", err)
+	}
+}
+
+// TestUsageAccounting 记录每次调用的token用量并按模型价格计算费用，TakeUsage 取出后清零
+func TestUsageAccounting(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"choices":[{"message":{"content":"ok"}}],"usage":{"prompt_tokens":1000000,"completion_tokens":500000,"total_tokens":1500000}}`))
+	}))
+	defer server.Close()
+
+	client := New()
+	client.SetCustomAPI(server.URL, "test-key", "deepseek-chat")
+	resp, err := client.CallWithConversation([]Message{{Role: "user", Content: "hi"}}, nil)
+	if err != nil {
+		t.Fatalf("调用失败: %v", err)
+	}
+	if resp.Usage.PromptTokens != 1000000 || resp.Usage.CompletionTokens != 500000 {
+		t.Errorf("应解析 usage: %+v", resp.Usage)
+	}
+	if want := 0.28 + 0.21; math.Abs(resp.Usage.CostUSD-want) > 1e-9 {
+		t.Errorf("费用 = %f, want %f", resp.Usage.CostUSD, want)
+	}
+
+	if _, err := client.CallWithMessages("", "again"); err != nil {
+		t.Fatalf("调用失败: %v", err)
+	}
+	usage := client.TakeUsage()
+	if usage.Calls != 2 || usage.TotalTokens() != 3000000 {
+		t.Errorf("应累计两次调用: %+v", usage)
+	}
+	if client.TakeUsage() != (Usage{}) {
+		t.Errorf("TakeUsage 后应清零")
+	}
+
+	cheap := client.WithModel("qwen-turbo")
+	if cheap.Model != "qwen-turbo" || cheap.BaseURL != client.BaseURL || cheap.APIKey != client.APIKey {
+		t.Errorf("WithModel 应只替换模型: %+v", cheap)
+	}
+}
+
+func TestPriceTable(t *testing.T) {
+	if price, ok := PriceFor("GPT-4o-2024-08-06"); !ok || price.Input != 2.5 {
+		t.Errorf("应按最长前缀匹配 gpt-4o: %+v %v", price, ok)
+	}
+	if price, ok := PriceFor("gpt-4o-mini-2024-07-18"); !ok || price.Input != 0.15 {
+		t.Errorf("应匹配 gpt-4o-mini 而不是 gpt-4o: %+v", price)
+	}
+	if _, ok := PriceFor("unknown-model"); ok {
+		t.Error("未知模型不应有价格")
+	}
+
+	table, err := ParsePriceTable(`{"My-Model": {"input": 1, "output": 2}}`)
+	if err != nil || table["my-model"].Output != 2 {
+		t.Errorf("解析价格表失败: %v %+v", err, table)
+	}
+	if _, err := ParsePriceTable(`{"m": {"input": -1}}`); err == nil {
+		t.Error("负数价格应报错")
+	}
+}
+
+func TestContextWindow(t *testing.T) {
+	if got := ContextWindowFor("deepseek-chat"); got != 128000 {
+		t.Errorf("deepseek-chat 上下文窗口应为128000: %d", got)
+	}
+	if got := ContextWindowFor("GPT-4.1-mini-2025-04-14"); got != 1047576 {
+		t.Errorf("应按最长前缀匹配 gpt-4.1-mini: %d", got)
+	}
+	if got := ContextWindowFor("unknown-model"); got != 0 {
+		t.Errorf("未知模型的上下文窗口应为0（不压缩）: %d", got)
+	}
+
+	windows, err := ParseContextWindows(`{" My-Model ": 65536}`)
+	if err != nil || windows["my-model"] != 65536 {
+		t.Errorf("解析上下文窗口失败: %v %+v", err, windows)
+	}
+	if _, err := ParseContextWindows(`{"m": 0}`); err == nil {
+		t.Error("上下文窗口为0应报错")
+	}
+}
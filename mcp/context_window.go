@@ -0,0 +1,101 @@
+package mcp
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// defaultContextWindows 内置的模型上下文窗口（输入+输出的token上限）
+var defaultContextWindows = map[string]int{
+	"deepseek-chat":     128000,
+	"deepseek-reasoner": 128000,
+	"qwen3-max":         262144,
+	"qwen-max":          32768,
+	"qwen-plus":         131072,
+	"qwen-turbo":        1000000,
+	"gpt-4o":            128000,
+	"gpt-4o-mini":       128000,
+	"gpt-4.1":           1047576,
+	"gpt-4.1-mini":      1047576,
+}
+
+var (
+	contextWindows        map[string]int
+	contextWindowAll      int // AI_CONTEXT_WINDOW 为单个数字时对所有模型生效
+	contextWindowsOnce    sync.Once
+	unknownContextWindows sync.Map // 已提示过上下文窗口未知的模型
+)
+
+// loadContextWindows 合并内置上下文窗口和 AI_CONTEXT_WINDOW
+// AI_CONTEXT_WINDOW 可以是数字（对所有模型生效）或JSON对象（模型 -> 上下文窗口，按模型覆盖）
+func loadContextWindows() (map[string]int, int) {
+	table := make(map[string]int, len(defaultContextWindows))
+	for model, window := range defaultContextWindows {
+		table[model] = window
+	}
+
+	raw := strings.TrimSpace(os.Getenv("AI_CONTEXT_WINDOW"))
+	if raw == "" {
+		return table, 0
+	}
+	if !strings.HasPrefix(raw, "{") {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed <= 0 {
+			log.Printf("⚠️  [MCP] 环境变量 AI_CONTEXT_WINDOW 无效 (%s)，使用内置的模型上下文窗口", raw)
+			return table, 0
+		}
+		log.Printf("🔧 [MCP] 使用环境变量 AI_CONTEXT_WINDOW: %d", parsed)
+		return table, parsed
+	}
+	custom, err := ParseContextWindows(raw)
+	if err != nil {
+		log.Printf("⚠️  [MCP] AI_CONTEXT_WINDOW 无效，使用内置的模型上下文窗口: %v", err)
+		return table, 0
+	}
+	for model, window := range custom {
+		table[model] = window
+	}
+	log.Printf("🔧 [MCP] 使用环境变量 AI_CONTEXT_WINDOW: %d 个模型上下文窗口", len(custom))
+	return table, 0
+}
+
+// ParseContextWindows 解析按模型配置的上下文窗口（JSON对象：模型 -> token数）
+func ParseContextWindows(raw string) (map[string]int, error) {
+	var table map[string]int
+	if err := json.Unmarshal([]byte(raw), &table); err != nil {
+		return nil, fmt.Errorf("上下文窗口配置必须是JSON对象: %w", err)
+	}
+	normalized := make(map[string]int, len(table))
+	for model, window := range table {
+		if window <= 0 {
+			return nil, fmt.Errorf("模型 %s 的上下文窗口必须大于0", model)
+		}
+		normalized[strings.ToLower(strings.TrimSpace(model))] = window
+	}
+	return normalized, nil
+}
+
+// ContextWindowFor 查询模型的上下文窗口（token）；未知模型返回0（不按上下文窗口压缩 prompt）
+func ContextWindowFor(model string) int {
+	contextWindowsOnce.Do(func() { contextWindows, contextWindowAll = loadContextWindows() })
+	if contextWindowAll > 0 {
+		return contextWindowAll
+	}
+	if window, ok := lookupModel(contextWindows, model); ok {
+		return window
+	}
+	if _, seen := unknownContextWindows.LoadOrStore(model, true); !seen {
+		log.Printf("⚠️  [MCP] 模型 %s 的上下文窗口未知，不压缩 prompt（可通过 AI_CONTEXT_WINDOW 配置）", model)
+	}
+	return 0
+}
+
+// ContextWindow 客户端当前模型的上下文窗口（token，0表示未知）
+func (client *Client) ContextWindow() int {
+	return ContextWindowFor(client.Model)
+}
@@ -0,0 +1,187 @@
+package mcp
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Usage AI调用的token用量和费用（可累加多次调用）
+type Usage struct {
+	Calls            int     `json:"calls"`
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	CostUSD          float64 `json:"cost_usd"`
+}
+
+// Add 累加另一次调用的用量
+func (u *Usage) Add(other Usage) {
+	u.Calls += other.Calls
+	u.PromptTokens += other.PromptTokens
+	u.CompletionTokens += other.CompletionTokens
+	u.CostUSD += other.CostUSD
+}
+
+// TotalTokens 输入和输出token总数
+func (u Usage) TotalTokens() int {
+	return u.PromptTokens + u.CompletionTokens
+}
+
+// ModelPrice 模型价格（美元/百万token）
+type ModelPrice struct {
+	Input  float64 `json:"input"`  // 输入（prompt）价格
+	Output float64 `json:"output"` // 输出（completion）价格
+}
+
+// defaultPriceTable 内置的模型价格（美元/百万token，按官方标价，缓存命中等折扣不计）
+// 可通过环境变量 AI_PRICE_TABLE 覆盖或补充
+var defaultPriceTable = map[string]ModelPrice{
+	"deepseek-chat":     {Input: 0.28, Output: 0.42},
+	"deepseek-reasoner": {Input: 0.28, Output: 0.42},
+	"qwen3-max":         {Input: 1.2, Output: 6},
+	"qwen-max":          {Input: 1.6, Output: 6.4},
+	"qwen-plus":         {Input: 0.4, Output: 1.2},
+	"qwen-turbo":        {Input: 0.05, Output: 0.2},
+	"gpt-4o":            {Input: 2.5, Output: 10},
+	"gpt-4o-mini":       {Input: 0.15, Output: 0.6},
+	"gpt-4.1":           {Input: 2, Output: 8},
+	"gpt-4.1-mini":      {Input: 0.4, Output: 1.6},
+}
+
+var (
+	priceTable     map[string]ModelPrice
+	priceTableOnce sync.Once
+	unpricedModels sync.Map // 已提示过没有价格的模型
+)
+
+// loadPriceTable 合并内置价格和 AI_PRICE_TABLE（JSON对象或JSON文件路径：模型 -> {"input":..,"output":..}）
+func loadPriceTable() map[string]ModelPrice {
+	table := make(map[string]ModelPrice, len(defaultPriceTable))
+	for model, price := range defaultPriceTable {
+		table[model] = price
+	}
+
+	raw := strings.TrimSpace(os.Getenv("AI_PRICE_TABLE"))
+	if raw == "" {
+		return table
+	}
+	if !strings.HasPrefix(raw, "{") {
+		data, err := os.ReadFile(raw)
+		if err != nil {
+			log.Printf("⚠️  [MCP] 读取 AI_PRICE_TABLE 文件失败，使用内置价格: %v", err)
+			return table
+		}
+		raw = string(data)
+	}
+	custom, err := ParsePriceTable(raw)
+	if err != nil {
+		log.Printf("⚠️  [MCP] AI_PRICE_TABLE 无效，使用内置价格: %v", err)
+		return table
+	}
+	for model, price := range custom {
+		table[model] = price
+	}
+	log.Printf("🔧 [MCP] 使用环境变量 AI_PRICE_TABLE: %d 个模型价格", len(custom))
+	return table
+}
+
+// ParsePriceTable 解析模型价格表（JSON对象：模型 -> {"input":..,"output":..}，单位为美元/百万token）
+func ParsePriceTable(raw string) (map[string]ModelPrice, error) {
+	var table map[string]ModelPrice
+	if err := json.Unmarshal([]byte(raw), &table); err != nil {
+		return nil, fmt.Errorf("价格表必须是JSON对象: %w", err)
+	}
+	normalized := make(map[string]ModelPrice, len(table))
+	for model, price := range table {
+		if price.Input < 0 || price.Output < 0 {
+			return nil, fmt.Errorf("模型 %s 的价格不能为负数", model)
+		}
+		normalized[strings.ToLower(strings.TrimSpace(model))] = price
+	}
+	return normalized, nil
+}
+
+// PriceFor 查询模型价格（不区分大小写；没有精确匹配时使用最长的前缀匹配，如 gpt-4o-2024-08-06 -> gpt-4o）
+func PriceFor(model string) (ModelPrice, bool) {
+	priceTableOnce.Do(func() { priceTable = loadPriceTable() })
+	return lookupModel(priceTable, model)
+}
+
+// lookupModel 按模型名查表（不区分大小写；没有精确匹配时使用最长的前缀匹配）
+func lookupModel[T any](table map[string]T, model string) (T, bool) {
+	model = strings.ToLower(strings.TrimSpace(model))
+	if value, ok := table[model]; ok {
+		return value, true
+	}
+	best := ""
+	for name := range table {
+		if strings.HasPrefix(model, name) && len(name) > len(best) {
+			best = name
+		}
+	}
+	if best == "" {
+		var zero T
+		return zero, false
+	}
+	return table[best], true
+}
+
+// CostFor 按模型价格计算一次调用的费用（美元），没有价格的模型费用为0
+func CostFor(model string, promptTokens, completionTokens int) float64 {
+	price, ok := PriceFor(model)
+	if !ok {
+		if _, warned := unpricedModels.LoadOrStore(model, true); !warned {
+			log.Printf("⚠️  [MCP] 模型 %s 没有价格配置，费用按0计算（可通过 AI_PRICE_TABLE 设置）", model)
+		}
+		return 0
+	}
+	return (float64(promptTokens)*price.Input + float64(completionTokens)*price.Output) / 1e6
+}
+
+// usageMeter 客户端累计的用量（并发安全）
+type usageMeter struct {
+	mu    sync.Mutex
+	total Usage
+}
+
+// recordUsage 累加一次调用的用量（未通过 New 创建的客户端不统计）
+func (client *Client) recordUsage(usage Usage) {
+	if client.usage == nil {
+		return
+	}
+	client.usage.mu.Lock()
+	defer client.usage.mu.Unlock()
+	client.usage.total.Add(usage)
+}
+
+// TakeUsage 返回上次调用 TakeUsage 以来累计的用量并清零（交易员每个周期调用一次）
+func (client *Client) TakeUsage() Usage {
+	if client.usage == nil {
+		return Usage{}
+	}
+	client.usage.mu.Lock()
+	defer client.usage.mu.Unlock()
+	usage := client.usage.total
+	client.usage.total = Usage{}
+	return usage
+}
+
+// WithModel 返回使用另一个模型的客户端（相同的API地址和密钥，用量单独统计）
+func (client *Client) WithModel(model string) *Client {
+	return &Client{
+		Provider:              client.Provider,
+		APIKey:                client.APIKey,
+		BaseURL:               client.BaseURL,
+		Model:                 model,
+		Timeout:               client.Timeout,
+		UseFullURL:            client.UseFullURL,
+		MaxTokens:             client.MaxTokens,
+		StructuredOutput:      client.StructuredOutput,
+		structuredUnsupported: &atomic.Bool{},
+		usage:                 &usageMeter{},
+	}
+}
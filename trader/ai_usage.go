@@ -0,0 +1,83 @@
+package trader
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"nofx/config"
+	"nofx/logger"
+	"nofx/mcp"
+)
+
+// aiClientForCycle 按当天AI费用和每日预算选择本周期使用的AI客户端
+// 未超预算时使用主模型；超出后改用备用模型（fallback 为 true），没有备用模型时返回 nil（跳过本周期）
+func (at *AutoTrader) aiClientForCycle() (client *mcp.Client, fallback bool) {
+	budget := at.config.DailyAIBudget
+	if budget <= 0 || at.todayAICost() < budget {
+		return at.mcpClient, false
+	}
+	if at.fallbackClient != nil {
+		return at.fallbackClient, true
+	}
+	return nil, false
+}
+
+// todayAICost 当天（UTC）已用的AI费用；首次调用或日期变化时从数据库加载，重启后预算不会重置
+func (at *AutoTrader) todayAICost() float64 {
+	today := config.AIUsageDate(time.Now())
+	if at.aiCostDate == today {
+		return at.aiCostToday
+	}
+	at.aiCostDate = today
+	at.aiCostToday = 0
+	if db, ok := at.database.(*config.Database); ok && db != nil {
+		cost, err := db.GetTraderAICost(at.id, today)
+		if err != nil {
+			log.Printf("⚠️  [%s] 读取今日AI费用失败: %v", at.name, err)
+		} else {
+			at.aiCostToday = cost
+		}
+	}
+	return at.aiCostToday
+}
+
+// recordAIUsage 取出本周期的AI用量，写入决策记录、累计到当天费用并保存到数据库
+func (at *AutoTrader) recordAIUsage(record *logger.DecisionRecord, client *mcp.Client, fallback bool) {
+	usage := client.TakeUsage()
+	if usage.Calls == 0 {
+		return
+	}
+	at.todayAICost() // 跨日时先切换到新的一天
+	at.aiCostToday += usage.CostUSD
+
+	record.AIUsage = &logger.AIUsageRecord{
+		Model:            client.Model,
+		Calls:            usage.Calls,
+		PromptTokens:     usage.PromptTokens,
+		CompletionTokens: usage.CompletionTokens,
+		CostUSD:          usage.CostUSD,
+		BudgetFallback:   fallback,
+	}
+	log.Printf("💰 AI用量: %d 次调用，输入 %d / 输出 %d token，费用 $%.4f（今日累计 $%.4f）",
+		usage.Calls, usage.PromptTokens, usage.CompletionTokens, usage.CostUSD, at.aiCostToday)
+	record.ExecutionLog = append(record.ExecutionLog,
+		fmt.Sprintf("AI用量: %d 次调用，%d token，$%.4f", usage.Calls, usage.TotalTokens(), usage.CostUSD))
+
+	db, ok := at.database.(*config.Database)
+	if !ok || db == nil {
+		return
+	}
+	if err := db.AddAIUsage(&config.AIUsageRecord{
+		UserID:           at.userID,
+		TraderID:         at.id,
+		Date:             at.aiCostDate,
+		Model:            client.Model,
+		Calls:            usage.Calls,
+		PromptTokens:     usage.PromptTokens,
+		CompletionTokens: usage.CompletionTokens,
+		CostUSD:          usage.CostUSD,
+	}); err != nil {
+		log.Printf("⚠️  [%s] %v", at.name, err)
+	}
+}
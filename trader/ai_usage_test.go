@@ -0,0 +1,40 @@
+package trader
+
+import (
+	"time"
+
+	"nofx/config"
+	"nofx/mcp"
+)
+
+// TestAIClientForCycle 超出每日AI预算后切换到备用模型，没有备用模型时跳过周期
+func (s *AutoTraderTestSuite) TestAIClientForCycle() {
+	at := s.autoTrader
+	at.mcpClient = mcp.New()
+	at.aiCostDate = config.AIUsageDate(time.Now())
+	at.aiCostToday = 1.5
+
+	client, fallback := at.aiClientForCycle()
+	s.Same(at.mcpClient, client, "未设置预算时不限制")
+	s.False(fallback)
+
+	at.config.DailyAIBudget = 2
+	client, fallback = at.aiClientForCycle()
+	s.Same(at.mcpClient, client, "未超预算时使用主模型")
+	s.False(fallback)
+
+	at.config.DailyAIBudget = 1
+	client, fallback = at.aiClientForCycle()
+	s.Nil(client, "超出预算且没有备用模型时跳过周期")
+	s.False(fallback)
+
+	at.fallbackClient = at.mcpClient.WithModel("qwen-turbo")
+	client, fallback = at.aiClientForCycle()
+	s.Same(at.fallbackClient, client)
+	s.True(fallback)
+
+	at.aiCostDate = "2000-01-01"
+	client, fallback = at.aiClientForCycle()
+	s.Same(at.mcpClient, client, "跨日后预算重新计算")
+	s.False(fallback)
+}
@@ -14,6 +14,7 @@ import (
 	"net/http"
 	"net/url"
 	"nofx/hook"
+	"nofx/market"
 	"sort"
 	"strconv"
 	"strings"
@@ -150,6 +151,58 @@ func (t *AsterTrader) getPrecision(symbol string) (SymbolPrecision, error) {
 	return SymbolPrecision{}, fmt.Errorf("未找到交易对 %s 的精度信息", symbol)
 }
 
+// GetInstruments 获取可交易的永续合约列表
+func (t *AsterTrader) GetInstruments() ([]market.Instrument, error) {
+	resp, err := t.client.Get(t.baseURL + "/fapi/v3/exchangeInfo")
+	if err != nil {
+		return nil, fmt.Errorf("获取交易规则失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	var info struct {
+		Symbols []struct {
+			Symbol       string                   `json:"symbol"`
+			BaseAsset    string                   `json:"baseAsset"`
+			QuoteAsset   string                   `json:"quoteAsset"`
+			ContractType string                   `json:"contractType"`
+			Status       string                   `json:"status"`
+			Filters      []map[string]interface{} `json:"filters"`
+		} `json:"symbols"`
+	}
+	if err := json.Unmarshal(body, &info); err != nil {
+		return nil, fmt.Errorf("解析交易规则失败: %w", err)
+	}
+
+	var instruments []market.Instrument
+	for _, s := range info.Symbols {
+		if s.Status != "" && s.Status != "TRADING" {
+			continue
+		}
+		if s.ContractType != "" && s.ContractType != market.ContractPerpetual {
+			continue
+		}
+		base, quote := s.BaseAsset, s.QuoteAsset
+		if base == "" || quote == "" {
+			base, quote = market.SplitSymbol(s.Symbol)
+		}
+		if quote != market.QuoteUSDT && quote != market.QuoteUSDC {
+			continue
+		}
+		minQty, minNotional := parseOrderMinimums(s.Filters)
+		instruments = append(instruments, market.Instrument{
+			Base:         base,
+			Quote:        quote,
+			Exchange:     "aster",
+			NativeSymbol: s.Symbol,
+			ContractType: market.ContractPerpetual,
+			MinNotional:  minNotional,
+			MinQty:       minQty,
+		})
+	}
+	return instruments, nil
+}
+
 // roundToTickSize 将价格/数量四舍五入到tick size/step size的整数倍
 func roundToTickSize(value float64, tickSize float64) float64 {
 	if tickSize <= 0 {
@@ -575,6 +628,11 @@ func (t *AsterTrader) GetPositions() ([]map[string]interface{}, error) {
 
 // OpenLong 开多单
 func (t *AsterTrader) OpenLong(symbol string, quantity float64, leverage int) (map[string]interface{}, error) {
+	return t.OpenLongWithClientID(symbol, quantity, leverage, "")
+}
+
+// OpenLongWithClientID 使用指定客户端订单ID开多单（clientOrderID为空时由交易所生成）
+func (t *AsterTrader) OpenLongWithClientID(symbol string, quantity float64, leverage int, clientOrderID string) (map[string]interface{}, error) {
 	// 开仓前先取消所有挂单,防止残留挂单导致仓位叠加
 	if err := t.CancelAllOrders(symbol); err != nil {
 		log.Printf("  ⚠ 取消挂单失败(继续开仓): %v", err)
@@ -626,6 +684,9 @@ func (t *AsterTrader) OpenLong(symbol string, quantity float64, leverage int) (m
 		"quantity":     qtyStr,
 		"price":        priceStr,
 	}
+	if clientOrderID != "" {
+		params["newClientOrderId"] = clientOrderID
+	}
 
 	body, err := t.request("POST", "/fapi/v3/order", params)
 	if err != nil {
@@ -642,6 +703,11 @@ func (t *AsterTrader) OpenLong(symbol string, quantity float64, leverage int) (m
 
 // OpenShort 开空单
 func (t *AsterTrader) OpenShort(symbol string, quantity float64, leverage int) (map[string]interface{}, error) {
+	return t.OpenShortWithClientID(symbol, quantity, leverage, "")
+}
+
+// OpenShortWithClientID 使用指定客户端订单ID开空单（clientOrderID为空时由交易所生成）
+func (t *AsterTrader) OpenShortWithClientID(symbol string, quantity float64, leverage int, clientOrderID string) (map[string]interface{}, error) {
 	// 开仓前先取消所有挂单,防止残留挂单导致仓位叠加
 	if err := t.CancelAllOrders(symbol); err != nil {
 		log.Printf("  ⚠ 取消挂单失败(继续开仓): %v", err)
@@ -693,6 +759,9 @@ func (t *AsterTrader) OpenShort(symbol string, quantity float64, leverage int) (
 		"quantity":     qtyStr,
 		"price":        priceStr,
 	}
+	if clientOrderID != "" {
+		params["newClientOrderId"] = clientOrderID
+	}
 
 	body, err := t.request("POST", "/fapi/v3/order", params)
 	if err != nil {
@@ -707,6 +776,44 @@ func (t *AsterTrader) OpenShort(symbol string, quantity float64, leverage int) (
 	return result, nil
 }
 
+// GetOrderByClientID 按客户端订单ID查询订单
+func (t *AsterTrader) GetOrderByClientID(symbol string, clientOrderID string) (map[string]interface{}, error) {
+	if clientOrderID == "" {
+		return nil, ErrOrderNotFound
+	}
+
+	params := map[string]interface{}{
+		"symbol":            symbol,
+		"origClientOrderId": clientOrderID,
+	}
+
+	body, err := t.request("GET", "/fapi/v3/order", params)
+	if err != nil {
+		// -2013: Order does not exist
+		if strings.Contains(err.Error(), "-2013") || strings.Contains(err.Error(), "Order does not exist") {
+			return nil, ErrOrderNotFound
+		}
+		return nil, fmt.Errorf("查询订单失败: %w", err)
+	}
+
+	var order map[string]interface{}
+	if err := json.Unmarshal(body, &order); err != nil {
+		return nil, fmt.Errorf("解析订单数据失败: %w", err)
+	}
+
+	orderID, _ := order["orderId"].(float64)
+	status, _ := order["status"].(string)
+	executedQtyStr, _ := order["executedQty"].(string)
+	executedQty, _ := strconv.ParseFloat(executedQtyStr, 64)
+
+	return map[string]interface{}{
+		"orderId":     int64(orderID),
+		"symbol":      symbol,
+		"status":      status,
+		"executedQty": executedQty,
+	}, nil
+}
+
 // CloseLong 平多单
 func (t *AsterTrader) CloseLong(symbol string, quantity float64) (map[string]interface{}, error) {
 	// 如果数量为0，获取当前持仓数量
@@ -762,6 +869,7 @@ func (t *AsterTrader) CloseLong(symbol string, quantity float64) (map[string]int
 	params := map[string]interface{}{
 		"symbol":       symbol,
 		"positionSide": "BOTH",
+		"reduceOnly":   "true", // 单向持仓：平仓单只减仓，避免反向开仓
 		"type":         "LIMIT",
 		"side":         "SELL",
 		"timeInForce":  "GTC",
@@ -845,6 +953,7 @@ func (t *AsterTrader) CloseShort(symbol string, quantity float64) (map[string]in
 	params := map[string]interface{}{
 		"symbol":       symbol,
 		"positionSide": "BOTH",
+		"reduceOnly":   "true", // 单向持仓：平仓单只减仓，避免反向开仓
 		"type":         "LIMIT",
 		"side":         "BUY",
 		"timeInForce":  "GTC",
@@ -872,6 +981,12 @@ func (t *AsterTrader) CloseShort(symbol string, quantity float64) (map[string]in
 	return result, nil
 }
 
+// GetPositionMode 获取持仓模式
+// Aster 账户使用单向持仓（positionSide=BOTH），平仓和止盈止损使用 reduceOnly
+func (t *AsterTrader) GetPositionMode() string {
+	return PositionModeOneWay
+}
+
 // SetMarginMode 设置仓位模式
 func (t *AsterTrader) SetMarginMode(symbol string, isCrossMargin bool) error {
 	// Aster支持仓位模式设置
@@ -987,6 +1102,7 @@ func (t *AsterTrader) SetStopLoss(symbol string, positionSide string, quantity,
 	params := map[string]interface{}{
 		"symbol":       symbol,
 		"positionSide": "BOTH",
+		"reduceOnly":   "true", // 单向持仓：止损单只减仓
 		"type":         "STOP_MARKET",
 		"side":         side,
 		"stopPrice":    priceStr,
@@ -1028,6 +1144,7 @@ func (t *AsterTrader) SetTakeProfit(symbol string, positionSide string, quantity
 	params := map[string]interface{}{
 		"symbol":       symbol,
 		"positionSide": "BOTH",
+		"reduceOnly":   "true", // 单向持仓：止盈单只减仓
 		"type":         "TAKE_PROFIT_MARKET",
 		"side":         side,
 		"stopPrice":    priceStr,
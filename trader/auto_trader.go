@@ -2,9 +2,11 @@ package trader
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"math"
+	"nofx/config"
 	"nofx/decision"
 	"nofx/logger"
 	"nofx/market"
@@ -12,6 +14,7 @@ import (
 	"nofx/pool"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -32,6 +35,7 @@ type AutoTraderConfig struct {
 	// Hyperliquid配置
 	HyperliquidPrivateKey string
 	HyperliquidWalletAddr string
+	HyperliquidVaultAddr  string // 子账户/Vault地址（可选，设置后在该地址上交易）
 	HyperliquidTestnet    bool
 
 	// Aster配置
@@ -69,12 +73,51 @@ type AutoTraderConfig struct {
 	// 仓位模式
 	IsCrossMargin bool // true=全仓模式, false=逐仓模式
 
+	// 持仓模式
+	PositionMode string // "hedge"=双向持仓, "one_way"=单向持仓，空值使用交易所默认
+
 	// 币种配置
 	DefaultCoins []string // 默认币种列表（从数据库获取）
 	TradingCoins []string // 实际交易币种列表
 
 	// 系统提示词模板
 	SystemPromptTemplate string // 系统提示词模板名称（如 "default", "aggressive"）
+	RegimeTemplates      string // 市场状态 -> 系统提示词模板（JSON对象），空值不按市场状态切换
+	PromptLanguage       string // 系统提示词语言（zh/en，空值为中文）
+	SystemPromptVersion  int    // 固定的用户模板版本（A/B实验使用），<=0 使用最新版本
+
+	// 代理模式：AI先看紧凑概览，再通过工具按需查询行情、订单簿和历史交易
+	AgentMode    bool // 是否启用代理模式
+	MaxToolCalls int  // 每个周期的工具调用上限，<=0 使用默认值
+
+	// 风控审核：交易分析师给出决策后，由风控经理批准、缩小或否决每条开仓决策
+	RiskReview       bool   // 是否启用第二阶段风控审核
+	RiskReviewPrompt string // 额外风控规则（追加到风控经理的系统提示词）
+
+	// 交易记忆：提示词中加入近期交易、币种战绩和近期失误，并定期由AI复盘
+	TradeMemory        bool // 是否在提示词中加入交易记忆
+	ReflectionInterval int  // AI复盘间隔（周期数，<=0 不复盘）
+
+	// 开仓校验规则（JSON对象：风险回报比、仓位上限、最小开仓金额等），空值使用默认规则
+	ValidationRules string
+
+	// AI费用预算：当天（UTC）AI费用达到预算后，改用备用模型或跳过周期
+	DailyAIBudget       float64 // 每日AI费用预算（美元），<=0 不限制
+	BudgetFallbackModel string  // 超出预算后改用的模型（同一API），空值跳过周期
+
+	// 市场数据配置
+	Timeframes string // K线周期，逗号分隔（如 "1m,15m,1h"，空值使用系统默认）
+	Indicators string // 提示词输出的指标，逗号分隔（空值为基础指标）
+
+	// 滑点控制
+	MaxSlippagePct float64 // 按订单簿估算的开仓滑点上限（百分比），超过则拒绝开仓，<=0 不检查
+
+	// 事件触发（在固定扫描间隔之外提前触发AI决策周期）
+	AlertTrigger         bool          // 关注的币种出现市场警报时触发
+	PriceMoveTriggerPct  float64       // 持仓币种价格相对上个周期变化超过该百分比时触发，<=0 不检查
+	LiquidationBufferPct float64       // 持仓标记价距强平价小于该百分比时触发，<=0 不检查
+	FillTrigger          bool          // 持仓在周期外被平掉（止盈/止损、强平或手动平仓）时触发
+	MinTriggerGap        time.Duration // 事件触发的AI决策与上个周期的最小间隔，<=0 使用默认1分钟
 }
 
 // AutoTrader 自动交易器
@@ -107,8 +150,46 @@ type AutoTrader struct {
 	lastBalanceSyncTime   time.Time          // 上次余额同步时间
 	database              interface{}        // 数据库引用（用于自动更新余额）
 	userID                string             // 用户ID
+	marketDataConfig      *market.DataConfig // K线周期和指标配置
+	watchedSymbols        map[string]bool    // 最近一个周期关注的币种（持仓+候选，币安USDT交易对）
+	lastCycleTime         time.Time          // 上次AI决策周期开始时间
+	cycleSeq              atomic.Int64       // AI决策周期序号（持仓事件监控据此重置基准）
+	cycleRunning          atomic.Bool        // AI决策周期是否正在执行
+	regimeTemplates       map[string]string  // 市场状态 -> 系统提示词模板
+	systemPromptVersion   int                // 固定的用户模板版本（0为最新）
+	promptMutex           sync.RWMutex       // 保护 systemPromptTemplate 和 systemPromptVersion（API 与运行中的周期并发读写）
+
+	validationRules decision.ValidationRules // 开仓校验规则（风险回报比、仓位上限、最小开仓金额）
+
+	// AI用量：每个周期统计token和费用，按每日预算切换模型
+	fallbackClient *mcp.Client // 超出预算后使用的备用模型客户端（未配置时为nil）
+	aiCostDate     string      // aiCostToday 对应的日期（UTC）
+	aiCostToday    float64     // 当天已用的AI费用（美元）
+
+	// 交易记忆：识别交易所止盈止损成交，并定期由AI复盘
+	lastPositions       map[string]decision.PositionInfo // 上个周期的持仓 (symbol_side -> 持仓)
+	exitLevels          map[string]positionExit          // 持仓的止损止盈价 (symbol_side -> 价格)
+	pendingAutoCloses   []logger.DecisionAction          // 待写入本周期决策记录的交易所自动平仓
+	reflection          *logger.Reflection               // 最近一次AI复盘（首次使用时从日志目录加载）
+	reflectionLoaded    bool
+	lastReflectionCycle int // 上次尝试复盘的周期
+
+	// 用户提示词模板解析缓存（按模板ID和版本）
+	promptTemplates     map[promptTemplateKey]*decision.PromptTemplate
+	promptTemplateMutex sync.Mutex
+
+	// 交易所可交易品种缓存（用于候选币种过滤和决策符号校验）
+	instruments         *market.InstrumentSet
+	instrumentsLoadedAt time.Time
+	instrumentsMutex    sync.Mutex
 }
 
+// instrumentCacheTTL 交易品种列表缓存时间
+const instrumentCacheTTL = 1 * time.Hour
+
+// getMarketData 获取币种的行情数据（测试中替换为桩函数）
+var getMarketData = market.GetWithConfig
+
 // NewAutoTrader 创建自动交易器
 func NewAutoTrader(config AutoTraderConfig, database interface{}, userID string) (*AutoTrader, error) {
 	// 设置默认值
@@ -172,13 +253,20 @@ func NewAutoTrader(config AutoTraderConfig, database interface{}, userID string)
 	}
 	log.Printf("📊 [%s] 仓位模式: %s", config.Name, marginModeStr)
 
+	positionMode := NormalizePositionMode(config.Exchange, config.PositionMode)
+	positionModeStr := "双向持仓"
+	if positionMode == PositionModeOneWay {
+		positionModeStr = "单向持仓"
+	}
+	log.Printf("📊 [%s] 持仓模式: %s", config.Name, positionModeStr)
+
 	switch config.Exchange {
 	case "binance":
 		log.Printf("🏦 [%s] 使用币安合约交易", config.Name)
-		trader = NewFuturesTrader(config.BinanceAPIKey, config.BinanceSecretKey, userID)
+		trader = NewFuturesTrader(config.BinanceAPIKey, config.BinanceSecretKey, userID, positionMode)
 	case "hyperliquid":
 		log.Printf("🏦 [%s] 使用Hyperliquid交易", config.Name)
-		trader, err = NewHyperliquidTrader(config.HyperliquidPrivateKey, config.HyperliquidWalletAddr, config.HyperliquidTestnet)
+		trader, err = NewHyperliquidTrader(config.HyperliquidPrivateKey, config.HyperliquidWalletAddr, config.HyperliquidVaultAddr, config.HyperliquidTestnet)
 		if err != nil {
 			return nil, fmt.Errorf("初始化Hyperliquid交易器失败: %w", err)
 		}
@@ -208,6 +296,42 @@ func NewAutoTrader(config AutoTraderConfig, database interface{}, userID string)
 		systemPromptTemplate = "adaptive"
 	}
 
+	// 解析K线周期和指标配置（配置无效时使用系统默认，不阻止交易员启动）
+	marketDataConfig, err := market.NewDataConfig(config.Timeframes, config.Indicators)
+	if err != nil {
+		log.Printf("⚠️  [%s] 市场数据配置无效，使用系统默认: %v", config.Name, err)
+		marketDataConfig = &market.DataConfig{}
+	}
+	if len(marketDataConfig.Timeframes) > 0 {
+		log.Printf("📊 [%s] K线周期: %s", config.Name, strings.Join(marketDataConfig.Timeframes, ", "))
+	}
+	// 行情取自交易员所在交易所（价格、资金费率和上架币种因交易所而异）
+	marketDataConfig.Source = market.SourceForExchange(config.Exchange, config.HyperliquidTestnet)
+	log.Printf("📊 [%s] 行情数据源: %s", config.Name, marketDataConfig.Source.Name())
+
+	// 解析按市场状态选择的提示词模板（配置无效时不切换模板）
+	var userTemplates []string
+	if config.RegimeTemplates != "" {
+		userTemplates = userPromptTemplateNames(database, userID)
+	}
+	regimeTemplates, err := decision.ParseRegimeTemplates(config.RegimeTemplates, userTemplates)
+	if err != nil {
+		log.Printf("⚠️  [%s] 市场状态模板配置无效，不按市场状态切换模板: %v", config.Name, err)
+	}
+
+	// 解析开仓校验规则（配置无效时使用默认规则）
+	validationRules, err := decision.ParseValidationRules(config.ValidationRules)
+	if err != nil {
+		log.Printf("⚠️  [%s] 开仓校验规则配置无效，使用默认规则: %v", config.Name, err)
+	}
+
+	// 超出每日AI预算后改用的备用模型（与主模型使用同一API）
+	var fallbackClient *mcp.Client
+	if config.DailyAIBudget > 0 && config.BudgetFallbackModel != "" {
+		fallbackClient = mcpClient.WithModel(config.BudgetFallbackModel)
+		log.Printf("💰 [%s] 每日AI预算 $%.2f，超出后改用模型: %s", config.Name, config.DailyAIBudget, config.BudgetFallbackModel)
+	}
+
 	return &AutoTrader{
 		id:                    config.ID,
 		name:                  config.Name,
@@ -226,6 +350,8 @@ func NewAutoTrader(config AutoTraderConfig, database interface{}, userID string)
 		callCount:             0,
 		isRunning:             false,
 		positionFirstSeenTime: make(map[string]int64),
+		lastPositions:         make(map[string]decision.PositionInfo),
+		exitLevels:            make(map[string]positionExit),
 		stopMonitorCh:         make(chan struct{}),
 		monitorWg:             sync.WaitGroup{},
 		peakPnLCache:          make(map[string]float64),
@@ -233,6 +359,11 @@ func NewAutoTrader(config AutoTraderConfig, database interface{}, userID string)
 		lastBalanceSyncTime:   time.Now(), // 初始化为当前时间
 		database:              database,
 		userID:                userID,
+		marketDataConfig:      marketDataConfig,
+		regimeTemplates:       regimeTemplates,
+		validationRules:       validationRules,
+		fallbackClient:        fallbackClient,
+		systemPromptVersion:   config.SystemPromptVersion,
 	}, nil
 }
 
@@ -249,12 +380,31 @@ func (at *AutoTrader) Run() error {
 	at.monitorWg.Add(1)
 	defer at.monitorWg.Done()
 
+	// 登记需要的K线周期（WSMonitor 订阅所有运行中交易员周期的并集）
+	market.RegisterTimeframes(at.id, at.marketDataConfig.EffectiveTimeframes())
+	defer market.UnregisterTimeframes(at.id)
+
 	// 启动回撤监控
 	at.startDrawdownMonitor()
 
 	ticker := time.NewTicker(at.config.ScanInterval)
 	defer ticker.Stop()
 
+	// 订阅市场警报（未启用时 alerts 为nil，select 永不触发）
+	var alerts <-chan market.Alert
+	if at.config.AlertTrigger {
+		sub := market.SubscribeAlerts(at.id)
+		defer market.UnsubscribeAlerts(sub)
+		alerts = sub.C
+		log.Printf("🔔 [%s] 已启用市场警报触发", at.name)
+	}
+
+	// 持仓事件监控（价格变化、接近强平、止盈止损成交），事件合并后按最小间隔触发周期
+	triggers := make(chan cycleTrigger, triggerQueueSize)
+	at.startPositionTriggerMonitor(triggers)
+	scheduler := newTriggerScheduler(at.config.MinTriggerGap)
+	defer scheduler.reset()
+
 	// 首次立即执行
 	if err := at.runCycle(); err != nil {
 		log.Printf("❌ 执行失败: %v", err)
@@ -263,6 +413,22 @@ func (at *AutoTrader) Run() error {
 	for at.isRunning {
 		select {
 		case <-ticker.C:
+			scheduler.reset() // 定时周期覆盖等待中的事件
+			if err := at.runCycle(); err != nil {
+				log.Printf("❌ 执行失败: %v", err)
+			}
+		case alert, ok := <-alerts:
+			if !ok {
+				alerts = nil
+				continue
+			}
+			if at.shouldRunOnAlert(alert) {
+				scheduler.add(cycleTrigger{Reason: TriggerMarketAlert, Symbol: alert.Symbol, Message: alert.Message}, at.lastCycleTime, time.Now())
+			}
+		case t := <-triggers:
+			scheduler.add(t, at.lastCycleTime, time.Now())
+		case <-scheduler.C():
+			log.Printf("⚡ [%s] 事件触发AI决策: %s", at.name, summarizeTriggers(scheduler.take()))
 			if err := at.runCycle(); err != nil {
 				log.Printf("❌ 执行失败: %v", err)
 			}
@@ -275,6 +441,113 @@ func (at *AutoTrader) Run() error {
 	return nil
 }
 
+// shouldRunOnAlert 警报币种在关注列表中时才触发（最小间隔由 triggerScheduler 控制）
+func (at *AutoTrader) shouldRunOnAlert(alert market.Alert) bool {
+	return at.watchedSymbols[alert.Symbol]
+}
+
+// userPromptTemplateNames 用户在数据库中保存的提示词模板名称（读取失败时只记录日志）
+func userPromptTemplateNames(database interface{}, userID string) []string {
+	db, ok := database.(*config.Database)
+	if !ok || db == nil {
+		return nil
+	}
+	names, err := db.ListPromptTemplateNames(userID)
+	if err != nil {
+		log.Printf("⚠️  读取用户提示词模板失败: %v", err)
+		return nil
+	}
+	return names
+}
+
+// promptTemplateKey 用户提示词模板的解析缓存键（模板版本保存后不可修改）
+type promptTemplateKey struct {
+	templateID int64
+	version    int
+}
+
+// loadUserPromptTemplates 读取用户在数据库中保存的提示词模板（各模板的最新版本）
+// 每个周期只查询模板列表，模板内容按模板ID和版本缓存，仅在出现新版本时读取并解析
+// A/B实验固定了模板版本时，当前模板使用固定的版本；固定版本无法加载时返回错误，
+// 由调用方跳过本周期，避免实验分组悄悄改用最新版本而污染实验结果
+func (at *AutoTrader) loadUserPromptTemplates(templateName string, version int) (map[string]*decision.PromptTemplate, error) {
+	db, ok := at.database.(*config.Database)
+	if !ok || db == nil {
+		return nil, nil
+	}
+	records, err := db.GetPromptTemplates(at.userID)
+	if err != nil {
+		log.Printf("⚠️  [%s] 读取用户提示词模板失败: %v", at.name, err)
+		records = nil
+	}
+
+	at.promptTemplateMutex.Lock()
+	defer at.promptTemplateMutex.Unlock()
+	// 只保留本周期用到的版本，旧版本随之淘汰
+	cache := make(map[promptTemplateKey]*decision.PromptTemplate, len(records)+1)
+	load := func(templateID int64, name string, v int) (*decision.PromptTemplate, error) {
+		key := promptTemplateKey{templateID: templateID, version: v}
+		if tmpl, ok := at.promptTemplates[key]; ok {
+			cache[key] = tmpl
+			return tmpl, nil
+		}
+		tv, err := db.GetPromptTemplateVersion(at.userID, name, v)
+		if err != nil {
+			return nil, err
+		}
+		tmpl, err := decision.NewPromptTemplate(tv.Name, tv.Version, tv.Content)
+		if err != nil {
+			return nil, err
+		}
+		cache[key] = tmpl
+		return tmpl, nil
+	}
+
+	templates := make(map[string]*decision.PromptTemplate, len(records))
+	templateIDs := make(map[string]int64, len(records))
+	for _, r := range records {
+		templateIDs[r.Name] = r.ID
+		tmpl, err := load(r.ID, r.Name, r.LatestVersion)
+		if err != nil {
+			log.Printf("⚠️  [%s] %v", at.name, err)
+			continue
+		}
+		templates[r.Name] = tmpl
+	}
+
+	if version > 0 {
+		var tmpl *decision.PromptTemplate
+		if templateID, ok := templateIDs[templateName]; ok {
+			tmpl, err = load(templateID, templateName, version)
+		} else {
+			// 模板已删除（固定版本仍可读取）：不缓存
+			var tv *config.PromptTemplateVersion
+			if tv, err = db.GetPromptTemplateVersion(at.userID, templateName, version); err == nil {
+				tmpl, err = decision.NewPromptTemplate(tv.Name, tv.Version, tv.Content)
+			}
+		}
+		if err != nil {
+			at.promptTemplates = cache
+			return nil, fmt.Errorf("加载固定的提示词模板 %s v%d 失败: %w", templateName, version, err)
+		}
+		templates[templateName] = tmpl
+	}
+	at.promptTemplates = cache
+	return templates, nil
+}
+
+// updateWatchedSymbols 记录本周期关注的币种（持仓+候选），映射为行情使用的币安USDT交易对
+func (at *AutoTrader) updateWatchedSymbols(positions []decision.PositionInfo, candidates []decision.CandidateCoin) {
+	watched := make(map[string]bool, len(positions)+len(candidates))
+	for _, pos := range positions {
+		watched[market.ReferenceSymbol(pos.Symbol)] = true
+	}
+	for _, coin := range candidates {
+		watched[market.ReferenceSymbol(coin.Symbol)] = true
+	}
+	at.watchedSymbols = watched
+}
+
 // Stop 停止自动交易
 func (at *AutoTrader) Stop() {
 	if !at.isRunning {
@@ -289,6 +562,10 @@ func (at *AutoTrader) Stop() {
 // runCycle 运行一个交易周期（使用AI全权决策）
 func (at *AutoTrader) runCycle() error {
 	at.callCount++
+	at.lastCycleTime = time.Now()
+	at.cycleSeq.Add(1)
+	at.cycleRunning.Store(true)
+	defer at.cycleRunning.Store(false)
 
 	log.Print("\n" + strings.Repeat("=", 70) + "\n")
 	log.Printf("⏰ %s - AI决策周期 #%d", time.Now().Format("2006-01-02 15:04:05"), at.callCount)
@@ -317,6 +594,37 @@ func (at *AutoTrader) runCycle() error {
 		log.Println("📅 日盈亏已重置")
 	}
 
+	// 检查每日AI预算（超出后改用备用模型，没有备用模型时跳过本周期）
+	aiClient, budgetFallback := at.aiClientForCycle()
+	if aiClient == nil {
+		log.Printf("⏸ 今日AI费用 $%.4f 已达预算 $%.2f，跳过本周期", at.aiCostToday, at.config.DailyAIBudget)
+		record.Success = false
+		record.ErrorMessage = fmt.Sprintf("今日AI费用 $%.4f 已达预算 $%.2f", at.aiCostToday, at.config.DailyAIBudget)
+		at.decisionLogger.LogDecision(record)
+		return nil
+	}
+	if budgetFallback {
+		log.Printf("💰 今日AI费用 $%.4f 已达预算 $%.2f，本周期改用模型 %s", at.aiCostToday, at.config.DailyAIBudget, aiClient.Model)
+		record.ExecutionLog = append(record.ExecutionLog, fmt.Sprintf("💰 已达每日AI预算，改用模型 %s", aiClient.Model))
+	}
+
+	// 3. 检查行情数据流（币安数据源的K线来自 WebSocket，大面积中断时跳过本周期）
+	if at.marketDataConfig.DataSource().Name() == market.SourceBinance {
+		if health := market.GetStreamHealth(); health != nil {
+			switch health.Status {
+			case market.FeedDown:
+				log.Printf("⏸ 行情数据流中断（%d/%d 个K线流过期），跳过本周期", health.Stale, health.Total)
+				record.Success = false
+				record.ErrorMessage = fmt.Sprintf("行情数据流中断：%d/%d 个K线流过期", health.Stale, health.Total)
+				at.decisionLogger.LogDecision(record)
+				return nil
+			case market.FeedDegraded:
+				log.Printf("⚠️  行情数据流降级：%d 个K线流使用REST轮询，%d 个过期", health.Polling, health.Stale)
+				record.ExecutionLog = append(record.ExecutionLog, fmt.Sprintf("⚠️ 行情降级：%d 个K线流轮询中，%d 个过期", health.Polling, health.Stale))
+			}
+		}
+	}
+
 	// 4. 收集交易上下文
 	ctx, err := at.buildTradingContext()
 	if err != nil {
@@ -326,6 +634,17 @@ func (at *AutoTrader) runCycle() error {
 		return fmt.Errorf("构建交易上下文失败: %w", err)
 	}
 
+	// 本周期使用的模板和固定版本（取一次快照，A/B实验中途切换时不会混用）
+	// 固定的模板版本无法加载时跳过本周期
+	templateName, templateVersion := at.systemPrompt()
+	ctx.UserPromptTemplates, err = at.loadUserPromptTemplates(templateName, templateVersion)
+	if err != nil {
+		record.Success = false
+		record.ErrorMessage = fmt.Sprintf("加载提示词模板失败: %v", err)
+		at.decisionLogger.LogDecision(record)
+		return fmt.Errorf("加载提示词模板失败: %w", err)
+	}
+
 	// 保存账户状态快照
 	record.AccountState = logger.AccountSnapshot{
 		TotalBalance:          ctx.Account.TotalEquity - ctx.Account.UnrealizedPnL,
@@ -350,6 +669,14 @@ func (at *AutoTrader) runCycle() error {
 		})
 	}
 
+	// 交易所自动平仓（止盈止损等）写入本周期记录，供交易记忆统计
+	for _, action := range at.pendingAutoCloses {
+		record.Decisions = append(record.Decisions, action)
+		record.ExecutionLog = append(record.ExecutionLog, fmt.Sprintf("🔔 %s %s: %s", action.Symbol, action.Action, action.Reasoning))
+	}
+	at.pendingAutoCloses = nil
+	at.reflectIfDue(ctx, record, aiClient)
+
 	log.Print(strings.Repeat("=", 70))
 	for _, coin := range ctx.CandidateCoins {
 		record.CandidateCoins = append(record.CandidateCoins, coin.Symbol)
@@ -359,8 +686,9 @@ func (at *AutoTrader) runCycle() error {
 		ctx.Account.TotalEquity, ctx.Account.AvailableBalance, ctx.Account.PositionCount)
 
 	// 5. 调用AI获取完整决策
-	log.Printf("🤖 正在请求AI分析并决策... [模板: %s]", at.systemPromptTemplate)
-	decision, err := decision.GetFullDecisionWithCustomPrompt(ctx, at.mcpClient, at.customPrompt, at.overrideBasePrompt, at.systemPromptTemplate)
+	log.Printf("🤖 正在请求AI分析并决策... [模板: %s]", templateName)
+	decision, err := decision.GetFullDecisionWithCustomPrompt(ctx, aiClient, at.customPrompt, at.overrideBasePrompt, templateName)
+	at.recordAIUsage(record, aiClient, budgetFallback)
 
 	if decision != nil && decision.AIRequestDurationMs > 0 {
 		record.AIRequestDurationMs = decision.AIRequestDurationMs
@@ -372,8 +700,41 @@ func (at *AutoTrader) runCycle() error {
 	// 即使有错误，也保存思维链、决策和输入prompt（用于debug）
 	if decision != nil {
 		record.SystemPrompt = decision.SystemPrompt // 保存系统提示词
+		record.PromptTemplate = decision.PromptTemplate
+		record.PromptTemplateVersion = decision.PromptTemplateVersion
 		record.InputPrompt = decision.UserPrompt
 		record.CoTTrace = decision.CoTTrace
+		for _, call := range decision.ToolCalls {
+			record.ToolCalls = append(record.ToolCalls, logger.ToolCallRecord(call))
+		}
+		if len(record.ToolCalls) > 0 {
+			record.ExecutionLog = append(record.ExecutionLog,
+				fmt.Sprintf("代理模式工具调用: %d 次", len(record.ToolCalls)))
+		}
+		if budget := decision.PromptBudget; budget != nil {
+			record.PromptBudget = (*logger.PromptBudgetRecord)(budget)
+			if budget.SeriesDetail != market.SeriesFull.String() || len(budget.DroppedCandidates) > 0 {
+				record.ExecutionLog = append(record.ExecutionLog,
+					fmt.Sprintf("Prompt压缩: 序列%s，省略%d个候选币种（估算%d/%d token）",
+						budget.SeriesDetail, len(budget.DroppedCandidates), budget.EstimatedTokens, budget.InputBudget))
+			}
+		}
+		if review := decision.RiskReview; review != nil {
+			proposedJSON, _ := json.MarshalIndent(review.Proposed, "", "  ")
+			record.RiskReview = &logger.RiskReviewRecord{
+				SystemPrompt: review.SystemPrompt,
+				InputPrompt:  review.UserPrompt,
+				CoTTrace:     review.CoTTrace,
+				ProposedJSON: string(proposedJSON),
+				DurationMs:   review.DurationMs,
+				Error:        review.Error,
+			}
+			for _, v := range review.Verdicts {
+				record.RiskReview.Verdicts = append(record.RiskReview.Verdicts, logger.RiskVerdictRecord(v))
+			}
+			record.ExecutionLog = append(record.ExecutionLog,
+				fmt.Sprintf("风控审核耗时: %d ms", review.DurationMs))
+		}
 		if len(decision.Decisions) > 0 {
 			decisionJSON, _ := json.MarshalIndent(decision.Decisions, "", "  ")
 			record.DecisionJSON = string(decisionJSON)
@@ -387,7 +748,7 @@ func (at *AutoTrader) runCycle() error {
 		// 打印系统提示词和AI思维链（即使有错误，也要输出以便调试）
 		if decision != nil {
 			log.Print("\n" + strings.Repeat("=", 70) + "\n")
-			log.Printf("📋 系统提示词 [模板: %s] (错误情况)", at.systemPromptTemplate)
+			log.Printf("📋 系统提示词 [模板: %s] (错误情况)", templateName)
 			log.Println(strings.Repeat("=", 70))
 			log.Println(decision.SystemPrompt)
 			log.Println(strings.Repeat("=", 70))
@@ -443,7 +804,7 @@ func (at *AutoTrader) runCycle() error {
 	log.Println()
 
 	// 执行决策并记录结果
-	for _, d := range sortedDecisions {
+	for i, d := range sortedDecisions {
 		actionRecord := logger.DecisionAction{
 			Action:    d.Action,
 			Symbol:    d.Symbol,
@@ -452,6 +813,11 @@ func (at *AutoTrader) runCycle() error {
 			Price:     0,
 			Timestamp: time.Now(),
 			Success:   false,
+			Reasoning: d.Reasoning,
+		}
+		if d.Action == "open_long" || d.Action == "open_short" {
+			// 客户端订单ID由周期编号+决策序号确定，重试时保持不变
+			actionRecord.ClientOrderID = BuildClientOrderID(at.id, at.startTime, at.callCount, i)
 		}
 
 		if err := at.executeDecisionWithRecord(&d, &actionRecord); err != nil {
@@ -573,6 +939,9 @@ func (at *AutoTrader) buildTradingContext() (*decision.Context, error) {
 		})
 	}
 
+	// 识别上个周期之后由交易所止盈止损等触发的平仓
+	at.detectExchangeCloses(positionInfos)
+
 	// 清理已平仓的持仓记录
 	for key := range at.positionFirstSeenTime {
 		if !currentPositionKeys[key] {
@@ -585,6 +954,7 @@ func (at *AutoTrader) buildTradingContext() (*decision.Context, error) {
 	if err != nil {
 		return nil, fmt.Errorf("获取候选币种失败: %w", err)
 	}
+	candidateCoins = at.filterTradableCoins(candidateCoins)
 
 	// 4. 计算总盈亏
 	totalPnL := totalEquity - at.initialBalance
@@ -624,16 +994,45 @@ func (at *AutoTrader) buildTradingContext() (*decision.Context, error) {
 			MarginUsedPct:    marginUsedPct,
 			PositionCount:    len(positionInfos),
 		},
-		Positions:      positionInfos,
-		CandidateCoins: candidateCoins,
-		Performance:    performance, // 添加历史表现分析
+		Positions:        positionInfos,
+		CandidateCoins:   candidateCoins,
+		Performance:      performance, // 添加历史表现分析
+		MarketDataConfig: at.marketDataConfig,
+		RegimeTemplates:  at.regimeTemplates,
+		PromptLanguage:   at.config.PromptLanguage,
+		AgentMode:        at.config.AgentMode,
+		MaxToolCalls:     at.config.MaxToolCalls,
+		RiskReview:       at.config.RiskReview,
+		RiskReviewPrompt: at.config.RiskReviewPrompt,
+		TradeMemory:      at.config.TradeMemory,
+		ValidationRules:  &at.validationRules,
+		Instruments:      at.getInstrumentSet(),
+	}
+	if at.config.TradeMemory {
+		if reflection := at.loadReflection(); reflection != nil {
+			ctx.Reflection = reflection.Text
+		}
 	}
+	at.updateWatchedSymbols(positionInfos, candidateCoins)
 
 	return ctx, nil
 }
 
 // executeDecisionWithRecord 执行AI决策并记录详细信息
 func (at *AutoTrader) executeDecisionWithRecord(decision *decision.Decision, actionRecord *logger.DecisionAction) error {
+	// 将AI给出的交易对映射为交易所真实品种（如 Hyperliquid 上 BTCUSDT -> BTCUSDC）
+	if decision.Action != "hold" && decision.Action != "wait" {
+		symbol, err := at.resolveSymbol(decision.Symbol)
+		if err != nil {
+			return err
+		}
+		if symbol != decision.Symbol {
+			log.Printf("  🔁 交易对映射: %s -> %s", decision.Symbol, symbol)
+			decision.Symbol = symbol
+			actionRecord.Symbol = symbol
+		}
+	}
+
 	switch decision.Action {
 	case "open_long":
 		return at.executeOpenLongWithRecord(decision, actionRecord)
@@ -671,8 +1070,18 @@ func (at *AutoTrader) executeOpenLongWithRecord(decision *decision.Decision, act
 		}
 	}
 
+	// 滑点检查（放在平反向仓位之前，避免平仓后因滑点拒绝开仓）
+	if err := at.checkSlippage(decision.Symbol, market.SideBuy, decision.PositionSizeUSD); err != nil {
+		return err
+	}
+
+	// 单向持仓模式下反向开仓：先平掉反向仓位
+	if err := at.closeOppositeBeforeOpen(decision.Symbol, "long", positions); err != nil {
+		return err
+	}
+
 	// 获取当前价格
-	marketData, err := market.Get(decision.Symbol)
+	marketData, err := getMarketData(decision.Symbol, at.marketDataConfig)
 	if err != nil {
 		return err
 	}
@@ -709,8 +1118,11 @@ func (at *AutoTrader) executeOpenLongWithRecord(decision *decision.Decision, act
 		// 继续执行，不影响交易
 	}
 
-	// 开仓
-	order, err := at.trader.OpenLong(decision.Symbol, quantity, decision.Leverage)
+	// 开仓（使用确定性客户端订单ID，状态不明时先查询再重试）
+	if actionRecord.ClientOrderID == "" {
+		actionRecord.ClientOrderID = BuildClientOrderID(at.id, at.startTime, at.callCount, 0)
+	}
+	order, err := at.placeOpenOrderWithRetry("long", decision.Symbol, quantity, decision.Leverage, actionRecord.ClientOrderID)
 	if err != nil {
 		return err
 	}
@@ -722,9 +1134,10 @@ func (at *AutoTrader) executeOpenLongWithRecord(decision *decision.Decision, act
 
 	log.Printf("  ✓ 开仓成功，订单ID: %v, 数量: %.4f", order["orderId"], quantity)
 
-	// 记录开仓时间
+	// 记录开仓时间和止损止盈价
 	posKey := decision.Symbol + "_long"
 	at.positionFirstSeenTime[posKey] = time.Now().UnixMilli()
+	at.trackOpenedPosition(decision, "long", quantity, actionRecord.Price)
 
 	// 设置止损止盈
 	if err := at.trader.SetStopLoss(decision.Symbol, "LONG", quantity, decision.StopLoss); err != nil {
@@ -737,6 +1150,61 @@ func (at *AutoTrader) executeOpenLongWithRecord(decision *decision.Decision, act
 	return nil
 }
 
+// checkSlippage 按交易员所在交易所的订单簿估算市价开仓滑点，超过配置上限时拒绝开仓
+// 无法获取订单簿时不阻止开仓（仅记录日志）
+func (at *AutoTrader) checkSlippage(symbol, side string, notional float64) error {
+	if at.config.MaxSlippagePct <= 0 {
+		return nil
+	}
+	book, err := at.marketDataConfig.DataSource().OrderBook(symbol)
+	if err != nil {
+		log.Printf("  ⚠️ 无法获取 %s 订单簿，跳过滑点检查: %v", symbol, err)
+		return nil
+	}
+
+	slippagePct, exhausted := book.EstimateSlippage(side, notional)
+	if exhausted {
+		return fmt.Errorf("❌ %s 订单簿可见深度不足以成交 %.2f USDT（预估滑点≥%.3f%%），拒绝开仓", symbol, notional, slippagePct)
+	}
+	if slippagePct > at.config.MaxSlippagePct {
+		return fmt.Errorf("❌ %s 预估滑点 %.3f%% 超过上限 %.3f%%（开仓金额 %.2f USDT），拒绝开仓",
+			symbol, slippagePct, at.config.MaxSlippagePct, notional)
+	}
+	log.Printf("  📊 %s 预估滑点 %.3f%%（上限 %.3f%%）", symbol, slippagePct, at.config.MaxSlippagePct)
+	return nil
+}
+
+// closeOppositeBeforeOpen 单向持仓模式下开仓前先平掉同币种的反向仓位
+// 单向持仓只有一个净仓位，直接反向下单会先抵消原仓位，导致实际仓位、止盈止损与开仓记录不一致
+func (at *AutoTrader) closeOppositeBeforeOpen(symbol, side string, positions []map[string]interface{}) error {
+	if at.trader.GetPositionMode() != PositionModeOneWay {
+		return nil
+	}
+
+	opposite := oppositeSide(side)
+	for _, pos := range positions {
+		if pos["symbol"] != symbol || pos["side"] != opposite {
+			continue
+		}
+
+		log.Printf("  🔄 单向持仓模式：%s 持有%s仓，先平仓再开%s仓", symbol, sideName(opposite), sideName(side))
+		var err error
+		if opposite == "long" {
+			_, err = at.trader.CloseLong(symbol, 0)
+		} else {
+			_, err = at.trader.CloseShort(symbol, 0)
+		}
+		if err != nil {
+			return fmt.Errorf("单向持仓模式下平掉反向仓位失败: %w", err)
+		}
+
+		delete(at.positionFirstSeenTime, symbol+"_"+opposite)
+		delete(at.lastPositions, symbol+"_"+opposite)
+		return nil
+	}
+	return nil
+}
+
 // executeOpenShortWithRecord 执行开空仓并记录详细信息
 func (at *AutoTrader) executeOpenShortWithRecord(decision *decision.Decision, actionRecord *logger.DecisionAction) error {
 	log.Printf("  📉 开空仓: %s", decision.Symbol)
@@ -751,8 +1219,18 @@ func (at *AutoTrader) executeOpenShortWithRecord(decision *decision.Decision, ac
 		}
 	}
 
+	// 滑点检查（放在平反向仓位之前，避免平仓后因滑点拒绝开仓）
+	if err := at.checkSlippage(decision.Symbol, market.SideSell, decision.PositionSizeUSD); err != nil {
+		return err
+	}
+
+	// 单向持仓模式下反向开仓：先平掉反向仓位
+	if err := at.closeOppositeBeforeOpen(decision.Symbol, "short", positions); err != nil {
+		return err
+	}
+
 	// 获取当前价格
-	marketData, err := market.Get(decision.Symbol)
+	marketData, err := getMarketData(decision.Symbol, at.marketDataConfig)
 	if err != nil {
 		return err
 	}
@@ -789,8 +1267,11 @@ func (at *AutoTrader) executeOpenShortWithRecord(decision *decision.Decision, ac
 		// 继续执行，不影响交易
 	}
 
-	// 开仓
-	order, err := at.trader.OpenShort(decision.Symbol, quantity, decision.Leverage)
+	// 开仓（使用确定性客户端订单ID，状态不明时先查询再重试）
+	if actionRecord.ClientOrderID == "" {
+		actionRecord.ClientOrderID = BuildClientOrderID(at.id, at.startTime, at.callCount, 0)
+	}
+	order, err := at.placeOpenOrderWithRetry("short", decision.Symbol, quantity, decision.Leverage, actionRecord.ClientOrderID)
 	if err != nil {
 		return err
 	}
@@ -802,9 +1283,10 @@ func (at *AutoTrader) executeOpenShortWithRecord(decision *decision.Decision, ac
 
 	log.Printf("  ✓ 开仓成功，订单ID: %v, 数量: %.4f", order["orderId"], quantity)
 
-	// 记录开仓时间
+	// 记录开仓时间和止损止盈价
 	posKey := decision.Symbol + "_short"
 	at.positionFirstSeenTime[posKey] = time.Now().UnixMilli()
+	at.trackOpenedPosition(decision, "short", quantity, actionRecord.Price)
 
 	// 设置止损止盈
 	if err := at.trader.SetStopLoss(decision.Symbol, "SHORT", quantity, decision.StopLoss); err != nil {
@@ -817,12 +1299,58 @@ func (at *AutoTrader) executeOpenShortWithRecord(decision *decision.Decision, ac
 	return nil
 }
 
+// placeOpenOrderWithRetry 使用客户端订单ID下开仓单，并在状态不明时安全重试
+// 超时/断连等错误无法确定订单是否已到达交易所，直接重试可能导致仓位翻倍，
+// 因此先按客户端订单ID查询：已存在则视为下单成功，确认不存在（或已取消且无成交）才重试
+func (at *AutoTrader) placeOpenOrderWithRetry(side, symbol string, quantity float64, leverage int, clientOrderID string) (map[string]interface{}, error) {
+	var lastErr error
+	for attempt := 1; attempt <= maxOpenOrderAttempts; attempt++ {
+		var order map[string]interface{}
+		var err error
+		if side == "long" {
+			order, err = at.trader.OpenLongWithClientID(symbol, quantity, leverage, clientOrderID)
+		} else {
+			order, err = at.trader.OpenShortWithClientID(symbol, quantity, leverage, clientOrderID)
+		}
+		if err == nil {
+			return order, nil
+		}
+		lastErr = err
+
+		// 明确的失败（余额不足、参数错误等）不重试
+		if !isAmbiguousOrderError(err) {
+			return nil, err
+		}
+
+		log.Printf("  ⚠️ 下单状态不明 (第%d次, clientOrderId=%s): %v，查询订单确认...", attempt, clientOrderID, err)
+		existing, lookupErr := at.trader.GetOrderByClientID(symbol, clientOrderID)
+		switch {
+		case lookupErr == nil && !isOrderDead(existing):
+			log.Printf("  ✓ 订单已到达交易所 (状态: %v)，不再重复下单", existing["status"])
+			return existing, nil
+		case lookupErr == nil:
+			log.Printf("  ℹ 订单已失效且无成交 (状态: %v)，准备重试", existing["status"])
+		case errors.Is(lookupErr, ErrOrderNotFound):
+			log.Printf("  ℹ 交易所中没有该订单，准备重试")
+		default:
+			// 无法确认订单状态时宁可放弃本次开仓，也不冒重复开仓的风险
+			return nil, fmt.Errorf("下单状态不明且无法查询订单 (clientOrderId=%s): %v (查询错误: %w)", clientOrderID, err, lookupErr)
+		}
+
+		if attempt < maxOpenOrderAttempts {
+			time.Sleep(time.Duration(attempt) * openOrderRetryDelay)
+		}
+	}
+
+	return nil, fmt.Errorf("开仓失败（已重试%d次）: %w", maxOpenOrderAttempts, lastErr)
+}
+
 // executeCloseLongWithRecord 执行平多仓并记录详细信息
 func (at *AutoTrader) executeCloseLongWithRecord(decision *decision.Decision, actionRecord *logger.DecisionAction) error {
 	log.Printf("  🔄 平多仓: %s", decision.Symbol)
 
 	// 获取当前价格
-	marketData, err := market.Get(decision.Symbol)
+	marketData, err := getMarketData(decision.Symbol, at.marketDataConfig)
 	if err != nil {
 		return err
 	}
@@ -833,6 +1361,8 @@ func (at *AutoTrader) executeCloseLongWithRecord(decision *decision.Decision, ac
 	if err != nil {
 		return err
 	}
+	// AI主动平仓，不计入交易所自动平仓
+	delete(at.lastPositions, decision.Symbol+"_long")
 
 	// 记录订单ID
 	if orderID, ok := order["orderId"].(int64); ok {
@@ -848,7 +1378,7 @@ func (at *AutoTrader) executeCloseShortWithRecord(decision *decision.Decision, a
 	log.Printf("  🔄 平空仓: %s", decision.Symbol)
 
 	// 获取当前价格
-	marketData, err := market.Get(decision.Symbol)
+	marketData, err := getMarketData(decision.Symbol, at.marketDataConfig)
 	if err != nil {
 		return err
 	}
@@ -859,6 +1389,8 @@ func (at *AutoTrader) executeCloseShortWithRecord(decision *decision.Decision, a
 	if err != nil {
 		return err
 	}
+	// AI主动平仓，不计入交易所自动平仓
+	delete(at.lastPositions, decision.Symbol+"_short")
 
 	// 记录订单ID
 	if orderID, ok := order["orderId"].(int64); ok {
@@ -874,7 +1406,7 @@ func (at *AutoTrader) executeUpdateStopLossWithRecord(decision *decision.Decisio
 	log.Printf("  🎯 调整止损: %s → %.2f", decision.Symbol, decision.NewStopLoss)
 
 	// 获取当前价格
-	marketData, err := market.Get(decision.Symbol)
+	marketData, err := getMarketData(decision.Symbol, at.marketDataConfig)
 	if err != nil {
 		return err
 	}
@@ -948,6 +1480,10 @@ func (at *AutoTrader) executeUpdateStopLossWithRecord(decision *decision.Decisio
 	if err != nil {
 		return fmt.Errorf("修改止损失败: %w", err)
 	}
+	posKey := decision.Symbol + "_" + strings.ToLower(positionSide)
+	levels := at.exitLevels[posKey]
+	levels.StopLoss = decision.NewStopLoss
+	at.exitLevels[posKey] = levels
 
 	log.Printf("  ✓ 止损已调整: %.2f (当前价格: %.2f)", decision.NewStopLoss, marketData.CurrentPrice)
 	return nil
@@ -958,7 +1494,7 @@ func (at *AutoTrader) executeUpdateTakeProfitWithRecord(decision *decision.Decis
 	log.Printf("  🎯 调整止盈: %s → %.2f", decision.Symbol, decision.NewTakeProfit)
 
 	// 获取当前价格
-	marketData, err := market.Get(decision.Symbol)
+	marketData, err := getMarketData(decision.Symbol, at.marketDataConfig)
 	if err != nil {
 		return err
 	}
@@ -1032,6 +1568,10 @@ func (at *AutoTrader) executeUpdateTakeProfitWithRecord(decision *decision.Decis
 	if err != nil {
 		return fmt.Errorf("修改止盈失败: %w", err)
 	}
+	posKey := decision.Symbol + "_" + strings.ToLower(positionSide)
+	levels := at.exitLevels[posKey]
+	levels.TakeProfit = decision.NewTakeProfit
+	at.exitLevels[posKey] = levels
 
 	log.Printf("  ✓ 止盈已调整: %.2f (当前价格: %.2f)", decision.NewTakeProfit, marketData.CurrentPrice)
 	return nil
@@ -1047,7 +1587,7 @@ func (at *AutoTrader) executePartialCloseWithRecord(decision *decision.Decision,
 	}
 
 	// 获取当前价格
-	marketData, err := market.Get(decision.Symbol)
+	marketData, err := getMarketData(decision.Symbol, at.marketDataConfig)
 	if err != nil {
 		return err
 	}
@@ -1154,6 +1694,9 @@ func (at *AutoTrader) executePartialCloseWithRecord(decision *decision.Decision,
 		}
 	}
 
+	// 原有止盈止损已被交易所取消，只保留重新设置的价格
+	at.exitLevels[decision.Symbol+"_"+strings.ToLower(positionSide)] = positionExit{StopLoss: decision.NewStopLoss, TakeProfit: decision.NewTakeProfit}
+
 	// 如果 AI 没有提供新的止盈止损，记录警告
 	if decision.NewStopLoss <= 0 && decision.NewTakeProfit <= 0 {
 		log.Printf("  ⚠️⚠️⚠️ 警告: 部分平仓后AI未提供新的止盈止损价格")
@@ -1196,14 +1739,41 @@ func (at *AutoTrader) SetOverrideBasePrompt(override bool) {
 
 // SetSystemPromptTemplate 设置系统提示词模板
 func (at *AutoTrader) SetSystemPromptTemplate(templateName string) {
+	at.promptMutex.Lock()
+	defer at.promptMutex.Unlock()
 	at.systemPromptTemplate = templateName
 }
 
 // GetSystemPromptTemplate 获取当前系统提示词模板名称
 func (at *AutoTrader) GetSystemPromptTemplate() string {
+	at.promptMutex.RLock()
+	defer at.promptMutex.RUnlock()
 	return at.systemPromptTemplate
 }
 
+// SetSystemPrompt 同时设置系统提示词模板和固定的用户模板版本（<=0 使用最新版本）
+// A/B实验切换分组时使用，保证运行中的周期不会读到新模板配旧版本
+func (at *AutoTrader) SetSystemPrompt(templateName string, version int) {
+	at.promptMutex.Lock()
+	defer at.promptMutex.Unlock()
+	at.systemPromptTemplate = templateName
+	at.systemPromptVersion = version
+}
+
+// GetSystemPromptVersion 获取固定的用户模板版本（0为最新）
+func (at *AutoTrader) GetSystemPromptVersion() int {
+	at.promptMutex.RLock()
+	defer at.promptMutex.RUnlock()
+	return at.systemPromptVersion
+}
+
+// systemPrompt 获取系统提示词模板和固定版本的快照
+func (at *AutoTrader) systemPrompt() (string, int) {
+	at.promptMutex.RLock()
+	defer at.promptMutex.RUnlock()
+	return at.systemPromptTemplate, at.systemPromptVersion
+}
+
 // GetDecisionLogger 获取决策日志记录器
 func (at *AutoTrader) GetDecisionLogger() *logger.DecisionLogger {
 	return at.decisionLogger
@@ -1477,17 +2047,68 @@ func (at *AutoTrader) getCandidateCoins() ([]decision.CandidateCoin, error) {
 	}
 }
 
-// normalizeSymbol 标准化币种符号（确保以USDT结尾）
+// normalizeSymbol 标准化币种符号（未带计价资产时补全为USDT交易对）
 func normalizeSymbol(symbol string) string {
-	// 转为大写
-	symbol = strings.ToUpper(strings.TrimSpace(symbol))
+	return market.Normalize(symbol)
+}
+
+// getInstrumentSet 获取交易所可交易品种（带缓存，返回nil表示不校验）
+func (at *AutoTrader) getInstrumentSet() *market.InstrumentSet {
+	at.instrumentsMutex.Lock()
+	defer at.instrumentsMutex.Unlock()
+
+	if at.instruments != nil && time.Since(at.instrumentsLoadedAt) < instrumentCacheTTL {
+		return at.instruments
+	}
+
+	instruments, err := at.trader.GetInstruments()
+	if err != nil {
+		// 获取失败时继续使用旧缓存（可能为nil）
+		log.Printf("⚠️  [%s] 获取交易品种列表失败: %v", at.name, err)
+		return at.instruments
+	}
+	if len(instruments) == 0 {
+		return nil
+	}
+
+	at.instruments = market.NewInstrumentSet(at.exchange, instruments)
+	at.instrumentsLoadedAt = time.Now()
+	log.Printf("📋 [%s] 已加载 %s 可交易品种: %d个", at.name, at.exchange, at.instruments.Len())
+	return at.instruments
+}
+
+// resolveSymbol 将交易对解析为当前交易所的规范符号
+func (at *AutoTrader) resolveSymbol(symbol string) (string, error) {
+	set := at.getInstrumentSet()
+	if set == nil {
+		return market.NormalizeSymbol(symbol, market.DefaultQuote(at.exchange)), nil
+	}
 
-	// 确保以USDT结尾
-	if !strings.HasSuffix(symbol, "USDT") {
-		symbol = symbol + "USDT"
+	inst, err := set.Resolve(symbol)
+	if err != nil {
+		return "", err
 	}
+	return inst.Symbol(), nil
+}
 
-	return symbol
+// filterTradableCoins 将候选币种映射为交易所真实品种，并过滤掉交易所不支持的币种
+func (at *AutoTrader) filterTradableCoins(coins []decision.CandidateCoin) []decision.CandidateCoin {
+	seen := make(map[string]bool, len(coins))
+	result := make([]decision.CandidateCoin, 0, len(coins))
+	for _, coin := range coins {
+		symbol, err := at.resolveSymbol(coin.Symbol)
+		if err != nil {
+			log.Printf("⚠️  [%s] 跳过候选币种: %v", at.name, err)
+			continue
+		}
+		if seen[symbol] {
+			continue
+		}
+		seen[symbol] = true
+		coin.Symbol = symbol
+		result = append(result, coin)
+	}
+	return result
 }
 
 // 启动回撤监控
@@ -7,6 +7,7 @@ import (
 	"testing"
 	"time"
 
+	"nofx/config"
 	"nofx/decision"
 	"nofx/logger"
 	"nofx/market"
@@ -103,6 +104,8 @@ func (s *AutoTraderTestSuite) SetupTest() {
 		callCount:             0,
 		isRunning:             false,
 		positionFirstSeenTime: make(map[string]int64),
+		lastPositions:         make(map[string]decision.PositionInfo),
+		exitLevels:            make(map[string]positionExit),
 		stopMonitorCh:         make(chan struct{}),
 		peakPnLCache:          make(map[string]float64),
 		lastBalanceSyncTime:   time.Now(),
@@ -210,6 +213,14 @@ func (s *AutoTraderTestSuite) TestGettersAndSetters() {
 		s.Equal("aggressive", s.autoTrader.GetSystemPromptTemplate())
 	})
 
+	s.Run("SetSystemPrompt", func() {
+		s.autoTrader.SetSystemPrompt("trend", 3)
+		name, version := s.autoTrader.systemPrompt()
+		s.Equal("trend", name)
+		s.Equal(3, version)
+		s.Equal(3, s.autoTrader.GetSystemPromptVersion())
+	})
+
 	s.Run("SetCustomPrompt", func() {
 		s.autoTrader.SetCustomPrompt("custom prompt")
 		s.Equal("custom prompt", s.autoTrader.customPrompt)
@@ -383,8 +394,8 @@ func (s *AutoTraderTestSuite) TestGetCandidateCoins() {
 // ============================================================
 
 func (s *AutoTraderTestSuite) TestBuildTradingContext() {
-	// Mock market.Get
-	s.patches.ApplyFunc(market.Get, func(symbol string) (*market.Data, error) {
+	// Mock getMarketData
+	s.patches.ApplyGlobalVar(&getMarketData, func(symbol string, cfg *market.DataConfig) (*market.Data, error) {
 		return &market.Data{Symbol: symbol, CurrentPrice: 50000.0}, nil
 	})
 
@@ -476,7 +487,7 @@ func (s *AutoTraderTestSuite) TestExecuteOpenPosition() {
 	for _, tt := range tests {
 		time.Sleep(time.Millisecond)
 		s.Run(tt.name, func() {
-			s.patches.ApplyFunc(market.Get, func(symbol string) (*market.Data, error) {
+			s.patches.ApplyGlobalVar(&getMarketData, func(symbol string, cfg *market.DataConfig) (*market.Data, error) {
 				return &market.Data{Symbol: symbol, CurrentPrice: 50000.0}, nil
 			})
 
@@ -509,6 +520,285 @@ func (s *AutoTraderTestSuite) TestExecuteOpenPosition() {
 	}
 }
 
+// TestExecuteOpenPositionFlip 测试反向开仓：单向持仓先平掉反向仓位，双向持仓直接开仓
+func (s *AutoTraderTestSuite) TestExecuteOpenPositionFlip() {
+	tests := []struct {
+		name          string
+		positionMode  string
+		action        string
+		existingSide  string
+		failClose     bool
+		expectedClose []string
+		expectedErr   string
+	}{
+		{
+			name:          "单向持仓_空翻多",
+			positionMode:  PositionModeOneWay,
+			action:        "open_long",
+			existingSide:  "short",
+			expectedClose: []string{"short"},
+		},
+		{
+			name:          "单向持仓_多翻空",
+			positionMode:  PositionModeOneWay,
+			action:        "open_short",
+			existingSide:  "long",
+			expectedClose: []string{"long"},
+		},
+		{
+			name:         "单向持仓_平仓失败则不开仓",
+			positionMode: PositionModeOneWay,
+			action:       "open_long",
+			existingSide: "short",
+			failClose:    true,
+			expectedErr:  "平掉反向仓位失败",
+		},
+		{
+			name:         "双向持仓_保留反向仓位",
+			positionMode: PositionModeHedge,
+			action:       "open_long",
+			existingSide: "short",
+		},
+	}
+
+	for _, tt := range tests {
+		s.Run(tt.name, func() {
+			s.patches.ApplyGlobalVar(&getMarketData, func(symbol string, cfg *market.DataConfig) (*market.Data, error) {
+				return &market.Data{Symbol: symbol, CurrentPrice: 50000.0}, nil
+			})
+
+			s.mockTrader.positionMode = tt.positionMode
+			s.mockTrader.positions = []map[string]interface{}{{"symbol": "BTCUSDT", "side": tt.existingSide}}
+			s.mockTrader.shouldFailCloseShort = tt.failClose
+			s.mockTrader.closeCalls = nil
+			s.mockTrader.openCalls = 0
+			oppositeKey := "BTCUSDT_" + tt.existingSide
+			s.autoTrader.positionFirstSeenTime[oppositeKey] = 1
+
+			d := &decision.Decision{Action: tt.action, Symbol: "BTCUSDT", PositionSizeUSD: 1000.0, Leverage: 10}
+			actionRecord := &logger.DecisionAction{Action: tt.action, Symbol: "BTCUSDT"}
+
+			var err error
+			if tt.action == "open_long" {
+				err = s.autoTrader.executeOpenLongWithRecord(d, actionRecord)
+			} else {
+				err = s.autoTrader.executeOpenShortWithRecord(d, actionRecord)
+			}
+
+			s.Equal(tt.expectedClose, s.mockTrader.closeCalls)
+			if tt.expectedErr != "" {
+				s.Error(err)
+				s.Contains(err.Error(), tt.expectedErr)
+				s.Equal(0, s.mockTrader.openCalls, "平仓失败时不应开仓")
+			} else {
+				s.NoError(err)
+				s.Equal(1, s.mockTrader.openCalls)
+				_, kept := s.autoTrader.positionFirstSeenTime[oppositeKey]
+				s.Equal(tt.expectedClose == nil, kept, "反向仓位平掉后应清除其开仓时间记录")
+			}
+
+			// 恢复默认状态
+			s.mockTrader.positionMode = ""
+			s.mockTrader.positions = []map[string]interface{}{}
+			s.mockTrader.shouldFailCloseShort = false
+			s.mockTrader.closeCalls = nil
+			delete(s.autoTrader.positionFirstSeenTime, oppositeKey)
+		})
+	}
+}
+
+// stubOrderBookSource 只提供订单簿的行情数据源（注入交易员的数据源，其余方法不应被调用）
+type stubOrderBookSource struct {
+	market.MarketDataSource
+	book *market.OrderBook
+}
+
+func (s stubOrderBookSource) Name() string { return "stub" }
+
+func (s stubOrderBookSource) OrderBook(symbol string) (*market.OrderBook, error) { return s.book, nil }
+
+// TestExecuteOpenPositionSlippage 测试按订单簿估算滑点拒绝开仓
+func (s *AutoTraderTestSuite) TestExecuteOpenPositionSlippage() {
+	// 每档 0.1% 间隔、每档约 1000 USDT 的订单簿
+	book := &market.OrderBook{Symbol: "BTCUSDT"}
+	for i := 0; i < 20; i++ {
+		book.Bids = append(book.Bids, market.OrderBookLevel{Price: 49975 - float64(i)*50, Quantity: 0.02})
+		book.Asks = append(book.Asks, market.OrderBookLevel{Price: 50025 + float64(i)*50, Quantity: 0.02})
+	}
+
+	// 交易员所在交易所的订单簿很薄，不能用币安的深度估算
+	venueBook := &market.OrderBook{
+		Symbol: "BTCUSDC",
+		Bids:   []market.OrderBookLevel{{Price: 49975, Quantity: 0.001}},
+		Asks:   []market.OrderBookLevel{{Price: 50025, Quantity: 0.001}},
+	}
+
+	tests := []struct {
+		name        string
+		action      string
+		maxSlippage float64
+		sizeUSD     float64
+		venue       bool // 使用订单簿很薄的交易所数据源
+		expectedErr string
+	}{
+		{name: "滑点在上限内", action: "open_long", maxSlippage: 0.5, sizeUSD: 1000},
+		{name: "开多滑点超限", action: "open_long", maxSlippage: 0.1, sizeUSD: 5000, expectedErr: "超过上限"},
+		{name: "开空滑点超限", action: "open_short", maxSlippage: 0.1, sizeUSD: 5000, expectedErr: "超过上限"},
+		{name: "超过可见深度", action: "open_long", maxSlippage: 5, sizeUSD: 100000, expectedErr: "可见深度不足"},
+		{name: "未配置上限不检查", action: "open_long", maxSlippage: 0, sizeUSD: 100000},
+		{name: "使用交易所自己的订单簿", action: "open_long", maxSlippage: 5, sizeUSD: 1000, venue: true, expectedErr: "可见深度不足"},
+	}
+
+	for _, tt := range tests {
+		s.Run(tt.name, func() {
+			s.patches.ApplyGlobalVar(&getMarketData, func(symbol string, cfg *market.DataConfig) (*market.Data, error) {
+				return &market.Data{Symbol: symbol, CurrentPrice: 50000.0}, nil
+			})
+			s.autoTrader.config.MaxSlippagePct = tt.maxSlippage
+			originalConfig := s.autoTrader.marketDataConfig
+			s.autoTrader.marketDataConfig = &market.DataConfig{Source: stubOrderBookSource{book: book}}
+			if tt.venue {
+				s.autoTrader.marketDataConfig = &market.DataConfig{Source: stubOrderBookSource{book: venueBook}}
+			}
+			s.mockTrader.balance["availableBalance"] = 1000000.0
+			s.mockTrader.openCalls = 0
+
+			d := &decision.Decision{Action: tt.action, Symbol: "BTCUSDT", PositionSizeUSD: tt.sizeUSD, Leverage: 10}
+			actionRecord := &logger.DecisionAction{Action: tt.action, Symbol: "BTCUSDT"}
+
+			var err error
+			if tt.action == "open_long" {
+				err = s.autoTrader.executeOpenLongWithRecord(d, actionRecord)
+			} else {
+				err = s.autoTrader.executeOpenShortWithRecord(d, actionRecord)
+			}
+
+			if tt.expectedErr != "" {
+				s.Error(err)
+				s.Contains(err.Error(), tt.expectedErr)
+				s.Equal(0, s.mockTrader.openCalls, "滑点超限时不应下单")
+			} else {
+				s.NoError(err)
+				s.Equal(1, s.mockTrader.openCalls)
+			}
+
+			// 恢复默认状态
+			s.autoTrader.config.MaxSlippagePct = 0
+			s.autoTrader.marketDataConfig = originalConfig
+			s.mockTrader.balance["availableBalance"] = 8000.0
+			s.mockTrader.positions = []map[string]interface{}{}
+		})
+	}
+}
+
+// TestShouldRunOnAlert 测试市场警报只对关注币种触发（最小间隔见 TestTriggerScheduler）
+func (s *AutoTraderTestSuite) TestShouldRunOnAlert() {
+	s.autoTrader.updateWatchedSymbols(
+		[]decision.PositionInfo{{Symbol: "ETHUSDC"}},
+		[]decision.CandidateCoin{{Symbol: "BTCUSDT"}},
+	)
+
+	s.True(s.autoTrader.shouldRunOnAlert(market.Alert{Symbol: "BTCUSDT"}))
+	s.True(s.autoTrader.shouldRunOnAlert(market.Alert{Symbol: "ETHUSDT"}), "USDC持仓应按USDT行情交易对匹配")
+	s.False(s.autoTrader.shouldRunOnAlert(market.Alert{Symbol: "SOLUSDT"}), "未关注的币种不应触发")
+}
+
+// TestExecuteOpenPositionRetry 测试开仓状态不明时的幂等重试
+func (s *AutoTraderTestSuite) TestExecuteOpenPositionRetry() {
+	originalDelay := openOrderRetryDelay
+	openOrderRetryDelay = 0
+	defer func() { openOrderRetryDelay = originalDelay }()
+
+	timeoutErr := errors.New("Post \"https://fapi.binance.com/fapi/v1/order\": context deadline exceeded (Client.Timeout exceeded)")
+
+	tests := []struct {
+		name           string
+		openErrors     []error
+		ordersByClient map[string]map[string]interface{}
+		lookupErr      error
+		expectedCalls  int
+		expectedOrder  int64
+		expectedErr    string
+	}{
+		{
+			name:          "超时后订单不存在_重试成功",
+			openErrors:    []error{timeoutErr},
+			expectedCalls: 2,
+			expectedOrder: 123456,
+		},
+		{
+			name:       "超时后订单已成交_不重复下单",
+			openErrors: []error{timeoutErr},
+			ordersByClient: map[string]map[string]interface{}{
+				"fixed-id": {"orderId": int64(999), "status": "FILLED", "executedQty": 0.02},
+			},
+			expectedCalls: 1,
+			expectedOrder: 999,
+		},
+		{
+			name:       "超时后订单已取消且无成交_重试",
+			openErrors: []error{timeoutErr},
+			ordersByClient: map[string]map[string]interface{}{
+				"fixed-id": {"orderId": int64(999), "status": "EXPIRED", "executedQty": 0.0},
+			},
+			expectedCalls: 2,
+			expectedOrder: 123456,
+		},
+		{
+			name:          "超时且无法查询订单_放弃开仓",
+			openErrors:    []error{timeoutErr},
+			lookupErr:     errors.New("connection refused"),
+			expectedCalls: 1,
+			expectedErr:   "下单状态不明",
+		},
+		{
+			name:          "明确失败_不重试",
+			openErrors:    []error{errors.New("<APIError> code=-2019, msg=Margin is insufficient.")},
+			expectedCalls: 1,
+			expectedErr:   "Margin is insufficient",
+		},
+		{
+			name:          "持续超时_达到重试上限",
+			openErrors:    []error{timeoutErr, timeoutErr, timeoutErr},
+			expectedCalls: maxOpenOrderAttempts,
+			expectedErr:   "已重试",
+		},
+	}
+
+	for _, tt := range tests {
+		s.Run(tt.name, func() {
+			s.patches.ApplyGlobalVar(&getMarketData, func(symbol string, cfg *market.DataConfig) (*market.Data, error) {
+				return &market.Data{Symbol: symbol, CurrentPrice: 50000.0}, nil
+			})
+
+			s.mockTrader.openErrors = tt.openErrors
+			s.mockTrader.ordersByClient = tt.ordersByClient
+			s.mockTrader.lookupErr = tt.lookupErr
+			s.mockTrader.openCalls = 0
+
+			d := &decision.Decision{Action: "open_long", Symbol: "BTCUSDT", PositionSizeUSD: 1000.0, Leverage: 10}
+			actionRecord := &logger.DecisionAction{Action: "open_long", Symbol: "BTCUSDT", ClientOrderID: "fixed-id"}
+
+			err := s.autoTrader.executeOpenLongWithRecord(d, actionRecord)
+
+			s.Equal(tt.expectedCalls, s.mockTrader.openCalls)
+			s.Equal("fixed-id", s.mockTrader.lastClientID, "重试必须复用同一个客户端订单ID")
+			if tt.expectedErr != "" {
+				s.Error(err)
+				s.Contains(err.Error(), tt.expectedErr)
+			} else {
+				s.NoError(err)
+				s.Equal(tt.expectedOrder, actionRecord.OrderID)
+			}
+
+			// 恢复默认状态
+			s.mockTrader.openErrors = nil
+			s.mockTrader.ordersByClient = nil
+			s.mockTrader.lookupErr = nil
+		})
+	}
+}
+
 // TestExecuteClosePosition 测试平仓操作（多空通用）
 func (s *AutoTraderTestSuite) TestExecuteClosePosition() {
 	tests := []struct {
@@ -541,7 +831,7 @@ func (s *AutoTraderTestSuite) TestExecuteClosePosition() {
 	for _, tt := range tests {
 		time.Sleep(time.Millisecond)
 		s.Run(tt.name, func() {
-			s.patches.ApplyFunc(market.Get, func(symbol string) (*market.Data, error) {
+			s.patches.ApplyGlobalVar(&getMarketData, func(symbol string, cfg *market.DataConfig) (*market.Data, error) {
 				return &market.Data{Symbol: symbol, CurrentPrice: tt.currentPrice}, nil
 			})
 
@@ -559,9 +849,9 @@ func (s *AutoTraderTestSuite) TestExecuteClosePosition() {
 
 // TestExecuteUpdateStopOrTakeProfit 测试更新止损/止盈（多空通用）
 func (s *AutoTraderTestSuite) TestExecuteUpdateStopOrTakeProfit() {
-	// 使用指针变量来控制 market.Get 的返回值
+	// 使用指针变量来控制 getMarketData 的返回值
 	var testPrice *float64
-	s.patches.ApplyFunc(market.Get, func(symbol string) (*market.Data, error) {
+	s.patches.ApplyGlobalVar(&getMarketData, func(symbol string, cfg *market.DataConfig) (*market.Data, error) {
 		price := 50000.0
 		if testPrice != nil {
 			price = *testPrice
@@ -731,8 +1021,8 @@ func (s *AutoTraderTestSuite) TestExecutePartialCloseWithRecord() {
 			},
 		}
 
-		// Mock market.Get
-		s.patches.ApplyFunc(market.Get, func(symbol string) (*market.Data, error) {
+		// Mock getMarketData
+		s.patches.ApplyGlobalVar(&getMarketData, func(symbol string, cfg *market.DataConfig) (*market.Data, error) {
 			return &market.Data{
 				Symbol:       symbol,
 				CurrentPrice: 52000.0,
@@ -777,8 +1067,8 @@ func (s *AutoTraderTestSuite) TestExecutePartialCloseWithRecord() {
 // ============================================================
 
 func (s *AutoTraderTestSuite) TestExecuteDecisionWithRecord() {
-	// Mock market.Get
-	s.patches.ApplyFunc(market.Get, func(symbol string) (*market.Data, error) {
+	// Mock getMarketData
+	s.patches.ApplyGlobalVar(&getMarketData, func(symbol string, cfg *market.DataConfig) (*market.Data, error) {
 		return &market.Data{
 			Symbol:       symbol,
 			CurrentPrice: 50000.0,
@@ -983,6 +1273,20 @@ type MockTrader struct {
 	shouldFailOpenLong   bool
 	shouldFailCloseLong  bool
 	shouldFailCloseShort bool
+
+	// 幂等下单测试用
+	openErrors     []error                           // 依次返回的开仓错误（用完后开仓成功）
+	openCalls      int                               // 开仓调用次数
+	lastClientID   string                            // 最近一次开仓使用的客户端订单ID
+	ordersByClient map[string]map[string]interface{} // 模拟交易所中已存在的订单
+	lookupErr      error                             // GetOrderByClientID 返回的错误
+
+	// 持仓模式测试用
+	positionMode string   // 持仓模式（空值为双向持仓）
+	closeCalls   []string // 平仓调用记录（"long" / "short"）
+
+	// 交易品种测试用（nil表示不校验）
+	instruments []market.Instrument
 }
 
 func (m *MockTrader) GetBalance() (map[string]interface{}, error) {
@@ -1010,26 +1314,63 @@ func (m *MockTrader) GetPositions() ([]map[string]interface{}, error) {
 }
 
 func (m *MockTrader) OpenLong(symbol string, quantity float64, leverage int) (map[string]interface{}, error) {
+	return m.OpenLongWithClientID(symbol, quantity, leverage, "")
+}
+
+func (m *MockTrader) OpenShort(symbol string, quantity float64, leverage int) (map[string]interface{}, error) {
+	return m.OpenShortWithClientID(symbol, quantity, leverage, "")
+}
+
+func (m *MockTrader) OpenLongWithClientID(symbol string, quantity float64, leverage int, clientOrderID string) (map[string]interface{}, error) {
 	if m.shouldFailOpenLong {
 		return nil, errors.New("failed to open long")
 	}
+	if err := m.nextOpenError(clientOrderID); err != nil {
+		return nil, err
+	}
 	return map[string]interface{}{
 		"orderId": int64(123456),
 		"symbol":  symbol,
 	}, nil
 }
 
-func (m *MockTrader) OpenShort(symbol string, quantity float64, leverage int) (map[string]interface{}, error) {
+func (m *MockTrader) OpenShortWithClientID(symbol string, quantity float64, leverage int, clientOrderID string) (map[string]interface{}, error) {
+	if err := m.nextOpenError(clientOrderID); err != nil {
+		return nil, err
+	}
 	return map[string]interface{}{
 		"orderId": int64(123457),
 		"symbol":  symbol,
 	}, nil
 }
 
+// nextOpenError 记录开仓调用并返回预设的错误（按顺序消费）
+func (m *MockTrader) nextOpenError(clientOrderID string) error {
+	m.openCalls++
+	m.lastClientID = clientOrderID
+	if len(m.openErrors) == 0 {
+		return nil
+	}
+	err := m.openErrors[0]
+	m.openErrors = m.openErrors[1:]
+	return err
+}
+
+func (m *MockTrader) GetOrderByClientID(symbol string, clientOrderID string) (map[string]interface{}, error) {
+	if m.lookupErr != nil {
+		return nil, m.lookupErr
+	}
+	if order, ok := m.ordersByClient[clientOrderID]; ok {
+		return order, nil
+	}
+	return nil, ErrOrderNotFound
+}
+
 func (m *MockTrader) CloseLong(symbol string, quantity float64) (map[string]interface{}, error) {
 	if m.shouldFailCloseLong {
 		return nil, errors.New("failed to close long")
 	}
+	m.closeCalls = append(m.closeCalls, "long")
 	return map[string]interface{}{
 		"orderId": int64(123458),
 		"symbol":  symbol,
@@ -1040,6 +1381,7 @@ func (m *MockTrader) CloseShort(symbol string, quantity float64) (map[string]int
 	if m.shouldFailCloseShort {
 		return nil, errors.New("failed to close short")
 	}
+	m.closeCalls = append(m.closeCalls, "short")
 	return map[string]interface{}{
 		"orderId": int64(123459),
 		"symbol":  symbol,
@@ -1054,6 +1396,17 @@ func (m *MockTrader) SetMarginMode(symbol string, isCrossMargin bool) error {
 	return nil
 }
 
+func (m *MockTrader) GetPositionMode() string {
+	if m.positionMode == "" {
+		return PositionModeHedge
+	}
+	return m.positionMode
+}
+
+func (m *MockTrader) GetInstruments() ([]market.Instrument, error) {
+	return m.instruments, nil
+}
+
 func (m *MockTrader) GetMarketPrice(symbol string) (float64, error) {
 	return 50000.0, nil
 }
@@ -1210,3 +1563,47 @@ func TestCalculatePnLPercentage_RealWorldScenarios(t *testing.T) {
 		}
 	})
 }
+
+// TestLoadUserPromptTemplates_CachesByVersion 测试用户提示词模板按模板ID和版本缓存，仅新版本重新解析
+func TestLoadUserPromptTemplates_CachesByVersion(t *testing.T) {
+	db, err := config.NewDatabase(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatalf("创建测试数据库失败: %v", err)
+	}
+	defer db.Close()
+	userID := "prompt-user"
+	if err := db.CreateUser(&config.User{ID: userID, Email: userID + "@test.com", PasswordHash: "hash"}); err != nil {
+		t.Fatalf("创建用户失败: %v", err)
+	}
+	if _, err := db.CreatePromptTemplate(userID, "trend", "第一版", ""); err != nil {
+		t.Fatalf("创建模板失败: %v", err)
+	}
+	at := &AutoTrader{name: "test", database: db, userID: userID}
+
+	first, err := at.loadUserPromptTemplates("trend", 0)
+	if err != nil || first["trend"] == nil || first["trend"].Version != 1 {
+		t.Fatalf("首次加载 = %v, %v", first, err)
+	}
+	second, err := at.loadUserPromptTemplates("trend", 0)
+	if err != nil || second["trend"] != first["trend"] {
+		t.Errorf("版本未变化时应复用已解析的模板")
+	}
+
+	if _, err := db.AddPromptTemplateVersion(userID, "trend", "第二版", ""); err != nil {
+		t.Fatalf("保存新版本失败: %v", err)
+	}
+	latest, err := at.loadUserPromptTemplates("trend", 0)
+	if err != nil || latest["trend"].Version != 2 || latest["trend"].Content != "第二版" {
+		t.Errorf("新版本应重新加载: %+v, %v", latest["trend"], err)
+	}
+	pinned, err := at.loadUserPromptTemplates("trend", 1)
+	if err != nil || pinned["trend"].Version != 1 {
+		t.Errorf("固定版本 = %+v, %v", pinned["trend"], err)
+	}
+	if len(at.promptTemplates) != 2 {
+		t.Errorf("缓存应只保留本周期用到的版本, got %d", len(at.promptTemplates))
+	}
+	if _, err := at.loadUserPromptTemplates("trend", 9); err == nil {
+		t.Error("固定版本不存在时应返回错误")
+	}
+}
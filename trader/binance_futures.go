@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"log"
 	"nofx/hook"
+	"nofx/market"
 	"strconv"
 	"strings"
 	"sync"
@@ -15,6 +16,9 @@ import (
 	"github.com/adshao/go-binance/v2/futures"
 )
 
+// leverageSwitchCooldown 切换杠杆后的等待时间（避免冷却期错误，测试中可置0）
+var leverageSwitchCooldown = 5 * time.Second
+
 // getBrOrderID 生成唯一订单ID（合约专用）
 // 格式: x-{BR_ID}{TIMESTAMP}{RANDOM}
 // 合约限制32字符，统一使用此限制以保持一致性
@@ -59,10 +63,14 @@ type FuturesTrader struct {
 
 	// 缓存有效期（15秒）
 	cacheDuration time.Duration
+
+	// 持仓模式（PositionModeHedge / PositionModeOneWay，空值为双向持仓）
+	positionMode string
 }
 
 // NewFuturesTrader 创建合约交易器
-func NewFuturesTrader(apiKey, secretKey string, userId string) *FuturesTrader {
+// positionMode: PositionModeHedge(双向持仓) / PositionModeOneWay(单向持仓)，空值为双向持仓
+func NewFuturesTrader(apiKey, secretKey string, userId string, positionMode string) *FuturesTrader {
 	client := futures.NewClient(apiKey, secretKey)
 
 	hookRes := hook.HookExec[hook.NewBinanceTraderResult](hook.NEW_BINANCE_TRADER, userId, client)
@@ -75,39 +83,74 @@ func NewFuturesTrader(apiKey, secretKey string, userId string) *FuturesTrader {
 	trader := &FuturesTrader{
 		client:        client,
 		cacheDuration: 15 * time.Second, // 15秒缓存
+		positionMode:  NormalizePositionMode("binance", positionMode),
 	}
 
-	// 设置双向持仓模式（Hedge Mode）
-	// 这是必需的，因为代码中使用了 PositionSide (LONG/SHORT)
-	if err := trader.setDualSidePosition(); err != nil {
-		log.Printf("⚠️ 设置双向持仓模式失败: %v (如果已是双向模式则忽略此警告)", err)
+	// 设置持仓模式（双向持仓下单使用 PositionSide LONG/SHORT，单向持仓使用 reduceOnly）
+	if err := trader.setPositionMode(); err != nil {
+		log.Printf("⚠️ 设置持仓模式失败: %v (如果账户已是该模式则忽略此警告)", err)
 	}
 
 	return trader
 }
 
-// setDualSidePosition 设置双向持仓模式（初始化时调用）
-func (t *FuturesTrader) setDualSidePosition() error {
-	// 尝试设置双向持仓模式
+// setPositionMode 按配置设置账户持仓模式（初始化时调用）
+func (t *FuturesTrader) setPositionMode() error {
+	dualSide := !t.isOneWayMode()
+	modeName := "双向持仓模式（Hedge Mode）"
+	if !dualSide {
+		modeName = "单向持仓模式（One-way Mode）"
+	}
+
 	err := t.client.NewChangePositionModeService().
-		DualSide(true). // true = 双向持仓（Hedge Mode）
+		DualSide(dualSide). // true = 双向持仓, false = 单向持仓
 		Do(context.Background())
 
 	if err != nil {
-		// 如果错误信息包含"No need to change"，说明已经是双向持仓模式
+		// 如果错误信息包含"No need to change"，说明账户已是目标模式
 		if strings.Contains(err.Error(), "No need to change position side") {
-			log.Printf("  ✓ 账户已是双向持仓模式（Hedge Mode）")
+			log.Printf("  ✓ 账户已是%s", modeName)
 			return nil
 		}
 		// 其他错误则返回（但在调用方不会中断初始化）
+		// 注意：有持仓或挂单时币安不允许切换持仓模式
 		return err
 	}
 
-	log.Printf("  ✓ 账户已切换为双向持仓模式（Hedge Mode）")
-	log.Printf("  ℹ️  双向持仓模式允许同时持有多单和空单")
+	log.Printf("  ✓ 账户已切换为%s", modeName)
+	if dualSide {
+		log.Printf("  ℹ️  双向持仓模式允许同时持有多单和空单")
+	} else {
+		log.Printf("  ℹ️  单向持仓模式下每个币种只有一个净仓位，反向开仓前需先平仓")
+	}
 	return nil
 }
 
+// GetPositionMode 获取持仓模式
+func (t *FuturesTrader) GetPositionMode() string {
+	if t.isOneWayMode() {
+		return PositionModeOneWay
+	}
+	return PositionModeHedge
+}
+
+func (t *FuturesTrader) isOneWayMode() bool {
+	return t.positionMode == PositionModeOneWay
+}
+
+// withPositionSide 按持仓模式设置订单的持仓方向参数
+// 双向持仓：指定 positionSide (LONG/SHORT)
+// 单向持仓：不传 positionSide，减仓订单（平仓、止盈止损）使用 reduceOnly
+func (t *FuturesTrader) withPositionSide(svc *futures.CreateOrderService, posSide futures.PositionSideType, reduceOnly bool) *futures.CreateOrderService {
+	if !t.isOneWayMode() {
+		return svc.PositionSide(posSide)
+	}
+	if reduceOnly {
+		return svc.ReduceOnly(true)
+	}
+	return svc
+}
+
 // syncBinanceServerTime 同步币安服务器时间，确保请求时间戳合法
 func syncBinanceServerTime(client *futures.Client) {
 	serverTime, err := client.NewServerTimeService().Do(context.Background())
@@ -215,6 +258,17 @@ func (t *FuturesTrader) GetPositions() ([]map[string]interface{}, error) {
 	return result, nil
 }
 
+// invalidateCache 清除余额和持仓缓存（平仓后调用，避免随后的开仓读到平仓前的持仓和可用余额）
+func (t *FuturesTrader) invalidateCache() {
+	t.balanceCacheMutex.Lock()
+	t.cachedBalance = nil
+	t.balanceCacheMutex.Unlock()
+
+	t.positionsCacheMutex.Lock()
+	t.cachedPositions = nil
+	t.positionsCacheMutex.Unlock()
+}
+
 // SetMarginMode 设置仓位模式
 func (t *FuturesTrader) SetMarginMode(symbol string, isCrossMargin bool) error {
 	var marginType futures.MarginType
@@ -305,15 +359,22 @@ func (t *FuturesTrader) SetLeverage(symbol string, leverage int) error {
 
 	log.Printf("  ✓ %s 杠杆已切换为 %dx", symbol, leverage)
 
-	// 切换杠杆后等待5秒（避免冷却期错误）
-	log.Printf("  ⏱ 等待5秒冷却期...")
-	time.Sleep(5 * time.Second)
+	// 切换杠杆后等待冷却期（避免冷却期错误）
+	if leverageSwitchCooldown > 0 {
+		log.Printf("  ⏱ 等待%v冷却期...", leverageSwitchCooldown)
+		time.Sleep(leverageSwitchCooldown)
+	}
 
 	return nil
 }
 
 // OpenLong 开多仓
 func (t *FuturesTrader) OpenLong(symbol string, quantity float64, leverage int) (map[string]interface{}, error) {
+	return t.OpenLongWithClientID(symbol, quantity, leverage, "")
+}
+
+// OpenLongWithClientID 使用指定客户端订单ID开多仓（clientOrderID为空时随机生成）
+func (t *FuturesTrader) OpenLongWithClientID(symbol string, quantity float64, leverage int, clientOrderID string) (map[string]interface{}, error) {
 	// 先取消该币种的所有委托单（清理旧的止损止盈单）
 	if err := t.CancelAllOrders(symbol); err != nil {
 		log.Printf("  ⚠ 取消旧委托单失败（可能没有委托单）: %v", err)
@@ -343,15 +404,14 @@ func (t *FuturesTrader) OpenLong(symbol string, quantity float64, leverage int)
 		return nil, err
 	}
 
-	// 创建市价买入订单（使用br ID）
-	order, err := t.client.NewCreateOrderService().
+	// 创建市价买入订单（使用br ID + 客户端订单ID）
+	svc := t.client.NewCreateOrderService().
 		Symbol(symbol).
 		Side(futures.SideTypeBuy).
-		PositionSide(futures.PositionSideTypeLong).
 		Type(futures.OrderTypeMarket).
 		Quantity(quantityStr).
-		NewClientOrderID(getBrOrderID()).
-		Do(context.Background())
+		NewClientOrderID(binanceClientOrderID(clientOrderID))
+	order, err := t.withPositionSide(svc, futures.PositionSideTypeLong, false).Do(context.Background())
 
 	if err != nil {
 		return nil, fmt.Errorf("开多仓失败: %w", err)
@@ -369,6 +429,11 @@ func (t *FuturesTrader) OpenLong(symbol string, quantity float64, leverage int)
 
 // OpenShort 开空仓
 func (t *FuturesTrader) OpenShort(symbol string, quantity float64, leverage int) (map[string]interface{}, error) {
+	return t.OpenShortWithClientID(symbol, quantity, leverage, "")
+}
+
+// OpenShortWithClientID 使用指定客户端订单ID开空仓（clientOrderID为空时随机生成）
+func (t *FuturesTrader) OpenShortWithClientID(symbol string, quantity float64, leverage int, clientOrderID string) (map[string]interface{}, error) {
 	// 先取消该币种的所有委托单（清理旧的止损止盈单）
 	if err := t.CancelAllOrders(symbol); err != nil {
 		log.Printf("  ⚠ 取消旧委托单失败（可能没有委托单）: %v", err)
@@ -398,15 +463,14 @@ func (t *FuturesTrader) OpenShort(symbol string, quantity float64, leverage int)
 		return nil, err
 	}
 
-	// 创建市价卖出订单（使用br ID）
-	order, err := t.client.NewCreateOrderService().
+	// 创建市价卖出订单（使用br ID + 客户端订单ID）
+	svc := t.client.NewCreateOrderService().
 		Symbol(symbol).
 		Side(futures.SideTypeSell).
-		PositionSide(futures.PositionSideTypeShort).
 		Type(futures.OrderTypeMarket).
 		Quantity(quantityStr).
-		NewClientOrderID(getBrOrderID()).
-		Do(context.Background())
+		NewClientOrderID(binanceClientOrderID(clientOrderID))
+	order, err := t.withPositionSide(svc, futures.PositionSideTypeShort, false).Do(context.Background())
 
 	if err != nil {
 		return nil, fmt.Errorf("开空仓失败: %w", err)
@@ -450,20 +514,20 @@ func (t *FuturesTrader) CloseLong(symbol string, quantity float64) (map[string]i
 	}
 
 	// 创建市价卖出订单（平多，使用br ID）
-	order, err := t.client.NewCreateOrderService().
+	svc := t.client.NewCreateOrderService().
 		Symbol(symbol).
 		Side(futures.SideTypeSell).
-		PositionSide(futures.PositionSideTypeLong).
 		Type(futures.OrderTypeMarket).
 		Quantity(quantityStr).
-		NewClientOrderID(getBrOrderID()).
-		Do(context.Background())
+		NewClientOrderID(getBrOrderID())
+	order, err := t.withPositionSide(svc, futures.PositionSideTypeLong, true).Do(context.Background())
 
 	if err != nil {
 		return nil, fmt.Errorf("平多仓失败: %w", err)
 	}
 
 	log.Printf("✓ 平多仓成功: %s 数量: %s", symbol, quantityStr)
+	t.invalidateCache()
 
 	// 平仓后取消该币种的所有挂单（止损止盈单）
 	if err := t.CancelAllOrders(symbol); err != nil {
@@ -505,20 +569,20 @@ func (t *FuturesTrader) CloseShort(symbol string, quantity float64) (map[string]
 	}
 
 	// 创建市价买入订单（平空，使用br ID）
-	order, err := t.client.NewCreateOrderService().
+	svc := t.client.NewCreateOrderService().
 		Symbol(symbol).
 		Side(futures.SideTypeBuy).
-		PositionSide(futures.PositionSideTypeShort).
 		Type(futures.OrderTypeMarket).
 		Quantity(quantityStr).
-		NewClientOrderID(getBrOrderID()).
-		Do(context.Background())
+		NewClientOrderID(getBrOrderID())
+	order, err := t.withPositionSide(svc, futures.PositionSideTypeShort, true).Do(context.Background())
 
 	if err != nil {
 		return nil, fmt.Errorf("平空仓失败: %w", err)
 	}
 
 	log.Printf("✓ 平空仓成功: %s 数量: %s", symbol, quantityStr)
+	t.invalidateCache()
 
 	// 平仓后取消该币种的所有挂单（止损止盈单）
 	if err := t.CancelAllOrders(symbol); err != nil {
@@ -532,6 +596,31 @@ func (t *FuturesTrader) CloseShort(symbol string, quantity float64) (map[string]
 	return result, nil
 }
 
+// GetOrderByClientID 按客户端订单ID查询订单
+func (t *FuturesTrader) GetOrderByClientID(symbol string, clientOrderID string) (map[string]interface{}, error) {
+	order, err := t.client.NewGetOrderService().
+		Symbol(symbol).
+		OrigClientOrderID(binanceClientOrderID(clientOrderID)).
+		Do(context.Background())
+
+	if err != nil {
+		// -2013: Order does not exist
+		if contains(err.Error(), "-2013") || contains(err.Error(), "Order does not exist") {
+			return nil, ErrOrderNotFound
+		}
+		return nil, fmt.Errorf("查询订单失败: %w", err)
+	}
+
+	executedQty, _ := strconv.ParseFloat(order.ExecutedQuantity, 64)
+
+	result := make(map[string]interface{})
+	result["orderId"] = order.OrderID
+	result["symbol"] = order.Symbol
+	result["status"] = string(order.Status)
+	result["executedQty"] = executedQty
+	return result, nil
+}
+
 // CancelStopLossOrders 仅取消止损单（不影响止盈单）
 func (t *FuturesTrader) CancelStopLossOrders(symbol string) error {
 	// 获取该币种的所有未完成订单
@@ -739,16 +828,18 @@ func (t *FuturesTrader) SetStopLoss(symbol string, positionSide string, quantity
 		return err
 	}
 
-	_, err = t.client.NewCreateOrderService().
+	svc := t.client.NewCreateOrderService().
 		Symbol(symbol).
 		Side(side).
-		PositionSide(posSide).
 		Type(futures.OrderTypeStopMarket).
 		StopPrice(fmt.Sprintf("%.8f", stopPrice)).
 		Quantity(quantityStr).
-		WorkingType(futures.WorkingTypeContractPrice).
-		ClosePosition(true).
-		Do(context.Background())
+		WorkingType(futures.WorkingTypeContractPrice)
+	if !t.isOneWayMode() {
+		svc = svc.ClosePosition(true)
+	}
+	// 单向持仓不使用 closePosition，改为 reduceOnly + 数量，避免触发时反向开仓
+	_, err = t.withPositionSide(svc, posSide, true).Do(context.Background())
 
 	if err != nil {
 		return fmt.Errorf("设置止损失败: %w", err)
@@ -777,16 +868,18 @@ func (t *FuturesTrader) SetTakeProfit(symbol string, positionSide string, quanti
 		return err
 	}
 
-	_, err = t.client.NewCreateOrderService().
+	svc := t.client.NewCreateOrderService().
 		Symbol(symbol).
 		Side(side).
-		PositionSide(posSide).
 		Type(futures.OrderTypeTakeProfitMarket).
 		StopPrice(fmt.Sprintf("%.8f", takeProfitPrice)).
 		Quantity(quantityStr).
-		WorkingType(futures.WorkingTypeContractPrice).
-		ClosePosition(true).
-		Do(context.Background())
+		WorkingType(futures.WorkingTypeContractPrice)
+	if !t.isOneWayMode() {
+		svc = svc.ClosePosition(true)
+	}
+	// 单向持仓不使用 closePosition，改为 reduceOnly + 数量，避免触发时反向开仓
+	_, err = t.withPositionSide(svc, posSide, true).Do(context.Background())
 
 	if err != nil {
 		return fmt.Errorf("设置止盈失败: %w", err)
@@ -847,6 +940,54 @@ func (t *FuturesTrader) GetSymbolPrecision(symbol string) (int, error) {
 	return 3, nil // 默认精度为3
 }
 
+// GetInstruments 获取可交易的永续合约列表（USDT和USDC保证金）
+func (t *FuturesTrader) GetInstruments() ([]market.Instrument, error) {
+	exchangeInfo, err := t.client.NewExchangeInfoService().Do(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("获取交易规则失败: %w", err)
+	}
+
+	var instruments []market.Instrument
+	for _, s := range exchangeInfo.Symbols {
+		if string(s.ContractType) != market.ContractPerpetual || s.Status != "TRADING" {
+			continue
+		}
+		if s.QuoteAsset != market.QuoteUSDT && s.QuoteAsset != market.QuoteUSDC {
+			continue
+		}
+		minQty, minNotional := parseOrderMinimums(s.Filters)
+		instruments = append(instruments, market.Instrument{
+			Base:         s.BaseAsset,
+			Quote:        s.QuoteAsset,
+			Exchange:     "binance",
+			NativeSymbol: s.Symbol,
+			ContractType: string(s.ContractType),
+			MinNotional:  minNotional,
+			MinQty:       minQty,
+		})
+	}
+	return instruments, nil
+}
+
+// parseOrderMinimums 从交易规则的 filters 中解析最小下单数量（LOT_SIZE）和最小名义价值（MIN_NOTIONAL）
+// 币安和 Aster 的 filters 格式相同；解析失败的字段返回0
+func parseOrderMinimums(filters []map[string]interface{}) (minQty, minNotional float64) {
+	for _, filter := range filters {
+		filterType, _ := filter["filterType"].(string)
+		switch filterType {
+		case "LOT_SIZE":
+			if v, ok := filter["minQty"].(string); ok {
+				minQty, _ = strconv.ParseFloat(v, 64)
+			}
+		case "MIN_NOTIONAL":
+			if v, ok := filter["notional"].(string); ok {
+				minNotional, _ = strconv.ParseFloat(v, 64)
+			}
+		}
+	}
+	return minQty, minNotional
+}
+
 // calculatePrecision 从stepSize计算精度
 func calculatePrecision(stepSize string) int {
 	// 去除尾部的0
@@ -200,6 +200,25 @@ func NewBinanceFuturesTestSuite(t *testing.T) *BinanceFuturesTestSuite {
 				"workingType":   r.FormValue("workingType"),
 			}
 
+		// Mock GetOrder - /fapi/v1/order (GET)
+		case path == "/fapi/v1/order" && r.Method == "GET":
+			clientOrderID := r.URL.Query().Get("origClientOrderId")
+			if strings.Contains(clientOrderID, "missing") {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]interface{}{
+					"code": -2013,
+					"msg":  "Order does not exist.",
+				})
+				return
+			}
+			respBody = map[string]interface{}{
+				"orderId":       123456,
+				"symbol":        r.URL.Query().Get("symbol"),
+				"status":        "FILLED",
+				"clientOrderId": clientOrderID,
+				"executedQty":   "0.010",
+			}
+
 		// Mock CancelOrder - /fapi/v1/order (DELETE)
 		case path == "/fapi/v1/order" && r.Method == "DELETE":
 			respBody = map[string]interface{}{
@@ -343,7 +362,7 @@ func TestNewFuturesTrader(t *testing.T) {
 	defer mockServer.Close()
 
 	// 测试成功创建
-	trader := NewFuturesTrader("test_api_key", "test_secret_key", "test_user")
+	trader := NewFuturesTrader("test_api_key", "test_secret_key", "test_user", "")
 
 	// 修改 client 使用 mock server
 	trader.client.BaseURL = mockServer.URL
@@ -352,6 +371,7 @@ func TestNewFuturesTrader(t *testing.T) {
 	assert.NotNil(t, trader)
 	assert.NotNil(t, trader.client)
 	assert.Equal(t, 15*time.Second, trader.cacheDuration)
+	assert.Equal(t, PositionModeHedge, trader.GetPositionMode(), "默认使用双向持仓")
 }
 
 // TestCalculatePositionSize 测试仓位计算
@@ -418,3 +438,41 @@ func TestGetBrOrderID(t *testing.T) {
 		ids[id] = true
 	}
 }
+
+// TestFuturesTrader_GetOrderByClientID 测试按客户端订单ID查询订单
+func TestFuturesTrader_GetOrderByClientID(t *testing.T) {
+	suite := NewBinanceFuturesTestSuite(t)
+	defer suite.Cleanup()
+
+	trader := suite.Trader.(*FuturesTrader)
+
+	order, err := trader.GetOrderByClientID("BTCUSDT", "abcdc1d0")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(123456), order["orderId"])
+	assert.Equal(t, "FILLED", order["status"])
+	assert.InDelta(t, 0.01, order["executedQty"], 1e-9)
+
+	_, err = trader.GetOrderByClientID("BTCUSDT", "missingc1d0")
+	assert.ErrorIs(t, err, ErrOrderNotFound)
+}
+
+func TestFuturesTrader_CloseInvalidatesCache(t *testing.T) {
+	suite := NewBinanceFuturesTestSuite(t)
+	defer suite.Cleanup()
+
+	trader := suite.Trader.(*FuturesTrader)
+	trader.cacheDuration = 15 * time.Second
+
+	_, err := trader.GetBalance()
+	assert.NoError(t, err)
+	_, err = trader.GetPositions()
+	assert.NoError(t, err)
+	assert.NotNil(t, trader.cachedBalance)
+	assert.NotNil(t, trader.cachedPositions)
+
+	// 平仓后缓存失效，单向持仓模式下随后的开仓重新读取持仓和可用余额
+	_, err = trader.CloseLong("BTCUSDT", 0)
+	assert.NoError(t, err)
+	assert.Nil(t, trader.cachedBalance)
+	assert.Nil(t, trader.cachedPositions)
+}
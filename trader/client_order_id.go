@@ -0,0 +1,99 @@
+package trader
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrOrderNotFound 交易所中不存在该客户端订单ID对应的订单
+// 用于在下单超时后确认订单确实没有到达交易所，可以安全重试
+var ErrOrderNotFound = errors.New("订单不存在")
+
+// 开仓下单重试配置
+var (
+	maxOpenOrderAttempts = 3               // 最多尝试次数（含首次）
+	openOrderRetryDelay  = 2 * time.Second // 每次重试前的等待时间（按次数线性递增）
+)
+
+// BuildClientOrderID 生成确定性的客户端订单ID
+// 同一个 trader、同一次运行、同一周期的同一条决策总是得到相同的ID，
+// 因此重试时交易所可以识别出重复订单，查询时也能找回之前的订单。
+// 格式: {trader哈希4位}{启动时间base36}c{周期}d{决策序号}，例如 "1a2bs3k9x0c12d0"
+// 长度控制在21字符以内，保证加上币安 broker 前缀后不超过32字符
+func BuildClientOrderID(traderID string, sessionStart time.Time, cycle, index int) string {
+	sum := sha256.Sum256([]byte(traderID))
+	traderTag := hex.EncodeToString(sum[:2])
+	sessionTag := strconv.FormatInt(sessionStart.Unix(), 36)
+	return fmt.Sprintf("%s%sc%dd%d", traderTag, sessionTag, cycle, index)
+}
+
+// binanceClientOrderID 将逻辑客户端订单ID转换为币安格式（带 broker 前缀，最长32字符）
+// 为空时生成随机ID（兼容不需要幂等的调用）
+func binanceClientOrderID(clientOrderID string) string {
+	if clientOrderID == "" {
+		return getBrOrderID()
+	}
+	orderID := "x-KzrpZaP9" + clientOrderID
+	if len(orderID) > 32 {
+		orderID = orderID[:32]
+	}
+	return orderID
+}
+
+// hyperliquidCloid 将逻辑客户端订单ID转换为 Hyperliquid 的 cloid（0x + 32位十六进制）
+// Hyperliquid 要求 cloid 为16字节，这里取逻辑ID哈希的前16字节，保证同一ID映射结果不变
+func hyperliquidCloid(clientOrderID string) *string {
+	if clientOrderID == "" {
+		return nil
+	}
+	sum := sha256.Sum256([]byte(clientOrderID))
+	cloid := "0x" + hex.EncodeToString(sum[:16])
+	return &cloid
+}
+
+// isAmbiguousOrderError 判断下单错误是否"状态不明"
+// 超时、连接中断、服务端5xx等错误无法确定订单是否已被交易所接受，
+// 此时不能直接重试，必须先按客户端订单ID查询订单状态
+func isAmbiguousOrderError(err error) bool {
+	if err == nil {
+		return false
+	}
+	msg := strings.ToLower(err.Error())
+	ambiguousKeywords := []string{
+		"timeout",
+		"deadline exceeded",
+		"connection reset",
+		"connection refused",
+		"broken pipe",
+		"eof",
+		"http 500",
+		"http 502",
+		"http 503",
+		"http 504",
+		"unknown error, please check your request or try again later", // 币安 -1000/-1007
+		"-1007",
+	}
+	for _, keyword := range ambiguousKeywords {
+		if strings.Contains(msg, keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+// isOrderDead 判断查询到的订单是否已失效且没有任何成交（可以安全重试）
+func isOrderDead(order map[string]interface{}) bool {
+	status, _ := order["status"].(string)
+	switch strings.ToUpper(status) {
+	case "CANCELED", "REJECTED", "EXPIRED":
+	default:
+		return false
+	}
+	executedQty, _ := order["executedQty"].(float64)
+	return executedQty == 0
+}
@@ -0,0 +1,77 @@
+package trader
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestBuildClientOrderID 测试确定性客户端订单ID生成
+func TestBuildClientOrderID(t *testing.T) {
+	start := time.Unix(1730000000, 0)
+
+	id := BuildClientOrderID("trader_1", start, 12, 3)
+	assert.Equal(t, id, BuildClientOrderID("trader_1", start, 12, 3), "相同输入必须生成相同ID")
+	assert.True(t, strings.HasSuffix(id, "c12d3"))
+	assert.LessOrEqual(t, len(id), 21, "加上币安broker前缀后不能超过32字符")
+
+	assert.NotEqual(t, id, BuildClientOrderID("trader_1", start, 12, 4), "不同决策序号ID应不同")
+	assert.NotEqual(t, id, BuildClientOrderID("trader_1", start, 13, 3), "不同周期ID应不同")
+	assert.NotEqual(t, id, BuildClientOrderID("trader_2", start, 12, 3), "不同trader ID应不同")
+	assert.NotEqual(t, id, BuildClientOrderID("trader_1", start.Add(time.Second), 12, 3), "重启后ID应不同")
+}
+
+// TestBinanceClientOrderID 测试币安客户端订单ID格式
+func TestBinanceClientOrderID(t *testing.T) {
+	id := binanceClientOrderID("abcd1a2b3cc99999d12")
+	assert.Equal(t, "x-KzrpZaP9abcd1a2b3cc99999d12", id)
+	assert.LessOrEqual(t, len(binanceClientOrderID(strings.Repeat("a", 40))), 32)
+	assert.True(t, strings.HasPrefix(binanceClientOrderID(""), "x-KzrpZaP9"), "为空时应生成随机broker ID")
+}
+
+// TestHyperliquidCloid 测试 Hyperliquid cloid 映射
+func TestHyperliquidCloid(t *testing.T) {
+	assert.Nil(t, hyperliquidCloid(""))
+
+	cloid := hyperliquidCloid("abcdc1d0")
+	assert.NotNil(t, cloid)
+	assert.Len(t, *cloid, 34)
+	assert.True(t, strings.HasPrefix(*cloid, "0x"))
+	assert.Equal(t, *cloid, *hyperliquidCloid("abcdc1d0"), "同一ID必须映射到同一cloid")
+}
+
+// TestIsAmbiguousOrderError 测试下单错误分类
+func TestIsAmbiguousOrderError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"客户端超时", errors.New("context deadline exceeded (Client.Timeout exceeded while awaiting headers)"), true},
+		{"连接重置", errors.New("read tcp: connection reset by peer"), true},
+		{"EOF", errors.New("Post \"https://api\": EOF"), true},
+		{"网关错误", errors.New("HTTP 502: Bad Gateway"), true},
+		{"币安后端超时", errors.New("<APIError> code=-1007, msg=Timeout waiting for response from backend server."), true},
+		{"保证金不足", errors.New("<APIError> code=-2019, msg=Margin is insufficient."), false},
+		{"精度错误", errors.New("<APIError> code=-1111, msg=Precision is over the maximum defined for this asset."), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, isAmbiguousOrderError(tt.err))
+		})
+	}
+}
+
+// TestIsOrderDead 测试订单失效判断
+func TestIsOrderDead(t *testing.T) {
+	assert.False(t, isOrderDead(map[string]interface{}{"status": "FILLED", "executedQty": 1.0}))
+	assert.False(t, isOrderDead(map[string]interface{}{"status": "NEW", "executedQty": 0.0}))
+	assert.True(t, isOrderDead(map[string]interface{}{"status": "CANCELED", "executedQty": 0.0}))
+	assert.True(t, isOrderDead(map[string]interface{}{"status": "EXPIRED"}))
+	assert.False(t, isOrderDead(map[string]interface{}{"status": "CANCELED", "executedQty": 0.5}), "部分成交后取消不能重试")
+}
@@ -0,0 +1,249 @@
+package trader
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 事件触发类型（在固定扫描间隔之外提前触发AI决策周期）
+const (
+	TriggerMarketAlert = "market_alert" // 关注币种出现市场警报
+	TriggerPriceMove   = "price_move"   // 持仓币种价格相对上个周期大幅变化
+	TriggerLiquidation = "liquidation"  // 持仓接近强平价
+	TriggerFill        = "fill"         // 持仓在周期外被平掉（止盈/止损成交、强平或手动平仓）
+)
+
+const (
+	defaultMinTriggerGap  = 1 * time.Minute  // 事件触发的AI决策与上个周期的默认最小间隔
+	triggerDebounce       = 5 * time.Second  // 合并窗口：窗口内的多个事件只触发一次周期
+	positionWatchInterval = 15 * time.Second // 持仓事件检查间隔
+	triggerQueueSize      = 16
+)
+
+// cycleTrigger 提前触发AI决策周期的事件
+type cycleTrigger struct {
+	Reason  string
+	Symbol  string
+	Message string
+}
+
+// triggerScheduler 合并短时间内的多个事件，并保证与上个周期的最小间隔
+// 只在主循环 goroutine 中使用
+type triggerScheduler struct {
+	minGap  time.Duration
+	pending []cycleTrigger
+	timer   *time.Timer
+}
+
+func newTriggerScheduler(minGap time.Duration) *triggerScheduler {
+	if minGap <= 0 {
+		minGap = defaultMinTriggerGap
+	}
+	return &triggerScheduler{minGap: minGap}
+}
+
+// delay 距离可以执行事件触发周期还需等待的时间（至少一个合并窗口）
+func (s *triggerScheduler) delay(lastCycle, now time.Time) time.Duration {
+	wait := s.minGap - now.Sub(lastCycle)
+	if wait < triggerDebounce {
+		wait = triggerDebounce
+	}
+	return wait
+}
+
+// add 记录事件，没有等待中的定时器时按最小间隔启动一个
+func (s *triggerScheduler) add(t cycleTrigger, lastCycle, now time.Time) {
+	s.pending = append(s.pending, t)
+	if s.timer == nil {
+		wait := s.delay(lastCycle, now)
+		s.timer = time.NewTimer(wait)
+		log.Printf("⚡ 事件触发: %s，%.0f 秒后执行AI决策周期", t.Message, wait.Seconds())
+	}
+}
+
+// C 定时器通道，没有待执行事件时为nil（select 永不触发）
+func (s *triggerScheduler) C() <-chan time.Time {
+	if s.timer == nil {
+		return nil
+	}
+	return s.timer.C
+}
+
+// take 取出所有待执行事件（定时器已触发时调用）
+func (s *triggerScheduler) take() []cycleTrigger {
+	triggers := s.pending
+	s.pending = nil
+	s.timer = nil
+	return triggers
+}
+
+// reset 丢弃待执行事件（定时周期已经覆盖这些事件）
+func (s *triggerScheduler) reset() {
+	if s.timer != nil {
+		s.timer.Stop()
+	}
+	s.pending = nil
+	s.timer = nil
+}
+
+// summarizeTriggers 汇总事件用于日志
+func summarizeTriggers(triggers []cycleTrigger) string {
+	messages := make([]string, 0, len(triggers))
+	for _, t := range triggers {
+		messages = append(messages, t.Message)
+	}
+	return strings.Join(messages, "; ")
+}
+
+// positionTriggersEnabled 是否启用了任何持仓事件触发
+func (c *AutoTraderConfig) positionTriggersEnabled() bool {
+	return c.PriceMoveTriggerPct > 0 || c.LiquidationBufferPct > 0 || c.FillTrigger
+}
+
+// positionWatchState 持仓监控的基准状态（只在持仓监控 goroutine 中使用）
+type positionWatchState struct {
+	seq       int64              // 基准对应的AI决策周期序号
+	basePrice map[string]float64 // 持仓key(symbol_side) -> 上个周期之后的标记价
+	fired     map[string]bool    // 本周期已触发过的事件（类型:持仓key），避免重复
+}
+
+// watchedPosition 持仓监控关心的持仓字段
+type watchedPosition struct {
+	symbol           string
+	side             string
+	markPrice        float64
+	liquidationPrice float64
+}
+
+// closedPositionKeys 上次快照中有、当前持仓中已经没有的持仓key（symbol_side，按key排序）
+// 持仓在两次检查之间被平掉，可能是止盈/止损成交、强平、回撤保护或手动平仓
+func closedPositionKeys[V, W any](previous map[string]V, current map[string]W) []string {
+	var closed []string
+	for key := range previous {
+		if _, ok := current[key]; !ok {
+			closed = append(closed, key)
+		}
+	}
+	sort.Strings(closed)
+	return closed
+}
+
+// detectPositionTriggers 对比上个周期之后的持仓基准，检测价格变化、接近强平和周期外平仓
+// seq 与基准不一致（期间执行过AI决策周期）时只重置基准，不检测价格变化和平仓
+func detectPositionTriggers(state *positionWatchState, positions []map[string]interface{}, seq int64, cfg AutoTraderConfig) []cycleTrigger {
+	current := make(map[string]watchedPosition, len(positions))
+	for _, pos := range positions {
+		symbol, _ := pos["symbol"].(string)
+		side, _ := pos["side"].(string)
+		markPrice, _ := pos["markPrice"].(float64)
+		liquidationPrice, _ := pos["liquidationPrice"].(float64)
+		if symbol == "" || markPrice <= 0 {
+			continue
+		}
+		current[symbol+"_"+side] = watchedPosition{symbol, side, markPrice, liquidationPrice}
+	}
+
+	var triggers []cycleTrigger
+	fire := func(reason, key, symbol, format string, args ...interface{}) {
+		if state.fired[reason+":"+key] {
+			return
+		}
+		state.fired[reason+":"+key] = true
+		triggers = append(triggers, cycleTrigger{Reason: reason, Symbol: symbol, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if state.basePrice == nil || state.seq != seq {
+		state.seq = seq
+		state.basePrice = make(map[string]float64, len(current))
+		state.fired = make(map[string]bool)
+		for key, pos := range current {
+			state.basePrice[key] = pos.markPrice
+		}
+	} else {
+		if cfg.FillTrigger {
+			for _, key := range closedPositionKeys(state.basePrice, current) {
+				symbol, side, _ := strings.Cut(key, "_")
+				fire(TriggerFill, key, symbol, "%s %s 持仓已在周期外平仓（止盈/止损、强平或手动平仓）", symbol, side)
+				delete(state.basePrice, key)
+			}
+		}
+		for key, pos := range current {
+			base, ok := state.basePrice[key]
+			if !ok {
+				state.basePrice[key] = pos.markPrice
+				continue
+			}
+			if cfg.PriceMoveTriggerPct > 0 {
+				if change := (pos.markPrice/base - 1) * 100; math.Abs(change) >= cfg.PriceMoveTriggerPct {
+					fire(TriggerPriceMove, key, pos.symbol, "%s %s 价格较上个周期变化 %+.2f%%", pos.symbol, pos.side, change)
+				}
+			}
+		}
+	}
+
+	// 接近强平价在每次检查时都评估（刚结束的周期没有处理的风险也需要再次提醒）
+	if cfg.LiquidationBufferPct > 0 {
+		for key, pos := range current {
+			if pos.liquidationPrice <= 0 {
+				continue
+			}
+			if distance := math.Abs(pos.markPrice-pos.liquidationPrice) / pos.markPrice * 100; distance < cfg.LiquidationBufferPct {
+				fire(TriggerLiquidation, key, pos.symbol, "%s %s 距强平价仅 %.2f%%", pos.symbol, pos.side, distance)
+			}
+		}
+	}
+	return triggers
+}
+
+// startPositionTriggerMonitor 启动持仓事件监控，检测到事件时发送到 triggers（未启用持仓事件时不启动）
+func (at *AutoTrader) startPositionTriggerMonitor(triggers chan<- cycleTrigger) {
+	if !at.config.positionTriggersEnabled() {
+		return
+	}
+
+	at.monitorWg.Add(1)
+	go func() {
+		defer at.monitorWg.Done()
+
+		ticker := time.NewTicker(positionWatchInterval)
+		defer ticker.Stop()
+
+		log.Printf("⚡ [%s] 启动持仓事件监控（价格变化 %.2f%% / 强平距离 %.2f%% / 周期外平仓 %v）",
+			at.name, at.config.PriceMoveTriggerPct, at.config.LiquidationBufferPct, at.config.FillTrigger)
+
+		state := &positionWatchState{}
+		for {
+			select {
+			case <-ticker.C:
+				// AI决策周期执行中持仓会被主动调整，跳过本次检查
+				seq := at.cycleSeq.Load()
+				if at.cycleRunning.Load() {
+					continue
+				}
+				positions, err := at.trader.GetPositions()
+				if err != nil {
+					log.Printf("❌ 持仓事件监控：获取持仓失败: %v", err)
+					continue
+				}
+				// 获取持仓期间开始了新的周期，结果可能已过时
+				if at.cycleRunning.Load() || at.cycleSeq.Load() != seq {
+					continue
+				}
+				for _, t := range detectPositionTriggers(state, positions, seq, at.config) {
+					select {
+					case triggers <- t:
+					default:
+						log.Printf("⚠️  事件触发队列已满，丢弃: %s", t.Message)
+					}
+				}
+			case <-at.stopMonitorCh:
+				log.Println("⏹ 停止持仓事件监控")
+				return
+			}
+		}
+	}()
+}
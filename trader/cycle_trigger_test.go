@@ -0,0 +1,95 @@
+package trader
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testPosition(symbol, side string, markPrice, liquidationPrice float64) map[string]interface{} {
+	return map[string]interface{}{
+		"symbol":           symbol,
+		"side":             side,
+		"markPrice":        markPrice,
+		"liquidationPrice": liquidationPrice,
+	}
+}
+
+func triggerReasons(triggers []cycleTrigger) []string {
+	reasons := make([]string, len(triggers))
+	for i, t := range triggers {
+		reasons[i] = t.Reason + ":" + t.Symbol
+	}
+	return reasons
+}
+
+// TestDetectPositionTriggers 测试价格变化、周期外平仓检测及周期后重置基准
+func TestDetectPositionTriggers(t *testing.T) {
+	cfg := AutoTraderConfig{PriceMoveTriggerPct: 2, FillTrigger: true}
+	state := &positionWatchState{}
+
+	// 首次检查只建立基准
+	positions := []map[string]interface{}{
+		testPosition("BTCUSDT", "long", 100000, 0),
+		testPosition("ETHUSDT", "short", 4000, 0),
+	}
+	assert.Empty(t, detectPositionTriggers(state, positions, 1, cfg))
+
+	// BTC 上涨1%不触发，ETH 被止损平仓
+	positions = []map[string]interface{}{testPosition("BTCUSDT", "long", 101000, 0)}
+	fills := detectPositionTriggers(state, positions, 1, cfg)
+	assert.Equal(t, []string{"fill:ETHUSDT"}, triggerReasons(fills))
+	assert.Contains(t, fills[0].Message, "周期外平仓", "持仓消失的原因未知，不应断定为止盈/止损成交")
+
+	// BTC 相对上个周期上涨2.5%触发，同一周期内不重复
+	positions = []map[string]interface{}{testPosition("BTCUSDT", "long", 102500, 0)}
+	assert.Equal(t, []string{"price_move:BTCUSDT"}, triggerReasons(detectPositionTriggers(state, positions, 1, cfg)))
+	assert.Empty(t, detectPositionTriggers(state, positions, 1, cfg), "同一周期内不应重复触发")
+
+	// 新周期后以当前价格为基准，AI主动平仓不视为周期外平仓
+	assert.Empty(t, detectPositionTriggers(state, nil, 2, cfg))
+	assert.Empty(t, state.basePrice)
+}
+
+// TestDetectPositionTriggers_Liquidation 测试接近强平价触发（新周期后仍会提醒一次）
+func TestDetectPositionTriggers_Liquidation(t *testing.T) {
+	cfg := AutoTraderConfig{LiquidationBufferPct: 5}
+	state := &positionWatchState{}
+
+	positions := []map[string]interface{}{
+		testPosition("BTCUSDT", "long", 100000, 96000), // 距强平 4%
+		testPosition("ETHUSDT", "short", 4000, 4400),   // 距强平 10%
+		testPosition("SOLUSDT", "long", 200, 0),        // 无强平价
+	}
+	assert.Equal(t, []string{"liquidation:BTCUSDT"}, triggerReasons(detectPositionTriggers(state, positions, 1, cfg)))
+	assert.Empty(t, detectPositionTriggers(state, positions, 1, cfg))
+	assert.Equal(t, []string{"liquidation:BTCUSDT"}, triggerReasons(detectPositionTriggers(state, positions, 2, cfg)))
+}
+
+// TestTriggerScheduler 测试事件合并和最小间隔
+func TestTriggerScheduler(t *testing.T) {
+	now := time.Now()
+	s := newTriggerScheduler(0)
+	assert.Equal(t, defaultMinTriggerGap, s.minGap)
+
+	assert.Equal(t, 40*time.Second, s.delay(now.Add(-20*time.Second), now), "距上个周期不足最小间隔时等到满足间隔")
+	assert.Equal(t, triggerDebounce, s.delay(now.Add(-10*time.Minute), now), "已满足间隔时仍等待一个合并窗口")
+
+	assert.Nil(t, s.C())
+	s.add(cycleTrigger{Reason: TriggerPriceMove, Message: "a"}, now.Add(-10*time.Minute), now)
+	timer := s.timer
+	s.add(cycleTrigger{Reason: TriggerFill, Message: "b"}, now.Add(-10*time.Minute), now)
+	assert.Same(t, timer, s.timer, "等待中的事件沿用原定时器")
+	assert.NotNil(t, s.C())
+
+	triggers := s.take()
+	assert.Len(t, triggers, 2)
+	assert.Equal(t, "a; b", summarizeTriggers(triggers))
+	assert.Nil(t, s.C())
+
+	s.add(cycleTrigger{Message: "c"}, now, now)
+	s.reset()
+	assert.Nil(t, s.C())
+	assert.Empty(t, s.pending)
+}
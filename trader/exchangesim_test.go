@@ -0,0 +1,415 @@
+package trader
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"nofx/exchangesim"
+	"nofx/market"
+
+	"github.com/adshao/go-binance/v2/futures"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/sonirico/go-hyperliquid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ============================================================
+// 基于 exchangesim 模拟交易所的端到端测试
+// 请求经过真实的 SDK / 签名流程，由模拟交易所验签并撮合
+// ============================================================
+
+// newSimFuturesTrader 创建连接到模拟交易所的币安交易器（双向持仓模式）
+func newSimFuturesTrader(t *testing.T, sim *exchangesim.Server, secretKey string) *FuturesTrader {
+	sim.AddBinanceAPIKey("sim-api-key", "sim-secret-key")
+
+	client := futures.NewClient("sim-api-key", secretKey)
+	client.BaseURL = sim.URL()
+	client.HTTPClient = sim.Client()
+
+	cooldown := leverageSwitchCooldown
+	leverageSwitchCooldown = 0
+	t.Cleanup(func() { leverageSwitchCooldown = cooldown })
+
+	return &FuturesTrader{client: client, cacheDuration: 0}
+}
+
+// newSimAsterTrader 创建连接到模拟交易所的 Aster 交易器
+func newSimAsterTrader(t *testing.T, sim *exchangesim.Server) *AsterTrader {
+	privateKey, err := crypto.GenerateKey()
+	require.NoError(t, err)
+
+	user := "0x1234567890123456789012345678901234567890"
+	signer := crypto.PubkeyToAddress(privateKey.PublicKey).Hex()
+	sim.AddAsterSigner(user, signer)
+
+	return &AsterTrader{
+		ctx:             context.Background(),
+		user:            user,
+		signer:          signer,
+		privateKey:      privateKey,
+		client:          sim.Client(),
+		baseURL:         sim.URL(),
+		symbolPrecision: make(map[string]SymbolPrecision),
+	}
+}
+
+// newSimHyperliquidTrader 创建连接到模拟交易所的 Hyperliquid 交易器（Agent 钱包模式）
+func newSimHyperliquidTrader(t *testing.T, sim *exchangesim.Server, register bool) *HyperliquidTrader {
+	return newSimHyperliquidVaultTrader(t, sim, register, "")
+}
+
+// newSimHyperliquidVaultTrader 创建在子账户/Vault上交易的 Hyperliquid 交易器（vaultAddr 为空时在主钱包交易）
+func newSimHyperliquidVaultTrader(t *testing.T, sim *exchangesim.Server, register bool, vaultAddr string) *HyperliquidTrader {
+	agentKey, err := crypto.GenerateKey()
+	require.NoError(t, err)
+
+	walletAddr := "0x9999999999999999999999999999999999999999"
+	if register {
+		sim.AddHyperliquidAgent(walletAddr, crypto.PubkeyToAddress(agentKey.PublicKey).Hex())
+	}
+
+	accountAddr := walletAddr
+	if vaultAddr != "" {
+		accountAddr = vaultAddr
+	}
+
+	ctx := context.Background()
+	exchange := hyperliquid.NewExchange(ctx, agentKey, sim.URL(), nil, vaultAddr, accountAddr, nil)
+	meta, err := exchange.Info().Meta(ctx)
+	require.NoError(t, err)
+
+	return &HyperliquidTrader{
+		exchange:      exchange,
+		ctx:           ctx,
+		walletAddr:    walletAddr,
+		vaultAddr:     vaultAddr,
+		meta:          meta,
+		isCrossMargin: true,
+	}
+}
+
+func TestExchangeSim_BinanceLifecycle(t *testing.T) {
+	sim := exchangesim.NewServer()
+	defer sim.Close()
+	trader := newSimFuturesTrader(t, sim, "sim-secret-key")
+
+	require.NoError(t, trader.setPositionMode())
+	assert.True(t, sim.DualSidePosition())
+	require.NoError(t, trader.setPositionMode(), "已是双向持仓时应忽略 -4059")
+
+	order, err := trader.OpenLong("BTCUSDT", 0.01, 10)
+	require.NoError(t, err)
+	assert.Equal(t, futures.OrderStatusTypeFilled, order["status"])
+	assert.Equal(t, 10, sim.Leverage("BTCUSDT"))
+	assert.InDelta(t, 0.01, sim.Position("BTCUSDT", "LONG").Amount, 1e-9)
+
+	positions, err := trader.GetPositions()
+	require.NoError(t, err)
+	require.Len(t, positions, 1)
+	assert.Equal(t, "long", positions[0]["side"])
+	assert.Equal(t, 50000.0, positions[0]["entryPrice"])
+
+	require.NoError(t, trader.SetStopLoss("BTCUSDT", "LONG", 0.01, 49000))
+	require.NoError(t, trader.SetTakeProfit("BTCUSDT", "LONG", 0.01, 52000))
+	assert.Len(t, sim.OpenOrders("BTCUSDT"), 2)
+
+	// 价格跌破止损价：止损单触发平仓
+	sim.SetPrice("BTCUSDT", 48900)
+	assert.InDelta(t, 0, sim.Position("BTCUSDT", "LONG").Amount, 1e-9)
+	assert.InDelta(t, 10000-11, sim.Balance(), 1e-6)
+
+	balance, err := trader.GetBalance()
+	require.NoError(t, err)
+	assert.InDelta(t, 10000-11, balance["totalWalletBalance"], 1e-6)
+
+	require.NoError(t, trader.CancelAllOrders("BTCUSDT"))
+	assert.Empty(t, sim.OpenOrders("BTCUSDT"))
+}
+
+func TestExchangeSim_BinanceScenarios(t *testing.T) {
+	sim := exchangesim.NewServer()
+	defer sim.Close()
+	trader := newSimFuturesTrader(t, sim, "sim-secret-key")
+	require.NoError(t, trader.setPositionMode())
+
+	t.Run("拒单", func(t *testing.T) {
+		sim.Script(exchangesim.NextOrder().Reject(-2019, "Margin is insufficient."))
+		_, err := trader.OpenLong("BTCUSDT", 0.01, 10)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "-2019")
+	})
+
+	t.Run("部分成交", func(t *testing.T) {
+		sim.Script(exchangesim.NextOrder().PartialFill(0.5))
+		_, err := trader.OpenShortWithClientID("ETHUSDT", 0.1, 5, "partial-1")
+		require.NoError(t, err)
+
+		order, err := trader.GetOrderByClientID("ETHUSDT", "partial-1")
+		require.NoError(t, err)
+		assert.Equal(t, "EXPIRED", order["status"])
+		assert.InDelta(t, 0.05, order["executedQty"], 1e-9)
+		assert.InDelta(t, -0.05, sim.Position("ETHUSDT", "SHORT").Amount, 1e-9)
+	})
+
+	t.Run("已成交但响应超时", func(t *testing.T) {
+		sim.Script(exchangesim.NextOrder().AcceptThenFail())
+		_, err := trader.OpenLongWithClientID("SOLUSDT", 1, 5, "ambiguous-1")
+		require.Error(t, err)
+		assert.True(t, isAmbiguousOrderError(err))
+
+		order, err := trader.GetOrderByClientID("SOLUSDT", "ambiguous-1")
+		require.NoError(t, err)
+		assert.Equal(t, "FILLED", order["status"])
+	})
+
+	t.Run("未到达交易所", func(t *testing.T) {
+		sim.Script(exchangesim.NextOrder().FailBeforeAccept())
+		_, err := trader.OpenLongWithClientID("SOLUSDT", 1, 5, "lost-1")
+		require.Error(t, err)
+
+		_, err = trader.GetOrderByClientID("SOLUSDT", "lost-1")
+		assert.ErrorIs(t, err, ErrOrderNotFound)
+	})
+
+	t.Run("止损价会立即触发", func(t *testing.T) {
+		err := trader.SetStopLoss("ETHUSDT", "SHORT", 0.05, 2900)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "-2021")
+	})
+}
+
+func TestExchangeSim_BinanceOneWayMode(t *testing.T) {
+	sim := exchangesim.NewServer()
+	defer sim.Close()
+	trader := newSimFuturesTrader(t, sim, "sim-secret-key")
+	trader.positionMode = PositionModeOneWay
+
+	require.NoError(t, trader.setPositionMode())
+	assert.False(t, sim.DualSidePosition())
+	assert.Equal(t, PositionModeOneWay, trader.GetPositionMode())
+
+	// 开仓不带 positionSide，持仓记在 BOTH 上
+	_, err := trader.OpenShort("ETHUSDT", 1, 5)
+	require.NoError(t, err)
+	assert.InDelta(t, -1, sim.Position("ETHUSDT", "BOTH").Amount, 1e-9)
+
+	// 止盈止损使用 reduceOnly + 数量
+	require.NoError(t, trader.SetStopLoss("ETHUSDT", "SHORT", 1, 3100))
+	require.NoError(t, trader.SetTakeProfit("ETHUSDT", "SHORT", 1, 2800))
+	stops := sim.OpenOrders("ETHUSDT")
+	require.Len(t, stops, 2)
+	for _, o := range stops {
+		assert.True(t, o.ReduceOnly)
+		assert.False(t, o.ClosePosition)
+		assert.Equal(t, "BOTH", o.PositionSide)
+	}
+
+	// 平仓使用 reduceOnly：超量平仓不会反向开仓
+	_, err = trader.CloseShort("ETHUSDT", 2)
+	require.NoError(t, err)
+	assert.InDelta(t, 0, sim.Position("ETHUSDT", "BOTH").Amount, 1e-9)
+	assert.Empty(t, sim.OpenOrders("ETHUSDT"), "平仓后应取消止盈止损单")
+
+}
+
+func TestExchangeSim_BinanceUSDCContract(t *testing.T) {
+	sim := exchangesim.NewServer()
+	defer sim.Close()
+	sim.AddSymbol(exchangesim.Symbol{Name: "BTCUSDC", PricePrecision: 1, QuantityPrecision: 3, MaxLeverage: 50, MinNotional: 5, Price: 50010})
+	trader := newSimFuturesTrader(t, sim, "sim-secret-key")
+	require.NoError(t, trader.setPositionMode())
+
+	instruments, err := trader.GetInstruments()
+	require.NoError(t, err)
+	set := market.NewInstrumentSet("binance", instruments)
+	assert.Equal(t, []string{"BTCUSDC", "BTCUSDT", "ETHUSDT", "SOLUSDT"}, set.Symbols())
+
+	inst, err := set.Resolve("btc/usdc")
+	require.NoError(t, err)
+	assert.Equal(t, "BTCUSDC", inst.NativeSymbol)
+	assert.Equal(t, market.QuoteUSDC, inst.Quote)
+	assert.Equal(t, 5.0, inst.MinNotional, "最小名义价值取自 MIN_NOTIONAL filter")
+	assert.Equal(t, 0.001, inst.MinQty, "最小下单数量取自 LOT_SIZE filter")
+
+	_, err = trader.OpenLong(inst.NativeSymbol, 0.01, 10)
+	require.NoError(t, err)
+	assert.InDelta(t, 0.01, sim.Position("BTCUSDC", "LONG").Amount, 1e-9)
+	assert.InDelta(t, 0, sim.Position("BTCUSDT", "LONG").Amount, 1e-9)
+}
+
+func TestExchangeSim_BinanceInvalidSignature(t *testing.T) {
+	sim := exchangesim.NewServer()
+	defer sim.Close()
+	trader := newSimFuturesTrader(t, sim, "wrong-secret-key")
+
+	_, err := trader.GetBalance()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "-1022")
+}
+
+func TestExchangeSim_AsterLifecycle(t *testing.T) {
+	sim := exchangesim.NewServer()
+	defer sim.Close()
+	trader := newSimAsterTrader(t, sim)
+
+	_, err := trader.OpenLong("ETHUSDT", 0.5, 10)
+	require.NoError(t, err)
+	assert.Equal(t, 10, sim.Leverage("ETHUSDT"))
+	assert.InDelta(t, 0.5, sim.Position("ETHUSDT", "BOTH").Amount, 1e-9)
+
+	positions, err := trader.GetPositions()
+	require.NoError(t, err)
+	require.Len(t, positions, 1)
+	assert.Equal(t, "long", positions[0]["side"])
+
+	require.NoError(t, trader.SetTakeProfit("ETHUSDT", "LONG", 0.5, 3100))
+	sim.SetPrice("ETHUSDT", 3150)
+	assert.InDelta(t, 0, sim.Position("ETHUSDT", "BOTH").Amount, 1e-9)
+	assert.InDelta(t, 10000+75, sim.Balance(), 1e-6)
+
+	sim.Script(exchangesim.NextOrder().OnVenue(exchangesim.VenueAster).Reject(-4164, "Order's notional must be no smaller than 5"))
+	_, err = trader.OpenShort("ETHUSDT", 0.5, 10)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "-4164")
+}
+
+func TestExchangeSim_HyperliquidLifecycle(t *testing.T) {
+	sim := exchangesim.NewServer()
+	defer sim.Close()
+	trader := newSimHyperliquidTrader(t, sim, true)
+
+	_, err := trader.OpenLongWithClientID("BTCUSDT", 0.01, 10, "hl-open-1")
+	require.NoError(t, err)
+	assert.Equal(t, 10, sim.Leverage("BTCUSDT"))
+	assert.InDelta(t, 0.01, sim.Position("BTCUSDT", "BOTH").Amount, 1e-9)
+
+	order, err := trader.GetOrderByClientID("BTCUSDT", "hl-open-1")
+	require.NoError(t, err)
+	assert.Equal(t, "FILLED", order["status"])
+
+	positions, err := trader.GetPositions()
+	require.NoError(t, err)
+	require.Len(t, positions, 1)
+	assert.Equal(t, "long", positions[0]["side"])
+	assert.Equal(t, 0.01, positions[0]["positionAmt"])
+
+	require.NoError(t, trader.SetStopLoss("BTCUSDT", "LONG", 0.01, 49000))
+	assert.Len(t, sim.OpenOrders("BTCUSDT"), 1)
+
+	// 止损单在触发时按标记价格成交
+	sim.SetPrice("BTCUSDT", 48500)
+	assert.InDelta(t, 0, sim.Position("BTCUSDT", "BOTH").Amount, 1e-9)
+	assert.InDelta(t, 10000-15, sim.Balance(), 1e-6)
+
+	_, err = trader.GetOrderByClientID("BTCUSDT", "hl-unknown")
+	assert.ErrorIs(t, err, ErrOrderNotFound)
+}
+
+func TestExchangeSim_HyperliquidInstruments(t *testing.T) {
+	sim := exchangesim.NewServer()
+	defer sim.Close()
+	trader := newSimHyperliquidTrader(t, sim, true)
+
+	instruments, err := trader.GetInstruments()
+	require.NoError(t, err)
+	require.Len(t, instruments, 3)
+	for _, inst := range instruments {
+		assert.Equal(t, market.QuoteUSDC, inst.Quote)
+		assert.Equal(t, inst.Base, inst.NativeSymbol, "Hyperliquid 原生符号为币种名")
+		assert.Equal(t, hyperliquidMinOrderValue, inst.MinNotional)
+		assert.Greater(t, inst.MinQty, 0.0)
+	}
+
+	// 规范符号 BTCUSDC 下单，持仓以 USDC 计价返回
+	_, err = trader.OpenShort("BTCUSDC", 0.01, 5)
+	require.NoError(t, err)
+	positions, err := trader.GetPositions()
+	require.NoError(t, err)
+	require.Len(t, positions, 1)
+	assert.Equal(t, "BTCUSDC", positions[0]["symbol"])
+}
+
+func TestExchangeSim_HyperliquidVault(t *testing.T) {
+	sim := exchangesim.NewServer()
+	defer sim.Close()
+
+	vaultAddr := "0xdfc24b077bc1425ad1dea75bcb6f8158e10df303"
+	sim.SetHyperliquidVault(vaultAddr, "0x9999999999999999999999999999999999999999")
+	trader := newSimHyperliquidVaultTrader(t, sim, true, vaultAddr)
+
+	// 订单由 Agent 签名，在子账户/Vault 上执行
+	_, err := trader.OpenLongWithClientID("ETHUSDT", 0.5, 5, "vault-open-1")
+	require.NoError(t, err)
+	assert.InDelta(t, 0.5, sim.Position("ETHUSDT", "BOTH").Amount, 1e-9)
+
+	order, err := trader.GetOrderByClientID("ETHUSDT", "vault-open-1")
+	require.NoError(t, err)
+	assert.Equal(t, "FILLED", order["status"])
+
+	// 余额和持仓从子账户/Vault 地址读取
+	positions, err := trader.GetPositions()
+	require.NoError(t, err)
+	require.Len(t, positions, 1)
+	assert.Equal(t, "long", positions[0]["side"])
+
+	balance, err := trader.GetBalance()
+	require.NoError(t, err)
+	assert.Greater(t, balance["totalWalletBalance"], 0.0)
+
+	// 不指定子账户时在主钱包上交易：主钱包没有资金和持仓
+	direct := newSimHyperliquidTrader(t, sim, true)
+	positions, err = direct.GetPositions()
+	require.NoError(t, err)
+	assert.Empty(t, positions)
+
+	_, err = direct.OpenLong("ETHUSDT", 0.5, 5)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "has no margin")
+}
+
+func TestExchangeSim_HyperliquidScenarios(t *testing.T) {
+	sim := exchangesim.NewServer()
+	defer sim.Close()
+	trader := newSimHyperliquidTrader(t, sim, true)
+
+	sim.Script(exchangesim.NextOrder().OnVenue(exchangesim.VenueHyperliquid).Rest())
+	_, err := trader.OpenShort("ETHUSDT", 0.1, 5)
+	require.Error(t, err, "IOC 订单未成交应返回错误")
+	assert.Contains(t, err.Error(), "could not immediately match")
+
+	sim.Script(exchangesim.NextOrder().AcceptThenFail())
+	_, err = trader.OpenShortWithClientID("ETHUSDT", 0.1, 5, "hl-timeout-1")
+	require.Error(t, err)
+	assert.True(t, isAmbiguousOrderError(err))
+
+	order, err := trader.GetOrderByClientID("ETHUSDT", "hl-timeout-1")
+	require.NoError(t, err)
+	assert.Equal(t, "FILLED", order["status"])
+	assert.InDelta(t, -0.1, sim.Position("ETHUSDT", "BOTH").Amount, 1e-9)
+}
+
+func TestExchangeSim_HyperliquidUnknownAgent(t *testing.T) {
+	sim := exchangesim.NewServer()
+	defer sim.Close()
+	trader := newSimHyperliquidTrader(t, sim, false)
+
+	_, err := trader.OpenLong("BTCUSDT", 0.01, 10)
+	require.Error(t, err)
+	assert.True(t, strings.Contains(err.Error(), "does not exist"))
+	assert.Empty(t, sim.Orders())
+}
+
+func TestExchangeSim_Latency(t *testing.T) {
+	sim := exchangesim.NewServer()
+	defer sim.Close()
+	trader := newSimFuturesTrader(t, sim, "sim-secret-key")
+
+	sim.SetLatency(50 * time.Millisecond)
+	start := time.Now()
+	_, err := trader.GetMarketPrice("BTCUSDT")
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+}
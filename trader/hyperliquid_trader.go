@@ -6,26 +6,34 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"math"
+	"nofx/market"
 	"strconv"
 	"strings"
 	"sync"
 
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/sonirico/go-hyperliquid"
 )
 
+// hyperliquidMinOrderValue Hyperliquid 订单最小价值（USDC）
+const hyperliquidMinOrderValue = 10.0
+
 // HyperliquidTrader Hyperliquid交易器
 type HyperliquidTrader struct {
 	exchange      *hyperliquid.Exchange
 	ctx           context.Context
 	walletAddr    string
+	vaultAddr     string            // 子账户/Vault地址（为空时在主钱包交易）
 	meta          *hyperliquid.Meta // 缓存meta信息（包含精度等）
 	metaMutex     sync.RWMutex      // 保护meta字段的并发访问
 	isCrossMargin bool              // 是否为全仓模式
 }
 
 // NewHyperliquidTrader 创建Hyperliquid交易器
-func NewHyperliquidTrader(privateKeyHex string, walletAddr string, testnet bool) (*HyperliquidTrader, error) {
+// vaultAddr 可选：子账户或Vault地址。设置后订单仍由Agent钱包签名，但在该地址上执行，余额和持仓也从该地址读取
+func NewHyperliquidTrader(privateKeyHex string, walletAddr string, vaultAddr string, testnet bool) (*HyperliquidTrader, error) {
 	// 去掉私钥的 0x 前缀（如果有，不区分大小写）
 	privateKeyHex = strings.TrimPrefix(strings.ToLower(privateKeyHex), "0x")
 
@@ -54,6 +62,18 @@ func NewHyperliquidTrader(privateKeyHex string, walletAddr string, testnet bool)
 			"   https://app.hyperliquid.xyz/ → Settings → API Wallets")
 	}
 
+	// Sub-account / Vault target (optional)
+	vaultAddr = strings.TrimSpace(vaultAddr)
+	if vaultAddr != "" {
+		if !common.IsHexAddress(vaultAddr) {
+			return nil, fmt.Errorf("无效的子账户/Vault地址: %s", vaultAddr)
+		}
+		if strings.EqualFold(vaultAddr, walletAddr) {
+			log.Printf("⚠️ 子账户/Vault地址与主钱包地址相同，忽略该配置")
+			vaultAddr = ""
+		}
+	}
+
 	// Check if user accidentally uses main wallet private key (security risk)
 	if strings.EqualFold(walletAddr, agentAddr) {
 		log.Printf("⚠️⚠️⚠️ WARNING: Main wallet address (%s) matches Agent wallet address!", walletAddr)
@@ -65,21 +85,34 @@ func NewHyperliquidTrader(privateKeyHex string, walletAddr string, testnet bool)
 		log.Printf("  └─ Agent wallet address: %s (for signing)", agentAddr)
 		log.Printf("  └─ Main wallet address: %s (holds funds)", walletAddr)
 	}
+	if vaultAddr != "" {
+		log.Printf("  └─ Sub-account/Vault address: %s (orders executed here)", vaultAddr)
+	}
 
 	ctx := context.Background()
 
+	// 交易账户：配置了子账户/Vault时为该地址，否则为主钱包
+	accountAddr := walletAddr
+	if vaultAddr != "" {
+		accountAddr = vaultAddr
+	}
+
 	// 创建Exchange客户端（Exchange包含Info功能）
 	exchange := hyperliquid.NewExchange(
 		ctx,
 		privateKey,
 		apiURL,
-		nil,        // Meta will be fetched automatically
-		"",         // vault address (empty for personal account)
-		walletAddr, // wallet address
-		nil,        // SpotMeta will be fetched automatically
+		nil,         // Meta will be fetched automatically
+		vaultAddr,   // vault / sub-account address (empty for personal account)
+		accountAddr, // trading account address
+		nil,         // SpotMeta will be fetched automatically
 	)
 
-	log.Printf("✓ Hyperliquid交易器初始化成功 (testnet=%v, wallet=%s)", testnet, walletAddr)
+	if vaultAddr != "" {
+		log.Printf("✓ Hyperliquid交易器初始化成功 (testnet=%v, wallet=%s, vault=%s)", testnet, walletAddr, vaultAddr)
+	} else {
+		log.Printf("✓ Hyperliquid交易器初始化成功 (testnet=%v, wallet=%s)", testnet, walletAddr)
+	}
 
 	// 获取meta信息（包含精度等配置）
 	meta, err := exchange.Info().Meta(ctx)
@@ -124,17 +157,26 @@ func NewHyperliquidTrader(privateKeyHex string, walletAddr string, testnet bool)
 		exchange:      exchange,
 		ctx:           ctx,
 		walletAddr:    walletAddr,
+		vaultAddr:     vaultAddr,
 		meta:          meta,
 		isCrossMargin: true, // 默认使用全仓模式
 	}, nil
 }
 
+// accountAddr 实际交易账户地址（余额、持仓、订单查询都使用该地址）
+func (t *HyperliquidTrader) accountAddr() string {
+	if t.vaultAddr != "" {
+		return t.vaultAddr
+	}
+	return t.walletAddr
+}
+
 // GetBalance 获取账户余额
 func (t *HyperliquidTrader) GetBalance() (map[string]interface{}, error) {
 	log.Printf("🔄 正在调用Hyperliquid API获取账户余额...")
 
 	// ✅ Step 1: 查询 Spot 现货账户余额
-	spotState, err := t.exchange.Info().SpotUserState(t.ctx, t.walletAddr)
+	spotState, err := t.exchange.Info().SpotUserState(t.ctx, t.accountAddr())
 	var spotUSDCBalance float64 = 0.0
 	if err != nil {
 		log.Printf("⚠️ 查询 Spot 余额失败（可能无现货资产）: %v", err)
@@ -149,7 +191,7 @@ func (t *HyperliquidTrader) GetBalance() (map[string]interface{}, error) {
 	}
 
 	// ✅ Step 2: 查询 Perpetuals 合约账户状态
-	accountState, err := t.exchange.Info().UserState(t.ctx, t.walletAddr)
+	accountState, err := t.exchange.Info().UserState(t.ctx, t.accountAddr())
 	if err != nil {
 		log.Printf("❌ Hyperliquid Perpetuals API调用失败: %v", err)
 		return nil, fmt.Errorf("获取账户信息失败: %w", err)
@@ -245,7 +287,7 @@ func (t *HyperliquidTrader) GetBalance() (map[string]interface{}, error) {
 // GetPositions 获取所有持仓
 func (t *HyperliquidTrader) GetPositions() ([]map[string]interface{}, error) {
 	// 获取账户状态
-	accountState, err := t.exchange.Info().UserState(t.ctx, t.walletAddr)
+	accountState, err := t.exchange.Info().UserState(t.ctx, t.accountAddr())
 	if err != nil {
 		return nil, fmt.Errorf("获取持仓失败: %w", err)
 	}
@@ -265,8 +307,8 @@ func (t *HyperliquidTrader) GetPositions() ([]map[string]interface{}, error) {
 
 		posMap := make(map[string]interface{})
 
-		// 标准化symbol格式（Hyperliquid使用如"BTC"，我们转换为"BTCUSDT"）
-		symbol := position.Coin + "USDT"
+		// 标准化symbol格式（Hyperliquid使用如"BTC"、"kPEPE"，我们转换为USDC计价的"BTCUSDC"、"KPEPEUSDC"）
+		symbol := strings.ToUpper(position.Coin) + market.QuoteUSDC
 		posMap["symbol"] = symbol
 
 		// 持仓数量和方向
@@ -308,6 +350,41 @@ func (t *HyperliquidTrader) GetPositions() ([]map[string]interface{}, error) {
 	return result, nil
 }
 
+// GetPositionMode 获取持仓模式
+// Hyperliquid 只支持单向持仓（净仓位），平仓和止盈止损使用 reduceOnly
+func (t *HyperliquidTrader) GetPositionMode() string {
+	return PositionModeOneWay
+}
+
+// GetInstruments 获取可交易的永续合约列表（Hyperliquid 统一以USDC结算）
+func (t *HyperliquidTrader) GetInstruments() ([]market.Instrument, error) {
+	meta, err := t.exchange.Info().Meta(t.ctx)
+	if err != nil {
+		return nil, fmt.Errorf("获取meta信息失败: %w", err)
+	}
+
+	t.metaMutex.Lock()
+	t.meta = meta
+	t.metaMutex.Unlock()
+
+	instruments := make([]market.Instrument, 0, len(meta.Universe))
+	for _, asset := range meta.Universe {
+		if asset.IsDelisted {
+			continue
+		}
+		instruments = append(instruments, market.Instrument{
+			Base:         strings.ToUpper(asset.Name), // 系统内部统一大写，下单时通过 NativeSymbol 还原（如 kPEPE）
+			Quote:        market.QuoteUSDC,
+			Exchange:     "hyperliquid",
+			NativeSymbol: asset.Name,
+			ContractType: market.ContractPerpetual,
+			MinNotional:  hyperliquidMinOrderValue,
+			MinQty:       math.Pow10(-asset.SzDecimals),
+		})
+	}
+	return instruments, nil
+}
+
 // SetMarginMode 设置仓位模式 (在SetLeverage时一并设置)
 func (t *HyperliquidTrader) SetMarginMode(symbol string, isCrossMargin bool) error {
 	// Hyperliquid的仓位模式在SetLeverage时设置，这里只记录
@@ -322,8 +399,8 @@ func (t *HyperliquidTrader) SetMarginMode(symbol string, isCrossMargin bool) err
 
 // SetLeverage 设置杠杆
 func (t *HyperliquidTrader) SetLeverage(symbol string, leverage int) error {
-	// Hyperliquid symbol格式（去掉USDT后缀）
-	coin := convertSymbolToHyperliquid(symbol)
+	// Hyperliquid symbol格式（去掉计价资产后缀）
+	coin := t.coinFor(symbol)
 
 	// 调用UpdateLeverage (leverage int, name string, isCross bool)
 	// 第三个参数: true=全仓模式, false=逐仓模式
@@ -373,6 +450,11 @@ func (t *HyperliquidTrader) refreshMetaIfNeeded(coin string) error {
 
 // OpenLong 开多仓
 func (t *HyperliquidTrader) OpenLong(symbol string, quantity float64, leverage int) (map[string]interface{}, error) {
+	return t.OpenLongWithClientID(symbol, quantity, leverage, "")
+}
+
+// OpenLongWithClientID 使用指定客户端订单ID开多仓（映射为 Hyperliquid cloid）
+func (t *HyperliquidTrader) OpenLongWithClientID(symbol string, quantity float64, leverage int, clientOrderID string) (map[string]interface{}, error) {
 	// 先取消该币种的所有委托单
 	if err := t.CancelAllOrders(symbol); err != nil {
 		log.Printf("  ⚠ 取消旧委托单失败: %v", err)
@@ -384,7 +466,7 @@ func (t *HyperliquidTrader) OpenLong(symbol string, quantity float64, leverage i
 	}
 
 	// Hyperliquid symbol格式
-	coin := convertSymbolToHyperliquid(symbol)
+	coin := t.coinFor(symbol)
 
 	// 获取当前价格（用于市价单）
 	price, err := t.GetMarketPrice(symbol)
@@ -411,7 +493,8 @@ func (t *HyperliquidTrader) OpenLong(symbol string, quantity float64, leverage i
 				Tif: hyperliquid.TifIoc, // Immediate or Cancel (类似市价单)
 			},
 		},
-		ReduceOnly: false,
+		ReduceOnly:    false,
+		ClientOrderID: hyperliquidCloid(clientOrderID), // 重试时复用同一cloid
 	}
 
 	_, err = t.exchange.Order(t.ctx, order, nil)
@@ -431,6 +514,11 @@ func (t *HyperliquidTrader) OpenLong(symbol string, quantity float64, leverage i
 
 // OpenShort 开空仓
 func (t *HyperliquidTrader) OpenShort(symbol string, quantity float64, leverage int) (map[string]interface{}, error) {
+	return t.OpenShortWithClientID(symbol, quantity, leverage, "")
+}
+
+// OpenShortWithClientID 使用指定客户端订单ID开空仓（映射为 Hyperliquid cloid）
+func (t *HyperliquidTrader) OpenShortWithClientID(symbol string, quantity float64, leverage int, clientOrderID string) (map[string]interface{}, error) {
 	// 先取消该币种的所有委托单
 	if err := t.CancelAllOrders(symbol); err != nil {
 		log.Printf("  ⚠ 取消旧委托单失败: %v", err)
@@ -442,7 +530,7 @@ func (t *HyperliquidTrader) OpenShort(symbol string, quantity float64, leverage
 	}
 
 	// Hyperliquid symbol格式
-	coin := convertSymbolToHyperliquid(symbol)
+	coin := t.coinFor(symbol)
 
 	// 获取当前价格
 	price, err := t.GetMarketPrice(symbol)
@@ -469,7 +557,8 @@ func (t *HyperliquidTrader) OpenShort(symbol string, quantity float64, leverage
 				Tif: hyperliquid.TifIoc,
 			},
 		},
-		ReduceOnly: false,
+		ReduceOnly:    false,
+		ClientOrderID: hyperliquidCloid(clientOrderID),
 	}
 
 	_, err = t.exchange.Order(t.ctx, order, nil)
@@ -509,7 +598,7 @@ func (t *HyperliquidTrader) CloseLong(symbol string, quantity float64) (map[stri
 	}
 
 	// Hyperliquid symbol格式
-	coin := convertSymbolToHyperliquid(symbol)
+	coin := t.coinFor(symbol)
 
 	// 获取当前价格
 	price, err := t.GetMarketPrice(symbol)
@@ -581,7 +670,7 @@ func (t *HyperliquidTrader) CloseShort(symbol string, quantity float64) (map[str
 	}
 
 	// Hyperliquid symbol格式
-	coin := convertSymbolToHyperliquid(symbol)
+	coin := t.coinFor(symbol)
 
 	// 获取当前价格
 	price, err := t.GetMarketPrice(symbol)
@@ -631,7 +720,49 @@ func (t *HyperliquidTrader) CloseShort(symbol string, quantity float64) (map[str
 	return result, nil
 }
 
-// CancelStopOrders 取消该币种的止盈/止
+// GetOrderByClientID 按客户端订单ID查询订单（通过 cloid 查询 orderStatus）
+func (t *HyperliquidTrader) GetOrderByClientID(symbol string, clientOrderID string) (map[string]interface{}, error) {
+	cloid := hyperliquidCloid(clientOrderID)
+	if cloid == nil {
+		return nil, ErrOrderNotFound
+	}
+
+	queryResult, err := t.exchange.Info().QueryOrderByCloid(t.ctx, t.accountAddr(), *cloid)
+	if err != nil {
+		return nil, fmt.Errorf("查询订单失败: %w", err)
+	}
+	if queryResult.Status != hyperliquid.OrderQueryStatusSuccess {
+		return nil, ErrOrderNotFound
+	}
+
+	queried := queryResult.Order
+	origSz, _ := strconv.ParseFloat(queried.Order.OrigSz, 64)
+	remainingSz, _ := strconv.ParseFloat(queried.Order.Sz, 64)
+
+	result := make(map[string]interface{})
+	result["orderId"] = queried.Order.Oid
+	result["symbol"] = symbol
+	result["status"] = convertHyperliquidOrderStatus(queried.Status)
+	result["executedQty"] = origSz - remainingSz
+	return result, nil
+}
+
+// convertHyperliquidOrderStatus 将 Hyperliquid 订单状态转换为统一状态（与币安一致）
+func convertHyperliquidOrderStatus(status hyperliquid.OrderStatusValue) string {
+	switch status {
+	case hyperliquid.OrderStatusValueOpen:
+		return "NEW"
+	case hyperliquid.OrderStatusValueFilled, hyperliquid.OrderStatusValueTriggered:
+		return "FILLED"
+	case hyperliquid.OrderStatusValueCanceled:
+		return "CANCELED"
+	}
+	if strings.HasSuffix(string(status), "Rejected") {
+		return "REJECTED"
+	}
+	// 其他 xxxCanceled 状态（保证金不足、自成交等）统一视为已取消
+	return "CANCELED"
+}
 
 // CancelStopLossOrders 仅取消止损单（Hyperliquid 暂无法区分止损和止盈，取消所有）
 func (t *HyperliquidTrader) CancelStopLossOrders(symbol string) error {
@@ -651,10 +782,10 @@ func (t *HyperliquidTrader) CancelTakeProfitOrders(symbol string) error {
 
 // CancelAllOrders 取消该币种的所有挂单
 func (t *HyperliquidTrader) CancelAllOrders(symbol string) error {
-	coin := convertSymbolToHyperliquid(symbol)
+	coin := t.coinFor(symbol)
 
 	// 获取所有挂单
-	openOrders, err := t.exchange.Info().OpenOrders(t.ctx, t.walletAddr)
+	openOrders, err := t.exchange.Info().OpenOrders(t.ctx, t.accountAddr())
 	if err != nil {
 		return fmt.Errorf("获取挂单失败: %w", err)
 	}
@@ -675,10 +806,10 @@ func (t *HyperliquidTrader) CancelAllOrders(symbol string) error {
 
 // CancelStopOrders 取消该币种的止盈/止损单（用于调整止盈止损位置）
 func (t *HyperliquidTrader) CancelStopOrders(symbol string) error {
-	coin := convertSymbolToHyperliquid(symbol)
+	coin := t.coinFor(symbol)
 
 	// 获取所有挂单
-	openOrders, err := t.exchange.Info().OpenOrders(t.ctx, t.walletAddr)
+	openOrders, err := t.exchange.Info().OpenOrders(t.ctx, t.accountAddr())
 	if err != nil {
 		return fmt.Errorf("获取挂单失败: %w", err)
 	}
@@ -709,7 +840,7 @@ func (t *HyperliquidTrader) CancelStopOrders(symbol string) error {
 
 // GetMarketPrice 获取市场价格
 func (t *HyperliquidTrader) GetMarketPrice(symbol string) (float64, error) {
-	coin := convertSymbolToHyperliquid(symbol)
+	coin := t.coinFor(symbol)
 
 	// 获取所有市场价格
 	allMids, err := t.exchange.Info().AllMids(t.ctx)
@@ -731,7 +862,7 @@ func (t *HyperliquidTrader) GetMarketPrice(symbol string) (float64, error) {
 
 // SetStopLoss 设置止损单
 func (t *HyperliquidTrader) SetStopLoss(symbol string, positionSide string, quantity, stopPrice float64) error {
-	coin := convertSymbolToHyperliquid(symbol)
+	coin := t.coinFor(symbol)
 
 	isBuy := positionSide == "SHORT" // 空仓止损=买入，多仓止损=卖出
 
@@ -768,7 +899,7 @@ func (t *HyperliquidTrader) SetStopLoss(symbol string, positionSide string, quan
 
 // SetTakeProfit 设置止盈单
 func (t *HyperliquidTrader) SetTakeProfit(symbol string, positionSide string, quantity, takeProfitPrice float64) error {
-	coin := convertSymbolToHyperliquid(symbol)
+	coin := t.coinFor(symbol)
 
 	isBuy := positionSide == "SHORT" // 空仓止盈=买入，多仓止盈=卖出
 
@@ -805,7 +936,7 @@ func (t *HyperliquidTrader) SetTakeProfit(symbol string, positionSide string, qu
 
 // FormatQuantity 格式化数量到正确的精度
 func (t *HyperliquidTrader) FormatQuantity(symbol string, quantity float64) (string, error) {
-	coin := convertSymbolToHyperliquid(symbol)
+	coin := t.coinFor(symbol)
 	szDecimals := t.getSzDecimals(coin)
 
 	// 使用szDecimals格式化数量
@@ -887,14 +1018,29 @@ func (t *HyperliquidTrader) roundPriceToSigfigs(price float64) float64 {
 	return rounded
 }
 
-// convertSymbolToHyperliquid 将标准symbol转换为Hyperliquid格式
-// 例如: "BTCUSDT" -> "BTC"
-func convertSymbolToHyperliquid(symbol string) string {
-	// 去掉USDT后缀
-	if len(symbol) > 4 && symbol[len(symbol)-4:] == "USDT" {
-		return symbol[:len(symbol)-4]
+// coinFor 将标准symbol转换为Hyperliquid币种名
+// Hyperliquid 币种名区分大小写（如 kPEPE、kSHIB），按 meta 中的品种列表还原真实写法，找不到时使用大写的基础资产
+func (t *HyperliquidTrader) coinFor(symbol string) string {
+	base := convertSymbolToHyperliquid(symbol)
+
+	t.metaMutex.RLock()
+	defer t.metaMutex.RUnlock()
+	if t.meta != nil {
+		for _, asset := range t.meta.Universe {
+			if strings.EqualFold(asset.Name, base) {
+				return asset.Name
+			}
+		}
 	}
-	return symbol
+	return base
+}
+
+// convertSymbolToHyperliquid 将标准symbol转换为Hyperliquid格式（大写的基础资产，真实写法见 coinFor）
+// 例如: "BTCUSDT" / "BTCUSDC" -> "BTC"
+func convertSymbolToHyperliquid(symbol string) string {
+	// 去掉计价资产后缀（Hyperliquid 永续合约统一以USDC结算）
+	base, _ := market.SplitSymbol(symbol)
+	return base
 }
 
 // absFloat 返回浮点数的绝对值
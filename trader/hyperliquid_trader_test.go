@@ -271,6 +271,7 @@ func TestNewHyperliquidTrader(t *testing.T) {
 		name          string
 		privateKeyHex string
 		walletAddr    string
+		vaultAddr     string
 		testnet       bool
 		wantError     bool
 		errorContains string
@@ -291,11 +292,20 @@ func TestNewHyperliquidTrader(t *testing.T) {
 			wantError:     true,
 			errorContains: "Configuration error",
 		},
+		{
+			name:          "子账户地址无效",
+			privateKeyHex: "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef",
+			walletAddr:    "0x1234567890123456789012345678901234567890",
+			vaultAddr:     "0x1234",
+			testnet:       true,
+			wantError:     true,
+			errorContains: "无效的子账户/Vault地址",
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			trader, err := NewHyperliquidTrader(tt.privateKeyHex, tt.walletAddr, tt.testnet)
+			trader, err := NewHyperliquidTrader(tt.privateKeyHex, tt.walletAddr, tt.vaultAddr, tt.testnet)
 
 			if tt.wantError {
 				assert.Error(t, err)
@@ -413,6 +423,19 @@ func TestConvertSymbolToHyperliquid(t *testing.T) {
 	}
 }
 
+// TestCoinFor 按 meta 还原区分大小写的币种名（如 kPEPE）
+func TestCoinFor(t *testing.T) {
+	trader := &HyperliquidTrader{
+		meta: &hyperliquid.Meta{
+			Universe: []hyperliquid.AssetInfo{{Name: "BTC"}, {Name: "kPEPE"}},
+		},
+	}
+	assert.Equal(t, "kPEPE", trader.coinFor("KPEPEUSDC"))
+	assert.Equal(t, "kPEPE", trader.coinFor("kpepe"))
+	assert.Equal(t, "BTC", trader.coinFor("BTCUSDT"))
+	assert.Equal(t, "SOL", trader.coinFor("SOLUSDC"), "meta中没有的币种使用大写基础资产")
+}
+
 // TestAbsFloat 测试绝对值函数
 func TestAbsFloat(t *testing.T) {
 	tests := []struct {
@@ -1,5 +1,7 @@
 package trader
 
+import "nofx/market"
+
 // Trader 交易器统一接口
 // 支持多个交易平台（币安、Hyperliquid等）
 type Trader interface {
@@ -15,6 +17,16 @@ type Trader interface {
 	// OpenShort 开空仓
 	OpenShort(symbol string, quantity float64, leverage int) (map[string]interface{}, error)
 
+	// OpenLongWithClientID 使用指定客户端订单ID开多仓（重试时复用同一ID，避免重复开仓）
+	OpenLongWithClientID(symbol string, quantity float64, leverage int, clientOrderID string) (map[string]interface{}, error)
+
+	// OpenShortWithClientID 使用指定客户端订单ID开空仓（重试时复用同一ID，避免重复开仓）
+	OpenShortWithClientID(symbol string, quantity float64, leverage int, clientOrderID string) (map[string]interface{}, error)
+
+	// GetOrderByClientID 按客户端订单ID查询订单（不存在时返回 ErrOrderNotFound）
+	// 返回字段: orderId, symbol, status (NEW/PARTIALLY_FILLED/FILLED/CANCELED/REJECTED/EXPIRED), executedQty
+	GetOrderByClientID(symbol string, clientOrderID string) (map[string]interface{}, error)
+
 	// CloseLong 平多仓（quantity=0表示全部平仓）
 	CloseLong(symbol string, quantity float64) (map[string]interface{}, error)
 
@@ -27,6 +39,12 @@ type Trader interface {
 	// SetMarginMode 设置仓位模式 (true=全仓, false=逐仓)
 	SetMarginMode(symbol string, isCrossMargin bool) error
 
+	// GetPositionMode 获取持仓模式 (PositionModeHedge=双向持仓, PositionModeOneWay=单向持仓)
+	GetPositionMode() string
+
+	// GetInstruments 获取交易所当前可交易的品种列表（返回nil表示不校验）
+	GetInstruments() ([]market.Instrument, error)
+
 	// GetMarketPrice 获取市场价格
 	GetMarketPrice(symbol string) (float64, error)
 
@@ -0,0 +1,47 @@
+package trader
+
+import "log"
+
+// 持仓模式
+const (
+	// PositionModeHedge 双向持仓：同一币种可同时持有多仓和空仓，下单需指定 positionSide LONG/SHORT
+	PositionModeHedge = "hedge"
+	// PositionModeOneWay 单向持仓：同一币种只有一个净仓位，平仓和止盈止损使用 reduceOnly
+	PositionModeOneWay = "one_way"
+)
+
+// NormalizePositionMode 根据交易所能力规范化持仓模式配置
+// 币安支持两种模式（默认双向持仓）；Hyperliquid 和 Aster 只支持单向持仓
+func NormalizePositionMode(exchange, mode string) string {
+	switch exchange {
+	case "binance":
+		if mode == PositionModeOneWay {
+			return PositionModeOneWay
+		}
+		if mode != "" && mode != PositionModeHedge {
+			log.Printf("⚠️ 未知的持仓模式 %q，使用默认的双向持仓模式", mode)
+		}
+		return PositionModeHedge
+	default:
+		if mode == PositionModeHedge {
+			log.Printf("⚠️ %s 不支持双向持仓模式，使用单向持仓模式", exchange)
+		}
+		return PositionModeOneWay
+	}
+}
+
+// oppositeSide 返回相反的持仓方向（long <-> short）
+func oppositeSide(side string) string {
+	if side == "long" {
+		return "short"
+	}
+	return "long"
+}
+
+// sideName 持仓方向的中文名称（用于日志）
+func sideName(side string) string {
+	if side == "long" {
+		return "多"
+	}
+	return "空"
+}
@@ -0,0 +1,29 @@
+package trader
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizePositionMode(t *testing.T) {
+	tests := []struct {
+		exchange string
+		mode     string
+		expected string
+	}{
+		{"binance", "", PositionModeHedge},
+		{"binance", "hedge", PositionModeHedge},
+		{"binance", "one_way", PositionModeOneWay},
+		{"binance", "net", PositionModeHedge},
+		{"hyperliquid", "", PositionModeOneWay},
+		{"hyperliquid", "hedge", PositionModeOneWay},
+		{"aster", "one_way", PositionModeOneWay},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.exchange+"_"+tt.mode, func(t *testing.T) {
+			assert.Equal(t, tt.expected, NormalizePositionMode(tt.exchange, tt.mode))
+		})
+	}
+}
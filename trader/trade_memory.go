@@ -0,0 +1,158 @@
+package trader
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"nofx/decision"
+	"nofx/logger"
+	"nofx/mcp"
+)
+
+// exitPriceTolerance 判断止损/止盈是否成交时允许的价格偏差（成交后到下个周期价格可能回摆）
+const exitPriceTolerance = 0.01
+
+// positionExit 持仓的止损止盈价（用于判断交易所自动平仓的触发原因）
+type positionExit struct {
+	StopLoss   float64
+	TakeProfit float64
+}
+
+// trackOpenedPosition 记录新开仓位的止损止盈价并加入持仓快照，开仓后到下个周期之间被止损也能识别
+func (at *AutoTrader) trackOpenedPosition(d *decision.Decision, side string, quantity, price float64) {
+	if !at.config.TradeMemory {
+		return
+	}
+	posKey := d.Symbol + "_" + side
+	at.exitLevels[posKey] = positionExit{StopLoss: d.StopLoss, TakeProfit: d.TakeProfit}
+	at.lastPositions[posKey] = decision.PositionInfo{
+		Symbol:     d.Symbol,
+		Side:       side,
+		EntryPrice: price,
+		MarkPrice:  price,
+		Quantity:   quantity,
+		Leverage:   d.Leverage,
+	}
+}
+
+// detectExchangeCloses 对比上个周期的持仓，把不是AI平掉的持仓记为 auto_close（止盈止损、强平、回撤保护或手动平仓）
+// 识别结果在本周期写入决策记录，交易记忆据此统计完整的交易结果（未启用交易记忆时不识别）
+func (at *AutoTrader) detectExchangeCloses(positions []decision.PositionInfo) {
+	if !at.config.TradeMemory {
+		return
+	}
+	current := make(map[string]decision.PositionInfo, len(positions))
+	for _, pos := range positions {
+		current[pos.Symbol+"_"+pos.Side] = pos
+	}
+
+	for _, key := range closedPositionKeys(at.lastPositions, current) {
+		last := at.lastPositions[key]
+		price, err := at.trader.GetMarketPrice(last.Symbol)
+		if err != nil || price <= 0 {
+			price = last.MarkPrice
+		}
+		action := exchangeCloseAction(last, at.exitLevels[key], price, time.Now())
+		log.Printf("🔔 %s %s 持仓已在周期外平仓: %s", last.Symbol, last.Side, action.Reasoning)
+		at.pendingAutoCloses = append(at.pendingAutoCloses, action)
+	}
+
+	for _, key := range closedPositionKeys(at.exitLevels, current) {
+		delete(at.exitLevels, key)
+	}
+	at.lastPositions = current
+}
+
+// exchangeCloseAction 根据当前价格与止损止盈价推断自动平仓的原因和成交价
+func exchangeCloseAction(pos decision.PositionInfo, exit positionExit, price float64, now time.Time) logger.DecisionAction {
+	var stopHit, takeHit bool
+	if pos.Side == "long" {
+		stopHit = exit.StopLoss > 0 && price <= exit.StopLoss*(1+exitPriceTolerance)
+		takeHit = exit.TakeProfit > 0 && price >= exit.TakeProfit*(1-exitPriceTolerance)
+	} else {
+		stopHit = exit.StopLoss > 0 && price >= exit.StopLoss*(1-exitPriceTolerance)
+		takeHit = exit.TakeProfit > 0 && price <= exit.TakeProfit*(1+exitPriceTolerance)
+	}
+
+	action := logger.DecisionAction{
+		Action:     "auto_close_" + pos.Side,
+		Symbol:     pos.Symbol,
+		Quantity:   pos.Quantity,
+		Leverage:   pos.Leverage,
+		Price:      price,
+		Timestamp:  now,
+		Success:    true,
+		ExitReason: logger.ExitExternal,
+	}
+	switch {
+	case stopHit:
+		action.Price = exit.StopLoss
+		action.ExitReason = logger.ExitStopLoss
+		action.Reasoning = fmt.Sprintf("止损触发 @%.4f", exit.StopLoss)
+	case takeHit:
+		action.Price = exit.TakeProfit
+		action.ExitReason = logger.ExitTakeProfit
+		action.Reasoning = fmt.Sprintf("止盈触发 @%.4f", exit.TakeProfit)
+	default:
+		action.Reasoning = fmt.Sprintf("周期外平仓（强平、回撤保护或手动） @%.4f", price)
+	}
+	return action
+}
+
+// loadReflection 返回最近一次AI复盘（首次调用时从日志目录加载）
+func (at *AutoTrader) loadReflection() *logger.Reflection {
+	if !at.reflectionLoaded {
+		reflection, err := at.decisionLogger.LoadReflection()
+		if err != nil {
+			log.Printf("⚠️  读取AI复盘失败: %v", err)
+		}
+		at.reflection = reflection
+		at.reflectionLoaded = true
+	}
+	return at.reflection
+}
+
+// reflectIfDue 每隔 ReflectionInterval 个周期、且有新的已平仓交易时，让AI复盘并更新交易记忆
+func (at *AutoTrader) reflectIfDue(ctx *decision.Context, record *logger.DecisionRecord, client *mcp.Client) {
+	if !at.config.TradeMemory || at.config.ReflectionInterval <= 0 {
+		return
+	}
+	if at.callCount-at.lastReflectionCycle < at.config.ReflectionInterval {
+		return
+	}
+	performance, ok := ctx.Performance.(*logger.PerformanceAnalysis)
+	if !ok || performance == nil || len(performance.RecentTrades) == 0 {
+		return
+	}
+	latest := performance.RecentTrades[0].CloseTime
+	if previous := at.loadReflection(); previous != nil && !latest.After(previous.LastTradeTime) {
+		return
+	}
+
+	// 失败时也等到下个间隔再重试，避免每个周期重复调用
+	at.lastReflectionCycle = at.callCount
+	start := time.Now()
+	text, err := decision.GenerateReflection(ctx, client)
+	if err != nil {
+		log.Printf("⚠️  AI复盘失败: %v", err)
+		record.ExecutionLog = append(record.ExecutionLog, fmt.Sprintf("⚠️ AI复盘失败: %v", err))
+		return
+	}
+
+	reflection := &logger.Reflection{
+		Text:          text,
+		CycleNumber:   at.callCount,
+		Timestamp:     time.Now(),
+		TradeCount:    len(performance.RecentTrades),
+		LastTradeTime: latest,
+	}
+	if err := at.decisionLogger.SaveReflection(reflection); err != nil {
+		log.Printf("⚠️  保存AI复盘失败: %v", err)
+	}
+	at.reflection = reflection
+	ctx.Reflection = text
+	log.Printf("🧠 AI复盘已更新（%d 笔交易，耗时 %d ms）", reflection.TradeCount, time.Since(start).Milliseconds())
+	record.ExecutionLog = append(record.ExecutionLog,
+		fmt.Sprintf("🧠 AI复盘已更新: %d 笔交易", reflection.TradeCount))
+}
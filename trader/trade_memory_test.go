@@ -0,0 +1,74 @@
+package trader
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"nofx/decision"
+	"nofx/logger"
+)
+
+// TestExchangeCloseAction 根据当前价格与止损止盈价推断自动平仓原因
+func TestExchangeCloseAction(t *testing.T) {
+	now := time.Now()
+	long := decision.PositionInfo{Symbol: "BTCUSDT", Side: "long", Quantity: 0.1, Leverage: 5, MarkPrice: 100000}
+	short := decision.PositionInfo{Symbol: "ETHUSDT", Side: "short", Quantity: 2, Leverage: 3, MarkPrice: 4000}
+
+	cases := []struct {
+		name      string
+		pos       decision.PositionInfo
+		exit      positionExit
+		price     float64
+		wantPrice float64
+		wantExit  string
+	}{
+		{"多仓跌破止损", long, positionExit{StopLoss: 95000, TakeProfit: 110000}, 94800, 95000, logger.ExitStopLoss},
+		{"多仓止损后价格小幅回升", long, positionExit{StopLoss: 95000, TakeProfit: 110000}, 95500, 95000, logger.ExitStopLoss},
+		{"多仓触及止盈", long, positionExit{StopLoss: 95000, TakeProfit: 110000}, 110200, 110000, logger.ExitTakeProfit},
+		{"空仓涨破止损", short, positionExit{StopLoss: 4200, TakeProfit: 3600}, 4210, 4200, logger.ExitStopLoss},
+		{"空仓触及止盈", short, positionExit{StopLoss: 4200, TakeProfit: 3600}, 3590, 3600, logger.ExitTakeProfit},
+		{"价格远离止损止盈", long, positionExit{StopLoss: 95000, TakeProfit: 110000}, 101000, 101000, logger.ExitExternal},
+		{"未记录止损止盈", short, positionExit{}, 3900, 3900, logger.ExitExternal},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			action := exchangeCloseAction(tc.pos, tc.exit, tc.price, now)
+			assert.Equal(t, "auto_close_"+tc.pos.Side, action.Action)
+			assert.Equal(t, tc.wantExit, action.ExitReason)
+			assert.Equal(t, tc.wantPrice, action.Price)
+			assert.Equal(t, tc.pos.Quantity, action.Quantity)
+			assert.True(t, action.Success)
+			assert.NotEmpty(t, action.Reasoning)
+		})
+	}
+}
+
+// TestDetectExchangeCloses AI主动平掉的持仓不计入自动平仓，本周期新开的仓位被止损也能识别
+func (s *AutoTraderTestSuite) TestDetectExchangeCloses() {
+	at := s.autoTrader
+	at.config.TradeMemory = true
+	at.lastPositions = map[string]decision.PositionInfo{
+		"BTCUSDT_long":  {Symbol: "BTCUSDT", Side: "long", Quantity: 0.1, MarkPrice: 100000},
+		"ETHUSDT_short": {Symbol: "ETHUSDT", Side: "short", Quantity: 2, MarkPrice: 4000},
+	}
+	at.trackOpenedPosition(&decision.Decision{Symbol: "SOLUSDT", StopLoss: 140, TakeProfit: 180, Leverage: 3}, "long", 10, 150)
+	delete(at.lastPositions, "ETHUSDT_short") // AI 已主动平仓
+	at.pendingAutoCloses = nil
+
+	at.detectExchangeCloses([]decision.PositionInfo{{Symbol: "BTCUSDT", Side: "long", Quantity: 0.1}})
+
+	s.Require().Len(at.pendingAutoCloses, 1)
+	s.Equal("SOLUSDT", at.pendingAutoCloses[0].Symbol)
+	s.Equal("auto_close_long", at.pendingAutoCloses[0].Action)
+	s.Contains(at.lastPositions, "BTCUSDT_long")
+	s.NotContains(at.exitLevels, "SOLUSDT_long")
+
+	// 未启用交易记忆时不识别，决策记录保持不变
+	at.config.TradeMemory = false
+	at.pendingAutoCloses = nil
+	at.detectExchangeCloses(nil)
+	s.Empty(at.pendingAutoCloses)
+	s.Contains(at.lastPositions, "BTCUSDT_long")
+}